@@ -0,0 +1,206 @@
+// Package adjust 复权：由除权除息事件推导复权因子，并把原始日 K 换算成前/后复权价。
+//
+// 抓取到的日 K 一律是不复权价，原样入库；复权只在读取时换算：
+//   - 后复权（hfq）：原始价 × 累计因子，历史价格不变，最新价随分红送转越来越高；
+//   - 前复权（qfq）：原始价 × 累计因子 / 最新因子，最新价等于实际价，历史价格随每次除权整体下移。
+//
+// 技术指标和规则的窗口条件使用前复权价，这样最新一根的均线可以直接和实际收盘价比较，
+// 除权缺口也不会被当成下跌或突破。
+package adjust
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"oh-my-stock/models"
+)
+
+// Mode 复权方式。
+type Mode string
+
+const (
+	None Mode = "none" // 不复权
+	QFQ  Mode = "qfq"  // 前复权
+	HFQ  Mode = "hfq"  // 后复权
+)
+
+// ParseMode 解析 adjust 参数，空串返回 def。
+func ParseMode(s string, def Mode) (Mode, error) {
+	switch Mode(strings.ToLower(strings.TrimSpace(s))) {
+	case "":
+		return def, nil
+	case None:
+		return None, nil
+	case QFQ:
+		return QFQ, nil
+	case HFQ:
+		return HFQ, nil
+	}
+	return "", fmt.Errorf("adjust 只能是 none / qfq / hfq")
+}
+
+// RefPrice 除权除息参考价：
+//
+//	(前收盘 - 每股派现 + 配股价 × 每股配股) / (1 + 每股送股 + 每股转增 + 每股配股)
+func RefPrice(prevClose float64, a models.StockCorporateAction) float64 {
+	return (prevClose - a.CashDividend + a.RightsPrice*a.RightsRatio) /
+		(1 + a.BonusRatio + a.TransferRatio + a.RightsRatio)
+}
+
+// Factors 由日 K（顺序不限）和除权除息事件推导后复权累计因子，按 ExDate 升序。
+//
+// 每次除权的单次因子 = 除权日前一根 K 线收盘价 / 参考价。
+// 早于第一根 K 线（没有前收盘）或晚于最后一根 K 线（尚未生效）的事件跳过；
+// 参考价不为正的异常事件也跳过。
+func Factors(symbol string, rows []models.StockDailyData, acts []models.StockCorporateAction) []models.StockAdjFactor {
+	if len(rows) == 0 || len(acts) == 0 {
+		return nil
+	}
+	bars := make([]models.StockDailyData, len(rows))
+	copy(bars, rows)
+	sort.Slice(bars, func(i, j int) bool { return bars[i].TradeDate.Before(bars[j].TradeDate) })
+	events := make([]models.StockCorporateAction, len(acts))
+	copy(events, acts)
+	sort.Slice(events, func(i, j int) bool { return events[i].ExDate.Before(events[j].ExDate) })
+
+	last := bars[len(bars)-1].TradeDate
+	f := 1.0
+	var out []models.StockAdjFactor
+	for _, a := range events {
+		if a.ExDate.After(last) {
+			break
+		}
+		// 除权日前一根 K 线
+		p := sort.Search(len(bars), func(i int) bool { return !bars[i].TradeDate.Before(a.ExDate) }) - 1
+		if p < 0 || bars[p].Close <= 0 {
+			continue
+		}
+		ref := RefPrice(bars[p].Close, a)
+		if ref <= 0 || math.IsNaN(ref) || math.IsInf(ref, 0) {
+			continue
+		}
+		f *= bars[p].Close / ref
+		out = append(out, models.StockAdjFactor{Symbol: symbol, ExDate: a.ExDate, Factor: f})
+	}
+	return out
+}
+
+// Adjuster 按日期查询复权因子。零值（没有因子）等价于不复权。
+type Adjuster struct {
+	dates   []time.Time
+	factors []float64
+}
+
+// New 由 Factors 的结果（顺序不限）构造 Adjuster。
+func New(fs []models.StockAdjFactor) *Adjuster {
+	sorted := make([]models.StockAdjFactor, len(fs))
+	copy(sorted, fs)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ExDate.Before(sorted[j].ExDate) })
+	a := &Adjuster{}
+	for _, f := range sorted {
+		a.dates = append(a.dates, f.ExDate)
+		a.factors = append(a.factors, f.Factor)
+	}
+	return a
+}
+
+// Factor 日期 d 的后复权累计因子。
+func (a *Adjuster) Factor(d time.Time) float64 {
+	i := sort.Search(len(a.dates), func(i int) bool { return a.dates[i].After(d) }) - 1
+	if i < 0 {
+		return 1
+	}
+	return a.factors[i]
+}
+
+// Latest 最新因子。
+func (a *Adjuster) Latest() float64 {
+	if len(a.factors) == 0 {
+		return 1
+	}
+	return a.factors[len(a.factors)-1]
+}
+
+// Ratio 日期 d 的原始价换算成 m 复权价要乘的系数。
+func (a *Adjuster) Ratio(d time.Time, m Mode) float64 {
+	switch m {
+	case QFQ:
+		return a.Factor(d) / a.Latest()
+	case HFQ:
+		return a.Factor(d)
+	}
+	return 1
+}
+
+// Apply 返回 rows 的 m 复权副本（顺序与 rows 一致，不修改入参）。
+//
+// 换算开高低收；成交量、成交额、换手率保持原值。
+// 除权日当根的涨跌额/涨跌幅按复权后的前收盘重算，其余 K 线的涨跌幅本就不受复权影响。
+func (a *Adjuster) Apply(rows []models.StockDailyData, m Mode) []models.StockDailyData {
+	out := make([]models.StockDailyData, len(rows))
+	copy(out, rows)
+	if m == None || len(a.factors) == 0 {
+		return out
+	}
+	idx := make([]int, len(out))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(i, j int) bool { return out[idx[i]].TradeDate.Before(out[idx[j]].TradeDate) })
+
+	prevClose, prevFactor := 0.0, 0.0
+	for _, i := range idx {
+		r := &out[i]
+		f := a.Factor(r.TradeDate)
+		k := a.Ratio(r.TradeDate, m)
+		r.Open = round4(r.Open * k)
+		r.High = round4(r.High * k)
+		r.Low = round4(r.Low * k)
+		r.Close = round4(r.Close * k)
+		if prevFactor != 0 && f != prevFactor && prevClose != 0 {
+			r.ChangeAmount = round4(r.Close - prevClose)
+			r.ChangePercent = round4((r.Close - prevClose) / prevClose * 100)
+		}
+		prevClose, prevFactor = r.Close, f
+	}
+	return out
+}
+
+// Rebase 把入库的指标（按前复权价计算）换算到 m 复权口径。
+//
+// 均线、布林、MACD、ATR 等价格量纲的指标按比例缩放；
+// KDJ / RSI / WR / CCI / DMI 是比值，OBV 是成交量，均不受影响。
+// VWAP 由成交额/成交量直接得出，本身是不复权价，按不复权 → m 换算。
+func (a *Adjuster) Rebase(ind models.StockIndicator, m Mode) models.StockIndicator {
+	if len(a.factors) == 0 {
+		return ind
+	}
+	d := ind.CalcDate
+	k := a.Ratio(d, m) / a.Ratio(d, QFQ)
+	if k != 1 {
+		for _, p := range []**float64{
+			&ind.MA5, &ind.MA10, &ind.MA20, &ind.MA60, &ind.MA120, &ind.MA250,
+			&ind.MACD, &ind.DIF, &ind.DEA,
+			&ind.BollUpper, &ind.BollMid, &ind.BollLower, &ind.ATR14,
+		} {
+			*p = scaled(*p, k)
+		}
+	}
+	ind.VWAP = scaled(ind.VWAP, a.Ratio(d, m))
+	return ind
+}
+
+func scaled(p *float64, k float64) *float64 {
+	if p == nil || k == 1 {
+		return p
+	}
+	v := round4(*p * k)
+	return &v
+}
+
+func round4(v float64) float64 {
+	return math.Round(v*10000) / 10000
+}
@@ -0,0 +1,109 @@
+package adjust
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"oh-my-stock/models"
+)
+
+func approx(a, b float64) bool { return math.Abs(a-b) < 1e-4 }
+
+func day(n int) time.Time { return time.Date(2024, 6, n, 0, 0, 0, 0, time.UTC) }
+
+func bars(closes ...float64) []models.StockDailyData {
+	out := make([]models.StockDailyData, len(closes))
+	for i, c := range closes {
+		out[i] = models.StockDailyData{Symbol: "600000", TradeDate: day(i + 1), Open: c, High: c, Low: c, Close: c}
+	}
+	return out
+}
+
+func TestRefPrice(t *testing.T) {
+	// 10 派 3 送 2 转 3，前收 10.3：(10.3 - 0.3) / 1.5
+	a := models.StockCorporateAction{CashDividend: 0.3, BonusRatio: 0.2, TransferRatio: 0.3}
+	if got := RefPrice(10.3, a); !approx(got, 10/1.5) {
+		t.Fatalf("RefPrice = %v", got)
+	}
+	// 10 配 3，配股价 5：(10 + 5*0.3) / 1.3
+	a = models.StockCorporateAction{RightsRatio: 0.3, RightsPrice: 5}
+	if got := RefPrice(10, a); !approx(got, 11.5/1.3) {
+		t.Fatalf("RefPrice rights = %v", got)
+	}
+}
+
+func TestFactors_SkipsOutOfRange(t *testing.T) {
+	rows := bars(10, 10, 5, 5)
+	acts := []models.StockCorporateAction{
+		{ExDate: day(1), CashDividend: 1},  // 没有前收盘
+		{ExDate: day(3), TransferRatio: 1}, // 10 转 10，前收 10 → 参考价 5
+		{ExDate: day(9), CashDividend: 1},  // 尚未生效
+	}
+	fs := Factors("600000", rows, acts)
+	if len(fs) != 1 || !fs[0].ExDate.Equal(day(3)) || !approx(fs[0].Factor, 2) {
+		t.Fatalf("factors = %+v", fs)
+	}
+}
+
+func TestApply_QFQAndHFQ(t *testing.T) {
+	rows := bars(10, 10, 5, 5.5) // 第 3 天 10 转 10
+	a := New(Factors("600000", rows, []models.StockCorporateAction{{ExDate: day(3), TransferRatio: 1}}))
+
+	q := a.Apply(rows, QFQ)
+	if !approx(q[0].Close, 5) || !approx(q[3].Close, 5.5) {
+		t.Fatalf("qfq = %v %v", q[0].Close, q[3].Close)
+	}
+	// 除权日不再是 -50%
+	if !approx(q[2].ChangePercent, 0) {
+		t.Fatalf("qfq 除权日涨跌幅 = %v", q[2].ChangePercent)
+	}
+
+	h := a.Apply(rows, HFQ)
+	if !approx(h[0].Close, 10) || !approx(h[3].Close, 11) {
+		t.Fatalf("hfq = %v %v", h[0].Close, h[3].Close)
+	}
+
+	n := a.Apply(rows, None)
+	if n[0].Close != 10 || rows[0].Close != 10 {
+		t.Fatalf("none 或入参被修改: %v %v", n[0].Close, rows[0].Close)
+	}
+}
+
+func TestApply_NoFactors(t *testing.T) {
+	rows := bars(10, 11)
+	got := New(nil).Apply(rows, QFQ)
+	if got[1].Close != 11 {
+		t.Fatalf("无因子应原样返回: %v", got[1].Close)
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	if m, err := ParseMode("", QFQ); err != nil || m != QFQ {
+		t.Fatalf("默认值: %v %v", m, err)
+	}
+	if m, err := ParseMode("HFQ", None); err != nil || m != HFQ {
+		t.Fatalf("大小写: %v %v", m, err)
+	}
+	if _, err := ParseMode("bfq", None); err == nil {
+		t.Fatal("非法值应报错")
+	}
+}
+
+func TestRebase(t *testing.T) {
+	rows := bars(10, 10, 5, 5)
+	a := New(Factors("600000", rows, []models.StockCorporateAction{{ExDate: day(3), TransferRatio: 1}}))
+	ma, rsi, vwap := 5.0, 60.0, 10.0
+	ind := models.StockIndicator{CalcDate: day(1), MA5: &ma, RSI6: &rsi, VWAP: &vwap}
+
+	if got := a.Rebase(ind, QFQ); *got.MA5 != 5 || *got.VWAP != 5 {
+		t.Fatalf("qfq: ma5=%v vwap=%v", *got.MA5, *got.VWAP)
+	}
+	got := a.Rebase(ind, None)
+	if *got.MA5 != 10 || *got.RSI6 != 60 || *got.VWAP != 10 || ma != 5 {
+		t.Fatalf("none: ma5=%v rsi6=%v vwap=%v", *got.MA5, *got.RSI6, *got.VWAP)
+	}
+	if got := a.Rebase(ind, HFQ); *got.MA5 != 10 {
+		t.Fatalf("hfq: ma5=%v", *got.MA5)
+	}
+}
@@ -0,0 +1,318 @@
+package alerts
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"oh-my-stock/models"
+)
+
+// ============================================================
+// 单只股票的价格 / 指标提醒：判断条件是否成立（纯函数，不读库）。
+//
+//   price_cross   收盘价穿越 threshold：above 上穿（前收 < 价位 <= 现价）、below 下穿
+//   pct_move      相对参考收盘价（ref_close，空 = 前一交易日收盘）的涨跌幅达到 threshold%：
+//                 up 涨、down 跌、any 任一方向
+//   volume_spike  成交量 >= 前 5 个交易日均量 × threshold
+//   rsi_zone      RSI(period) 进入区间：above 由下往上到达 threshold（超买）、below 由上往下（超卖）
+//   boll_touch    最高价触及上轨（upper）/ 最低价触及下轨（lower）
+//
+// 「穿越」「进入」都是和前一根 K 线比，已经在区间里的不会每根都触发；
+// 盘中增量抓取会反复刷新当天这根，同一根上是否再次触发由冷却时间控制（见 runner.go）。
+// K 线按前复权价传入，前一根和当天在同一口径，除权日不会误判穿越；最新一根的前复权价即原始价。
+// ============================================================
+
+// 提醒类型
+const (
+	KindPriceCross  = "price_cross"
+	KindPctMove     = "pct_move"
+	KindVolumeSpike = "volume_spike"
+	KindRSIZone     = "rsi_zone"
+	KindBollTouch   = "boll_touch"
+)
+
+// 方向
+const (
+	DirAbove = "above"
+	DirBelow = "below"
+	DirUp    = "up"
+	DirDown  = "down"
+	DirAny   = "any"
+	DirUpper = "upper"
+	DirLower = "lower"
+)
+
+// volumeLookback 量能放大比较的均量天数。
+const volumeLookback = 5
+
+// DefaultCooldownMinutes 重复提醒没填冷却时间时的默认值：一天。
+// 盘中每几分钟刷新一次当天的 K 线，冷却为 0 的话条件成立期间每轮都会触发。
+const DefaultCooldownMinutes = 24 * 60
+
+// Kinds 每种提醒允许的方向，也给前端做下拉。
+var Kinds = map[string][]string{
+	KindPriceCross:  {DirAbove, DirBelow},
+	KindPctMove:     {DirUp, DirDown, DirAny},
+	KindVolumeSpike: {DirAbove},
+	KindRSIZone:     {DirAbove, DirBelow},
+	KindBollTouch:   {DirUpper, DirLower},
+}
+
+// RSIPeriods rsi_zone 支持的周期（stock_indicators 里有的）。
+var RSIPeriods = []int{6, 12, 24}
+
+// Validate 检查并补全提醒的参数：方向缺省取该类型的第一个，RSI 周期缺省 6，
+// volume_spike 的方向固定 above，重复提醒的冷却时间缺省 DefaultCooldownMinutes。
+func Validate(a *models.StockAlert) error {
+	dirs, ok := Kinds[a.Kind]
+	if !ok {
+		return fmt.Errorf("不支持的提醒类型: %s", a.Kind)
+	}
+	if a.Direction == "" || a.Kind == KindVolumeSpike {
+		a.Direction = dirs[0]
+	}
+	if !contains(dirs, a.Direction) {
+		return fmt.Errorf("%s 的方向只能是 %v", a.Kind, dirs)
+	}
+	if math.IsNaN(a.Threshold) || math.IsInf(a.Threshold, 0) {
+		return errors.New("threshold 无效")
+	}
+	switch a.Kind {
+	case KindPriceCross:
+		if a.Threshold <= 0 {
+			return errors.New("价位必须大于 0")
+		}
+	case KindPctMove:
+		if a.Threshold <= 0 || a.Threshold > 100 {
+			return errors.New("涨跌幅阈值须在 (0, 100] 之间（不带符号，方向用 direction）")
+		}
+		if a.RefClose != nil && *a.RefClose <= 0 {
+			return errors.New("ref_close 必须大于 0")
+		}
+	case KindVolumeSpike:
+		if a.Threshold <= 1 {
+			return errors.New("量能倍数必须大于 1")
+		}
+	case KindRSIZone:
+		if a.Threshold <= 0 || a.Threshold >= 100 {
+			return errors.New("RSI 阈值须在 (0, 100) 之间")
+		}
+		if a.Period == 0 {
+			a.Period = RSIPeriods[0]
+		}
+		if !containsInt(RSIPeriods, a.Period) {
+			return fmt.Errorf("RSI 周期只能是 %v", RSIPeriods)
+		}
+	}
+	if a.Kind != KindRSIZone {
+		a.Period = 0
+	}
+	if a.Kind != KindPctMove {
+		a.RefClose = nil
+	}
+	if a.CooldownMinutes < 0 {
+		return errors.New("cooldown_minutes 不能为负")
+	}
+	if a.Repeat && a.CooldownMinutes == 0 {
+		a.CooldownMinutes = DefaultCooldownMinutes
+	}
+	return nil
+}
+
+// Trigger 一次触发的现场，写进通知正文和外发消息。
+type Trigger struct {
+	TradeDate time.Time
+	Close     float64
+	Value     float64 // 判断用到的值：价格 / 涨跌幅 / 量比 / RSI / 轨道价
+	Text      string
+}
+
+// Evaluate 用一只股票最近的 K 线和指标判断提醒是否触发。
+// bars、inds 按日期升序，最后一根是最新的；bars 至少要有 2 根（前一根 + 当天），
+// volume_spike 需要前 volumeLookback 根。数据不足时不触发。
+// 最新一根早于提醒创建当天的（停牌、还没抓到新数据）不评估，新建的提醒不会拿历史行情触发。
+func Evaluate(a models.StockAlert, bars []models.StockDailyData, inds []models.StockIndicator) (Trigger, bool) {
+	if len(bars) == 0 {
+		return Trigger{}, false
+	}
+	cur := bars[len(bars)-1]
+	if !a.CreatedAt.IsZero() && cur.TradeDate.Format("2006-01-02") < a.CreatedAt.Format("2006-01-02") {
+		return Trigger{}, false
+	}
+	t := Trigger{TradeDate: cur.TradeDate, Close: cur.Close}
+	var prev *models.StockDailyData
+	if len(bars) >= 2 {
+		prev = &bars[len(bars)-2]
+	}
+
+	switch a.Kind {
+	case KindPriceCross:
+		if prev == nil {
+			return t, false
+		}
+		t.Value = cur.Close
+		switch {
+		case a.Direction == DirAbove && prev.Close < a.Threshold && cur.Close >= a.Threshold:
+			t.Text = fmt.Sprintf("收盘价 %.2f 上穿 %.2f（前收 %.2f）", cur.Close, a.Threshold, prev.Close)
+		case a.Direction == DirBelow && prev.Close > a.Threshold && cur.Close <= a.Threshold:
+			t.Text = fmt.Sprintf("收盘价 %.2f 下穿 %.2f（前收 %.2f）", cur.Close, a.Threshold, prev.Close)
+		default:
+			return t, false
+		}
+
+	case KindPctMove:
+		ref := 0.0
+		if a.RefClose != nil {
+			ref = *a.RefClose
+		} else if prev != nil {
+			ref = prev.Close
+		}
+		if ref <= 0 {
+			return t, false
+		}
+		pct := (cur.Close - ref) / ref * 100
+		t.Value = round2(pct)
+		hit := (a.Direction == DirUp || a.Direction == DirAny) && pct >= a.Threshold ||
+			(a.Direction == DirDown || a.Direction == DirAny) && pct <= -a.Threshold
+		if !hit {
+			return t, false
+		}
+		t.Text = fmt.Sprintf("现价 %.2f 相对参考价 %.2f 涨跌 %+.2f%%（阈值 %.2f%%）", cur.Close, ref, pct, a.Threshold)
+
+	case KindVolumeSpike:
+		if len(bars) < volumeLookback+1 {
+			return t, false
+		}
+		var sum float64
+		for _, b := range bars[len(bars)-1-volumeLookback : len(bars)-1] {
+			sum += float64(b.Volume)
+		}
+		avg := sum / volumeLookback
+		if avg <= 0 {
+			return t, false
+		}
+		ratio := float64(cur.Volume) / avg
+		t.Value = round2(ratio)
+		if ratio < a.Threshold {
+			return t, false
+		}
+		t.Text = fmt.Sprintf("成交量 %d 为前 %d 日均量的 %.2f 倍（阈值 %.2f 倍）", cur.Volume, volumeLookback, ratio, a.Threshold)
+
+	case KindRSIZone:
+		curInd, prevInd, ok := lastTwo(inds, cur.TradeDate)
+		if !ok {
+			return t, false
+		}
+		c, p := rsi(curInd, a.Period), rsi(prevInd, a.Period)
+		if c == nil || p == nil {
+			return t, false
+		}
+		t.Value = round2(*c)
+		switch {
+		case a.Direction == DirAbove && *p < a.Threshold && *c >= a.Threshold:
+			t.Text = fmt.Sprintf("RSI%d %.2f 进入 %.0f 以上（前值 %.2f）", a.Period, *c, a.Threshold, *p)
+		case a.Direction == DirBelow && *p > a.Threshold && *c <= a.Threshold:
+			t.Text = fmt.Sprintf("RSI%d %.2f 进入 %.0f 以下（前值 %.2f）", a.Period, *c, a.Threshold, *p)
+		default:
+			return t, false
+		}
+
+	case KindBollTouch:
+		if len(inds) == 0 || !sameDay(inds[len(inds)-1].CalcDate, cur.TradeDate) {
+			return t, false
+		}
+		ind := inds[len(inds)-1]
+		switch {
+		case a.Direction == DirUpper && ind.BollUpper != nil && cur.High >= *ind.BollUpper:
+			t.Value = *ind.BollUpper
+			t.Text = fmt.Sprintf("最高价 %.2f 触及布林上轨 %.2f", cur.High, *ind.BollUpper)
+		case a.Direction == DirLower && ind.BollLower != nil && cur.Low > 0 && cur.Low <= *ind.BollLower:
+			t.Value = *ind.BollLower
+			t.Text = fmt.Sprintf("最低价 %.2f 触及布林下轨 %.2f", cur.Low, *ind.BollLower)
+		default:
+			return t, false
+		}
+
+	default:
+		return t, false
+	}
+	return t, true
+}
+
+// Describe 提醒条件的可读描述，用于通知标题。
+func Describe(a models.StockAlert) string {
+	switch a.Kind {
+	case KindPriceCross:
+		if a.Direction == DirBelow {
+			return fmt.Sprintf("价格下穿 %.2f", a.Threshold)
+		}
+		return fmt.Sprintf("价格上穿 %.2f", a.Threshold)
+	case KindPctMove:
+		switch a.Direction {
+		case DirUp:
+			return fmt.Sprintf("涨幅达 %.2f%%", a.Threshold)
+		case DirDown:
+			return fmt.Sprintf("跌幅达 %.2f%%", a.Threshold)
+		}
+		return fmt.Sprintf("涨跌幅达 ±%.2f%%", a.Threshold)
+	case KindVolumeSpike:
+		return fmt.Sprintf("放量 %.1f 倍", a.Threshold)
+	case KindRSIZone:
+		if a.Direction == DirBelow {
+			return fmt.Sprintf("RSI%d 低于 %.0f", a.Period, a.Threshold)
+		}
+		return fmt.Sprintf("RSI%d 高于 %.0f", a.Period, a.Threshold)
+	case KindBollTouch:
+		if a.Direction == DirLower {
+			return "触及布林下轨"
+		}
+		return "触及布林上轨"
+	}
+	return a.Kind
+}
+
+// lastTwo 当天和前一天的指标；最新一条不是当天的（指标还没算出来）视为数据不足。
+func lastTwo(inds []models.StockIndicator, day time.Time) (cur, prev models.StockIndicator, ok bool) {
+	if len(inds) < 2 || !sameDay(inds[len(inds)-1].CalcDate, day) {
+		return cur, prev, false
+	}
+	return inds[len(inds)-1], inds[len(inds)-2], true
+}
+
+func rsi(ind models.StockIndicator, period int) *float64 {
+	switch period {
+	case 12:
+		return ind.RSI12
+	case 24:
+		return ind.RSI24
+	}
+	return ind.RSI6
+}
+
+func sameDay(a, b time.Time) bool {
+	return a.Format("2006-01-02") == b.Format("2006-01-02")
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+func contains(ss []string, s string) bool {
+	for _, x := range ss {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+func containsInt(xs []int, x int) bool {
+	for _, v := range xs {
+		if v == x {
+			return true
+		}
+	}
+	return false
+}
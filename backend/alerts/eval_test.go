@@ -0,0 +1,133 @@
+package alerts
+
+import (
+	"testing"
+	"time"
+
+	"oh-my-stock/models"
+)
+
+func day(d int) time.Time { return time.Date(2024, 6, d, 0, 0, 0, 0, time.UTC) }
+
+// bars 收盘价依次为 closes 的 K 线，最高 / 最低 = 收盘 ± 0.1，成交量 1000。
+func bars(closes ...float64) []models.StockDailyData {
+	out := make([]models.StockDailyData, len(closes))
+	for i, c := range closes {
+		out[i] = models.StockDailyData{TradeDate: day(i + 1), Close: c, High: c + 0.1, Low: c - 0.1, Volume: 1000}
+	}
+	return out
+}
+
+func f(v float64) *float64 { return &v }
+
+func TestEvaluate_PriceCross(t *testing.T) {
+	up := models.StockAlert{Kind: KindPriceCross, Direction: DirAbove, Threshold: 10}
+	if tr, ok := Evaluate(up, bars(9.8, 10.2), nil); !ok || tr.Value != 10.2 || tr.Text == "" {
+		t.Fatalf("上穿应触发: %+v %v", tr, ok)
+	}
+	if _, ok := Evaluate(up, bars(10.1, 10.2), nil); ok {
+		t.Fatal("前收已在价位之上，不算穿越")
+	}
+	if _, ok := Evaluate(up, bars(10.2), nil); ok {
+		t.Fatal("只有一根 K 线不能判断穿越")
+	}
+	down := models.StockAlert{Kind: KindPriceCross, Direction: DirBelow, Threshold: 10}
+	if _, ok := Evaluate(down, bars(10.3, 10), nil); !ok {
+		t.Fatal("收在价位上也算下穿")
+	}
+}
+
+func TestEvaluate_PctMove(t *testing.T) {
+	a := models.StockAlert{Kind: KindPctMove, Direction: DirDown, Threshold: 5}
+	if tr, ok := Evaluate(a, bars(10, 9.4), nil); !ok || tr.Value != -6 {
+		t.Fatalf("相对前收跌 6%%: %+v %v", tr, ok)
+	}
+	if _, ok := Evaluate(a, bars(10, 10.6), nil); ok {
+		t.Fatal("down 不应被上涨触发")
+	}
+	a.Direction, a.RefClose = DirAny, f(8)
+	if tr, ok := Evaluate(a, bars(10, 9.4), nil); !ok || tr.Value != 17.5 {
+		t.Fatalf("按 ref_close 算: %+v %v", tr, ok)
+	}
+}
+
+func TestEvaluate_VolumeSpike(t *testing.T) {
+	a := models.StockAlert{Kind: KindVolumeSpike, Direction: DirAbove, Threshold: 2}
+	bs := bars(1, 1, 1, 1, 1, 1)
+	bs[0].Volume = 500 // 前 5 日均量 (500+4×1000)/5 = 900
+	bs[5].Volume = 1800
+	if tr, ok := Evaluate(a, bs, nil); !ok || tr.Value != 2 {
+		t.Fatalf("量比 2 倍应触发: %+v %v", tr, ok)
+	}
+	bs[5].Volume = 1700
+	if _, ok := Evaluate(a, bs, nil); ok {
+		t.Fatal("不到 2 倍")
+	}
+	if _, ok := Evaluate(a, bs[1:], nil); ok {
+		t.Fatal("不足 5 日均量不判断")
+	}
+}
+
+func TestEvaluate_RSIZone(t *testing.T) {
+	a := models.StockAlert{Kind: KindRSIZone, Direction: DirBelow, Threshold: 30, Period: 12}
+	inds := []models.StockIndicator{
+		{CalcDate: day(1), RSI12: f(35)},
+		{CalcDate: day(2), RSI12: f(28)},
+	}
+	if tr, ok := Evaluate(a, bars(10, 9), inds); !ok || tr.Value != 28 {
+		t.Fatalf("RSI12 进入 30 以下: %+v %v", tr, ok)
+	}
+	inds[0].RSI12 = f(29)
+	if _, ok := Evaluate(a, bars(10, 9), inds); ok {
+		t.Fatal("已经在区间里不算进入")
+	}
+	inds[0].RSI12 = f(35)
+	if _, ok := Evaluate(a, bars(10, 9, 8), inds); ok {
+		t.Fatal("当天的指标还没算出来不判断")
+	}
+}
+
+func TestEvaluate_BollTouch(t *testing.T) {
+	a := models.StockAlert{Kind: KindBollTouch, Direction: DirUpper}
+	inds := []models.StockIndicator{{CalcDate: day(2), BollUpper: f(10.25), BollLower: f(9)}}
+	if _, ok := Evaluate(a, bars(10, 10.2), inds); !ok {
+		t.Fatal("最高 10.3 触及上轨 10.25")
+	}
+	a.Direction = DirLower
+	if _, ok := Evaluate(a, bars(10, 10.2), inds); ok {
+		t.Fatal("没有触及下轨")
+	}
+}
+
+func TestEvaluate_SkipsBarsBeforeCreation(t *testing.T) {
+	a := models.StockAlert{Kind: KindPriceCross, Direction: DirAbove, Threshold: 10, CreatedAt: day(3).Add(10 * time.Hour)}
+	if _, ok := Evaluate(a, bars(9.8, 10.2), nil); ok {
+		t.Fatal("创建之前的行情不应触发")
+	}
+	if _, ok := Evaluate(a, bars(9.7, 9.8, 10.2), nil); !ok {
+		t.Fatal("创建当天的 K 线应评估")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	a := models.StockAlert{Kind: KindRSIZone, Threshold: 70, Repeat: true, RefClose: f(1)}
+	if err := Validate(&a); err != nil {
+		t.Fatal(err)
+	}
+	if a.Direction != DirAbove || a.Period != 6 || a.CooldownMinutes != DefaultCooldownMinutes || a.RefClose != nil {
+		t.Fatalf("缺省值没补全: %+v", a)
+	}
+	for _, bad := range []models.StockAlert{
+		{Kind: "macd_cross", Threshold: 1},
+		{Kind: KindPriceCross, Direction: DirUp, Threshold: 10},
+		{Kind: KindPctMove, Threshold: -3},
+		{Kind: KindVolumeSpike, Threshold: 0.5},
+		{Kind: KindRSIZone, Threshold: 70, Period: 9},
+		{Kind: KindPriceCross, Threshold: 10, CooldownMinutes: -1},
+	} {
+		b := bad
+		if err := Validate(&b); err == nil {
+			t.Fatalf("应拒绝 %+v", bad)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package alerts
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+
+	"oh-my-stock/adjust"
+	"oh-my-stock/events"
+	"oh-my-stock/fetcher"
+	"oh-my-stock/models"
+	"oh-my-stock/notify"
+)
+
+// ============================================================
+// 提醒评估：新 K 线入库后（incremental_fetch / backfill_gaps / refetch_daily_all）对这批股票上
+// 启用中的提醒逐条判断，触发的写站内通知（notifications.alert_id）、实时事件（alert），
+// 设了渠道的再排一条外发投递，由 notify 包发送和重试（用户设了免打扰的，时段内推迟到结束再发）。
+//
+// 「能不能触发」在一条 UPDATE 里判断并占位（启用中、冷却已过），多副本同时评估也只会触发一次；
+// 一次性提醒触发后同一条语句里停用。
+// ============================================================
+
+// barsNeeded 评估要读的最近 K 线根数：当天 + 前 volumeLookback 根。
+const barsNeeded = volumeLookback + 1
+
+// fireSQL 占位并写通知、投递、实时事件。参数：alert_id, stock_name, trade_date, title, message, 投递最早发送时间。
+const fireSQL = `WITH a AS (
+	UPDATE stock_alerts
+	SET last_triggered_at = NOW(), trigger_count = trigger_count + 1, active = repeat, updated_at = NOW()
+	WHERE id = ? AND active
+	  AND (last_triggered_at IS NULL OR last_triggered_at <= NOW() - make_interval(mins => cooldown_minutes))
+	RETURNING id, user_id, symbol, channel_id
+), ins AS (
+	INSERT INTO notifications (user_id, alert_id, symbol, stock_name, trade_date, title, message)
+	SELECT user_id, id, symbol, ?::varchar, ?::date, ?::varchar, ?::text FROM a
+	RETURNING id, user_id, alert_id, symbol, stock_name, trade_date, title, message, created_at
+), q AS (
+	INSERT INTO notification_deliveries (user_id, channel_id, notification_id, status, next_attempt_at)
+	SELECT ins.user_id, c.id, ins.id, 'pending', ?::timestamp
+	FROM ins
+	JOIN a ON a.id = ins.alert_id
+	JOIN notification_channels c ON c.id = a.channel_id AND c.user_id = ins.user_id AND c.enabled
+	ON CONFLICT (notification_id, channel_id) DO NOTHING
+	RETURNING 1
+), ev AS (
+	INSERT INTO user_events (user_id, type, data)
+	SELECT user_id, 'alert', jsonb_build_object(
+		'id', id, 'alert_id', alert_id, 'symbol', symbol, 'stock_name', stock_name,
+		'trade_date', trade_date, 'title', title, 'message', message, 'created_at', created_at)
+	FROM ins
+)
+SELECT (SELECT COUNT(*) FROM ins) AS fired, (SELECT COUNT(*) FROM q) AS queued`
+
+// Result 一轮评估的结果。
+type Result struct {
+	Evaluated int // 评估的提醒数
+	Fired     int // 触发的提醒数
+	Queued    int // 排上的外发投递数
+}
+
+// CheckSymbols 评估这些股票上所有启用中的提醒。一只股票读数据失败不影响其他股票，最后一个错误返回。
+func CheckSymbols(ctx context.Context, db *gorm.DB, symbols []string) (Result, error) {
+	var res Result
+	if len(symbols) == 0 {
+		return res, nil
+	}
+	var list []models.StockAlert
+	if err := db.WithContext(ctx).Where("active AND symbol IN ?", symbols).Order("symbol, id").Find(&list).Error; err != nil {
+		return res, fmt.Errorf("读取提醒: %w", err)
+	}
+	if len(list) == 0 {
+		return res, nil
+	}
+	bySymbol := map[string][]models.StockAlert{}
+	var syms, users []string
+	seenUser := map[string]bool{}
+	for _, a := range list {
+		if !seenUser[a.UserID] {
+			seenUser[a.UserID] = true
+			users = append(users, a.UserID)
+		}
+		if _, ok := bySymbol[a.Symbol]; !ok {
+			syms = append(syms, a.Symbol)
+		}
+		bySymbol[a.Symbol] = append(bySymbol[a.Symbol], a)
+	}
+	names := stockNames(db.WithContext(ctx), syms)
+	policies, err := notify.LoadPolicies(db.WithContext(ctx), users)
+	if err != nil {
+		return res, err
+	}
+
+	var lastErr error
+	for _, sym := range syms {
+		if ctx.Err() != nil {
+			return res, ctx.Err()
+		}
+		bars, inds, err := loadSeries(db.WithContext(ctx), sym)
+		if err != nil {
+			log.Printf("⚠️ %s 读取提醒评估数据失败: %v", sym, err)
+			lastErr = err
+			continue
+		}
+		for _, a := range bySymbol[sym] {
+			res.Evaluated++
+			t, ok := Evaluate(a, bars, inds)
+			if !ok {
+				continue
+			}
+			fired, queued, err := fire(db.WithContext(ctx), a, t, names[sym], notify.DeliverAt(policies[a.UserID], time.Now()))
+			if err != nil {
+				log.Printf("⚠️ 提醒 %d（%s）写入失败: %v", a.ID, sym, err)
+				lastErr = err
+				continue
+			}
+			res.Fired += fired
+			res.Queued += queued
+		}
+	}
+	if res.Fired > 0 {
+		if err := events.Signal(db); err != nil {
+			log.Printf("⚠️ 实时事件通知失败（在线用户最晚 %s 后收到）: %v", events.PollInterval, err)
+		}
+	}
+	return res, lastErr
+}
+
+// loadSeries 一只股票最近 barsNeeded 根前复权 K 线和最近 2 条指标，都按日期升序。
+func loadSeries(db *gorm.DB, symbol string) ([]models.StockDailyData, []models.StockIndicator, error) {
+	var bars []models.StockDailyData
+	if err := db.Where("symbol = ?", symbol).Order("trade_date DESC").Limit(barsNeeded).Find(&bars).Error; err != nil {
+		return nil, nil, fmt.Errorf("读取日 K: %w", err)
+	}
+	reverse(bars)
+	bars, err := fetcher.AdjustDaily(symbol, bars, adjust.QFQ)
+	if err != nil {
+		return nil, nil, err
+	}
+	var inds []models.StockIndicator
+	if err := db.Where("symbol = ?", symbol).Order("calc_date DESC").Limit(2).Find(&inds).Error; err != nil {
+		return nil, nil, fmt.Errorf("读取指标: %w", err)
+	}
+	reverse(inds)
+	return bars, inds, nil
+}
+
+// fire 触发一条提醒，外发投递 deliverAt 之后再发。冷却中或已被别的副本抢先触发时 fired=0。
+func fire(db *gorm.DB, a models.StockAlert, t Trigger, stockName string, deliverAt time.Time) (fired, queued int, err error) {
+	title := fmt.Sprintf("%s %s %s", a.Symbol, stockName, Describe(a))
+	msg := t.Text
+	if a.Note != "" {
+		msg += "；备注：" + a.Note
+	}
+	var res struct{ Fired, Queued int }
+	if err := db.Raw(fireSQL, a.ID, stockName, t.TradeDate, title, msg, deliverAt).Scan(&res).Error; err != nil {
+		return 0, 0, err
+	}
+	return res.Fired, res.Queued, nil
+}
+
+// stockNames 股票名称（best-effort，读不到就只显示代码）。
+func stockNames(db *gorm.DB, symbols []string) map[string]string {
+	var rows []models.StockBasicInfo
+	db.Select("symbol, name").Where("symbol IN ?", symbols).Find(&rows)
+	names := make(map[string]string, len(rows))
+	for _, r := range rows {
+		names[r.Symbol] = r.Name
+	}
+	return names
+}
+
+func reverse[T any](s []T) {
+	for i, j := 0, len(s)-1; i < j; i, j = i+1, j-1 {
+		s[i], s[j] = s[j], s[i]
+	}
+}
@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"oh-my-stock/config"
+)
+
+func TestRefreshToken(t *testing.T) {
+	a, err := newRefreshToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := newRefreshToken()
+	if a == b || len(a) != 43 || strings.ContainsAny(a, "+/=") {
+		t.Fatalf("refresh token = %q / %q", a, b)
+	}
+	if h := hashToken(a); len(h) != 64 || h != hashToken(a) || h == hashToken(b) {
+		t.Fatalf("hash = %q", h)
+	}
+}
+
+func TestClip(t *testing.T) {
+	if got := clip("浏览器abc", 4); got != "浏览器a" {
+		t.Fatalf("clip = %q", got)
+	}
+	if got := clip("ab", 4); got != "ab" {
+		t.Fatalf("clip = %q", got)
+	}
+}
+
+func TestCache(t *testing.T) {
+	now := time.Now()
+	s := config.Claims{UserID: "u1", SessionID: "s1"}
+	legacy := config.Claims{UserID: "u1", IssuedAt: now}
+	other := config.Claims{UserID: "u2", SessionID: "s2"}
+	if cacheKey(s) == cacheKey(legacy) {
+		t.Fatal("会话 token 和老 token 的缓存键不应相同")
+	}
+
+	remember(cacheKey(s), true, now)
+	remember(cacheKey(legacy), false, now)
+	remember(cacheKey(other), true, now)
+	if ok, hit := cached(cacheKey(s), now.Add(checkCacheTTL-time.Second)); !hit || !ok {
+		t.Fatalf("cached = %v, %v", ok, hit)
+	}
+	if ok, hit := cached(cacheKey(legacy), now); !hit || ok {
+		t.Fatalf("legacy cached = %v, %v", ok, hit)
+	}
+	if _, hit := cached(cacheKey(s), now.Add(checkCacheTTL)); hit {
+		t.Fatal("过期的缓存不应命中")
+	}
+
+	forgetUser("u1")
+	if _, hit := cached(cacheKey(s), now); hit {
+		t.Fatal("吊销后本用户的缓存应清掉")
+	}
+	if _, hit := cached(cacheKey(other), now); !hit {
+		t.Fatal("其他用户的缓存不应受影响")
+	}
+}
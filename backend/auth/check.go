@@ -0,0 +1,120 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"oh-my-stock/config"
+)
+
+// ============================================================
+// 吊销检查：访问 token 的签名和有效期由 config.VerifyToken 校验，这里再看它所属的会话还在不在。
+// 每个请求都查库太重，结果在本进程缓存 checkCacheTTL：本副本上吊销立即生效，
+// 其他副本最晚 checkCacheTTL 后生效。
+// 升级前签发的老 token 没有会话，只能等它自然过期，或者「退出所有设备」（users.tokens_revoked_at）让它失效。
+// ============================================================
+
+// ErrSessionRevoked token 所属的会话已退出、被吊销或过期。
+var ErrSessionRevoked = errors.New("会话已失效，请重新登录")
+
+// checkCacheTTL 会话状态缓存多久。
+const checkCacheTTL = 30 * time.Second
+
+// maxCacheEntries 缓存超过这么多条时顺手清掉过期的。
+const maxCacheEntries = 10000
+
+type cacheEntry struct {
+	ok bool
+	at time.Time
+}
+
+var cache = struct {
+	sync.Mutex
+	m map[string]cacheEntry
+}{m: map[string]cacheEntry{}}
+
+// cacheKey 同一个用户的键都以 "<uid>|" 开头，吊销时按用户整体清掉。
+func cacheKey(c config.Claims) string {
+	if c.SessionID != "" {
+		return c.UserID + "|s|" + c.SessionID
+	}
+	return fmt.Sprintf("%s|u|%d", c.UserID, c.IssuedAt.Unix())
+}
+
+func cached(key string, now time.Time) (ok, hit bool) {
+	cache.Lock()
+	defer cache.Unlock()
+	e, found := cache.m[key]
+	if !found || now.Sub(e.at) >= checkCacheTTL {
+		return false, false
+	}
+	return e.ok, true
+}
+
+func remember(key string, ok bool, now time.Time) {
+	cache.Lock()
+	defer cache.Unlock()
+	if len(cache.m) >= maxCacheEntries {
+		for k, e := range cache.m {
+			if now.Sub(e.at) >= checkCacheTTL {
+				delete(cache.m, k)
+			}
+		}
+	}
+	cache.m[key] = cacheEntry{ok: ok, at: now}
+}
+
+// forgetUser 清掉一个用户的缓存，本副本上的吊销立即生效。
+func forgetUser(userID string) {
+	cache.Lock()
+	defer cache.Unlock()
+	for k := range cache.m {
+		if strings.HasPrefix(k, userID+"|") {
+			delete(cache.m, k)
+		}
+	}
+}
+
+// Check token 所属的会话是否仍然有效，无效返回 ErrSessionRevoked。
+// 带会话的查 user_sessions；不带的（升级前签发）查签发时间是否晚于用户的 tokens_revoked_at。
+func Check(db *gorm.DB, c config.Claims) error {
+	now := time.Now()
+	key := cacheKey(c)
+	if ok, hit := cached(key, now); hit {
+		if !ok {
+			return ErrSessionRevoked
+		}
+		return nil
+	}
+	var ok bool
+	if c.SessionID != "" {
+		if _, err := uuid.Parse(c.SessionID); err != nil {
+			return ErrSessionRevoked
+		}
+		if err := db.Raw(`SELECT EXISTS (SELECT 1 FROM user_sessions
+			WHERE id = ? AND user_id = ? AND revoked_at IS NULL AND expires_at > NOW())`,
+			c.SessionID, c.UserID).Scan(&ok).Error; err != nil {
+			return fmt.Errorf("校验会话: %w", err)
+		}
+	} else {
+		if _, err := uuid.Parse(c.UserID); err != nil {
+			return ErrSessionRevoked
+		}
+		if err := db.Raw(`SELECT EXISTS (SELECT 1 FROM users
+			WHERE id = ? AND (tokens_revoked_at IS NULL OR tokens_revoked_at < to_timestamp(?)::timestamp))`,
+			c.UserID, c.IssuedAt.Unix()).Scan(&ok).Error; err != nil {
+			return fmt.Errorf("校验会话: %w", err)
+		}
+	}
+	remember(key, ok, now)
+	if !ok {
+		return ErrSessionRevoked
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"oh-my-stock/config"
+	"oh-my-stock/models"
+)
+
+// ============================================================
+// 登录会话：每次登录建一个会话（user_sessions），发一对 token：
+//   - 访问 token：config.IssueAccessToken，默认 15 分钟，带会话 ID（sid），每个请求校验会话没被吊销（见 check.go）
+//   - refresh token：随机 32 字节，库里只存 SHA-256；每次刷新都换一个新的，旧的作废，
+//     会话有效期顺延 jwt.ttl_hours
+// 已经换掉的 refresh token 又被拿来刷新，说明它泄露了：整个会话吊销，偷到的和正主手里的都不能再用。
+// 例外是刚换掉 refreshRaceGrace 以内（多个标签页同时刷新），只拒绝这一次，不吊销。
+// ============================================================
+
+var (
+	ErrInvalidRefresh = errors.New("refresh token 无效或已过期，请重新登录")
+	ErrRefreshRaced   = errors.New("refresh token 刚刚已刷新过，请使用最新的 token")
+	ErrRefreshReused  = errors.New("refresh token 被重复使用，会话已吊销，请重新登录")
+)
+
+// refreshRaceGrace 旧 refresh token 在轮换后多久内再出现算并发刷新而不是盗用。
+const refreshRaceGrace = 30 * time.Second
+
+// DefaultKeep 已过期 / 已吊销的会话保留多久（会话列表、排查用），purge 任务清理。
+const DefaultKeep = 30 * 24 * time.Hour
+
+// 吊销原因（user_sessions.revoke_reason）
+const (
+	ReasonLogout    = "logout"     // 退出登录
+	ReasonLogoutAll = "logout_all" // 退出所有设备
+	ReasonRevoked   = "revoked"    // 在会话列表里踢掉
+	ReasonReuse     = "reuse"      // refresh token 重放
+)
+
+// Tokens 登录 / 刷新返回给客户端的 token。
+type Tokens struct {
+	AccessToken      string `json:"token"`              // 访问 token，字段名沿用老的登录接口
+	ExpiresIn        int    `json:"expires_in"`         // 访问 token 有效秒数
+	RefreshToken     string `json:"refresh_token"`      // 只在这次返回，库里只有哈希
+	RefreshExpiresIn int    `json:"refresh_expires_in"` // 会话有效秒数，刷新后重新计算
+	SessionID        string `json:"session_id"`
+}
+
+// Client 发起登录 / 刷新的客户端，记在会话上给用户辨认是哪台设备。
+type Client struct {
+	UserAgent string
+	IP        string
+}
+
+func hashToken(t string) string {
+	sum := sha256.Sum256([]byte(t))
+	return hex.EncodeToString(sum[:])
+}
+
+func newRefreshToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("生成 refresh token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// clip 按字符截断，存进定长列。
+func clip(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n])
+}
+
+func issue(s models.UserSession, refresh string) (Tokens, error) {
+	access, err := config.IssueAccessToken(s.UserID, s.ID)
+	if err != nil {
+		return Tokens{}, fmt.Errorf("签发访问 token: %w", err)
+	}
+	return Tokens{
+		AccessToken:      access,
+		ExpiresIn:        int(config.AccessTTL().Seconds()),
+		RefreshToken:     refresh,
+		RefreshExpiresIn: int(config.SessionTTL().Seconds()),
+		SessionID:        s.ID,
+	}, nil
+}
+
+// Login 给通过密码校验的用户建一个会话。
+func Login(db *gorm.DB, userID string, cl Client) (Tokens, error) {
+	refresh, err := newRefreshToken()
+	if err != nil {
+		return Tokens{}, err
+	}
+	var s models.UserSession
+	err = db.Raw(`INSERT INTO user_sessions (id, user_id, refresh_hash, user_agent, ip, expires_at)
+		VALUES (?, ?, ?, ?, ?, NOW() + make_interval(secs => ?))
+		RETURNING *`, uuid.NewString(), userID, hashToken(refresh), clip(cl.UserAgent, 300), clip(cl.IP, 64),
+		config.SessionTTL().Seconds()).Scan(&s).Error
+	if err != nil {
+		return Tokens{}, fmt.Errorf("创建会话: %w", err)
+	}
+	return issue(s, refresh)
+}
+
+// Refresh 用 refresh token 换一对新 token，旧的 refresh token 作废。
+func Refresh(db *gorm.DB, refresh string, cl Client) (Tokens, error) {
+	if refresh == "" {
+		return Tokens{}, ErrInvalidRefresh
+	}
+	next, err := newRefreshToken()
+	if err != nil {
+		return Tokens{}, err
+	}
+	old := hashToken(refresh)
+	// 条件更新即占位：同一个 refresh token 并发刷新只有一个成功
+	var rows []models.UserSession
+	err = db.Raw(`UPDATE user_sessions s
+		SET prev_hash = refresh_hash, refresh_hash = ?, rotated_at = NOW(), last_used_at = NOW(),
+			expires_at = NOW() + make_interval(secs => ?), user_agent = ?, ip = ?
+		WHERE refresh_hash = ? AND revoked_at IS NULL AND expires_at > NOW()
+		  AND EXISTS (SELECT 1 FROM users u WHERE u.id = s.user_id AND u.is_active IS NOT FALSE)
+		RETURNING s.*`, hashToken(next), config.SessionTTL().Seconds(), clip(cl.UserAgent, 300), clip(cl.IP, 64), old).
+		Scan(&rows).Error
+	if err != nil {
+		return Tokens{}, fmt.Errorf("刷新会话: %w", err)
+	}
+	if len(rows) == 1 {
+		return issue(rows[0], next)
+	}
+
+	// 没换成功：是不是已经换掉的上一个 refresh token
+	var prev struct {
+		ID     string
+		UserID string
+		Raced  bool
+	}
+	if err := db.Raw(`SELECT id, user_id, COALESCE(rotated_at > NOW() - make_interval(secs => ?), FALSE) AS raced
+		FROM user_sessions WHERE prev_hash = ? AND revoked_at IS NULL`, refreshRaceGrace.Seconds(), old).
+		Scan(&prev).Error; err != nil {
+		return Tokens{}, fmt.Errorf("读取会话: %w", err)
+	}
+	switch {
+	case prev.ID == "":
+		return Tokens{}, ErrInvalidRefresh
+	case prev.Raced:
+		return Tokens{}, ErrRefreshRaced
+	}
+	if _, err := Revoke(db, prev.UserID, prev.ID, ReasonReuse); err != nil {
+		return Tokens{}, err
+	}
+	log.Printf("⚠️ 会话 %s（用户 %s）的 refresh token 被重复使用，已吊销", prev.ID, prev.UserID)
+	return Tokens{}, ErrRefreshReused
+}
+
+// SessionByRefresh refresh token 对应的有效会话（退出登录时用），找不到返回 ErrInvalidRefresh。
+func SessionByRefresh(db *gorm.DB, refresh string) (models.UserSession, error) {
+	var s models.UserSession
+	err := db.Where("refresh_hash = ? AND revoked_at IS NULL", hashToken(refresh)).First(&s).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return s, ErrInvalidRefresh
+	}
+	return s, err
+}
+
+// Revoke 吊销用户的一个会话，返回是否真的吊销了（已吊销 / 不存在返回 false）。
+func Revoke(db *gorm.DB, userID, sessionID, reason string) (bool, error) {
+	if _, err := uuid.Parse(sessionID); err != nil {
+		return false, nil
+	}
+	res := db.Model(&models.UserSession{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", sessionID, userID).
+		Updates(map[string]interface{}{"revoked_at": gorm.Expr("NOW()"), "revoke_reason": reason})
+	if res.Error != nil {
+		return false, fmt.Errorf("吊销会话: %w", res.Error)
+	}
+	forgetUser(userID)
+	return res.RowsAffected > 0, nil
+}
+
+// RevokeAll 退出所有设备：吊销用户全部会话，升级前签发、不带会话的老 token 也一并失效。
+func RevokeAll(db *gorm.DB, userID string) (int64, error) {
+	var n int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&models.UserSession{}).Where("user_id = ? AND revoked_at IS NULL", userID).
+			Updates(map[string]interface{}{"revoked_at": gorm.Expr("NOW()"), "revoke_reason": ReasonLogoutAll})
+		if res.Error != nil {
+			return res.Error
+		}
+		n = res.RowsAffected
+		return tx.Model(&models.User{}).Where("id = ?", userID).
+			UpdateColumn("tokens_revoked_at", gorm.Expr("NOW()")).Error
+	})
+	if err != nil {
+		return 0, fmt.Errorf("吊销会话: %w", err)
+	}
+	forgetUser(userID)
+	return n, nil
+}
+
+// List 用户仍然有效的会话，最近用过的在前。
+func List(db *gorm.DB, userID string) ([]models.UserSession, error) {
+	var rows []models.UserSession
+	if err := db.Where("user_id = ? AND revoked_at IS NULL AND expires_at > NOW()", userID).
+		Order("last_used_at DESC").Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("读取会话: %w", err)
+	}
+	return rows, nil
+}
+
+// Prune 删除过期或吊销超过 keep 的会话，返回删除条数。
+func Prune(ctx context.Context, db *gorm.DB, keep time.Duration) (int64, error) {
+	before := time.Now().Add(-keep)
+	res := db.WithContext(ctx).Where("expires_at < ? OR revoked_at < ?", before, before).Delete(&models.UserSession{})
+	return res.RowsAffected, res.Error
+}
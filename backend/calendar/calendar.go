@@ -0,0 +1,202 @@
+// Package calendar 沪深交易所交易日历。
+//
+// 休市日来自内嵌的 holidays.txt（交易所每年底发布次年休市安排），
+// 也可以用 Load / LoadFile 换成部署侧维护的文件。日期一律按 Asia/Shanghai 的自然日判断，
+// 传入的 time.Time 不论什么时区都先换算到上海时间再取年月日。
+package calendar
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+//go:embed holidays.txt
+var builtin string
+
+// Shanghai 交易所所在时区；系统没有 tzdata 时退化为固定 UTC+8（中国无夏令时，结果一致）。
+var Shanghai = func() *time.Location {
+	if loc, err := time.LoadLocation("Asia/Shanghai"); err == nil {
+		return loc
+	}
+	return time.FixedZone("CST", 8*3600)
+}()
+
+var (
+	mu       sync.RWMutex
+	holidays = map[int]string{} // yyyymmdd → 说明
+	years    = map[int]bool{}   // 数据文件覆盖到的年份
+	warned   sync.Map           // 已告警过的未覆盖年份
+)
+
+func init() {
+	if err := Load(strings.NewReader(builtin)); err != nil {
+		panic("calendar: 内置休市表有误: " + err.Error())
+	}
+}
+
+// Load 用 r 里的休市表替换当前数据。每行 "YYYY-MM-DD 说明"，# 开头为注释。
+func Load(r io.Reader) error {
+	hs := map[int]string{}
+	ys := map[int]bool{}
+	sc := bufio.NewScanner(r)
+	for ln := 1; sc.Scan(); ln++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		day, note, _ := strings.Cut(line, " ")
+		d, err := time.ParseInLocation("2006-01-02", day, Shanghai)
+		if err != nil {
+			return fmt.Errorf("第 %d 行日期有误: %q", ln, day)
+		}
+		hs[key(d)] = strings.TrimSpace(note)
+		ys[d.Year()] = true
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	mu.Lock()
+	holidays, years = hs, ys
+	mu.Unlock()
+	return nil
+}
+
+// LoadFile 从文件加载休市表，替换内置数据。
+func LoadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return Load(f)
+}
+
+// Covers 休市表是否包含 year 年的安排。
+func Covers(year int) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return years[year]
+}
+
+// CoverageLeadDays 离年底不到这么多天时，次年的休市安排就该收录了（交易所一般 12 月公布）。
+const CoverageLeadDays = 60
+
+// CheckCoverage now 所在年份没有收录，或离年底不到 CoverageLeadDays 天而次年还没收录时返回错误。
+// 没收录的年份只按周末判断：节假日照常跑盘中任务、数据质量校验放过非交易日 K 线、
+// 保留策略按交易日折算的界线也会偏早，所以由 partitions 任务每天检查、以任务失败的形式暴露出来。
+func CheckCoverage(now time.Time) error {
+	d := Date(now)
+	y := d.Year()
+	if !Covers(y) {
+		return fmt.Errorf("交易日历未收录 %d 年休市安排，交易日只按周末判断，请更新 holidays.txt", y)
+	}
+	end := time.Date(y, 12, 31, 0, 0, 0, 0, Shanghai)
+	if end.Sub(d) < CoverageLeadDays*24*time.Hour && !Covers(y+1) {
+		return fmt.Errorf("交易日历未收录 %d 年休市安排，%d 年起交易日只按周末判断，请在 holidays.txt 追加", y+1, y+1)
+	}
+	return nil
+}
+
+func key(t time.Time) int {
+	t = t.In(Shanghai)
+	return t.Year()*10000 + int(t.Month())*100 + t.Day()
+}
+
+// Date t 在上海时区的当日零点。
+func Date(t time.Time) time.Time {
+	t = t.In(Shanghai)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, Shanghai)
+}
+
+// Holiday 返回 t 当天的休市说明；不是节假日休市返回 ""、false（周末不算）。
+func Holiday(t time.Time) (string, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	note, ok := holidays[key(t)]
+	return note, ok
+}
+
+// IsTradingDay t 所在自然日是否开市。
+func IsTradingDay(t time.Time) bool {
+	d := Date(t)
+	if wd := d.Weekday(); wd == time.Saturday || wd == time.Sunday {
+		return false
+	}
+	if !Covers(d.Year()) {
+		if _, dup := warned.LoadOrStore(d.Year(), true); !dup {
+			log.Printf("⚠️ 交易日历未收录 %d 年休市安排，暂按周末判断，请更新 holidays.txt", d.Year())
+		}
+	}
+	_, closed := Holiday(d)
+	return !closed
+}
+
+// LastTradingDay t 当天或之前最近的一个交易日（零点）。
+func LastTradingDay(t time.Time) time.Time {
+	d := Date(t)
+	for !IsTradingDay(d) {
+		d = d.AddDate(0, 0, -1)
+	}
+	return d
+}
+
+// PrevTradingDay t 之前第 n 个交易日（不含 t 当天，n<=0 等同 LastTradingDay）。
+func PrevTradingDay(t time.Time, n int) time.Time {
+	d := Date(t)
+	if n <= 0 {
+		return LastTradingDay(d)
+	}
+	for n > 0 {
+		d = d.AddDate(0, 0, -1)
+		if IsTradingDay(d) {
+			n--
+		}
+	}
+	return d
+}
+
+// NextTradingDay t 之后第 n 个交易日（不含 t 当天，n<=0 时按 1 处理）。
+func NextTradingDay(t time.Time, n int) time.Time {
+	d := Date(t)
+	if n <= 0 {
+		n = 1
+	}
+	for n > 0 {
+		d = d.AddDate(0, 0, 1)
+		if IsTradingDay(d) {
+			n--
+		}
+	}
+	return d
+}
+
+// TradingDaysBetween [from, to] 闭区间内的交易日数，from 晚于 to 时返回 0。
+func TradingDaysBetween(from, to time.Time) int {
+	a, b := Date(from), Date(to)
+	n := 0
+	for d := a; !d.After(b); d = d.AddDate(0, 0, 1) {
+		if IsTradingDay(d) {
+			n++
+		}
+	}
+	return n
+}
+
+// TradingDays [from, to] 闭区间内的全部交易日（零点），升序。
+func TradingDays(from, to time.Time) []time.Time {
+	a, b := Date(from), Date(to)
+	var out []time.Time
+	for d := a; !d.After(b); d = d.AddDate(0, 0, 1) {
+		if IsTradingDay(d) {
+			out = append(out, d)
+		}
+	}
+	return out
+}
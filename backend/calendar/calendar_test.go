@@ -0,0 +1,158 @@
+package calendar
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func day(s string) time.Time {
+	t, err := time.ParseInLocation("2006-01-02", s, Shanghai)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func at(s string) time.Time {
+	t, err := time.ParseInLocation("2006-01-02 15:04", s, Shanghai)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestIsTradingDay(t *testing.T) {
+	cases := map[string]bool{
+		"2024-06-07": true,  // 周五
+		"2024-06-08": false, // 周六
+		"2024-06-10": false, // 端午
+		"2024-06-11": true,
+		"2025-01-28": false, // 春节
+		"2025-10-08": false, // 国庆中秋连休
+		"2025-10-09": true,
+	}
+	for s, want := range cases {
+		if got := IsTradingDay(day(s)); got != want {
+			t.Errorf("IsTradingDay(%s) = %v, want %v", s, got, want)
+		}
+	}
+	// UTC 零点的 DATE 列换到上海仍是同一天
+	if IsTradingDay(time.Date(2024, 6, 10, 0, 0, 0, 0, time.UTC)) {
+		t.Error("UTC 零点的端午节应休市")
+	}
+}
+
+func TestPrevNextTradingDay(t *testing.T) {
+	// 2024-06-11（周二）往前：06-07 周五（跳过周末和端午）
+	if got := PrevTradingDay(day("2024-06-11"), 1); !got.Equal(day("2024-06-07")) {
+		t.Fatalf("prev = %s", got.Format("2006-01-02"))
+	}
+	if got := PrevTradingDay(day("2024-06-11"), 3); !got.Equal(day("2024-06-05")) {
+		t.Fatalf("prev3 = %s", got.Format("2006-01-02"))
+	}
+	if got := PrevTradingDay(day("2024-06-10"), 0); !got.Equal(day("2024-06-07")) {
+		t.Fatalf("prev0 = %s", got.Format("2006-01-02"))
+	}
+	// 春节前最后一天 2025-01-27 → 节后 2025-02-05
+	if got := NextTradingDay(day("2025-01-27"), 1); !got.Equal(day("2025-02-05")) {
+		t.Fatalf("next = %s", got.Format("2006-01-02"))
+	}
+}
+
+func TestTradingDaysBetween(t *testing.T) {
+	// 2024-10：23 个工作日，国庆休 5 天
+	if n := TradingDaysBetween(day("2024-10-01"), day("2024-10-31")); n != 18 {
+		t.Fatalf("n = %d", n)
+	}
+	if n := TradingDaysBetween(day("2024-06-11"), day("2024-06-07")); n != 0 {
+		t.Fatalf("倒序应为 0, got %d", n)
+	}
+	if ds := TradingDays(day("2024-06-07"), day("2024-06-11")); len(ds) != 2 {
+		t.Fatalf("days = %v", ds)
+	}
+}
+
+func TestSession(t *testing.T) {
+	cases := map[string]Phase{
+		"2024-06-07 09:00": Closed,
+		"2024-06-07 09:20": PreOpen,
+		"2024-06-07 09:30": Morning,
+		"2024-06-07 11:30": Lunch,
+		"2024-06-07 13:00": Afternoon,
+		"2024-06-07 15:00": Closed,
+		"2024-06-10 10:00": Closed, // 端午
+	}
+	for s, want := range cases {
+		if got := PhaseAt(at(s)); got != want {
+			t.Errorf("PhaseAt(%s) = %s, want %s", s, got, want)
+		}
+	}
+	// 北京时间 10:00 = UTC 02:00
+	if !InSession(time.Date(2024, 6, 7, 2, 0, 0, 0, time.UTC)) {
+		t.Error("UTC 02:00 应在上午时段")
+	}
+	if got := NextOpen(at("2024-06-07 12:00")); !got.Equal(at("2024-06-07 13:00")) {
+		t.Fatalf("NextOpen lunch = %v", got)
+	}
+	if got := NextOpen(at("2024-06-07 15:30")); !got.Equal(at("2024-06-11 09:30")) {
+		t.Fatalf("NextOpen after close = %v", got)
+	}
+	if got := LatestSettled(at("2024-06-11 10:00")); !got.Equal(day("2024-06-07")) {
+		t.Fatalf("LatestSettled intraday = %v", got)
+	}
+	if got := LatestSettled(at("2024-06-11 15:00")); !got.Equal(day("2024-06-11")) {
+		t.Fatalf("LatestSettled after close = %v", got)
+	}
+}
+
+// 内置休市表往前覆盖日 K 默认保留的 1250 个交易日；每年交易日数与交易所公布的一致。
+func TestBuiltinYears(t *testing.T) {
+	want := map[int]int{2019: 244, 2020: 243, 2021: 243, 2022: 242, 2023: 242, 2024: 242, 2025: 243}
+	for y, n := range want {
+		if got := TradingDaysBetween(day(fmt.Sprintf("%d-01-01", y)), day(fmt.Sprintf("%d-12-31", y))); got != n {
+			t.Errorf("%d 年交易日 = %d, want %d", y, got, n)
+		}
+	}
+}
+
+func TestCheckCoverage(t *testing.T) {
+	defer Load(strings.NewReader(builtin))
+	if err := Load(strings.NewReader("2030-01-01 元旦\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckCoverage(at("2030-06-01 10:00")); err != nil {
+		t.Fatalf("年中不应报错: %v", err)
+	}
+	// 离年底不到 60 天、次年没收录
+	if err := CheckCoverage(at("2030-11-15 10:00")); err == nil || !strings.Contains(err.Error(), "2031") {
+		t.Fatalf("err = %v, want 缺 2031 年", err)
+	}
+	if err := CheckCoverage(at("2031-01-05 10:00")); err == nil {
+		t.Fatal("当年没收录应报错")
+	}
+	if err := Load(strings.NewReader("2030-01-01 元旦\n2031-01-01 元旦\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckCoverage(at("2030-12-20 10:00")); err != nil {
+		t.Fatalf("次年已收录不应报错: %v", err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	defer Load(strings.NewReader(builtin))
+	if err := Load(strings.NewReader("2030-01-01 元旦\nbad\n")); err == nil {
+		t.Fatal("格式错误应报错")
+	}
+	if err := Load(strings.NewReader("# x\n2030-01-01 元旦\n")); err != nil {
+		t.Fatal(err)
+	}
+	if !Covers(2030) || Covers(2024) || IsTradingDay(day("2030-01-01")) {
+		t.Fatal("自定义休市表未生效")
+	}
+	// 未收录年份按周末判断
+	if !IsTradingDay(day("2024-06-10")) {
+		t.Fatal("未收录年份不应再识别端午")
+	}
+}
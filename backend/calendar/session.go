@@ -0,0 +1,85 @@
+package calendar
+
+import "time"
+
+// Phase 一天内的交易时段。
+type Phase string
+
+const (
+	Closed    Phase = "closed"    // 非交易日，或开盘前 / 收盘后
+	PreOpen   Phase = "pre_open"  // 9:15–9:30 集合竞价
+	Morning   Phase = "morning"   // 9:30–11:30
+	Lunch     Phase = "lunch"     // 11:30–13:00
+	Afternoon Phase = "afternoon" // 13:00–15:00
+)
+
+// 连续竞价时段（上海时间，距零点的分钟数），收盘集合竞价并入下午时段。
+const (
+	auctionOpen  = 9*60 + 15
+	morningOpen  = 9*60 + 30
+	morningClose = 11*60 + 30
+	noonOpen     = 13 * 60
+	dayClose     = 15 * 60
+)
+
+func minuteOf(t time.Time) int {
+	t = t.In(Shanghai)
+	return t.Hour()*60 + t.Minute()
+}
+
+// PhaseAt t 时刻所处的交易时段。
+func PhaseAt(t time.Time) Phase {
+	if !IsTradingDay(t) {
+		return Closed
+	}
+	switch m := minuteOf(t); {
+	case m < auctionOpen || m >= dayClose:
+		return Closed
+	case m < morningOpen:
+		return PreOpen
+	case m < morningClose:
+		return Morning
+	case m < noonOpen:
+		return Lunch
+	default:
+		return Afternoon
+	}
+}
+
+// InSession t 是否在连续竞价时段内（9:30–11:30、13:00–15:00）。
+func InSession(t time.Time) bool {
+	p := PhaseAt(t)
+	return p == Morning || p == Afternoon
+}
+
+// CloseTime t 所在交易日的收盘时刻（15:00 上海时间）。
+func CloseTime(t time.Time) time.Time {
+	return Date(t).Add(dayClose * time.Minute)
+}
+
+// NextOpen t 之后（含 t）最近一次开盘时刻：上午 9:30 或下午 13:00。
+func NextOpen(t time.Time) time.Time {
+	d := Date(t)
+	if IsTradingDay(d) {
+		m := minuteOf(t)
+		if m < morningOpen {
+			return d.Add(morningOpen * time.Minute)
+		}
+		if m >= morningClose && m < noonOpen {
+			return d.Add(noonOpen * time.Minute)
+		}
+		if m < dayClose {
+			return t
+		}
+	}
+	return NextTradingDay(d, 1).Add(morningOpen * time.Minute)
+}
+
+// LatestSettled 最近一个已收盘交易日：当天收盘前返回上一个交易日。
+// 日 K 齐不齐、数据是否过期都应以它为准，而不是以今天为准。
+func LatestSettled(t time.Time) time.Time {
+	if IsTradingDay(t) && !t.Before(CloseTime(t)) {
+		return Date(t)
+	}
+	return PrevTradingDay(t, 1)
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"oh-my-stock/fetcher"
+	"oh-my-stock/importer"
+)
+
+// ============================================================
+// 命令行子命令。不带参数时启动 HTTP 服务；带子命令时执行完退出，不启动后台任务。
+//
+//	oh-my-stock import bars      --file daily/ [--file more.csv.gz ...] [--dry-run] [--sync-actions] [--no-refresh]
+//	oh-my-stock import moneyflow --file moneyflow.csv
+//	oh-my-stock import basics    --file cache/sh_stocks.csv --file cache/company_info.txt
+//	oh-my-stock restore stock_daily_data --from 2020-01-01 --to 2020-12-31 [--file archive/...csv.gz] [--hold-days 30]
+//	oh-my-stock partition migrate
+//	oh-my-stock partition ensure [--from 2020-01-01] [--to 2027-12-31]
+// ============================================================
+
+type fileList []string
+
+func (f *fileList) String() string     { return strings.Join(*f, ",") }
+func (f *fileList) Set(v string) error { *f = append(*f, v); return nil }
+
+const importUsage = `用法: oh-my-stock import <bars|moneyflow|basics> --file <文件或目录> [选项]
+
+  bars       日 K（日期 开盘 最高 最低 收盘 成交量 [成交额 换手率 振幅]），不复权
+  moneyflow  资金流（日期 主力净流入 散户净流入 大/中/小单成交占比）
+  basics     股票资料（代码 名称 [公司全称 行业 地区 板块 上市日期 流通股 总股本 状态]）
+
+没有代码列时从文件名取代码（如 daily/600000.csv）。支持 .csv / .txt / .tsv，可 gzip 压缩。
+`
+
+const restoreUsage = `用法: oh-my-stock restore <表名> --from YYYY-MM-DD --to YYYY-MM-DD [选项]
+
+把裁剪时归档出去的数据装回原表（stock_daily_data / stock_indicators / stock_money_flow /
+stock_money_flow_all / target_trend_stock）。不指定 --file 时按 archive_files 找覆盖区间的归档文件。
+装回的区间在 --hold-days 天内不会再被裁剪。
+`
+
+const partitionUsage = `用法: oh-my-stock partition <migrate|ensure> [选项]
+
+  migrate  把还是普通表的 stock_daily_data / stock_indicators / stock_money_flow 转换成按月分区
+           （老库升级用，一次性；复制期间表不可写，建议先停掉后端），完成后重建 stock_history_mv
+  ensure   建好 --from ~ --to 覆盖的月份分区，默认完整性检查窗口到之后几个月（和 partitions 任务相同）
+`
+
+// runCommand 执行子命令，返回进程退出码。
+func runCommand(args []string) int {
+	switch args[0] {
+	case "import":
+		return runImport(args[1:])
+	case "restore":
+		return runRestore(args[1:])
+	case "partition":
+		return runPartition(args[1:])
+	case "help", "-h", "--help":
+		fmt.Print(importUsage + "\n" + restoreUsage + "\n" + partitionUsage)
+		return 0
+	}
+	fmt.Fprintf(os.Stderr, "未知命令 %q\n\n%s\n%s\n%s", args[0], importUsage, restoreUsage, partitionUsage)
+	return 2
+}
+
+func runImport(args []string) int {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		fmt.Fprint(os.Stderr, importUsage)
+		return 2
+	}
+	fs := flag.NewFlagSet("import "+args[0], flag.ContinueOnError)
+	var files fileList
+	fs.Var(&files, "file", "CSV 文件或目录，可重复")
+	dryRun := fs.Bool("dry-run", false, "只解析、校验，不写库")
+	syncActions := fs.Bool("sync-actions", false, "校验日 K 前先从数据源同步除权除息")
+	noRefresh := fs.Bool("no-refresh", false, "不重算指标、不刷新 stock_history_mv")
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, importUsage+"\n选项:\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	files = append(files, fs.Args()...)
+	if len(files) == 0 {
+		fs.Usage()
+		return 2
+	}
+	paths, err := importer.ExpandFiles(files)
+	if err != nil {
+		log.Printf("❌ %v", err)
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	rep, err := importer.Run(ctx, importer.Options{
+		Kind:        importer.Kind(args[0]),
+		Files:       paths,
+		DryRun:      *dryRun,
+		SyncActions: *syncActions,
+		NoRefresh:   *noRefresh,
+	})
+	if rep != nil {
+		for _, e := range rep.Errors {
+			log.Printf("⚠️ %s", e)
+		}
+		span := ""
+		if !rep.From.IsZero() {
+			span = fmt.Sprintf("，%s ~ %s", rep.From.Format("2006-01-02"), rep.To.Format("2006-01-02"))
+		}
+		verb := "写入"
+		if *dryRun {
+			verb = "可写入"
+		}
+		log.Printf("📦 导入 %s：%d 个文件，读 %d 行，%s %d 行，隔离 %d 行，无效 %d 行，%d 只股票%s",
+			args[0], rep.Files, rep.Rows, verb, rep.Imported, rep.Quarantined, rep.Invalid, rep.Symbols, span)
+	}
+	if err != nil {
+		log.Printf("❌ 导入失败: %v", err)
+		return 1
+	}
+	return 0
+}
+
+func runRestore(args []string) int {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		fmt.Fprint(os.Stderr, restoreUsage)
+		return 2
+	}
+	fs := flag.NewFlagSet("restore "+args[0], flag.ContinueOnError)
+	var files fileList
+	fs.Var(&files, "file", "归档文件，可重复；不指定时按 archive_files 查找")
+	from := fs.String("from", "", "开始日期 YYYY-MM-DD")
+	to := fs.String("to", "", "结束日期 YYYY-MM-DD（含）")
+	holdDays := fs.Int("hold-days", 30, "装回的区间多少天内不再裁剪，0 表示不保留")
+	noRefresh := fs.Bool("no-refresh", false, "不重算指标、不刷新 stock_history_mv")
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, restoreUsage+"\n选项:\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	fromDate, err1 := time.Parse("2006-01-02", *from)
+	toDate, err2 := time.Parse("2006-01-02", *to)
+	if err1 != nil || err2 != nil {
+		fmt.Fprintln(os.Stderr, "--from / --to 必填，格式 YYYY-MM-DD")
+		fs.Usage()
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	rep, err := importer.Restore(ctx, importer.RestoreOptions{
+		Table:     args[0],
+		From:      fromDate,
+		To:        toDate,
+		Files:     append(files, fs.Args()...),
+		HoldDays:  *holdDays,
+		NoRefresh: *noRefresh,
+	})
+	if rep != nil {
+		log.Printf("📦 装回 %s：%d 个文件，%d 行，%d 只股票，%s ~ %s",
+			args[0], rep.Files, rep.Rows, rep.Symbols, *from, *to)
+	}
+	if err != nil {
+		log.Printf("❌ 装回失败: %v", err)
+		return 1
+	}
+	return 0
+}
+
+func runPartition(args []string) int {
+	if len(args) == 0 || (args[0] != "migrate" && args[0] != "ensure") {
+		fmt.Fprint(os.Stderr, partitionUsage)
+		return 2
+	}
+	fs := flag.NewFlagSet("partition "+args[0], flag.ContinueOnError)
+	from := fs.String("from", "", "ensure：开始日期 YYYY-MM-DD")
+	to := fs.String("to", "", "ensure：结束日期 YYYY-MM-DD")
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, partitionUsage+"\n选项:\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if args[0] == "migrate" {
+		done, err := fetcher.MigratePartitions(ctx)
+		if err != nil {
+			log.Printf("❌ 转换失败（已完成: %s）: %v", strings.Join(done, ", "), err)
+			return 1
+		}
+		if len(done) == 0 {
+			log.Printf("ℹ️ 已经都是分区表，无需转换")
+		} else {
+			log.Printf("✅ 已转换为按月分区: %s", strings.Join(done, ", "))
+		}
+		return 0
+	}
+
+	var (
+		n   int
+		err error
+	)
+	if *from == "" && *to == "" {
+		n, err = fetcher.EnsureUpcomingPartitions(ctx)
+	} else {
+		fromDate, err1 := time.Parse("2006-01-02", *from)
+		toDate, err2 := time.Parse("2006-01-02", *to)
+		if err1 != nil || err2 != nil || toDate.Before(fromDate) {
+			fmt.Fprintln(os.Stderr, "--from / --to 需同时给出，格式 YYYY-MM-DD")
+			fs.Usage()
+			return 2
+		}
+		n, err = fetcher.EnsurePartitions(ctx, fromDate, toDate)
+	}
+	if err != nil {
+		log.Printf("❌ 建分区失败: %v", err)
+		return 1
+	}
+	log.Printf("✅ 新建 %d 个月份分区", n)
+	return 0
+}
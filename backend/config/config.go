@@ -1,20 +1,18 @@
 package config
 
 import (
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/base64"
-	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"log"
 	"os"
 	"strconv"
-	"strings"
 	"time"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+
+	"oh-my-stock/calendar"
+	"oh-my-stock/jwt"
 )
 
 // ============================================================
@@ -32,9 +30,25 @@ type FrontendConfig struct {
 	Origin string `json:"origin"`
 }
 
+// JWTConfig 登录 token：访问 token 短期有效，过期后用 refresh token 换新（见 auth 包）。
 type JWTConfig struct {
-	Secret  string `json:"secret"`
-	TTLHours int    `json:"ttl_hours"`
+	Secret           string         `json:"secret"`             // 没配 keys 时的 HS256 密钥；也用来校验老格式 token
+	TTLHours         int            `json:"ttl_hours"`          // 会话（refresh token）有效期，期间每次刷新顺延，默认 168（7 天）
+	AccessTTLMinutes int            `json:"access_ttl_minutes"` // 访问 token 有效期，默认 15 分钟
+	Issuer           string         `json:"issuer"`             // iss，默认 oh-my-stock
+	Keys             []JWTKeyConfig `json:"keys"`               // 签名密钥，签发用 created_at 最新的，校验认所有没过期的
+	AcceptLegacy     *bool          `json:"accept_legacy"`      // 是否接受升级前的老格式 token，默认 true
+}
+
+// JWTKeyConfig 一把签名密钥。轮换：加一把 created_at 更新的，旧的 expires_at 设到最长 token 有效期之后。
+type JWTKeyConfig struct {
+	KID        string `json:"kid"`
+	Alg        string `json:"alg"`         // HS256（默认）/ EdDSA
+	Secret     string `json:"secret"`      // HS256
+	PrivateKey string `json:"private_key"` // EdDSA：PEM（PKCS#8）或 base64 的 32 字节种子；不填 = 只验签
+	PublicKey  string `json:"public_key"`  // EdDSA：PEM（PKIX）或 base64；有私钥时可不填
+	CreatedAt  string `json:"created_at"`  // YYYY-MM-DD 或 RFC3339
+	ExpiresAt  string `json:"expires_at"`  // 过期后不再签发也不再认，空 = 不过期
 }
 
 type ServerConfig struct {
@@ -42,11 +56,98 @@ type ServerConfig struct {
 	Port string `json:"port"`
 }
 
+// ProvidersConfig 行情数据源：order 为故障转移顺序，options 按数据源名给参数。
+// 例如 {"order": ["sina", "eastmoney"]}；离线开发用 {"order": ["fixture"], "options": {"fixture": {"dir": "../cache"}}}
+type ProvidersConfig struct {
+	Order   []string                     `json:"order"`
+	Options map[string]map[string]string `json:"options"`
+}
+
+// CalendarConfig 交易日历：holidays_file 非空时用该文件替换内置休市表（格式同 calendar/holidays.txt）。
+type CalendarConfig struct {
+	HolidaysFile string `json:"holidays_file"`
+}
+
+// FetchConfig 抓取上游的限流、重试、熔断（见 fetcher 包），零值字段取默认值。
+type FetchConfig struct {
+	Concurrency int           `json:"concurrency"` // 批量抓取的并发数，默认 10
+	RateLimits  RateLimits    `json:"rate_limits"`
+	Retry       RetryConfig   `json:"retry"`
+	Breaker     BreakerConfig `json:"breaker"`
+}
+
+// RateLimits 按上游 Host 的令牌桶；hosts 里没列的用 default。
+type RateLimits struct {
+	Default RateLimit            `json:"default"`
+	Hosts   map[string]RateLimit `json:"hosts"`
+}
+
+// RateLimit 每秒 rps 个请求，允许 burst 个突发；rps <= 0 表示不限。
+type RateLimit struct {
+	RPS   float64 `json:"rps"`
+	Burst int     `json:"burst"`
+}
+
+// RetryConfig 指数退避 + 抖动；budget_ratio 为重试预算（每次请求攒 ratio 次重试额度，
+// 至少保留 budget_min 次），上游整体故障时重试不会放大流量。
+type RetryConfig struct {
+	MaxAttempts int     `json:"max_attempts"`
+	BaseMS      int     `json:"base_ms"`
+	MaxMS       int     `json:"max_ms"`
+	Jitter      float64 `json:"jitter"` // 0..1，退避时间随机缩短的最大比例
+	BudgetRatio float64 `json:"budget_ratio"`
+	BudgetMin   int     `json:"budget_min"`
+}
+
+// BreakerConfig 同一数据源连续失败 failure_threshold 次后熔断 cooldown_sec 秒，之后放一个探测请求。
+type BreakerConfig struct {
+	FailureThreshold int `json:"failure_threshold"`
+	CooldownSec      int `json:"cooldown_sec"`
+}
+
+// RetentionConfig 按表的数据保留策略（见 fetcher/retention.go）：过期的整月先归档成 archive_dir 下的
+// .csv.gz 再删除，restore 子命令可以按日期区间装回。tables 里没列的表用内置默认值。
+type RetentionConfig struct {
+	ArchiveDir string                     `json:"archive_dir"` // 默认 ./archive
+	Tables     map[string]RetentionPolicy `json:"tables"`
+}
+
+// RetentionPolicy keep_days 保留的已收盘交易日数，-1 表示永久保留；archive 为 false 时过期直接删除。
+// 零值字段取该表的默认值。
+type RetentionPolicy struct {
+	KeepDays int   `json:"keep_days"`
+	Archive  *bool `json:"archive"`
+}
+
+// NotifyConfig 规则通知的外发渠道（见 notify 包）。smtp 是邮件渠道共用的发信服务器。
+type NotifyConfig struct {
+	SMTP SMTPConfig `json:"smtp"`
+	// AllowPrivateHosts 允许 webhook / 机器人地址指向内网、回环地址（本地联调用），默认禁止
+	AllowPrivateHosts bool `json:"allow_private_hosts"`
+	MaxAttempts       int  `json:"max_attempts"` // 每条投递最多尝试次数，默认 5
+	TimeoutSec        int  `json:"timeout_sec"`  // 单次发送超时，默认 10
+}
+
+// SMTPConfig 发信服务器。tls: starttls（默认，587）/ tls（465）/ none（仅本地联调）。
+type SMTPConfig struct {
+	Host     string `json:"host"`
+	Port     string `json:"port"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	From     string `json:"from"`
+	TLS      string `json:"tls"`
+}
+
 type Config struct {
-	Database DBConfig      `json:"database"`
-	Frontend FrontendConfig `json:"frontend"`
-	JWT      JWTConfig     `json:"jwt"`
-	Server   ServerConfig  `json:"server"`
+	Database  DBConfig        `json:"database"`
+	Frontend  FrontendConfig  `json:"frontend"`
+	JWT       JWTConfig       `json:"jwt"`
+	Server    ServerConfig    `json:"server"`
+	Providers ProvidersConfig `json:"providers"`
+	Calendar  CalendarConfig  `json:"calendar"`
+	Fetch     FetchConfig     `json:"fetch"`
+	Retention RetentionConfig `json:"retention"`
+	Notify    NotifyConfig    `json:"notify"`
 }
 
 var (
@@ -78,8 +179,15 @@ func LoadConfig(path string) {
 	if Cfg.JWT.TTLHours <= 0 {
 		Cfg.JWT.TTLHours = 168 // 默认 7 天
 	}
-	log.Printf("✅ 配置加载完成: db=%s/%s frontend=%s jwt_ttl=%dh",
-		Cfg.Database.Host, Cfg.Database.Name, Cfg.Frontend.Origin, Cfg.JWT.TTLHours)
+	if Cfg.JWT.AccessTTLMinutes <= 0 {
+		Cfg.JWT.AccessTTLMinutes = 15
+	}
+	if Cfg.JWT.Issuer == "" {
+		Cfg.JWT.Issuer = "oh-my-stock"
+	}
+	loadKeys()
+	log.Printf("✅ 配置加载完成: db=%s/%s frontend=%s session_ttl=%dh access_ttl=%dm",
+		Cfg.Database.Host, Cfg.Database.Name, Cfg.Frontend.Origin, Cfg.JWT.TTLHours, Cfg.JWT.AccessTTLMinutes)
 }
 
 func expandEnv(s string) string {
@@ -111,59 +219,155 @@ func InitDB() {
 }
 
 // ============================================================
-// JWT (HMAC-SHA256，自实现，不引第三方库)
+// JWT（RFC 7519，HS256 / EdDSA，见 jwt 包）
 //
-// token 格式: base64url(payload).hex(hmac_sha256(secret, base64url(payload)))
-// payload    : { "uid": <user_uuid>, "exp": <unix_ts>, "iat": <unix_ts> }
+// header : {"alg": "HS256" | "EdDSA", "typ": "JWT", "kid": <密钥 ID>}
+// claims : {"iss", "sub": <user_uuid>, "sid": <session_id>, "scope", "iat", "exp"}
+// 签发用 jwt.keys 里最新的密钥，校验认所有没过期的；没配 keys 时用 jwt.secret（kid = default）。
+// 升级前的老格式 token 在 jwt.accept_legacy 打开时照常可用。
+// 只是无状态的访问凭证；会话、refresh token、吊销见 auth 包。
 // ============================================================
-type jwtPayload struct {
-	UID string `json:"uid"`
-	IAT int64  `json:"iat"`
-	EXP int64  `json:"exp"`
-}
 
-func IssueToken(userID string) (string, error) {
-	now := time.Now().Unix()
-	p := jwtPayload{
-		UID: userID,
-		IAT: now,
-		EXP: now + int64(Cfg.JWT.TTLHours)*3600,
+// DefaultKeyID 没配 jwt.keys 时由 jwt.secret 生成的密钥的 kid。
+// 改成多密钥时把原来的 secret 以这个 kid 配进 keys，已签发的 token 不会失效。
+const DefaultKeyID = "default"
+
+var keySet *jwt.KeySet
+
+// loadKeys 按配置建密钥集合，配置有误直接退出。
+func loadKeys() {
+	var keys []*jwt.Key
+	for _, kc := range Cfg.JWT.Keys {
+		k, err := newKey(kc)
+		if err != nil {
+			log.Fatalf("❌ jwt.keys 配置错误: %v", err)
+		}
+		keys = append(keys, k)
+	}
+	if len(keys) == 0 {
+		if Cfg.JWT.Secret == "" {
+			log.Fatalf("❌ jwt.secret 和 jwt.keys 至少配一个")
+		}
+		k, err := jwt.NewHMACKey(DefaultKeyID, []byte(Cfg.JWT.Secret), time.Time{}, time.Time{})
+		if err != nil {
+			log.Fatalf("❌ jwt.secret 配置错误: %v", err)
+		}
+		keys = append(keys, k)
+	}
+	var legacy []byte
+	if Cfg.JWT.AcceptLegacy == nil || *Cfg.JWT.AcceptLegacy {
+		if Cfg.JWT.Secret == "" {
+			log.Printf("⚠️ jwt.secret 为空，无法校验老格式 token")
+		} else {
+			legacy = []byte(Cfg.JWT.Secret)
+		}
 	}
-	payloadJSON, err := json.Marshal(p)
+	ks, err := jwt.NewKeySet(Cfg.JWT.Issuer, keys, legacy)
 	if err != nil {
-		return "", err
+		log.Fatalf("❌ jwt 密钥配置错误: %v", err)
 	}
-	payloadB64 := base64.RawURLEncoding.EncodeToString(payloadJSON)
-	mac := hmac.New(sha256.New, []byte(Cfg.JWT.Secret))
-	mac.Write([]byte(payloadB64))
-	sig := hex.EncodeToString(mac.Sum(nil))
-	return payloadB64 + "." + sig, nil
+	if ks.SigningKeyID() == "" {
+		log.Fatalf("❌ jwt.keys 里能签发的密钥都已过期")
+	}
+	keySet = ks
+	log.Printf("✅ JWT 密钥 %d 把，签发用 %s，老格式 token: %v", len(keys), ks.SigningKeyID(), ks.AcceptsLegacy())
 }
 
-func VerifyToken(token string) (string, error) {
-	parts := strings.SplitN(token, ".", 2)
-	if len(parts) != 2 {
-		return "", fmt.Errorf("malformed token")
+// parseKeyTime 密钥的 created_at / expires_at：YYYY-MM-DD（上海时间零点）或 RFC3339，空 = 零值。
+func parseKeyTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
 	}
-	payloadB64, sig := parts[0], parts[1]
-	mac := hmac.New(sha256.New, []byte(Cfg.JWT.Secret))
-	mac.Write([]byte(payloadB64))
-	want := hex.EncodeToString(mac.Sum(nil))
-	if !hmac.Equal([]byte(sig), []byte(want)) {
-		return "", fmt.Errorf("bad signature")
+	return time.ParseInLocation("2006-01-02", s, calendar.Shanghai)
+}
+
+func newKey(kc JWTKeyConfig) (*jwt.Key, error) {
+	created, err := parseKeyTime(kc.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("密钥 %s: created_at: %w", kc.KID, err)
 	}
-	raw, err := base64.RawURLEncoding.DecodeString(payloadB64)
+	expires, err := parseKeyTime(kc.ExpiresAt)
 	if err != nil {
-		return "", err
+		return nil, fmt.Errorf("密钥 %s: expires_at: %w", kc.KID, err)
+	}
+	switch kc.Alg {
+	case "", jwt.AlgHS256:
+		if len(kc.Secret) < 32 {
+			log.Printf("⚠️ jwt 密钥 %s 的 secret 不足 32 字节", kc.KID)
+		}
+		return jwt.NewHMACKey(kc.KID, []byte(kc.Secret), created, expires)
+	case jwt.AlgEdDSA:
+		return jwt.NewEdDSAKey(kc.KID, kc.PrivateKey, kc.PublicKey, created, expires)
 	}
-	var p jwtPayload
-	if err := json.Unmarshal(raw, &p); err != nil {
-		return "", err
+	return nil, fmt.Errorf("密钥 %s: 不支持的 alg %q（HS256 / EdDSA）", kc.KID, kc.Alg)
+}
+
+// Claims token 里的身份信息。
+type Claims struct {
+	UserID    string
+	SessionID string // user_sessions.id；升级前签发的老 token 没有
+	IssuedAt  time.Time
+}
+
+// AccessTTL 访问 token 的有效期。
+func AccessTTL() time.Duration {
+	return time.Duration(Cfg.JWT.AccessTTLMinutes) * time.Minute
+}
+
+// SessionTTL 会话（refresh token）的有效期。
+func SessionTTL() time.Duration {
+	return time.Duration(Cfg.JWT.TTLHours) * time.Hour
+}
+
+// IssueAccessToken 给会话签发访问 token。
+func IssueAccessToken(userID, sessionID string) (string, error) {
+	return issue(userID, sessionID, "", AccessTTL())
+}
+
+// VerifyToken 校验访问 token 的签名和有效期；会话是否已吊销由调用方（auth.Check）判断。
+func VerifyToken(token string) (Claims, error) {
+	return verify(token, "")
+}
+
+// IssueScopedToken 只能用于某个用途（scope，如 "events"）的短期 token，带上签发时的会话，随会话一起吊销。
+// scope 写在声明里，和登录 token 互不通用：拿它调不了其他接口，登录 token 也冒充不了它。
+func IssueScopedToken(userID, sessionID, scope string, ttl time.Duration) (string, error) {
+	return issue(userID, sessionID, scope, ttl)
+}
+
+// VerifyScopedToken 校验 IssueScopedToken 签发的 token。
+func VerifyScopedToken(token, scope string) (Claims, error) {
+	if scope == "" {
+		return Claims{}, fmt.Errorf("scope required")
 	}
-	if p.EXP > 0 && time.Now().Unix() > p.EXP {
-		return "", fmt.Errorf("token expired")
+	return verify(token, scope)
+}
+
+// JWKS 对外公开的验签公钥（只有 EdDSA 密钥）。
+func JWKS() jwt.JWKSet {
+	return keySet.JWKS(time.Now())
+}
+
+func issue(userID, sessionID, scope string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	return keySet.Sign(jwt.Claims{
+		Subject:   userID,
+		SessionID: sessionID,
+		Scope:     scope,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(ttl).Unix(),
+	}, now)
+}
+
+func verify(token, scope string) (Claims, error) {
+	c, err := keySet.Verify(token, scope, time.Now())
+	if err != nil {
+		return Claims{}, err
 	}
-	return p.UID, nil
+	return Claims{UserID: c.Subject, SessionID: c.SessionID, IssuedAt: time.Unix(c.IssuedAt, 0)}, nil
 }
 
 // 辅助：从环境变量读整型（供 main 调用端口 log 用）
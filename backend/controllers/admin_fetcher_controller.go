@@ -0,0 +1,18 @@
+package controllers
+
+import (
+	"net/http"
+
+	"oh-my-stock/fetcher"
+
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary 抓取指标（按 Host 的限流排队、按数据源的重试 / 熔断）
+// @Tags 管理
+// @Produce json
+// @Success 200 {object} fetcher.MetricsSnapshot
+// @Router /admin/fetcher/metrics [get]
+func GetFetcherMetrics(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"data": fetcher.Metrics()})
+}
@@ -0,0 +1,184 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"oh-my-stock/jobs"
+	"oh-my-stock/middleware"
+	"oh-my-stock/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// @Summary 后台任务列表（调度、下次运行时间、是否在跑）
+// @Tags 管理
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /admin/jobs [get]
+func ListJobs(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"data": jobs.List()})
+}
+
+// @Summary 某个任务最近的运行记录
+// @Tags 管理
+// @Produce json
+// @Param name path string true "任务名"
+// @Param limit query int false "条数，默认 20，最大 200"
+// @Success 200 {object} map[string]interface{}
+// @Router /admin/jobs/{name}/runs [get]
+func ListJobRuns(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	runs, err := jobs.Runs(c.Param("name"), limit)
+	if err != nil {
+		c.JSON(jobErrStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": runs})
+}
+
+// @Summary 单次运行详情（运行中返回实时计数）
+// @Tags 管理
+// @Produce json
+// @Param id path int true "运行记录 ID"
+// @Success 200 {object} models.JobRun
+// @Router /admin/job-runs/{id} [get]
+func GetJobRun(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	run, err := jobs.GetRun(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "运行记录不存在"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, run)
+}
+
+// @Summary 手动触发任务（后台运行，立即返回运行记录 ID）
+// @Tags 管理
+// @Produce json
+// @Param name path string true "任务名"
+// @Success 202 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{} "任务正在运行"
+// @Router /admin/jobs/{name}/trigger [post]
+func TriggerJob(c *gin.Context) {
+	// 不跟随请求 ctx：请求结束后任务继续跑，需要停下来走 cancel 接口
+	id, err := jobs.Trigger(context.Background(), c.Param("name"), "manual", middleware.GetUserID(c))
+	if err != nil {
+		c.JSON(jobErrStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": "已触发", "run_id": id})
+}
+
+// @Summary 取消正在运行的任务
+// @Tags 管理
+// @Produce json
+// @Param name path string true "任务名"
+// @Success 200 {object} map[string]interface{}
+// @Router /admin/jobs/{name}/cancel [post]
+func CancelJob(c *gin.Context) {
+	if err := jobs.Cancel(c.Param("name")); err != nil {
+		c.JSON(jobErrStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "已发送取消信号"})
+}
+
+// @Summary 一次运行的逐股进度和状态（按股票采集的任务）
+// @Tags 管理
+// @Produce json
+// @Param id path int true "运行记录 ID"
+// @Param status query string false "pending / ok / failed / skipped，空为全部"
+// @Param page query int false "页码，默认 1"
+// @Param page_size query int false "每页数量，默认 50，最大 500"
+// @Success 200 {object} map[string]interface{}
+// @Router /admin/job-runs/{id}/symbols [get]
+func ListJobRunSymbols(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	status := c.Query("status")
+	switch status {
+	case "", models.IngestPending, models.IngestOK, models.IngestFailed, models.IngestSkipped:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status 只能是 pending / ok / failed / skipped"})
+		return
+	}
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "50"))
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 || pageSize > 500 {
+		pageSize = 50
+	}
+	progress, err := jobs.RunProgress(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	rows, total, err := jobs.RunSymbols(id, status, (page-1)*pageSize, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"progress":  progress,
+		"page":      page,
+		"page_size": pageSize,
+		"total":     total,
+		"data":      rows,
+	})
+}
+
+// @Summary 只重试某次运行中失败的股票（新建一次运行）
+// @Tags 管理
+// @Produce json
+// @Param id path int true "运行记录 ID"
+// @Success 202 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{} "任务不支持或没有失败的股票"
+// @Failure 409 {object} map[string]interface{} "任务正在运行"
+// @Router /admin/job-runs/{id}/retry-failed [post]
+func RetryJobRunFailed(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	newID, err := jobs.RetryFailed(context.Background(), id, middleware.GetUserID(c))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "运行记录不存在"})
+		return
+	}
+	if err != nil {
+		c.JSON(jobErrStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": "已触发", "run_id": newID})
+}
+
+func jobErrStatus(err error) int {
+	switch {
+	case errors.Is(err, jobs.ErrUnknownJob):
+		return http.StatusNotFound
+	case errors.Is(err, jobs.ErrNotIngest), errors.Is(err, jobs.ErrNothingToRetry):
+		return http.StatusBadRequest
+	case errors.Is(err, jobs.ErrRunning), errors.Is(err, jobs.ErrNotRunning), errors.Is(err, jobs.ErrLockedElsewhere):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
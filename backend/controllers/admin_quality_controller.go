@@ -0,0 +1,206 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"oh-my-stock/fetcher"
+	"oh-my-stock/middleware"
+	"oh-my-stock/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// @Summary 未通过数据质量校验的日 K（隔离区）
+// @Tags 管理
+// @Produce json
+// @Param status query string false "pending / admitted / rejected，默认 pending，all 为全部"
+// @Param symbol query string false "股票代码"
+// @Param reason query string false "隔离原因，如 ohlc / price_jump / zero_volume"
+// @Param page query int false "页码，默认 1"
+// @Param page_size query int false "每页数量，默认 20，最大 200"
+// @Success 200 {object} map[string]interface{}
+// @Router /admin/quarantine [get]
+func ListQuarantine(c *gin.Context) {
+	f := fetcher.QuarantineFilter{
+		Status: c.DefaultQuery("status", models.QuarantinePending),
+		Symbol: c.Query("symbol"),
+		Reason: c.Query("reason"),
+	}
+	switch f.Status {
+	case "all":
+		f.Status = ""
+	case models.QuarantinePending, models.QuarantineAdmitted, models.QuarantineRejected:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status 只能是 pending / admitted / rejected / all"})
+		return
+	}
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 || pageSize > 200 {
+		pageSize = 20
+	}
+	rows, total, err := fetcher.ListQuarantine(f, (page-1)*pageSize, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"page": page, "page_size": pageSize, "total": total, "data": rows})
+}
+
+// @Summary 放行一条隔离的日 K（写入日 K 表并重算涨跌幅、复权因子和指标）
+// @Tags 管理
+// @Produce json
+// @Param id path int true "隔离记录 ID"
+// @Success 200 {object} models.StockDailyQuarantine
+// @Failure 409 {object} map[string]interface{} "已放行"
+// @Router /admin/quarantine/{id}/admit [post]
+func AdmitQuarantine(c *gin.Context) {
+	reviewQuarantine(c, fetcher.AdmitQuarantined)
+}
+
+// @Summary 丢弃一条隔离的日 K（之后再抓到相同的 K 线直接忽略）
+// @Tags 管理
+// @Produce json
+// @Param id path int true "隔离记录 ID"
+// @Success 200 {object} models.StockDailyQuarantine
+// @Failure 409 {object} map[string]interface{} "已复核"
+// @Router /admin/quarantine/{id}/reject [post]
+func RejectQuarantine(c *gin.Context) {
+	reviewQuarantine(c, fetcher.RejectQuarantined)
+}
+
+func reviewQuarantine(c *gin.Context, review func(id int64, by string) (*models.StockDailyQuarantine, error)) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	q, err := review(id, middleware.GetUserID(c))
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "隔离记录不存在"})
+	case errors.Is(err, fetcher.ErrQuarantineState):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusOK, q)
+	}
+}
+
+// @Summary 日 K 完整性报告（应有交易日 vs 已入库）
+// @Tags 管理
+// @Produce json
+// @Param incomplete query bool false "只看有缺失的，默认 true"
+// @Param page query int false "页码，默认 1"
+// @Param page_size query int false "每页数量，默认 50，最大 500"
+// @Success 200 {object} map[string]interface{}
+// @Router /admin/data/completeness [get]
+func GetDataCompleteness(c *gin.Context) {
+	onlyIncomplete, err := strconv.ParseBool(c.DefaultQuery("incomplete", "true"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "incomplete 只能是 true / false"})
+		return
+	}
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "50"))
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 || pageSize > 500 {
+		pageSize = 50
+	}
+	rows, err := fetcher.CompletenessReport(onlyIncomplete)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	total := len(rows)
+	start := (page - 1) * pageSize
+	if start > total {
+		start = total
+	}
+	end := start + pageSize
+	if end > total {
+		end = total
+	}
+	c.JSON(http.StatusOK, gin.H{"page": page, "page_size": pageSize, "total": total, "data": rows[start:end]})
+}
+
+// @Summary 单只股票的日 K 缺口和补抓记录
+// @Tags 管理
+// @Produce json
+// @Param symbol path string true "股票代码"
+// @Success 200 {object} map[string]interface{}
+// @Router /admin/data/completeness/{symbol} [get]
+func GetSymbolCompleteness(c *gin.Context) {
+	summary, gaps, records, err := fetcher.SymbolGaps(c.Param("symbol"))
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "股票不存在"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"summary": summary, "pending": summary.Pending(), "gaps": gaps, "records": records})
+}
+
+// @Summary stock_history_mv 状态（定义版本、最近刷新、基表/视图最大交易日、是否过期）
+// @Description 手动刷新或重建走 POST /admin/jobs/history_mv/trigger
+// @Tags 管理
+// @Produce json
+// @Success 200 {object} fetcher.MVStatus
+// @Router /admin/data/mv [get]
+func GetHistoryMVStatus(c *gin.Context) {
+	s, err := fetcher.HistoryMVStatus()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, s)
+}
+
+// @Summary 保留策略、归档文件和装回保留期
+// @Tags 管理
+// @Produce json
+// @Param table query string false "只看某张表"
+// @Param page query int false "页码，默认 1"
+// @Param page_size query int false "每页数量，默认 50，最大 500"
+// @Success 200 {object} map[string]interface{}
+// @Router /admin/data/archives [get]
+func ListArchives(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "50"))
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 || pageSize > 500 {
+		pageSize = 50
+	}
+	files, total, err := fetcher.ListArchiveFiles(c.Query("table"), page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	holds, err := fetcher.ActiveRetentionHolds()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"archive_dir": fetcher.ArchiveDir(),
+		"policies":    fetcher.RetentionPolicies(),
+		"holds":       holds,
+		"page":        page,
+		"page_size":   pageSize,
+		"total":       total,
+		"data":        files,
+	})
+}
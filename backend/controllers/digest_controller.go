@@ -0,0 +1,192 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"time"
+
+	"oh-my-stock/config"
+	"oh-my-stock/digest"
+	"oh-my-stock/middleware"
+	"oh-my-stock/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ============================================================
+// 收盘日报（daily_digest 任务生成，见 digest 包）
+//
+//   GET  /user/digests                 日报列表（新的在前，不含正文）
+//   GET  /user/digests/:date           某天的日报，:date 为 YYYY-MM-DD 或 latest；
+//                                      ?format=html 直接返回 HTML 页面，?format=markdown 返回 Markdown，默认 JSON
+//   POST /user/digests/generate        立即生成（或重新生成）最新交易日的日报，不发邮件
+//   GET  /user/digest-settings         日报设置
+//   PUT  /user/digest-settings         修改设置 {"enabled","email","email_to"}
+// ============================================================
+
+// ListDigests 分页获取日报
+func ListDigests(c *gin.Context) {
+	uid := middleware.GetUserID(c)
+	if uid == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未登录"})
+		return
+	}
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 || pageSize > 100 {
+		pageSize = 20
+	}
+	q := config.DB.Model(&models.DailyDigest{}).Where("user_id = ?", uid)
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	var rows []models.DailyDigest
+	if err := q.Omit("summary", "markdown", "html").Order("trade_date DESC").
+		Offset((page - 1) * pageSize).Limit(pageSize).Find(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"page": page, "page_size": pageSize, "total": total, "data": rows})
+}
+
+// GetDigest 某天的日报
+func GetDigest(c *gin.Context) {
+	uid := middleware.GetUserID(c)
+	if uid == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未登录"})
+		return
+	}
+	q := config.DB.Where("user_id = ?", uid)
+	if date := c.Param("date"); date == "latest" {
+		q = q.Order("trade_date DESC")
+	} else if _, err := time.Parse("2006-01-02", date); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "日期格式应为 YYYY-MM-DD 或 latest"})
+		return
+	} else {
+		q = q.Where("trade_date = ?", date)
+	}
+	var row models.DailyDigest
+	if err := q.First(&row).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "日报不存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	switch c.Query("format") {
+	case "html":
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(row.HTML))
+	case "markdown", "md":
+		c.Data(http.StatusOK, "text/markdown; charset=utf-8", []byte(row.Markdown))
+	default:
+		c.JSON(http.StatusOK, gin.H{"digest": row, "summary": json.RawMessage(row.Summary), "markdown": row.Markdown})
+	}
+}
+
+// GenerateDigest 立即生成最新交易日的日报
+func GenerateDigest(c *gin.Context) {
+	uid := middleware.GetUserID(c)
+	if uid == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未登录"})
+		return
+	}
+	m, err := digest.LoadMarket(c.Request.Context(), config.DB, time.Time{})
+	if err != nil {
+		if errors.Is(err, digest.ErrNoData) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	row, err := digest.GenerateForUser(c.Request.Context(), config.DB, m, uid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "日报已生成", "digest": row, "summary": json.RawMessage(row.Summary)})
+}
+
+// loadDigestSetting 用户的日报设置，没有记录时返回默认值。
+func loadDigestSetting(uid string) (models.DigestSetting, error) {
+	s := models.DigestSetting{UserID: uid, Enabled: true}
+	err := config.DB.Where("user_id = ?", uid).First(&s).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return s, nil
+	}
+	return s, err
+}
+
+// GetDigestSettings 日报设置
+func GetDigestSettings(c *gin.Context) {
+	uid := middleware.GetUserID(c)
+	if uid == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未登录"})
+		return
+	}
+	s, err := loadDigestSetting(uid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, s)
+}
+
+// UpdateDigestSettings 修改日报设置，不传的字段保持原值
+func UpdateDigestSettings(c *gin.Context) {
+	uid := middleware.GetUserID(c)
+	if uid == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未登录"})
+		return
+	}
+	var req struct {
+		Enabled *bool   `json:"enabled"`
+		Email   *bool   `json:"email"`
+		EmailTo *string `json:"email_to"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	s, err := loadDigestSetting(uid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Enabled != nil {
+		s.Enabled = *req.Enabled
+	}
+	if req.Email != nil {
+		s.Email = *req.Email
+	}
+	if req.EmailTo != nil {
+		if *req.EmailTo != "" {
+			if _, err := mail.ParseAddress(*req.EmailTo); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "邮箱地址不合法"})
+				return
+			}
+		}
+		s.EmailTo = *req.EmailTo
+	}
+	s.UpdatedAt = time.Now()
+	// Enabled / Email 为 false 时 gorm 会省略零值走库默认值，upsert 显式带上全部列
+	if err := config.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"enabled", "email", "email_to", "updated_at"}),
+	}).Select("UserID", "Enabled", "Email", "EmailTo", "UpdatedAt").Create(&s).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "更新成功", "settings": s})
+}
@@ -0,0 +1,145 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"oh-my-stock/auth"
+	"oh-my-stock/config"
+	"oh-my-stock/events"
+	"oh-my-stock/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ============================================================
+// 实时事件推送（Server-Sent Events，见 events 包）
+//
+//   POST /user/events/ticket   换一张只能用于事件流的短期票据（EventSource 不能带请求头）
+//   GET  /user/events          事件流：Authorization 头或 ?ticket=；
+//                              断线重连带 Last-Event-ID（或 ?last_event_id=）补发错过的事件
+// ============================================================
+
+// StreamTicketTTL 事件流票据有效期；过期后重连会 401，前端重新换票据。
+// 票据跟着签发它的会话走，退出登录后随会话一起失效，已连着的流在下一次心跳时断开。
+const StreamTicketTTL = time.Hour
+
+// streamHeartbeat 心跳间隔，防止代理 / 负载均衡把空闲连接掐掉。
+const streamHeartbeat = 25 * time.Second
+
+// streamReplayLimit 重连时最多补发的事件数，更早的请前端走列表接口。
+const streamReplayLimit = 500
+
+// IssueEventTicket 换事件流票据
+func IssueEventTicket(c *gin.Context) {
+	uid := middleware.GetUserID(c)
+	if uid == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未登录"})
+		return
+	}
+	ticket, err := config.IssueScopedToken(uid, middleware.GetSessionID(c), middleware.StreamScope, StreamTicketTTL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ticket": ticket, "expires_in": int(StreamTicketTTL.Seconds())})
+}
+
+// StreamEvents 推送当前用户的实时事件：notification（规则命中）、ingest（行情入库完成）、alert（价格提醒）。
+func StreamEvents(c *gin.Context) {
+	uid := middleware.GetUserID(c)
+	if uid == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未登录"})
+		return
+	}
+	lastID, _ := strconv.ParseInt(c.GetHeader("Last-Event-ID"), 10, 64)
+	if lastID == 0 {
+		lastID, _ = strconv.ParseInt(c.Query("last_event_id"), 10, 64)
+	}
+
+	// 先订阅再补发，补发期间到达的实时事件在缓冲里，按 ID 去重
+	sub, err := events.Default.Subscribe(uid)
+	if err != nil {
+		if errors.Is(err, events.ErrTooManyConnections) {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer sub.Close()
+
+	var backlog []events.Event
+	if lastID > 0 {
+		if backlog, err = events.Replay(c.Request.Context(), config.DB, uid, lastID, streamReplayLimit); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	// 长连接不受写超时限制
+	_ = http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+	h := c.Writer.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("Connection", "keep-alive")
+	h.Set("X-Accel-Buffering", "no") // nginx 不要缓冲
+	c.Status(http.StatusOK)
+
+	w := c.Writer
+	if _, err := w.WriteString("retry: 3000\n\n"); err != nil {
+		return
+	}
+	sent := lastID
+	for _, e := range backlog {
+		if events.WriteSSE(w, e) != nil {
+			return
+		}
+		sent = e.ID
+	}
+	w.Flush()
+
+	tick := time.NewTicker(streamHeartbeat)
+	defer tick.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case e, ok := <-sub.C:
+			if !ok {
+				return // 被 Hub 断开（太慢或服务停止），客户端会自动重连补发
+			}
+			// 补发里已经发过的跳过；ID 乱序提交的晚到事件（比 sent 小但没补发过）照发
+			if e.ID <= sent && inBacklog(backlog, e.ID) {
+				continue
+			}
+			if events.WriteSSE(w, e) != nil {
+				return
+			}
+			if e.ID > sent {
+				sent = e.ID
+			}
+			w.Flush()
+		case <-tick.C:
+			// 会话退出或被吊销后断开，客户端重连会 401
+			if claims, ok := middleware.GetClaims(c); ok && auth.Check(config.DB, claims) != nil {
+				return
+			}
+			if _, err := w.WriteString(": ping\n\n"); err != nil {
+				return
+			}
+			w.Flush()
+		}
+	}
+}
+
+func inBacklog(backlog []events.Event, id int64) bool {
+	for _, e := range backlog {
+		if e.ID == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,376 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"oh-my-stock/config"
+	"oh-my-stock/middleware"
+	"oh-my-stock/models"
+	"oh-my-stock/notify"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ============================================================
+// 通知外发渠道（见 notify/channels.go）
+//
+//   GET    /user/channels               渠道列表（密钥脱敏）
+//   POST   /user/channels               新建渠道；webhook 不填 secret 时自动生成，只在这里返回一次
+//   PUT    /user/channels/:id           修改名称 / 配置 / 启停
+//   DELETE /user/channels/:id           删除（规则绑定和投递记录一并删除）
+//   POST   /user/channels/:id/test      立即发一条测试消息，结果写入投递日志
+//   GET    /user/rules/:id/channels     规则绑定的渠道
+//   PUT    /user/rules/:id/channels     设置规则命中后推送到哪些渠道 {"channel_ids": [...]}
+//   GET    /user/deliveries             投递日志（?status=pending|sent|failed&channel_id=）
+// ============================================================
+
+// ChannelData 渠道输出：配置里的密钥只露最后 4 位。
+type ChannelData struct {
+	models.NotificationChannel
+	Config notify.ChannelConfig `json:"config"`
+}
+
+func maskSecret(s string) string {
+	if s == "" {
+		return ""
+	}
+	if len(s) <= 8 {
+		return "****"
+	}
+	return "****" + s[len(s)-4:]
+}
+
+// maskURL 机器人地址里的 access_token / key（企业微信、钉钉在 query，飞书在 path 末段）本身就是凭据，打码。
+func maskURL(u string) string {
+	if i := strings.Index(u, "?"); i >= 0 {
+		return u[:i] + "?****"
+	}
+	if i := strings.LastIndex(u, "/"); i >= 0 && i < len(u)-1 && strings.Count(u, "/") > 3 {
+		return u[:i+1] + "****"
+	}
+	return u
+}
+
+func channelData(ch models.NotificationChannel) ChannelData {
+	var cfg notify.ChannelConfig
+	_ = json.Unmarshal(ch.Config, &cfg)
+	cfg.Secret = maskSecret(cfg.Secret)
+	if ch.Type != notify.ChannelWebhook {
+		cfg.URL = maskURL(cfg.URL)
+	}
+	return ChannelData{NotificationChannel: ch, Config: cfg}
+}
+
+// ListChannels 当前用户的渠道
+func ListChannels(c *gin.Context) {
+	uid := middleware.GetUserID(c)
+	if uid == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未登录"})
+		return
+	}
+	var chs []models.NotificationChannel
+	if err := config.DB.Where("user_id = ?", uid).Order("id").Find(&chs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	data := make([]ChannelData, 0, len(chs))
+	for _, ch := range chs {
+		data = append(data, channelData(ch))
+	}
+	c.JSON(http.StatusOK, gin.H{"total": len(data), "data": data, "types": notify.ChannelTypes})
+}
+
+// AddChannel 新建渠道
+func AddChannel(c *gin.Context) {
+	uid := middleware.GetUserID(c)
+	if uid == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未登录"})
+		return
+	}
+	var req struct {
+		Name    string               `json:"name" binding:"required"`
+		Type    string               `json:"type" binding:"required"`
+		Config  notify.ChannelConfig `json:"config"`
+		Enabled *bool                `json:"enabled"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := notify.ValidateChannel(req.Type, req.Config); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	generated := ""
+	if req.Type == notify.ChannelWebhook && req.Config.Secret == "" {
+		req.Config.Secret = notify.NewSecret()
+		generated = req.Config.Secret
+	}
+	raw, _ := json.Marshal(req.Config)
+	ch := models.NotificationChannel{UserID: uid, Name: req.Name, Type: req.Type, Config: raw, Enabled: true}
+	if req.Enabled != nil {
+		ch.Enabled = *req.Enabled
+	}
+	// Enabled=false 时 gorm 会省略零值走库默认 true，显式带上
+	if err := config.DB.Select("UserID", "Name", "Type", "Config", "Enabled").Create(&ch).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) || strings.Contains(err.Error(), "uk_channel_user_name") {
+			c.JSON(http.StatusConflict, gin.H{"error": "同名渠道已存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	resp := gin.H{"message": "渠道创建成功", "channel": channelData(ch)}
+	if generated != "" {
+		resp["secret"] = generated // 签名密钥只在创建时完整返回一次
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// UpdateChannel 修改渠道。config 里不传的字段保留原值（secret 传空串不会清掉密钥）。
+func UpdateChannel(c *gin.Context) {
+	uid := middleware.GetUserID(c)
+	if uid == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未登录"})
+		return
+	}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID 无效"})
+		return
+	}
+	var req struct {
+		Name    string                `json:"name"`
+		Config  *notify.ChannelConfig `json:"config"`
+		Enabled *bool                 `json:"enabled"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var ch models.NotificationChannel
+	if err := config.DB.Where("id = ? AND user_id = ?", id, uid).First(&ch).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "渠道不存在"})
+		return
+	}
+	updates := map[string]interface{}{}
+	if req.Name != "" {
+		updates["name"] = req.Name
+	}
+	if req.Enabled != nil {
+		updates["enabled"] = *req.Enabled
+	}
+	if req.Config != nil {
+		var cfg notify.ChannelConfig
+		_ = json.Unmarshal(ch.Config, &cfg)
+		if req.Config.URL != "" {
+			cfg.URL = req.Config.URL
+		}
+		if req.Config.Secret != "" {
+			cfg.Secret = req.Config.Secret
+		}
+		if req.Config.To != nil {
+			cfg.To = req.Config.To
+		}
+		if err := notify.ValidateChannel(ch.Type, cfg); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		updates["config"], _ = json.Marshal(cfg)
+	}
+	if len(updates) > 0 {
+		if err := config.DB.Model(&ch).Updates(updates).Error; err != nil {
+			if strings.Contains(err.Error(), "uk_channel_user_name") {
+				c.JSON(http.StatusConflict, gin.H{"error": "同名渠道已存在"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "更新失败"})
+			return
+		}
+	}
+	config.DB.First(&ch, ch.ID)
+	c.JSON(http.StatusOK, gin.H{"message": "更新成功", "channel": channelData(ch)})
+}
+
+// DeleteChannel 删除渠道
+func DeleteChannel(c *gin.Context) {
+	uid := middleware.GetUserID(c)
+	if uid == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未登录"})
+		return
+	}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID 无效"})
+		return
+	}
+	res := config.DB.Where("id = ? AND user_id = ?", id, uid).Delete(&models.NotificationChannel{})
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": res.Error.Error()})
+		return
+	}
+	if res.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "渠道不存在"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "渠道删除成功"})
+}
+
+// TestChannel 立即发一条测试消息（停用的渠道也可以测）
+func TestChannel(c *gin.Context) {
+	uid := middleware.GetUserID(c)
+	if uid == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未登录"})
+		return
+	}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID 无效"})
+		return
+	}
+	var ch models.NotificationChannel
+	if err := config.DB.Where("id = ? AND user_id = ?", id, uid).First(&ch).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "渠道不存在"})
+		return
+	}
+	d, err := notify.SendTest(c.Request.Context(), config.DB, ch)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error(), "delivery": d})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "测试消息已发送", "delivery": d})
+}
+
+// GetRuleChannels 规则绑定的渠道 ID
+func GetRuleChannels(c *gin.Context) {
+	uid := middleware.GetUserID(c)
+	if uid == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未登录"})
+		return
+	}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID 无效"})
+		return
+	}
+	var n int64
+	config.DB.Model(&models.UserStockRule{}).Where("id = ? AND user_id = ?", id, uid).Count(&n)
+	if n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "规则不存在"})
+		return
+	}
+	ids := []uint{}
+	if err := config.DB.Model(&models.RuleChannel{}).Where("rule_id = ?", id).
+		Order("channel_id").Pluck("channel_id", &ids).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"rule_id": id, "channel_ids": ids})
+}
+
+// SetRuleChannels 整体替换规则绑定的渠道；传空数组表示只站内通知
+func SetRuleChannels(c *gin.Context) {
+	uid := middleware.GetUserID(c)
+	if uid == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未登录"})
+		return
+	}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID 无效"})
+		return
+	}
+	var req struct {
+		ChannelIDs []uint `json:"channel_ids"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.ChannelIDs == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "需要 channel_ids 数组"})
+		return
+	}
+	var n int64
+	config.DB.Model(&models.UserStockRule{}).Where("id = ? AND user_id = ?", id, uid).Count(&n)
+	if n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "规则不存在"})
+		return
+	}
+	// 只能绑定自己的渠道
+	ids := dedupeUint(req.ChannelIDs)
+	if len(ids) > 0 {
+		var owned int64
+		config.DB.Model(&models.NotificationChannel{}).Where("id IN ? AND user_id = ?", ids, uid).Count(&owned)
+		if int(owned) != len(ids) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "渠道不存在"})
+			return
+		}
+	}
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("rule_id = ?", id).Delete(&models.RuleChannel{}).Error; err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		rows := make([]models.RuleChannel, 0, len(ids))
+		for _, cid := range ids {
+			rows = append(rows, models.RuleChannel{RuleID: uint(id), ChannelID: cid})
+		}
+		return tx.Create(&rows).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "已更新", "rule_id": id, "channel_ids": ids})
+}
+
+func dedupeUint(in []uint) []uint {
+	seen := map[uint]bool{}
+	out := []uint{}
+	for _, v := range in {
+		if !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// ListDeliveries 投递日志，新的在前
+func ListDeliveries(c *gin.Context) {
+	uid := middleware.GetUserID(c)
+	if uid == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未登录"})
+		return
+	}
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 || pageSize > 100 {
+		pageSize = 20
+	}
+	q := config.DB.Model(&models.NotificationDelivery{}).Where("user_id = ?", uid)
+	if s := c.Query("status"); s != "" {
+		q = q.Where("status = ?", s)
+	}
+	if cid := c.Query("channel_id"); cid != "" {
+		q = q.Where("channel_id = ?", cid)
+	}
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	var rows []models.NotificationDelivery
+	if err := q.Order("id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"page": page, "page_size": pageSize, "total": total, "data": rows})
+}
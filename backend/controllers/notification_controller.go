@@ -0,0 +1,238 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"oh-my-stock/config"
+	"oh-my-stock/middleware"
+	"oh-my-stock/models"
+	"oh-my-stock/notify"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm/clause"
+)
+
+// ============================================================
+// 规则命中通知（rule_check 任务写入，见 notify 包）
+//
+//   GET  /user/notifications               列表（?unread=true 只看未读）
+//   GET  /user/notifications/unread-count  未读数
+//   POST /user/notifications/:id/read      标记已读
+//   POST /user/notifications/read-all      全部标记已读
+//   GET  /user/notifications/preview       按最新快照预览规则命中（不写入、不套用通知策略；?all=true 含关闭通知的规则）
+//   GET  /user/notifications/policy        通知策略（免打扰、每天上限、合并、只通知新进）
+//   PUT  /user/notifications/policy        修改通知策略，不传的字段保持原值
+//   PUT  /user/rules/:id/notify            打开 / 关闭某条规则的通知
+// ============================================================
+
+// ListNotifications 分页获取通知，新的在前
+func ListNotifications(c *gin.Context) {
+	uid := middleware.GetUserID(c)
+	if uid == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未登录"})
+		return
+	}
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 || pageSize > 100 {
+		pageSize = 20
+	}
+	q := config.DB.Model(&models.Notification{}).Where("user_id = ?", uid)
+	if c.Query("unread") == "true" || c.Query("unread") == "1" {
+		q = q.Where("NOT is_read")
+	}
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	var rows []models.Notification
+	if err := q.Order("id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"page": page, "page_size": pageSize, "total": total, "data": rows})
+}
+
+// CountUnreadNotifications 未读通知数
+func CountUnreadNotifications(c *gin.Context) {
+	uid := middleware.GetUserID(c)
+	if uid == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未登录"})
+		return
+	}
+	var n int64
+	if err := config.DB.Model(&models.Notification{}).Where("user_id = ? AND NOT is_read", uid).Count(&n).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"unread": n})
+}
+
+// MarkNotificationRead 标记一条通知已读
+func MarkNotificationRead(c *gin.Context) {
+	uid := middleware.GetUserID(c)
+	if uid == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未登录"})
+		return
+	}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID 无效"})
+		return
+	}
+	res := config.DB.Model(&models.Notification{}).Where("id = ? AND user_id = ?", id, uid).Update("is_read", true)
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": res.Error.Error()})
+		return
+	}
+	if res.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "通知不存在"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "已读"})
+}
+
+// MarkAllNotificationsRead 全部标记已读
+func MarkAllNotificationsRead(c *gin.Context) {
+	uid := middleware.GetUserID(c)
+	if uid == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未登录"})
+		return
+	}
+	res := config.DB.Model(&models.Notification{}).Where("user_id = ? AND NOT is_read", uid).Update("is_read", true)
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": res.Error.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "已全部标记为已读", "updated": res.RowsAffected})
+}
+
+// PreviewNotifications 用最新快照试跑自己的规则，不写通知
+func PreviewNotifications(c *gin.Context) {
+	uid := middleware.GetUserID(c)
+	if uid == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未登录"})
+		return
+	}
+	all := c.Query("all") == "true" || c.Query("all") == "1"
+	hits, skipped, err := notify.DryRunForUser(config.DB, uid, !all)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if hits == nil {
+		hits = []notify.Hit{}
+	}
+	if skipped == nil {
+		skipped = []notify.Unsupported{}
+	}
+	c.JSON(http.StatusOK, gin.H{"total": len(hits), "data": hits, "unsupported": skipped})
+}
+
+// SetRuleNotify 打开 / 关闭规则命中通知
+func SetRuleNotify(c *gin.Context) {
+	uid := middleware.GetUserID(c)
+	if uid == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未登录"})
+		return
+	}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID 无效"})
+		return
+	}
+	var req struct {
+		NotifyOnMatch *bool `json:"notify_on_match" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	res := config.DB.Model(&models.UserStockRule{}).Where("id = ? AND user_id = ?", id, uid).
+		Update("notify_on_match", *req.NotifyOnMatch)
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": res.Error.Error()})
+		return
+	}
+	if res.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "规则不存在"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "已更新", "rule_id": id, "notify_on_match": *req.NotifyOnMatch})
+}
+
+// GetNotificationPolicy 通知策略，没有设置过返回默认值
+func GetNotificationPolicy(c *gin.Context) {
+	uid := middleware.GetUserID(c)
+	if uid == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未登录"})
+		return
+	}
+	p, err := notify.LoadPolicy(config.DB, uid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"policy": p, "max_per_rule_daily_limit": notify.MaxPerRuleDailyLimit})
+}
+
+// UpdateNotificationPolicy 修改通知策略
+func UpdateNotificationPolicy(c *gin.Context) {
+	uid := middleware.GetUserID(c)
+	if uid == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未登录"})
+		return
+	}
+	var req struct {
+		QuietStart      *string `json:"quiet_start"`
+		QuietEnd        *string `json:"quiet_end"`
+		MaxPerRuleDaily *int    `json:"max_per_rule_daily"`
+		GroupHits       *bool   `json:"group_hits"`
+		NewEntriesOnly  *bool   `json:"new_entries_only"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	p, err := notify.LoadPolicy(config.DB, uid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if req.QuietStart != nil {
+		p.QuietStart = *req.QuietStart
+	}
+	if req.QuietEnd != nil {
+		p.QuietEnd = *req.QuietEnd
+	}
+	if req.MaxPerRuleDaily != nil {
+		p.MaxPerRuleDaily = *req.MaxPerRuleDaily
+	}
+	if req.GroupHits != nil {
+		p.GroupHits = *req.GroupHits
+	}
+	if req.NewEntriesOnly != nil {
+		p.NewEntriesOnly = *req.NewEntriesOnly
+	}
+	if err := notify.ValidatePolicy(&p); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	p.UpdatedAt = time.Now()
+	// 布尔 false / 空串是零值，gorm 会省略走库默认值，upsert 显式带上全部列
+	cols := []string{"quiet_start", "quiet_end", "max_per_rule_daily", "group_hits", "new_entries_only", "updated_at"}
+	if err := config.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns(cols),
+	}).Select("UserID", "QuietStart", "QuietEnd", "MaxPerRuleDaily", "GroupHits", "NewEntriesOnly", "UpdatedAt").Create(&p).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "更新成功", "policy": p})
+}
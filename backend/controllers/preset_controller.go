@@ -23,5 +23,5 @@ func RunPreset(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"preset": preset, "page": page, "page_size": pageSize, "total": total, "data": rows})
+	c.JSON(http.StatusOK, gin.H{"preset": preset, "page": page, "page_size": pageSize, "total": total, "data": rows, "freshness": historyFreshness(c)})
 }
@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"oh-my-stock/calendar"
 	"oh-my-stock/config"
+	"oh-my-stock/formula"
 	"oh-my-stock/middleware"
 	"oh-my-stock/models"
 	"strings"
@@ -46,9 +48,10 @@ func RunRule(c *gin.Context) {
 	}
 	matched := runRuleCore(rule)
 	c.JSON(http.StatusOK, gin.H{
-		"matched": len(matched),
-		"date":    time.Now().Format("2006-01-02"),
-		"rules":   matched,
+		"matched":   len(matched),
+		"date":      time.Now().Format("2006-01-02"),
+		"rules":     matched,
+		"freshness": historyFreshness(c),
 	})
 }
 
@@ -69,7 +72,7 @@ func PreviewRule(c *gin.Context) {
 		UserID:         middleware.GetUserID(c),
 	}
 	matched := runRuleCore(tmp)
-	c.JSON(http.StatusOK, gin.H{"matched": len(matched), "rules": matched})
+	c.JSON(http.StatusOK, gin.H{"matched": len(matched), "rules": matched, "freshness": historyFreshness(c)})
 }
 
 // ListTargetStocks 查询候选股
@@ -87,18 +90,27 @@ func ListTargetStocks(c *gin.Context) {
 // ----------------------------------------------------------
 // 核心：解析 + 查询 + 入库
 // ----------------------------------------------------------
+// ruleLookbackDays 连涨 / 连续净流入 / 连续放量最多回看的交易日数
+const ruleLookbackDays = 40
+
+// ruleLookbackStart 回看窗口起点：最近已收盘交易日往前 ruleLookbackDays 个交易日。
+// 按交易日算，长假前后窗口里的 K 线数量不会缩水。
+func ruleLookbackStart() string {
+	return calendar.PrevTradingDay(calendar.LatestSettled(time.Now()), ruleLookbackDays).Format("2006-01-02")
+}
+
 func runRuleCore(rule models.UserStockRule) []models.TargetTrendStock {
 	expr := map[string]interface{}{}
 	_ = json.Unmarshal(rule.RuleExpression, &expr)
 
 	amplifyRatio := getFloat(expr["volume_amplify_days"], "min_ratio", 1.2)
-	whereSQL, args := buildWhereFromSpec(expr, "h", amplifyRatio)
+	whereSQL, args := buildWhereFromSpec(expr, "h", amplifyRatio, loadFormulaRefs(rule.UserID))
 
 	baseSQL := fmt.Sprintf(`
 		WITH latest AS (
 		    SELECT symbol, MAX(trade_date) AS trade_date
 		    FROM stock_history_mv
-		    WHERE trade_date >= CURRENT_DATE - INTERVAL '60 days'
+		    WHERE trade_date >= DATE '%[1]s'
 		    GROUP BY symbol
 		),
 		streak_up AS (
@@ -110,7 +122,7 @@ func runRuleCore(rule models.UserStockRule) []models.TargetTrendStock {
 		                   OVER (PARTITION BY symbol ORDER BY trade_date DESC
 		                         ROWS BETWEEN UNBOUNDED PRECEDING AND CURRENT ROW) AS cum
 		        FROM stock_history_mv
-		        WHERE trade_date >= CURRENT_DATE - INTERVAL '60 days'
+		        WHERE trade_date >= DATE '%[1]s'
 		    ) t
 		    WHERE cum = rn
 		    GROUP BY symbol, cum
@@ -124,7 +136,7 @@ func runRuleCore(rule models.UserStockRule) []models.TargetTrendStock {
 		                   OVER (PARTITION BY symbol ORDER BY trade_date DESC
 		                         ROWS BETWEEN UNBOUNDED PRECEDING AND CURRENT ROW) AS cum
 		        FROM stock_history_mv
-		        WHERE trade_date >= CURRENT_DATE - INTERVAL '60 days'
+		        WHERE trade_date >= DATE '%[1]s'
 		    ) t
 		    WHERE cum = rn
 		    GROUP BY symbol, cum
@@ -142,7 +154,7 @@ func runRuleCore(rule models.UserStockRule) []models.TargetTrendStock {
 		                   LAG(volume) OVER (PARTITION BY symbol ORDER BY trade_date DESC) AS prev_vol,
 		                   ROW_NUMBER() OVER (PARTITION BY symbol ORDER BY trade_date DESC) AS rn
 		            FROM stock_history_mv
-		            WHERE trade_date >= CURRENT_DATE - INTERVAL '60 days'
+		            WHERE trade_date >= DATE '%[1]s'
 		        ) inner_t
 		    ) t
 		    WHERE cum = rn
@@ -161,10 +173,10 @@ func runRuleCore(rule models.UserStockRule) []models.TargetTrendStock {
 		LEFT JOIN streak_up   su ON su.symbol = h.symbol
 		LEFT JOIN streak_in   si ON si.symbol = h.symbol
 		LEFT JOIN streak_vol  sv ON sv.symbol = h.symbol
-		WHERE 1=1 %s
+		WHERE 1=1 %[2]s
 		ORDER BY h.change_percent DESC
 		LIMIT 200
-	`, whereSQL)
+	`, ruleLookbackStart(), whereSQL)
 
 	type rawRow struct {
 		Symbol                       string  `gorm:"column:symbol"`
@@ -218,7 +230,29 @@ func runRuleCore(rule models.UserStockRule) []models.TargetTrendStock {
 // ----------------------------------------------------------
 type cmpItem struct{ col, op string; v interface{} }
 
-func buildWhereFromSpec(spec map[string]interface{}, alias string, amplifyRatio float64) (string, []interface{}) {
+// formulaRef 规则里可引用的用户公式：ID 与输出线（第一条为默认输出）。
+type formulaRef struct {
+	id      uint
+	outputs []string
+}
+
+// loadFormulaRefs 读取用户全部公式，按大写公式名索引。
+func loadFormulaRefs(uid string) map[string]formulaRef {
+	refs := map[string]formulaRef{}
+	if uid == "" {
+		return refs
+	}
+	var fs []models.UserFormula
+	config.DB.Where("user_id = ?", uid).Find(&fs)
+	for _, f := range fs {
+		if p, err := formula.Compile(f.Source); err == nil {
+			refs[f.Name] = formulaRef{id: f.ID, outputs: p.Outputs()}
+		}
+	}
+	return refs
+}
+
+func buildWhereFromSpec(spec map[string]interface{}, alias string, amplifyRatio float64, formulas map[string]formulaRef) (string, []interface{}) {
 	args := []interface{}{amplifyRatio}; _ = args // $1 = amplifyRatio (CTE 用); outer placeholder starts at $2
 	ph := func() string { return fmt.Sprintf("$%d", len(args)+1) }
 	var conds []string
@@ -280,6 +314,30 @@ func buildWhereFromSpec(spec map[string]interface{}, alias string, amplifyRatio
 				args = append(args, s)
 			}
 		default:
+			if strings.HasPrefix(k, "formula:") {
+				// "formula:NAME" / "formula:NAME.OUTPUT" → 该公式在最新交易日的物化取值。
+				// 公式或输出线不存在时整条规则不命中，而不是静默忽略条件。
+				name, out, _ := strings.Cut(strings.ToUpper(strings.TrimPrefix(k, "formula:")), ".")
+				ref, ok := formulas[name]
+				if ok && out == "" {
+					out = ref.outputs[0]
+				}
+				if !ok || !containsStr(ref.outputs, out) {
+					conds = append(conds, "FALSE")
+					continue
+				}
+				for _, it := range cmpSlots("", v) {
+					idPH := ph()
+					args = append(args, ref.id)
+					outPH := ph()
+					args = append(args, out)
+					conds = append(conds, fmt.Sprintf(
+						"(SELECT fv.value FROM user_formula_values fv WHERE fv.formula_id = %s AND fv.output = %s AND fv.symbol = %s.symbol AND fv.trade_date = %s.trade_date) %s %s",
+						idPH, outPH, alias, alias, it.op, ph()))
+					args = append(args, it.v)
+				}
+				continue
+			}
 			addCmp(alias+"."+k, v)
 		}
 	}
@@ -331,6 +389,15 @@ func numFrom(v interface{}) (float64, bool) {
 	return 0, false
 }
 
+func containsStr(ls []string, s string) bool {
+	for _, x := range ls {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
 func getFloat(m interface{}, key string, def float64) float64 {
 	if mp, ok := m.(map[string]interface{}); ok {
 		if v, ok := numFrom(mp[key]); ok {
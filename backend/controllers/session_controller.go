@@ -0,0 +1,159 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"oh-my-stock/auth"
+	"oh-my-stock/config"
+	"oh-my-stock/middleware"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ============================================================
+// 登录会话（见 auth 包）
+//
+//   POST   /user/token/refresh   用 refresh token 换新的访问 token + refresh token（不需要访问 token）
+//   POST   /user/logout          退出当前会话：body {"refresh_token"}，或带 Authorization 退出 token 所属会话
+//   POST   /user/logout-all      退出所有设备（所有会话 + 升级前签发的老 token）
+//   GET    /user/sessions        有效会话列表，current 标记当前会话
+//   DELETE /user/sessions/:id    踢掉某个会话
+//   GET    /.well-known/jwks.json 验签公钥（只有 EdDSA 密钥，HS256 不公开）
+// ============================================================
+
+// clientOf 记在会话上的客户端信息
+func clientOf(c *gin.Context) auth.Client {
+	return auth.Client{UserAgent: c.Request.UserAgent(), IP: c.ClientIP()}
+}
+
+// RefreshToken 刷新 token
+func RefreshToken(c *gin.Context) {
+	var req struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	tokens, err := auth.Refresh(config.DB, req.RefreshToken, clientOf(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrRefreshRaced):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, auth.ErrInvalidRefresh), errors.Is(err, auth.ErrRefreshReused):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+// Logout 退出当前会话。访问 token 可能已经过期，所以挂在鉴权之外，凭 refresh token 或 token 里的会话退出。
+func Logout(c *gin.Context) {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	_ = c.ShouldBindJSON(&req)
+
+	var uid, sid string
+	if req.RefreshToken != "" {
+		s, err := auth.SessionByRefresh(config.DB, req.RefreshToken)
+		if err != nil && !errors.Is(err, auth.ErrInvalidRefresh) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		uid, sid = s.UserID, s.ID
+	} else if token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "); token != "" {
+		if claims, err := config.VerifyToken(token); err == nil {
+			uid, sid = claims.UserID, claims.SessionID
+		}
+	}
+	if sid == "" {
+		// 已经退出过或 token 无效，结果一样，不报错
+		c.JSON(http.StatusOK, gin.H{"message": "已退出"})
+		return
+	}
+	if _, err := auth.Revoke(config.DB, uid, sid, auth.ReasonLogout); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "已退出"})
+}
+
+// LogoutAll 退出所有设备
+func LogoutAll(c *gin.Context) {
+	uid := middleware.GetUserID(c)
+	if uid == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未登录"})
+		return
+	}
+	n, err := auth.RevokeAll(config.DB, uid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "已退出所有设备", "revoked": n})
+}
+
+// ListSessions 有效会话列表
+func ListSessions(c *gin.Context) {
+	uid := middleware.GetUserID(c)
+	if uid == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未登录"})
+		return
+	}
+	rows, err := auth.List(config.DB, uid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	current := middleware.GetSessionID(c)
+	data := make([]gin.H, 0, len(rows))
+	for _, s := range rows {
+		data = append(data, gin.H{
+			"id":           s.ID,
+			"user_agent":   s.UserAgent,
+			"ip":           s.IP,
+			"created_at":   s.CreatedAt,
+			"last_used_at": s.LastUsedAt,
+			"expires_at":   s.ExpiresAt,
+			"current":      s.ID == current,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"data": data})
+}
+
+// RevokeSession 踢掉某个会话
+func RevokeSession(c *gin.Context) {
+	uid := middleware.GetUserID(c)
+	if uid == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未登录"})
+		return
+	}
+	id := c.Param("id")
+	if _, err := uuid.Parse(id); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID 无效"})
+		return
+	}
+	ok, err := auth.Revoke(config.DB, uid, id, auth.ReasonRevoked)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "会话不存在或已失效"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "会话已退出"})
+}
+
+// JWKS 验签公钥。轮换时新旧公钥会同时出现，缓存 5 分钟即可。
+func JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, config.JWKS())
+}
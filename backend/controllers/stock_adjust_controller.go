@@ -0,0 +1,95 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"oh-my-stock/config"
+	"oh-my-stock/fetcher"
+	"oh-my-stock/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+type corporateActionReq struct {
+	Symbol        string  `json:"symbol" binding:"required"`
+	ExDate        string  `json:"ex_date" binding:"required"` // YYYY-MM-DD
+	CashDividend  float64 `json:"cash_dividend"`
+	BonusRatio    float64 `json:"bonus_ratio"`
+	TransferRatio float64 `json:"transfer_ratio"`
+	RightsRatio   float64 `json:"rights_ratio"`
+	RightsPrice   float64 `json:"rights_price"`
+}
+
+// @Summary 查询除权除息事件和复权因子
+// @Tags 复权
+// @Produce json
+// @Param symbol path string true "股票代码"
+// @Success 200 {object} map[string]interface{}
+// @Router /stock-corporate-actions/{symbol} [get]
+func GetCorporateActions(c *gin.Context) {
+	symbol := c.Param("symbol")
+	var acts []models.StockCorporateAction
+	if err := config.DB.Where("symbol = ?", symbol).Order("ex_date").Find(&acts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	var factors []models.StockAdjFactor
+	if err := config.DB.Where("symbol = ?", symbol).Order("ex_date").Find(&factors).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"symbol": symbol, "actions": acts, "factors": factors})
+}
+
+// @Summary 新增/修正除权除息事件（同一除权日覆盖），并重算复权因子和指标
+// @Tags 复权
+// @Accept json
+// @Produce json
+// @Param data body corporateActionReq true "每股口径，例如 10 派 3 送 2 转 3 填 0.3 / 0.2 / 0.3"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {string} string "Bad Request"
+// @Router /admin/corporate-actions [post]
+func UpsertCorporateAction(c *gin.Context) {
+	var req corporateActionReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	exDate, err := time.Parse("2006-01-02", req.ExDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ex_date"})
+		return
+	}
+	if req.CashDividend < 0 || req.BonusRatio < 0 || req.TransferRatio < 0 || req.RightsRatio < 0 || req.RightsPrice < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "数值不能为负"})
+		return
+	}
+	act := models.StockCorporateAction{
+		Symbol:        req.Symbol,
+		ExDate:        exDate,
+		CashDividend:  req.CashDividend,
+		BonusRatio:    req.BonusRatio,
+		TransferRatio: req.TransferRatio,
+		RightsRatio:   req.RightsRatio,
+		RightsPrice:   req.RightsPrice,
+		Source:        "manual",
+	}
+	if _, err := fetcher.UpsertCorporateActions([]models.StockCorporateAction{act}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	// 因子变了会清掉续算状态，这里后台全量重算，不必等下一轮抓取
+	go func(symbol string) {
+		if _, err := fetcher.RefreshIndicators(symbol); err != nil {
+			log.Printf("⚠️ %s 复权后重算指标失败: %v", symbol, err)
+		}
+		if set, err := fetcher.LoadFormulaSet(); err != nil {
+			log.Printf("⚠️ %s 复权后重算公式失败: %v", symbol, err)
+		} else if _, err := fetcher.RefreshFormulaValues(set, symbol); err != nil {
+			log.Printf("⚠️ %s 复权后重算公式失败: %v", symbol, err)
+		}
+	}(act.Symbol)
+	c.JSON(http.StatusOK, gin.H{"message": "已保存", "action": act})
+}
@@ -0,0 +1,237 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"oh-my-stock/alerts"
+	"oh-my-stock/config"
+	"oh-my-stock/middleware"
+	"oh-my-stock/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ============================================================
+// 单只股票的价格 / 指标提醒（见 alerts 包，新 K 线入库后评估）
+//
+//   GET    /user/alerts       提醒列表（?symbol=&active=true|false），附带支持的类型和方向
+//   POST   /user/alerts       新建提醒
+//   PUT    /user/alerts/:id   修改条件 / 渠道 / 重复与冷却；active=true 重新启用触发过的一次性提醒
+//   DELETE /user/alerts/:id   删除（已写入的通知保留）
+//
+// 触发后写站内通知（notifications.alert_id）并推实时事件 alert；设了 channel_id 的再推到该外发渠道。
+// ============================================================
+
+// MaxAlertsPerUser 每个用户最多的提醒数。
+const MaxAlertsPerUser = 200
+
+// alertRequest 新建 / 修改提醒的请求体，修改时不传的字段保持原值。
+type alertRequest struct {
+	Symbol          string   `json:"symbol"`
+	Kind            string   `json:"kind"`
+	Direction       string   `json:"direction"`
+	Threshold       *float64 `json:"threshold"`
+	Period          *int     `json:"period"`
+	RefClose        *float64 `json:"ref_close"`  // 修改时传 0 清空，改回按前一交易日收盘
+	ChannelID       *uint    `json:"channel_id"` // 修改时传 0 解绑
+	Note            *string  `json:"note"`
+	Repeat          *bool    `json:"repeat"`
+	CooldownMinutes *int     `json:"cooldown_minutes"`
+	Active          *bool    `json:"active"`
+}
+
+// apply 把请求里传了的字段写到 a 上。
+func (r alertRequest) apply(a *models.StockAlert) {
+	if r.Kind != "" && r.Kind != a.Kind {
+		a.Kind, a.Direction, a.Period = r.Kind, "", 0
+	}
+	if r.Direction != "" {
+		a.Direction = r.Direction
+	}
+	if r.Threshold != nil {
+		a.Threshold = *r.Threshold
+	}
+	if r.Period != nil {
+		a.Period = *r.Period
+	}
+	if r.RefClose != nil {
+		if *r.RefClose == 0 {
+			a.RefClose = nil
+		} else {
+			v := *r.RefClose
+			a.RefClose = &v
+		}
+	}
+	if r.ChannelID != nil {
+		if *r.ChannelID == 0 {
+			a.ChannelID = nil
+		} else {
+			v := *r.ChannelID
+			a.ChannelID = &v
+		}
+	}
+	if r.Note != nil {
+		a.Note = *r.Note
+	}
+	if r.Repeat != nil {
+		a.Repeat = *r.Repeat
+	}
+	if r.CooldownMinutes != nil {
+		a.CooldownMinutes = *r.CooldownMinutes
+	}
+	if r.Active != nil {
+		a.Active = *r.Active
+	}
+}
+
+// checkAlert 校验提醒参数和渠道归属，返回给前端的错误信息。
+func checkAlert(uid string, a *models.StockAlert) string {
+	if err := alerts.Validate(a); err != nil {
+		return err.Error()
+	}
+	if len([]rune(a.Note)) > 200 {
+		return "备注不能超过 200 字"
+	}
+	if a.ChannelID != nil {
+		var n int64
+		config.DB.Model(&models.NotificationChannel{}).Where("id = ? AND user_id = ?", *a.ChannelID, uid).Count(&n)
+		if n == 0 {
+			return "渠道不存在"
+		}
+	}
+	return ""
+}
+
+// alertColumns 新建 / 修改时显式写入的列（Repeat=false、Active=false 等零值不能被 gorm 省略）。
+var alertColumns = []string{"Kind", "Direction", "Threshold", "Period", "RefClose", "ChannelID", "Note",
+	"Repeat", "CooldownMinutes", "Active"}
+
+// ListAlerts 当前用户的提醒
+func ListAlerts(c *gin.Context) {
+	uid := middleware.GetUserID(c)
+	if uid == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未登录"})
+		return
+	}
+	q := config.DB.Where("user_id = ?", uid)
+	if s := c.Query("symbol"); s != "" {
+		q = q.Where("symbol = ?", s)
+	}
+	switch c.Query("active") {
+	case "true", "1":
+		q = q.Where("active")
+	case "false", "0":
+		q = q.Where("NOT active")
+	}
+	var rows []models.StockAlert
+	if err := q.Order("id DESC").Find(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"total": len(rows), "data": rows, "kinds": alerts.Kinds, "rsi_periods": alerts.RSIPeriods})
+}
+
+// AddAlert 新建提醒
+func AddAlert(c *gin.Context) {
+	uid := middleware.GetUserID(c)
+	if uid == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未登录"})
+		return
+	}
+	var req alertRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Symbol == "" || req.Kind == "" || req.Threshold == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "symbol、kind、threshold 必填"})
+		return
+	}
+	var basic models.StockBasicInfo
+	if err := config.DB.Select("symbol, name").Where("symbol = ?", req.Symbol).First(&basic).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "symbol 不存在或未入库"})
+		return
+	}
+	var cnt int64
+	config.DB.Model(&models.StockAlert{}).Where("user_id = ?", uid).Count(&cnt)
+	if cnt >= MaxAlertsPerUser {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "提醒数量已达上限 " + strconv.Itoa(MaxAlertsPerUser)})
+		return
+	}
+
+	a := models.StockAlert{UserID: uid, Symbol: basic.Symbol, Active: true}
+	req.apply(&a)
+	if msg := checkAlert(uid, &a); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	if err := config.DB.Select(append([]string{"UserID", "Symbol"}, alertColumns...)).Create(&a).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "提醒创建成功", "alert": a, "name": basic.Name})
+}
+
+// UpdateAlert 修改提醒
+func UpdateAlert(c *gin.Context) {
+	uid := middleware.GetUserID(c)
+	if uid == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未登录"})
+		return
+	}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID 无效"})
+		return
+	}
+	var req alertRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var a models.StockAlert
+	if err := config.DB.Where("id = ? AND user_id = ?", id, uid).First(&a).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "提醒不存在"})
+		return
+	}
+	if req.Symbol != "" && req.Symbol != a.Symbol {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不能修改股票，请新建提醒"})
+		return
+	}
+	req.apply(&a)
+	if msg := checkAlert(uid, &a); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	if err := config.DB.Model(&a).Select(alertColumns).Updates(&a).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新失败"})
+		return
+	}
+	config.DB.First(&a, a.ID)
+	c.JSON(http.StatusOK, gin.H{"message": "更新成功", "alert": a})
+}
+
+// DeleteAlert 删除提醒
+func DeleteAlert(c *gin.Context) {
+	uid := middleware.GetUserID(c)
+	if uid == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未登录"})
+		return
+	}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID 无效"})
+		return
+	}
+	res := config.DB.Where("id = ? AND user_id = ?", id, uid).Delete(&models.StockAlert{})
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": res.Error.Error()})
+		return
+	}
+	if res.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "提醒不存在"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "提醒删除成功"})
+}
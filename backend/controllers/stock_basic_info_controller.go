@@ -3,8 +3,12 @@ package controllers
 import (
 	"net/http"
 	"strconv"
+	"strings"
 
+	"oh-my-stock/adjust"
 	"oh-my-stock/config"
+	"oh-my-stock/fetcher"
+	"oh-my-stock/middleware"
 	"oh-my-stock/models"
 
 	"github.com/gin-gonic/gin"
@@ -153,6 +157,8 @@ func DeleteStockBySymbol(c *gin.Context) {
 // @Produce json
 // @Param symbol query string true "股票代码或股票名称"
 // @Param days query int false "最近几天，默认7天"
+// @Param formula_id query string false "叠加自定义公式输出（逗号分隔的公式 ID，需登录）"
+// @Param adjust query string false "复权方式 none|qfq|hfq，默认 none（原始价）"
 // @Success 200 {object} map[string]interface{}
 // @Failure 400 {string} string "Bad Request"
 // @Failure 404 {string} string "Not Found"
@@ -169,6 +175,11 @@ func GetStockHistory(c *gin.Context) {
 	if days <= 0 {
 		days = 7
 	}
+	mode, err := adjust.ParseMode(c.Query("adjust"), adjust.None)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	// 基本信息（支持代码或名称查询）
 	var basic models.StockBasicInfo
@@ -183,18 +194,35 @@ func GetStockHistory(c *gin.Context) {
 		Order("trade_date DESC").
 		Limit(days).Find(&dailyData)
 
-	// 最近 N 天技术指标
+	// 最近 N 天技术指标（入库的是前复权口径，按 adjust 换算）
 	var indicators []models.StockIndicator
 	config.DB.Where("symbol = ?", basic.Symbol).
 		Order("calc_date DESC").
 		Limit(days).Find(&indicators)
 
+	adj, err := fetcher.LoadAdjuster(basic.Symbol)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	dailyData = adj.Apply(dailyData, mode)
+	for i := range indicators {
+		indicators[i] = adj.Rebase(indicators[i], mode)
+	}
+
 	// 最近 N 天资金流
 	var moneyFlows []models.StockMoneyFlowAll
 	config.DB.Where("symbol = ?", basic.Symbol).
 		Order("trade_date DESC").
 		Limit(days).Find(&moneyFlows)
 
+	// 自定义公式输出（仅登录用户自己的公式）
+	var formulaIDs []string
+	if raw := c.Query("formula_id"); raw != "" {
+		formulaIDs = strings.Split(raw, ",")
+	}
+	formulaVals := formulaSeries(middleware.GetUserID(c), basic.Symbol, formulaIDs, days, mode)
+
 	// 整合每日数据（按日期升序返回）
 	history := make([]map[string]interface{}, 0, len(dailyData))
 	for i := len(dailyData) - 1; i >= 0; i-- {
@@ -242,11 +270,26 @@ func GetStockHistory(c *gin.Context) {
 			"boll_upper":     ind.BollUpper,
 			"boll_mid":       ind.BollMid,
 			"boll_lower":     ind.BollLower,
+			"ma120":          ind.MA120,
+			"ma250":          ind.MA250,
+			"atr14":          ind.ATR14,
+			"obv":            ind.OBV,
+			"cci14":          ind.CCI14,
+			"wr6":            ind.WR6,
+			"wr10":           ind.WR10,
+			"pdi":            ind.PDI,
+			"mdi":            ind.MDI,
+			"adx":            ind.ADX,
+			"adxr":           ind.ADXR,
+			"vwap":           ind.VWAP,
 			"in_amount":      mf.InflowAmount,  // 转为万
 			"out_amount":     mf.OutflowAmount, // 转为万
 			"net_amount":     mf.NetAmount,     // 转为万
 			"turnover":       mf.Turnover,      // 转为万
 		}
+		if len(formulaIDs) > 0 {
+			record["formulas"] = formulaVals[d.TradeDate.Format("2006-01-02")]
+		}
 		history = append(history, record)
 	}
 
@@ -256,6 +299,7 @@ func GetStockHistory(c *gin.Context) {
 		"industry":     basic.Industry,
 		"market":       basic.Market,
 		"listing_date": basic.ListingDate,
+		"adjust":       mode,
 		"daily_data":   history,
 	})
 }
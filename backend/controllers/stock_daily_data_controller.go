@@ -7,6 +7,8 @@ import (
 	"net/http"
 	"time"
 
+	"oh-my-stock/adjust"
+	"oh-my-stock/calendar"
 	"oh-my-stock/config"
 	"oh-my-stock/fetcher"
 	"oh-my-stock/models"
@@ -30,12 +32,18 @@ func GetAllStockDailyData(c *gin.Context) {
 // @Produce json
 // @Param symbol path string true "股票代码"
 // @Param trade_date query string false "交易日期(YYYY-MM-DD)"
+// @Param adjust query string false "复权方式 none|qfq|hfq，默认 none（库内原始价）"
 // @Success 200 {array} models.StockDailyData
 // @Failure 404 {string} string "Not Found"
 // @Router /stock-daily-data/{symbol} [get]
 func GetStockDailyData(c *gin.Context) {
 	symbol := c.Param("symbol")
 	tradeDateStr := c.Query("trade_date")
+	mode, err := adjust.ParseMode(c.Query("adjust"), adjust.None)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	var records []models.StockDailyData
 	query := config.DB.Where("symbol = ?", symbol)
@@ -53,6 +61,11 @@ func GetStockDailyData(c *gin.Context) {
 		c.JSON(http.StatusNotFound, "Not Found")
 		return
 	}
+	records, err = fetcher.AdjustDaily(symbol, records, mode)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
 	c.JSON(http.StatusOK, records)
 }
@@ -114,7 +127,7 @@ func GetRecentStockDaily(c *gin.Context) {
 		return
 	}
 
-	// 2) 缓存判断：是否覆盖最近 7 个自然日（按 trade_date）
+	// 2) 缓存判断：是否覆盖最近 7 个交易日（按 trade_date）
 	if rowsCoverLastDays(rows, 7) {
 		c.JSON(http.StatusOK, gin.H{"source": "db", "data": rows})
 		return
@@ -205,52 +218,45 @@ func refreshOneSymbol(ctx context.Context, symbol string, days int) error {
 		log.Printf("✅ %s 写入资金流 %d 行", symbol, n)
 	}
 
-	if n, err := fetcher.UpsertHistoryMV(prepared); err != nil {
-		log.Printf("⚠️ %s 同步 mv: %v", symbol, err)
-	} else {
-		log.Printf("✅ %s 写入 mv %d 行", symbol, n)
+	// 除权除息事件 → 复权因子（best-effort；新除权日生效时下面的指标会全量重算）
+	if err := fetcher.SyncCorporateActions(ctx, symbol); err != nil {
+		log.Printf("⚠️ %s 同步除权除息失败: %v", symbol, err)
 	}
 
-	// 顺手裁剪
-	if n, perr := fetcher.PurgeOldDaily(); perr == nil && n > 0 {
-		log.Printf("✅ %s 触发后裁剪 stock_daily_data %d 行", symbol, n)
+	// 技术指标（按持久化状态增量续算，见 fetcher.RefreshIndicators）
+	if n, err := fetcher.RefreshIndicators(symbol); err != nil {
+		log.Printf("⚠️ %s 写技术指标失败: %v", symbol, err)
+	} else if n > 0 {
+		log.Printf("✅ %s 写入指标 %d 行", symbol, n)
 	}
 
-	// 技术指标
-	recent, err := fetcher.LoadRecentDaily(symbol, 90)
-	if err == nil && len(recent) >= 5 {
-		inds := fetcher.ComputeIndicators(symbol, recent)
-		if n, err := fetcher.UpsertIndicators(inds); err != nil {
-			log.Printf("⚠️ %s 写技术指标失败: %v", symbol, err)
-		} else {
-			log.Printf("✅ %s 写入指标 %d 行", symbol, n)
-		}
+	// 用户自定义公式在最新交易日的取值（规则条件 formula:NAME 引用）
+	if set, err := fetcher.LoadFormulaSet(); err != nil {
+		log.Printf("⚠️ %s 计算自定义公式失败: %v", symbol, err)
+	} else if _, err := fetcher.RefreshFormulaValues(set, symbol); err != nil {
+		log.Printf("⚠️ %s 计算自定义公式失败: %v", symbol, err)
 	}
+
+	// 选股/排行读的 stock_history_mv 在后台刷新
+	fetcher.RequestHistoryMVRefresh()
 	return nil
 }
 
-// rowsCoverLastDays DB 行是否覆盖最近 n 天（按 trade_date 自然日）
+// rowsCoverLastDays DB 行是否覆盖最近 n 个已收盘交易日（盘中当天尚未收盘，不要求有当天）
 func rowsCoverLastDays(rows []models.StockDailyData, n int) bool {
 	if len(rows) == 0 {
 		return false
 	}
-	now := time.Now()
-	cutoff := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).
-		AddDate(0, 0, -n+1)
 	have := map[string]bool{}
 	for _, r := range rows {
 		have[r.TradeDate.Format("2006-01-02")] = true
 	}
-	// 至少覆盖 recent n 个日历日中已存在交易
-	for d := time.Now(); !d.Before(cutoff); d = d.AddDate(0, 0, -1) {
-		// 工作日跳过周末非交易日：实际不严格，遇周末可能不覆盖；放宽到 70% 即可
-		weekday := d.Weekday()
-		if weekday == time.Saturday || weekday == time.Sunday {
-			continue
-		}
+	d := calendar.LatestSettled(time.Now())
+	for i := 0; i < n; i++ {
 		if !have[d.Format("2006-01-02")] {
 			return false
 		}
+		d = calendar.PrevTradingDay(d, 1)
 	}
 	return true
 }
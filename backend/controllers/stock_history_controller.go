@@ -5,6 +5,7 @@ import (
 	"strconv"
 
 	"oh-my-stock/config"
+	"oh-my-stock/fetcher"
 	"oh-my-stock/models"
 
 	"github.com/gin-gonic/gin"
@@ -32,6 +33,7 @@ func GetStockHistoryInfo(c *gin.Context) {
 		return
 	}
 
+	historyFreshness(c)
 	c.JSON(http.StatusOK, stock)
 }
 
@@ -71,6 +73,7 @@ func GetStockList(c *gin.Context) {
 		"page_size": pageSize,
 		"total":     total,
 		"data":      stocks,
+		"freshness": historyFreshness(c),
 	})
 }
 
@@ -120,5 +123,19 @@ func GetHotStocks(c *gin.Context) {
 		"threshold": threshold,
 		"total":     total,
 		"data":      stocks,
+		"freshness": historyFreshness(c),
 	})
 }
+
+// historyFreshness 读 stock_history_mv 的接口统一带上数据新鲜度：响应头 X-Data-As-Of（视图最新交易日）、
+// X-Data-Stale（true/false），返回值放进响应体的 freshness 字段。状态读不到时返回 nil，不影响查询本身。
+func historyFreshness(c *gin.Context) *fetcher.Freshness {
+	s, err := fetcher.HistoryMVStatus()
+	if err != nil {
+		return nil
+	}
+	f := s.Freshness()
+	c.Header("X-Data-As-Of", f.AsOf)
+	c.Header("X-Data-Stale", strconv.FormatBool(f.Stale))
+	return &f
+}
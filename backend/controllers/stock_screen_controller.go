@@ -193,7 +193,7 @@ func ScreenStocks(c *gin.Context) {
 	sortOrder := "DESC"
 	if strings.ToLower(req.SortOrder) == "asc" { sortOrder = "ASC" }
 
-	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM ("+baseQuery+" "+whereClause+") sub")
+	countQuery := "SELECT COUNT(*) FROM (" + baseQuery + " " + whereClause + ") sub"
 	var total int64
 	config.DB.Raw(countQuery, args...).Scan(&total)
 
@@ -213,6 +213,7 @@ func ScreenStocks(c *gin.Context) {
 		"page_size": req.PageSize,
 		"total": total,
 		"data": results,
+		"freshness": historyFreshness(c),
 	})
 }
 // GetIndustryList returns all distinct industries
@@ -256,5 +257,5 @@ func GetStockRanking(c *gin.Context) {
 	query := fmt.Sprintf(`SELECT h.symbol, h.name, COALESCE(b.industry, '') AS industry, COALESCE(b.market, '') AS market, COALESCE(h.close,0) AS close, COALESCE(h.change_percent,0) AS change_percent, COALESCE(h.volume,0) AS volume, COALESCE(h.turnover_rate,0) AS turnover_rate, COALESCE(h.net_amount,0) AS net_amount, TO_CHAR(h.trade_date,'YYYY-MM-DD') AS trade_date FROM stock_history_mv h LEFT JOIN stock_basic_info b ON h.symbol=b.symbol ORDER BY h.%s %s LIMIT %d`, orderField, sortOrder, limit)
 	config.DB.Raw(query).Scan(&results)
 	if results == nil { results = []ScreenResult{} }
-	c.JSON(http.StatusOK, gin.H{"rank_by": rankBy, "order": strings.ToLower(order), "data": results})
+	c.JSON(http.StatusOK, gin.H{"rank_by": rankBy, "order": strings.ToLower(order), "data": results, "freshness": historyFreshness(c)})
 }
\ No newline at end of file
@@ -0,0 +1,247 @@
+package controllers
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"oh-my-stock/adjust"
+	"oh-my-stock/config"
+	"oh-my-stock/fetcher"
+	"oh-my-stock/formula"
+	"oh-my-stock/middleware"
+	"oh-my-stock/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ============================================================
+// 用户自定义指标公式（通达信风格）
+//
+//   POST   /user/formulas          新建
+//   GET    /user/formulas          列表（含输出线名）
+//   PUT    /user/formulas/:id      修改
+//   DELETE /user/formulas/:id      删除
+//   POST   /user/formulas/check    只做语法校验，供编辑器实时提示
+//
+// 使用：
+//   - 画图：GET /stocks/history?symbol=600000&formula_id=1,2（带 token）
+//   - 规则：rule_expression 里写 "formula:NAME" 或 "formula:NAME.OUTPUT"，
+//     例如 {"formula:MYMACD.SIG": {"eq": 1}}
+// ============================================================
+
+// FormulaData 返回给前端的公式。
+type FormulaData struct {
+	models.UserFormula
+	Outputs []string `json:"outputs"`
+}
+
+var formulaNameRe = regexp.MustCompile(`^[\p{L}_][\p{L}\p{N}_]{0,49}$`)
+
+type formulaReq struct {
+	Name        string `json:"name"`
+	Source      string `json:"source"`
+	Description string `json:"description"`
+}
+
+// CheckFormula 语法校验
+func CheckFormula(c *gin.Context) {
+	var req formulaReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	p, err := formula.Compile(req.Source)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "outputs": p.Outputs()})
+}
+
+// AddFormula 新建公式
+func AddFormula(c *gin.Context) {
+	uid := middleware.GetUserID(c)
+	if uid == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未登录"})
+		return
+	}
+	var req formulaReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	name := strings.ToUpper(strings.TrimSpace(req.Name))
+	if !formulaNameRe.MatchString(name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "公式名只能包含字母、数字、下划线，且不能以数字开头"})
+		return
+	}
+	p, err := formula.Compile(req.Source)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "公式有误: " + err.Error()})
+		return
+	}
+	f := models.UserFormula{
+		UserID:      uid,
+		Name:        name,
+		Source:      req.Source,
+		Description: req.Description,
+	}
+	if err := config.DB.Create(&f).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "创建公式失败，可能是同名公式已存在"})
+		return
+	}
+	go materializeFormula(f)
+	c.JSON(http.StatusOK, gin.H{"message": "公式创建成功", "formula": FormulaData{f, p.Outputs()}})
+}
+
+// GetFormulas 当前用户的全部公式
+func GetFormulas(c *gin.Context) {
+	uid := middleware.GetUserID(c)
+	if uid == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未登录"})
+		return
+	}
+	var fs []models.UserFormula
+	config.DB.Where("user_id = ?", uid).Order("name").Find(&fs)
+	resp := make([]FormulaData, 0, len(fs))
+	for _, f := range fs {
+		d := FormulaData{UserFormula: f, Outputs: []string{}}
+		if p, err := formula.Compile(f.Source); err == nil {
+			d.Outputs = p.Outputs()
+		}
+		resp = append(resp, d)
+	}
+	c.JSON(http.StatusOK, gin.H{"total": len(resp), "data": resp})
+}
+
+// UpdateFormula 修改公式（name/source/description 均可选）
+func UpdateFormula(c *gin.Context) {
+	uid := middleware.GetUserID(c)
+	if uid == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未登录"})
+		return
+	}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID 无效"})
+		return
+	}
+	var req formulaReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var f models.UserFormula
+	if err := config.DB.Where("id = ? AND user_id = ?", id, uid).First(&f).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "公式不存在"})
+		return
+	}
+	if req.Name != "" {
+		name := strings.ToUpper(strings.TrimSpace(req.Name))
+		if !formulaNameRe.MatchString(name) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "公式名只能包含字母、数字、下划线，且不能以数字开头"})
+			return
+		}
+		f.Name = name
+	}
+	if req.Source != "" {
+		f.Source = req.Source
+	}
+	if req.Description != "" {
+		f.Description = req.Description
+	}
+	p, err := formula.Compile(f.Source)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "公式有误: " + err.Error()})
+		return
+	}
+	f.UpdatedAt = time.Now()
+	if err := config.DB.Save(&f).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "更新失败，可能是同名公式已存在"})
+		return
+	}
+	go materializeFormula(f)
+	c.JSON(http.StatusOK, gin.H{"message": "更新成功", "formula": FormulaData{f, p.Outputs()}})
+}
+
+// DeleteFormula 删除公式（最新取值随外键级联删除）
+func DeleteFormula(c *gin.Context) {
+	uid := middleware.GetUserID(c)
+	if uid == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未登录"})
+		return
+	}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID 无效"})
+		return
+	}
+	res := config.DB.Where("id = ? AND user_id = ?", id, uid).Delete(&models.UserFormula{})
+	if res.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "公式不存在"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "公式删除成功"})
+}
+
+// materializeFormula 后台对全部股票计算公式最新值，供规则引用。
+func materializeFormula(f models.UserFormula) {
+	start := time.Now()
+	n, err := fetcher.MaterializeFormula(f)
+	if err != nil {
+		log.Printf("⚠️ 公式 %d(%s) 物化失败: %v", f.ID, f.Name, err)
+		return
+	}
+	log.Printf("✅ 公式 %d(%s) 物化 %d 行，用时 %s", f.ID, f.Name, n, time.Since(start).Round(time.Millisecond))
+}
+
+// formulaSeries 给 GetStockHistory 最近 days 根 K 线叠加用户公式输出（按 m 复权价求值）：
+// 返回 date → {"NAME.OUTPUT": value}。只处理属于 uid 的公式，无效值为 nil。
+func formulaSeries(uid, symbol string, ids []string, days int, m adjust.Mode) map[string]gin.H {
+	out := map[string]gin.H{}
+	if uid == "" || len(ids) == 0 {
+		return out
+	}
+	var fs []models.UserFormula
+	config.DB.Where("user_id = ? AND id IN ?", uid, ids).Find(&fs)
+	if len(fs) == 0 {
+		return out
+	}
+	// 和规则取值用同一个窗口（最近 FormulaBars 根）求值，最新一天的值与规则里引用的一致；
+	// 只有展示区间本身更长时才往前多取
+	rows, err := fetcher.LoadDailyAsc(symbol, max(days, fetcher.FormulaBars), m)
+	if err != nil {
+		return out
+	}
+	shown := max(len(rows)-days, 0)
+	for _, f := range fs {
+		p, err := formula.Compile(f.Source)
+		if err != nil {
+			continue
+		}
+		for _, l := range fetcher.EvalFormula(p, rows) {
+			for i := shown; i < len(rows); i++ {
+				r := rows[i]
+				key := r.TradeDate.Format("2006-01-02")
+				if out[key] == nil {
+					out[key] = gin.H{}
+				}
+				out[key][f.Name+"."+l.Name] = finiteOrNil(l.Values[i])
+			}
+		}
+	}
+	return out
+}
+
+func finiteOrNil(v float64) *float64 {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return nil
+	}
+	v = math.Round(v*10000) / 10000
+	return &v
+}
@@ -17,6 +17,7 @@ type RuleData struct {
 	UserID         string                 `json:"user_id"`
 	RuleName       string                 `json:"rule_name"`
 	RuleExpression map[string]interface{} `json:"rule_expression"`
+	NotifyOnMatch  bool                   `json:"notify_on_match"`
 	CreatedAt      time.Time              `json:"created_at"`
 	UpdatedAt      time.Time              `json:"updated_at"`
 }
@@ -38,6 +39,7 @@ func AddRule(c *gin.Context) {
 	var req struct {
 		RuleName       string                 `json:"rule_name" binding:"required"`
 		RuleExpression map[string]interface{} `json:"rule_expression" binding:"required"`
+		NotifyOnMatch  *bool                  `json:"notify_on_match"` // 不传时默认打开
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -48,8 +50,10 @@ func AddRule(c *gin.Context) {
 		UserID:         uid,
 		RuleName:       req.RuleName,
 		RuleExpression: exprJSON,
+		NotifyOnMatch:  req.NotifyOnMatch == nil || *req.NotifyOnMatch,
 	}
-	if err := config.DB.Create(&rule).Error; err != nil {
+	// NotifyOnMatch 带 default:true，false 是零值会被 Create 省略，显式列出
+	if err := config.DB.Select("UserID", "RuleName", "RuleExpression", "NotifyOnMatch").Create(&rule).Error; err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "创建规则失败，可能是同名规则已存在"})
 		return
 	}
@@ -86,6 +90,7 @@ func GetRules(c *gin.Context) {
 			UserID:         r.UserID,
 			RuleName:       r.RuleName,
 			RuleExpression: expr,
+			NotifyOnMatch:  r.NotifyOnMatch,
 			CreatedAt:      r.CreatedAt,
 			UpdatedAt:      r.UpdatedAt,
 		})
@@ -110,6 +115,7 @@ func UpdateRule(c *gin.Context) {
 	var req struct {
 		RuleName       string                 `json:"rule_name"`
 		RuleExpression map[string]interface{} `json:"rule_expression"`
+		NotifyOnMatch  *bool                  `json:"notify_on_match"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -127,6 +133,9 @@ func UpdateRule(c *gin.Context) {
 		b, _ := json.Marshal(req.RuleExpression)
 		rule.RuleExpression = b
 	}
+	if req.NotifyOnMatch != nil {
+		rule.NotifyOnMatch = *req.NotifyOnMatch
+	}
 	rule.UpdatedAt = time.Now()
 	if err := config.DB.Save(&rule).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新失败"})
@@ -136,7 +145,7 @@ func UpdateRule(c *gin.Context) {
 	_ = json.Unmarshal(rule.RuleExpression, &expr)
 	c.JSON(http.StatusOK, gin.H{"message": "更新成功", "rule": RuleData{
 		ID: rule.ID, UserID: rule.UserID, RuleName: rule.RuleName,
-		RuleExpression: expr, CreatedAt: rule.CreatedAt, UpdatedAt: rule.UpdatedAt,
+		RuleExpression: expr, NotifyOnMatch: rule.NotifyOnMatch, CreatedAt: rule.CreatedAt, UpdatedAt: rule.UpdatedAt,
 	}})
 }
 
@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"net/http"
+	"oh-my-stock/auth"
 	"oh-my-stock/config"
 	"oh-my-stock/models"
 
@@ -39,7 +40,7 @@ func Register(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "注册成功", "user_id": user.ID})
 }
 
-// Login 用户登录 - 返回 HMAC token
+// Login 用户登录 - 建会话，返回访问 token + refresh token（见 auth 包）
 func Login(c *gin.Context) {
 	var req struct {
 		Username string `json:"username" binding:"required"`
@@ -59,14 +60,18 @@ func Login(c *gin.Context) {
 		return
 	}
 	uid := user.ID.String()
-	token, err := config.IssueToken(uid)
+	tokens, err := auth.Login(config.DB, uid, clientOf(c))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "token 签发失败"})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{
-		"message": "登录成功",
-		"user_id": uid,
-		"token":   token,
+		"message":            "登录成功",
+		"user_id":            uid,
+		"token":              tokens.AccessToken,
+		"expires_in":         tokens.ExpiresIn,
+		"refresh_token":      tokens.RefreshToken,
+		"refresh_expires_in": tokens.RefreshExpiresIn,
+		"session_id":         tokens.SessionID,
 	})
 }
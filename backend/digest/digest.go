@@ -0,0 +1,217 @@
+package digest
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"oh-my-stock/models"
+	"oh-my-stock/notify"
+	"oh-my-stock/quality"
+)
+
+// ============================================================
+// 收盘日报：每个交易日收盘后给每个用户生成一份，内容包括
+//   - 市场概况：涨跌家数、涨停跌停、涨跌幅中位数（所有用户共用，见 Market）
+//   - 规则命中：每条规则当天命中的股票，分「新进」（前一交易日没命中）和「持续」，以及退出的只数
+//   - 自选股：按涨跌幅排序，当天没有行情的（停牌等）单列
+//   - 价格提醒：当天触发的提醒（notifications.alert_id）
+// 规则命中和站内通知同一口径：只判断快照上的数值条件（见 notify.MatchStock），但不受每条规则 50 只的上限限制。
+// 结构化内容存 daily_digests.summary，同时渲染成 Markdown 和 HTML（见 render.go）。
+// ============================================================
+
+// listLimit 每条规则的新进 / 持续各最多列出多少只（按涨跌幅从高到低），其余只计数。
+const listLimit = 20
+
+// Stock 日报里的一只股票。
+type Stock struct {
+	Symbol        string  `json:"symbol"`
+	Name          string  `json:"name"`
+	Close         float64 `json:"close"`
+	ChangePercent float64 `json:"change_percent"`
+}
+
+// Breadth 市场宽度。
+type Breadth struct {
+	Total        int     `json:"total"`
+	Up           int     `json:"up"`
+	Down         int     `json:"down"`
+	Flat         int     `json:"flat"`
+	LimitUp      int     `json:"limit_up"`
+	LimitDown    int     `json:"limit_down"`
+	Up5          int     `json:"up5"`   // 涨超 5%
+	Down5        int     `json:"down5"` // 跌超 5%
+	MedianChange float64 `json:"median_change"`
+}
+
+// RuleSection 一条规则当天的命中情况。
+type RuleSection struct {
+	RuleID          uint    `json:"rule_id"`
+	RuleName        string  `json:"rule_name"`
+	Unsupported     bool    `json:"unsupported,omitempty"` // 有快照判断不了的条件，日报不统计（口径同通知）
+	NewCount        int     `json:"new_count"`
+	ContinuingCount int     `json:"continuing_count"`
+	ExitedCount     int     `json:"exited_count"` // 前一交易日命中、今天不再命中
+	New             []Stock `json:"new"`
+	Continuing      []Stock `json:"continuing"`
+}
+
+// AlertItem 当天触发的一条价格提醒。
+type AlertItem struct {
+	AlertID   uint      `json:"alert_id"`
+	Symbol    string    `json:"symbol"`
+	StockName string    `json:"stock_name"`
+	Title     string    `json:"title"`
+	Message   string    `json:"message"`
+	At        time.Time `json:"at"`
+}
+
+// Digest 一个用户一个交易日的日报。
+type Digest struct {
+	TradeDate    string        `json:"trade_date"`
+	PrevDate     string        `json:"prev_date,omitempty"`
+	Breadth      Breadth       `json:"breadth"`
+	Rules        []RuleSection `json:"rules"`
+	Watchlist    []Stock       `json:"watchlist"`
+	WatchMissing []string      `json:"watch_missing,omitempty"` // 当天没有行情的自选股
+	Alerts       []AlertItem   `json:"alerts"`
+	GeneratedAt  time.Time     `json:"generated_at"`
+}
+
+// Title 日报标题（邮件主题、列表展示）。
+func (d Digest) Title() string {
+	return "oh-my-stock 收盘日报 " + d.TradeDate
+}
+
+// Empty 没有任何和用户相关的内容（没有规则、自选股、提醒）。
+func (d Digest) Empty() bool {
+	return len(d.Rules) == 0 && len(d.Watchlist) == 0 && len(d.WatchMissing) == 0 && len(d.Alerts) == 0
+}
+
+// Market 一个交易日所有用户共用的数据：当天和前一交易日的快照、市场宽度。
+type Market struct {
+	Day     time.Time
+	PrevDay time.Time // 零值表示没有前一交易日的数据，所有命中都算新进
+	Today   []notify.Snapshot
+	Prev    []notify.Snapshot
+	Breadth Breadth
+
+	bySymbol map[string]notify.Snapshot
+}
+
+// NewMarket 由两天的快照组装 Market。
+func NewMarket(day, prevDay time.Time, today, prev []notify.Snapshot) *Market {
+	m := &Market{Day: day, PrevDay: prevDay, Today: today, Prev: prev, Breadth: ComputeBreadth(today),
+		bySymbol: make(map[string]notify.Snapshot, len(today))}
+	for _, s := range today {
+		m.bySymbol[s.Symbol] = s
+	}
+	return m
+}
+
+// ComputeBreadth 按快照统计市场宽度。涨跌停幅度和数据质量校验一致（quality.LimitPct），
+// 按幅度的 99% 判断（价格按分取整，10% 的涨停常见 9.9x%）。
+func ComputeBreadth(snaps []notify.Snapshot) Breadth {
+	b := Breadth{Total: len(snaps)}
+	if len(snaps) == 0 {
+		return b
+	}
+	changes := make([]float64, 0, len(snaps))
+	for _, s := range snaps {
+		c := s.ChangePercent
+		changes = append(changes, c)
+		switch {
+		case c > 0:
+			b.Up++
+		case c < 0:
+			b.Down++
+		default:
+			b.Flat++
+		}
+		if c >= 5 {
+			b.Up5++
+		} else if c <= -5 {
+			b.Down5++
+		}
+		if lim := quality.LimitPct(s.Symbol, s.Name) * 100 * 0.99; c >= lim {
+			b.LimitUp++
+		} else if c <= -lim {
+			b.LimitDown++
+		}
+	}
+	sort.Float64s(changes)
+	n := len(changes)
+	if n%2 == 1 {
+		b.MedianChange = changes[n/2]
+	} else {
+		b.MedianChange = round2((changes[n/2-1] + changes[n/2]) / 2)
+	}
+	return b
+}
+
+// Inputs 一个用户的日报原料。
+type Inputs struct {
+	Rules     []models.UserStockRule
+	Favorites []string
+	Alerts    []models.Notification // 当天触发的价格提醒通知
+}
+
+// Assemble 用共用的 Market 和用户自己的原料拼一份日报。
+func Assemble(m *Market, in Inputs, now time.Time) Digest {
+	d := Digest{TradeDate: m.Day.Format("2006-01-02"), Breadth: m.Breadth, GeneratedAt: now,
+		Rules: []RuleSection{}, Watchlist: []Stock{}, Alerts: []AlertItem{}}
+	if !m.PrevDay.IsZero() {
+		d.PrevDate = m.PrevDay.Format("2006-01-02")
+	}
+
+	for _, r := range in.Rules {
+		sec := RuleSection{RuleID: r.ID, RuleName: r.RuleName, New: []Stock{}, Continuing: []Stock{}}
+		if !notify.Notifiable(r) { // 只能判断一部分条件时按子集算命中会虚高，整条规则不统计
+			sec.Unsupported = true
+			d.Rules = append(d.Rules, sec)
+			continue
+		}
+		rs := []models.UserStockRule{r}
+		before := map[string]bool{}
+		for _, h := range notify.MatchAll(rs, m.Prev) {
+			before[h.Symbol] = true
+		}
+		// 快照按涨跌幅从高到低，命中保持同样顺序
+		for _, h := range notify.MatchAll(rs, m.Today) {
+			s := Stock{Symbol: h.Symbol, Name: h.Name, Close: h.Close, ChangePercent: h.ChangePercent}
+			if before[h.Symbol] {
+				delete(before, h.Symbol)
+				if sec.ContinuingCount++; len(sec.Continuing) < listLimit {
+					sec.Continuing = append(sec.Continuing, s)
+				}
+			} else if sec.NewCount++; len(sec.New) < listLimit {
+				sec.New = append(sec.New, s)
+			}
+		}
+		sec.ExitedCount = len(before)
+		d.Rules = append(d.Rules, sec)
+	}
+
+	for _, sym := range in.Favorites {
+		s, ok := m.bySymbol[sym]
+		if !ok {
+			d.WatchMissing = append(d.WatchMissing, sym)
+			continue
+		}
+		d.Watchlist = append(d.Watchlist, Stock{Symbol: s.Symbol, Name: s.Name, Close: s.Close, ChangePercent: s.ChangePercent})
+	}
+	sort.SliceStable(d.Watchlist, func(i, j int) bool { return d.Watchlist[i].ChangePercent > d.Watchlist[j].ChangePercent })
+
+	for _, n := range in.Alerts {
+		it := AlertItem{Symbol: n.Symbol, StockName: n.StockName, Title: n.Title, Message: n.Message, At: n.CreatedAt}
+		if n.AlertID != nil {
+			it.AlertID = *n.AlertID
+		}
+		d.Alerts = append(d.Alerts, it)
+	}
+	return d
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,141 @@
+package digest
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"oh-my-stock/models"
+	"oh-my-stock/notify"
+)
+
+func TestComputeBreadth(t *testing.T) {
+	snaps := []notify.Snapshot{
+		{Symbol: "600000", Name: "A", ChangePercent: 9.95},  // 涨停（按 99% 判断）
+		{Symbol: "300001", Name: "B", ChangePercent: 10},    // 创业板 10% 不算涨停
+		{Symbol: "600002", Name: "ST C", ChangePercent: -5}, // ST 跌停，同时跌超 5%
+		{Symbol: "600003", Name: "D", ChangePercent: 0},
+		{Symbol: "600004", Name: "E", ChangePercent: -1},
+		{Symbol: "600005", Name: "F", ChangePercent: 2},
+		{Symbol: "300002", Name: "ST G", ChangePercent: 19.9}, // 创业板 ST 仍是 20%，和数据质量校验一致
+		{Symbol: "688001", Name: "H", ChangePercent: -6},      // 科创板跌 6% 不算跌停
+	}
+	b := ComputeBreadth(snaps)
+	want := Breadth{Total: 8, Up: 4, Down: 3, Flat: 1, LimitUp: 2, LimitDown: 1, Up5: 3, Down5: 2, MedianChange: 1}
+	if b != want {
+		t.Fatalf("breadth = %+v, want %+v", b, want)
+	}
+	if b := ComputeBreadth(nil); b != (Breadth{}) {
+		t.Fatalf("空快照 breadth = %+v", b)
+	}
+}
+
+func rule(id uint, name string, expr map[string]interface{}) models.UserStockRule {
+	raw, _ := json.Marshal(expr)
+	return models.UserStockRule{ID: id, RuleName: name, RuleExpression: raw}
+}
+
+func TestAssemble(t *testing.T) {
+	day := time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC)
+	prevDay := day.AddDate(0, 0, -1)
+	prev := []notify.Snapshot{
+		{Symbol: "000001", ChangePercent: 6},
+		{Symbol: "000002", ChangePercent: 7},
+		{Symbol: "000003", ChangePercent: 1},
+	}
+	// 快照按涨跌幅从高到低
+	today := []notify.Snapshot{
+		{Symbol: "000003", Name: "新进", Close: 10, ChangePercent: 8},
+		{Symbol: "000001", Name: "持续", Close: 20, ChangePercent: 5.5},
+		{Symbol: "000002", Name: "退出", Close: 30, ChangePercent: 1},
+	}
+	m := NewMarket(day, prevDay, today, prev)
+	alertID := uint(9)
+	in := Inputs{
+		Rules: []models.UserStockRule{
+			rule(1, "涨超5", map[string]interface{}{"change_percent": map[string]interface{}{"gt": 5}}),
+			rule(2, "只看行业", map[string]interface{}{"industry": "银行"}),
+			// 涨幅条件能判断、行业判断不了：不能只按涨幅算命中
+			rule(3, "银行涨超5", map[string]interface{}{"change_percent": map[string]interface{}{"gt": 5}, "industry": "银行"}),
+		},
+		Favorites: []string{"000002", "000003", "999999"},
+		Alerts:    []models.Notification{{AlertID: &alertID, Symbol: "000001", Title: "提醒", Message: "突破"}},
+	}
+	d := Assemble(m, in, day)
+
+	if d.TradeDate != "2026-03-10" || d.PrevDate != "2026-03-09" {
+		t.Fatalf("dates = %s / %s", d.TradeDate, d.PrevDate)
+	}
+	if len(d.Rules) != 3 {
+		t.Fatalf("rules = %d", len(d.Rules))
+	}
+	r := d.Rules[0]
+	if r.NewCount != 1 || r.ContinuingCount != 1 || r.ExitedCount != 1 {
+		t.Fatalf("counts = %d/%d/%d, want 1/1/1", r.NewCount, r.ContinuingCount, r.ExitedCount)
+	}
+	if r.New[0].Symbol != "000003" || r.Continuing[0].Symbol != "000001" {
+		t.Fatalf("new = %+v, continuing = %+v", r.New, r.Continuing)
+	}
+	if !d.Rules[1].Unsupported {
+		t.Fatal("只有行业条件的规则应标记为 unsupported")
+	}
+	if r := d.Rules[2]; !r.Unsupported || r.NewCount+r.ContinuingCount+r.ExitedCount != 0 {
+		t.Fatalf("带行业条件的规则应标记为 unsupported 且不统计命中: %+v", r)
+	}
+	if len(d.Watchlist) != 2 || d.Watchlist[0].Symbol != "000003" || d.Watchlist[1].Symbol != "000002" {
+		t.Fatalf("watchlist = %+v（应按涨跌幅排序）", d.Watchlist)
+	}
+	if len(d.WatchMissing) != 1 || d.WatchMissing[0] != "999999" {
+		t.Fatalf("watch missing = %v", d.WatchMissing)
+	}
+	if len(d.Alerts) != 1 || d.Alerts[0].AlertID != 9 {
+		t.Fatalf("alerts = %+v", d.Alerts)
+	}
+}
+
+func TestAssemble_NoPrevDayAndListLimit(t *testing.T) {
+	var today []notify.Snapshot
+	for i := 0; i < listLimit+5; i++ {
+		today = append(today, notify.Snapshot{Symbol: fmt.Sprintf("%06d", i), ChangePercent: 6})
+	}
+	m := NewMarket(time.Now(), time.Time{}, today, nil)
+	d := Assemble(m, Inputs{Rules: []models.UserStockRule{
+		rule(1, "涨超5", map[string]interface{}{"change_percent": map[string]interface{}{"gt": 5}}),
+	}}, time.Now())
+	r := d.Rules[0]
+	if r.NewCount != listLimit+5 || len(r.New) != listLimit || r.ContinuingCount != 0 {
+		t.Fatalf("new = %d（列出 %d），continuing = %d", r.NewCount, len(r.New), r.ContinuingCount)
+	}
+	if d.PrevDate != "" {
+		t.Fatalf("prev date = %q, want empty", d.PrevDate)
+	}
+}
+
+func TestRender(t *testing.T) {
+	m := NewMarket(time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC), time.Time{},
+		[]notify.Snapshot{{Symbol: "600000", Name: "<b>A|B</b>", Close: 10, ChangePercent: 6}}, nil)
+	d := Assemble(m, Inputs{
+		Rules:     []models.UserStockRule{rule(1, "涨超5", map[string]interface{}{"change_percent": map[string]interface{}{"gt": 5}})},
+		Favorites: []string{"600000"},
+	}, time.Now())
+
+	md := Markdown(d)
+	for _, want := range []string{"# oh-my-stock 收盘日报 2026-03-10", "### 涨超5（新进 1 / 持续 0 / 退出 0）", `<b>A\|B</b>`, "+6.00%"} {
+		if !strings.Contains(md, want) {
+			t.Fatalf("markdown 缺少 %q:\n%s", want, md)
+		}
+	}
+
+	html, err := HTML(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(html, "<b>A|B</b>") || !strings.Contains(html, "&lt;b&gt;A|B&lt;/b&gt;") {
+		t.Fatal("HTML 没有转义股票名称")
+	}
+	if !strings.Contains(html, "color:#d32f2f") {
+		t.Fatal("上涨应为红色")
+	}
+}
@@ -0,0 +1,151 @@
+package digest
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"strings"
+)
+
+// ============================================================
+// 日报渲染：Markdown（接口 / 群机器人 / 邮件纯文本部分）和 HTML（接口 / 邮件）。
+// HTML 只用内联样式，邮件客户端大多不认 <style>。A 股习惯红涨绿跌。
+// ============================================================
+
+// Markdown 渲染成 Markdown。
+func Markdown(d Digest) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", d.Title())
+
+	b.WriteString("## 市场概况\n\n")
+	br := d.Breadth
+	if br.Total == 0 {
+		b.WriteString("当天没有行情数据。\n\n")
+	} else {
+		fmt.Fprintf(&b, "- 上涨 %d / 下跌 %d / 平盘 %d（共 %d 只），涨跌幅中位数 %s\n", br.Up, br.Down, br.Flat, br.Total, pct(br.MedianChange))
+		fmt.Fprintf(&b, "- 涨停 %d / 跌停 %d，涨超 5%% %d / 跌超 5%% %d\n\n", br.LimitUp, br.LimitDown, br.Up5, br.Down5)
+	}
+
+	b.WriteString("## 规则命中\n\n")
+	if len(d.Rules) == 0 {
+		b.WriteString("还没有规则。\n\n")
+	}
+	for _, r := range d.Rules {
+		if r.Unsupported {
+			fmt.Fprintf(&b, "### %s\n\n含收盘快照判断不了的条件（行业、连续 N 天、公式……），请在应用里执行规则查看。\n\n", mdEscape(r.RuleName))
+			continue
+		}
+		fmt.Fprintf(&b, "### %s（新进 %d / 持续 %d / 退出 %d）\n\n", mdEscape(r.RuleName), r.NewCount, r.ContinuingCount, r.ExitedCount)
+		mdStocks(&b, "新进", r.New, r.NewCount)
+		mdStocks(&b, "持续", r.Continuing, r.ContinuingCount)
+		if r.NewCount+r.ContinuingCount == 0 {
+			b.WriteString("今天没有命中。\n\n")
+		}
+	}
+
+	b.WriteString("## 自选股\n\n")
+	if len(d.Watchlist)+len(d.WatchMissing) == 0 {
+		b.WriteString("还没有自选股。\n\n")
+	} else {
+		mdStocks(&b, "", d.Watchlist, len(d.Watchlist))
+		if len(d.WatchMissing) > 0 {
+			fmt.Fprintf(&b, "当天无行情：%s\n\n", strings.Join(d.WatchMissing, "、"))
+		}
+	}
+
+	b.WriteString("## 价格提醒\n\n")
+	if len(d.Alerts) == 0 {
+		b.WriteString("今天没有触发的提醒。\n")
+	}
+	for _, a := range d.Alerts {
+		fmt.Fprintf(&b, "- %s **%s**：%s\n", a.At.Format("15:04"), mdEscape(a.Title), mdEscape(a.Message))
+	}
+	return b.String()
+}
+
+func mdStocks(b *strings.Builder, label string, list []Stock, total int) {
+	if len(list) == 0 {
+		return
+	}
+	if label != "" {
+		fmt.Fprintf(b, "%s：\n\n", label)
+	}
+	b.WriteString("| 代码 | 名称 | 收盘 | 涨跌幅 |\n|---|---|---:|---:|\n")
+	for _, s := range list {
+		fmt.Fprintf(b, "| %s | %s | %.2f | %s |\n", s.Symbol, mdEscape(s.Name), s.Close, pct(s.ChangePercent))
+	}
+	if total > len(list) {
+		fmt.Fprintf(b, "\n另有 %d 只未列出。\n", total-len(list))
+	}
+	b.WriteString("\n")
+}
+
+// mdEscape 名称、提醒正文里的 | 和换行会打乱表格 / 列表。
+func mdEscape(s string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ", "\r", "").Replace(s)
+}
+
+func pct(v float64) string {
+	return fmt.Sprintf("%+.2f%%", v)
+}
+
+// changeColor 红涨绿跌。
+func changeColor(v float64) string {
+	switch {
+	case v > 0:
+		return "#d32f2f"
+	case v < 0:
+		return "#2e7d32"
+	}
+	return "#666666"
+}
+
+var htmlTmpl = template.Must(template.New("digest").Funcs(template.FuncMap{
+	"pct":   pct,
+	"color": changeColor,
+	"more":  func(total int, list []Stock) int { return total - len(list) },
+}).Parse(`<!DOCTYPE html>
+<html lang="zh-CN"><head><meta charset="utf-8"><title>{{.Title}}</title></head>
+<body style="margin:0;padding:16px;background:#f5f5f5;font-family:-apple-system,'PingFang SC','Microsoft YaHei',sans-serif;color:#222;">
+<div style="max-width:720px;margin:0 auto;background:#fff;padding:20px 24px;border-radius:6px;">
+<h1 style="font-size:20px;margin:0 0 16px;">{{.Title}}</h1>
+{{define "stocks"}}<table style="border-collapse:collapse;width:100%;font-size:13px;margin:4px 0 8px;">
+<tr style="background:#fafafa;"><th style="text-align:left;padding:4px 6px;border-bottom:1px solid #eee;">代码</th><th style="text-align:left;padding:4px 6px;border-bottom:1px solid #eee;">名称</th><th style="text-align:right;padding:4px 6px;border-bottom:1px solid #eee;">收盘</th><th style="text-align:right;padding:4px 6px;border-bottom:1px solid #eee;">涨跌幅</th></tr>
+{{range .}}<tr><td style="padding:4px 6px;border-bottom:1px solid #f0f0f0;">{{.Symbol}}</td><td style="padding:4px 6px;border-bottom:1px solid #f0f0f0;">{{.Name}}</td><td style="text-align:right;padding:4px 6px;border-bottom:1px solid #f0f0f0;">{{printf "%.2f" .Close}}</td><td style="text-align:right;padding:4px 6px;border-bottom:1px solid #f0f0f0;color:{{color .ChangePercent}};">{{pct .ChangePercent}}</td></tr>
+{{end}}</table>{{end}}
+<h2 style="font-size:16px;border-left:3px solid #1976d2;padding-left:8px;">市场概况</h2>
+{{with .D.Breadth}}{{if .Total}}<p style="font-size:14px;line-height:1.8;margin:0;">
+上涨 <b style="color:#d32f2f;">{{.Up}}</b> / 下跌 <b style="color:#2e7d32;">{{.Down}}</b> / 平盘 {{.Flat}}（共 {{.Total}} 只），涨跌幅中位数 <span style="color:{{color .MedianChange}};">{{pct .MedianChange}}</span><br>
+涨停 {{.LimitUp}} / 跌停 {{.LimitDown}}，涨超 5% {{.Up5}} / 跌超 5% {{.Down5}}</p>
+{{else}}<p style="font-size:14px;">当天没有行情数据。</p>{{end}}{{end}}
+<h2 style="font-size:16px;border-left:3px solid #1976d2;padding-left:8px;">规则命中</h2>
+{{range .D.Rules}}{{if .Unsupported}}<h3 style="font-size:14px;margin:12px 0 4px;">{{.RuleName}}</h3>
+<p style="font-size:13px;color:#888;margin:0;">含收盘快照判断不了的条件（行业、连续 N 天、公式……），请在应用里执行规则查看。</p>
+{{else}}<h3 style="font-size:14px;margin:12px 0 4px;">{{.RuleName}} <span style="font-weight:normal;color:#888;">新进 {{.NewCount}} / 持续 {{.ContinuingCount}} / 退出 {{.ExitedCount}}</span></h3>
+{{if .New}}<div style="font-size:13px;color:#555;">新进</div>{{template "stocks" .New}}{{if gt (more .NewCount .New) 0}}<div style="font-size:12px;color:#888;">另有 {{more .NewCount .New}} 只未列出</div>{{end}}{{end}}
+{{if .Continuing}}<div style="font-size:13px;color:#555;">持续</div>{{template "stocks" .Continuing}}{{if gt (more .ContinuingCount .Continuing) 0}}<div style="font-size:12px;color:#888;">另有 {{more .ContinuingCount .Continuing}} 只未列出</div>{{end}}{{end}}
+{{if not (or .New .Continuing)}}<p style="font-size:13px;color:#888;margin:0;">今天没有命中。</p>{{end}}
+{{end}}{{else}}<p style="font-size:13px;color:#888;">还没有规则。</p>{{end}}
+<h2 style="font-size:16px;border-left:3px solid #1976d2;padding-left:8px;">自选股</h2>
+{{if .D.Watchlist}}{{template "stocks" .D.Watchlist}}{{end}}
+{{if .D.WatchMissing}}<p style="font-size:13px;color:#888;">当天无行情：{{range $i, $s := .D.WatchMissing}}{{if $i}}、{{end}}{{$s}}{{end}}</p>{{end}}
+{{if not (or .D.Watchlist .D.WatchMissing)}}<p style="font-size:13px;color:#888;">还没有自选股。</p>{{end}}
+<h2 style="font-size:16px;border-left:3px solid #1976d2;padding-left:8px;">价格提醒</h2>
+{{if .D.Alerts}}<ul style="font-size:13px;padding-left:20px;line-height:1.8;">
+{{range .D.Alerts}}<li>{{.At.Format "15:04"}} <b>{{.Title}}</b>：{{.Message}}</li>
+{{end}}</ul>{{else}}<p style="font-size:13px;color:#888;">今天没有触发的提醒。</p>{{end}}
+<p style="font-size:12px;color:#aaa;margin-top:24px;">生成于 {{.D.GeneratedAt.Format "2006-01-02 15:04"}}</p>
+</div></body></html>
+`))
+
+// HTML 渲染成完整的 HTML 页面（内联样式，可直接作为邮件正文）。
+func HTML(d Digest) (string, error) {
+	var buf bytes.Buffer
+	if err := htmlTmpl.Execute(&buf, struct {
+		Title string
+		D     Digest
+	}{d.Title(), d}); err != nil {
+		return "", fmt.Errorf("渲染日报: %w", err)
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,196 @@
+package digest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/mail"
+	"time"
+
+	"gorm.io/gorm"
+
+	"oh-my-stock/events"
+	"oh-my-stock/models"
+	"oh-my-stock/notify"
+)
+
+// ============================================================
+// 生成与投递：daily_digest 任务收盘后对每个「有东西可看」的用户（有规则、自选股或当天触发过提醒）
+// 生成一份，按 (user_id, trade_date) upsert 进 daily_digests，推一条 digest 实时事件；
+// 打开了邮件的（digest_settings.email）再发 HTML 邮件。已发送成功的不会重发，
+// 失败的下次任务运行（或手动触发）再试。
+// ============================================================
+
+// 邮件状态（daily_digests.email_status），空串表示没发过
+const (
+	EmailSent   = "sent"
+	EmailFailed = "failed"
+)
+
+// ErrNoData stock_history_mv 里还没有任何交易日。
+var ErrNoData = errors.New("没有行情数据，无法生成日报")
+
+// LoadMarket 读取 day（零值 = 最新交易日）和它前一个有数据的交易日的快照。
+func LoadMarket(ctx context.Context, db *gorm.DB, day time.Time) (*Market, error) {
+	db = db.WithContext(ctx)
+	if day.IsZero() {
+		var latest *time.Time
+		if err := db.Raw("SELECT MAX(trade_date) FROM stock_history_mv").Scan(&latest).Error; err != nil {
+			return nil, fmt.Errorf("读取最新交易日: %w", err)
+		}
+		if latest == nil {
+			return nil, ErrNoData
+		}
+		day = *latest
+	}
+	today, err := notify.SnapshotsOn(db, day)
+	if err != nil {
+		return nil, err
+	}
+	if len(today) == 0 {
+		return nil, fmt.Errorf("%s %w", day.Format("2006-01-02"), ErrNoData)
+	}
+	prevDay, prev, err := notify.PrevSnapshots(db, day)
+	if err != nil {
+		return nil, err
+	}
+	return NewMarket(day, prevDay, today, prev), nil
+}
+
+// loadInputs 一个用户的规则、自选股和当天触发的提醒。
+func loadInputs(db *gorm.DB, userID string, day time.Time) (Inputs, error) {
+	var in Inputs
+	if err := db.Where("user_id = ?", userID).Order("id").Find(&in.Rules).Error; err != nil {
+		return in, fmt.Errorf("读取规则: %w", err)
+	}
+	if err := db.Model(&models.UserFavoriteStock{}).Where("user_id = ?", userID).Order("id").Pluck("symbol", &in.Favorites).Error; err != nil {
+		return in, fmt.Errorf("读取自选股: %w", err)
+	}
+	if err := db.Where("user_id = ? AND alert_id IS NOT NULL AND trade_date = ?", userID, day.Format("2006-01-02")).
+		Order("id").Find(&in.Alerts).Error; err != nil {
+		return in, fmt.Errorf("读取提醒: %w", err)
+	}
+	return in, nil
+}
+
+// Save 渲染并 upsert 一份日报，返回入库的行。重新生成不会清掉已发送的邮件状态。
+func Save(db *gorm.DB, userID string, d Digest) (models.DailyDigest, error) {
+	html, err := HTML(d)
+	if err != nil {
+		return models.DailyDigest{}, err
+	}
+	summary, err := json.Marshal(d)
+	if err != nil {
+		return models.DailyDigest{}, fmt.Errorf("日报序列化: %w", err)
+	}
+	var row models.DailyDigest
+	err = db.Raw(`INSERT INTO daily_digests (user_id, trade_date, title, summary, markdown, html)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (user_id, trade_date) DO UPDATE SET
+			title = EXCLUDED.title, summary = EXCLUDED.summary, markdown = EXCLUDED.markdown,
+			html = EXCLUDED.html, updated_at = NOW()
+		RETURNING *`, userID, d.TradeDate, d.Title(), string(summary), Markdown(d), html).Scan(&row).Error
+	if err != nil {
+		return row, fmt.Errorf("写入日报: %w", err)
+	}
+	return row, nil
+}
+
+// GenerateForUser 给一个用户生成（或重新生成）m 那天的日报，不发邮件。
+func GenerateForUser(ctx context.Context, db *gorm.DB, m *Market, userID string) (models.DailyDigest, error) {
+	db = db.WithContext(ctx)
+	in, err := loadInputs(db, userID, m.Day)
+	if err != nil {
+		return models.DailyDigest{}, err
+	}
+	return Save(db, userID, Assemble(m, in, time.Now()))
+}
+
+// Result 一轮生成的结果。
+type Result struct {
+	Generated int
+	Emailed   int
+	Failed    int // 生成或发邮件失败的用户数
+}
+
+// recipient 一个要生成日报的用户。
+type recipient struct {
+	UserID    string
+	UserEmail string
+	Email     bool   // 是否发邮件
+	EmailTo   string // 设置里的收件地址，空 = 注册邮箱
+}
+
+// recipientsSQL 有规则、自选股或当天触发过提醒的用户，排除关闭日报的。
+const recipientsSQL = `SELECT u.id AS user_id, COALESCE(u.email, '') AS user_email,
+		COALESCE(s.email, FALSE) AS email, COALESCE(s.email_to, '') AS email_to
+	FROM users u
+	LEFT JOIN digest_settings s ON s.user_id = u.id
+	WHERE u.is_active IS NOT FALSE AND COALESCE(s.enabled, TRUE)
+	  AND (EXISTS (SELECT 1 FROM user_stock_rules r WHERE r.user_id = u.id)
+	    OR EXISTS (SELECT 1 FROM user_favorite_stocks f WHERE f.user_id = u.id)
+	    OR EXISTS (SELECT 1 FROM notifications n WHERE n.user_id = u.id AND n.alert_id IS NOT NULL AND n.trade_date = ?))
+	ORDER BY u.id`
+
+// Run 给所有用户生成 m 那天的日报并按设置发邮件。一个用户失败不影响其他用户，错误合并返回。
+func Run(ctx context.Context, db *gorm.DB, m *Market) (Result, error) {
+	var res Result
+	var users []recipient
+	if err := db.WithContext(ctx).Raw(recipientsSQL, m.Day.Format("2006-01-02")).Scan(&users).Error; err != nil {
+		return res, fmt.Errorf("读取日报用户: %w", err)
+	}
+	var errs []error
+	for _, u := range users {
+		if ctx.Err() != nil {
+			return res, ctx.Err()
+		}
+		row, err := GenerateForUser(ctx, db, m, u.UserID)
+		if err != nil {
+			res.Failed++
+			errs = append(errs, fmt.Errorf("用户 %s: %w", u.UserID, err))
+			continue
+		}
+		res.Generated++
+		if err := events.Publish(db, u.UserID, events.TypeDigest, map[string]interface{}{
+			"id": row.ID, "trade_date": m.Day.Format("2006-01-02"), "title": row.Title,
+		}); err != nil {
+			log.Printf("⚠️ 推送日报事件失败: %v", err)
+		}
+		if !u.Email || row.EmailStatus == EmailSent {
+			continue
+		}
+		to := u.EmailTo
+		if to == "" {
+			to = u.UserEmail
+		}
+		if err := Email(ctx, db, row, to); err != nil {
+			res.Failed++
+			log.Printf("⚠️ 日报邮件发送失败（用户 %s）: %v", u.UserID, err)
+			continue
+		}
+		res.Emailed++
+	}
+	return res, errors.Join(errs...)
+}
+
+// Email 把日报发到 to，结果记在日报行上。
+func Email(ctx context.Context, db *gorm.DB, row models.DailyDigest, to string) error {
+	var sendErr error
+	if _, err := mail.ParseAddress(to); to == "" || err != nil {
+		sendErr = errors.New("没有可用的收件邮箱（在日报设置里填写，或给账号绑定邮箱）")
+	} else {
+		_, sendErr = notify.Send(ctx, notify.ChannelEmail, notify.ChannelConfig{To: []string{to}}, notify.Message{
+			Event: notify.EventDigest, Title: row.Title, Text: row.Markdown, HTML: row.HTML,
+		})
+	}
+	updates := map[string]interface{}{"email_status": EmailSent, "email_error": "", "emailed_at": time.Now()}
+	if sendErr != nil {
+		updates = map[string]interface{}{"email_status": EmailFailed, "email_error": sendErr.Error()}
+	}
+	if err := db.WithContext(ctx).Model(&models.DailyDigest{}).Where("id = ?", row.ID).Updates(updates).Error; err != nil {
+		return errors.Join(sendErr, fmt.Errorf("记录邮件状态: %w", err))
+	}
+	return sendErr
+}
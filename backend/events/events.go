@@ -0,0 +1,108 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"oh-my-stock/models"
+)
+
+// ============================================================
+// 实时事件：规则命中通知、行情入库完成、价格提醒……写入 user_events 并 NOTIFY，
+// 每个副本的 Hub 收到后按用户扇出给自己持有的 SSE 连接（见 hub.go）。
+// user_events 同时是断线重连的补发来源：客户端带 Last-Event-ID 重连时，
+// 先补发之后属于自己的事件，再接着推实时事件。
+// ============================================================
+
+// 事件类型
+const (
+	TypeNotification = "notification" // 规则命中通知
+	TypeIngest       = "ingest"       // 行情入库任务完成（发给所有人）
+	TypeAlert        = "alert"        // 价格提醒
+	TypeDigest       = "digest"       // 收盘日报已生成
+)
+
+// Channel PostgreSQL NOTIFY 的频道名。
+const Channel = "user_events"
+
+// DefaultKeep user_events 保留时长，超过的由 purge 任务清理（见 Prune）。
+const DefaultKeep = 72 * time.Hour
+
+// Event 推给前端的一条事件。
+type Event struct {
+	ID        int64           `json:"id"`
+	UserID    string          `json:"-"` // 空表示广播
+	Type      string          `json:"type"`
+	Data      json.RawMessage `json:"data"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+func fromModel(m models.UserEvent) Event {
+	e := Event{ID: m.ID, Type: m.Type, Data: m.Data, CreatedAt: m.CreatedAt}
+	if m.UserID != nil {
+		e.UserID = *m.UserID
+	}
+	if len(e.Data) == 0 {
+		e.Data = json.RawMessage("{}")
+	}
+	return e
+}
+
+// Publish 写一条事件并通知所有副本。userID 为空表示发给所有在线用户。
+func Publish(db *gorm.DB, userID, typ string, data interface{}) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("事件序列化: %w", err)
+	}
+	var uid interface{}
+	if userID != "" {
+		uid = userID
+	}
+	err = db.Exec(`WITH e AS (
+			INSERT INTO user_events (user_id, type, data) VALUES (?, ?, ?) RETURNING id
+		)
+		SELECT pg_notify(?, id::text) FROM e`, uid, typ, string(raw), Channel).Error
+	if err != nil {
+		return fmt.Errorf("写入事件: %w", err)
+	}
+	return nil
+}
+
+// Signal 只发 NOTIFY，用于事件已在别的 SQL 里写入 user_events 的场景（如 notify 包批量写通知）。
+func Signal(db *gorm.DB) error {
+	return db.Exec("SELECT pg_notify(?, '')", Channel).Error
+}
+
+// Replay 用户在 afterID 之后的事件（含广播），最多 limit 条，按 ID 升序。
+func Replay(ctx context.Context, db *gorm.DB, userID string, afterID int64, limit int) ([]Event, error) {
+	var rows []models.UserEvent
+	err := db.WithContext(ctx).Where("id > ? AND (user_id = ? OR user_id IS NULL)", afterID, userID).
+		Order("id").Limit(limit).Find(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("读取事件: %w", err)
+	}
+	out := make([]Event, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, fromModel(r))
+	}
+	return out, nil
+}
+
+// Prune 删除早于 keep 的事件，返回删除条数。
+func Prune(ctx context.Context, db *gorm.DB, keep time.Duration) (int64, error) {
+	res := db.WithContext(ctx).Where("created_at < ?", time.Now().Add(-keep)).Delete(&models.UserEvent{})
+	return res.RowsAffected, res.Error
+}
+
+// WriteSSE 按 text/event-stream 格式写一条事件（id / event / data）。
+func WriteSSE(w io.Writer, e Event) error {
+	data := strings.ReplaceAll(string(e.Data), "\n", "\ndata: ")
+	_, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+	return err
+}
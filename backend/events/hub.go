@@ -0,0 +1,273 @@
+package events
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/stdlib"
+	"gorm.io/gorm"
+
+	"oh-my-stock/models"
+)
+
+// ============================================================
+// Hub：一个进程一个，按用户维护在线订阅（每个 SSE 连接一个 Subscriber）。
+//
+// 在一条专用连接上 LISTEN user_events；收到 NOTIFY（或等满 PollInterval）就把 user_events 里
+// 新于已分发位置的行读出来，按 user_id 扇出（user_id 为空的发给所有人）。
+// NOTIFY 只是「有新事件」的信号，真正的内容每次都从表里读，所以合并 / 丢失的 NOTIFY、
+// LISTEN 连接断开重连都不会丢事件，最多晚一个 PollInterval。
+//
+// 并发写入时 ID 可能乱序提交（ID 小的事务后提交），分发时保留最近 reorderWindow 个 ID 的已发送集合，
+// 读的时候往回多看这么多，晚提交的事件仍会补上且不会重复。
+//
+// 订阅者的缓冲满了（客户端太慢）直接断开它，浏览器带 Last-Event-ID 自动重连后从表里补发。
+// ============================================================
+
+// PollInterval 没收到 NOTIFY 时兜底轮询的间隔。
+var PollInterval = 30 * time.Second
+
+// MaxPerUser 每个用户同时在线的连接数上限（多开标签页）。
+const MaxPerUser = 32
+
+const (
+	subscriberBuffer = 256
+	reorderWindow    = 500
+	fetchBatch       = 1000
+)
+
+// ErrTooManyConnections 用户在线连接数超过 MaxPerUser。
+var ErrTooManyConnections = errors.New("连接数过多，请关闭部分页面")
+
+// Subscriber 一个在线连接。C 关闭表示被 Hub 断开（缓冲满或 Hub 停止），客户端应重连。
+type Subscriber struct {
+	C      <-chan Event
+	ch     chan Event
+	userID string
+	hub    *Hub
+	once   sync.Once
+}
+
+// Close 取消订阅。
+func (s *Subscriber) Close() {
+	s.hub.remove(s)
+}
+
+// Hub 进程内的事件分发中心。
+type Hub struct {
+	mu     sync.Mutex
+	subs   map[string]map[*Subscriber]struct{}
+	lastID int64
+	floor  int64              // 启动时已有的事件（ID <= floor）只通过 Replay 补发，不再实时推
+	seen   map[int64]struct{} // (lastID-reorderWindow, lastID] 内已分发的 ID
+}
+
+// NewHub 空 Hub。
+func NewHub() *Hub {
+	return &Hub{subs: map[string]map[*Subscriber]struct{}{}, seen: map[int64]struct{}{}}
+}
+
+// Default 进程默认 Hub，由 Start 启动。
+var Default = NewHub()
+
+// Subscribe 给用户新开一个订阅。
+func (h *Hub) Subscribe(userID string) (*Subscriber, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	set := h.subs[userID]
+	if len(set) >= MaxPerUser {
+		return nil, ErrTooManyConnections
+	}
+	if set == nil {
+		set = map[*Subscriber]struct{}{}
+		h.subs[userID] = set
+	}
+	ch := make(chan Event, subscriberBuffer)
+	s := &Subscriber{C: ch, ch: ch, userID: userID, hub: h}
+	set[s] = struct{}{}
+	return s, nil
+}
+
+func (h *Hub) remove(s *Subscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.removeLocked(s)
+}
+
+func (h *Hub) removeLocked(s *Subscriber) {
+	if set, ok := h.subs[s.userID]; ok {
+		delete(set, s)
+		if len(set) == 0 {
+			delete(h.subs, s.userID)
+		}
+	}
+	s.once.Do(func() { close(s.ch) })
+}
+
+// Online 在线用户数和连接数。
+func (h *Hub) Online() (users, conns int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, set := range h.subs {
+		conns += len(set)
+	}
+	return len(h.subs), conns
+}
+
+// Dispatch 把一批事件扇出给在线订阅者，已分发过的 ID 跳过。事件按 ID 升序传入。
+func (h *Hub) Dispatch(evs []Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, e := range evs {
+		if _, dup := h.seen[e.ID]; dup || e.ID <= h.floor || e.ID <= h.lastID-reorderWindow {
+			continue
+		}
+		h.seen[e.ID] = struct{}{}
+		if e.ID > h.lastID {
+			h.lastID = e.ID
+		}
+		if e.UserID == "" {
+			for _, set := range h.subs {
+				h.sendLocked(set, e)
+			}
+		} else if set, ok := h.subs[e.UserID]; ok {
+			h.sendLocked(set, e)
+		}
+	}
+	for id := range h.seen {
+		if id <= h.lastID-reorderWindow {
+			delete(h.seen, id)
+		}
+	}
+}
+
+func (h *Hub) sendLocked(set map[*Subscriber]struct{}, e Event) {
+	for s := range set {
+		select {
+		case s.ch <- e:
+		default:
+			// 太慢的连接直接断开，客户端带 Last-Event-ID 重连后补发
+			h.removeLocked(s)
+		}
+	}
+}
+
+// closeAll Hub 停止时断开所有订阅者。
+func (h *Hub) closeAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, set := range h.subs {
+		for s := range set {
+			h.removeLocked(s)
+		}
+	}
+}
+
+// cursor 下一次从表里读的起点。
+func (h *Hub) cursor() int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.lastID <= reorderWindow {
+		return 0
+	}
+	return h.lastID - reorderWindow
+}
+
+// poll 把 cursor 之后的新事件读出来分发。
+func (h *Hub) poll(ctx context.Context, db *gorm.DB) error {
+	for {
+		var rows []models.UserEvent
+		if err := db.WithContext(ctx).Where("id > ?", h.cursor()).Order("id").Limit(fetchBatch).Find(&rows).Error; err != nil {
+			return err
+		}
+		evs := make([]Event, 0, len(rows))
+		for _, r := range rows {
+			evs = append(evs, fromModel(r))
+		}
+		h.Dispatch(evs)
+		if len(rows) < fetchBatch {
+			return nil
+		}
+	}
+}
+
+// Start 启动 Default Hub：从当前最新事件开始（已有的事件只通过 Replay 补发），LISTEN 断开后 5 秒重连。
+func Start(ctx context.Context, db *gorm.DB) {
+	go Default.run(ctx, db)
+}
+
+func (h *Hub) run(ctx context.Context, db *gorm.DB) {
+	defer h.closeAll()
+	var maxID int64
+	db.WithContext(ctx).Model(&models.UserEvent{}).Select("COALESCE(MAX(id), 0)").Scan(&maxID)
+	h.mu.Lock()
+	h.lastID, h.floor = maxID, maxID
+	h.mu.Unlock()
+
+	for ctx.Err() == nil {
+		err := h.listen(ctx, db)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("⚠️ 实时事件 LISTEN 断开，5 秒后重连: %v", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+// listen 在专用连接上 LISTEN，收到通知或超时都读一次新事件。
+func (h *Hub) listen(ctx context.Context, db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var lerr error
+	// 连接带着 LISTEN 不能回池：回调总是返回 ErrBadConn，让连接池丢掉它
+	conn.Raw(func(dc interface{}) error {
+		lerr = h.listenOn(ctx, db, dc)
+		return driver.ErrBadConn
+	})
+	return lerr
+}
+
+func (h *Hub) listenOn(ctx context.Context, db *gorm.DB, dc interface{}) error {
+	sc, ok := dc.(*stdlib.Conn)
+	if !ok {
+		return errors.New("数据库驱动不是 pgx，无法 LISTEN")
+	}
+	pc := sc.Conn().PgConn()
+	if _, err := pc.Exec(ctx, "LISTEN "+Channel).ReadAll(); err != nil {
+		return err
+	}
+	// (重)连上后先追一次，断开期间的事件不会漏
+	if err := h.poll(ctx, db); err != nil {
+		log.Printf("⚠️ 读取实时事件失败: %v", err)
+	}
+	for {
+		wctx, cancel := context.WithTimeout(ctx, PollInterval)
+		err := pc.WaitForNotification(wctx)
+		timedOut := wctx.Err() != nil
+		cancel()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil && !timedOut {
+			return err
+		}
+		if err := h.poll(ctx, db); err != nil {
+			log.Printf("⚠️ 读取实时事件失败: %v", err)
+		}
+	}
+}
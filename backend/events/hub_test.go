@@ -0,0 +1,127 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func ev(id int64, user string) Event {
+	return Event{ID: id, UserID: user, Type: TypeNotification, Data: json.RawMessage(`{}`)}
+}
+
+// drain 取出订阅者缓冲里现有的事件 ID。
+func drain(s *Subscriber) []int64 {
+	var ids []int64
+	for {
+		select {
+		case e, ok := <-s.C:
+			if !ok {
+				return ids
+			}
+			ids = append(ids, e.ID)
+		default:
+			return ids
+		}
+	}
+}
+
+func TestHub_FanOut(t *testing.T) {
+	h := NewHub()
+	a1, _ := h.Subscribe("a")
+	a2, _ := h.Subscribe("a") // 同一用户多开标签页
+	b, _ := h.Subscribe("b")
+
+	h.Dispatch([]Event{ev(1, "a"), ev(2, "b"), ev(3, "")})
+	for name, c := range map[string]struct {
+		s    *Subscriber
+		want []int64
+	}{"a1": {a1, []int64{1, 3}}, "a2": {a2, []int64{1, 3}}, "b": {b, []int64{2, 3}}} {
+		if got := drain(c.s); len(got) != len(c.want) || got[0] != c.want[0] || got[1] != c.want[1] {
+			t.Fatalf("%s 收到 %v，want %v", name, got, c.want)
+		}
+	}
+
+	a1.Close()
+	h.Dispatch([]Event{ev(4, "a")})
+	if got := drain(a2); len(got) != 1 || got[0] != 4 {
+		t.Fatalf("关掉一个标签页不影响另一个: %v", got)
+	}
+	if users, conns := h.Online(); users != 2 || conns != 2 {
+		t.Fatalf("online = %d/%d", users, conns)
+	}
+}
+
+func TestHub_DedupAndReorder(t *testing.T) {
+	h := NewHub()
+	s, _ := h.Subscribe("a")
+	h.Dispatch([]Event{ev(10, "a"), ev(12, "a")})
+	// 再读一次同一段（轮询重叠）+ 晚提交的 11
+	h.Dispatch([]Event{ev(10, "a"), ev(11, "a"), ev(12, "a")})
+	got := drain(s)
+	if len(got) != 3 || got[0] != 10 || got[1] != 12 || got[2] != 11 {
+		t.Fatalf("got %v，want [10 12 11]", got)
+	}
+	if h.cursor() != 0 {
+		t.Fatalf("cursor = %d", h.cursor())
+	}
+	h.Dispatch([]Event{ev(reorderWindow+20, "a")})
+	if c := h.cursor(); c != 20 {
+		t.Fatalf("cursor = %d，应回看 reorderWindow", c)
+	}
+}
+
+func TestHub_Floor(t *testing.T) {
+	h := NewHub()
+	h.lastID, h.floor = 100, 100 // 启动时已有 100 条
+	s, _ := h.Subscribe("a")
+	h.Dispatch([]Event{ev(99, "a"), ev(100, "a"), ev(101, "a")})
+	if got := drain(s); len(got) != 1 || got[0] != 101 {
+		t.Fatalf("启动前的事件不应实时推: %v", got)
+	}
+}
+
+func TestHub_SlowSubscriberDropped(t *testing.T) {
+	h := NewHub()
+	slow, _ := h.Subscribe("a")
+	evs := make([]Event, 0, subscriberBuffer+1)
+	for i := 1; i <= subscriberBuffer+1; i++ {
+		evs = append(evs, ev(int64(i), "a"))
+	}
+	h.Dispatch(evs)
+	n := 0
+	for range slow.C { // 缓冲满后被断开，channel 关闭
+		n++
+	}
+	if n != subscriberBuffer {
+		t.Fatalf("收到 %d 条", n)
+	}
+	if users, _ := h.Online(); users != 0 {
+		t.Fatal("慢连接应被移除")
+	}
+	slow.Close() // 重复关闭无害
+}
+
+func TestHub_MaxPerUser(t *testing.T) {
+	h := NewHub()
+	for i := 0; i < MaxPerUser; i++ {
+		if _, err := h.Subscribe("a"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := h.Subscribe("a"); err != ErrTooManyConnections {
+		t.Fatalf("err = %v", err)
+	}
+	if _, err := h.Subscribe("b"); err != nil {
+		t.Fatal("其他用户不受影响")
+	}
+}
+
+func TestWriteSSE(t *testing.T) {
+	var buf bytes.Buffer
+	WriteSSE(&buf, Event{ID: 7, Type: TypeIngest, Data: json.RawMessage("{\"a\":1,\n\"b\":2}")})
+	want := "id: 7\nevent: ingest\ndata: {\"a\":1,\ndata: \"b\":2}\n\n"
+	if buf.String() != want {
+		t.Fatalf("got %q", buf.String())
+	}
+}
@@ -0,0 +1,133 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"oh-my-stock/adjust"
+	"oh-my-stock/config"
+	"oh-my-stock/models"
+)
+
+// LoadAdjuster 读取某只股票的复权因子。
+func LoadAdjuster(symbol string) (*adjust.Adjuster, error) {
+	var fs []models.StockAdjFactor
+	if err := config.DB.Where("symbol = ?", symbol).Order("ex_date").Find(&fs).Error; err != nil {
+		return nil, fmt.Errorf("读取复权因子失败: %w", err)
+	}
+	return adjust.New(fs), nil
+}
+
+// AdjustDaily 把日 K 换算成 m 复权价，不复权时直接返回原切片。
+func AdjustDaily(symbol string, rows []models.StockDailyData, m adjust.Mode) ([]models.StockDailyData, error) {
+	if m == adjust.None || len(rows) == 0 {
+		return rows, nil
+	}
+	a, err := LoadAdjuster(symbol)
+	if err != nil {
+		return nil, err
+	}
+	return a.Apply(rows, m), nil
+}
+
+// UpsertCorporateActions 按 (symbol, ex_date) upsert 除权除息事件，
+// 并重建涉及股票的复权因子。返回写入事件数。
+func UpsertCorporateActions(acts []models.StockCorporateAction) (int, error) {
+	if len(acts) == 0 {
+		return 0, nil
+	}
+	err := config.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "symbol"}, {Name: "ex_date"}},
+		DoUpdates: clause.AssignmentColumns([]string{"cash_dividend", "bonus_ratio", "transfer_ratio", "rights_ratio", "rights_price", "source"}),
+	}).CreateInBatches(acts, 500).Error
+	if err != nil {
+		return 0, err
+	}
+	seen := map[string]bool{}
+	for _, a := range acts {
+		if seen[a.Symbol] {
+			continue
+		}
+		seen[a.Symbol] = true
+		if _, err := RebuildAdjFactors(a.Symbol); err != nil {
+			return len(acts), err
+		}
+	}
+	return len(acts), nil
+}
+
+// RebuildAdjFactors 由全部日 K 和除权除息事件重算某只股票的复权因子。
+//
+// 因子有变化（新的除权日生效、事件被修正）时前复权价整体改变，
+// 删除指标续算状态，下次 RefreshIndicators 全量重算。返回因子行数。
+func RebuildAdjFactors(symbol string) (int, error) {
+	var acts []models.StockCorporateAction
+	if err := config.DB.Where("symbol = ?", symbol).Order("ex_date").Find(&acts).Error; err != nil {
+		return 0, fmt.Errorf("读取除权除息事件失败: %w", err)
+	}
+	var rows []models.StockDailyData
+	if len(acts) > 0 {
+		if err := config.DB.Select("symbol", "trade_date", "close").
+			Where("symbol = ?", symbol).Order("trade_date").Find(&rows).Error; err != nil {
+			return 0, fmt.Errorf("读取日 K 失败: %w", err)
+		}
+	}
+	fs := adjust.Factors(symbol, rows, acts)
+
+	var old []models.StockAdjFactor
+	if err := config.DB.Where("symbol = ?", symbol).Order("ex_date").Find(&old).Error; err != nil {
+		return 0, fmt.Errorf("读取复权因子失败: %w", err)
+	}
+	if sameFactors(old, fs) {
+		return len(fs), nil
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("symbol = ?", symbol).Delete(&models.StockAdjFactor{}).Error; err != nil {
+			return err
+		}
+		if len(fs) == 0 {
+			return nil
+		}
+		return tx.Create(&fs).Error
+	})
+	if err != nil {
+		return 0, fmt.Errorf("写入复权因子失败: %w", err)
+	}
+	if err := DeleteIndicatorState(symbol); err != nil {
+		return len(fs), err
+	}
+	return len(fs), nil
+}
+
+func sameFactors(a, b []models.StockAdjFactor) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].ExDate.Equal(b[i].ExDate) || math.Abs(a[i].Factor-b[i].Factor) > 1e-9 {
+			return false
+		}
+	}
+	return true
+}
+
+// SyncCorporateActions 抓取某只股票的除权除息事件并重建复权因子。
+// 没有新事件时也会重建一次：上一次抓取时尚未生效的除权日可能已经有了 K 线。
+func SyncCorporateActions(ctx context.Context, symbol string) error {
+	acts, err := FetchCorporateActions(ctx, symbol)
+	if err != nil && !errors.Is(err, ErrNotSupported) {
+		return err
+	}
+	if len(acts) > 0 {
+		_, err = UpsertCorporateActions(acts)
+		return err
+	}
+	_, err = RebuildAdjFactors(symbol)
+	return err
+}
@@ -0,0 +1,266 @@
+package fetcher
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"oh-my-stock/config"
+	"oh-my-stock/models"
+)
+
+// ============================================================
+// 归档文件：<archive_dir>/<表名>/<YYYY-MM>_<归档时间>.csv.gz，带表头的 CSV（不含自增 id），
+// 每个文件登记在 archive_files（行数、大小、sha256）。
+//
+// 归档和删除在同一个事务里：COPY (DELETE ... RETURNING ...) TO STDOUT 直接写进文件，
+// 分区表则是 COPY 整个月份分区再 DROP 掉它；文件落盘（fsync + 改名）之后才提交删除，
+// 任何一步失败都回滚，库里的数据不动。
+// ============================================================
+
+// archivePath 归档文件路径。同一个月装回后再次过期会生成新文件，按归档时间区分。
+func archivePath(dir, table string, month, at time.Time) string {
+	return filepath.Join(dir, table, fmt.Sprintf("%s_%s.csv.gz", month.Format("2006-01"), at.Format("20060102T150405")))
+}
+
+// tableColumns 表的列（按定义顺序，不含自增 id）。
+func tableColumns(ctx context.Context, table string) ([]string, error) {
+	var cols []string
+	err := config.DB.WithContext(ctx).Raw(`SELECT column_name FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = ? AND column_name <> 'id'
+		ORDER BY ordinal_position`, table).Scan(&cols).Error
+	if err == nil && len(cols) == 0 {
+		err = fmt.Errorf("表 %s 不存在", table)
+	}
+	return cols, err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// archiveMonth 把一张表某个月的行写进归档文件并删除。该月已经没有行时不留文件，返回零值。
+// partition 不为空时该月是分区表的一个分区，归档后整个分区删掉。
+func archiveMonth(ctx context.Context, p RetentionPolicy, month time.Time, partition string) (models.ArchiveFile, error) {
+	cols, err := tableColumns(ctx, p.Table)
+	if err != nil {
+		return models.ArchiveFile{}, err
+	}
+	now := time.Now()
+	af := models.ArchiveFile{Table: p.Table, Month: month, Path: archivePath(ArchiveDir(), p.Table, month, now), CreatedAt: now}
+	if err := os.MkdirAll(filepath.Dir(af.Path), 0o755); err != nil {
+		return models.ArchiveFile{}, err
+	}
+	tmp := af.Path + ".tmp"
+	defer os.Remove(tmp) //nolint:errcheck
+
+	err = withPgxTx(ctx, func(tx pgx.Tx) error {
+		f, err := os.Create(tmp)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		h := sha256.New()
+		cw := &countingWriter{w: io.MultiWriter(f, h)}
+		zw := gzip.NewWriter(cw)
+		query := fmt.Sprintf("DELETE FROM %s WHERE %s >= '%s' AND %s < '%s' RETURNING %s",
+			p.Table, p.DateCol, month.Format("2006-01-02"), p.DateCol, month.AddDate(0, 1, 0).Format("2006-01-02"),
+			strings.Join(cols, ", "))
+		if partition != "" {
+			query = fmt.Sprintf("SELECT %s FROM %s", strings.Join(cols, ", "), partition)
+		}
+		tag, err := tx.Conn().PgConn().CopyTo(ctx, zw, "COPY ("+query+") TO STDOUT WITH (FORMAT csv, HEADER true)")
+		if err != nil {
+			return fmt.Errorf("导出: %w", err)
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		if err := f.Sync(); err != nil {
+			return err
+		}
+		if af.Rows = tag.RowsAffected(); af.Rows == 0 {
+			return dropPartition(ctx, tx, partition)
+		}
+		af.Bytes, af.SHA256 = cw.n, hex.EncodeToString(h.Sum(nil))
+		if err := os.Rename(tmp, af.Path); err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, `INSERT INTO archive_files (table_name, month, path, rows, bytes, sha256, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)`, af.Table, af.Month, af.Path, af.Rows, af.Bytes, af.SHA256, af.CreatedAt)
+		if err != nil {
+			return err
+		}
+		return dropPartition(ctx, tx, partition)
+	})
+	if partition != "" {
+		forgetPartition(partition)
+	}
+	if err != nil {
+		// 已改名的文件不删：提交失败时无法确定删除是否已生效，留一份多余的总比丢数据好
+		return models.ArchiveFile{}, err
+	}
+	if af.Rows == 0 {
+		return models.ArchiveFile{}, nil
+	}
+	return af, nil
+}
+
+// dropPartition 删掉已归档的分区，partition 为空时什么也不做。
+func dropPartition(ctx context.Context, tx pgx.Tx, partition string) error {
+	if partition == "" {
+		return nil
+	}
+	_, err := tx.Exec(ctx, "DROP TABLE "+partition)
+	return err
+}
+
+// ArchivedFiles 某张表覆盖 [from, to] 的归档文件，按月份、归档时间排序。
+func ArchivedFiles(table string, from, to time.Time) ([]models.ArchiveFile, error) {
+	first := time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, from.Location())
+	var files []models.ArchiveFile
+	err := config.DB.Where("table_name = ? AND month >= ? AND month <= ?",
+		table, first.Format("2006-01-02"), to.Format("2006-01-02")).
+		Order("month, created_at").Find(&files).Error
+	return files, err
+}
+
+// ListArchiveFiles 归档文件目录（table 为空时列全部），新的在前。
+func ListArchiveFiles(table string, page, pageSize int) ([]models.ArchiveFile, int64, error) {
+	q := config.DB.Model(&models.ArchiveFile{})
+	if table != "" {
+		q = q.Where("table_name = ?", table)
+	}
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var files []models.ArchiveFile
+	err := q.Order("month DESC, created_at DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&files).Error
+	return files, total, err
+}
+
+// HoldRetention 登记保留区间：hold_until 之前裁剪任务跳过和 [from, to] 有交集的月份。
+func HoldRetention(table string, from, to, until time.Time) error {
+	return config.DB.Create(&models.RetentionHold{Table: table, FromDate: from, ToDate: to, HoldUntil: until}).Error
+}
+
+// ActiveRetentionHolds 还没到期的保留区间。
+func ActiveRetentionHolds() ([]models.RetentionHold, error) {
+	var holds []models.RetentionHold
+	err := config.DB.Where("hold_until > ?", time.Now()).Order("table_name, from_date").Find(&holds).Error
+	return holds, err
+}
+
+// RestoreResult 装回一个归档文件的结果。
+type RestoreResult struct {
+	Rows    int64
+	Symbols map[string]time.Time // 装回了数据的股票 → 装回的最早日期
+}
+
+// RestoreArchiveFile 把归档文件里 [from, to] 之间的行合并回 table（业务键冲突时以文件为准）。
+func RestoreArchiveFile(ctx context.Context, table, path string, from, to time.Time) (RestoreResult, error) {
+	res := RestoreResult{Symbols: map[string]time.Time{}}
+	p, ok := RetentionPolicyFor(table)
+	if !ok {
+		return res, fmt.Errorf("不支持的表 %s", table)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return res, err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return res, fmt.Errorf("%s: %w", path, err)
+	}
+	defer zr.Close()
+	br := bufio.NewReader(zr)
+	line, err := br.ReadString('\n')
+	if err != nil {
+		return res, fmt.Errorf("%s: 读表头: %w", path, err)
+	}
+	header, err := csv.NewReader(strings.NewReader(line)).Read()
+	if err != nil {
+		return res, fmt.Errorf("%s: 表头: %w", path, err)
+	}
+	cols, err := tableColumns(ctx, table)
+	if err != nil {
+		return res, err
+	}
+	for _, h := range header {
+		if !slices.Contains(cols, h) {
+			return res, fmt.Errorf("%s: 列 %s 在 %s 里已不存在", path, h, table)
+		}
+	}
+	for _, k := range append([]string{p.DateCol}, p.keys...) {
+		if !slices.Contains(header, k) {
+			return res, fmt.Errorf("%s: 缺少列 %s", path, k)
+		}
+	}
+
+	colList := strings.Join(header, ", ")
+	var update []string
+	for _, h := range header {
+		if !slices.Contains(p.keys, h) {
+			update = append(update, h+" = EXCLUDED."+h)
+		}
+	}
+	action := "DO NOTHING"
+	if len(update) > 0 {
+		action = "DO UPDATE SET " + strings.Join(update, ", ")
+	}
+	err = withPgxTx(ctx, func(tx pgx.Tx) error {
+		tmp := "tmp_restore_" + table
+		if _, err := tx.Exec(ctx, fmt.Sprintf(
+			"CREATE TEMP TABLE %s ON COMMIT DROP AS SELECT %s FROM %s WITH NO DATA", tmp, colList, table)); err != nil {
+			return fmt.Errorf("创建临时表: %w", err)
+		}
+		if _, err := tx.Conn().PgConn().CopyFrom(ctx, br,
+			fmt.Sprintf("COPY %s (%s) FROM STDIN WITH (FORMAT csv)", tmp, colList)); err != nil {
+			return fmt.Errorf("COPY %s: %w", path, err)
+		}
+		tag, err := tx.Exec(ctx, fmt.Sprintf(
+			"INSERT INTO %s (%s) SELECT %s FROM %s WHERE %s BETWEEN $1 AND $2 ON CONFLICT (%s) %s",
+			table, colList, colList, tmp, p.DateCol, strings.Join(p.keys, ", "), action), from, to)
+		if err != nil {
+			return fmt.Errorf("合并 %s: %w", table, err)
+		}
+		res.Rows = tag.RowsAffected()
+		rows, err := tx.Query(ctx, fmt.Sprintf(
+			"SELECT symbol, MIN(%s)::timestamp FROM %s WHERE %s BETWEEN $1 AND $2 GROUP BY symbol", p.DateCol, tmp, p.DateCol), from, to)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var sym string
+			var first time.Time
+			if err := rows.Scan(&sym, &first); err != nil {
+				return err
+			}
+			res.Symbols[sym] = first
+		}
+		return rows.Err()
+	})
+	return res, err
+}
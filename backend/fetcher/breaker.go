@@ -0,0 +1,90 @@
+package fetcher
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen 数据源熔断中，故障转移链直接跳到下一个。
+var ErrCircuitOpen = errors.New("fetcher: circuit open")
+
+// 熔断器状态
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half_open"
+)
+
+// Breaker 连续失败 threshold 次后打开，cooldown 内拒绝所有请求；
+// 冷却结束进入半开，只放一个探测请求：成功则关闭，失败则再打开一轮。threshold <= 0 不熔断。
+type Breaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	state     string
+	failures  int
+	openedAt  time.Time
+	probing   bool
+	now       func() time.Time
+	onOpen    func()
+}
+
+// NewBreaker 初始为关闭状态。
+func NewBreaker(threshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{threshold: threshold, cooldown: cooldown, state: BreakerClosed, now: time.Now}
+}
+
+// Allow 请求前调用：熔断中返回 ErrCircuitOpen。
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return ErrCircuitOpen
+		}
+		b.state, b.probing = BreakerHalfOpen, true
+		return nil
+	case BreakerHalfOpen:
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// Success 请求成功：清零失败计数并关闭。
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state, b.failures, b.probing = BreakerClosed, 0, false
+}
+
+// Failure 请求失败：半开探测失败或连续失败达到阈值时打开。
+func (b *Breaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.state == BreakerHalfOpen || (b.threshold > 0 && b.failures >= b.threshold) {
+		if b.state != BreakerOpen && b.onOpen != nil {
+			b.onOpen()
+		}
+		b.state, b.openedAt, b.probing = BreakerOpen, b.now(), false
+	}
+}
+
+// Abort 请求没有结果（调用方取消）：不计成败，半开时让下一个请求继续探测。
+func (b *Breaker) Abort() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// State 当前状态（open 冷却结束但还没有请求进来时仍报 open）。
+func (b *Breaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
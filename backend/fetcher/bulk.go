@@ -0,0 +1,199 @@
+package fetcher
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+
+	"oh-my-stock/config"
+	"oh-my-stock/models"
+)
+
+// ============================================================
+// 批量入库：COPY 到临时表，再 INSERT ... SELECT ... ON CONFLICT 合并进正式表
+//
+// 历史导入动辄几百万行，逐批 INSERT 太慢。COPY 走 pgx 原生连接，同一事务内完成，
+// 失败整批回滚。update 只列出要覆盖的列：导入文件里没有的列不动库里已有的值。
+// 调用方保证同一批内业务键不重复（ON CONFLICT 不允许同一行更新两次）。
+// ============================================================
+
+// copyUpsert 把 rows（按 cols 顺序）合并进 table，冲突键 keys，冲突时覆盖 update 列。
+// existingOnly 只更新表里已有的行，不插入新行。
+func copyUpsert(ctx context.Context, table string, cols, keys, update []string, rows [][]interface{}, existingOnly bool) (int, error) {
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	var n int64
+	err := withPgxTx(ctx, func(tx pgx.Tx) error {
+		tmp := "tmp_import_" + table
+		colList := strings.Join(cols, ", ")
+		if _, err := tx.Exec(ctx, fmt.Sprintf(
+			"CREATE TEMP TABLE %s ON COMMIT DROP AS SELECT %s FROM %s WITH NO DATA", tmp, colList, table)); err != nil {
+			return fmt.Errorf("创建临时表: %w", err)
+		}
+		if _, err := tx.CopyFrom(ctx, pgx.Identifier{tmp}, cols, pgx.CopyFromRows(rows)); err != nil {
+			return fmt.Errorf("COPY %s: %w", table, err)
+		}
+		tag, err := tx.Exec(ctx, mergeSQL(table, tmp, cols, keys, update, existingOnly))
+		if err != nil {
+			return fmt.Errorf("合并 %s: %w", table, err)
+		}
+		n = tag.RowsAffected()
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int(n), nil
+}
+
+// mergeSQL 把临时表 tmp 合并进 table 的语句。update 为空时冲突行保持不变。
+func mergeSQL(table, tmp string, cols, keys, update []string, existingOnly bool) string {
+	colList := strings.Join(cols, ", ")
+	action := "DO NOTHING"
+	if len(update) > 0 {
+		sets := make([]string, len(update))
+		for i, c := range update {
+			sets[i] = c + " = EXCLUDED." + c
+		}
+		action = "DO UPDATE SET " + strings.Join(sets, ", ")
+	}
+	where := ""
+	if existingOnly {
+		on := make([]string, len(keys))
+		for i, k := range keys {
+			on[i] = fmt.Sprintf("t.%s = s.%s", k, k)
+		}
+		where = fmt.Sprintf(" s WHERE EXISTS (SELECT 1 FROM %s t WHERE %s)", table, strings.Join(on, " AND "))
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s%s ON CONFLICT (%s) %s",
+		table, colList, colList, tmp, where, strings.Join(keys, ", "), action)
+}
+
+// withPgxTx 在 pgx 原生连接上开事务执行 fn（COPY 要用原生连接），fn 返回 nil 时提交。
+func withPgxTx(ctx context.Context, fn func(tx pgx.Tx) error) error {
+	sqlDB, err := config.DB.DB()
+	if err != nil {
+		return err
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.Raw(func(dc interface{}) error {
+		sc, ok := dc.(*stdlib.Conn)
+		if !ok {
+			return fmt.Errorf("数据库驱动不支持 COPY（%T）", dc)
+		}
+		tx, err := sc.Conn().Begin(ctx)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback(ctx) //nolint:errcheck
+		if err := fn(tx); err != nil {
+			return err
+		}
+		return tx.Commit(ctx)
+	})
+}
+
+// DailyOptionalFields 日 K 里导入文件可能没有的列：没有时不覆盖库里已有的值。
+var DailyOptionalFields = []string{"turnover", "turnover_rate", "amplitude"}
+
+// dailyUpdateCols 日 K 冲突时覆盖的列：OHLCV 和（重算的）涨跌幅总是覆盖，可选列只覆盖 fields 里有的。
+func dailyUpdateCols(fields []string) []string {
+	update := []string{"open", "high", "low", "close", "volume", "change_percent", "change_amount"}
+	for _, c := range DailyOptionalFields {
+		if slices.Contains(fields, c) {
+			update = append(update, c)
+		}
+	}
+	return update
+}
+
+// BulkUpsertDaily 日 K 批量 upsert（COPY），字段与 UpsertDaily 一致。
+// fields 是来源里实际有的可选列（DailyOptionalFields 的子集），新行照常写入全部列。
+func BulkUpsertDaily(ctx context.Context, rows []models.StockDailyData, fields []string) (int, error) {
+	cols := []string{"symbol", "trade_date", "open", "high", "low", "close", "volume", "turnover",
+		"change_percent", "change_amount", "turnover_rate", "amplitude"}
+	vals := make([][]interface{}, len(rows))
+	for i, r := range rows {
+		vals[i] = []interface{}{r.Symbol, r.TradeDate, r.Open, r.High, r.Low, r.Close, r.Volume, r.Turnover,
+			r.ChangePercent, r.ChangeAmount, r.TurnoverRate, r.Amplitude}
+	}
+	return copyUpsert(ctx, "stock_daily_data", cols, []string{"symbol", "trade_date"}, dailyUpdateCols(fields), vals, false)
+}
+
+// BulkUpsertMoneyFlow 资金流批量 upsert，只覆盖 fields 里的列（列名同 stock_money_flow）。
+func BulkUpsertMoneyFlow(ctx context.Context, rows []models.StockMoneyFlow, fields []string) (int, error) {
+	all := map[string]func(r models.StockMoneyFlow) interface{}{
+		"main_net":           func(r models.StockMoneyFlow) interface{} { return r.MainNet },
+		"retail_net":         func(r models.StockMoneyFlow) interface{} { return r.RetailNet },
+		"large_order_ratio":  func(r models.StockMoneyFlow) interface{} { return r.LargeOrderRatio },
+		"medium_order_ratio": func(r models.StockMoneyFlow) interface{} { return r.MediumOrderRatio },
+		"small_order_ratio":  func(r models.StockMoneyFlow) interface{} { return r.SmallOrderRatio },
+	}
+	cols := []string{"symbol", "trade_date"}
+	for _, f := range fields {
+		if _, ok := all[f]; ok {
+			cols = append(cols, f)
+		}
+	}
+	vals := make([][]interface{}, len(rows))
+	for i, r := range rows {
+		v := []interface{}{r.Symbol, r.TradeDate}
+		for _, c := range cols[2:] {
+			v = append(v, all[c](r))
+		}
+		vals[i] = v
+	}
+	return copyUpsert(ctx, "stock_money_flow", cols, []string{"symbol", "trade_date"}, cols[2:], vals, false)
+}
+
+// BulkUpsertBasicInfo 股票资料批量 upsert，只覆盖 fields 里的列（列名同 stock_basic_info）。
+// fields 里没有 name 时只补已有的股票（新股票入库必须有名称）。
+func BulkUpsertBasicInfo(ctx context.Context, rows []models.StockBasicInfo, fields []string) (int, error) {
+	all := map[string]func(r models.StockBasicInfo) interface{}{
+		"name":               func(r models.StockBasicInfo) interface{} { return r.Name },
+		"full_name":          func(r models.StockBasicInfo) interface{} { return r.FullName },
+		"industry":           func(r models.StockBasicInfo) interface{} { return r.Industry },
+		"area":               func(r models.StockBasicInfo) interface{} { return r.Area },
+		"market":             func(r models.StockBasicInfo) interface{} { return r.Market },
+		"listing_date":       func(r models.StockBasicInfo) interface{} { return r.ListingDate },
+		"outstanding_shares": func(r models.StockBasicInfo) interface{} { return r.OutstandingShares },
+		"total_shares":       func(r models.StockBasicInfo) interface{} { return r.TotalShares },
+		"status":             func(r models.StockBasicInfo) interface{} { return r.Status },
+	}
+	cols := []string{"symbol"}
+	for _, f := range fields {
+		if _, ok := all[f]; ok {
+			cols = append(cols, f)
+		}
+	}
+	existingOnly := !slices.Contains(cols, "name")
+	now := time.Now()
+	cols = append(cols, "updated_at")
+	vals := make([][]interface{}, len(rows))
+	for i, r := range rows {
+		v := []interface{}{r.Symbol}
+		for _, c := range cols[1 : len(cols)-1] {
+			v = append(v, all[c](r))
+		}
+		vals[i] = append(v, now)
+	}
+	return copyUpsert(ctx, "stock_basic_info", cols, []string{"symbol"}, cols[1:], vals, existingOnly)
+}
+
+// MarkFilledBetween 导入补上的缺失日（stock_daily_missing 中 [from, to] 内、日 K 已有的）标成 filled。
+func MarkFilledBetween(symbol string, from, to time.Time) error {
+	return config.DB.Exec(`UPDATE stock_daily_missing m SET status = ?, last_error = '', updated_at = NOW()
+		WHERE m.symbol = ? AND m.trade_date BETWEEN ? AND ? AND m.status <> ?
+		  AND EXISTS (SELECT 1 FROM stock_daily_data d WHERE d.symbol = m.symbol AND d.trade_date = m.trade_date)`,
+		models.MissingFilled, symbol, from.Format("2006-01-02"), to.Format("2006-01-02"), models.MissingFilled).Error
+}
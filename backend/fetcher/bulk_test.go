@@ -0,0 +1,40 @@
+package fetcher
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDailyUpdateCols(t *testing.T) {
+	// 只有 OHLCV 的导入文件：重导已有的完整日 K 时成交额、换手率、振幅保持原值
+	stmt := mergeSQL("stock_daily_data", "tmp", []string{"symbol", "trade_date", "open", "turnover"},
+		[]string{"symbol", "trade_date"}, dailyUpdateCols(nil), false)
+	for _, c := range DailyOptionalFields {
+		if strings.Contains(stmt, c+" = EXCLUDED."+c) {
+			t.Fatalf("没有 %s 列时不应覆盖: %s", c, stmt)
+		}
+	}
+	for _, c := range []string{"open", "close", "volume", "change_percent"} {
+		if !strings.Contains(stmt, c+" = EXCLUDED."+c) {
+			t.Fatalf("%s 应覆盖: %s", c, stmt)
+		}
+	}
+
+	update := dailyUpdateCols([]string{"turnover"})
+	if !strings.Contains(strings.Join(update, ","), "turnover") || strings.Contains(strings.Join(update, ","), "turnover_rate") {
+		t.Fatalf("update = %v", update)
+	}
+}
+
+func TestMergeSQL(t *testing.T) {
+	got := mergeSQL("stock_basic_info", "tmp", []string{"symbol", "industry"}, []string{"symbol"}, []string{"industry"}, true)
+	want := "INSERT INTO stock_basic_info (symbol, industry) SELECT symbol, industry FROM tmp s " +
+		"WHERE EXISTS (SELECT 1 FROM stock_basic_info t WHERE t.symbol = s.symbol) " +
+		"ON CONFLICT (symbol) DO UPDATE SET industry = EXCLUDED.industry"
+	if got != want {
+		t.Fatalf("got  %s\nwant %s", got, want)
+	}
+	if got := mergeSQL("t", "tmp", []string{"a"}, []string{"a"}, nil, false); !strings.HasSuffix(got, "DO NOTHING") {
+		t.Fatalf("没有 update 列时应 DO NOTHING: %s", got)
+	}
+}
@@ -2,9 +2,11 @@ package fetcher
 
 import (
 	"context"
-	"log"
 	"strings"
 	"time"
+
+	"oh-my-stock/indicators"
+	"oh-my-stock/models"
 )
 
 // MarketFromSymbol 根据 6 位代码判断上交所/深交所/北交所前缀
@@ -19,24 +21,12 @@ func MarketFromSymbol(code string) string {
 	}
 }
 
-// FetchRecentDaily 拉取某只股票最近 days 天的日 K 线（不前复权）。
-// 调用方负责写入 DB：返回值即原始 K 线。
+// FetchRecentDaily 从当前数据源拉取某只股票最近 days 天的日 K 线（不复权）。
+// 调用方负责写入 DB：返回值即原始 K 线。重试、限流、熔断由数据源外层的 Guard 负责。
 func FetchRecentDaily(ctx context.Context, rawSymbol string, days int) ([]SinaDaily, error) {
-	sym := strings.ToLower(MarketFromSymbol(rawSymbol) + rawSymbol)
 	ctx, cancel := context.WithTimeout(ctx, 20*time.Second)
 	defer cancel()
-
-	var lastErr error
-	for attempt := 0; attempt < 2; attempt++ {
-		rows, err := FetchSinaDaily(ctx, sym, days)
-		if err == nil {
-			return rows, nil
-		}
-		lastErr = err
-		log.Printf("⚠️ sina 重试第 %d 次 %s: %v", attempt+1, rawSymbol, err)
-		time.Sleep(500 * time.Millisecond)
-	}
-	return nil, lastErr
+	return Active().Daily(ctx, rawSymbol, days)
 }
 
 // Round4 四舍五入到 4 位小数（保留财务字段精度）。
@@ -44,3 +34,8 @@ func FetchRecentDaily(ctx context.Context, rawSymbol string, days int) ([]SinaDa
 func Round4(v float64) float64 {
 	return float64(int64(v*10000+0.5)) / 10000
 }
+
+// ComputeIndicators 基于日 K 计算技术指标（实现见 indicators 包）。
+func ComputeIndicators(symbol string, rows []models.StockDailyData) []models.StockIndicator {
+	return indicators.Compute(symbol, rows)
+}
@@ -0,0 +1,211 @@
+package fetcher
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"math"
+
+	"gorm.io/gorm/clause"
+
+	"oh-my-stock/adjust"
+	"oh-my-stock/config"
+	"oh-my-stock/formula"
+	"oh-my-stock/indicators"
+	"oh-my-stock/models"
+)
+
+// FormulaBars 公式求值的固定窗口：最近这么多根 K 线。规则取值（RefreshFormulaValues、MaterializeFormula）
+// 和历史叠加都从同一根 K 线开始求值，EMA、BARSLAST 这类与起点有关的函数两边结果一致；
+// 2*MaxPeriod 够 MA(MA(C,250),250) 这样嵌套一层的长周期出值。
+const FormulaBars = 2 * formula.MaxPeriod
+
+// LoadDailyAsc 读取某只股票最近 n 根日 K，按日期升序，并换算成 m 复权价。
+func LoadDailyAsc(symbol string, n int, m adjust.Mode) ([]models.StockDailyData, error) {
+	var rows []models.StockDailyData
+	if err := config.DB.Where("symbol = ?", symbol).
+		Order("trade_date DESC").Limit(n).Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("读取日 K 失败: %w", err)
+	}
+	for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+		rows[i], rows[j] = rows[j], rows[i]
+	}
+	return AdjustDaily(symbol, rows, m)
+}
+
+// EvalFormula 对升序日 K 求值公式。
+func EvalFormula(p *formula.Program, rows []models.StockDailyData) []formula.Line {
+	return p.Eval(formula.FromBars(indicators.ToBars(rows)))
+}
+
+// FormulaSet 一轮抓取/重算共用的已编译公式：整轮只读库、编译一次，再传给每只股票。
+// Program 求值不改内部状态，可被多个 worker 并发使用。
+type FormulaSet struct {
+	items []compiledFormula
+}
+
+type compiledFormula struct {
+	f models.UserFormula
+	p *formula.Program
+}
+
+// LoadFormulaSet 读取并编译全部用户公式。
+// 单个公式编译失败（理论上保存时已校验）只记日志并跳过，不影响其他公式。
+func LoadFormulaSet() (*FormulaSet, error) {
+	var fs []models.UserFormula
+	if err := config.DB.Find(&fs).Error; err != nil {
+		return nil, fmt.Errorf("读取公式失败: %w", err)
+	}
+	set := &FormulaSet{items: make([]compiledFormula, 0, len(fs))}
+	for _, f := range fs {
+		p, err := formula.Compile(f.Source)
+		if err != nil {
+			log.Printf("⚠️ 公式 %d(%s) 编译失败: %v", f.ID, f.Name, err)
+			continue
+		}
+		set.items = append(set.items, compiledFormula{f: f, p: p})
+	}
+	return set, nil
+}
+
+// Len 已编译的公式条数；nil 视为空集。
+func (s *FormulaSet) Len() int {
+	if s == nil {
+		return 0
+	}
+	return len(s.items)
+}
+
+// stale 输入 K 线指纹与上次求值时（have: formula_id → input_hash）不同或从未求值过的公式。
+func (s *FormulaSet) stale(have map[uint]int64, h int64) []compiledFormula {
+	var out []compiledFormula
+	for _, c := range s.items {
+		if old, ok := have[c.f.ID]; !ok || old != h {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// barsHash 公式输入 K 线（已复权）的指纹：日期 + OHLCV + 成交额，任一根变化指纹即变。
+func barsHash(rows []models.StockDailyData) int64 {
+	h := fnv.New64a()
+	var buf [8]byte
+	put := func(v uint64) {
+		binary.LittleEndian.PutUint64(buf[:], v)
+		h.Write(buf[:])
+	}
+	for _, r := range rows {
+		put(uint64(r.TradeDate.Unix()))
+		for _, v := range []float64{r.Open, r.High, r.Low, r.Close, r.Turnover} {
+			put(math.Float64bits(v))
+		}
+		put(uint64(r.Volume))
+	}
+	return int64(h.Sum64())
+}
+
+// latestFormulaValues 取每条输出线在最后一根 K 线上的值；h 为输入 K 线指纹。
+func latestFormulaValues(f models.UserFormula, p *formula.Program, rows []models.StockDailyData, h int64) []models.UserFormulaValue {
+	if len(rows) == 0 {
+		return nil
+	}
+	last := rows[len(rows)-1]
+	lines := EvalFormula(p, rows)
+	out := make([]models.UserFormulaValue, 0, len(lines))
+	for _, l := range lines {
+		v := models.UserFormulaValue{
+			FormulaID: f.ID,
+			Symbol:    last.Symbol,
+			Output:    l.Name,
+			TradeDate: last.TradeDate,
+			InputHash: h,
+		}
+		if x := l.Values[len(l.Values)-1]; !math.IsNaN(x) && !math.IsInf(x, 0) {
+			v.Value = &x
+		}
+		out = append(out, v)
+	}
+	return out
+}
+
+func upsertFormulaValues(vals []models.UserFormulaValue) (int, error) {
+	if len(vals) == 0 {
+		return 0, nil
+	}
+	err := config.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "formula_id"}, {Name: "symbol"}, {Name: "output"}},
+		UpdateAll: true,
+	}).CreateInBatches(vals, 500).Error
+	if err != nil {
+		return 0, err
+	}
+	return len(vals), nil
+}
+
+// RefreshFormulaValues 抓到新日 K 后，重算该股票最新交易日的公式取值（前复权价）。
+// set 由调用方每轮 LoadFormulaSet 一次；只重算输入 K 线指纹变了的公式
+// （新 K 线、盘中最后一根变化、复权或历史修正），输入没变的公式沿用已存的值。
+func RefreshFormulaValues(set *FormulaSet, symbol string) (int, error) {
+	if set.Len() == 0 {
+		return 0, nil
+	}
+	rows, err := LoadDailyAsc(symbol, FormulaBars, adjust.QFQ)
+	if err != nil {
+		return 0, err
+	}
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	var prev []models.UserFormulaValue
+	if err := config.DB.Select("formula_id", "input_hash").
+		Where("symbol = ?", symbol).Find(&prev).Error; err != nil {
+		return 0, fmt.Errorf("读取公式取值失败: %w", err)
+	}
+	have := make(map[uint]int64, len(prev))
+	for _, v := range prev {
+		have[v.FormulaID] = v.InputHash
+	}
+	h := barsHash(rows)
+	var vals []models.UserFormulaValue
+	for _, c := range set.stale(have, h) {
+		vals = append(vals, latestFormulaValues(c.f, c.p, rows, h)...)
+	}
+	return upsertFormulaValues(vals)
+}
+
+// MaterializeFormula 公式新建/修改后，对全部股票重算它的最新取值。
+// 先清掉旧值：修改后输出线可能改名或减少。
+func MaterializeFormula(f models.UserFormula) (int, error) {
+	p, err := formula.Compile(f.Source)
+	if err != nil {
+		return 0, err
+	}
+	if err := config.DB.Where("formula_id = ?", f.ID).Delete(&models.UserFormulaValue{}).Error; err != nil {
+		return 0, err
+	}
+	var symbols []string
+	if err := config.DB.Model(&models.StockBasicInfo{}).Pluck("symbol", &symbols).Error; err != nil {
+		return 0, err
+	}
+	total := 0
+	var batch []models.UserFormulaValue
+	for _, sym := range symbols {
+		rows, err := LoadDailyAsc(sym, FormulaBars, adjust.QFQ)
+		if err != nil {
+			return total, err
+		}
+		batch = append(batch, latestFormulaValues(f, p, rows, barsHash(rows))...)
+		if len(batch) >= 500 {
+			n, err := upsertFormulaValues(batch)
+			if err != nil {
+				return total, err
+			}
+			total += n
+			batch = batch[:0]
+		}
+	}
+	n, err := upsertFormulaValues(batch)
+	return total + n, err
+}
@@ -0,0 +1,91 @@
+package fetcher
+
+import (
+	"testing"
+	"time"
+
+	"oh-my-stock/formula"
+	"oh-my-stock/models"
+)
+
+func formulaBars(n int) []models.StockDailyData {
+	base := time.Date(2024, 6, 3, 0, 0, 0, 0, time.UTC)
+	rows := make([]models.StockDailyData, n)
+	for i := range rows {
+		p := 10 + float64(i)*0.1
+		rows[i] = models.StockDailyData{
+			Symbol: "600000", TradeDate: base.AddDate(0, 0, i),
+			Open: p, High: p + 0.2, Low: p - 0.2, Close: p, Volume: int64(1000 + i),
+		}
+	}
+	return rows
+}
+
+func TestBarsHash(t *testing.T) {
+	rows := formulaBars(30)
+	h := barsHash(rows)
+	if h != barsHash(formulaBars(30)) {
+		t.Fatal("相同 K 线指纹应一致")
+	}
+	changed := formulaBars(30)
+	changed[29].Close += 0.01 // 盘中最后一根变化
+	if barsHash(changed) == h {
+		t.Fatal("最后一根收盘价变化，指纹应变")
+	}
+	changed = formulaBars(30)
+	changed[3].Volume++ // 历史修正
+	if barsHash(changed) == h {
+		t.Fatal("历史成交量变化，指纹应变")
+	}
+	if barsHash(formulaBars(31)) == h {
+		t.Fatal("新增 K 线，指纹应变")
+	}
+}
+
+func TestFormulaSetStale(t *testing.T) {
+	p, err := formula.Compile("X: MA(CLOSE, 5);")
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := &FormulaSet{items: []compiledFormula{
+		{f: models.UserFormula{ID: 1}, p: p},
+		{f: models.UserFormula{ID: 2}, p: p},
+		{f: models.UserFormula{ID: 3}, p: p},
+	}}
+	rows := formulaBars(30)
+	h := barsHash(rows)
+
+	// 1 输入没变，2 上次输入不同，3 从未求值
+	got := set.stale(map[uint]int64{1: h, 2: h + 1}, h)
+	if len(got) != 2 || got[0].f.ID != 2 || got[1].f.ID != 3 {
+		t.Fatalf("stale = %+v", got)
+	}
+	if got := set.stale(map[uint]int64{1: h, 2: h, 3: h}, h); len(got) != 0 {
+		t.Fatalf("输入都没变，不应重算: %d", len(got))
+	}
+
+	vals := latestFormulaValues(set.items[0].f, p, rows, h)
+	if len(vals) != 1 || vals[0].InputHash != h || vals[0].Value == nil || !vals[0].TradeDate.Equal(rows[29].TradeDate) {
+		t.Fatalf("vals = %+v", vals)
+	}
+	var nilSet *FormulaSet
+	if nilSet.Len() != 0 {
+		t.Fatal("nil 公式集应视为空")
+	}
+}
+
+// 规则取值窗口（FormulaBars）里最长周期嵌套一层也要出值；周期超过上限的公式编译期就报错，不会静默全为 NULL。
+func TestFormulaBars_CoversMaxPeriod(t *testing.T) {
+	p, err := formula.Compile("X:MA(MA(C,250),250);")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := models.UserFormula{ID: 1}
+	vals := latestFormulaValues(f, p, formulaBars(FormulaBars), 0)
+	if len(vals) != 1 || vals[0].Value == nil {
+		t.Fatalf("vals = %+v，窗口内应有值", vals)
+	}
+	if _, err := formula.Compile("X:MA(C,260);"); err == nil {
+		t.Fatal("超过 MaxPeriod 的周期应编译失败")
+	}
+}
@@ -0,0 +1,438 @@
+package fetcher
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"oh-my-stock/calendar"
+	"oh-my-stock/config"
+	"oh-my-stock/models"
+)
+
+// ============================================================
+// 日 K 完整性和缺口补抓
+//
+// 每只股票应有的交易日：上市日和日 K 保留窗口起点取较晚者，到最近一个已收盘交易日，按交易日历展开。
+// 和已入库的日期对比得出缺口。增量抓取只拉最近 7 天，更早的缺口不会自己消失，
+// 会让 LAG / REF 类规则取错前值；Backfill 只补缺的那几天，每一天的结果记在 stock_daily_missing。
+// ============================================================
+
+// BackfillMaxAttempts 同一天补抓这么多次上游都没有数据，就标成 unavailable（多半是停牌），不再自动补。
+const BackfillMaxAttempts = 3
+
+// Gap 一段连续缺失的交易日。
+type Gap struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	Days  int       `json:"days"`
+}
+
+// FindGaps expected（升序交易日）里不在 present（键为 2006-01-02）中的日子，按连续段合并。
+func FindGaps(expected []time.Time, present map[string]bool) []Gap {
+	var out []Gap
+	var cur *Gap
+	for _, d := range expected {
+		if present[d.Format("2006-01-02")] {
+			cur = nil
+			continue
+		}
+		if cur == nil {
+			out = append(out, Gap{Start: d})
+			cur = &out[len(out)-1]
+		}
+		cur.End = d
+		cur.Days++
+	}
+	return out
+}
+
+// Completeness 单只股票在覆盖区间 [From, To] 内的日 K 完整性。
+type Completeness struct {
+	Symbol      string    `json:"symbol"`
+	Name        string    `json:"name"`
+	From        time.Time `json:"from"`
+	To          time.Time `json:"to"`
+	Expected    int       `json:"expected"`
+	Present     int       `json:"present"`
+	Missing     int       `json:"missing"`
+	Quarantined int       `json:"quarantined"` // 缺失中补抓到了但在隔离区待复核的
+	Unavailable int       `json:"unavailable"` // 缺失中已确认上游没有的
+}
+
+// Pending 还需要补抓的天数。
+func (c Completeness) Pending() int { return c.Missing - c.Quarantined - c.Unavailable }
+
+// coverageWindow 完整性检查的区间：最近 CoverageDays 个已收盘交易日。
+func coverageWindow(now time.Time) (from, to time.Time) {
+	return RetentionCutoff(now, CoverageDays), calendar.LatestSettled(now)
+}
+
+// coverageFrom 单只股票的起点：上市日晚于窗口起点时从上市日算；上市日未知时从第一根已入库 K 线算，
+// 避免把资料不全的新股当成缺了整个窗口。
+func coverageFrom(start time.Time, listing *time.Time, first *time.Time) time.Time {
+	switch {
+	case listing != nil:
+		if calendar.Date(*listing).After(start) {
+			return calendar.Date(*listing)
+		}
+	case first != nil:
+		if calendar.Date(*first).After(start) {
+			return calendar.Date(*first)
+		}
+	}
+	return start
+}
+
+// CompletenessReport 全部股票的完整性，按代码排序；onlyIncomplete 只返回有缺失的。
+func CompletenessReport(onlyIncomplete bool) ([]Completeness, error) {
+	start, end := coverageWindow(time.Now())
+	var basics []models.StockBasicInfo
+	if err := config.DB.Select("symbol", "name", "listing_date").Order("symbol").Find(&basics).Error; err != nil {
+		return nil, fmt.Errorf("读取股票列表: %w", err)
+	}
+	var present []struct {
+		Symbol string
+		N      int
+		First  time.Time
+	}
+	if err := config.DB.Model(&models.StockDailyData{}).
+		Select("symbol, COUNT(*) AS n, MIN(trade_date) AS first").
+		Where("trade_date BETWEEN ? AND ?", start.Format("2006-01-02"), end.Format("2006-01-02")).
+		Group("symbol").Scan(&present).Error; err != nil {
+		return nil, fmt.Errorf("统计日 K: %w", err)
+	}
+	var marks []struct {
+		Symbol string
+		Status string
+		N      int
+	}
+	if err := config.DB.Model(&models.StockDailyMissing{}).
+		Select("symbol, status, COUNT(*) AS n").
+		Where("trade_date BETWEEN ? AND ? AND status IN ?", start.Format("2006-01-02"), end.Format("2006-01-02"),
+			[]string{models.MissingQuarantined, models.MissingUnavailable}).
+		Group("symbol, status").Scan(&marks).Error; err != nil {
+		return nil, fmt.Errorf("统计补抓记录: %w", err)
+	}
+
+	type have struct {
+		n     int
+		first *time.Time
+	}
+	bySym := make(map[string]have, len(present))
+	for _, p := range present {
+		f := p.First
+		bySym[p.Symbol] = have{n: p.N, first: &f}
+	}
+	out := make([]Completeness, 0, len(basics))
+	idx := make(map[string]int, len(basics))
+	for _, b := range basics {
+		h := bySym[b.Symbol]
+		c := Completeness{Symbol: b.Symbol, Name: b.Name, To: end, Present: h.n}
+		c.From = coverageFrom(start, b.ListingDate, h.first)
+		c.Expected = calendar.TradingDaysBetween(c.From, end)
+		if c.Missing = c.Expected - c.Present; c.Missing < 0 {
+			c.Missing = 0
+		}
+		idx[b.Symbol] = len(out)
+		out = append(out, c)
+	}
+	for _, m := range marks {
+		i, ok := idx[m.Symbol]
+		if !ok {
+			continue
+		}
+		if m.Status == models.MissingQuarantined {
+			out[i].Quarantined = m.N
+		} else {
+			out[i].Unavailable = m.N
+		}
+	}
+	if onlyIncomplete {
+		kept := out[:0]
+		for _, c := range out {
+			if c.Missing > 0 {
+				kept = append(kept, c)
+			}
+		}
+		out = kept
+	}
+	return out, nil
+}
+
+// IncompleteSymbols 还有需要补抓的缺口的股票。
+func IncompleteSymbols() ([]string, error) {
+	rep, err := CompletenessReport(true)
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, c := range rep {
+		if c.Pending() > 0 {
+			out = append(out, c.Symbol)
+		}
+	}
+	return out, nil
+}
+
+// symbolCoverage 单只股票的应有交易日、已有日期和缺失日的补抓记录。
+func symbolCoverage(symbol string) (Completeness, []time.Time, map[string]bool, map[string]models.StockDailyMissing, error) {
+	start, end := coverageWindow(time.Now())
+	c := Completeness{Symbol: symbol, To: end}
+	var basic models.StockBasicInfo
+	if err := config.DB.Select("symbol", "name", "listing_date").Where("symbol = ?", symbol).Limit(1).Find(&basic).Error; err != nil {
+		return c, nil, nil, nil, fmt.Errorf("读取股票资料: %w", err)
+	}
+	c.Name = basic.Name
+	var dates []time.Time
+	if err := config.DB.Model(&models.StockDailyData{}).
+		Where("symbol = ? AND trade_date BETWEEN ? AND ?", symbol, start.Format("2006-01-02"), end.Format("2006-01-02")).
+		Order("trade_date").Pluck("trade_date", &dates).Error; err != nil {
+		return c, nil, nil, nil, fmt.Errorf("读取日 K 日期: %w", err)
+	}
+	if basic.Symbol == "" && len(dates) == 0 {
+		return c, nil, nil, nil, gorm.ErrRecordNotFound
+	}
+	var first *time.Time
+	if len(dates) > 0 {
+		first = &dates[0]
+	}
+	c.From = coverageFrom(start, basic.ListingDate, first)
+	expected := calendar.TradingDays(c.From, end)
+	present := make(map[string]bool, len(dates))
+	for _, d := range dates {
+		if !d.Before(c.From) {
+			present[d.Format("2006-01-02")] = true
+		}
+	}
+	var ms []models.StockDailyMissing
+	if err := config.DB.Where("symbol = ? AND trade_date BETWEEN ? AND ?", symbol, c.From.Format("2006-01-02"), end.Format("2006-01-02")).
+		Find(&ms).Error; err != nil {
+		return c, nil, nil, nil, fmt.Errorf("读取补抓记录: %w", err)
+	}
+	marks := make(map[string]models.StockDailyMissing, len(ms))
+	for _, m := range ms {
+		marks[m.TradeDate.Format("2006-01-02")] = m
+	}
+
+	c.Expected, c.Present = len(expected), len(present)
+	for _, d := range expected {
+		k := d.Format("2006-01-02")
+		if present[k] {
+			continue
+		}
+		c.Missing++
+		switch marks[k].Status {
+		case models.MissingQuarantined:
+			c.Quarantined++
+		case models.MissingUnavailable:
+			c.Unavailable++
+		}
+	}
+	return c, expected, present, marks, nil
+}
+
+// SymbolGaps 单只股票的完整性、缺口区间，以及缺失日的补抓记录。
+func SymbolGaps(symbol string) (Completeness, []Gap, []models.StockDailyMissing, error) {
+	c, expected, present, marks, err := symbolCoverage(symbol)
+	if err != nil {
+		return c, nil, nil, err
+	}
+	gaps := FindGaps(expected, present)
+	records := make([]models.StockDailyMissing, 0, len(marks))
+	for k, m := range marks {
+		if !present[k] || m.Status == models.MissingFilled {
+			records = append(records, m)
+		}
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].TradeDate.Before(records[j].TradeDate) })
+	return c, gaps, records, nil
+}
+
+// BackfillResult 一只股票一次补抓的结果（天数）。
+type BackfillResult struct {
+	Tried       int `json:"tried"`
+	Filled      int `json:"filled"`
+	Quarantined int `json:"quarantined"`
+	NoData      int `json:"no_data"`
+}
+
+// Backfill 补抓一只股票缺失的交易日：只写缺的那些天，已有的 K 线不动。
+// 数据源只提供"最近 N 天"，所以拉到最早缺口为止，再筛出缺失日期。
+// 已确认 unavailable 或在隔离区待复核的日子跳过。每一天的结果写 stock_daily_missing。
+// set 为本轮已编译的公式，补上 K 线后随 HistoryChanged 重算。
+func Backfill(ctx context.Context, symbol string, set *FormulaSet) (BackfillResult, error) {
+	var res BackfillResult
+	_, expected, present, marks, err := symbolCoverage(symbol)
+	if err != nil {
+		return res, err
+	}
+	var want []time.Time
+	for _, d := range expected {
+		k := d.Format("2006-01-02")
+		if present[k] {
+			continue
+		}
+		if s := marks[k].Status; s == models.MissingUnavailable || s == models.MissingQuarantined {
+			continue
+		}
+		want = append(want, d)
+	}
+	res.Tried = len(want)
+	if len(want) == 0 {
+		return res, nil
+	}
+
+	days := calendar.TradingDaysBetween(want[0], time.Now())
+	rows, ferr := FetchRecentDaily(ctx, symbol, days)
+	if ferr != nil {
+		// 上游出错不代表没有数据：只记次数，不标 unavailable
+		recs := make([]models.StockDailyMissing, 0, len(want))
+		for _, d := range want {
+			m := marks[d.Format("2006-01-02")]
+			recs = append(recs, models.StockDailyMissing{
+				Symbol: symbol, TradeDate: d, Status: models.MissingOpen,
+				Attempts: m.Attempts + 1, LastError: ferr.Error(),
+			})
+		}
+		if err := saveMissing(recs); err != nil {
+			log.Printf("⚠️ %s 记录补抓结果失败: %v", symbol, err)
+		}
+		return res, ferr
+	}
+
+	wantSet := make(map[string]bool, len(want))
+	for _, d := range want {
+		wantSet[d.Format("2006-01-02")] = true
+	}
+	var parsed []models.StockDailyData
+	for _, r := range rows {
+		if !wantSet[r.Day] {
+			continue
+		}
+		t, err := time.Parse("2006-01-02", r.Day)
+		if err != nil {
+			continue
+		}
+		parsed = append(parsed, models.StockDailyData{
+			Symbol: symbol, TradeDate: t,
+			Open: r.Open, High: r.High, Low: r.Low, Close: r.Close,
+			Volume: int64(r.Volume), Turnover: r.Turnover,
+		})
+	}
+	admitted, _, err := AdmitDaily(symbol, "backfill", parsed)
+	if err != nil {
+		return res, err
+	}
+	if _, err := UpsertDaily(admitted); err != nil {
+		return res, fmt.Errorf("写入日 K: %w", err)
+	}
+
+	got := make(map[string]bool, len(parsed))
+	for _, r := range parsed {
+		got[r.TradeDate.Format("2006-01-02")] = true
+	}
+	ok := make(map[string]bool, len(admitted))
+	for _, r := range admitted {
+		ok[r.TradeDate.Format("2006-01-02")] = true
+	}
+	recs := make([]models.StockDailyMissing, 0, len(want))
+	for _, d := range want {
+		k := d.Format("2006-01-02")
+		m := models.StockDailyMissing{Symbol: symbol, TradeDate: d, Attempts: marks[k].Attempts + 1}
+		switch {
+		case ok[k]:
+			m.Status = models.MissingFilled
+			res.Filled++
+		case got[k]:
+			m.Status, m.LastError = models.MissingQuarantined, "未通过数据质量校验，见隔离区"
+			res.Quarantined++
+		default:
+			m.Status, m.LastError = models.MissingOpen, "上游没有该日数据"
+			if m.Attempts >= BackfillMaxAttempts {
+				m.Status = models.MissingUnavailable
+			}
+			res.NoData++
+		}
+		recs = append(recs, m)
+	}
+	if err := saveMissing(recs); err != nil {
+		log.Printf("⚠️ %s 记录补抓结果失败: %v", symbol, err)
+	}
+	if len(admitted) > 0 {
+		HistoryChanged(symbol, admitted[0].TradeDate, set)
+	}
+	return res, nil
+}
+
+func saveMissing(recs []models.StockDailyMissing) error {
+	if len(recs) == 0 {
+		return nil
+	}
+	return config.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "symbol"}, {Name: "trade_date"}},
+		DoUpdates: clause.AssignmentColumns([]string{"status", "attempts", "last_error", "updated_at"}),
+	}).CreateInBatches(recs, 500).Error
+}
+
+// markFilled 缺失日通过其他途径（隔离区放行、导入）补上了。
+func markFilled(symbol string, day time.Time) error {
+	return config.DB.Model(&models.StockDailyMissing{}).
+		Where("symbol = ? AND trade_date = ?", symbol, day.Format("2006-01-02")).
+		Updates(map[string]interface{}{"status": models.MissingFilled, "last_error": "", "updated_at": time.Now()}).Error
+}
+
+// HistoryChanged 某只股票 from 起的历史中插入了 K 线：重算此后各根的涨跌幅，
+// 复权因子、技术指标（全量）和自定义公式（set，见 LoadFormulaSet）跟着重算。
+// 都是 best-effort，失败只打日志，下次抓取还会续上。
+func HistoryChanged(symbol string, from time.Time, set *FormulaSet) {
+	if err := recomputeChanges(symbol, from); err != nil {
+		log.Printf("⚠️ %s 重算涨跌幅失败: %v", symbol, err)
+	}
+	if _, err := RebuildAdjFactors(symbol); err != nil {
+		log.Printf("⚠️ %s 重建复权因子失败: %v", symbol, err)
+	}
+	if err := DeleteIndicatorState(symbol); err != nil {
+		log.Printf("⚠️ %s 清除指标续算状态失败: %v", symbol, err)
+	} else if _, err := RefreshIndicators(symbol); err != nil {
+		log.Printf("⚠️ %s 重算技术指标失败: %v", symbol, err)
+	}
+	if _, err := RefreshFormulaValues(set, symbol); err != nil {
+		log.Printf("⚠️ %s 计算自定义公式失败: %v", symbol, err)
+	}
+}
+
+// recomputeChanges 按前一根收盘价重算 from 及之后各根的涨跌额、涨跌幅，只写有变化的行。
+func recomputeChanges(symbol string, from time.Time) error {
+	var prev []models.StockDailyData
+	if err := config.DB.Where("symbol = ? AND trade_date < ?", symbol, from).
+		Order("trade_date DESC").Limit(1).Find(&prev).Error; err != nil {
+		return err
+	}
+	var rows []models.StockDailyData
+	if err := config.DB.Where("symbol = ? AND trade_date >= ?", symbol, from).
+		Order("trade_date").Find(&rows).Error; err != nil {
+		return err
+	}
+	prevClose := 0.0
+	if len(prev) > 0 {
+		prevClose = prev[0].Close
+	}
+	var changed []models.StockDailyData
+	for _, r := range rows {
+		amt, pct := r.ChangeAmount, r.ChangePercent
+		fillChange(&r, prevClose)
+		if r.ChangeAmount != amt || r.ChangePercent != pct {
+			r.ID = 0 // 按 (symbol, trade_date) upsert
+			changed = append(changed, r)
+		}
+		prevClose = r.Close
+	}
+	_, err := UpsertDaily(changed)
+	return err
+}
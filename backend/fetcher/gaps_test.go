@@ -0,0 +1,69 @@
+package fetcher
+
+import (
+	"testing"
+	"time"
+
+	"oh-my-stock/calendar"
+)
+
+func TestFindGaps(t *testing.T) {
+	// 2024-06-03 ~ 06-14，06-10 端午休市
+	from := time.Date(2024, 6, 3, 0, 0, 0, 0, calendar.Shanghai)
+	to := time.Date(2024, 6, 14, 0, 0, 0, 0, calendar.Shanghai)
+	expected := calendar.TradingDays(from, to)
+	if len(expected) != 9 {
+		t.Fatalf("expected %d trading days", len(expected))
+	}
+	present := map[string]bool{
+		"2024-06-03": true, "2024-06-04": true,
+		"2024-06-07": true, // 06-05、06-06 缺
+		"2024-06-12": true, // 06-11 缺（06-10 休市不算）
+	}
+	gaps := FindGaps(expected, present)
+	want := []struct {
+		start, end string
+		days       int
+	}{
+		{"2024-06-05", "2024-06-06", 2},
+		{"2024-06-11", "2024-06-11", 1},
+		{"2024-06-13", "2024-06-14", 2},
+	}
+	if len(gaps) != len(want) {
+		t.Fatalf("gaps = %+v", gaps)
+	}
+	for i, w := range want {
+		g := gaps[i]
+		if g.Start.Format("2006-01-02") != w.start || g.End.Format("2006-01-02") != w.end || g.Days != w.days {
+			t.Errorf("gap %d = %s~%s (%d), want %s~%s (%d)", i,
+				g.Start.Format("2006-01-02"), g.End.Format("2006-01-02"), g.Days, w.start, w.end, w.days)
+		}
+	}
+
+	all := map[string]bool{}
+	for _, d := range expected {
+		all[d.Format("2006-01-02")] = true
+	}
+	if gaps := FindGaps(expected, all); len(gaps) != 0 {
+		t.Errorf("complete series has gaps: %+v", gaps)
+	}
+}
+
+func TestCoverageFrom(t *testing.T) {
+	start := time.Date(2024, 1, 2, 0, 0, 0, 0, calendar.Shanghai)
+	early := time.Date(2010, 5, 6, 0, 0, 0, 0, time.UTC)
+	late := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	if got := coverageFrom(start, &early, nil); !got.Equal(start) {
+		t.Errorf("old listing: %v", got)
+	}
+	if got := coverageFrom(start, &late, nil).Format("2006-01-02"); got != "2024-03-01" {
+		t.Errorf("new listing: %s", got)
+	}
+	// 上市日未知：从第一根 K 线算
+	if got := coverageFrom(start, nil, &late).Format("2006-01-02"); got != "2024-03-01" {
+		t.Errorf("unknown listing: %s", got)
+	}
+	if got := coverageFrom(start, nil, nil); !got.Equal(start) {
+		t.Errorf("no data: %v", got)
+	}
+}
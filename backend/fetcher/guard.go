@@ -0,0 +1,167 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"oh-my-stock/config"
+	"oh-my-stock/models"
+)
+
+// ============================================================
+// 抓取策略：重试（指数退避 + 抖动 + 全局重试预算）和按数据源熔断
+//
+// InitProviders 把每个数据源包一层 guarded：调用前先问熔断器，失败按退避重试，
+// 重试额度从全局 RetryBudget 里扣；连续失败到阈值就熔断，期间直接返回 ErrCircuitOpen，
+// 故障转移链立刻换下一个数据源，不再逐只股票去撞已经挂掉的上游。
+// 按 Host 的限流在 HTTP 层（见 ratelimit.go）。
+// ============================================================
+
+var (
+	policyMu sync.RWMutex
+	policy   = withDefaults(config.FetchConfig{})
+	budget   = NewRetryBudget(policy.Retry.BudgetRatio, policy.Retry.BudgetMin)
+)
+
+// withDefaults 零值字段补默认值。
+func withDefaults(c config.FetchConfig) config.FetchConfig {
+	if c.Concurrency <= 0 {
+		c.Concurrency = 10
+	}
+	if c.Retry.MaxAttempts <= 0 {
+		c.Retry.MaxAttempts = 3
+	}
+	if c.Retry.BaseMS <= 0 {
+		c.Retry.BaseMS = 300
+	}
+	if c.Retry.MaxMS <= 0 {
+		c.Retry.MaxMS = 5000
+	}
+	if c.Retry.BudgetMin <= 0 {
+		c.Retry.BudgetMin = 10
+	}
+	if c.Breaker.CooldownSec <= 0 {
+		c.Breaker.CooldownSec = 60
+	}
+	return c
+}
+
+// Configure 设置抓取策略（在 InitProviders 之前调用）。已创建的 Host 令牌桶按新配置重建。
+func Configure(c config.FetchConfig) {
+	c = withDefaults(c)
+	policyMu.Lock()
+	policy = c
+	budget = NewRetryBudget(c.Retry.BudgetRatio, c.Retry.BudgetMin)
+	policyMu.Unlock()
+
+	limitersMu.Lock()
+	limiters = map[string]*TokenBucket{}
+	limitersMu.Unlock()
+}
+
+func currentPolicy() config.FetchConfig {
+	policyMu.RLock()
+	defer policyMu.RUnlock()
+	return policy
+}
+
+func currentBudget() *RetryBudget {
+	policyMu.RLock()
+	defer policyMu.RUnlock()
+	return budget
+}
+
+// Concurrency 批量抓取的并发数。
+func Concurrency() int { return currentPolicy().Concurrency }
+
+type guarded struct {
+	p  Provider
+	br *Breaker
+	m  *providerMetrics
+}
+
+// Guard 给数据源加上重试和熔断（InitProviders 会自动加，测试或自定义组合时手动用）。
+func Guard(p Provider) Provider {
+	c := currentPolicy().Breaker
+	g := &guarded{
+		p:  p,
+		br: NewBreaker(c.FailureThreshold, time.Duration(c.CooldownSec)*time.Second),
+		m:  metrics.provider(p.Name()),
+	}
+	g.br.onOpen = func() { g.m.breakerOpens.Add(1) }
+	metrics.mu.Lock()
+	g.m.breaker = g.br
+	metrics.mu.Unlock()
+	return g
+}
+
+func (g *guarded) Name() string { return g.p.Name() }
+
+// guard 带重试和熔断地执行 call。ErrNotSupported 和调用方取消不算失败、不重试。
+func guard[T any](ctx context.Context, g *guarded, call func() (T, error)) (T, error) {
+	var zero T
+	pol := currentPolicy().Retry
+	bo := Backoff{
+		Base:   time.Duration(pol.BaseMS) * time.Millisecond,
+		Max:    time.Duration(pol.MaxMS) * time.Millisecond,
+		Jitter: pol.Jitter,
+	}
+	b := currentBudget()
+	b.Deposit()
+	for attempt := 0; ; attempt++ {
+		if err := g.br.Allow(); err != nil {
+			g.m.rejected.Add(1)
+			return zero, fmt.Errorf("%s: %w", g.p.Name(), err)
+		}
+		g.m.calls.Add(1)
+		v, err := call()
+		switch {
+		case err == nil, errors.Is(err, ErrNotSupported):
+			g.br.Success()
+			return v, err
+		case ctx.Err() != nil:
+			g.br.Abort()
+			return zero, err
+		}
+		g.m.failures.Add(1)
+		g.br.Failure()
+		if attempt+1 >= pol.MaxAttempts {
+			return zero, err
+		}
+		if !b.Withdraw() {
+			g.m.budgetExhausted.Add(1)
+			return zero, err
+		}
+		g.m.retries.Add(1)
+		if serr := sleepCtx(ctx, bo.Delay(attempt)); serr != nil {
+			return zero, err
+		}
+	}
+}
+
+func (g *guarded) List(ctx context.Context) ([]*SinaStock, error) {
+	return guard(ctx, g, func() ([]*SinaStock, error) { return g.p.List(ctx) })
+}
+
+func (g *guarded) Daily(ctx context.Context, symbol string, days int) ([]SinaDaily, error) {
+	return guard(ctx, g, func() ([]SinaDaily, error) { return g.p.Daily(ctx, symbol, days) })
+}
+
+func (g *guarded) MoneyFlow(ctx context.Context, symbol string, days int) ([]models.StockMoneyFlow, error) {
+	return guard(ctx, g, func() ([]models.StockMoneyFlow, error) { return g.p.MoneyFlow(ctx, symbol, days) })
+}
+
+func (g *guarded) Valuation(ctx context.Context) ([]ValuationRow, error) {
+	return guard(ctx, g, func() ([]ValuationRow, error) { return g.p.Valuation(ctx) })
+}
+
+func (g *guarded) Detail(ctx context.Context, symbol string) (*StockDetail, error) {
+	return guard(ctx, g, func() (*StockDetail, error) { return g.p.Detail(ctx, symbol) })
+}
+
+func (g *guarded) CorporateActions(ctx context.Context, symbol string) ([]models.StockCorporateAction, error) {
+	return guard(ctx, g, func() ([]models.StockCorporateAction, error) { return g.p.CorporateActions(ctx, symbol) })
+}
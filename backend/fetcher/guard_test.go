@@ -0,0 +1,218 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"oh-my-stock/config"
+)
+
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+func TestTokenBucket(t *testing.T) {
+	clk := &fakeClock{t: time.Unix(0, 0)}
+	b := NewTokenBucket(2, 2) // 每秒 2 个，桶容量 2
+	b.now = clk.now
+	if b.reserve() != 0 || b.reserve() != 0 {
+		t.Fatal("满桶时前两个不用等")
+	}
+	if d := b.reserve(); d != 500*time.Millisecond {
+		t.Fatalf("第 3 个应等 500ms, got %s", d)
+	}
+	if d := b.reserve(); d != time.Second {
+		t.Fatalf("第 4 个排在后面等 1s, got %s", d)
+	}
+	clk.t = clk.t.Add(10 * time.Second) // 补满但不超过 burst
+	b.reserve()
+	b.reserve()
+	if d := b.reserve(); d <= 0 {
+		t.Fatalf("补充不应超过 burst, got %s", d)
+	}
+	if NewTokenBucket(0, 1).reserve() != 0 {
+		t.Fatal("rate<=0 不限流")
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	clk := &fakeClock{t: time.Unix(0, 0)}
+	b := NewBreaker(3, time.Minute)
+	b.now = clk.now
+	opens := 0
+	b.onOpen = func() { opens++ }
+
+	b.Failure()
+	b.Failure()
+	b.Success() // 成功清零连续失败
+	b.Failure()
+	b.Failure()
+	if b.Allow() != nil || b.State() != BreakerClosed {
+		t.Fatal("未到阈值不应熔断")
+	}
+	b.Failure()
+	if !errors.Is(b.Allow(), ErrCircuitOpen) || opens != 1 {
+		t.Fatalf("应熔断 state=%s opens=%d", b.State(), opens)
+	}
+
+	clk.t = clk.t.Add(time.Minute)
+	if b.Allow() != nil || b.State() != BreakerHalfOpen {
+		t.Fatal("冷却后放一个探测")
+	}
+	if !errors.Is(b.Allow(), ErrCircuitOpen) {
+		t.Fatal("探测未返回前其余请求仍拒绝")
+	}
+	b.Failure() // 探测失败 → 再开一轮
+	if !errors.Is(b.Allow(), ErrCircuitOpen) || opens != 2 {
+		t.Fatalf("探测失败应重新熔断 opens=%d", opens)
+	}
+	clk.t = clk.t.Add(time.Minute)
+	b.Allow()
+	b.Abort() // 探测被取消，下一个继续探测
+	if b.Allow() != nil {
+		t.Fatal("取消的探测不应卡住半开状态")
+	}
+	b.Success()
+	if b.State() != BreakerClosed {
+		t.Fatal("探测成功应关闭")
+	}
+}
+
+func TestBackoffAndBudget(t *testing.T) {
+	bo := Backoff{Base: 100 * time.Millisecond, Max: time.Second, Jitter: 0.5}
+	for attempt, max := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		max *= time.Millisecond
+		d := bo.Delay(attempt)
+		if d > max || d < max/2 {
+			t.Errorf("attempt %d delay %s 不在 [%s, %s]", attempt, d, max/2, max)
+		}
+	}
+
+	b := NewRetryBudget(0.5, 2)
+	if !b.Withdraw() || !b.Withdraw() || b.Withdraw() {
+		t.Fatal("初始额度为 2")
+	}
+	b.Deposit()
+	b.Deposit()
+	if !b.Withdraw() || b.Withdraw() {
+		t.Fatal("两次请求攒 1 次重试")
+	}
+	if !NewRetryBudget(0, 1).Withdraw() {
+		t.Fatal("ratio<=0 不限重试")
+	}
+}
+
+func useFetchConfig(t *testing.T, c config.FetchConfig) {
+	old := currentPolicy()
+	Configure(c)
+	t.Cleanup(func() { Configure(old) })
+}
+
+func TestGuard_RetryAndBreaker(t *testing.T) {
+	useFetchConfig(t, config.FetchConfig{
+		Retry:   config.RetryConfig{MaxAttempts: 3, BaseMS: 1, MaxMS: 1, BudgetRatio: 1, BudgetMin: 100},
+		Breaker: config.BreakerConfig{FailureThreshold: 5, CooldownSec: 60},
+	})
+	before := providerStats("guard-bad") // 计数按名字累计，-count>1 时取差值
+	bad := &fakeProvider{name: "guard-bad", err: errors.New("boom")}
+	g := Guard(bad)
+	if _, err := g.Daily(context.Background(), "600000", 5); err == nil || bad.calls != 3 {
+		t.Fatalf("应重试到 3 次: calls=%d err=%v", bad.calls, err)
+	}
+	// 再失败 2 次达到阈值 5 → 熔断（第 3 次重试即被拒绝），之后不再调用上游
+	g.Daily(context.Background(), "600000", 5)
+	calls := bad.calls
+	_, err := g.Daily(context.Background(), "600000", 5)
+	if !errors.Is(err, ErrCircuitOpen) || bad.calls != calls {
+		t.Fatalf("熔断后应直接拒绝: calls=%d err=%v", bad.calls-calls, err)
+	}
+
+	// 熔断的数据源在故障转移链里被跳过
+	good := &fakeProvider{name: "guard-good"}
+	rows, err := Failover(g, Guard(good)).Daily(context.Background(), "600000", 5)
+	if err != nil || len(rows) != 1 {
+		t.Fatalf("rows=%v err=%v", rows, err)
+	}
+
+	st := providerStats("guard-bad")
+	if st.BreakerState != BreakerOpen || st.BreakerOpens-before.BreakerOpens != 1 ||
+		st.Retries == before.Retries || st.Rejected-before.Rejected != 3 {
+		t.Fatalf("metrics = %+v", st)
+	}
+
+	// ErrNotSupported 不重试、不计失败
+	ns := &fakeProvider{name: "guard-ns", err: ErrNotSupported}
+	if _, err := Guard(ns).Daily(context.Background(), "600000", 5); !errors.Is(err, ErrNotSupported) || ns.calls != 1 {
+		t.Fatalf("calls=%d err=%v", ns.calls, err)
+	}
+}
+
+func TestGuard_RetryBudgetExhausted(t *testing.T) {
+	useFetchConfig(t, config.FetchConfig{
+		Retry: config.RetryConfig{MaxAttempts: 5, BaseMS: 1, MaxMS: 1, BudgetRatio: 0.1, BudgetMin: 1},
+	})
+	bad := &fakeProvider{name: "budget-bad", err: errors.New("boom")}
+	Guard(bad).Daily(context.Background(), "600000", 5)
+	if bad.calls != 2 {
+		t.Fatalf("预算只够 1 次重试: calls=%d", bad.calls)
+	}
+}
+
+func TestHTTPClient_RateLimitPerHost(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+	host := mustHost(t, srv.URL)
+	useFetchConfig(t, config.FetchConfig{RateLimits: config.RateLimits{
+		Hosts: map[string]config.RateLimit{host: {RPS: 20, Burst: 1}},
+	}})
+
+	c := NewHTTPClient(time.Second)
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		resp, err := c.Get(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	if el := time.Since(start); el < 90*time.Millisecond {
+		t.Fatalf("20 rps / burst 1 三个请求至少 100ms, got %s", el)
+	}
+	hs := hostStats(host)
+	if hs.Requests != 3 || hs.Waited != 2 || hs.Throttled != 3 {
+		t.Fatalf("host metrics = %+v", hs)
+	}
+}
+
+func mustHost(t *testing.T, raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Host
+}
+
+func providerStats(name string) ProviderStats {
+	for _, p := range Metrics().Providers {
+		if p.Provider == name {
+			return p
+		}
+	}
+	return ProviderStats{}
+}
+
+func hostStats(host string) HostStats {
+	for _, h := range Metrics().Hosts {
+		if h.Host == host {
+			return h
+		}
+	}
+	return HostStats{}
+}
@@ -0,0 +1,374 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"oh-my-stock/calendar"
+	"oh-my-stock/config"
+	"oh-my-stock/models"
+)
+
+// ============================================================
+// stock_history_mv 由后端管理：定义带版本号写在这里，启动时（history_mv 任务）发现库里的版本不同就重建，
+// 采集批次结束后 REFRESH MATERIALIZED VIEW CONCURRENTLY，每次的结果记在 mv_meta。
+//
+// 重建先建 stock_history_mv_build（带数据和索引），再在同一事务里删旧的、改名，
+// 读方只在最后换名的一瞬间被挡住。重建和刷新都持有同一把事务级 advisory lock，多副本下串行执行。
+// 改定义时把 HistoryMVVersion 加 1。
+// ============================================================
+
+// HistoryMV 物化视图名。
+const HistoryMV = "stock_history_mv"
+
+// HistoryMVVersion 当前定义版本。
+// 1 = scripts/refresh_mv.sql 时代的定义；2 = 后端接管，加 trade_date 索引。
+const HistoryMVVersion = 2
+
+// historyMVLockKey 重建 / 刷新互斥（pg_advisory_xact_lock 的键）。
+const historyMVLockKey int64 = 0x6d765f68697374 // "mv_hist"
+
+// historyMVStatusTTL 新鲜度缓存时间：API 每次响应都带新鲜度，不必每次查库。
+const historyMVStatusTTL = 30 * time.Second
+
+const historyMVSelect = `
+SELECT
+    d.symbol::varchar(10)                         AS symbol,
+    bi.name::varchar(50)                          AS name,
+    bi.industry::varchar(50)                      AS industry,
+    bi.market::varchar(20)                        AS market,
+    d.trade_date                                  AS trade_date,
+    d.open, d.high, d.low, d.close,
+    d.volume, d.turnover,
+    d.change_percent, d.change_amount, d.turnover_rate,
+    d.pe_ttm, d.pb, d.amplitude,
+    i.ma5, i.ma10, i.ma20, i.ma60,
+    i.macd, i.dif, i.dea,
+    i.k, i.d, i.j,
+    i.rsi6, i.rsi12, i.rsi24,
+    i.boll_upper, i.boll_mid, i.boll_lower,
+    mf.inflow_amount  AS in_amount,
+    mf.outflow_amount AS out_amount,
+    mf.net_amount     AS net_amount,
+    mf.turnover       AS mf_turnover,
+    mf.change_percent AS mf_change_percent
+FROM stock_daily_data d
+LEFT JOIN stock_basic_info        bi ON bi.symbol = d.symbol
+LEFT JOIN stock_indicators        i  ON i.symbol = d.symbol  AND i.calc_date = d.trade_date
+LEFT JOIN stock_money_flow_all    mf ON mf.symbol = d.symbol AND mf.trade_date = d.trade_date AND mf.time_span = 0`
+
+// historyMVIndexes 索引名 → 定义（%s 为视图名）。唯一索引是 CONCURRENTLY 刷新的前提。
+var historyMVIndexes = []struct{ name, def string }{
+	{"uk_stock_history_mv", "CREATE UNIQUE INDEX %s ON %s(symbol, trade_date)"},
+	{"idx_stock_history_mv_symbol_date", "CREATE INDEX %s ON %s(symbol, trade_date DESC)"},
+	{"idx_stock_history_mv_date", "CREATE INDEX %s ON %s(trade_date)"},
+	{"idx_stock_history_mv_change", "CREATE INDEX %s ON %s(change_percent DESC)"},
+}
+
+// ErrHistoryMVMissing 视图还没建（history_mv 任务没跑过或失败了）。
+var ErrHistoryMVMissing = errors.New("stock_history_mv 不存在，请先运行 history_mv 任务")
+
+// EnsureHistoryMV 库里没有视图或版本不是 HistoryMVVersion 时重建，返回是否重建了。
+func EnsureHistoryMV(ctx context.Context) (bool, error) {
+	rebuilt := false
+	start := time.Now()
+	err := config.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", historyMVLockKey).Error; err != nil {
+			return err
+		}
+		meta, err := loadMVMeta(tx)
+		if err != nil {
+			return err
+		}
+		exists, err := historyMVExists(tx)
+		if err != nil {
+			return err
+		}
+		if exists && meta.Version == HistoryMVVersion {
+			return nil
+		}
+		if exists {
+			log.Printf("⏳ stock_history_mv 定义版本 %d → %d，重建...", meta.Version, HistoryMVVersion)
+		} else {
+			log.Printf("⏳ 创建 stock_history_mv（版本 %d）...", HistoryMVVersion)
+		}
+
+		srcMax, err := sourceMaxDate(tx)
+		if err != nil {
+			return err
+		}
+		build := HistoryMV + "_build"
+		stmts := []string{
+			"DROP MATERIALIZED VIEW IF EXISTS " + build,
+			fmt.Sprintf("CREATE MATERIALIZED VIEW %s AS %s", build, historyMVSelect),
+		}
+		for _, ix := range historyMVIndexes {
+			stmts = append(stmts, fmt.Sprintf(ix.def, ix.name+"_build", build))
+		}
+		// 旧视图上的索引随视图一起删掉，之后把新视图和索引改回正式名字
+		stmts = append(stmts,
+			"DROP MATERIALIZED VIEW IF EXISTS "+HistoryMV,
+			fmt.Sprintf("ALTER MATERIALIZED VIEW %s RENAME TO %s", build, HistoryMV))
+		for _, ix := range historyMVIndexes {
+			stmts = append(stmts, fmt.Sprintf("ALTER INDEX %s_build RENAME TO %s", ix.name, ix.name))
+		}
+		for _, s := range stmts {
+			if err := tx.Exec(s).Error; err != nil {
+				return fmt.Errorf("%s: %w", s, err)
+			}
+		}
+		meta.Version = HistoryMVVersion
+		if err := recordRefresh(tx, &meta, start, srcMax); err != nil {
+			return err
+		}
+		rebuilt = true
+		return nil
+	})
+	if err != nil {
+		if ctx.Err() == nil {
+			recordMVError(err)
+		}
+		return false, err
+	}
+	if rebuilt {
+		invalidateMVStatus()
+		log.Printf("✅ stock_history_mv 已重建（版本 %d，耗时 %s）", HistoryMVVersion, time.Since(start).Round(time.Millisecond))
+	}
+	return rebuilt, nil
+}
+
+// RefreshHistoryMV 刷新 stock_history_mv（CONCURRENTLY，不阻塞查询），结果记在 mv_meta。
+// 有别的实例正在刷新时等它完成后再刷一次，保证调用前写入的数据一定可见。
+func RefreshHistoryMV(ctx context.Context) error {
+	start := time.Now()
+	err := config.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", historyMVLockKey).Error; err != nil {
+			return err
+		}
+		exists, err := historyMVExists(tx)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrHistoryMVMissing
+		}
+		meta, err := loadMVMeta(tx)
+		if err != nil {
+			return err
+		}
+		srcMax, err := sourceMaxDate(tx)
+		if err != nil {
+			return err
+		}
+		if err := tx.Exec("REFRESH MATERIALIZED VIEW CONCURRENTLY " + HistoryMV).Error; err != nil {
+			return fmt.Errorf("刷新 stock_history_mv: %w", err)
+		}
+		if meta.Version == 0 {
+			meta.Version = 1 // 脚本建的旧视图，下次 EnsureHistoryMV 会重建
+		}
+		return recordRefresh(tx, &meta, start, srcMax)
+	})
+	if err != nil {
+		if ctx.Err() == nil {
+			recordMVError(err)
+		}
+		return err
+	}
+	invalidateMVStatus()
+	log.Printf("✅ stock_history_mv 已刷新（耗时 %s）", time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+var mvRefresh struct {
+	mu      sync.Mutex
+	running bool
+	again   bool
+}
+
+// RequestHistoryMVRefresh 后台刷新，不等结果（单只股票补数、隔离区放行等零散写入后用）。
+// 正在刷新时不重复启动，只记一笔，当前这次完成后再刷一次。
+func RequestHistoryMVRefresh() {
+	mvRefresh.mu.Lock()
+	if mvRefresh.running {
+		mvRefresh.again = true
+		mvRefresh.mu.Unlock()
+		return
+	}
+	mvRefresh.running = true
+	mvRefresh.mu.Unlock()
+
+	go func() {
+		for {
+			if err := RefreshHistoryMV(context.Background()); err != nil {
+				log.Printf("⚠️ 刷新 stock_history_mv 失败: %v", err)
+			}
+			mvRefresh.mu.Lock()
+			if !mvRefresh.again {
+				mvRefresh.running = false
+				mvRefresh.mu.Unlock()
+				return
+			}
+			mvRefresh.again = false
+			mvRefresh.mu.Unlock()
+		}
+	}()
+}
+
+func historyMVExists(tx *gorm.DB) (bool, error) {
+	var n int64
+	err := tx.Raw("SELECT COUNT(*) FROM pg_matviews WHERE matviewname = ?", HistoryMV).Scan(&n).Error
+	return n > 0, err
+}
+
+func loadMVMeta(tx *gorm.DB) (models.MVMeta, error) {
+	meta := models.MVMeta{Name: HistoryMV}
+	err := tx.Where("name = ?", HistoryMV).Limit(1).Find(&meta).Error
+	return meta, err
+}
+
+func sourceMaxDate(tx *gorm.DB) (*time.Time, error) {
+	var d *time.Time
+	err := tx.Raw("SELECT MAX(trade_date) FROM stock_daily_data").Scan(&d).Error
+	return d, err
+}
+
+// recordRefresh 刷新成功：记录耗时、刷新前基表的最大交易日和视图当前的统计，清掉上次的错误。
+func recordRefresh(tx *gorm.DB, meta *models.MVMeta, start time.Time, srcMax *time.Time) error {
+	var mvMax *time.Time
+	if err := tx.Raw("SELECT MAX(trade_date) FROM " + HistoryMV).Scan(&mvMax).Error; err != nil {
+		return err
+	}
+	var rows int64
+	if err := tx.Raw("SELECT GREATEST(reltuples, 0)::bigint FROM pg_class WHERE relname = ?", HistoryMV).Scan(&rows).Error; err != nil {
+		return err
+	}
+	now := time.Now()
+	meta.Name = HistoryMV
+	meta.RefreshedAt, meta.RefreshMS = &now, int(now.Sub(start).Milliseconds())
+	meta.SourceMaxDate, meta.MVMaxDate, meta.MVRows = srcMax, mvMax, rows
+	meta.LastError, meta.LastErrorAt = "", nil
+	return tx.Save(meta).Error
+}
+
+// recordMVError 记录失败（事务已回滚，单独写）。
+func recordMVError(cause error) {
+	now := time.Now()
+	meta := models.MVMeta{Name: HistoryMV, LastError: cause.Error(), LastErrorAt: &now, UpdatedAt: now}
+	err := config.DB.Exec(`INSERT INTO mv_meta (name, version, last_error, last_error_at, updated_at)
+		VALUES (?, 0, ?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET last_error = EXCLUDED.last_error,
+			last_error_at = EXCLUDED.last_error_at, updated_at = EXCLUDED.updated_at`,
+		meta.Name, meta.LastError, meta.LastErrorAt, meta.UpdatedAt).Error
+	if err != nil {
+		log.Printf("⚠️ 记录 stock_history_mv 刷新失败: %v", err)
+	}
+	invalidateMVStatus()
+}
+
+// ============================================================
+// 新鲜度
+// ============================================================
+
+// MVStatus stock_history_mv 的版本、刷新记录和新鲜度。
+type MVStatus struct {
+	models.MVMeta
+	Exists           bool       `json:"exists"`
+	WantVersion      int        `json:"want_version"`
+	CurrentSourceMax *time.Time `json:"current_source_max_date"` // 基表现在的最大交易日
+	LatestTradingDay time.Time  `json:"latest_trading_day"`      // 最近一个已收盘交易日
+	AgeSeconds       int64      `json:"age_seconds"`             // 距上次成功刷新
+	Stale            bool       `json:"stale"`
+	StaleReason      string     `json:"stale_reason,omitempty"`
+}
+
+// Freshness 放进 API 响应体的摘要。
+type Freshness struct {
+	AsOf        string     `json:"as_of"` // 视图里最新的交易日
+	RefreshedAt *time.Time `json:"refreshed_at"`
+	Stale       bool       `json:"stale"`
+	Reason      string     `json:"reason,omitempty"`
+}
+
+// Freshness 摘要。
+func (s MVStatus) Freshness() Freshness {
+	f := Freshness{RefreshedAt: s.RefreshedAt, Stale: s.Stale, Reason: s.StaleReason}
+	if s.MVMaxDate != nil {
+		f.AsOf = s.MVMaxDate.Format("2006-01-02")
+	}
+	return f
+}
+
+var mvStatusCache struct {
+	mu  sync.Mutex
+	at  time.Time
+	val MVStatus
+}
+
+func invalidateMVStatus() {
+	mvStatusCache.mu.Lock()
+	mvStatusCache.at = time.Time{}
+	mvStatusCache.mu.Unlock()
+}
+
+// HistoryMVStatus 当前状态，缓存 30 秒。
+func HistoryMVStatus() (MVStatus, error) {
+	mvStatusCache.mu.Lock()
+	defer mvStatusCache.mu.Unlock()
+	if time.Since(mvStatusCache.at) < historyMVStatusTTL {
+		return mvStatusCache.val, nil
+	}
+	s, err := loadMVStatus(time.Now())
+	if err != nil {
+		return s, err
+	}
+	mvStatusCache.val, mvStatusCache.at = s, time.Now()
+	return s, nil
+}
+
+func loadMVStatus(now time.Time) (MVStatus, error) {
+	s := MVStatus{WantVersion: HistoryMVVersion, LatestTradingDay: calendar.LatestSettled(now)}
+	var err error
+	if s.MVMeta, err = loadMVMeta(config.DB); err != nil {
+		return s, err
+	}
+	if s.Exists, err = historyMVExists(config.DB); err != nil {
+		return s, err
+	}
+	if s.CurrentSourceMax, err = sourceMaxDate(config.DB); err != nil {
+		return s, err
+	}
+	if s.RefreshedAt != nil {
+		s.AgeSeconds = int64(now.Sub(*s.RefreshedAt).Seconds())
+	}
+	s.Stale, s.StaleReason = staleness(s)
+	return s, nil
+}
+
+// staleness 判断视图是否落后：不存在、版本旧、上次刷新失败、基表有比视图更新的交易日。
+func staleness(s MVStatus) (bool, string) {
+	day := func(t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return t.Format("2006-01-02")
+	}
+	switch {
+	case !s.Exists:
+		return true, "视图不存在"
+	case s.Version != s.WantVersion:
+		return true, fmt.Sprintf("定义版本 %d，当前为 %d，待重建", s.Version, s.WantVersion)
+	case s.LastError != "":
+		return true, "上次刷新失败: " + s.LastError
+	case s.RefreshedAt == nil:
+		return true, "没有刷新记录"
+	case day(s.CurrentSourceMax) > day(s.MVMaxDate):
+		return true, fmt.Sprintf("日 K 已到 %s，视图停在 %s", day(s.CurrentSourceMax), day(s.MVMaxDate))
+	}
+	return false, ""
+}
@@ -0,0 +1,53 @@
+package fetcher
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"oh-my-stock/models"
+)
+
+func TestStaleness(t *testing.T) {
+	d := func(s string) *time.Time {
+		v, _ := time.Parse("2006-01-02", s)
+		return &v
+	}
+	fresh := MVStatus{
+		MVMeta:           models.MVMeta{Version: HistoryMVVersion, RefreshedAt: d("2024-06-04"), MVMaxDate: d("2024-06-04")},
+		Exists:           true,
+		WantVersion:      HistoryMVVersion,
+		CurrentSourceMax: d("2024-06-04"),
+	}
+	if stale, reason := staleness(fresh); stale {
+		t.Fatalf("fresh view reported stale: %s", reason)
+	}
+
+	cases := map[string]func(s *MVStatus){
+		"不存在":    func(s *MVStatus) { s.Exists = false },
+		"待重建":    func(s *MVStatus) { s.Version = 1 },
+		"上次刷新失败": func(s *MVStatus) { s.LastError = "timeout" },
+		"没有刷新记录": func(s *MVStatus) { s.RefreshedAt = nil },
+		"视图停在":   func(s *MVStatus) { s.CurrentSourceMax = d("2024-06-05") },
+	}
+	for want, mutate := range cases {
+		s := fresh
+		mutate(&s)
+		stale, reason := staleness(s)
+		if !stale || !strings.Contains(reason, want) {
+			t.Errorf("%s: stale=%v reason=%q", want, stale, reason)
+		}
+	}
+
+	// 基表为空（全部被裁剪）不算落后
+	s := fresh
+	s.CurrentSourceMax, s.MVMaxDate = nil, nil
+	if stale, reason := staleness(s); stale {
+		t.Errorf("empty source reported stale: %s", reason)
+	}
+
+	f := fresh.Freshness()
+	if f.AsOf != "2024-06-04" || f.Stale {
+		t.Errorf("freshness = %+v", f)
+	}
+}
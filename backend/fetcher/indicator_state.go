@@ -0,0 +1,114 @@
+package fetcher
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"oh-my-stock/adjust"
+	"oh-my-stock/config"
+	"oh-my-stock/indicators"
+	"oh-my-stock/models"
+)
+
+// LoadIndicatorState 读取某只股票的指标续算状态；不存在时返回 (nil, nil)。
+func LoadIndicatorState(symbol string) (*models.StockIndicatorState, error) {
+	var st models.StockIndicatorState
+	err := config.DB.Where("symbol = ?", symbol).First(&st).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+// SaveIndicatorState 按 symbol upsert 续算状态。
+func SaveIndicatorState(st *models.StockIndicatorState) error {
+	return config.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "symbol"}},
+		UpdateAll: true,
+	}).Create(st).Error
+}
+
+// DeleteIndicatorState 删除续算状态，下次 RefreshIndicators 会全量重算。
+// 复权因子、历史 K 线被修正后调用。
+func DeleteIndicatorState(symbol string) error {
+	return config.DB.Where("symbol = ?", symbol).Delete(&models.StockIndicatorState{}).Error
+}
+
+// RefreshIndicators 增量更新某只股票的技术指标，返回写入行数。
+//
+// 指标一律按前复权价计算（见 adjust 包）。
+// 有续算状态时只读 LastDate 之前 WindowBars 根 + 之后的新 K 线；
+// 没有状态或检测到历史改写（含新的除权日生效、续算窗口里补进 / 删掉了 K 线）
+// 时读全部日 K 全量重算。保留策略裁掉窗口之前的老 K 线不算改写。
+func RefreshIndicators(symbol string) (int, error) {
+	st, err := LoadIndicatorState(symbol)
+	if err != nil {
+		return 0, fmt.Errorf("读取指标状态失败: %w", err)
+	}
+	adj, err := LoadAdjuster(symbol)
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		inds []models.StockIndicator
+		next *models.StockIndicatorState
+	)
+	if st != nil {
+		rows, err := loadDailyAround(symbol, st)
+		if err != nil {
+			return 0, err
+		}
+		if err = indicators.CheckWindow(*st, rows); err == nil {
+			inds, next, err = indicators.Continue(symbol, *st, adj.Apply(rows, adjust.QFQ))
+		}
+		if errors.Is(err, indicators.ErrHistoryRewritten) {
+			log.Printf("⚠️ %s 历史 K 线有变化（%s），全量重算指标", symbol, st.LastDate.Format("2006-01-02"))
+			st = nil
+		} else if err != nil {
+			return 0, err
+		}
+	}
+	if st == nil {
+		var rows []models.StockDailyData
+		if err := config.DB.Where("symbol = ?", symbol).Order("trade_date").Find(&rows).Error; err != nil {
+			return 0, fmt.Errorf("读取日 K 失败: %w", err)
+		}
+		inds, next = indicators.ComputeWithState(symbol, adj.Apply(rows, adjust.QFQ))
+	}
+	if len(inds) == 0 {
+		return 0, nil
+	}
+
+	n, err := UpsertIndicators(inds)
+	if err != nil {
+		return n, err
+	}
+	if next != nil {
+		if err := SaveIndicatorState(next); err != nil {
+			return n, fmt.Errorf("保存指标状态失败: %w", err)
+		}
+	}
+	return n, nil
+}
+
+// loadDailyAround 读取 st.LastDate（含）之前 WindowBars+1 根和之后全部日 K。
+func loadDailyAround(symbol string, st *models.StockIndicatorState) ([]models.StockDailyData, error) {
+	var before, after []models.StockDailyData
+	if err := config.DB.Where("symbol = ? AND trade_date <= ?", symbol, st.LastDate).
+		Order("trade_date DESC").Limit(indicators.WindowBars + 1).Find(&before).Error; err != nil {
+		return nil, fmt.Errorf("读取日 K 失败: %w", err)
+	}
+	if err := config.DB.Where("symbol = ? AND trade_date > ?", symbol, st.LastDate).
+		Order("trade_date").Find(&after).Error; err != nil {
+		return nil, fmt.Errorf("读取日 K 失败: %w", err)
+	}
+	return append(before, after...), nil
+}
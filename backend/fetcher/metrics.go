@@ -0,0 +1,127 @@
+package fetcher
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 抓取指标：进程内累计计数，管理接口 /api/v1/admin/fetcher/metrics 读取。
+
+type hostMetrics struct {
+	requests  atomic.Int64 // 过令牌桶的请求数
+	waited    atomic.Int64 // 其中需要排队的请求数
+	waitNanos atomic.Int64 // 累计排队时间
+	throttled atomic.Int64 // 上游返回 429/503 的次数
+}
+
+func (m *hostMetrics) observe(wait time.Duration) {
+	m.requests.Add(1)
+	if wait > 0 {
+		m.waited.Add(1)
+		m.waitNanos.Add(int64(wait))
+	}
+}
+
+type providerMetrics struct {
+	calls           atomic.Int64 // 实际发出的调用（含重试）
+	failures        atomic.Int64
+	retries         atomic.Int64
+	budgetExhausted atomic.Int64 // 因重试预算不足放弃重试的次数
+	rejected        atomic.Int64 // 熔断期间被直接拒绝的调用
+	breakerOpens    atomic.Int64
+	breaker         *Breaker
+}
+
+type metricsRegistry struct {
+	mu        sync.Mutex
+	hosts     map[string]*hostMetrics
+	providers map[string]*providerMetrics
+}
+
+var metrics = &metricsRegistry{hosts: map[string]*hostMetrics{}, providers: map[string]*providerMetrics{}}
+
+func (r *metricsRegistry) host(h string) *hostMetrics {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	m, ok := r.hosts[h]
+	if !ok {
+		m = &hostMetrics{}
+		r.hosts[h] = m
+	}
+	return m
+}
+
+// provider 同名数据源重新 InitProviders 时沿用累计计数，熔断器换成新的。
+func (r *metricsRegistry) provider(name string) *providerMetrics {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	m, ok := r.providers[name]
+	if !ok {
+		m = &providerMetrics{}
+		r.providers[name] = m
+	}
+	return m
+}
+
+// HostStats 单个上游 Host 的限流指标。
+type HostStats struct {
+	Host      string  `json:"host"`
+	Requests  int64   `json:"requests"`
+	Waited    int64   `json:"waited"`
+	WaitMS    float64 `json:"wait_ms"`
+	Throttled int64   `json:"throttled"`
+}
+
+// ProviderStats 单个数据源的重试 / 熔断指标。
+type ProviderStats struct {
+	Provider        string `json:"provider"`
+	Calls           int64  `json:"calls"`
+	Failures        int64  `json:"failures"`
+	Retries         int64  `json:"retries"`
+	BudgetExhausted int64  `json:"budget_exhausted"`
+	Rejected        int64  `json:"rejected"`
+	BreakerOpens    int64  `json:"breaker_opens"`
+	BreakerState    string `json:"breaker_state"`
+}
+
+// MetricsSnapshot 全部指标，按名字排序。
+type MetricsSnapshot struct {
+	Hosts     []HostStats     `json:"hosts"`
+	Providers []ProviderStats `json:"providers"`
+}
+
+// Metrics 当前指标快照。
+func Metrics() MetricsSnapshot {
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+	out := MetricsSnapshot{Hosts: []HostStats{}, Providers: []ProviderStats{}}
+	for h, m := range metrics.hosts {
+		out.Hosts = append(out.Hosts, HostStats{
+			Host:      h,
+			Requests:  m.requests.Load(),
+			Waited:    m.waited.Load(),
+			WaitMS:    float64(m.waitNanos.Load()) / float64(time.Millisecond),
+			Throttled: m.throttled.Load(),
+		})
+	}
+	for name, m := range metrics.providers {
+		st := ProviderStats{
+			Provider:        name,
+			Calls:           m.calls.Load(),
+			Failures:        m.failures.Load(),
+			Retries:         m.retries.Load(),
+			BudgetExhausted: m.budgetExhausted.Load(),
+			Rejected:        m.rejected.Load(),
+			BreakerOpens:    m.breakerOpens.Load(),
+		}
+		if m.breaker != nil {
+			st.BreakerState = m.breaker.State()
+		}
+		out.Providers = append(out.Providers, st)
+	}
+	sort.Slice(out.Hosts, func(i, j int) bool { return out.Hosts[i].Host < out.Hosts[j].Host })
+	sort.Slice(out.Providers, func(i, j int) bool { return out.Providers[i].Provider < out.Providers[j].Provider })
+	return out
+}
@@ -0,0 +1,298 @@
+package fetcher
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"oh-my-stock/config"
+)
+
+// ============================================================
+// 按月分区：stock_daily_data / stock_indicators / stock_money_flow 按日期列 RANGE 分区，
+// 每月一个分区 <表名>_pYYYYMM。新库由 create_table.sql 直接建成分区表，老库（普通表）
+// 用 `oh-my-stock partition migrate` 一次性转换。
+//
+// 没有 DEFAULT 分区：partitions 任务每天把完整性检查窗口到之后 PartitionsAhead 个月的分区建好，
+// 导入、装回写更早的月份前自己补建（EnsurePartitions）。保留策略裁剪时整月归档后直接 DROP 分区。
+//
+// stock_history_mv 是物化视图，PostgreSQL 不支持分区；它的最新交易日扫描走 trade_date 索引。
+// ============================================================
+
+// PartitionsAhead 提前建好的月份数（不含当月）。
+const PartitionsAhead = 3
+
+// partitionedTable 分区表及其约束 / 索引名（和 create_table.sql 一致）。
+type partitionedTable struct {
+	name        string
+	dateCol     string
+	unique      string // (symbol, 日期列) 唯一约束
+	dateIndex   string
+	symbolIndex string // 普通表时代的 symbol 单列索引，分区后由唯一约束的前缀代替
+}
+
+var partitionedTables = []partitionedTable{
+	{"stock_daily_data", "trade_date", "uk_stock_daily", "idx_stock_daily_date", "idx_stock_daily_symbol"},
+	{"stock_indicators", "calc_date", "uk_stock_indicators", "idx_stock_indicators_date", "idx_stock_indicators_symbol"},
+	{"stock_money_flow", "trade_date", "uk_stock_money_flow", "idx_stock_money_flow_date", "idx_stock_money_flow_symbol"},
+}
+
+// partitionName 某月的分区名。
+func partitionName(table string, month time.Time) string {
+	return fmt.Sprintf("%s_p%s", table, month.Format("200601"))
+}
+
+// partitionMonth 从分区名解析月份，不是 <table>_pYYYYMM 形式的返回 false。
+func partitionMonth(table, name string) (time.Time, bool) {
+	suffix, ok := strings.CutPrefix(name, table+"_p")
+	if !ok || len(suffix) != 6 {
+		return time.Time{}, false
+	}
+	m, err := time.Parse("200601", suffix)
+	return m, err == nil
+}
+
+func monthStart(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// monthsBetween from、to 所在月及之间每个月的 1 日。
+func monthsBetween(from, to time.Time) []time.Time {
+	var months []time.Time
+	for m, end := monthStart(from), monthStart(to); !m.After(end); m = m.AddDate(0, 1, 0) {
+		months = append(months, m)
+	}
+	return months
+}
+
+// partitionCache 已确认存在的分区和已确认是分区表的表，省掉每次写入前查目录。
+var partitionCache = struct {
+	sync.Mutex
+	tables map[string]bool
+	parts  map[string]bool
+}{tables: map[string]bool{}, parts: map[string]bool{}}
+
+// isPartitioned 表是不是分区表（还没迁移的老库是普通表）。
+func isPartitioned(db *gorm.DB, table string) (bool, error) {
+	partitionCache.Lock()
+	ok := partitionCache.tables[table]
+	partitionCache.Unlock()
+	if ok {
+		return true, nil
+	}
+	var kind string
+	if err := db.Raw("SELECT relkind::text FROM pg_class WHERE oid = to_regclass(?)", table).Scan(&kind).Error; err != nil {
+		return false, err
+	}
+	if kind == "p" {
+		partitionCache.Lock()
+		partitionCache.tables[table] = true
+		partitionCache.Unlock()
+	}
+	return kind == "p", nil
+}
+
+// createPartition 建某月的分区（已存在时跳过），返回是否新建。
+func createPartition(db *gorm.DB, table string, month time.Time) (bool, error) {
+	name := partitionName(table, month)
+	partitionCache.Lock()
+	known := partitionCache.parts[name]
+	partitionCache.Unlock()
+	if known {
+		return false, nil
+	}
+	var exists bool
+	if err := db.Raw("SELECT to_regclass(?) IS NOT NULL", name).Scan(&exists).Error; err != nil {
+		return false, err
+	}
+	if !exists {
+		if err := db.Exec(fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s PARTITION OF %s FOR VALUES FROM ('%s') TO ('%s')",
+			name, table, month.Format("2006-01-02"), month.AddDate(0, 1, 0).Format("2006-01-02"))).Error; err != nil {
+			return false, fmt.Errorf("建分区 %s: %w", name, err)
+		}
+	}
+	partitionCache.Lock()
+	partitionCache.parts[name] = true
+	partitionCache.Unlock()
+	return !exists, nil
+}
+
+// forgetPartition 分区被删掉后清缓存。
+func forgetPartition(name string) {
+	partitionCache.Lock()
+	delete(partitionCache.parts, name)
+	partitionCache.Unlock()
+}
+
+// EnsurePartitions 给各分区表建好 [from, to] 覆盖的月份分区，返回新建的个数。还是普通表的跳过。
+func EnsurePartitions(ctx context.Context, from, to time.Time) (int, error) {
+	db := config.DB.WithContext(ctx)
+	created := 0
+	for _, t := range partitionedTables {
+		ok, err := isPartitioned(db, t.name)
+		if err != nil {
+			return created, err
+		}
+		if !ok {
+			continue
+		}
+		for _, m := range monthsBetween(from, to) {
+			isNew, err := createPartition(db, t.name, m)
+			if err != nil {
+				return created, err
+			}
+			if isNew {
+				created++
+			}
+		}
+	}
+	return created, nil
+}
+
+// EnsureUpcomingPartitions 完整性检查窗口起点到 PartitionsAhead 个月之后（partitions 任务用）。
+func EnsureUpcomingPartitions(ctx context.Context) (int, error) {
+	now := time.Now()
+	return EnsurePartitions(ctx, RetentionCutoff(now, CoverageDays), now.AddDate(0, PartitionsAhead, 0))
+}
+
+// monthPartition 分区表的一个月份分区。
+type monthPartition struct {
+	month time.Time
+	name  string
+}
+
+// listPartitions 分区表按 <table>_pYYYYMM 命名的分区，按月份排序。
+func listPartitions(db *gorm.DB, table string) ([]monthPartition, error) {
+	var names []string
+	if err := db.Raw(`SELECT c.relname FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		WHERE i.inhparent = to_regclass(?)`, table).Scan(&names).Error; err != nil {
+		return nil, err
+	}
+	var parts []monthPartition
+	for _, n := range names {
+		if m, ok := partitionMonth(table, n); ok {
+			parts = append(parts, monthPartition{m, n})
+		}
+	}
+	sort.Slice(parts, func(i, j int) bool { return parts[i].month.Before(parts[j].month) })
+	return parts, nil
+}
+
+// MigratePartitions 把还是普通表的分区表转换成按月分区（老库升级，一次性）。
+//
+// stock_history_mv 依赖这几张表，先删掉视图，全部转换完再按当前定义重建。每张表一个事务：
+// 旧表改名为 <表名>_heap，按它的列（LIKE）建分区表和覆盖已有数据的月份分区，整表复制后删掉旧表，
+// 自增序列转给新表。复制期间这张表不可写，建议停掉后端后执行。
+func MigratePartitions(ctx context.Context) ([]string, error) {
+	db := config.DB.WithContext(ctx)
+	var todo []partitionedTable
+	for _, t := range partitionedTables {
+		ok, err := isPartitioned(db, t.name)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			todo = append(todo, t)
+		}
+	}
+	if len(todo) == 0 {
+		return nil, nil
+	}
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", historyMVLockKey).Error; err != nil {
+			return err
+		}
+		return tx.Exec("DROP MATERIALIZED VIEW IF EXISTS " + HistoryMV).Error
+	}); err != nil {
+		return nil, fmt.Errorf("删除 stock_history_mv: %w", err)
+	}
+
+	var (
+		done     []string
+		from, to time.Time // 各表数据覆盖的并集，最后给所有表补齐（指标按日 K 的日期算，两边要对齐）
+	)
+	for _, t := range todo {
+		start := time.Now()
+		var rows int64
+		err := db.Transaction(func(tx *gorm.DB) error {
+			heap := t.name + "_heap"
+			stmts := []string{
+				fmt.Sprintf("ALTER TABLE %s RENAME TO %s", t.name, heap),
+				fmt.Sprintf("ALTER TABLE %s RENAME CONSTRAINT %s_pkey TO %s_pkey", heap, t.name, heap),
+				fmt.Sprintf("ALTER TABLE %s RENAME CONSTRAINT %s TO %s_heap", heap, t.unique, t.unique),
+				fmt.Sprintf("DROP INDEX IF EXISTS %s, %s", t.dateIndex, t.symbolIndex),
+				fmt.Sprintf("CREATE TABLE %s (LIKE %s INCLUDING DEFAULTS) PARTITION BY RANGE (%s)", t.name, heap, t.dateCol),
+				fmt.Sprintf("ALTER TABLE %s ADD PRIMARY KEY (id, %s)", t.name, t.dateCol),
+				fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s UNIQUE (symbol, %s)", t.name, t.unique, t.dateCol),
+				fmt.Sprintf("CREATE INDEX %s ON %s(%s)", t.dateIndex, t.name, t.dateCol),
+			}
+			for _, s := range stmts {
+				if err := tx.Exec(s).Error; err != nil {
+					return fmt.Errorf("%s: %w", s, err)
+				}
+			}
+			var span struct{ Min, Max *time.Time }
+			if err := tx.Raw(fmt.Sprintf("SELECT MIN(%s) AS min, MAX(%s) AS max FROM %s", t.dateCol, t.dateCol, heap)).
+				Scan(&span).Error; err != nil {
+				return err
+			}
+			now := time.Now()
+			lo, hi := RetentionCutoff(now, CoverageDays), now.AddDate(0, PartitionsAhead, 0)
+			if span.Min != nil && span.Min.Before(lo) {
+				lo = *span.Min
+			}
+			if span.Max != nil && span.Max.After(hi) {
+				hi = *span.Max
+			}
+			if from.IsZero() || lo.Before(from) {
+				from = lo
+			}
+			if hi.After(to) {
+				to = hi
+			}
+			for _, m := range monthsBetween(lo, hi) {
+				if _, err := createPartition(tx, t.name, m); err != nil {
+					return err
+				}
+			}
+			res := tx.Exec(fmt.Sprintf("INSERT INTO %s SELECT * FROM %s", t.name, heap))
+			if res.Error != nil {
+				return fmt.Errorf("复制 %s: %w", t.name, res.Error)
+			}
+			rows = res.RowsAffected
+			var seq *string
+			if err := tx.Raw("SELECT pg_get_serial_sequence(?, 'id')", heap).Scan(&seq).Error; err != nil {
+				return err
+			}
+			if seq != nil {
+				if err := tx.Exec(fmt.Sprintf("ALTER SEQUENCE %s OWNED BY %s.id", *seq, t.name)).Error; err != nil {
+					return err
+				}
+			}
+			return tx.Exec("DROP TABLE " + heap).Error
+		})
+		if err != nil {
+			// 事务回滚了，但建分区时写进缓存的名字不再可信
+			partitionCache.Lock()
+			partitionCache.parts = map[string]bool{}
+			partitionCache.Unlock()
+			return done, fmt.Errorf("转换 %s: %w", t.name, err)
+		}
+		log.Printf("✅ %s 已转换为按月分区：%d 行（耗时 %s）", t.name, rows, time.Since(start).Round(time.Millisecond))
+		done = append(done, t.name)
+	}
+	if _, err := EnsurePartitions(ctx, from, to); err != nil {
+		return done, err
+	}
+	if _, err := EnsureHistoryMV(ctx); err != nil {
+		return done, fmt.Errorf("重建 stock_history_mv: %w", err)
+	}
+	return done, nil
+}
@@ -0,0 +1,49 @@
+package fetcher
+
+import (
+	"testing"
+	"time"
+
+	"oh-my-stock/calendar"
+)
+
+func TestPartitionName(t *testing.T) {
+	m := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	name := partitionName("stock_daily_data", m)
+	if name != "stock_daily_data_p202403" {
+		t.Fatalf("name = %s", name)
+	}
+	got, ok := partitionMonth("stock_daily_data", name)
+	if !ok || !got.Equal(m) {
+		t.Fatalf("month = %v %v", got, ok)
+	}
+	for _, bad := range []string{
+		"stock_daily_data_heap",
+		"stock_daily_data_p2024",
+		"stock_daily_data_p202413",
+		"stock_money_flow_p202403", // 别的表的分区
+	} {
+		if _, ok := partitionMonth("stock_daily_data", bad); ok {
+			t.Fatalf("%s 不应解析成分区", bad)
+		}
+	}
+}
+
+func TestMonthsBetween(t *testing.T) {
+	// 上海时区的月末 / 月初都归到所在月
+	from := time.Date(2023, 11, 30, 0, 0, 0, 0, calendar.Shanghai)
+	to := time.Date(2024, 2, 1, 0, 0, 0, 0, calendar.Shanghai)
+	months := monthsBetween(from, to)
+	want := []string{"2023-11", "2023-12", "2024-01", "2024-02"}
+	if len(months) != len(want) {
+		t.Fatalf("months = %v", months)
+	}
+	for i, m := range months {
+		if m.Format("2006-01") != want[i] || m.Day() != 1 {
+			t.Fatalf("months[%d] = %v", i, m)
+		}
+	}
+	if got := monthsBetween(to, from); len(got) != 0 {
+		t.Fatalf("反向区间应为空: %v", got)
+	}
+}
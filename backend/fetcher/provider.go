@@ -0,0 +1,300 @@
+package fetcher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"oh-my-stock/models"
+)
+
+// ============================================================
+// 行情数据源
+//
+// 抓取统一走 Provider 接口：具体实现（sina 新浪、eastmoney 东财、fixture 本地回放）在 init() 里 Register，
+// 启动时按 config.json 的 providers.order 依次实例化，包成一个故障转移链：
+// 某个数据源报错或不支持该能力（ErrNotSupported）就换下一个。
+//
+// 包级函数 FetchRecentDaily / FetchSinaList / FetchEastMoneyFlowDays … 都转发到当前数据源，
+// 调用方（jobs、controllers）不感知具体实现。
+// ============================================================
+
+// ErrNotSupported 数据源不提供该能力，故障转移链会跳到下一个。
+var ErrNotSupported = errors.New("fetcher: not supported by provider")
+
+// Provider 行情数据源。symbol 一律是 6 位代码（不带 sh/sz 前缀）。
+type Provider interface {
+	Name() string
+	// List 全市场股票列表
+	List(ctx context.Context) ([]*SinaStock, error)
+	// Daily 最近 days 根日 K（不复权），按日期升序
+	Daily(ctx context.Context, symbol string, days int) ([]SinaDaily, error)
+	// MoneyFlow 最近 days 天资金流
+	MoneyFlow(ctx context.Context, symbol string, days int) ([]models.StockMoneyFlow, error)
+	// Valuation 全市场估值表（PE/PB/上市日期）
+	Valuation(ctx context.Context) ([]ValuationRow, error)
+	// Detail 单只股票的行业、地区、板块、股本
+	Detail(ctx context.Context, symbol string) (*StockDetail, error)
+	// CorporateActions 除权除息事件
+	CorporateActions(ctx context.Context, symbol string) ([]models.StockCorporateAction, error)
+}
+
+// SinaDaily 一根日 K（不复权）。Day 为 YYYY-MM-DD。
+type SinaDaily struct {
+	Day      string
+	Open     float64
+	High     float64
+	Low      float64
+	Close    float64
+	Volume   float64
+	Turnover float64
+}
+
+// SinaStock 股票列表的一项。
+type SinaStock struct {
+	Code string
+	Name string
+}
+
+// ValuationRow 估值表的一行。
+type ValuationRow struct {
+	Symbol      string
+	PETTM       float64
+	PB          float64
+	ListingDate string // YYYY-MM-DD，未知为空
+}
+
+// StockDetail 个股资料。
+type StockDetail struct {
+	Symbol      string
+	Name        string
+	Industry    string
+	Area        string
+	Market      string
+	TotalShares float64
+}
+
+// ProviderFactory 由 config.json 里该数据源的 options 构造实例。
+type ProviderFactory func(opts map[string]string) (Provider, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]ProviderFactory{}
+
+	activeMu sync.RWMutex
+	active   Provider = Failover() // 未初始化时所有能力都返回 ErrNotSupported
+)
+
+// Register 注册数据源，重名 panic（只应在 init() 里调用）。
+func Register(name string, f ProviderFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, dup := registry[name]; dup {
+		panic("fetcher: provider registered twice: " + name)
+	}
+	registry[name] = f
+}
+
+// Providers 已注册的数据源名，按字母序。
+func Providers() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for n := range registry {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewProvider 按名字实例化一个已注册的数据源。
+func NewProvider(name string, opts map[string]string) (Provider, error) {
+	registryMu.RLock()
+	f, ok := registry[name]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("未知数据源 %q（已注册: %s）", name, strings.Join(Providers(), ", "))
+	}
+	return f(opts)
+}
+
+// InitProviders 按顺序实例化数据源并设为当前数据源。order 为空时只用本地回放（fixture）。
+// 每个数据源都包一层 Guard（重试 + 熔断），策略取自 Configure。
+// 某个数据源创建失败时跳过它、其余照常组链；一个都建不起来才返回错误（当前数据源不变）。
+func InitProviders(order []string, options map[string]map[string]string) error {
+	if len(order) == 0 {
+		order = []string{"fixture"}
+	}
+	ps := make([]Provider, 0, len(order))
+	names := make([]string, 0, len(order))
+	var errs []error
+	for _, name := range order {
+		p, err := NewProvider(name, options[name])
+		if err != nil {
+			log.Printf("⚠️ 数据源 %s 初始化失败，已跳过: %v", name, err)
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		ps = append(ps, Guard(p))
+		names = append(names, name)
+	}
+	if len(ps) == 0 {
+		return errors.Join(errs...)
+	}
+	SetProvider(Failover(ps...))
+	log.Printf("✅ 行情数据源: %s", strings.Join(names, " → "))
+	return nil
+}
+
+// SetProvider 替换当前数据源（测试里也用它注入假实现）。
+func SetProvider(p Provider) {
+	activeMu.Lock()
+	active = p
+	activeMu.Unlock()
+}
+
+// Active 当前数据源。
+func Active() Provider {
+	activeMu.RLock()
+	defer activeMu.RUnlock()
+	return active
+}
+
+// ============================================================
+// 故障转移链
+// ============================================================
+
+type failover struct {
+	ps []Provider
+}
+
+// Failover 把多个数据源串成一个：按顺序尝试，返回第一个成功的结果。
+// 全部失败时返回最后一个错误；全部不支持时返回 ErrNotSupported。
+func Failover(ps ...Provider) Provider {
+	return &failover{ps: ps}
+}
+
+func (f *failover) Name() string {
+	names := make([]string, len(f.ps))
+	for i, p := range f.ps {
+		names[i] = p.Name()
+	}
+	return strings.Join(names, ",")
+}
+
+// try 依次调用 call，ctx 取消时立即停止。
+func try[T any](ctx context.Context, f *failover, what string, call func(Provider) (T, error)) (T, error) {
+	var zero T
+	err := ErrNotSupported
+	for _, p := range f.ps {
+		if ctx.Err() != nil {
+			return zero, ctx.Err()
+		}
+		v, e := call(p)
+		if e == nil {
+			return v, nil
+		}
+		switch {
+		case errors.Is(e, ErrNotSupported):
+		case errors.Is(e, ErrCircuitOpen):
+			// 熔断中的数据源每次调用都会被拒，不逐条打日志
+			err = e
+		default:
+			log.Printf("⚠️ 数据源 %s %s 失败，尝试下一个: %v", p.Name(), what, e)
+			err = e
+		}
+	}
+	return zero, err
+}
+
+func (f *failover) List(ctx context.Context) ([]*SinaStock, error) {
+	return try(ctx, f, "List", func(p Provider) ([]*SinaStock, error) { return p.List(ctx) })
+}
+
+func (f *failover) Daily(ctx context.Context, symbol string, days int) ([]SinaDaily, error) {
+	return try(ctx, f, "Daily "+symbol, func(p Provider) ([]SinaDaily, error) { return p.Daily(ctx, symbol, days) })
+}
+
+func (f *failover) MoneyFlow(ctx context.Context, symbol string, days int) ([]models.StockMoneyFlow, error) {
+	return try(ctx, f, "MoneyFlow "+symbol, func(p Provider) ([]models.StockMoneyFlow, error) { return p.MoneyFlow(ctx, symbol, days) })
+}
+
+func (f *failover) Valuation(ctx context.Context) ([]ValuationRow, error) {
+	return try(ctx, f, "Valuation", func(p Provider) ([]ValuationRow, error) { return p.Valuation(ctx) })
+}
+
+func (f *failover) Detail(ctx context.Context, symbol string) (*StockDetail, error) {
+	return try(ctx, f, "Detail "+symbol, func(p Provider) (*StockDetail, error) { return p.Detail(ctx, symbol) })
+}
+
+func (f *failover) CorporateActions(ctx context.Context, symbol string) ([]models.StockCorporateAction, error) {
+	return try(ctx, f, "CorporateActions "+symbol, func(p Provider) ([]models.StockCorporateAction, error) {
+		return p.CorporateActions(ctx, symbol)
+	})
+}
+
+// ============================================================
+// 包级入口：转发到当前数据源
+// ============================================================
+
+// FetchSinaList 全市场股票列表。
+func FetchSinaList(ctx context.Context) ([]*SinaStock, error) { return Active().List(ctx) }
+
+// FetchEastMoneyFlowDays 最近 days 天资金流。
+func FetchEastMoneyFlowDays(ctx context.Context, symbol string, days int) ([]models.StockMoneyFlow, error) {
+	return Active().MoneyFlow(ctx, symbol, days)
+}
+
+// FetchValuationAll 全市场估值表。
+func FetchValuationAll(ctx context.Context) ([]ValuationRow, error) { return Active().Valuation(ctx) }
+
+// FetchEastMoneyDetail 个股资料。
+func FetchEastMoneyDetail(ctx context.Context, symbol string) (*StockDetail, error) {
+	return Active().Detail(ctx, symbol)
+}
+
+// FetchCorporateActions 除权除息事件。
+func FetchCorporateActions(ctx context.Context, symbol string) ([]models.StockCorporateAction, error) {
+	return Active().CorporateActions(ctx, symbol)
+}
+
+// ============================================================
+// HTTP 数据源共用
+// ============================================================
+
+// upstreamTimeout 单个上游请求的超时（外层 FetchRecentDaily 等还有总超时）。
+const upstreamTimeout = 15 * time.Second
+
+// getJSON GET rawURL 并把 JSON 响应解到 v。c 应由 NewHTTPClient 创建（按 Host 限流）；
+// 非 2xx 返回带状态码的错误，由 Guard 重试、计入熔断。
+func getJSON(ctx context.Context, c *http.Client, rawURL, referer string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (oh-my-stock)")
+	if referer != "" {
+		req.Header.Set("Referer", referer)
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("%s %s: HTTP %d", req.URL.Host, req.URL.Path, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("%s %s: 解析响应失败: %w", req.URL.Host, req.URL.Path, err)
+	}
+	return nil
+}
@@ -0,0 +1,242 @@
+package fetcher
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"oh-my-stock/models"
+)
+
+// ============================================================
+// eastmoney：东方财富行情接口
+//
+//	MoneyFlow         push2his.eastmoney.com        fflow/daykline（日资金流）
+//	Valuation         push2.eastmoney.com           clist（沪深京 A 股 PE-TTM / PB / 上市日期，分页）
+//	Detail            push2.eastmoney.com           stock/get（名称、行业、地域、总股本）
+//	CorporateActions  datacenter-web.eastmoney.com  RPT_SHAREBONUS_DET（分红送转，每 10 股口径）
+//
+// List、Daily 不提供（ErrNotSupported），由链上的 sina 负责。
+// 请求一律走 NewHTTPClient，按 Host 限流。options.his_url / quote_url / data_url 可改接口地址。
+// ============================================================
+
+const (
+	emHisURL     = "https://push2his.eastmoney.com"
+	emQuoteURL   = "https://push2.eastmoney.com"
+	emDataURL    = "https://datacenter-web.eastmoney.com"
+	emReferer    = "https://quote.eastmoney.com/"
+	emListPageSz = 100
+	// emMarkets 沪深京 A 股（上证 A、深证 A、创业板、科创板、北交所）
+	emMarkets = "m:0+t:6,m:0+t:80,m:1+t:2,m:1+t:23,m:0+t:81+s:2048"
+)
+
+func init() {
+	Register("eastmoney", func(opts map[string]string) (Provider, error) {
+		return NewEastMoneyProvider(opts["his_url"], opts["quote_url"], opts["data_url"]), nil
+	})
+}
+
+// EastMoneyProvider 东财行情数据源。
+type EastMoneyProvider struct {
+	hisURL   string
+	quoteURL string
+	dataURL  string
+	client   *http.Client
+}
+
+// NewEastMoneyProvider 空地址用默认接口。
+func NewEastMoneyProvider(hisURL, quoteURL, dataURL string) *EastMoneyProvider {
+	if hisURL == "" {
+		hisURL = emHisURL
+	}
+	if quoteURL == "" {
+		quoteURL = emQuoteURL
+	}
+	if dataURL == "" {
+		dataURL = emDataURL
+	}
+	return &EastMoneyProvider{hisURL: hisURL, quoteURL: quoteURL, dataURL: dataURL, client: NewHTTPClient(upstreamTimeout)}
+}
+
+func (e *EastMoneyProvider) Name() string { return "eastmoney" }
+
+// secid 东财证券 ID：沪市 1.，深市、北交所 0.
+func secid(symbol string) string {
+	if MarketFromSymbol(symbol) == "sh" {
+		return "1." + symbol
+	}
+	return "0." + symbol
+}
+
+func (e *EastMoneyProvider) List(context.Context) ([]*SinaStock, error) {
+	return nil, ErrNotSupported
+}
+
+func (e *EastMoneyProvider) Daily(context.Context, string, int) ([]SinaDaily, error) {
+	return nil, ErrNotSupported
+}
+
+// MoneyFlow 日资金流，klines 每行：日期,主力净流入,小单净流入,中单净流入,大单净流入,超大单净流入,…
+// 东财日资金流只给净占比、不给成交占比，三个成交占比留空。
+func (e *EastMoneyProvider) MoneyFlow(ctx context.Context, symbol string, days int) ([]models.StockMoneyFlow, error) {
+	q := url.Values{
+		"secid": {secid(symbol)}, "klt": {"101"}, "lmt": {strconv.Itoa(days)},
+		"fields1": {"f1,f2,f3,f7"}, "fields2": {"f51,f52,f53,f54,f55,f56"},
+	}
+	var resp struct {
+		Data *struct {
+			Klines []string `json:"klines"`
+		} `json:"data"`
+	}
+	if err := getJSON(ctx, e.client, e.hisURL+"/api/qt/stock/fflow/daykline/get?"+q.Encode(), emReferer, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Data == nil {
+		return nil, fmt.Errorf("%w: 东财没有 %s 的资金流", ErrNotSupported, symbol)
+	}
+	out := make([]models.StockMoneyFlow, 0, len(resp.Data.Klines))
+	for _, line := range resp.Data.Klines {
+		f := strings.Split(line, ",")
+		if len(f) < 3 {
+			continue
+		}
+		d, err := time.Parse("2006-01-02", normDate(f[0]))
+		if err != nil {
+			continue
+		}
+		out = append(out, models.StockMoneyFlow{
+			Symbol:    symbol,
+			TradeDate: d,
+			MainNet:   numPtr(f[1]),
+			RetailNet: numPtr(f[2]),
+		})
+	}
+	return out, nil
+}
+
+// emValue fltt=2 时数值字段是数字，缺失时是 "-"。
+func emValue(v any) *float64 {
+	switch x := v.(type) {
+	case float64:
+		return &x
+	case string:
+		return numPtr(x)
+	}
+	return nil
+}
+
+func emNum(v any) float64 {
+	if p := emValue(v); p != nil {
+		return *p
+	}
+	return 0
+}
+
+// Valuation 分页拉 clist：f12 代码、f115 市盈率 TTM、f23 市净率、f26 上市日期（yyyymmdd）。
+func (e *EastMoneyProvider) Valuation(ctx context.Context) ([]ValuationRow, error) {
+	var out []ValuationRow
+	for page := 1; ; page++ {
+		q := url.Values{
+			"pn": {strconv.Itoa(page)}, "pz": {strconv.Itoa(emListPageSz)}, "po": {"0"}, "np": {"1"},
+			"fltt": {"2"}, "fid": {"f12"}, "fs": {emMarkets}, "fields": {"f12,f23,f26,f115"},
+		}
+		var resp struct {
+			Data *struct {
+				Total int              `json:"total"`
+				Diff  []map[string]any `json:"diff"`
+			} `json:"data"`
+		}
+		if err := getJSON(ctx, e.client, e.quoteURL+"/api/qt/clist/get?"+q.Encode(), emReferer, &resp); err != nil {
+			return nil, fmt.Errorf("东财估值表第 %d 页: %w", page, err)
+		}
+		if resp.Data == nil {
+			return out, nil
+		}
+		for _, it := range resp.Data.Diff {
+			code, _ := it["f12"].(string)
+			if code == "" {
+				continue
+			}
+			row := ValuationRow{Symbol: code, PETTM: emNum(it["f115"]), PB: emNum(it["f23"])}
+			if d := emNum(it["f26"]); d > 0 {
+				row.ListingDate = normDate(strconv.Itoa(int(d)))
+			}
+			out = append(out, row)
+		}
+		if len(resp.Data.Diff) < emListPageSz || len(out) >= resp.Data.Total {
+			return out, nil
+		}
+	}
+}
+
+// Detail f57 代码、f58 名称、f84 总股本、f127 行业、f128 地域板块（如「上海板块」）。
+func (e *EastMoneyProvider) Detail(ctx context.Context, symbol string) (*StockDetail, error) {
+	q := url.Values{"secid": {secid(symbol)}, "fltt": {"2"}, "fields": {"f57,f58,f84,f127,f128"}}
+	var resp struct {
+		Data map[string]any `json:"data"`
+	}
+	if err := getJSON(ctx, e.client, e.quoteURL+"/api/qt/stock/get?"+q.Encode(), emReferer, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Data == nil {
+		return nil, fmt.Errorf("%w: 东财没有 %s", ErrNotSupported, symbol)
+	}
+	str := func(k string) string {
+		s, _ := resp.Data[k].(string)
+		if s == "-" {
+			return ""
+		}
+		return s
+	}
+	return &StockDetail{
+		Symbol:      symbol,
+		Name:        str("f58"),
+		Industry:    str("f127"),
+		Area:        strings.TrimSuffix(str("f128"), "板块"),
+		Market:      boardOf(symbol),
+		TotalShares: emNum(resp.Data["f84"]),
+	}, nil
+}
+
+// CorporateActions 分红送转明细，东财按每 10 股给出，这里换算成每股。
+// 配股不在这张表里，RightsRatio / RightsPrice 留 0；还没到除权日的预案跳过。
+func (e *EastMoneyProvider) CorporateActions(ctx context.Context, symbol string) ([]models.StockCorporateAction, error) {
+	q := url.Values{
+		"reportName": {"RPT_SHAREBONUS_DET"},
+		"columns":    {"SECURITY_CODE,EX_DIVIDEND_DATE,PRETAX_BONUS_RMB,BONUS_RATIO,IT_RATIO"},
+		"filter":     {fmt.Sprintf(`(SECURITY_CODE="%s")`, symbol)},
+		"pageSize":   {"500"}, "sortColumns": {"EX_DIVIDEND_DATE"}, "sortTypes": {"1"},
+	}
+	var resp struct {
+		Result *struct {
+			Data []map[string]any `json:"data"`
+		} `json:"result"`
+	}
+	if err := getJSON(ctx, e.client, e.dataURL+"/api/data/v1/get?"+q.Encode(), emReferer, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Result == nil {
+		return nil, nil // 从未分红送转
+	}
+	out := make([]models.StockCorporateAction, 0, len(resp.Result.Data))
+	for _, it := range resp.Result.Data {
+		ex, _ := it["EX_DIVIDEND_DATE"].(string)
+		d, err := time.Parse("2006-01-02", normDate(ex))
+		if err != nil {
+			continue
+		}
+		out = append(out, models.StockCorporateAction{
+			Symbol:        symbol,
+			ExDate:        d,
+			CashDividend:  emNum(it["PRETAX_BONUS_RMB"]) / 10,
+			BonusRatio:    emNum(it["BONUS_RATIO"]) / 10,
+			TransferRatio: emNum(it["IT_RATIO"]) / 10,
+			Source:        "eastmoney",
+		})
+	}
+	return out, nil
+}
@@ -0,0 +1,415 @@
+package fetcher
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"oh-my-stock/models"
+)
+
+// ============================================================
+// fixture：回放本地录制的 CSV / JSON，离线跑通整条抓取链路（开发、测试、断网）
+//
+// 目录结构（options.dir，默认 cache）：
+//
+//	sh_stocks.csv / sz_stocks.csv / cy_stocks.csv   股票列表（交易所、东财导出格式）
+//	company_info.txt                                 上市时间、总股本
+//	industry_map.csv                                 代码 → 行业板块
+//	daily/<symbol>.csv|json                          日 K：日期 开盘 最高 最低 收盘 成交量 成交额
+//	moneyflow/<symbol>.csv|json                      资金流：日期 主力净流入 散户净流入 …
+//	actions/<symbol>.csv|json                        除权除息：除权除息日 每股派现 每股送股 …
+//
+// 表头中英文都认（见下面各 *Cols）。JSON 是对象数组，键名与 CSV 表头相同。
+// 没有录制某只股票时返回 ErrNotSupported，交给故障转移链的下一个数据源。
+// ============================================================
+
+func init() {
+	Register("fixture", func(opts map[string]string) (Provider, error) {
+		dir := opts["dir"]
+		if dir == "" {
+			dir = "cache"
+		}
+		if st, err := os.Stat(dir); err != nil || !st.IsDir() {
+			return nil, fmt.Errorf("fixture 目录 %q 不存在", dir)
+		}
+		return NewFixtureProvider(dir), nil
+	})
+}
+
+// FixtureProvider 本地回放数据源。
+type FixtureProvider struct {
+	dir string
+
+	once   sync.Once
+	stocks map[string]*fixtureStock
+	order  []string
+	err    error
+}
+
+type fixtureStock struct {
+	name        string
+	listingDate string
+	industry    string
+	totalShares float64
+	pe, pb      float64
+}
+
+// NewFixtureProvider 回放 dir 下的录制文件。
+func NewFixtureProvider(dir string) *FixtureProvider {
+	return &FixtureProvider{dir: dir}
+}
+
+func (f *FixtureProvider) Name() string { return "fixture" }
+
+func (f *FixtureProvider) List(_ context.Context) ([]*SinaStock, error) {
+	if err := f.load(); err != nil {
+		return nil, err
+	}
+	out := make([]*SinaStock, 0, len(f.order))
+	for _, sym := range f.order {
+		out = append(out, &SinaStock{Code: sym, Name: f.stocks[sym].name})
+	}
+	return out, nil
+}
+
+func (f *FixtureProvider) Valuation(_ context.Context) ([]ValuationRow, error) {
+	if err := f.load(); err != nil {
+		return nil, err
+	}
+	out := make([]ValuationRow, 0, len(f.order))
+	for _, sym := range f.order {
+		s := f.stocks[sym]
+		out = append(out, ValuationRow{Symbol: sym, PETTM: s.pe, PB: s.pb, ListingDate: s.listingDate})
+	}
+	return out, nil
+}
+
+func (f *FixtureProvider) Detail(_ context.Context, symbol string) (*StockDetail, error) {
+	if err := f.load(); err != nil {
+		return nil, err
+	}
+	s, ok := f.stocks[symbol]
+	if !ok {
+		return nil, fmt.Errorf("%w: fixture 没有 %s", ErrNotSupported, symbol)
+	}
+	return &StockDetail{
+		Symbol:      symbol,
+		Name:        s.name,
+		Industry:    s.industry,
+		Market:      boardOf(symbol),
+		TotalShares: s.totalShares,
+	}, nil
+}
+
+var dailyCols = map[string][]string{
+	"day":      {"day", "date", "trade_date", "日期"},
+	"open":     {"open", "开盘"},
+	"high":     {"high", "最高"},
+	"low":      {"low", "最低"},
+	"close":    {"close", "收盘"},
+	"volume":   {"volume", "成交量"},
+	"turnover": {"turnover", "amount", "成交额"},
+}
+
+func (f *FixtureProvider) Daily(_ context.Context, symbol string, days int) ([]SinaDaily, error) {
+	recs, err := f.series("daily", symbol, dailyCols)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]SinaDaily, 0, len(recs))
+	for _, r := range recs {
+		out = append(out, SinaDaily{
+			Day:      normDate(r["day"]),
+			Open:     num(r["open"]),
+			High:     num(r["high"]),
+			Low:      num(r["low"]),
+			Close:    num(r["close"]),
+			Volume:   num(r["volume"]),
+			Turnover: num(r["turnover"]),
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Day < out[j].Day })
+	if days > 0 && len(out) > days {
+		out = out[len(out)-days:]
+	}
+	return out, nil
+}
+
+var moneyFlowCols = map[string][]string{
+	"day":    {"day", "date", "trade_date", "日期"},
+	"main":   {"main_net", "主力净流入", "主力净流入-净额"},
+	"retail": {"retail_net", "散户净流入", "小单净流入-净额"},
+	"large":  {"large_order_ratio", "大单成交占比"},
+	"medium": {"medium_order_ratio", "中单成交占比"},
+	"small":  {"small_order_ratio", "小单成交占比"},
+}
+
+func (f *FixtureProvider) MoneyFlow(_ context.Context, symbol string, days int) ([]models.StockMoneyFlow, error) {
+	recs, err := f.series("moneyflow", symbol, moneyFlowCols)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]models.StockMoneyFlow, 0, len(recs))
+	for _, r := range recs {
+		d, err := time.Parse("2006-01-02", normDate(r["day"]))
+		if err != nil {
+			continue
+		}
+		out = append(out, models.StockMoneyFlow{
+			Symbol:           symbol,
+			TradeDate:        d,
+			MainNet:          numPtr(r["main"]),
+			RetailNet:        numPtr(r["retail"]),
+			LargeOrderRatio:  numPtr(r["large"]),
+			MediumOrderRatio: numPtr(r["medium"]),
+			SmallOrderRatio:  numPtr(r["small"]),
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].TradeDate.Before(out[j].TradeDate) })
+	if days > 0 && len(out) > days {
+		out = out[len(out)-days:]
+	}
+	return out, nil
+}
+
+var actionCols = map[string][]string{
+	"ex_date":  {"ex_date", "除权除息日"},
+	"cash":     {"cash_dividend", "每股派现"},
+	"bonus":    {"bonus_ratio", "每股送股"},
+	"transfer": {"transfer_ratio", "每股转增"},
+	"rights":   {"rights_ratio", "每股配股"},
+	"price":    {"rights_price", "配股价"},
+}
+
+func (f *FixtureProvider) CorporateActions(_ context.Context, symbol string) ([]models.StockCorporateAction, error) {
+	recs, err := f.series("actions", symbol, actionCols)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]models.StockCorporateAction, 0, len(recs))
+	for _, r := range recs {
+		d, err := time.Parse("2006-01-02", normDate(r["ex_date"]))
+		if err != nil {
+			continue
+		}
+		out = append(out, models.StockCorporateAction{
+			Symbol:        symbol,
+			ExDate:        d,
+			CashDividend:  num(r["cash"]),
+			BonusRatio:    num(r["bonus"]),
+			TransferRatio: num(r["transfer"]),
+			RightsRatio:   num(r["rights"]),
+			RightsPrice:   num(r["price"]),
+			Source:        "fixture",
+		})
+	}
+	return out, nil
+}
+
+// ============================================================
+// 静态表：列表 / 估值 / 个股资料
+// ============================================================
+
+func (f *FixtureProvider) load() error {
+	f.once.Do(func() {
+		f.stocks = map[string]*fixtureStock{}
+		get := func(sym string) *fixtureStock {
+			s, ok := f.stocks[sym]
+			if !ok {
+				s = &fixtureStock{}
+				f.stocks[sym] = s
+				f.order = append(f.order, sym)
+			}
+			return s
+		}
+		tables := []struct {
+			file string
+			cols map[string][]string
+			fill func(s *fixtureStock, r map[string]string)
+		}{
+			{"sh_stocks.csv", map[string][]string{"code": {"证券代码"}, "name": {"证券简称"}, "listing": {"上市日期"}},
+				func(s *fixtureStock, r map[string]string) { s.name, s.listingDate = r["name"], normDate(r["listing"]) }},
+			{"sz_stocks.csv", map[string][]string{"code": {"A股代码"}, "name": {"A股简称"}, "listing": {"A股上市日期"}, "total": {"A股总股本"}, "industry": {"所属行业"}},
+				func(s *fixtureStock, r map[string]string) {
+					s.name, s.listingDate, s.totalShares = r["name"], normDate(r["listing"]), num(r["total"])
+					// "J 金融业" → "金融业"
+					if i := strings.LastIndex(r["industry"], " "); i >= 0 {
+						s.industry = r["industry"][i+1:]
+					} else {
+						s.industry = r["industry"]
+					}
+				}},
+			{"cy_stocks.csv", map[string][]string{"code": {"代码"}, "name": {"名称"}, "pe": {"市盈率-动态"}, "pb": {"市净率"}},
+				func(s *fixtureStock, r map[string]string) {
+					if s.name == "" {
+						s.name = r["name"]
+					}
+					s.pe, s.pb = num(r["pe"]), num(r["pb"])
+				}},
+			{"company_info.txt", map[string][]string{"code": {"symbol"}, "name": {"股票简称"}, "listing": {"上市时间"}, "total": {"总股本"}},
+				func(s *fixtureStock, r map[string]string) {
+					if s.name == "" {
+						s.name = r["name"]
+					}
+					if s.listingDate == "" {
+						s.listingDate = normDate(r["listing"])
+					}
+					if s.totalShares == 0 {
+						s.totalShares = num(r["total"])
+					}
+				}},
+			{"industry_map.csv", map[string][]string{"code": {"代码"}, "industry": {"板块名称"}},
+				func(s *fixtureStock, r map[string]string) { s.industry = r["industry"] }},
+		}
+		for _, t := range tables {
+			recs, err := readTable(filepath.Join(f.dir, t.file), t.cols)
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				f.err = err
+				return
+			}
+			for _, r := range recs {
+				sym := strings.TrimSpace(r["code"])
+				if len(sym) != 6 {
+					continue
+				}
+				if t.file != "sh_stocks.csv" && t.file != "sz_stocks.csv" && t.file != "cy_stocks.csv" {
+					// 补充表只补已有股票，不凭空加入列表
+					if _, ok := f.stocks[sym]; !ok {
+						continue
+					}
+				}
+				t.fill(get(sym), r)
+			}
+		}
+		sort.Strings(f.order)
+	})
+	return f.err
+}
+
+// ============================================================
+// 文件读取
+// ============================================================
+
+// series 读取 <kind>/<symbol>.csv 或 .json。
+func (f *FixtureProvider) series(kind, symbol string, cols map[string][]string) ([]map[string]string, error) {
+	for _, ext := range []string{".csv", ".json"} {
+		recs, err := readTable(filepath.Join(f.dir, kind, symbol+ext), cols)
+		if os.IsNotExist(err) {
+			continue
+		}
+		return recs, err
+	}
+	return nil, fmt.Errorf("%w: fixture 没有 %s/%s", ErrNotSupported, kind, symbol)
+}
+
+// readTable 读 CSV（.csv/.txt）或 JSON 对象数组，按 cols 的别名把列归一成统一的键。
+func readTable(path string, cols map[string][]string) ([]map[string]string, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	raw = bytes.TrimPrefix(raw, []byte("\ufeff"))
+
+	var rows []map[string]string
+	if strings.HasSuffix(path, ".json") {
+		var objs []map[string]interface{}
+		if err := json.Unmarshal(raw, &objs); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		for _, o := range objs {
+			r := make(map[string]string, len(o))
+			for k, v := range o {
+				r[k] = fmt.Sprint(v)
+			}
+			rows = append(rows, r)
+		}
+	} else {
+		cr := csv.NewReader(bytes.NewReader(raw))
+		cr.FieldsPerRecord = -1
+		all, err := cr.ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if len(all) == 0 {
+			return nil, nil
+		}
+		header := all[0]
+		for _, rec := range all[1:] {
+			r := make(map[string]string, len(header))
+			for i, h := range header {
+				if i < len(rec) {
+					r[strings.TrimSpace(h)] = rec[i]
+				}
+			}
+			rows = append(rows, r)
+		}
+	}
+
+	out := make([]map[string]string, 0, len(rows))
+	for _, r := range rows {
+		n := make(map[string]string, len(cols))
+		for key, aliases := range cols {
+			for _, a := range aliases {
+				if v, ok := r[a]; ok {
+					n[key] = strings.TrimSpace(v)
+					break
+				}
+			}
+		}
+		out = append(out, n)
+	}
+	return out, nil
+}
+
+// normDate 20240603 / 2024/06/03 / 2024-06-03 → 2024-06-03。
+func normDate(s string) string {
+	s = strings.TrimSpace(strings.ReplaceAll(s, "/", "-"))
+	if len(s) == 8 && !strings.Contains(s, "-") {
+		return s[:4] + "-" + s[4:6] + "-" + s[6:]
+	}
+	if len(s) > 10 {
+		s = s[:10]
+	}
+	return s
+}
+
+// num 解析数字，容忍千分位逗号；空值、"-" 等记为 0。
+func num(s string) float64 {
+	v, _ := strconv.ParseFloat(strings.ReplaceAll(strings.TrimSpace(s), ",", ""), 64)
+	return v
+}
+
+func numPtr(s string) *float64 {
+	v, err := strconv.ParseFloat(strings.ReplaceAll(strings.TrimSpace(s), ",", ""), 64)
+	if err != nil {
+		return nil
+	}
+	return &v
+}
+
+// boardOf 由代码前缀推断板块。
+func boardOf(code string) string {
+	switch {
+	case strings.HasPrefix(code, "300"), strings.HasPrefix(code, "301"):
+		return "创业板"
+	case strings.HasPrefix(code, "688"):
+		return "科创板"
+	case MarketFromSymbol(code) == "bj":
+		return "北交所"
+	default:
+		return "主板"
+	}
+}
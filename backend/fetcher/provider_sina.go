@@ -0,0 +1,129 @@
+package fetcher
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"oh-my-stock/models"
+)
+
+// ============================================================
+// sina：新浪财经行情接口
+//
+//	List   vip.stock.finance.sina.com.cn  Market_Center.getHQNodeData（沪深 A 股，分页）
+//	Daily  money.finance.sina.com.cn      CN_MarketData.getKLineData（scale=240 日 K，不复权）
+//
+// 资金流、估值、个股资料、除权除息新浪不提供（ErrNotSupported），由链上的 eastmoney 补。
+// 请求一律走 NewHTTPClient，按 Host 限流（fetch.rate_limits.hosts）。
+// options.list_url / kline_url 可改接口地址（测试、代理）。
+// ============================================================
+
+const (
+	sinaListURL    = "https://vip.stock.finance.sina.com.cn/quotes_service/api/json_v2.php/Market_Center.getHQNodeData"
+	sinaKLineURL   = "https://money.finance.sina.com.cn/quotes_service/api/json_v2.php/CN_MarketData.getKLineData"
+	sinaReferer    = "https://finance.sina.com.cn/"
+	sinaListPageSz = 100
+)
+
+func init() {
+	Register("sina", func(opts map[string]string) (Provider, error) {
+		return NewSinaProvider(opts["list_url"], opts["kline_url"]), nil
+	})
+}
+
+// SinaProvider 新浪行情数据源。
+type SinaProvider struct {
+	listURL  string
+	klineURL string
+	client   *http.Client
+}
+
+// NewSinaProvider 空地址用默认接口。
+func NewSinaProvider(listURL, klineURL string) *SinaProvider {
+	if listURL == "" {
+		listURL = sinaListURL
+	}
+	if klineURL == "" {
+		klineURL = sinaKLineURL
+	}
+	return &SinaProvider{listURL: listURL, klineURL: klineURL, client: NewHTTPClient(upstreamTimeout)}
+}
+
+func (s *SinaProvider) Name() string { return "sina" }
+
+// List 分页拉 hs_a 节点，直到某页不满。
+func (s *SinaProvider) List(ctx context.Context) ([]*SinaStock, error) {
+	var out []*SinaStock
+	for page := 1; ; page++ {
+		q := url.Values{
+			"page": {strconv.Itoa(page)}, "num": {strconv.Itoa(sinaListPageSz)},
+			"sort": {"symbol"}, "asc": {"1"}, "node": {"hs_a"},
+		}
+		var items []struct {
+			Code string `json:"code"`
+			Name string `json:"name"`
+		}
+		if err := getJSON(ctx, s.client, s.listURL+"?"+q.Encode(), sinaReferer, &items); err != nil {
+			return nil, fmt.Errorf("新浪股票列表第 %d 页: %w", page, err)
+		}
+		for _, it := range items {
+			if it.Code != "" {
+				out = append(out, &SinaStock{Code: it.Code, Name: it.Name})
+			}
+		}
+		if len(items) < sinaListPageSz {
+			return out, nil
+		}
+	}
+}
+
+// Daily 新浪日 K，数值都是字符串；没有该股票时接口返回 null。
+func (s *SinaProvider) Daily(ctx context.Context, symbol string, days int) ([]SinaDaily, error) {
+	q := url.Values{
+		"symbol": {MarketFromSymbol(symbol) + symbol},
+		"scale":  {"240"}, "ma": {"no"}, "datalen": {strconv.Itoa(days)},
+	}
+	var items []struct {
+		Day    string `json:"day"`
+		Open   string `json:"open"`
+		High   string `json:"high"`
+		Low    string `json:"low"`
+		Close  string `json:"close"`
+		Volume string `json:"volume"`
+		Amount string `json:"amount"`
+	}
+	if err := getJSON(ctx, s.client, s.klineURL+"?"+q.Encode(), sinaReferer, &items); err != nil {
+		return nil, err
+	}
+	if items == nil {
+		return nil, fmt.Errorf("%w: 新浪没有 %s 的日 K", ErrNotSupported, symbol)
+	}
+	out := make([]SinaDaily, 0, len(items))
+	for _, it := range items {
+		out = append(out, SinaDaily{
+			Day:  normDate(it.Day),
+			Open: num(it.Open), High: num(it.High), Low: num(it.Low), Close: num(it.Close),
+			Volume: num(it.Volume), Turnover: num(it.Amount),
+		})
+	}
+	return out, nil
+}
+
+func (s *SinaProvider) MoneyFlow(context.Context, string, int) ([]models.StockMoneyFlow, error) {
+	return nil, ErrNotSupported
+}
+
+func (s *SinaProvider) Valuation(context.Context) ([]ValuationRow, error) {
+	return nil, ErrNotSupported
+}
+
+func (s *SinaProvider) Detail(context.Context, string) (*StockDetail, error) {
+	return nil, ErrNotSupported
+}
+
+func (s *SinaProvider) CorporateActions(context.Context, string) ([]models.StockCorporateAction, error) {
+	return nil, ErrNotSupported
+}
@@ -0,0 +1,159 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"oh-my-stock/models"
+)
+
+const fixtureDir = "testdata/fixture"
+
+// fakeProvider 只实现 Daily，其余能力不支持。
+type fakeProvider struct {
+	name  string
+	err   error
+	calls int
+}
+
+func (p *fakeProvider) Name() string { return p.name }
+func (p *fakeProvider) List(context.Context) ([]*SinaStock, error) {
+	return nil, ErrNotSupported
+}
+func (p *fakeProvider) Daily(_ context.Context, symbol string, _ int) ([]SinaDaily, error) {
+	p.calls++
+	if p.err != nil {
+		return nil, p.err
+	}
+	return []SinaDaily{{Day: "2024-06-03", Close: 1}}, nil
+}
+func (p *fakeProvider) MoneyFlow(context.Context, string, int) ([]models.StockMoneyFlow, error) {
+	return nil, ErrNotSupported
+}
+func (p *fakeProvider) Valuation(context.Context) ([]ValuationRow, error) {
+	return nil, ErrNotSupported
+}
+func (p *fakeProvider) Detail(context.Context, string) (*StockDetail, error) {
+	return nil, ErrNotSupported
+}
+func (p *fakeProvider) CorporateActions(context.Context, string) ([]models.StockCorporateAction, error) {
+	return nil, ErrNotSupported
+}
+
+func TestFailover_FallsThroughOnError(t *testing.T) {
+	bad := &fakeProvider{name: "bad", err: errors.New("boom")}
+	good := &fakeProvider{name: "good"}
+	rows, err := Failover(bad, good).Daily(context.Background(), "600000", 5)
+	if err != nil || len(rows) != 1 {
+		t.Fatalf("rows=%v err=%v", rows, err)
+	}
+	if bad.calls != 1 || good.calls != 1 {
+		t.Fatalf("calls bad=%d good=%d", bad.calls, good.calls)
+	}
+}
+
+func TestFailover_ErrorsWhenAllFail(t *testing.T) {
+	boom := errors.New("boom")
+	p := Failover(&fakeProvider{name: "a", err: ErrNotSupported}, &fakeProvider{name: "b", err: boom})
+	if _, err := p.Daily(context.Background(), "600000", 5); !errors.Is(err, boom) {
+		t.Fatalf("err = %v", err)
+	}
+	// 全部不支持
+	if _, err := p.List(context.Background()); !errors.Is(err, ErrNotSupported) {
+		t.Fatalf("err = %v", err)
+	}
+	// 已取消的 ctx 不再调用
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	good := &fakeProvider{name: "good"}
+	if _, err := Failover(good).Daily(ctx, "600000", 5); !errors.Is(err, context.Canceled) || good.calls != 0 {
+		t.Fatalf("err=%v calls=%d", err, good.calls)
+	}
+}
+
+func TestInitProviders(t *testing.T) {
+	defer SetProvider(Active())
+	if err := InitProviders([]string{"nope"}, nil); err == nil {
+		t.Fatal("未注册的数据源应报错")
+	}
+	if err := InitProviders([]string{"fixture"}, map[string]map[string]string{"fixture": {"dir": "testdata/missing"}}); err == nil {
+		t.Fatal("目录不存在应报错")
+	}
+	// 建不起来的数据源跳过，其余照常组链
+	if err := InitProviders([]string{"nope", "fixture"}, map[string]map[string]string{"fixture": {"dir": fixtureDir}}); err != nil {
+		t.Fatal(err)
+	}
+	if rows, err := FetchRecentDaily(context.Background(), "600000", 1); err != nil || len(rows) != 1 {
+		t.Fatalf("skip failed provider: rows=%v err=%v", rows, err)
+	}
+	if err := InitProviders(nil, map[string]map[string]string{"fixture": {"dir": fixtureDir}}); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := FetchRecentDaily(context.Background(), "600000", 2)
+	if err != nil || len(rows) != 2 || rows[1].Day != "2024-06-05" {
+		t.Fatalf("rows=%v err=%v", rows, err)
+	}
+}
+
+func TestFixture_ListValuationDetail(t *testing.T) {
+	p := NewFixtureProvider(fixtureDir)
+	ctx := context.Background()
+
+	list, err := p.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// industry_map 里多出来的 999999 不进列表
+	if len(list) != 2 || list[0].Code != "000001" || list[1].Name != "浦发银行" {
+		t.Fatalf("list = %+v %+v", list[0], list[len(list)-1])
+	}
+
+	vals, _ := p.Valuation(ctx)
+	if vals[1].ListingDate != "1999-11-10" {
+		t.Fatalf("valuation = %+v", vals)
+	}
+
+	d, err := p.Detail(ctx, "000001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Industry != "金融业" || d.TotalShares != 19405918198 || d.Market != "主板" {
+		t.Fatalf("detail = %+v", d)
+	}
+	if d, _ := p.Detail(ctx, "600000"); d.Industry != "银行" {
+		t.Fatalf("industry_map 应补行业: %+v", d)
+	}
+	if _, err := p.Detail(ctx, "300750"); !errors.Is(err, ErrNotSupported) {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestFixture_Series(t *testing.T) {
+	p := NewFixtureProvider(fixtureDir)
+	ctx := context.Background()
+
+	// CSV 中文表头，乱序录制，返回升序的最近 N 根
+	rows, err := p.Daily(ctx, "600000", 10)
+	if err != nil || len(rows) != 3 || rows[0].Day != "2024-06-03" || rows[2].Close != 7.20 {
+		t.Fatalf("rows=%+v err=%v", rows, err)
+	}
+	// JSON，紧凑日期
+	rows, err = p.Daily(ctx, "000001", 10)
+	if err != nil || len(rows) != 1 || rows[0].Day != "2024-06-03" || rows[0].Volume != 1000 {
+		t.Fatalf("rows=%+v err=%v", rows, err)
+	}
+	if _, err := p.Daily(ctx, "300750", 10); !errors.Is(err, ErrNotSupported) {
+		t.Fatalf("err = %v", err)
+	}
+
+	flows, err := p.MoneyFlow(ctx, "600000", 10)
+	if err != nil || len(flows) != 2 || *flows[0].MainNet != -1200.5 || flows[1].RetailNet != nil {
+		t.Fatalf("flows=%+v err=%v", flows, err)
+	}
+
+	acts, err := p.CorporateActions(ctx, "600000")
+	if err != nil || len(acts) != 1 || acts[0].CashDividend != 0.1 || acts[0].ExDate.Format("2006-01-02") != "2024-06-04" {
+		t.Fatalf("acts=%+v err=%v", acts, err)
+	}
+}
@@ -0,0 +1,192 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"oh-my-stock/config"
+)
+
+// upstreamServer 回放新浪 / 东财接口的录制响应；path 不在 routes 里时返回 500。
+func upstreamServer(t *testing.T, routes map[string]string) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := routes[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestSinaProvider(t *testing.T) {
+	var gotSymbol string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/kline":
+			gotSymbol = r.URL.Query().Get("symbol")
+			if gotSymbol == "sz300750" {
+				w.Write([]byte("null"))
+				return
+			}
+			w.Write([]byte(`[{"day":"2024-06-03","open":"7.000","high":"7.100","low":"6.950","close":"7.050","volume":"100"},
+				{"day":"2024-06-04","open":"7.050","high":"7.150","low":"7.000","close":"7.100","volume":"200","amount":"1420"}]`))
+		case "/list":
+			if r.URL.Query().Get("page") == "1" {
+				w.Write([]byte(`[{"symbol":"sh600000","code":"600000","name":"浦发银行"},{"symbol":"sz000001","code":"000001","name":"平安银行"}]`))
+				return
+			}
+			w.Write([]byte(`[]`))
+		}
+	}))
+	defer srv.Close()
+	p := NewSinaProvider(srv.URL+"/list", srv.URL+"/kline")
+	ctx := context.Background()
+
+	rows, err := p.Daily(ctx, "600000", 2)
+	if err != nil || len(rows) != 2 || gotSymbol != "sh600000" {
+		t.Fatalf("rows=%+v err=%v symbol=%s", rows, err, gotSymbol)
+	}
+	if rows[1].Day != "2024-06-04" || rows[1].Close != 7.1 || rows[1].Volume != 200 || rows[1].Turnover != 1420 {
+		t.Fatalf("row = %+v", rows[1])
+	}
+	if _, err := p.Daily(ctx, "300750", 2); !errors.Is(err, ErrNotSupported) {
+		t.Fatalf("接口返回 null 应交给下一个数据源, err = %v", err)
+	}
+	list, err := p.List(ctx)
+	if err != nil || len(list) != 2 || list[1].Code != "000001" || list[1].Name != "平安银行" {
+		t.Fatalf("list=%+v err=%v", list, err)
+	}
+	if _, err := p.MoneyFlow(ctx, "600000", 5); !errors.Is(err, ErrNotSupported) {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestEastMoneyProvider(t *testing.T) {
+	srv := upstreamServer(t, map[string]string{
+		"/api/qt/stock/fflow/daykline/get": `{"rc":0,"data":{"code":"600000","klines":[
+			"2024-06-03,-12005000.0,8000000.0,4005000.0,-5000000.0,-7005000.0",
+			"2024-06-04,30000000.0,-,1.0,2.0,3.0"]}}`,
+		"/api/qt/clist/get": `{"rc":0,"data":{"total":2,"diff":[
+			{"f12":"600000","f23":0.41,"f26":19991110,"f115":4.9},
+			{"f12":"000001","f23":"-","f26":"-","f115":"-"}]}}`,
+		"/api/qt/stock/get": `{"rc":0,"data":{"f57":"600000","f58":"浦发银行","f84":29352178996.0,"f127":"银行","f128":"上海板块"}}`,
+		"/api/data/v1/get": `{"success":true,"result":{"data":[
+			{"SECURITY_CODE":"600000","EX_DIVIDEND_DATE":"2024-07-19 00:00:00","PRETAX_BONUS_RMB":3.21,"BONUS_RATIO":null,"IT_RATIO":null},
+			{"SECURITY_CODE":"600000","EX_DIVIDEND_DATE":null,"PRETAX_BONUS_RMB":4.1}]}}`,
+	})
+	p := NewEastMoneyProvider(srv.URL, srv.URL, srv.URL)
+	ctx := context.Background()
+
+	flows, err := p.MoneyFlow(ctx, "600000", 2)
+	if err != nil || len(flows) != 2 || *flows[0].MainNet != -12005000 || *flows[0].RetailNet != 8000000 {
+		t.Fatalf("flows=%+v err=%v", flows, err)
+	}
+	if flows[1].RetailNet != nil || flows[1].LargeOrderRatio != nil {
+		t.Fatalf("缺失值应为 NULL: %+v", flows[1])
+	}
+
+	vals, err := p.Valuation(ctx)
+	if err != nil || len(vals) != 2 {
+		t.Fatalf("vals=%+v err=%v", vals, err)
+	}
+	if vals[0].PETTM != 4.9 || vals[0].PB != 0.41 || vals[0].ListingDate != "1999-11-10" || vals[1].ListingDate != "" {
+		t.Fatalf("vals = %+v", vals)
+	}
+
+	d, err := p.Detail(ctx, "600000")
+	if err != nil || d.Name != "浦发银行" || d.Industry != "银行" || d.Area != "上海" || d.Market != "主板" || d.TotalShares != 29352178996 {
+		t.Fatalf("detail=%+v err=%v", d, err)
+	}
+
+	acts, err := p.CorporateActions(ctx, "600000")
+	if err != nil || len(acts) != 1 || acts[0].ExDate.Format("2006-01-02") != "2024-07-19" || acts[0].CashDividend != 0.321 {
+		t.Fatalf("acts=%+v err=%v", acts, err)
+	}
+}
+
+// 新浪挂了（HTTP 500）：经 FetchRecentDaily 走故障转移链，落到本地回放。
+func TestFetch_FallsBackFromFailingUpstream(t *testing.T) {
+	useFetchConfig(t, config.FetchConfig{
+		Retry:   config.RetryConfig{MaxAttempts: 2, BaseMS: 1, MaxMS: 1, BudgetRatio: 1, BudgetMin: 100},
+		Breaker: config.BreakerConfig{FailureThreshold: 100, CooldownSec: 60},
+	})
+	defer SetProvider(Active())
+	var sinaCalls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sinaCalls++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+	before := providerStats("sina")
+
+	err := InitProviders([]string{"sina", "eastmoney", "fixture"}, map[string]map[string]string{
+		"sina":    {"list_url": srv.URL + "/list", "kline_url": srv.URL + "/kline"},
+		"fixture": {"dir": fixtureDir},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := FetchRecentDaily(context.Background(), "600000", 2)
+	if err != nil || len(rows) != 2 || rows[1].Day != "2024-06-05" {
+		t.Fatalf("应回落到 fixture: rows=%+v err=%v", rows, err)
+	}
+	if sinaCalls != 2 {
+		t.Fatalf("新浪应按重试策略请求 2 次, got %d", sinaCalls)
+	}
+	if got := providerStats("sina").Failures - before.Failures; got != 2 {
+		t.Fatalf("sina failures = %d", got)
+	}
+}
+
+// 限流作用在数据源的真实请求上：同一 Host 的令牌桶由不同数据源、不同能力的请求共享。
+func TestProviders_RateLimitedPerHost(t *testing.T) {
+	srv := upstreamServer(t, map[string]string{
+		"/kline":                           `[{"day":"2024-06-03","open":"7","high":"7","low":"7","close":"7","volume":"1"}]`,
+		"/api/qt/stock/fflow/daykline/get": `{"data":{"klines":[]}}`,
+	})
+	host := mustHost(t, srv.URL)
+	useFetchConfig(t, config.FetchConfig{RateLimits: config.RateLimits{
+		Hosts: map[string]config.RateLimit{host: {RPS: 20, Burst: 1}},
+	}})
+	before := hostStats(host)
+	sina := NewSinaProvider(srv.URL+"/list", srv.URL+"/kline")
+	em := NewEastMoneyProvider(srv.URL, srv.URL, srv.URL)
+	ctx := context.Background()
+
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		if _, err := sina.Daily(ctx, "600000", 1); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := em.MoneyFlow(ctx, "600000", 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if el := time.Since(start); el < 140*time.Millisecond {
+		t.Fatalf("20 rps / burst 1 四个请求至少 150ms, got %s", el)
+	}
+	hs := hostStats(host)
+	if hs.Requests-before.Requests != 4 || hs.Waited-before.Waited != 3 {
+		t.Fatalf("host metrics = %+v", hs)
+	}
+
+	// 上游 429：计入限流指标，并作为失败交给 Guard
+	busy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer busy.Close()
+	if _, err := NewSinaProvider("", busy.URL).Daily(ctx, "600000", 1); err == nil {
+		t.Fatal("HTTP 429 应报错")
+	}
+	if hostStats(mustHost(t, busy.URL)).Throttled != 1 {
+		t.Fatalf("429 未计入限流指标: %+v", hostStats(mustHost(t, busy.URL)))
+	}
+}
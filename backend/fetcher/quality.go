@@ -0,0 +1,223 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"gorm.io/gorm/clause"
+
+	"oh-my-stock/config"
+	"oh-my-stock/models"
+	"oh-my-stock/quality"
+)
+
+// ErrQuarantineState 隔离记录当前状态不允许该操作（已放行的不能再丢弃）。
+var ErrQuarantineState = errors.New("该记录当前状态不能执行此操作")
+
+// AdmitDaily 日 K 入库前的数据质量校验（规则见 quality 包）。
+//
+// 返回可以入库的行，按日期升序、涨跌幅已按前一根收盘价算好；没通过的写入 stock_daily_quarantine 待复核，
+// 返回其条数。管理员复核过的同一根 K 线（价量完全相同）按复核结论处理：放行过的直接入库，丢弃过的直接忽略。
+// source 记录数据来源（fetch / import）。
+func AdmitDaily(symbol, source string, rows []models.StockDailyData) ([]models.StockDailyData, int, error) {
+	if len(rows) == 0 {
+		return nil, 0, nil
+	}
+	first := rows[0].TradeDate
+	for _, r := range rows {
+		if r.TradeDate.Before(first) {
+			first = r.TradeDate
+		}
+	}
+
+	var qc quality.Context
+	var basic models.StockBasicInfo
+	if err := config.DB.Select("name", "listing_date").Where("symbol = ?", symbol).Limit(1).Find(&basic).Error; err != nil {
+		return nil, 0, fmt.Errorf("读取股票资料: %w", err)
+	}
+	qc.Name, qc.ListingDate = basic.Name, basic.ListingDate
+	var prev []models.StockDailyData
+	if err := config.DB.Where("symbol = ? AND trade_date < ?", symbol, first).
+		Order("trade_date DESC").Limit(1).Find(&prev).Error; err != nil {
+		return nil, 0, fmt.Errorf("读取前一根日 K: %w", err)
+	}
+	if len(prev) > 0 {
+		qc.Prev = &prev[0]
+	}
+	if err := config.DB.Where("symbol = ? AND ex_date >= ?", symbol, first.AddDate(0, -1, 0)).
+		Order("ex_date").Find(&qc.Actions).Error; err != nil {
+		return nil, 0, fmt.Errorf("读取除权除息事件: %w", err)
+	}
+
+	ok, bad := quality.Check(symbol, rows, qc)
+	quarantined := 0
+	if len(bad) > 0 {
+		reviewed, err := reviewedBars(symbol, bad)
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, b := range bad {
+			switch reviewed[barKey(b.Row)] {
+			case models.QuarantineAdmitted:
+				ok = append(ok, b.Row)
+				continue
+			case models.QuarantineRejected:
+				continue
+			}
+			if err := quarantine(b, source); err != nil {
+				return nil, 0, err
+			}
+			quarantined++
+		}
+		sort.Slice(ok, func(i, j int) bool { return ok[i].TradeDate.Before(ok[j].TradeDate) })
+	}
+
+	prevClose := 0.0
+	if qc.Prev != nil {
+		prevClose = qc.Prev.Close
+	}
+	for i := range ok {
+		fillChange(&ok[i], prevClose)
+		prevClose = ok[i].Close
+	}
+	return ok, quarantined, nil
+}
+
+// fillChange 按前收盘价算涨跌额、涨跌幅；没有前收盘时清零。
+func fillChange(r *models.StockDailyData, prevClose float64) {
+	r.ChangeAmount, r.ChangePercent = 0, 0
+	if prevClose != 0 {
+		r.ChangeAmount = Round4(r.Close - prevClose)
+		r.ChangePercent = Round4((r.Close - prevClose) / prevClose * 100)
+	}
+}
+
+// barKey 日期 + 价量，判断是不是复核过的同一根 K 线。
+func barKey(r models.StockDailyData) string {
+	return fmt.Sprintf("%s|%g|%g|%g|%g|%d|%g", r.TradeDate.Format("2006-01-02"),
+		r.Open, r.High, r.Low, r.Close, r.Volume, r.Turnover)
+}
+
+// reviewedBars 这些日期上已复核的隔离记录，同一根 K 线取最近一次结论。
+func reviewedBars(symbol string, bad []quality.Issue) (map[string]string, error) {
+	dates := make([]string, 0, len(bad))
+	for _, b := range bad {
+		dates = append(dates, b.Row.TradeDate.Format("2006-01-02"))
+	}
+	var qs []models.StockDailyQuarantine
+	if err := config.DB.Where("symbol = ? AND trade_date IN ? AND status <> ?", symbol, dates, models.QuarantinePending).
+		Order("reviewed_at").Find(&qs).Error; err != nil {
+		return nil, fmt.Errorf("读取隔离记录: %w", err)
+	}
+	out := make(map[string]string, len(qs))
+	for _, q := range qs {
+		out[barKey(q.Bar())] = q.Status
+	}
+	return out, nil
+}
+
+// quarantine 写入待复核记录；同一根 K 线已在待复核中时更新为最新抓到的值。
+func quarantine(b quality.Issue, source string) error {
+	q := models.StockDailyQuarantine{
+		Symbol: b.Row.Symbol, TradeDate: b.Row.TradeDate,
+		Open: b.Row.Open, High: b.Row.High, Low: b.Row.Low, Close: b.Row.Close,
+		Volume: b.Row.Volume, Turnover: b.Row.Turnover,
+		Reason: string(b.Reason), Detail: b.Detail, Source: source,
+		Status: models.QuarantinePending,
+	}
+	err := config.DB.Clauses(clause.OnConflict{
+		Columns:     []clause.Column{{Name: "symbol"}, {Name: "trade_date"}},
+		TargetWhere: clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "status = 'pending'"}}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"open", "high", "low", "close", "volume", "turnover", "reason", "detail", "source", "updated_at",
+		}),
+	}).Create(&q).Error
+	if err != nil {
+		return fmt.Errorf("写入隔离记录: %w", err)
+	}
+	return nil
+}
+
+// QuarantineFilter 隔离记录查询条件，空字段不过滤。
+type QuarantineFilter struct {
+	Status string
+	Symbol string
+	Reason string
+}
+
+// ListQuarantine 按 ID 倒序分页。
+func ListQuarantine(f QuarantineFilter, offset, limit int) ([]models.StockDailyQuarantine, int64, error) {
+	q := config.DB.Model(&models.StockDailyQuarantine{})
+	if f.Status != "" {
+		q = q.Where("status = ?", f.Status)
+	}
+	if f.Symbol != "" {
+		q = q.Where("symbol = ?", f.Symbol)
+	}
+	if f.Reason != "" {
+		q = q.Where("reason = ?", f.Reason)
+	}
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var out []models.StockDailyQuarantine
+	err := q.Order("id DESC").Offset(offset).Limit(limit).Find(&out).Error
+	return out, total, err
+}
+
+// AdmitQuarantined 放行一条待复核（或曾被丢弃）的 K 线：写入 stock_daily_data，
+// 重算此后的涨跌幅、复权因子，指标和公式全量重算，后台刷新 stock_history_mv。
+func AdmitQuarantined(id int64, by string) (*models.StockDailyQuarantine, error) {
+	var q models.StockDailyQuarantine
+	if err := config.DB.First(&q, id).Error; err != nil {
+		return nil, err
+	}
+	if q.Status == models.QuarantineAdmitted {
+		return nil, ErrQuarantineState
+	}
+	bar := q.Bar()
+	// 导入时隔离的可能是很早的月份
+	if _, err := EnsurePartitions(context.Background(), bar.TradeDate, bar.TradeDate); err != nil {
+		return nil, fmt.Errorf("建分区: %w", err)
+	}
+	if _, err := UpsertDaily([]models.StockDailyData{bar}); err != nil {
+		return nil, fmt.Errorf("写入日 K: %w", err)
+	}
+	now := time.Now()
+	q.Status, q.ReviewedBy, q.ReviewedAt = models.QuarantineAdmitted, by, &now
+	if err := config.DB.Save(&q).Error; err != nil {
+		return nil, err
+	}
+	if err := markFilled(q.Symbol, q.TradeDate); err != nil {
+		log.Printf("⚠️ %s 更新补抓记录失败: %v", q.Symbol, err)
+	}
+	set, err := LoadFormulaSet()
+	if err != nil {
+		log.Printf("⚠️ %s 计算自定义公式失败: %v", q.Symbol, err)
+	}
+	HistoryChanged(q.Symbol, q.TradeDate, set)
+	RequestHistoryMVRefresh()
+	return &q, nil
+}
+
+// RejectQuarantined 确认是坏数据。之后再抓到价量完全相同的 K 线直接忽略。
+func RejectQuarantined(id int64, by string) (*models.StockDailyQuarantine, error) {
+	var q models.StockDailyQuarantine
+	if err := config.DB.First(&q, id).Error; err != nil {
+		return nil, err
+	}
+	if q.Status != models.QuarantinePending {
+		return nil, ErrQuarantineState
+	}
+	now := time.Now()
+	q.Status, q.ReviewedBy, q.ReviewedAt = models.QuarantineRejected, by, &now
+	if err := config.DB.Save(&q).Error; err != nil {
+		return nil, err
+	}
+	return &q, nil
+}
@@ -0,0 +1,129 @@
+package fetcher
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ============================================================
+// 按上游 Host 限流：每个 Host 一个令牌桶，所有数据源、所有并发 goroutine 共享，
+// 并发数再高，打到同一个上游的请求速率也不会超过配置。
+// ============================================================
+
+// TokenBucket 令牌桶：每秒补 rate 个，最多攒 burst 个。rate <= 0 不限流。
+type TokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+}
+
+// NewTokenBucket 初始是满桶。
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &TokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), now: time.Now}
+}
+
+// reserve 取一个令牌，返回需要等待的时间（令牌可以透支，排在后面的等得更久）。
+func (b *TokenBucket) reserve() time.Duration {
+	if b.rate <= 0 {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	b.last = now
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// cancelReservation 等待被取消时把令牌还回去。
+func (b *TokenBucket) cancelReservation() {
+	if b.rate <= 0 {
+		return
+	}
+	b.mu.Lock()
+	b.tokens++
+	b.mu.Unlock()
+}
+
+// Wait 阻塞到拿到令牌或 ctx 结束，返回实际等待时间。
+func (b *TokenBucket) Wait(ctx context.Context) (time.Duration, error) {
+	d := b.reserve()
+	if d <= 0 {
+		return 0, nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		b.cancelReservation()
+		return 0, ctx.Err()
+	case <-t.C:
+		return d, nil
+	}
+}
+
+var (
+	limitersMu sync.Mutex
+	limiters   = map[string]*TokenBucket{}
+)
+
+// limiterFor host 对应的令牌桶，首次使用时按当前策略创建。
+func limiterFor(host string) *TokenBucket {
+	limitersMu.Lock()
+	defer limitersMu.Unlock()
+	if b, ok := limiters[host]; ok {
+		return b
+	}
+	rl := currentPolicy().RateLimits.Default
+	if h, ok := currentPolicy().RateLimits.Hosts[host]; ok {
+		rl = h
+	}
+	b := NewTokenBucket(rl.RPS, rl.Burst)
+	limiters[host] = b
+	return b
+}
+
+// WaitHost 按 host 限流，数据源自己发请求（非 HTTPClient）时调用。
+func WaitHost(ctx context.Context, host string) error {
+	d, err := limiterFor(host).Wait(ctx)
+	metrics.host(host).observe(d)
+	return err
+}
+
+// NewHTTPClient 访问上游用的 http.Client：每个请求先过目标 Host 的令牌桶，429/503 计入限流指标。
+// HTTP 数据源都应通过它发请求。
+func NewHTTPClient(timeout time.Duration) *http.Client {
+	return &http.Client{Timeout: timeout, Transport: &limitedTransport{base: http.DefaultTransport}}
+}
+
+type limitedTransport struct {
+	base http.RoundTripper
+}
+
+func (t *limitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := WaitHost(req.Context(), req.URL.Host); err != nil {
+		return nil, err
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err == nil && (resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable) {
+		metrics.host(req.URL.Host).throttled.Add(1)
+	}
+	return resp, err
+}
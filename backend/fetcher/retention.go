@@ -0,0 +1,289 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"oh-my-stock/calendar"
+	"oh-my-stock/config"
+	"oh-my-stock/indicators"
+	"oh-my-stock/models"
+)
+
+// ============================================================
+// 数据保留：按表配置保留的交易日数（config.retention），过期数据按自然月归档成 .csv.gz 后删除。
+//
+// 保留窗口按交易日计（长假期间不会多删），删除界线再退到所在月的 1 日：只整月归档、整月删除，
+// 一个月一个归档文件，不会被切成几段；实际保留的会比 keep_days 多出不到一个月。
+// 从归档装回的区间登记在 retention_holds，到期前不裁剪（见 importer.Restore）。
+// 按月分区的表（见 partitions.go）过期的月份归档后直接 DROP 分区，不逐行删除。
+// ============================================================
+
+// CoverageDays 日 K 完整性检查和缺口补抓看的交易日数，也是日 K 保留天数的下限：
+// 不能小于 indicators.WindowBars，否则全量重算指标时窗口不够。更早的历史靠 import 导入。
+const CoverageDays = indicators.WindowBars + 40
+
+// KeepForever keep_days 取这个值时永久保留。
+const KeepForever = -1
+
+// retentionTable 可配置保留策略的表及其默认值。
+type retentionTable struct {
+	name    string
+	dateCol string
+	keys    []string // 唯一键，装回时按它合并
+	minKeep int      // keep_days 下限
+	keep    int      // 默认 keep_days
+	archive bool     // 默认是否归档
+}
+
+var retentionTables = []retentionTable{
+	{"stock_daily_data", "trade_date", []string{"symbol", "trade_date"}, CoverageDays, 1250, true},
+	{"stock_indicators", "calc_date", []string{"symbol", "calc_date"}, CoverageDays, 1250, true},
+	// 规则里连续净流入最多看 40 个交易日
+	{"stock_money_flow", "trade_date", []string{"symbol", "trade_date"}, 60, 250, true},
+	{"stock_money_flow_all", "trade_date", []string{"symbol", "trade_date", "time_span"}, 1, KeepForever, true},
+	{"target_trend_stock", "matched_at", []string{"symbol", "rule_name", "matched_at"}, 1, KeepForever, false},
+}
+
+// RetentionPolicy 一张表生效的保留策略。
+type RetentionPolicy struct {
+	Table    string `json:"table"`
+	DateCol  string `json:"date_column"`
+	KeepDays int    `json:"keep_days"` // -1 永久保留
+	Archive  bool   `json:"archive"`
+	keys     []string
+}
+
+var retention = struct {
+	mu       sync.RWMutex
+	dir      string
+	policies []RetentionPolicy
+}{dir: "archive"}
+
+func init() {
+	retention.policies, _ = resolveRetention(config.RetentionConfig{})
+}
+
+// ConfigureRetention 设置保留策略（启动时调用）。配置里不支持的表、低于下限的天数打日志后忽略 / 取下限。
+func ConfigureRetention(c config.RetentionConfig) {
+	policies, warnings := resolveRetention(c)
+	for _, w := range warnings {
+		log.Printf("⚠️ retention: %s", w)
+	}
+	retention.mu.Lock()
+	retention.policies = policies
+	retention.dir = c.ArchiveDir
+	if retention.dir == "" {
+		retention.dir = "archive"
+	}
+	retention.mu.Unlock()
+}
+
+// resolveRetention 默认值叠加配置。
+func resolveRetention(c config.RetentionConfig) ([]RetentionPolicy, []string) {
+	var warnings []string
+	known := map[string]bool{}
+	policies := make([]RetentionPolicy, 0, len(retentionTables))
+	for _, t := range retentionTables {
+		known[t.name] = true
+		p := RetentionPolicy{Table: t.name, DateCol: t.dateCol, KeepDays: t.keep, Archive: t.archive, keys: t.keys}
+		if o, ok := c.Tables[t.name]; ok {
+			switch {
+			case o.KeepDays == 0:
+			case o.KeepDays == KeepForever:
+				p.KeepDays = KeepForever
+			case o.KeepDays < t.minKeep:
+				warnings = append(warnings, fmt.Sprintf("%s keep_days=%d 低于下限，按 %d", t.name, o.KeepDays, t.minKeep))
+				p.KeepDays = t.minKeep
+			default:
+				p.KeepDays = o.KeepDays
+			}
+			if o.Archive != nil {
+				p.Archive = *o.Archive
+			}
+		}
+		policies = append(policies, p)
+	}
+	for name := range c.Tables {
+		if !known[name] {
+			warnings = append(warnings, fmt.Sprintf("不支持的表 %s，忽略", name))
+		}
+	}
+	return policies, warnings
+}
+
+// RetentionPolicies 所有表的保留策略。
+func RetentionPolicies() []RetentionPolicy {
+	retention.mu.RLock()
+	defer retention.mu.RUnlock()
+	return append([]RetentionPolicy(nil), retention.policies...)
+}
+
+// RetentionPolicyFor 某张表的保留策略，不支持的表返回 false。
+func RetentionPolicyFor(table string) (RetentionPolicy, bool) {
+	for _, p := range RetentionPolicies() {
+		if p.Table == table {
+			return p, true
+		}
+	}
+	return RetentionPolicy{}, false
+}
+
+// ArchiveDir 归档文件的根目录。
+func ArchiveDir() string {
+	retention.mu.RLock()
+	defer retention.mu.RUnlock()
+	return retention.dir
+}
+
+// RetentionCutoff 保留 days 个已收盘交易日时的界线：trade_date 早于它的超出窗口。
+func RetentionCutoff(now time.Time, days int) time.Time {
+	return calendar.PrevTradingDay(calendar.LatestSettled(now), days-1)
+}
+
+// ExpireBefore 实际的删除界线：RetentionCutoff 所在月的 1 日，早于它的整月过期。
+func ExpireBefore(now time.Time, days int) time.Time {
+	c := RetentionCutoff(now, days)
+	return time.Date(c.Year(), c.Month(), 1, 0, 0, 0, 0, c.Location())
+}
+
+// PurgeResult 一张表一次裁剪的结果。
+type PurgeResult struct {
+	Table  string    `json:"table"`
+	Before time.Time `json:"before"`
+	Months int       `json:"months"` // 删除的月数
+	Rows   int64     `json:"rows"`
+	Files  []string  `json:"files,omitempty"`
+	Held   int       `json:"held"` // 在保留期内（装回过）跳过的月数
+}
+
+// PurgeExpired 按策略裁剪一张表：早于 ExpireBefore 的月份逐月归档（策略要求时）再删除，
+// 每个月一个事务，失败的月份原样留在库里，下次再试。
+func PurgeExpired(ctx context.Context, table string) (PurgeResult, error) {
+	p, ok := RetentionPolicyFor(table)
+	if !ok {
+		return PurgeResult{}, fmt.Errorf("不支持的表 %s", table)
+	}
+	res := PurgeResult{Table: table}
+	if p.KeepDays == KeepForever {
+		return res, nil
+	}
+	now := time.Now()
+	res.Before = ExpireBefore(now, p.KeepDays)
+	if table == "stock_daily_data" {
+		// 完整性检查窗口外的缺口记录没用了
+		cutoff := RetentionCutoff(now, CoverageDays).Format("2006-01-02")
+		if err := config.DB.Where("trade_date < ?", cutoff).Delete(&models.StockDailyMissing{}).Error; err != nil {
+			return res, err
+		}
+	}
+
+	months, err := expiredMonths(ctx, p, res.Before)
+	if err != nil {
+		return res, err
+	}
+	var holds []models.RetentionHold
+	if len(months) > 0 {
+		if err := config.DB.Where("table_name = ? AND hold_until > ?", table, now).Find(&holds).Error; err != nil {
+			return res, err
+		}
+	}
+	var errs []error
+	for _, em := range months {
+		m := em.month
+		if err := ctx.Err(); err != nil {
+			return res, err
+		}
+		if monthHeld(holds, m) {
+			res.Held++
+			continue
+		}
+		var (
+			n   int64
+			err error
+		)
+		if p.Archive {
+			var f models.ArchiveFile
+			if f, err = archiveMonth(ctx, p, m, em.name); err == nil && f.Path != "" {
+				n = f.Rows
+				res.Files = append(res.Files, f.Path)
+			}
+		} else {
+			n, err = deleteMonth(ctx, p, m, em.name)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s %s: %w", table, m.Format("2006-01"), err))
+			continue
+		}
+		res.Months++
+		res.Rows += n
+	}
+	return res, errors.Join(errs...)
+}
+
+// monthHeld 该月是否和某个保留区间有交集。
+func monthHeld(holds []models.RetentionHold, month time.Time) bool {
+	end := month.AddDate(0, 1, -1)
+	for _, h := range holds {
+		if !h.FromDate.After(end) && !h.ToDate.Before(month) {
+			return true
+		}
+	}
+	return false
+}
+
+// expiredMonths 早于 before 的月份。分区表按分区列（name 为分区名），普通表按数据里出现的月份。
+func expiredMonths(ctx context.Context, p RetentionPolicy, before time.Time) ([]monthPartition, error) {
+	db := config.DB.WithContext(ctx)
+	partitioned, err := isPartitioned(db, p.Table)
+	if err != nil {
+		return nil, err
+	}
+	if partitioned {
+		parts, err := listPartitions(db, p.Table)
+		if err != nil {
+			return nil, err
+		}
+		var expired []monthPartition
+		for _, mp := range parts {
+			if mp.month.Before(monthStart(before)) {
+				expired = append(expired, mp)
+			}
+		}
+		return expired, nil
+	}
+	var months []time.Time
+	if err := db.Raw(fmt.Sprintf(
+		"SELECT DISTINCT date_trunc('month', %s)::date FROM %s WHERE %s < ? ORDER BY 1", p.DateCol, p.Table, p.DateCol),
+		before.Format("2006-01-02")).Scan(&months).Error; err != nil {
+		return nil, err
+	}
+	expired := make([]monthPartition, len(months))
+	for i, m := range months {
+		expired[i] = monthPartition{month: m}
+	}
+	return expired, nil
+}
+
+func deleteMonth(ctx context.Context, p RetentionPolicy, month time.Time, partition string) (int64, error) {
+	if partition != "" {
+		var n int64
+		err := config.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Raw("SELECT count(*) FROM " + partition).Scan(&n).Error; err != nil {
+				return err
+			}
+			return tx.Exec("DROP TABLE " + partition).Error
+		})
+		forgetPartition(partition)
+		return n, err
+	}
+	res := config.DB.WithContext(ctx).Exec(fmt.Sprintf("DELETE FROM %s WHERE %s >= ? AND %s < ?", p.Table, p.DateCol, p.DateCol),
+		month.Format("2006-01-02"), month.AddDate(0, 1, 0).Format("2006-01-02"))
+	return res.RowsAffected, res.Error
+}
@@ -0,0 +1,96 @@
+package fetcher
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"oh-my-stock/calendar"
+	"oh-my-stock/config"
+	"oh-my-stock/models"
+)
+
+func TestRetentionCutoff(t *testing.T) {
+	// 2024-06-11 盘中：最近已收盘是 06-07，保留 3 个交易日 → 06-05 起
+	now := time.Date(2024, 6, 11, 10, 0, 0, 0, calendar.Shanghai)
+	if got := RetentionCutoff(now, 3).Format("2006-01-02"); got != "2024-06-05" {
+		t.Fatalf("cutoff = %s", got)
+	}
+	// 收盘后当天计入
+	now = time.Date(2024, 6, 11, 16, 0, 0, 0, calendar.Shanghai)
+	if got := RetentionCutoff(now, 1).Format("2006-01-02"); got != "2024-06-11" {
+		t.Fatalf("cutoff = %s", got)
+	}
+}
+
+func TestExpireBefore(t *testing.T) {
+	// 保留 3 个交易日的界线是 06-05，整月删除 → 只删 5 月及以前
+	now := time.Date(2024, 6, 11, 10, 0, 0, 0, calendar.Shanghai)
+	if got := ExpireBefore(now, 3).Format("2006-01-02"); got != "2024-06-01" {
+		t.Fatalf("before = %s", got)
+	}
+}
+
+func TestResolveRetention(t *testing.T) {
+	no := false
+	policies, warnings := resolveRetention(config.RetentionConfig{Tables: map[string]config.RetentionPolicy{
+		"stock_daily_data":   {KeepDays: 10},                // 低于下限
+		"stock_money_flow":   {KeepDays: 500, Archive: &no}, // 覆盖默认
+		"target_trend_stock": {KeepDays: 20},
+		"stock_indicators":   {KeepDays: KeepForever},
+		"users":              {KeepDays: 1}, // 不支持
+	}})
+	if len(warnings) != 2 {
+		t.Errorf("warnings = %v", warnings)
+	}
+	got := map[string]RetentionPolicy{}
+	for _, p := range policies {
+		got[p.Table] = p
+	}
+	if len(got) != len(retentionTables) {
+		t.Fatalf("policies = %+v", policies)
+	}
+	if p := got["stock_daily_data"]; p.KeepDays != CoverageDays || !p.Archive {
+		t.Errorf("daily = %+v", p)
+	}
+	if p := got["stock_money_flow"]; p.KeepDays != 500 || p.Archive {
+		t.Errorf("money flow = %+v", p)
+	}
+	if p := got["target_trend_stock"]; p.KeepDays != 20 || p.Archive {
+		t.Errorf("target = %+v", p)
+	}
+	if p := got["stock_indicators"]; p.KeepDays != KeepForever {
+		t.Errorf("indicators = %+v", p)
+	}
+	// 没配置的取默认值
+	if p := got["stock_money_flow_all"]; p.KeepDays != KeepForever || !p.Archive {
+		t.Errorf("money flow all = %+v", p)
+	}
+}
+
+func TestMonthHeld(t *testing.T) {
+	d := func(s string) time.Time {
+		v, _ := time.Parse("2006-01-02", s)
+		return v
+	}
+	holds := []models.RetentionHold{{FromDate: d("2023-03-15"), ToDate: d("2023-05-02")}}
+	for m, want := range map[string]bool{
+		"2023-02-01": false,
+		"2023-03-01": true,
+		"2023-04-01": true,
+		"2023-05-01": true,
+		"2023-06-01": false,
+	} {
+		if got := monthHeld(holds, d(m)); got != want {
+			t.Errorf("monthHeld(%s) = %v", m, got)
+		}
+	}
+}
+
+func TestArchivePath(t *testing.T) {
+	at := time.Date(2024, 7, 1, 17, 30, 5, 0, calendar.Shanghai)
+	got := archivePath("/data/archive", "stock_daily_data", time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC), at)
+	if got != filepath.Join("/data/archive", "stock_daily_data", "2021-03_20240701T173005.csv.gz") {
+		t.Errorf("path = %s", got)
+	}
+}
@@ -0,0 +1,81 @@
+package fetcher
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Backoff 指数退避：第 n 次重试等 base·2^n（不超过 max），再随机缩短至多 jitter 比例，
+// 避免大量并发请求在同一时刻一起重试。
+type Backoff struct {
+	Base   time.Duration
+	Max    time.Duration
+	Jitter float64
+}
+
+// Delay 第 attempt 次重试（从 0 开始）前的等待时间。
+func (b Backoff) Delay(attempt int) time.Duration {
+	d := float64(b.Base) * math.Pow(2, float64(attempt))
+	if b.Max > 0 && d > float64(b.Max) {
+		d = float64(b.Max)
+	}
+	if b.Jitter > 0 {
+		d *= 1 - b.Jitter*rand.Float64()
+	}
+	return time.Duration(d)
+}
+
+// sleepCtx 等 d 或 ctx 结束。
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// RetryBudget 重试预算：每个首次请求攒 ratio 个额度，每次重试花 1 个，额度不超过 max，
+// 初始给 min 个。上游大面积故障时首次请求失败率高，额度很快花完，之后失败直接返回，
+// 重试流量最多是正常流量的 ratio 倍。
+type RetryBudget struct {
+	mu     sync.Mutex
+	ratio  float64
+	max    float64
+	tokens float64
+}
+
+// NewRetryBudget ratio <= 0 表示不限重试次数（只受 max_attempts 约束）。
+func NewRetryBudget(ratio float64, min int) *RetryBudget {
+	m := float64(min)
+	if m < 1 {
+		m = 1
+	}
+	return &RetryBudget{ratio: ratio, max: m * 10, tokens: m}
+}
+
+// Deposit 记一次首次请求。
+func (b *RetryBudget) Deposit() {
+	b.mu.Lock()
+	b.tokens = math.Min(b.max, b.tokens+b.ratio)
+	b.mu.Unlock()
+}
+
+// Withdraw 申请一次重试，预算不足返回 false。
+func (b *RetryBudget) Withdraw() bool {
+	if b.ratio <= 0 {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
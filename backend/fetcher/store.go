@@ -0,0 +1,123 @@
+package fetcher
+
+import (
+	"time"
+
+	"gorm.io/gorm/clause"
+
+	"oh-my-stock/config"
+	"oh-my-stock/models"
+)
+
+// 抓取结果入库。全部按业务唯一键 upsert，重复抓取同一天不会产生重复行。
+
+// CountBasicInfo stock_basic_info 行数。
+func CountBasicInfo() int64 {
+	var n int64
+	config.DB.Model(&models.StockBasicInfo{}).Count(&n)
+	return n
+}
+
+// ListAllSymbols stock_basic_info 里全部代码，按代码排序。
+func ListAllSymbols() []string {
+	var out []string
+	config.DB.Model(&models.StockBasicInfo{}).Order("symbol").Pluck("symbol", &out)
+	return out
+}
+
+// ActiveSymbolsSince since 当天及以后有日 K 的代码。
+func ActiveSymbolsSince(since time.Time) []string {
+	var out []string
+	config.DB.Model(&models.StockDailyData{}).
+		Where("trade_date >= ?", since.Format("2006-01-02")).
+		Distinct("symbol").Order("symbol").Pluck("symbol", &out)
+	return out
+}
+
+// UpsertBasicInfo 列表入库：只写代码、名称、状态，不覆盖已补全的行业等字段。
+func UpsertBasicInfo(rows []models.StockBasicInfo) (int, error) {
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	err := config.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "symbol"}},
+		DoUpdates: clause.AssignmentColumns([]string{"name", "status", "updated_at"}),
+	}).CreateInBatches(rows, 500).Error
+	if err != nil {
+		return 0, err
+	}
+	return len(rows), nil
+}
+
+// UpsertBasicInfoWithValuation 个股资料 + 估值入库（detail / 估值表补全）。
+func UpsertBasicInfoWithValuation(rows []models.StockBasicInfo) (int, error) {
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	err := config.DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "symbol"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"name", "industry", "area", "market", "status", "total_shares",
+			"pettm", "pb", "listing_date", "updated_at",
+		}),
+	}).CreateInBatches(rows, 500).Error
+	if err != nil {
+		return 0, err
+	}
+	return len(rows), nil
+}
+
+// UpsertDaily 日 K 按 (symbol, trade_date) upsert。
+func UpsertDaily(rows []models.StockDailyData) (int, error) {
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	err := config.DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "symbol"}, {Name: "trade_date"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"open", "high", "low", "close", "volume", "turnover",
+			"change_percent", "change_amount", "turnover_rate", "amplitude",
+		}),
+	}).CreateInBatches(rows, 500).Error
+	if err != nil {
+		return 0, err
+	}
+	return len(rows), nil
+}
+
+// UpsertMoneyFlowDaily 资金流按 (symbol, trade_date) upsert。
+func UpsertMoneyFlowDaily(rows []models.StockMoneyFlow) (int, error) {
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	err := config.DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "symbol"}, {Name: "trade_date"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"main_net", "retail_net", "large_order_ratio", "medium_order_ratio", "small_order_ratio",
+		}),
+	}).CreateInBatches(rows, 500).Error
+	if err != nil {
+		return 0, err
+	}
+	return len(rows), nil
+}
+
+// UpsertIndicators 技术指标按 (symbol, calc_date) upsert。
+func UpsertIndicators(rows []models.StockIndicator) (int, error) {
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	err := config.DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "symbol"}, {Name: "calc_date"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"ma5", "ma10", "ma20", "ma60", "ma120", "ma250",
+			"macd", "dif", "dea", "k", "d", "j", "rsi6", "rsi12", "rsi24",
+			"boll_upper", "boll_mid", "boll_lower",
+			"atr14", "obv", "cci14", "wr6", "wr10", "pdi", "mdi", "adx", "adxr", "vwap",
+		}),
+	}).CreateInBatches(rows, 500).Error
+	if err != nil {
+		return 0, err
+	}
+	return len(rows), nil
+}
@@ -0,0 +1,253 @@
+package formula
+
+import (
+	"math"
+
+	"oh-my-stock/indicators"
+)
+
+// funcSpec 内置函数签名。periods 标记哪些参数是周期常量（从 0 开始的下标）。
+type funcSpec struct {
+	arity     int
+	periods   []int
+	minPeriod int // 周期参数下限（不支持 N=0 的「从第一根起累计」：结果取决于求值窗口从哪天开始）
+	fn        func(args [][]float64, periods []int) []float64
+}
+
+func (f funcSpec) isPeriod(i int) bool {
+	for _, x := range f.periods {
+		if x == i {
+			return true
+		}
+	}
+	return false
+}
+
+var funcs = map[string]funcSpec{
+	"REF":      {arity: 2, periods: []int{1}, fn: func(a [][]float64, p []int) []float64 { return ref(a[0], p[0]) }},
+	"MA":       {arity: 2, periods: []int{1}, minPeriod: 1, fn: func(a [][]float64, p []int) []float64 { return indicators.MA(a[0], p[0]) }},
+	"EMA":      {arity: 2, periods: []int{1}, minPeriod: 1, fn: func(a [][]float64, p []int) []float64 { return indicators.EMA(a[0], p[0]) }},
+	"SMA":      {arity: 3, periods: []int{1, 2}, minPeriod: 1, fn: func(a [][]float64, p []int) []float64 { return sma(a[0], p[0], p[1]) }},
+	"STD":      {arity: 2, periods: []int{1}, minPeriod: 2, fn: func(a [][]float64, p []int) []float64 { return indicators.STD(a[0], p[0]) }},
+	"HHV":      {arity: 2, periods: []int{1}, minPeriod: 1, fn: func(a [][]float64, p []int) []float64 { return window(a[0], p[0], math.Max) }},
+	"LLV":      {arity: 2, periods: []int{1}, minPeriod: 1, fn: func(a [][]float64, p []int) []float64 { return window(a[0], p[0], math.Min) }},
+	"SUM":      {arity: 2, periods: []int{1}, minPeriod: 1, fn: func(a [][]float64, p []int) []float64 { return window(a[0], p[0], add) }},
+	"COUNT":    {arity: 2, periods: []int{1}, minPeriod: 1, fn: func(a [][]float64, p []int) []float64 { return window(truth(a[0]), p[0], add) }},
+	"EVERY":    {arity: 2, periods: []int{1}, minPeriod: 1, fn: func(a [][]float64, p []int) []float64 { return window(truth(a[0]), p[0], math.Min) }},
+	"EXIST":    {arity: 2, periods: []int{1}, minPeriod: 1, fn: func(a [][]float64, p []int) []float64 { return window(truth(a[0]), p[0], math.Max) }},
+	"IF":       {arity: 3, fn: func(a [][]float64, p []int) []float64 { return ifThen(a[0], a[1], a[2]) }},
+	"IFF":      {arity: 3, fn: func(a [][]float64, p []int) []float64 { return ifThen(a[0], a[1], a[2]) }},
+	"CROSS":    {arity: 2, fn: func(a [][]float64, p []int) []float64 { return cross(a[0], a[1]) }},
+	"BARSLAST": {arity: 1, fn: func(a [][]float64, p []int) []float64 { return barsLast(a[0]) }},
+	"NOT": {arity: 1, fn: func(a [][]float64, p []int) []float64 {
+		return mapf(a[0], func(x float64) float64 { return b2f(x == 0) })
+	}},
+	"ABS": {arity: 1, fn: func(a [][]float64, p []int) []float64 { return mapf(a[0], math.Abs) }},
+	"MAX": {arity: 2, fn: func(a [][]float64, p []int) []float64 { return zip(a[0], a[1], math.Max) }},
+	"MIN": {arity: 2, fn: func(a [][]float64, p []int) []float64 { return zip(a[0], a[1], math.Min) }},
+}
+
+func eval(x Expr, d Data, vars map[string][]float64, n int) []float64 {
+	switch e := x.(type) {
+	case *Num:
+		out := make([]float64, n)
+		for i := range out {
+			out[i] = e.Value
+		}
+		return out
+	case *Ident:
+		if v, ok := vars[e.Name]; ok {
+			return v
+		}
+		return d.series(e.Name)
+	case *Unary:
+		return mapf(eval(e.X, d, vars, n), func(v float64) float64 { return -v })
+	case *Binary:
+		return zip(eval(e.L, d, vars, n), eval(e.R, d, vars, n), binop(e.Op))
+	case *Call:
+		fn := funcs[e.Func]
+		var args [][]float64
+		var periods []int
+		for i, a := range e.Args {
+			if fn.isPeriod(i) {
+				periods = append(periods, int(a.(*Num).Value))
+				continue
+			}
+			args = append(args, eval(a, d, vars, n))
+		}
+		return fn.fn(args, periods)
+	}
+	return nans(n)
+}
+
+func binop(op string) func(a, b float64) float64 {
+	switch op {
+	case "+":
+		return func(a, b float64) float64 { return a + b }
+	case "-":
+		return func(a, b float64) float64 { return a - b }
+	case "*":
+		return func(a, b float64) float64 { return a * b }
+	case "/":
+		return func(a, b float64) float64 {
+			if b == 0 {
+				return math.NaN()
+			}
+			return a / b
+		}
+	case ">":
+		return func(a, b float64) float64 { return b2f(a > b) }
+	case "<":
+		return func(a, b float64) float64 { return b2f(a < b) }
+	case ">=":
+		return func(a, b float64) float64 { return b2f(a >= b) }
+	case "<=":
+		return func(a, b float64) float64 { return b2f(a <= b) }
+	case "=":
+		return func(a, b float64) float64 { return b2f(a == b) }
+	case "<>":
+		return func(a, b float64) float64 { return b2f(a != b) }
+	case "AND":
+		return func(a, b float64) float64 { return b2f(a != 0 && b != 0) }
+	case "OR":
+		return func(a, b float64) float64 { return b2f(a != 0 || b != 0) }
+	}
+	return func(a, b float64) float64 { return math.NaN() }
+}
+
+// zip 逐元素运算，任一侧为 NaN 时结果为 NaN。
+func zip(a, b []float64, f func(a, b float64) float64) []float64 {
+	out := make([]float64, len(a))
+	for i := range a {
+		if math.IsNaN(a[i]) || math.IsNaN(b[i]) {
+			out[i] = math.NaN()
+			continue
+		}
+		out[i] = f(a[i], b[i])
+	}
+	return out
+}
+
+func mapf(a []float64, f func(float64) float64) []float64 {
+	out := make([]float64, len(a))
+	for i, x := range a {
+		if math.IsNaN(x) {
+			out[i] = x
+			continue
+		}
+		out[i] = f(x)
+	}
+	return out
+}
+
+func ref(xs []float64, k int) []float64 {
+	out := nans(len(xs))
+	for i := k; i < len(xs); i++ {
+		out[i] = xs[i-k]
+	}
+	return out
+}
+
+// sma 通达信 SMA(X,N,M)：Y = (M·X + (N-M)·Y') / N，首个有效值取 X。
+func sma(xs []float64, n, m int) []float64 {
+	out := nans(len(xs))
+	prev := math.NaN()
+	for i, x := range xs {
+		switch {
+		case math.IsNaN(x):
+		case math.IsNaN(prev):
+			prev = x
+		default:
+			prev = (float64(m)*x + float64(n-m)*prev) / float64(n)
+		}
+		out[i] = prev
+	}
+	return out
+}
+
+// window 滚动聚合；n=0 表示从第一根累计到当前。窗口内有 NaN 时结果为 NaN。
+func window(xs []float64, n int, f func(a, b float64) float64) []float64 {
+	return rollingReduce(xs, n, f)
+}
+
+func rollingReduce(xs []float64, n int, f func(a, b float64) float64) []float64 {
+	out := nans(len(xs))
+outer:
+	for i := n - 1; i < len(xs); i++ {
+		acc := xs[i-n+1]
+		if math.IsNaN(acc) {
+			continue
+		}
+		for _, x := range xs[i-n+2 : i+1] {
+			if math.IsNaN(x) {
+				continue outer
+			}
+			acc = f(acc, x)
+		}
+		out[i] = acc
+	}
+	return out
+}
+
+func truth(xs []float64) []float64 {
+	return mapf(xs, func(x float64) float64 { return b2f(x != 0) })
+}
+
+func ifThen(c, a, b []float64) []float64 {
+	out := make([]float64, len(c))
+	for i := range c {
+		switch {
+		case math.IsNaN(c[i]):
+			out[i] = math.NaN()
+		case c[i] != 0:
+			out[i] = a[i]
+		default:
+			out[i] = b[i]
+		}
+	}
+	return out
+}
+
+// cross A 上穿 B：当根 A>B 且前一根 A<=B。
+func cross(a, b []float64) []float64 {
+	out := nans(len(a))
+	for i := 1; i < len(a); i++ {
+		if math.IsNaN(a[i]) || math.IsNaN(b[i]) || math.IsNaN(a[i-1]) || math.IsNaN(b[i-1]) {
+			continue
+		}
+		out[i] = b2f(a[i] > b[i] && a[i-1] <= b[i-1])
+	}
+	return out
+}
+
+// barsLast 距上一次条件成立的根数，当根成立为 0；从未成立为 NaN。
+func barsLast(c []float64) []float64 {
+	out := nans(len(c))
+	last := -1
+	for i, x := range c {
+		if !math.IsNaN(x) && x != 0 {
+			last = i
+		}
+		if last >= 0 {
+			out[i] = float64(i - last)
+		}
+	}
+	return out
+}
+
+func add(a, b float64) float64 { return a + b }
+
+func b2f(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func nans(n int) []float64 {
+	out := make([]float64, n)
+	for i := range out {
+		out[i] = math.NaN()
+	}
+	return out
+}
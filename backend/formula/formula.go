@@ -0,0 +1,210 @@
+// Package formula 实现通达信/同花顺风格的指标公式语言，在 Go 里对单只股票的日 K 序列求值。
+//
+// 语法示例：
+//
+//	{ MACD 金叉 }
+//	VAR1:=EMA(C,12)-EMA(C,26);
+//	SIG:CROSS(VAR1, MA(VAR1,9)),COLORRED;
+//
+// 约定：
+//   - 标识符、函数名不区分大小写；
+//   - NAME:=expr 为中间变量，NAME:expr 与匿名 expr 为输出线；
+//   - 行情序列：O/OPEN、H/HIGH、L/LOW、C/CLOSE、V/VOL/VOLUME、AMOUNT；
+//   - 比较/逻辑运算结果为 1/0，窗口不足或参与运算的值无效时为 NaN（入库/输出为 null）；
+//   - 周期参数（REF 的 N、MA 的 N 等）必须是数字常量，上限 MaxPeriod；SUM/HHV/LLV/COUNT 不支持 N=0 累计。
+package formula
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"oh-my-stock/indicators"
+)
+
+// 输入规模限制，防止用户公式拖垮服务。
+// MaxPeriod 受求值窗口约束：规则取值和历史叠加都只读最近 2*MaxPeriod 根 K 线（见 fetcher.FormulaBars），
+// 周期再长就算不出值。
+const (
+	MaxSourceLen = 4096
+	MaxStmts     = 64
+	MaxPeriod    = 250
+)
+
+// Program 编译（解析 + 校验）后的公式。
+type Program struct {
+	Stmts   []Stmt
+	outputs []string
+}
+
+// Line 一条输出线。
+type Line struct {
+	Name   string    `json:"name"`
+	Values []float64 `json:"values"`
+}
+
+// series 内置行情序列别名。
+var series = map[string]string{
+	"O": "OPEN", "OPEN": "OPEN",
+	"H": "HIGH", "HIGH": "HIGH",
+	"L": "LOW", "LOW": "LOW",
+	"C": "CLOSE", "CLOSE": "CLOSE",
+	"V": "VOL", "VOL": "VOL", "VOLUME": "VOL",
+	"AMOUNT": "AMOUNT",
+}
+
+// Compile 解析并校验公式：函数名与参数个数、周期参数为常量、变量先定义后使用、输出名不重复。
+func Compile(src string) (*Program, error) {
+	if strings.TrimSpace(src) == "" {
+		return nil, fmt.Errorf("公式为空")
+	}
+	if len(src) > MaxSourceLen {
+		return nil, fmt.Errorf("公式过长（上限 %d 字节）", MaxSourceLen)
+	}
+	stmts, err := parseStmts(src)
+	if err != nil {
+		return nil, err
+	}
+	if len(stmts) == 0 {
+		return nil, fmt.Errorf("公式为空")
+	}
+	if len(stmts) > MaxStmts {
+		return nil, fmt.Errorf("语句过多（上限 %d 条）", MaxStmts)
+	}
+
+	p := &Program{Stmts: stmts}
+	defined := map[string]bool{}
+	anon := 0
+	for i := range p.Stmts {
+		st := &p.Stmts[i]
+		if err := check(st.X, defined); err != nil {
+			return nil, err
+		}
+		if st.Name == "" {
+			anon++
+			st.Name = "OUT" + strconv.Itoa(anon)
+		} else if _, ok := series[st.Name]; ok {
+			return nil, errorf(st.X.Pos(), "%s 是内置行情名，不能作为变量名", st.Name)
+		} else if _, ok := funcs[st.Name]; ok {
+			return nil, errorf(st.X.Pos(), "%s 是函数名，不能作为变量名", st.Name)
+		}
+		if defined[st.Name] {
+			return nil, errorf(st.X.Pos(), "变量 %s 重复定义", st.Name)
+		}
+		defined[st.Name] = true
+		if st.Output {
+			p.outputs = append(p.outputs, st.Name)
+		}
+	}
+	if len(p.outputs) == 0 {
+		return nil, fmt.Errorf("公式没有输出线（用 NAME: 而不是 NAME:= 定义输出）")
+	}
+	return p, nil
+}
+
+// Outputs 输出线名称，按定义顺序。
+func (p *Program) Outputs() []string {
+	return append([]string(nil), p.outputs...)
+}
+
+func check(x Expr, defined map[string]bool) error {
+	switch n := x.(type) {
+	case *Num:
+		return nil
+	case *Ident:
+		if _, ok := series[n.Name]; ok || defined[n.Name] {
+			return nil
+		}
+		if _, ok := funcs[n.Name]; ok {
+			return errorf(n.At, "函数 %s 缺少参数", n.Name)
+		}
+		return errorf(n.At, "未定义的变量 %s", n.Name)
+	case *Unary:
+		return check(n.X, defined)
+	case *Binary:
+		if err := check(n.L, defined); err != nil {
+			return err
+		}
+		return check(n.R, defined)
+	case *Call:
+		fn, ok := funcs[n.Func]
+		if !ok {
+			return errorf(n.At, "未知函数 %s", n.Func)
+		}
+		if len(n.Args) != fn.arity {
+			return errorf(n.At, "%s 需要 %d 个参数，实际 %d 个", n.Func, fn.arity, len(n.Args))
+		}
+		for i, a := range n.Args {
+			if fn.isPeriod(i) {
+				num, ok := a.(*Num)
+				if !ok {
+					return errorf(a.Pos(), "%s 的第 %d 个参数必须是数字常量", n.Func, i+1)
+				}
+				if num.Value != float64(int(num.Value)) || num.Value < float64(fn.minPeriod) || num.Value > MaxPeriod {
+					return errorf(a.Pos(), "%s 的第 %d 个参数应为 %d~%d 的整数", n.Func, i+1, fn.minPeriod, MaxPeriod)
+				}
+				continue
+			}
+			if err := check(a, defined); err != nil {
+				return err
+			}
+		}
+		if n.Func == "SMA" && n.Args[2].(*Num).Value > n.Args[1].(*Num).Value {
+			return errorf(n.At, "SMA(X,N,M) 要求 M <= N")
+		}
+		return nil
+	}
+	return fmt.Errorf("未知节点 %T", x)
+}
+
+// Data 求值输入：按交易日升序的行情序列，各切片等长。
+type Data struct {
+	Open, High, Low, Close, Volume, Amount []float64
+}
+
+// FromBars 把 indicators.Bar 转成求值输入（Amount 取成交额）。
+func FromBars(bars []indicators.Bar) Data {
+	d := Data{
+		Open: make([]float64, len(bars)), High: make([]float64, len(bars)),
+		Low: make([]float64, len(bars)), Close: make([]float64, len(bars)),
+		Volume: make([]float64, len(bars)), Amount: make([]float64, len(bars)),
+	}
+	for i, b := range bars {
+		d.Open[i], d.High[i], d.Low[i], d.Close[i] = b.Open, b.High, b.Low, b.Close
+		d.Volume[i], d.Amount[i] = b.Volume, b.Turnover
+	}
+	return d
+}
+
+func (d Data) series(name string) []float64 {
+	switch series[name] {
+	case "OPEN":
+		return d.Open
+	case "HIGH":
+		return d.High
+	case "LOW":
+		return d.Low
+	case "CLOSE":
+		return d.Close
+	case "VOL":
+		return d.Volume
+	case "AMOUNT":
+		return d.Amount
+	}
+	return nil
+}
+
+// Eval 对 d 求值，按定义顺序返回全部输出线，每条与输入等长。
+func (p *Program) Eval(d Data) []Line {
+	n := len(d.Close)
+	vars := map[string][]float64{}
+	var out []Line
+	for _, st := range p.Stmts {
+		v := eval(st.X, d, vars, n)
+		vars[st.Name] = v
+		if st.Output {
+			out = append(out, Line{Name: st.Name, Values: v})
+		}
+	}
+	return out
+}
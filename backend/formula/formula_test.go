@@ -0,0 +1,171 @@
+package formula
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func approx(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+
+func closes(xs ...float64) Data {
+	return Data{Open: xs, High: xs, Low: xs, Close: xs, Volume: xs, Amount: xs}
+}
+
+func run(t *testing.T, src string, d Data) map[string][]float64 {
+	t.Helper()
+	p, err := Compile(src)
+	if err != nil {
+		t.Fatalf("Compile(%q): %v", src, err)
+	}
+	out := map[string][]float64{}
+	for _, l := range p.Eval(d) {
+		out[l.Name] = l.Values
+	}
+	return out
+}
+
+func TestCompile_StatementsAndOutputs(t *testing.T) {
+	p, err := Compile(`{注释} VAR1:=EMA(C,12)-EMA(C,26); SIG:CROSS(VAR1, MA(VAR1,9)),COLORRED; // 行注释
+		c > ref(c, 1);`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := p.Outputs()
+	if len(got) != 2 || got[0] != "SIG" || got[1] != "OUT1" {
+		t.Fatalf("outputs = %v", got)
+	}
+}
+
+func TestCompile_Errors(t *testing.T) {
+	cases := map[string]string{
+		"":                        "公式为空",
+		"A:=C;":                   "没有输出线",
+		"X:FOO(C);":               "未知函数 FOO",
+		"X:MA(C);":                "需要 2 个参数",
+		"X:MA(C,N);":              "必须是数字常量",
+		"X:MA(C,0);":              "1~250 的整数",
+		"X:MA(C,251);":            "1~250 的整数",
+		"X:SUM(C,0);":             "1~250 的整数",
+		"X:REF(C,2.5);":           "整数",
+		"X:Y+1;":                  "未定义的变量 Y",
+		"X:C; X:O;":               "重复定义",
+		"C:O;":                    "内置行情名",
+		"X:C Y:O;":                "缺少分号",
+		"X:(C+1;":                 "此处应为 )",
+		"X:C,BOLD;":               "不支持的画线属性",
+		"X:SMA(C,3,5);":           "M <= N",
+		"X:C #":                   "非法字符",
+		"{ 未闭合":                   "注释未闭合",
+		"X:MA;":                   "缺少参数",
+		strings.Repeat("X", 5000): "公式过长",
+	}
+	for src, want := range cases {
+		_, err := Compile(src)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Compile(%q) err = %v, want contains %q", src, err, want)
+		}
+	}
+}
+
+func TestSyntaxError_Position(t *testing.T) {
+	_, err := Compile("A:=C;\nB:FOO(A);")
+	se, ok := err.(*SyntaxError)
+	if !ok || se.Pos.Line != 2 || se.Pos.Col != 3 {
+		t.Fatalf("err = %#v", err)
+	}
+}
+
+func TestEval_Precedence(t *testing.T) {
+	out := run(t, "X:1+2*3-4/2; Y:-C+1>0 AND 2>1 OR 0;", closes(0.5, 2))
+	if !approx(out["X"][0], 5) {
+		t.Fatalf("X = %v", out["X"])
+	}
+	if out["Y"][0] != 1 || out["Y"][1] != 0 {
+		t.Fatalf("Y = %v", out["Y"])
+	}
+}
+
+func TestEval_RefCountEverySum(t *testing.T) {
+	d := closes(1, 2, 3, 2, 3, 4)
+	out := run(t, `
+		UP:=C>REF(C,1);
+		R:REF(C,2);
+		N:COUNT(UP,3);
+		E:EVERY(UP,2);
+		X:EXIST(C>3.5,3);
+		S:SUM(C,3);
+		HH:HHV(C,3);
+		LL:LLV(C,3);`, d)
+	if !math.IsNaN(out["R"][1]) || out["R"][2] != 1 {
+		t.Fatalf("REF = %v", out["R"])
+	}
+	// UP = [NaN,1,1,0,1,1]
+	if !math.IsNaN(out["N"][2]) || out["N"][3] != 2 || out["N"][5] != 2 {
+		t.Fatalf("COUNT = %v", out["N"])
+	}
+	if out["E"][2] != 1 || out["E"][3] != 0 || out["E"][5] != 1 {
+		t.Fatalf("EVERY = %v", out["E"])
+	}
+	if out["X"][4] != 0 || out["X"][5] != 1 {
+		t.Fatalf("EXIST = %v", out["X"])
+	}
+	if !math.IsNaN(out["S"][1]) || out["S"][5] != 9 {
+		t.Fatalf("SUM(C,3) = %v", out["S"])
+	}
+	if out["HH"][3] != 3 || out["LL"][4] != 2 {
+		t.Fatalf("HHV = %v LLV = %v", out["HH"], out["LL"])
+	}
+}
+
+func TestEval_IfCrossBarsLast(t *testing.T) {
+	d := closes(3, 1, 2, 4, 1)
+	out := run(t, `
+		S:CROSS(C,2);
+		B:BARSLAST(C>=4);
+		I:IF(C>2, C, -C);
+		M:MAX(C,2)+MIN(C,2)+ABS(-1)+NOT(C>2);`, d)
+	want := []float64{math.NaN(), 0, 0, 1, 0}
+	for i := 1; i < len(want); i++ {
+		if out["S"][i] != want[i] {
+			t.Fatalf("CROSS = %v", out["S"])
+		}
+	}
+	if !math.IsNaN(out["B"][2]) || out["B"][3] != 0 || out["B"][4] != 1 {
+		t.Fatalf("BARSLAST = %v", out["B"])
+	}
+	if out["I"][0] != 3 || out["I"][1] != -1 {
+		t.Fatalf("IF = %v", out["I"])
+	}
+	if out["M"][0] != 3+2+1+0 || out["M"][1] != 2+1+1+1 {
+		t.Fatalf("MAX/MIN/ABS/NOT = %v", out["M"])
+	}
+}
+
+func TestEval_SMAMatchesTDX(t *testing.T) {
+	out := run(t, "X:SMA(C,3,1);", closes(3, 6, 9))
+	// Y1=3；Y2=(6+2*3)/3=4；Y3=(9+2*4)/3=17/3
+	if !approx(out["X"][1], 4) || !approx(out["X"][2], 17.0/3) {
+		t.Fatalf("SMA = %v", out["X"])
+	}
+}
+
+func TestEval_DivisionByZeroIsNaN(t *testing.T) {
+	out := run(t, "X:C/(C-C);", closes(1, 2))
+	if !math.IsNaN(out["X"][0]) {
+		t.Fatalf("X = %v", out["X"])
+	}
+}
+
+func TestParseExpr(t *testing.T) {
+	x, err := ParseExpr("close / ma20 >= 1.05 and -rsi6 < -70")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := x.String(); got != "(((CLOSE/MA20)>=1.05) AND ((-RSI6)<-70))" {
+		t.Fatalf("String() = %s", got)
+	}
+	if _, err := ParseExpr("close > 1;"); err == nil {
+		t.Fatal("多余的分号应报错")
+	}
+}
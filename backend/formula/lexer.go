@@ -0,0 +1,165 @@
+package formula
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNum
+	tokIdent
+	tokOp     // + - * / > < >= <= = <> AND OR
+	tokLParen // (
+	tokRParen // )
+	tokComma  // ,
+	tokSemi   // ;
+	tokAssign // :=
+	tokColon  // :
+)
+
+type token struct {
+	kind tokenKind
+	text string // 标识符已转大写；运算符已归一（== → =，!= → <>，&& → AND，|| → OR）
+	num  float64
+	pos  Pos
+}
+
+// Pos 源码位置，行列均从 1 开始。
+type Pos struct {
+	Line int
+	Col  int
+}
+
+// SyntaxError 语法/语义错误，带位置。
+type SyntaxError struct {
+	Pos Pos
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("第 %d 行第 %d 列: %s", e.Pos.Line, e.Pos.Col, e.Msg)
+}
+
+func errorf(p Pos, format string, args ...interface{}) error {
+	return &SyntaxError{Pos: p, Msg: fmt.Sprintf(format, args...)}
+}
+
+// lex 把源码切成 token。支持 {…} 块注释与 // 行注释。
+func lex(src string) ([]token, error) {
+	rs := []rune(src)
+	var out []token
+	line, col := 1, 1
+	i := 0
+	advance := func(n int) {
+		for k := 0; k < n; k++ {
+			if rs[i] == '\n' {
+				line++
+				col = 1
+			} else {
+				col++
+			}
+			i++
+		}
+	}
+	peek := func(k int) rune {
+		if i+k < len(rs) {
+			return rs[i+k]
+		}
+		return 0
+	}
+
+	for i < len(rs) {
+		r := rs[i]
+		p := Pos{line, col}
+		switch {
+		case unicode.IsSpace(r):
+			advance(1)
+		case r == '{':
+			for i < len(rs) && rs[i] != '}' {
+				advance(1)
+			}
+			if i >= len(rs) {
+				return nil, errorf(p, "注释未闭合")
+			}
+			advance(1)
+		case r == '/' && peek(1) == '/':
+			for i < len(rs) && rs[i] != '\n' {
+				advance(1)
+			}
+		case unicode.IsDigit(r) || (r == '.' && unicode.IsDigit(peek(1))):
+			start := i
+			for i < len(rs) && (unicode.IsDigit(rs[i]) || rs[i] == '.') {
+				advance(1)
+			}
+			text := string(rs[start:i])
+			v, err := strconv.ParseFloat(text, 64)
+			if err != nil {
+				return nil, errorf(p, "非法数字 %q", text)
+			}
+			out = append(out, token{kind: tokNum, text: text, num: v, pos: p})
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(rs) && (unicode.IsLetter(rs[i]) || unicode.IsDigit(rs[i]) || rs[i] == '_') {
+				advance(1)
+			}
+			text := strings.ToUpper(string(rs[start:i]))
+			if text == "AND" || text == "OR" {
+				out = append(out, token{kind: tokOp, text: text, pos: p})
+			} else {
+				out = append(out, token{kind: tokIdent, text: text, pos: p})
+			}
+		default:
+			two := string(r) + string(peek(1))
+			switch two {
+			case ":=":
+				out = append(out, token{kind: tokAssign, text: two, pos: p})
+				advance(2)
+				continue
+			case ">=", "<=", "<>":
+				out = append(out, token{kind: tokOp, text: two, pos: p})
+				advance(2)
+				continue
+			case "==":
+				out = append(out, token{kind: tokOp, text: "=", pos: p})
+				advance(2)
+				continue
+			case "!=":
+				out = append(out, token{kind: tokOp, text: "<>", pos: p})
+				advance(2)
+				continue
+			case "&&":
+				out = append(out, token{kind: tokOp, text: "AND", pos: p})
+				advance(2)
+				continue
+			case "||":
+				out = append(out, token{kind: tokOp, text: "OR", pos: p})
+				advance(2)
+				continue
+			}
+			switch r {
+			case '+', '-', '*', '/', '>', '<', '=':
+				out = append(out, token{kind: tokOp, text: string(r), pos: p})
+			case '(':
+				out = append(out, token{kind: tokLParen, text: "(", pos: p})
+			case ')':
+				out = append(out, token{kind: tokRParen, text: ")", pos: p})
+			case ',':
+				out = append(out, token{kind: tokComma, text: ",", pos: p})
+			case ';':
+				out = append(out, token{kind: tokSemi, text: ";", pos: p})
+			case ':':
+				out = append(out, token{kind: tokColon, text: ":", pos: p})
+			default:
+				return nil, errorf(p, "非法字符 %q", r)
+			}
+			advance(1)
+		}
+	}
+	out = append(out, token{kind: tokEOF, pos: Pos{line, col}})
+	return out, nil
+}
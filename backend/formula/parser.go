@@ -0,0 +1,307 @@
+package formula
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ============================================================
+// 语法树
+// ============================================================
+
+// Expr 表达式节点：*Num / *Ident / *Unary / *Binary / *Call。
+type Expr interface {
+	Pos() Pos
+	String() string
+}
+
+// Num 数字常量。
+type Num struct {
+	At    Pos
+	Value float64
+}
+
+// Ident 标识符（行情序列或前面定义的变量），Name 已转大写。
+type Ident struct {
+	At   Pos
+	Name string
+}
+
+// Unary 一元负号。
+type Unary struct {
+	At Pos
+	Op string // "-"
+	X  Expr
+}
+
+// Binary 二元运算，Op 取 + - * / > < >= <= = <> AND OR。
+type Binary struct {
+	At   Pos
+	Op   string
+	L, R Expr
+}
+
+// Call 函数调用，Func 已转大写。
+type Call struct {
+	At   Pos
+	Func string
+	Args []Expr
+}
+
+func (n *Num) Pos() Pos    { return n.At }
+func (n *Ident) Pos() Pos  { return n.At }
+func (n *Unary) Pos() Pos  { return n.At }
+func (n *Binary) Pos() Pos { return n.At }
+func (n *Call) Pos() Pos   { return n.At }
+
+func (n *Num) String() string   { return strconv.FormatFloat(n.Value, 'f', -1, 64) }
+func (n *Ident) String() string { return n.Name }
+func (n *Unary) String() string { return "(" + n.Op + n.X.String() + ")" }
+func (n *Binary) String() string {
+	op := n.Op
+	if op == "AND" || op == "OR" {
+		op = " " + op + " "
+	}
+	return "(" + n.L.String() + op + n.R.String() + ")"
+}
+func (n *Call) String() string {
+	args := make([]string, len(n.Args))
+	for i, a := range n.Args {
+		args[i] = a.String()
+	}
+	return n.Func + "(" + strings.Join(args, ",") + ")"
+}
+
+// Stmt 一条语句：
+//
+//	NAME:=expr;   中间变量，不输出
+//	NAME:expr;    输出线
+//	expr;         匿名输出线，名字按输出顺序记为 OUT1、OUT2…
+type Stmt struct {
+	Name   string
+	Output bool
+	X      Expr
+}
+
+// ============================================================
+// 解析
+// ============================================================
+
+// 画线属性只影响客户端显示，解析时忽略：SIG:CROSS(A,B),COLORRED,LINETHICK2;
+var drawAttrs = map[string]bool{
+	"NODRAW": true, "DOTLINE": true, "STICK": true, "COLORSTICK": true, "VOLSTICK": true,
+	"LINESTICK": true, "CROSSDOT": true, "CIRCLEDOT": true, "POINTDOT": true,
+}
+
+func isDrawAttr(name string) bool {
+	return drawAttrs[name] || strings.HasPrefix(name, "COLOR") || strings.HasPrefix(name, "LINETHICK")
+}
+
+type parser struct {
+	toks []token
+	i    int
+}
+
+func (p *parser) peek() token { return p.toks[p.i] }
+
+func (p *parser) next() token {
+	t := p.toks[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *parser) expect(k tokenKind, what string) (token, error) {
+	t := p.next()
+	if t.kind != k {
+		return t, errorf(t.pos, "此处应为 %s，实际为 %s", what, describe(t))
+	}
+	return t, nil
+}
+
+func describe(t token) string {
+	if t.kind == tokEOF {
+		return "结尾"
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// ParseExpr 解析单个表达式（不含语句、不校验标识符），供规则条件等场景复用。
+func ParseExpr(src string) (Expr, error) {
+	toks, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	x, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, errorf(t.pos, "多余的 %s", describe(t))
+	}
+	return x, nil
+}
+
+func parseStmts(src string) ([]Stmt, error) {
+	toks, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	var out []Stmt
+	for {
+		for p.peek().kind == tokSemi {
+			p.next()
+		}
+		if p.peek().kind == tokEOF {
+			return out, nil
+		}
+		st, err := p.stmt()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, st)
+		if t := p.peek(); t.kind != tokSemi && t.kind != tokEOF {
+			return nil, errorf(t.pos, "语句之间缺少分号，遇到 %s", describe(t))
+		}
+	}
+}
+
+func (p *parser) stmt() (Stmt, error) {
+	var st Stmt
+	if t := p.peek(); t.kind == tokIdent {
+		switch p.toks[p.i+1].kind {
+		case tokAssign:
+			p.i += 2
+			st.Name = t.text
+		case tokColon:
+			p.i += 2
+			st.Name, st.Output = t.text, true
+		}
+	}
+	if st.Name == "" {
+		st.Output = true
+	}
+	x, err := p.expr()
+	if err != nil {
+		return st, err
+	}
+	st.X = x
+	for p.peek().kind == tokComma {
+		p.next()
+		t, err := p.expect(tokIdent, "画线属性")
+		if err != nil {
+			return st, err
+		}
+		if !isDrawAttr(t.text) {
+			return st, errorf(t.pos, "不支持的画线属性 %s", t.text)
+		}
+	}
+	return st, nil
+}
+
+// 优先级（低 → 高）：OR < AND < 比较 < 加减 < 乘除 < 一元负号
+func (p *parser) expr() (Expr, error) { return p.binary(0) }
+
+var precedence = [][]string{
+	{"OR"},
+	{"AND"},
+	{">", "<", ">=", "<=", "=", "<>"},
+	{"+", "-"},
+	{"*", "/"},
+}
+
+func (p *parser) binary(level int) (Expr, error) {
+	if level == len(precedence) {
+		return p.unary()
+	}
+	l, err := p.binary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.kind != tokOp || !contains(precedence[level], t.text) {
+			return l, nil
+		}
+		p.next()
+		r, err := p.binary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		l = &Binary{At: t.pos, Op: t.text, L: l, R: r}
+	}
+}
+
+func (p *parser) unary() (Expr, error) {
+	t := p.peek()
+	if t.kind == tokOp && (t.text == "-" || t.text == "+") {
+		p.next()
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		if t.text == "+" {
+			return x, nil
+		}
+		if n, ok := x.(*Num); ok {
+			return &Num{At: t.pos, Value: -n.Value}, nil
+		}
+		return &Unary{At: t.pos, Op: "-", X: x}, nil
+	}
+	return p.primary()
+}
+
+func (p *parser) primary() (Expr, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNum:
+		return &Num{At: t.pos, Value: t.num}, nil
+	case tokLParen:
+		x, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokRParen, ")"); err != nil {
+			return nil, err
+		}
+		return x, nil
+	case tokIdent:
+		if p.peek().kind != tokLParen {
+			return &Ident{At: t.pos, Name: t.text}, nil
+		}
+		p.next()
+		call := &Call{At: t.pos, Func: t.text}
+		if p.peek().kind == tokRParen {
+			p.next()
+			return call, nil
+		}
+		for {
+			a, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			call.Args = append(call.Args, a)
+			sep := p.next()
+			if sep.kind == tokRParen {
+				return call, nil
+			}
+			if sep.kind != tokComma {
+				return nil, errorf(sep.pos, "函数参数之间应为逗号，实际为 %s", describe(sep))
+			}
+		}
+	}
+	return nil, errorf(t.pos, "此处应为表达式，实际为 %s", describe(t))
+}
+
+func contains(ls []string, s string) bool {
+	for _, x := range ls {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,580 @@
+// Package importer 历史数据批量导入（命令行 oh-my-stock import ...）。
+//
+// 增量抓取只拉最近 7 天，新环境要灌几年的历史只能走导入：日 K、资金流、股票资料从 CSV / Parquet 读入，
+// 校验、归一代码后 COPY 批量 upsert。日 K 和抓取一样先过数据质量校验（坏行进隔离区），
+// 写完按受影响的股票重算涨跌幅、复权因子、技术指标和自定义公式，最后刷新 stock_history_mv。
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"oh-my-stock/fetcher"
+	"oh-my-stock/models"
+	"oh-my-stock/quality"
+)
+
+// Kind 导入的数据类型。
+type Kind string
+
+const (
+	KindBars      Kind = "bars"      // 日 K → stock_daily_data
+	KindMoneyFlow Kind = "moneyflow" // 资金流 → stock_money_flow
+	KindBasics    Kind = "basics"    // 股票资料 → stock_basic_info
+)
+
+// copyBatch 资金流、股票资料每次 COPY 的行数；日 K 按股票逐只写。
+const copyBatch = 50000
+
+// maxErrors 报告里最多保留多少条逐行错误。
+const maxErrors = 20
+
+// Options 一次导入。
+type Options struct {
+	Kind        Kind
+	Files       []string
+	DryRun      bool // 只解析、校验，不写库
+	SyncActions bool // 校验日 K 前先从数据源同步除权除息（否则除权日的跳空会被当成 price_jump 隔离）
+	NoRefresh   bool // 不重算指标、不刷新 stock_history_mv（分多次导入时最后一次再做）
+}
+
+// Report 导入结果。
+type Report struct {
+	Files       int       `json:"files"`
+	Rows        int       `json:"rows"`        // 读到的数据行
+	Invalid     int       `json:"invalid"`     // 解析失败的行（代码、日期、数字）
+	Imported    int       `json:"imported"`    // 写入的行（dry-run 为将写入的行）
+	Quarantined int       `json:"quarantined"` // 未通过数据质量校验、进隔离区的日 K
+	Symbols     int       `json:"symbols"`
+	From        time.Time `json:"from"`
+	To          time.Time `json:"to"`
+	Errors      []string  `json:"errors"` // 前 maxErrors 条逐行错误
+}
+
+func (r *Report) invalid(path string, line int, err error) {
+	r.Invalid++
+	if len(r.Errors) < maxErrors {
+		r.Errors = append(r.Errors, fmt.Sprintf("%s:%d: %v", path, line, err))
+	}
+}
+
+func (r *Report) span(from, to time.Time) {
+	if r.From.IsZero() || from.Before(r.From) {
+		r.From = from
+	}
+	if to.After(r.To) {
+		r.To = to
+	}
+}
+
+// ExpandFiles 目录展开成其中的数据文件（按文件名排序，不递归），文件原样保留。
+func ExpandFiles(paths []string) ([]string, error) {
+	var out []string
+	for _, p := range paths {
+		st, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if !st.IsDir() {
+			out = append(out, p)
+			continue
+		}
+		entries, err := os.ReadDir(p)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			name := strings.ToLower(strings.TrimSuffix(e.Name(), ".gz"))
+			switch filepath.Ext(name) {
+			case ".csv", ".txt", ".tsv", ".parquet", ".pq":
+				if !e.IsDir() {
+					out = append(out, filepath.Join(p, e.Name()))
+				}
+			}
+		}
+	}
+	return out, nil
+}
+
+// Run 执行导入。单行解析失败只计入 Invalid；文件打不开、写库失败时中止并返回已完成部分的报告。
+func Run(ctx context.Context, o Options) (*Report, error) {
+	rep := &Report{}
+	var err error
+	switch o.Kind {
+	case KindBars:
+		err = importBars(ctx, o, rep)
+	case KindMoneyFlow:
+		err = importMoneyFlow(ctx, o, rep)
+	case KindBasics:
+		err = importBasics(ctx, o, rep)
+	default:
+		return nil, fmt.Errorf("未知的导入类型 %q（bars / moneyflow / basics）", o.Kind)
+	}
+	if err != nil || o.DryRun || o.NoRefresh || rep.Imported == 0 {
+		return rep, err
+	}
+	log.Printf("⏳ 刷新 stock_history_mv...")
+	if err := fetcher.RefreshHistoryMV(ctx); err != nil {
+		log.Printf("⚠️ 刷新 stock_history_mv 失败: %v", err)
+	}
+	return rep, nil
+}
+
+// fileSymbol 文件里没有代码列时，从文件名取（daily/600000.csv）。
+func fileSymbol(path string) string {
+	base := filepath.Base(path)
+	for ext := filepath.Ext(base); ext != ""; ext = filepath.Ext(base) {
+		base = strings.TrimSuffix(base, ext)
+	}
+	return base
+}
+
+// rowSymbol 当前行的代码：有代码列用代码列，否则用文件名。
+func rowSymbol(t *table, r map[string]string) (string, error) {
+	if t.has("symbol") {
+		return NormalizeSymbol(r["symbol"])
+	}
+	return NormalizeSymbol(fileSymbol(t.path))
+}
+
+// requireCols 缺少必需列时报错（文件级）。
+func requireCols(t *table, keys ...string) error {
+	var miss []string
+	for _, k := range keys {
+		if !t.has(k) {
+			miss = append(miss, k)
+		}
+	}
+	if len(miss) > 0 {
+		return fmt.Errorf("%s: 缺少列 %s", t.path, strings.Join(miss, ", "))
+	}
+	if !t.has("symbol") {
+		if _, err := NormalizeSymbol(fileSymbol(t.path)); err != nil {
+			return fmt.Errorf("%s: 没有代码列，文件名也不是股票代码", t.path)
+		}
+	}
+	return nil
+}
+
+// ============================================================
+// 日 K
+// ============================================================
+
+func importBars(ctx context.Context, o Options, rep *Report) error {
+	affected := map[string]time.Time{} // 股票 → 最早写入的交易日
+	seen := map[string]bool{}
+	for _, path := range o.Files {
+		bySym, fields, err := readBars(path, rep)
+		if err != nil {
+			return err
+		}
+		rep.Files++
+		symbols := make([]string, 0, len(bySym))
+		for s := range bySym {
+			symbols = append(symbols, s)
+		}
+		sort.Strings(symbols)
+
+		imported, quarantined := 0, 0
+		for _, sym := range symbols {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			seen[sym] = true
+			rows := bySym[sym]
+			if o.DryRun {
+				ok, bad := quality.Check(sym, rows, quality.Context{})
+				imported += len(ok)
+				quarantined += len(bad)
+				if len(ok) > 0 {
+					rep.span(ok[0].TradeDate, ok[len(ok)-1].TradeDate)
+				}
+				continue
+			}
+			if o.SyncActions {
+				if err := fetcher.SyncCorporateActions(ctx, sym); err != nil {
+					log.Printf("⚠️ %s 同步除权除息失败: %v", sym, err)
+				}
+			}
+			prepared, q, err := fetcher.AdmitDaily(sym, "import", rows)
+			if err != nil {
+				return fmt.Errorf("%s 校验日 K: %w", sym, err)
+			}
+			quarantined += q
+			if len(prepared) == 0 {
+				continue
+			}
+			// 日 K 和随后重算的指标落在同样的月份，分区一起建
+			from, to := prepared[0].TradeDate, prepared[len(prepared)-1].TradeDate
+			if _, err := fetcher.EnsurePartitions(ctx, from, to); err != nil {
+				return fmt.Errorf("%s 建分区: %w", sym, err)
+			}
+			if _, err := fetcher.BulkUpsertDaily(ctx, prepared, fields); err != nil {
+				return fmt.Errorf("%s 写入日 K: %w", sym, err)
+			}
+			imported += len(prepared)
+			rep.span(from, to)
+			if err := fetcher.MarkFilledBetween(sym, from, to); err != nil {
+				log.Printf("⚠️ %s 更新补抓记录失败: %v", sym, err)
+			}
+			if d, ok := affected[sym]; !ok || from.Before(d) {
+				affected[sym] = from
+			}
+		}
+		rep.Imported += imported
+		rep.Quarantined += quarantined
+		log.Printf("✅ %s: %d 只股票，写入 %d 根，隔离 %d 根", path, len(symbols), imported, quarantined)
+	}
+	rep.Symbols = len(seen)
+
+	if o.DryRun || o.NoRefresh || len(affected) == 0 {
+		return nil
+	}
+	log.Printf("⏳ 重算 %d 只股票的涨跌幅、复权因子、指标和公式...", len(affected))
+	rebuild(ctx, affected)
+	return nil
+}
+
+// readBars 读一个日 K 文件，按股票分组、每组按日期升序；fields 是文件里有的可选列（成交额、换手率、振幅），
+// 写库时只覆盖这些，没有的列保留库里已有的值。
+func readBars(path string, rep *Report) (bySym map[string][]models.StockDailyData, fields []string, err error) {
+	t, err := openTable(path, barCols)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer t.Close()
+	if err := requireCols(t, "day", "open", "high", "low", "close", "volume"); err != nil {
+		return nil, nil, err
+	}
+	for _, k := range fetcher.DailyOptionalFields {
+		if t.has(k) {
+			fields = append(fields, k)
+		}
+	}
+
+	out := map[string][]models.StockDailyData{}
+	for {
+		r, err := t.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		rep.Rows++
+		bar, err := parseBar(t, r)
+		if err != nil {
+			rep.invalid(path, t.line, err)
+			continue
+		}
+		out[bar.Symbol] = append(out[bar.Symbol], bar)
+	}
+	for _, rows := range out {
+		sort.SliceStable(rows, func(i, j int) bool { return rows[i].TradeDate.Before(rows[j].TradeDate) })
+	}
+	return out, fields, nil
+}
+
+func parseBar(t *table, r map[string]string) (models.StockDailyData, error) {
+	var bar models.StockDailyData
+	sym, err := rowSymbol(t, r)
+	if err != nil {
+		return bar, err
+	}
+	day, err := parseDate(r["day"])
+	if err != nil {
+		return bar, err
+	}
+	bar.Symbol, bar.TradeDate = sym, day
+	fields := []struct {
+		key      string
+		dst      *float64
+		required bool
+	}{
+		{"open", &bar.Open, true}, {"high", &bar.High, true}, {"low", &bar.Low, true}, {"close", &bar.Close, true},
+		{"turnover", &bar.Turnover, false}, {"turnover_rate", &bar.TurnoverRate, false}, {"amplitude", &bar.Amplitude, false},
+	}
+	for _, f := range fields {
+		v, err := parseNum(r[f.key])
+		if err != nil {
+			return bar, fmt.Errorf("%s: %w", f.key, err)
+		}
+		if v == nil {
+			if f.required {
+				return bar, fmt.Errorf("%s 为空", f.key)
+			}
+			continue
+		}
+		*f.dst = *v
+	}
+	vol, err := parseNum(r["volume"])
+	if err != nil {
+		return bar, fmt.Errorf("volume: %w", err)
+	}
+	if vol != nil {
+		bar.Volume = int64(*vol)
+	}
+	return bar, nil
+}
+
+// rebuild 并发重算受影响股票的派生数据（与抓取共用 fetcher.Concurrency）。
+func rebuild(ctx context.Context, affected map[string]time.Time) {
+	set, err := fetcher.LoadFormulaSet()
+	if err != nil {
+		log.Printf("⚠️ 读取自定义公式失败，本次不重算公式: %v", err)
+	}
+	work := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < fetcher.Concurrency(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for sym := range work {
+				fetcher.HistoryChanged(sym, affected[sym], set)
+			}
+		}()
+	}
+	for sym := range affected {
+		if ctx.Err() != nil {
+			break
+		}
+		work <- sym
+	}
+	close(work)
+	wg.Wait()
+}
+
+// ============================================================
+// 资金流
+// ============================================================
+
+func importMoneyFlow(ctx context.Context, o Options, rep *Report) error {
+	seen := map[string]bool{}
+	for _, path := range o.Files {
+		t, err := openTable(path, moneyFlowCols)
+		if err != nil {
+			return err
+		}
+		fields, rows, err := readMoneyFlow(t, rep)
+		t.Close()
+		if err != nil {
+			return err
+		}
+		rep.Files++
+		var from, to time.Time
+		for i, r := range rows {
+			seen[r.Symbol] = true
+			rep.span(r.TradeDate, r.TradeDate)
+			if i == 0 || r.TradeDate.Before(from) {
+				from = r.TradeDate
+			}
+			if i == 0 || r.TradeDate.After(to) {
+				to = r.TradeDate
+			}
+		}
+		if !o.DryRun && len(rows) > 0 {
+			if _, err := fetcher.EnsurePartitions(ctx, from, to); err != nil {
+				return fmt.Errorf("%s 建分区: %w", path, err)
+			}
+			for i := 0; i < len(rows); i += copyBatch {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				end := min(i+copyBatch, len(rows))
+				if _, err := fetcher.BulkUpsertMoneyFlow(ctx, rows[i:end], fields); err != nil {
+					return fmt.Errorf("%s 写入资金流: %w", path, err)
+				}
+			}
+		}
+		rep.Imported += len(rows)
+		log.Printf("✅ %s: 写入资金流 %d 行", path, len(rows))
+	}
+	rep.Symbols = len(seen)
+	return nil
+}
+
+// readMoneyFlow 读一个资金流文件，同一 (代码, 日期) 以后出现的为准。返回文件里有的数值列。
+func readMoneyFlow(t *table, rep *Report) ([]string, []models.StockMoneyFlow, error) {
+	if err := requireCols(t, "day"); err != nil {
+		return nil, nil, err
+	}
+	var fields []string
+	for _, k := range []string{"main_net", "retail_net", "large_order_ratio", "medium_order_ratio", "small_order_ratio"} {
+		if t.has(k) {
+			fields = append(fields, k)
+		}
+	}
+	if len(fields) == 0 {
+		return nil, nil, fmt.Errorf("%s: 没有可导入的资金流列", t.path)
+	}
+
+	index := map[string]int{}
+	var out []models.StockMoneyFlow
+	for {
+		r, err := t.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		rep.Rows++
+		sym, err := rowSymbol(t, r)
+		if err != nil {
+			rep.invalid(t.path, t.line, err)
+			continue
+		}
+		day, err := parseDate(r["day"])
+		if err != nil {
+			rep.invalid(t.path, t.line, err)
+			continue
+		}
+		mf := models.StockMoneyFlow{Symbol: sym, TradeDate: day}
+		dst := map[string]**float64{
+			"main_net": &mf.MainNet, "retail_net": &mf.RetailNet, "large_order_ratio": &mf.LargeOrderRatio,
+			"medium_order_ratio": &mf.MediumOrderRatio, "small_order_ratio": &mf.SmallOrderRatio,
+		}
+		var perr error
+		for _, f := range fields {
+			v, err := parseNum(r[f])
+			if err != nil {
+				perr = fmt.Errorf("%s: %w", f, err)
+				break
+			}
+			*dst[f] = v
+		}
+		if perr != nil {
+			rep.invalid(t.path, t.line, perr)
+			continue
+		}
+		key := sym + "|" + day.Format("2006-01-02")
+		if i, ok := index[key]; ok {
+			out[i] = mf
+			continue
+		}
+		index[key] = len(out)
+		out = append(out, mf)
+	}
+	return fields, out, nil
+}
+
+// ============================================================
+// 股票资料
+// ============================================================
+
+func importBasics(ctx context.Context, o Options, rep *Report) error {
+	for _, path := range o.Files {
+		t, err := openTable(path, basicCols)
+		if err != nil {
+			return err
+		}
+		fields, rows, err := readBasics(t, rep)
+		t.Close()
+		if err != nil {
+			return err
+		}
+		rep.Files++
+		if !o.DryRun {
+			for i := 0; i < len(rows); i += copyBatch {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				end := min(i+copyBatch, len(rows))
+				if _, err := fetcher.BulkUpsertBasicInfo(ctx, rows[i:end], fields); err != nil {
+					return fmt.Errorf("%s 写入股票资料: %w", path, err)
+				}
+			}
+		}
+		rep.Imported += len(rows)
+		rep.Symbols += len(rows)
+		log.Printf("✅ %s: 写入股票资料 %d 行（列: %s）", path, len(rows), strings.Join(fields, ", "))
+	}
+	return nil
+}
+
+// readBasics 读一个股票资料文件，同一代码以后出现的为准。必须有代码列；
+// 没有名称列的文件（如行业映射表）只补已有的股票。
+func readBasics(t *table, rep *Report) ([]string, []models.StockBasicInfo, error) {
+	if !t.has("symbol") {
+		return nil, nil, fmt.Errorf("%s: 缺少代码列", t.path)
+	}
+	var fields []string
+	for _, k := range []string{"name", "full_name", "industry", "area", "market", "listing_date",
+		"outstanding_shares", "total_shares", "status"} {
+		if t.has(k) {
+			fields = append(fields, k)
+		}
+	}
+
+	index := map[string]int{}
+	var out []models.StockBasicInfo
+	for {
+		r, err := t.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		rep.Rows++
+		b, err := parseBasic(r)
+		if err != nil {
+			rep.invalid(t.path, t.line, err)
+			continue
+		}
+		if i, ok := index[b.Symbol]; ok {
+			out[i] = b
+			continue
+		}
+		index[b.Symbol] = len(out)
+		out = append(out, b)
+	}
+	return fields, out, nil
+}
+
+func parseBasic(r map[string]string) (models.StockBasicInfo, error) {
+	var b models.StockBasicInfo
+	sym, err := NormalizeSymbol(r["symbol"])
+	if err != nil {
+		return b, err
+	}
+	if _, ok := r["name"]; ok && r["name"] == "" {
+		return b, errors.New("名称为空")
+	}
+	b.Symbol, b.Name = sym, r["name"]
+	b.FullName, b.Area, b.Market, b.Status = r["full_name"], r["area"], r["market"], r["status"]
+	// "J 金融业" → "金融业"（深交所列表的行业带门类字母）
+	b.Industry = r["industry"]
+	if i := strings.LastIndex(b.Industry, " "); i >= 0 {
+		b.Industry = b.Industry[i+1:]
+	}
+	if s := r["listing_date"]; s != "" {
+		d, err := parseDate(s)
+		if err != nil {
+			return b, err
+		}
+		b.ListingDate = &d
+	}
+	for _, f := range []struct {
+		key string
+		dst *float64
+	}{{"outstanding_shares", &b.OutstandingShares}, {"total_shares", &b.TotalShares}} {
+		v, err := parseNum(r[f.key])
+		if err != nil {
+			return b, fmt.Errorf("%s: %w", f.key, err)
+		}
+		if v != nil {
+			*f.dst = *v
+		}
+	}
+	return b, nil
+}
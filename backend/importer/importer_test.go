@@ -0,0 +1,196 @@
+package importer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNormalizeSymbol(t *testing.T) {
+	ok := map[string]string{
+		"600000":    "600000",
+		" sh600000": "600000",
+		"SH.600000": "600000",
+		"600000.SH": "600000",
+		"600000.SS": "600000",
+		"000001.SZ": "000001",
+		"sz000001":  "000001",
+		"1":         "000001", // Excel 吃掉前导零
+		"2594.0":    "002594",
+		"bj830799":  "830799",
+	}
+	for in, want := range ok {
+		got, err := NormalizeSymbol(in)
+		if err != nil || got != want {
+			t.Errorf("NormalizeSymbol(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "sh000001", "600000.HK", "60000A", "6000001", "浦发银行"} {
+		if got, err := NormalizeSymbol(in); err == nil {
+			t.Errorf("NormalizeSymbol(%q) = %q, want error", in, got)
+		}
+	}
+}
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	p := filepath.Join(dir, name)
+	if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestReadBars(t *testing.T) {
+	dir := t.TempDir()
+	// pandas utf-8-sig 导出：BOM + 中文表头，没有代码列（从文件名取），日期倒序
+	p := writeFile(t, dir, "sh600000.csv", "\ufeff"+`"日期","开盘","收盘","最高","最低","成交量","成交额"
+"2024-06-04","10.1","10.2","10.3","10.0","1000","10100"
+"20240603","10.0","10.1","10.2","9.9","1,200","12000"
+"2024-06-05","x","10.2","10.3","10.0","1000","10100"
+"2024-06-06","","10.2","10.3","10.0","1000","10100"
+`)
+	rep := &Report{}
+	got, fields, err := readBars(p, rep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := got["600000"]
+	if len(got) != 1 || len(rows) != 2 {
+		t.Fatalf("got %+v", got)
+	}
+	if rows[0].TradeDate.Format("2006-01-02") != "2024-06-03" || rows[0].Volume != 1200 || rows[0].Close != 10.1 {
+		t.Errorf("first row = %+v", rows[0])
+	}
+	if rep.Rows != 4 || rep.Invalid != 2 || len(rep.Errors) != 2 {
+		t.Errorf("report = %+v", rep)
+	}
+	// 有成交额、没有换手率 / 振幅：写库时只覆盖成交额
+	if len(fields) != 1 || fields[0] != "turnover" {
+		t.Errorf("fields = %v", fields)
+	}
+
+	// 有代码列时按列分组
+	p = writeFile(t, dir, "all.csv", `symbol,date,open,high,low,close,volume
+600000.SH,2024-06-03,1,1,1,1,1
+000001.SZ,2024-06-03,2,2,2,2,2
+sh000001,2024-06-03,3,3,3,3,3
+`)
+	rep = &Report{}
+	got, fields, err = readBars(p, rep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got["600000"]) != 1 || len(got["000001"]) != 1 || rep.Invalid != 1 {
+		t.Errorf("got %+v, report %+v", got, rep)
+	}
+	// 只有 OHLCV：库里已有的成交额、换手率、振幅不能被 0 覆盖
+	if len(fields) != 0 {
+		t.Errorf("OHLCV 文件 fields = %v, want none", fields)
+	}
+
+	// 没有代码列、文件名也不是代码
+	p = writeFile(t, dir, "daily.csv", "date,open,high,low,close,volume\n")
+	if _, _, err := readBars(p, &Report{}); err == nil {
+		t.Error("want error for missing symbol")
+	}
+	// 缺必需列
+	p = writeFile(t, dir, "600000.csv", "date,open,close\n")
+	if _, _, err := readBars(p, &Report{}); err == nil {
+		t.Error("want error for missing columns")
+	}
+}
+
+func TestReadGzipAndParquet(t *testing.T) {
+	dir := t.TempDir()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte("date,open,high,low,close,volume\n2024-06-03,1,1,1,1,1\n")) //nolint:errcheck
+	zw.Close()
+	p := writeFile(t, dir, "000001.csv.gz", buf.String())
+	got, _, err := readBars(p, &Report{})
+	if err != nil || len(got["000001"]) != 1 {
+		t.Fatalf("gzip: %+v %v", got, err)
+	}
+
+	// Parquet 样本：snappy + 字典页，date 是 TIMESTAMP(MICROS)，amount 第 2 行为 NULL
+	raw, err := os.ReadFile(filepath.Join("..", "parquet", "testdata", "daily.parquet"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p = writeFile(t, dir, "600000.parquet", string(raw))
+	rep := &Report{}
+	got, fields, err := readBars(p, rep)
+	if err != nil {
+		t.Fatalf("parquet: %v", err)
+	}
+	bars := got["600000"]
+	if len(bars) != 3 || rep.Rows != 3 || len(fields) != 1 || fields[0] != "turnover" {
+		t.Fatalf("parquet: bars %+v fields %v rep %+v", bars, fields, rep)
+	}
+	if d := bars[0].TradeDate.Format("2006-01-02"); d != "2024-06-03" || bars[0].Close != 7.05 || bars[2].Volume != 300 || bars[2].Turnover != 2160 {
+		t.Errorf("parquet: bars = %+v", bars)
+	}
+
+	p = writeFile(t, dir, "600000.parquet.gz", string(raw))
+	if _, _, err := readBars(p, &Report{}); err == nil {
+		t.Error("want error for gzipped parquet")
+	}
+	p = writeFile(t, dir, "600001.parquet", "PAR1")
+	if _, _, err := readBars(p, &Report{}); err == nil {
+		t.Error("want error for truncated parquet")
+	}
+}
+
+func TestReadMoneyFlowAndBasics(t *testing.T) {
+	dir := t.TempDir()
+	p := writeFile(t, dir, "600000.csv", `日期,主力净流入-净额,小单净流入-净额
+2024-06-03,100,-100
+2024-06-03,200,-200
+2024-06-04,-,50
+`)
+	tb, err := openTable(p, moneyFlowCols)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields, rows, err := readMoneyFlow(tb, &Report{})
+	tb.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fields) != 2 || len(rows) != 2 {
+		t.Fatalf("fields %v rows %+v", fields, rows)
+	}
+	if *rows[0].MainNet != 200 || rows[1].MainNet != nil || *rows[1].RetailNet != 50 {
+		t.Errorf("rows = %+v", rows)
+	}
+
+	// 交易所列表格式
+	p = writeFile(t, dir, "sz_stocks.csv", `"A股代码","A股简称","A股上市日期","A股总股本","所属行业"
+"1","平安银行","1991-04-03","19,405,918,198","J 金融业"
+"000002","","1991-01-29","1","K 房地产"
+`)
+	tb, err = openTable(p, basicCols)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rep := &Report{}
+	fields, basics, err := readBasics(tb, rep)
+	tb.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(basics) != 1 || rep.Invalid != 1 {
+		t.Fatalf("basics %+v report %+v", basics, rep)
+	}
+	b := basics[0]
+	if b.Symbol != "000001" || b.Industry != "金融业" || b.TotalShares != 19405918198 ||
+		b.ListingDate == nil || b.ListingDate.Format("2006-01-02") != "1991-04-03" {
+		t.Errorf("basic = %+v", b)
+	}
+	if len(fields) != 4 {
+		t.Errorf("fields = %v", fields)
+	}
+}
@@ -0,0 +1,238 @@
+package importer
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"oh-my-stock/calendar"
+	"oh-my-stock/fetcher"
+	"oh-my-stock/parquet"
+)
+
+// 各类文件的表头别名：英文列名、akshare / 东财导出的中文列名都认，取第一个存在的。
+var (
+	symbolAliases = []string{"symbol", "code", "ts_code", "代码", "股票代码", "证券代码", "A股代码"}
+
+	barCols = map[string][]string{
+		"symbol":        symbolAliases,
+		"day":           {"day", "date", "trade_date", "日期"},
+		"open":          {"open", "开盘"},
+		"high":          {"high", "最高"},
+		"low":           {"low", "最低"},
+		"close":         {"close", "收盘"},
+		"volume":        {"volume", "vol", "成交量"},
+		"turnover":      {"turnover", "amount", "成交额"},
+		"turnover_rate": {"turnover_rate", "换手率"},
+		"amplitude":     {"amplitude", "振幅"},
+	}
+	moneyFlowCols = map[string][]string{
+		"symbol":             symbolAliases,
+		"day":                {"day", "date", "trade_date", "日期"},
+		"main_net":           {"main_net", "主力净流入", "主力净流入-净额"},
+		"retail_net":         {"retail_net", "散户净流入", "小单净流入-净额"},
+		"large_order_ratio":  {"large_order_ratio", "大单成交占比"},
+		"medium_order_ratio": {"medium_order_ratio", "中单成交占比"},
+		"small_order_ratio":  {"small_order_ratio", "小单成交占比"},
+	}
+	basicCols = map[string][]string{
+		"symbol":             symbolAliases,
+		"name":               {"name", "名称", "股票简称", "证券简称", "A股简称"},
+		"full_name":          {"full_name", "公司全称"},
+		"industry":           {"industry", "行业", "所属行业", "板块名称"},
+		"area":               {"area", "地区", "地域"},
+		"market":             {"market", "板块"},
+		"listing_date":       {"listing_date", "上市日期", "上市时间", "A股上市日期"},
+		"outstanding_shares": {"outstanding_shares", "流通股", "流通股本"},
+		"total_shares":       {"total_shares", "总股本", "A股总股本"},
+		"status":             {"status", "状态"},
+	}
+)
+
+// table 流式读取一个 CSV（.csv / .txt / .tsv，可带 .gz）或 Parquet（.parquet / .pq），
+// 按别名把列归一成统一的键。Parquet 的值按逻辑类型渲染成和 CSV 一样的文本（日期 → 2024-06-03），
+// 之后的解析两者共用；line 对 Parquet 是「表头算第 1 行」的行号。
+type table struct {
+	path   string
+	read   func() ([]string, error)
+	closer io.Closer
+	idx    map[string]int
+	line   int
+}
+
+func openTable(path string, cols map[string][]string) (*table, error) {
+	name := strings.ToLower(path)
+	gz := strings.HasSuffix(name, ".gz")
+	name = strings.TrimSuffix(name, ".gz")
+	switch filepath.Ext(name) {
+	case ".parquet", ".pq":
+		if gz {
+			return nil, fmt.Errorf("%s: Parquet 自带压缩，不要再 gzip", path)
+		}
+		pf, err := parquet.Open(path, calendar.Shanghai)
+		if err != nil {
+			return nil, err
+		}
+		return newTable(path, pf.Columns(), pf.Next, pf, cols), nil
+	case ".csv", ".txt", ".tsv":
+	default:
+		return nil, fmt.Errorf("%s: 不认识的文件类型（支持 .csv / .txt / .tsv / .parquet，CSV 可 gzip 压缩）", path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	var src io.Reader = f
+	if gz {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		src = zr
+	}
+	br := bufio.NewReaderSize(src, 1<<20)
+	// 跳过 UTF-8 BOM（pandas utf-8-sig 导出）
+	if b, err := br.Peek(3); err == nil && string(b) == "\ufeff" {
+		br.Discard(3) //nolint:errcheck
+	}
+	r := csv.NewReader(br)
+	r.FieldsPerRecord = -1
+	r.ReuseRecord = true
+	if filepath.Ext(name) == ".tsv" {
+		r.Comma = '\t'
+	}
+
+	header, err := r.Read()
+	if err != nil {
+		f.Close()
+		if err == io.EOF {
+			return nil, fmt.Errorf("%s: 空文件", path)
+		}
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return newTable(path, header, r.Read, f, cols), nil
+}
+
+// newTable 按表头把别名映射到列下标；read 逐行返回记录，读完返回 io.EOF。
+func newTable(path string, header []string, read func() ([]string, error), closer io.Closer, cols map[string][]string) *table {
+	t := &table{path: path, read: read, closer: closer, idx: map[string]int{}, line: 1}
+	pos := make(map[string]int, len(header))
+	for i, h := range header {
+		pos[strings.TrimSpace(h)] = i
+	}
+	for key, aliases := range cols {
+		for _, a := range aliases {
+			if i, ok := pos[a]; ok {
+				t.idx[key] = i
+				break
+			}
+		}
+	}
+	return t
+}
+
+// has 文件里有没有这一列。
+func (t *table) has(key string) bool {
+	_, ok := t.idx[key]
+	return ok
+}
+
+// next 下一行，读完返回 io.EOF。
+func (t *table) next() (map[string]string, error) {
+	rec, err := t.read()
+	if err != nil {
+		if err != io.EOF {
+			err = fmt.Errorf("%s:%d: %w", t.path, t.line+1, err)
+		}
+		return nil, err
+	}
+	t.line++
+	out := make(map[string]string, len(t.idx))
+	for key, i := range t.idx {
+		if i < len(rec) {
+			out[key] = strings.TrimSpace(rec[i])
+		}
+	}
+	return out, nil
+}
+
+func (t *table) Close() error { return t.closer.Close() }
+
+// NormalizeSymbol 把 600000 / sh600000 / SH.600000 / 600000.SH / 600000.SS / 1（Excel 吃掉前导零）
+// 统一成 6 位代码。带交易所标记时校验和代码前缀一致，避免把 sh000001（上证指数）当成 000001（平安银行）。
+func NormalizeSymbol(s string) (string, error) {
+	raw := s
+	s = strings.ToUpper(strings.TrimSpace(s))
+	exch := ""
+	for _, p := range []string{"SH", "SZ", "BJ"} {
+		if strings.HasPrefix(s, p) {
+			exch, s = strings.ToLower(p), strings.TrimPrefix(s[2:], ".")
+			break
+		}
+	}
+	s = strings.TrimSuffix(s, ".0")
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		switch s[i+1:] {
+		case "SH", "SS":
+			exch = "sh"
+		case "SZ":
+			exch = "sz"
+		case "BJ":
+			exch = "bj"
+		default:
+			return "", fmt.Errorf("代码 %q 格式不对", raw)
+		}
+		s = s[:i]
+	}
+	if s == "" || len(s) > 6 {
+		return "", fmt.Errorf("代码 %q 格式不对", raw)
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return "", fmt.Errorf("代码 %q 格式不对", raw)
+		}
+	}
+	s = strings.Repeat("0", 6-len(s)) + s
+	if exch != "" && fetcher.MarketFromSymbol(s) != exch {
+		return "", fmt.Errorf("代码 %q 与交易所不符（指数或其他品种？）", raw)
+	}
+	return s, nil
+}
+
+// parseDate 2024-06-03 / 2024/06/03 / 20240603，带时间部分的截掉。
+func parseDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(strings.ReplaceAll(s, "/", "-"))
+	if len(s) == 8 && !strings.Contains(s, "-") {
+		s = s[:4] + "-" + s[4:6] + "-" + s[6:]
+	}
+	if len(s) > 10 {
+		s = s[:10]
+	}
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("日期 %q 格式不对", s)
+	}
+	return t, nil
+}
+
+// parseNum 解析数字，容忍千分位逗号；空值、"-"、"--" 返回 nil。
+func parseNum(s string) (*float64, error) {
+	s = strings.ReplaceAll(strings.TrimSpace(s), ",", "")
+	if s == "" || s == "-" || s == "--" || strings.EqualFold(s, "nan") || strings.EqualFold(s, "null") {
+		return nil, nil
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, fmt.Errorf("数字 %q 格式不对", s)
+	}
+	return &v, nil
+}
@@ -0,0 +1,108 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"oh-my-stock/fetcher"
+)
+
+// ============================================================
+// 从归档装回（命令行 oh-my-stock restore ...）：把裁剪时归档出去的区间合并回原表做研究 / 回测。
+// 装回的区间先登记保留期，到期前裁剪任务跳过；装回日 K 后和导入一样重算派生数据。
+// ============================================================
+
+// RestoreOptions 一次装回。
+type RestoreOptions struct {
+	Table     string
+	From, To  time.Time
+	Files     []string // 指定归档文件；为空时按 archive_files 找覆盖区间的文件
+	HoldDays  int      // 装回的区间多少天内不再裁剪，0 表示下次裁剪照常归档删除
+	NoRefresh bool     // 不重算指标、不刷新 stock_history_mv
+}
+
+// RestoreReport 装回结果。
+type RestoreReport struct {
+	Files   int   `json:"files"`
+	Rows    int64 `json:"rows"`
+	Symbols int   `json:"symbols"`
+}
+
+// historyMVSources stock_history_mv 读的表，装回它们之后要刷新视图。
+var historyMVSources = map[string]bool{"stock_daily_data": true, "stock_indicators": true, "stock_money_flow": true}
+
+// Restore 把 [From, To] 之间归档过的行装回 Table。
+func Restore(ctx context.Context, o RestoreOptions) (*RestoreReport, error) {
+	if _, ok := fetcher.RetentionPolicyFor(o.Table); !ok {
+		return nil, fmt.Errorf("不支持的表 %s", o.Table)
+	}
+	if o.To.Before(o.From) {
+		return nil, errors.New("结束日期早于开始日期")
+	}
+	files := o.Files
+	if len(files) == 0 {
+		archived, err := fetcher.ArchivedFiles(o.Table, o.From, o.To)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range archived {
+			files = append(files, f.Path)
+		}
+		if len(files) == 0 {
+			return nil, fmt.Errorf("%s 在 %s ~ %s 没有归档", o.Table, o.From.Format("2006-01-02"), o.To.Format("2006-01-02"))
+		}
+	}
+	// 先确认文件都在，免得装回一半
+	for _, p := range files {
+		if _, err := os.Stat(p); err != nil {
+			return nil, err
+		}
+	}
+	// 归档出去的月份分区已经删掉了，先建回来
+	if _, err := fetcher.EnsurePartitions(ctx, o.From, o.To); err != nil {
+		return nil, fmt.Errorf("建分区: %w", err)
+	}
+	if o.HoldDays > 0 {
+		if err := fetcher.HoldRetention(o.Table, o.From, o.To, time.Now().AddDate(0, 0, o.HoldDays)); err != nil {
+			return nil, fmt.Errorf("登记保留期: %w", err)
+		}
+	}
+
+	rep := &RestoreReport{}
+	affected := map[string]time.Time{}
+	for _, p := range files {
+		if err := ctx.Err(); err != nil {
+			return rep, err
+		}
+		res, err := fetcher.RestoreArchiveFile(ctx, o.Table, p, o.From, o.To)
+		if err != nil {
+			return rep, err
+		}
+		log.Printf("✅ %s：装回 %d 行", p, res.Rows)
+		rep.Files++
+		rep.Rows += res.Rows
+		for sym, d := range res.Symbols {
+			if cur, ok := affected[sym]; !ok || d.Before(cur) {
+				affected[sym] = d
+			}
+		}
+	}
+	rep.Symbols = len(affected)
+	if o.NoRefresh || rep.Rows == 0 {
+		return rep, nil
+	}
+	if o.Table == "stock_daily_data" {
+		log.Printf("⏳ 重算 %d 只股票的涨跌幅、复权因子、指标和公式...", len(affected))
+		rebuild(ctx, affected)
+	}
+	if historyMVSources[o.Table] {
+		if err := fetcher.RefreshHistoryMV(ctx); err != nil {
+			return rep, fmt.Errorf("刷新 stock_history_mv: %w", err)
+		}
+	}
+	return rep, ctx.Err()
+}
@@ -0,0 +1,426 @@
+// Package indicators 用纯 Go 计算日 K 技术指标，口径与 scripts/compute_indicators.py 保持一致，
+// 并补充 ATR / OBV / CCI / WR / DMI / VWAP / MA120 / MA250。
+//
+// 约定：
+//   - 输入按 trade_date 升序；
+//   - 窗口不足时对应字段为 nil（入库为 NULL），不会用 0 冒充；
+//   - 参数取通达信默认：ATR(14)、CCI(14)、WR(10,6)、DMI(14,6)。
+package indicators
+
+import (
+	"math"
+	"sort"
+
+	"oh-my-stock/models"
+)
+
+// Bar 计算所需的最小日 K 字段。
+type Bar struct {
+	Open     float64
+	High     float64
+	Low      float64
+	Close    float64
+	Volume   float64
+	Turnover float64
+}
+
+// 指标参数（通达信默认值）。
+const (
+	atrN   = 14
+	cciN   = 14
+	wrLong = 10
+	wrShrt = 6
+	dmiN   = 14
+	dmiM   = 6
+)
+
+// MinBars 少于该条数的 K 线不计算（与 scheduler 的阈值一致）。
+const MinBars = 30
+
+// Compute 对 rows（任意顺序）全量计算全部指标，返回与 rows 等长、按日期升序的指标行。
+func Compute(symbol string, rows []models.StockDailyData) []models.StockIndicator {
+	out, _ := ComputeWithState(symbol, rows)
+	return out
+}
+
+func sortedDaily(rows []models.StockDailyData) []models.StockDailyData {
+	sorted := make([]models.StockDailyData, len(rows))
+	copy(sorted, rows)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].TradeDate.Before(sorted[j].TradeDate) })
+	return sorted
+}
+
+// ToBars 把日 K 行转成计算用的 Bar，顺序不变。
+func ToBars(rows []models.StockDailyData) []Bar {
+	bars := make([]Bar, len(rows))
+	for i, r := range rows {
+		bars[i] = Bar{
+			Open: r.Open, High: r.High, Low: r.Low, Close: r.Close,
+			Volume: float64(r.Volume), Turnover: r.Turnover,
+		}
+	}
+	return bars
+}
+
+// Result 每个指标一条与输入等长的序列，NaN 表示窗口不足。
+type Result struct {
+	MA5, MA10, MA20, MA60, MA120, MA250 []float64
+	DIF, DEA, MACD                      []float64
+	K, D, J                             []float64
+	RSI6, RSI12, RSI24                  []float64
+	BollUpper, BollMid, BollLower       []float64
+	ATR14, OBV, CCI14, WR6, WR10        []float64
+	PDI, MDI, ADX, ADXR                 []float64
+	VWAP                                []float64
+}
+
+// Series 从第一根 K 线开始全量计算全部指标序列。
+func Series(bars []Bar) Result {
+	r, _ := seriesFrom(bars, 0, nil)
+	return r
+}
+
+// seriesFrom 计算指标序列：窗口类指标（MA/BOLL/WR/CCI/ATR/DMI）用 bars 整段计算；
+// 递推类指标（MACD/KDJ/RSI/OBV）从 seed 续算 bars[start:]，start 之前输出 NaN。
+// seed 为 nil 时从零初始化（此时 start 应为 0）。
+// 返回值第二项是处理到倒数第二根 K 线后的状态，见 state.go。
+func seriesFrom(bars []Bar, start int, seed *carry) (Result, *carry) {
+	closes := pick(bars, func(b Bar) float64 { return b.Close })
+	highs := pick(bars, func(b Bar) float64 { return b.High })
+	lows := pick(bars, func(b Bar) float64 { return b.Low })
+
+	var r Result
+	r.MA5 = MA(closes, 5)
+	r.MA10 = MA(closes, 10)
+	r.MA20 = MA(closes, 20)
+	r.MA60 = MA(closes, 60)
+	r.MA120 = MA(closes, 120)
+	r.MA250 = MA(closes, 250)
+
+	// KDJ (9,3,3)：RSV 窗口不足按 50 处理
+	hhv9 := HHV(highs, 9)
+	llv9 := LLV(lows, 9)
+	r.DIF, r.DEA, r.MACD = nans(len(bars)), nans(len(bars)), nans(len(bars))
+	r.K, r.D, r.J = nans(len(bars)), nans(len(bars)), nans(len(bars))
+	r.RSI6, r.RSI12, r.RSI24 = nans(len(bars)), nans(len(bars)), nans(len(bars))
+	r.OBV = nans(len(bars))
+
+	c := &carry{}
+	if seed != nil {
+		cp := *seed
+		c = &cp
+	}
+	var settled *carry
+	for i := start; i < len(bars); i++ {
+		rsv := 50.0
+		if span := hhv9[i] - llv9[i]; !math.IsNaN(span) && span != 0 {
+			rsv = (closes[i] - llv9[i]) / span * 100
+		}
+		c.step(bars[i], rsv)
+		r.DIF[i] = c.EMA12 - c.EMA26
+		r.DEA[i] = c.DEA
+		r.MACD[i] = 2 * (r.DIF[i] - r.DEA[i])
+		r.K[i], r.D[i] = c.K, c.D
+		r.J[i] = 3*c.K - 2*c.D
+		r.RSI6[i], r.RSI12[i], r.RSI24[i] = c.rsi(0), c.rsi(1), c.rsi(2)
+		r.OBV[i] = c.OBV
+		if i == len(bars)-2 {
+			cp := *c
+			settled = &cp
+		}
+	}
+
+	// BOLL (20,2)：样本标准差，与 pandas rolling().std() 一致
+	std20 := STD(closes, 20)
+	r.BollMid = r.MA20
+	r.BollUpper = make([]float64, len(bars))
+	r.BollLower = make([]float64, len(bars))
+	for i := range bars {
+		r.BollUpper[i] = r.MA20[i] + 2*std20[i]
+		r.BollLower[i] = r.MA20[i] - 2*std20[i]
+	}
+
+	r.ATR14 = MA(trueRange(bars), atrN)
+	r.CCI14 = cci(bars, cciN)
+	r.WR10 = wr(bars, wrLong)
+	r.WR6 = wr(bars, wrShrt)
+	r.PDI, r.MDI, r.ADX, r.ADXR = dmi(bars, dmiN, dmiM)
+
+	r.VWAP = make([]float64, len(bars))
+	for i, b := range bars {
+		r.VWAP[i] = math.NaN()
+		if b.Volume > 0 && b.Turnover > 0 {
+			r.VWAP[i] = b.Turnover / b.Volume
+		}
+	}
+	return r, settled
+}
+
+// Row 把第 i 天的指标装配成 models.StockIndicator。
+func (r Result) Row(symbol string, d models.StockDailyData, i int) models.StockIndicator {
+	return models.StockIndicator{
+		Symbol:    symbol,
+		CalcDate:  d.TradeDate,
+		MA5:       ptr(r.MA5[i]),
+		MA10:      ptr(r.MA10[i]),
+		MA20:      ptr(r.MA20[i]),
+		MA60:      ptr(r.MA60[i]),
+		MA120:     ptr(r.MA120[i]),
+		MA250:     ptr(r.MA250[i]),
+		MACD:      ptr(r.MACD[i]),
+		DIF:       ptr(r.DIF[i]),
+		DEA:       ptr(r.DEA[i]),
+		K:         ptr(r.K[i]),
+		D:         ptr(r.D[i]),
+		J:         ptr(r.J[i]),
+		RSI6:      ptr(r.RSI6[i]),
+		RSI12:     ptr(r.RSI12[i]),
+		RSI24:     ptr(r.RSI24[i]),
+		BollUpper: ptr(r.BollUpper[i]),
+		BollMid:   ptr(r.BollMid[i]),
+		BollLower: ptr(r.BollLower[i]),
+		ATR14:     ptr(r.ATR14[i]),
+		OBV:       ptr(r.OBV[i]),
+		CCI14:     ptr(r.CCI14[i]),
+		WR6:       ptr(r.WR6[i]),
+		WR10:      ptr(r.WR10[i]),
+		PDI:       ptr(r.PDI[i]),
+		MDI:       ptr(r.MDI[i]),
+		ADX:       ptr(r.ADX[i]),
+		ADXR:      ptr(r.ADXR[i]),
+		VWAP:      ptr(r.VWAP[i]),
+	}
+}
+
+// ------------------------------------------------------------
+// 基础序列函数（NaN 传播；窗口不足为 NaN）
+// ------------------------------------------------------------
+
+// MA N 日简单移动平均。
+func MA(xs []float64, n int) []float64 {
+	sum := SUM(xs, n)
+	for i := range sum {
+		sum[i] /= float64(n)
+	}
+	return sum
+}
+
+// EMA 指数移动平均（adjust=false，首值取第一个非 NaN 输入）。
+func EMA(xs []float64, n int) []float64 {
+	out := nans(len(xs))
+	alpha := 2 / float64(n+1)
+	prev := math.NaN()
+	for i, x := range xs {
+		switch {
+		case math.IsNaN(x):
+		case math.IsNaN(prev):
+			prev = x
+		default:
+			prev = alpha*x + (1-alpha)*prev
+		}
+		out[i] = prev
+	}
+	return out
+}
+
+// HHV N 日最高。
+func HHV(xs []float64, n int) []float64 {
+	return rolling(xs, n, func(w []float64) float64 {
+		m := w[0]
+		for _, x := range w[1:] {
+			m = math.Max(m, x)
+		}
+		return m
+	})
+}
+
+// LLV N 日最低。
+func LLV(xs []float64, n int) []float64 {
+	return rolling(xs, n, func(w []float64) float64 {
+		m := w[0]
+		for _, x := range w[1:] {
+			m = math.Min(m, x)
+		}
+		return m
+	})
+}
+
+// STD N 日样本标准差（ddof=1）。
+func STD(xs []float64, n int) []float64 {
+	return rolling(xs, n, func(w []float64) float64 {
+		if len(w) < 2 {
+			return math.NaN()
+		}
+		mean := 0.0
+		for _, x := range w {
+			mean += x
+		}
+		mean /= float64(len(w))
+		ss := 0.0
+		for _, x := range w {
+			ss += (x - mean) * (x - mean)
+		}
+		return math.Sqrt(ss / float64(len(w)-1))
+	})
+}
+
+// trueRange TR = max(H-L, |H-昨收|, |L-昨收|)；首日只有 H-L。
+func trueRange(bars []Bar) []float64 {
+	out := make([]float64, len(bars))
+	for i, b := range bars {
+		tr := b.High - b.Low
+		if i > 0 {
+			pc := bars[i-1].Close
+			tr = math.Max(tr, math.Max(math.Abs(b.High-pc), math.Abs(b.Low-pc)))
+		}
+		out[i] = tr
+	}
+	return out
+}
+
+// cci 顺势指标：(TP - MA(TP,N)) / (0.015 * AVEDEV(TP,N))，TP=(H+L+C)/3。
+func cci(bars []Bar, n int) []float64 {
+	tp := pick(bars, func(b Bar) float64 { return (b.High + b.Low + b.Close) / 3 })
+	ma := MA(tp, n)
+	avedev := rolling(tp, n, func(w []float64) float64 {
+		mean := 0.0
+		for _, x := range w {
+			mean += x
+		}
+		mean /= float64(len(w))
+		dev := 0.0
+		for _, x := range w {
+			dev += math.Abs(x - mean)
+		}
+		return dev / float64(len(w))
+	})
+	out := nans(len(bars))
+	for i := range bars {
+		if !math.IsNaN(avedev[i]) && avedev[i] != 0 {
+			out[i] = (tp[i] - ma[i]) / (0.015 * avedev[i])
+		}
+	}
+	return out
+}
+
+// wr 威廉指标（通达信口径，0 在顶、100 在底）：100*(HHV(H,N)-C)/(HHV(H,N)-LLV(L,N))。
+func wr(bars []Bar, n int) []float64 {
+	hhv := HHV(pick(bars, func(b Bar) float64 { return b.High }), n)
+	llv := LLV(pick(bars, func(b Bar) float64 { return b.Low }), n)
+	out := nans(len(bars))
+	for i, b := range bars {
+		if span := hhv[i] - llv[i]; !math.IsNaN(span) && span != 0 {
+			out[i] = 100 * (hhv[i] - b.Close) / span
+		}
+	}
+	return out
+}
+
+// dmi 趋向指标（通达信口径）：
+//
+//	TR  = SUM(真实波幅, N)
+//	+DM = SUM(HD>0 且 HD>LD ? HD : 0, N)，HD = H-昨H
+//	-DM = SUM(LD>0 且 LD>HD ? LD : 0, N)，LD = 昨L-L
+//	PDI = +DM/TR*100，MDI = -DM/TR*100
+//	ADX = MA(|MDI-PDI|/(MDI+PDI)*100, M)，ADXR = (ADX + REF(ADX,M)) / 2
+func dmi(bars []Bar, n, m int) (pdi, mdi, adx, adxr []float64) {
+	tr := trueRange(bars)
+	dmp := make([]float64, len(bars))
+	dmm := make([]float64, len(bars))
+	tr[0] = math.NaN()
+	dmp[0], dmm[0] = math.NaN(), math.NaN()
+	for i := 1; i < len(bars); i++ {
+		hd := bars[i].High - bars[i-1].High
+		ld := bars[i-1].Low - bars[i].Low
+		if hd > 0 && hd > ld {
+			dmp[i] = hd
+		}
+		if ld > 0 && ld > hd {
+			dmm[i] = ld
+		}
+	}
+	trN := SUM(tr, n)
+	dmpN := SUM(dmp, n)
+	dmmN := SUM(dmm, n)
+
+	pdi = nans(len(bars))
+	mdi = nans(len(bars))
+	dx := nans(len(bars))
+	for i := range bars {
+		if math.IsNaN(trN[i]) || trN[i] == 0 {
+			continue
+		}
+		pdi[i] = dmpN[i] * 100 / trN[i]
+		mdi[i] = dmmN[i] * 100 / trN[i]
+		if s := pdi[i] + mdi[i]; s != 0 {
+			dx[i] = math.Abs(mdi[i]-pdi[i]) / s * 100
+		}
+	}
+	adx = MA(dx, m)
+	adxr = nans(len(bars))
+	for i := m; i < len(bars); i++ {
+		adxr[i] = (adx[i] + adx[i-m]) / 2
+	}
+	return pdi, mdi, adx, adxr
+}
+
+// SUM N 日求和。
+func SUM(xs []float64, n int) []float64 {
+	return rolling(xs, n, func(w []float64) float64 {
+		s := 0.0
+		for _, x := range w {
+			s += x
+		}
+		return s
+	})
+}
+
+// rolling 对长度为 n 的窗口求 fn；窗口未满或含 NaN 输出 NaN。
+func rolling(xs []float64, n int, fn func(w []float64) float64) []float64 {
+	out := nans(len(xs))
+	if n <= 0 {
+		return out
+	}
+	for i := n - 1; i < len(xs); i++ {
+		w := xs[i-n+1 : i+1]
+		if hasNaN(w) {
+			continue
+		}
+		out[i] = fn(w)
+	}
+	return out
+}
+
+func pick(bars []Bar, f func(Bar) float64) []float64 {
+	out := make([]float64, len(bars))
+	for i, b := range bars {
+		out[i] = f(b)
+	}
+	return out
+}
+
+func nans(n int) []float64 {
+	out := make([]float64, n)
+	for i := range out {
+		out[i] = math.NaN()
+	}
+	return out
+}
+
+func hasNaN(w []float64) bool {
+	for _, x := range w {
+		if math.IsNaN(x) {
+			return true
+		}
+	}
+	return false
+}
+
+// ptr NaN/Inf → nil；否则保留 4 位小数（与 DECIMAL(12,4) 对齐）。
+func ptr(v float64) *float64 {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return nil
+	}
+	r := math.Round(v*10000) / 10000
+	return &r
+}
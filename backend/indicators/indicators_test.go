@@ -0,0 +1,273 @@
+package indicators
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"oh-my-stock/models"
+)
+
+func approx(a, b float64) bool { return math.Abs(a-b) < 1e-6 }
+
+func TestMA_WindowAndNaN(t *testing.T) {
+	got := MA([]float64{1, 2, 3, 4, 5}, 3)
+	if !math.IsNaN(got[0]) || !math.IsNaN(got[1]) {
+		t.Fatalf("窗口不足应为 NaN: %v", got)
+	}
+	if !approx(got[2], 2) || !approx(got[4], 4) {
+		t.Fatalf("MA3 = %v", got)
+	}
+	// NaN 只污染它所在的窗口，不会一路传下去
+	got = MA([]float64{math.NaN(), 2, 4, 6}, 2)
+	if !math.IsNaN(got[1]) || !approx(got[2], 3) || !approx(got[3], 5) {
+		t.Fatalf("MA2 with NaN = %v", got)
+	}
+}
+
+func TestEMA_AdjustFalse(t *testing.T) {
+	got := EMA([]float64{10, 20}, 3) // alpha = 0.5
+	if !approx(got[0], 10) || !approx(got[1], 15) {
+		t.Fatalf("EMA = %v", got)
+	}
+}
+
+func TestRSI_AllUpIs100(t *testing.T) {
+	var bars []Bar
+	for i := 1; i <= 8; i++ {
+		bars = append(bars, Bar{High: float64(i), Low: float64(i), Close: float64(i)})
+	}
+	got := Series(bars).RSI6
+	if !math.IsNaN(got[5]) {
+		t.Fatalf("第 6 根只有 5 个涨跌幅，应为 NaN: %v", got[5])
+	}
+	if !approx(got[6], 100) {
+		t.Fatalf("单边上涨 RSI 应为 100，got %v", got[6])
+	}
+}
+
+func TestOBV(t *testing.T) {
+	bars := []Bar{
+		{Close: 10, Volume: 100},
+		{Close: 11, Volume: 200},
+		{Close: 10.5, Volume: 50},
+		{Close: 10.5, Volume: 80},
+	}
+	got := Series(bars).OBV
+	want := []float64{0, 200, 150, 150}
+	for i := range want {
+		if !approx(got[i], want[i]) {
+			t.Fatalf("OBV = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestWR_TopAndBottom(t *testing.T) {
+	bars := make([]Bar, 6)
+	for i := range bars {
+		bars[i] = Bar{High: 12, Low: 8, Close: 10}
+	}
+	bars[5].Close = 12
+	got := wr(bars, 6)
+	if !approx(got[5], 0) {
+		t.Fatalf("收在最高价 WR 应为 0，got %v", got[5])
+	}
+	bars[5].Close = 8
+	if got = wr(bars, 6); !approx(got[5], 100) {
+		t.Fatalf("收在最低价 WR 应为 100，got %v", got[5])
+	}
+}
+
+func TestATR_ConstantRange(t *testing.T) {
+	bars := make([]Bar, 20)
+	for i := range bars {
+		bars[i] = Bar{High: 11, Low: 9, Close: 10}
+	}
+	got := MA(trueRange(bars), atrN)
+	if !math.IsNaN(got[12]) || !approx(got[13], 2) || !approx(got[19], 2) {
+		t.Fatalf("ATR = %v", got)
+	}
+}
+
+func TestDMI_UptrendPDIAboveMDI(t *testing.T) {
+	bars := make([]Bar, 40)
+	for i := range bars {
+		p := 10 + float64(i)*0.2
+		bars[i] = Bar{High: p + 0.3, Low: p - 0.3, Close: p}
+	}
+	pdi, mdi, adx, adxr := dmi(bars, dmiN, dmiM)
+	last := len(bars) - 1
+	if !(pdi[last] > mdi[last]) {
+		t.Fatalf("单边上涨应 PDI > MDI: pdi=%v mdi=%v", pdi[last], mdi[last])
+	}
+	if math.IsNaN(adx[last]) || math.IsNaN(adxr[last]) {
+		t.Fatalf("40 根 K 线足够计算 ADX/ADXR: adx=%v adxr=%v", adx[last], adxr[last])
+	}
+	if !math.IsNaN(pdi[dmiN-1]) || math.IsNaN(pdi[dmiN]) {
+		t.Fatalf("PDI 首个有效值应在第 %d 根", dmiN+1)
+	}
+}
+
+func TestCompute_SortsAndNilsShortWindows(t *testing.T) {
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	var rows []models.StockDailyData
+	for i := 59; i >= 0; i-- { // 故意倒序
+		p := 10 + float64(i%7)
+		rows = append(rows, models.StockDailyData{
+			Symbol:    "600000",
+			TradeDate: base.AddDate(0, 0, i),
+			Open:      p, High: p + 1, Low: p - 1, Close: p,
+			Volume: 1000, Turnover: 1000 * p,
+		})
+	}
+	out := Compute("600000", rows)
+	if len(out) != 60 {
+		t.Fatalf("len = %d", len(out))
+	}
+	if !out[0].CalcDate.Equal(base) || !out[59].CalcDate.Equal(base.AddDate(0, 0, 59)) {
+		t.Fatal("结果应按日期升序")
+	}
+	last := out[59]
+	if last.MA60 == nil || last.ATR14 == nil || last.CCI14 == nil || last.ADX == nil {
+		t.Fatal("60 根 K 线应算出 MA60/ATR14/CCI14/ADX")
+	}
+	if last.MA120 != nil || last.MA250 != nil {
+		t.Fatal("60 根 K 线不足以计算 MA120/MA250，应为 nil")
+	}
+	if last.VWAP == nil || !approx(*last.VWAP, rows[0].Close) {
+		t.Fatalf("VWAP = %v, want %v", last.VWAP, rows[0].Close)
+	}
+}
+
+func dailyRows(n int) []models.StockDailyData {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	rows := make([]models.StockDailyData, n)
+	for i := range rows {
+		p := 10 + math.Sin(float64(i)/5)*2 + float64(i%3)*0.1
+		rows[i] = models.StockDailyData{
+			Symbol:    "600000",
+			TradeDate: base.AddDate(0, 0, i),
+			Open:      p, High: p + 0.5, Low: p - 0.5, Close: p,
+			Volume: int64(1000 + i*10), Turnover: float64(1000+i*10) * p,
+		}
+	}
+	return rows
+}
+
+func eqPtr(a, b *float64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return approx(*a, *b)
+}
+
+func TestContinue_MatchesFullRecompute(t *testing.T) {
+	rows := dailyRows(400)
+	full := Compute("600000", rows)
+
+	// 前 300 根全量算出状态，再喂窗口 + 后 100 根续算
+	_, st := ComputeWithState("600000", rows[:300])
+	if st == nil || !st.LastDate.Equal(rows[298].TradeDate) {
+		t.Fatalf("状态应停在倒数第二根: %+v", st)
+	}
+	from := 298 - WindowBars
+	out, next, err := Continue("600000", *st, rows[from:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 400-299 {
+		t.Fatalf("len = %d", len(out))
+	}
+	for j, got := range out {
+		want := full[299+j]
+		if !got.CalcDate.Equal(want.CalcDate) {
+			t.Fatalf("日期错位: %v vs %v", got.CalcDate, want.CalcDate)
+		}
+		for name, pair := range map[string][2]*float64{
+			"dif": {got.DIF, want.DIF}, "dea": {got.DEA, want.DEA}, "k": {got.K, want.K},
+			"j": {got.J, want.J}, "rsi6": {got.RSI6, want.RSI6}, "rsi24": {got.RSI24, want.RSI24},
+			"obv": {got.OBV, want.OBV}, "ma250": {got.MA250, want.MA250}, "adx": {got.ADX, want.ADX},
+		} {
+			if !eqPtr(pair[0], pair[1]) {
+				t.Fatalf("%s @%d: 续算 %v, 全量 %v", name, 299+j, pair[0], pair[1])
+			}
+		}
+	}
+	if next.LastDate != rows[398].TradeDate || next.Bars != 399 {
+		t.Fatalf("新状态 = %+v", next)
+	}
+}
+
+func TestContinue_DetectsRewrite(t *testing.T) {
+	rows := dailyRows(50)
+	_, st := ComputeWithState("600000", rows[:40])
+
+	changed := append([]models.StockDailyData(nil), rows...)
+	changed[38].Close += 0.5 // 例如复权后历史价格变化
+	if _, _, err := Continue("600000", *st, changed); err != ErrHistoryRewritten {
+		t.Fatalf("err = %v, want ErrHistoryRewritten", err)
+	}
+	if _, _, err := Continue("600000", *st, rows[39:]); err != ErrHistoryRewritten {
+		t.Fatalf("缺少状态日 K 线应视为改写, err = %v", err)
+	}
+	// 没有新 K 线：原样返回
+	out, same, err := Continue("600000", *st, rows[:39])
+	if err != nil || len(out) != 0 || same.LastDate != st.LastDate {
+		t.Fatalf("out=%d st=%+v err=%v", len(out), same, err)
+	}
+}
+
+func TestCheckWindow_DetectsBackfill(t *testing.T) {
+	// 库里原本缺 full[100]，状态算到 hist[298]
+	full := dailyRows(320)
+	hist := append(append([]models.StockDailyData(nil), full[:100]...), full[101:]...)
+	_, st := ComputeWithState("600000", hist[:300])
+	if !st.WindowFrom.Equal(hist[38].TradeDate) {
+		t.Fatalf("WindowFrom = %v, want %v", st.WindowFrom, hist[38].TradeDate)
+	}
+	// 续算时读 LastDate 之前最近 WindowBars+1 根（再带上之后的新 K 线）
+	if err := CheckWindow(*st, hist[38:310]); err != nil {
+		t.Fatalf("窗口没变不应报错: %v", err)
+	}
+	// 保留策略裁掉窗口之前的老 K 线：读到的窗口不变，不算改写
+	if err := CheckWindow(*st, hist[38:299]); err != nil {
+		t.Fatalf("裁掉老 K 线不应视为改写: %v", err)
+	}
+	_, next, err := Continue("600000", *st, hist[38:310])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckWindow(*next, hist[48:310]); err != nil || !next.WindowFrom.Equal(hist[48].TradeDate) {
+		t.Fatalf("续算后的窗口应前移到 hist[48]: %+v %v", next, err)
+	}
+
+	// 窗口里补回 full[100]：收盘价对得上，只有窗口起点能发现
+	if err := CheckWindow(*st, full[39:300]); err != ErrHistoryRewritten {
+		t.Fatalf("补进 K 线: err = %v, want ErrHistoryRewritten", err)
+	}
+	deleted := append(append([]models.StockDailyData(nil), hist[37:200]...), hist[201:299]...)
+	if err := CheckWindow(*st, deleted); err != ErrHistoryRewritten {
+		t.Fatalf("删掉 K 线: err = %v, want ErrHistoryRewritten", err)
+	}
+
+	// 历史不满一个窗口时比对根数
+	rows := dailyRows(50)
+	_, short := ComputeWithState("600000", rows[:40])
+	if err := CheckWindow(*short, rows[:39]); err != nil {
+		t.Fatalf("根数一致不应报错: %v", err)
+	}
+	extra := append([]models.StockDailyData{{TradeDate: rows[0].TradeDate.AddDate(0, 0, -1), Close: 10}}, rows[:39]...)
+	if err := CheckWindow(*short, extra); err != ErrHistoryRewritten {
+		t.Fatalf("err = %v, want ErrHistoryRewritten", err)
+	}
+	if err := CheckWindow(*short, rows[1:39]); err != ErrHistoryRewritten {
+		t.Fatalf("删掉一根也应视为改写, err = %v", err)
+	}
+
+	// 老版本的状态没有 WindowFrom：不检查
+	legacy := *short
+	legacy.WindowFrom = time.Time{}
+	if err := CheckWindow(legacy, rows[5:39]); err != nil {
+		t.Fatalf("老状态不检查: %v", err)
+	}
+}
@@ -0,0 +1,214 @@
+package indicators
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"oh-my-stock/models"
+)
+
+// ============================================================
+// 增量计算
+//
+// 递推类指标（MACD 的 EMA12/EMA26/DEA、KDJ 的 K/D、RSI 的平滑涨跌幅、OBV）
+// 只依赖「上一根 K 线的状态 + 当日 K 线」，因此每只股票持久化一行状态
+// （stock_indicator_state），下次只续算新 K 线，不再用固定窗口预热。
+//
+// 状态停在倒数第二根 K 线：盘中最后一根还会变，停在它身上会被下一轮
+// 误判为「历史改写」。窗口类指标（MA/BOLL/WR/CCI/ATR/DMI）仍按最近
+// WindowBars 根 K 线现算，成本与窗口长度成正比，与历史长度无关。
+// ============================================================
+
+// WindowBars 增量计算时需要带上的已定型 K 线根数（覆盖 MA250 + 余量）。
+const WindowBars = 260
+
+// ErrHistoryRewritten 状态对应的那根 K 线已不存在或收盘价变了（复权、数据修正），
+// 或状态窗口里补进/删掉了 K 线，调用方应丢弃状态全量重算。
+var ErrHistoryRewritten = errors.New("indicators: history rewritten since saved state")
+
+// carry 递推状态，字段与 models.StockIndicatorState 一一对应。
+type carry struct {
+	Bars      int
+	LastClose float64
+	EMA12     float64
+	EMA26     float64
+	DEA       float64
+	K         float64
+	D         float64
+	RSIUp     [3]float64
+	RSIAbs    [3]float64
+	OBV       float64
+}
+
+var rsiPeriods = [3]int{6, 12, 24}
+
+// step 吃进一根 K 线更新状态。
+//   - EMA：adjust=false，首根取收盘价；
+//   - KDJ：首根 K=D=50，之后 K=2/3·K'+1/3·RSV，D=2/3·D'+1/3·K；
+//   - RSI：通达信 SMA(MAX(C-LC,0),N,1) / SMA(ABS(C-LC),N,1)，首个涨跌幅作初值；
+//   - OBV：首根为 0。
+func (c *carry) step(b Bar, rsv float64) {
+	if c.Bars == 0 {
+		c.EMA12, c.EMA26, c.DEA = b.Close, b.Close, 0
+		c.K, c.D = 50, 50
+		c.OBV = 0
+	} else {
+		c.EMA12 = emaNext(c.EMA12, b.Close, 12)
+		c.EMA26 = emaNext(c.EMA26, b.Close, 26)
+		c.DEA = emaNext(c.DEA, c.EMA12-c.EMA26, 9)
+		c.K = c.K*2/3 + rsv/3
+		c.D = c.D*2/3 + c.K/3
+
+		diff := b.Close - c.LastClose
+		for i, n := range rsiPeriods {
+			up, abs := math.Max(diff, 0), math.Abs(diff)
+			if c.Bars == 1 {
+				c.RSIUp[i], c.RSIAbs[i] = up, abs
+			} else {
+				c.RSIUp[i] = (up + float64(n-1)*c.RSIUp[i]) / float64(n)
+				c.RSIAbs[i] = (abs + float64(n-1)*c.RSIAbs[i]) / float64(n)
+			}
+		}
+		switch {
+		case b.Close > c.LastClose:
+			c.OBV += b.Volume
+		case b.Close < c.LastClose:
+			c.OBV -= b.Volume
+		}
+	}
+	c.LastClose = b.Close
+	c.Bars++
+}
+
+// rsi 第 i 个周期的 RSI；累计涨跌幅不足 N 个时为 NaN。
+func (c *carry) rsi(i int) float64 {
+	if c.Bars <= rsiPeriods[i] || c.RSIAbs[i] == 0 {
+		return math.NaN()
+	}
+	return c.RSIUp[i] / c.RSIAbs[i] * 100
+}
+
+func emaNext(prev, x float64, n int) float64 {
+	alpha := 2 / float64(n+1)
+	return alpha*x + (1-alpha)*prev
+}
+
+// ComputeWithState 全量计算，并返回可供下次续算的状态；K 线不足 2 根时状态为 nil。
+func ComputeWithState(symbol string, rows []models.StockDailyData) ([]models.StockIndicator, *models.StockIndicatorState) {
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	sorted := sortedDaily(rows)
+	r, settled := seriesFrom(ToBars(sorted), 0, nil)
+	out := make([]models.StockIndicator, len(sorted))
+	for i, d := range sorted {
+		out[i] = r.Row(symbol, d, i)
+	}
+	if settled == nil {
+		return out, nil
+	}
+	return out, settled.model(symbol, sorted, len(sorted)-2)
+}
+
+// Continue 从 st 续算。rows 须包含 st.LastDate 那根 K 线以及它之前至少 WindowBars 根
+// （不足时窗口类指标按已有数据计算），和它之后的全部新 K 线；顺序不限。
+//
+// 返回 st.LastDate 之后每根 K 线的指标，以及新的状态（没有新的已定型 K 线时原样返回 st）。
+// st.LastDate 缺失或收盘价对不上时返回 ErrHistoryRewritten。
+func Continue(symbol string, st models.StockIndicatorState, rows []models.StockDailyData) ([]models.StockIndicator, *models.StockIndicatorState, error) {
+	sorted := sortedDaily(rows)
+	p := -1
+	for i, d := range sorted {
+		if d.TradeDate.Equal(st.LastDate) {
+			p = i
+			break
+		}
+	}
+	if p < 0 || round4(sorted[p].Close) != round4(st.LastClose) {
+		return nil, nil, ErrHistoryRewritten
+	}
+	if p == len(sorted)-1 {
+		return nil, &st, nil
+	}
+
+	seed := fromModel(st)
+	r, settled := seriesFrom(ToBars(sorted), p+1, &seed)
+	out := make([]models.StockIndicator, 0, len(sorted)-p-1)
+	for i := p + 1; i < len(sorted); i++ {
+		out = append(out, r.Row(symbol, sorted[i], i))
+	}
+	if settled == nil {
+		// 只有一根新 K 线（盘中那根）：状态不前移
+		return out, &st, nil
+	}
+	return out, settled.model(symbol, sorted, len(sorted)-2), nil
+}
+
+// CheckWindow 校验续算要用的窗口有没有被改写。rows 是库里 st.LastDate（含）之前最近
+// WindowBars+1 根 K 线（可以带上之后的新 K 线，顺序不限）。
+//
+// LastDate 之前补进一根缺失的日 K（回补、导入）或删掉一根，LastDate 那根的收盘价仍对得上，
+// Continue 察觉不到；窗口类指标却会算错。补/删在窗口里时，最近 WindowBars+1 根的第一根
+// 会前后移动（历史不满一个窗口时根数会变），与状态里的 WindowFrom 对不上即返回 ErrHistoryRewritten。
+// 只看窗口、不数全部历史：保留策略裁掉窗口之前的老 K 线是正常的，不算改写。
+// 老版本保存的状态没有 WindowFrom，不做检查（下次状态前移时补上）。
+func CheckWindow(st models.StockIndicatorState, rows []models.StockDailyData) error {
+	if st.WindowFrom.IsZero() {
+		return nil
+	}
+	var first time.Time
+	n := 0
+	for _, d := range rows {
+		if d.TradeDate.After(st.LastDate) {
+			continue
+		}
+		if n++; first.IsZero() || d.TradeDate.Before(first) {
+			first = d.TradeDate
+		}
+	}
+	if !first.Equal(st.WindowFrom) || n != min(st.Bars, WindowBars+1) {
+		return ErrHistoryRewritten
+	}
+	return nil
+}
+
+// model 停在 sorted[last] 的状态；WindowFrom 是续算时要带上的窗口（含 last 共 WindowBars+1 根）的第一根。
+func (c *carry) model(symbol string, sorted []models.StockDailyData, last int) *models.StockIndicatorState {
+	return &models.StockIndicatorState{
+		Symbol:     symbol,
+		LastDate:   sorted[last].TradeDate,
+		WindowFrom: sorted[max(last-WindowBars, 0)].TradeDate,
+		LastClose:  c.LastClose,
+		Bars:       c.Bars,
+		EMA12:      c.EMA12,
+		EMA26:      c.EMA26,
+		DEA:        c.DEA,
+		K:          c.K,
+		D:          c.D,
+		RSI6Up:     c.RSIUp[0],
+		RSI6Abs:    c.RSIAbs[0],
+		RSI12Up:    c.RSIUp[1],
+		RSI12Abs:   c.RSIAbs[1],
+		RSI24Up:    c.RSIUp[2],
+		RSI24Abs:   c.RSIAbs[2],
+		OBV:        c.OBV,
+	}
+}
+
+func fromModel(st models.StockIndicatorState) carry {
+	return carry{
+		Bars:      st.Bars,
+		LastClose: st.LastClose,
+		EMA12:     st.EMA12,
+		EMA26:     st.EMA26,
+		DEA:       st.DEA,
+		K:         st.K,
+		D:         st.D,
+		RSIUp:     [3]float64{st.RSI6Up, st.RSI12Up, st.RSI24Up},
+		RSIAbs:    [3]float64{st.RSI6Abs, st.RSI12Abs, st.RSI24Abs},
+		OBV:       st.OBV,
+	}
+}
+
+func round4(v float64) float64 { return math.Round(v*10000) / 10000 }
@@ -0,0 +1,226 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"oh-my-stock/fetcher"
+	"oh-my-stock/models"
+)
+
+// ============================================================
+// 按股票采集：固定大小的 worker 池逐只处理，每只股票的状态
+// （pending / ok / failed / skipped、处理次数、最后一次错误）写入 ingest_symbols。
+//
+// 运行开始时整批写成 pending，处理结果攒批落库（约 1 秒或 200 条一批），
+// 所以运行中按状态计数就是实时进度，多副本下任何实例的管理接口都能看到。
+// ctx 取消后不再派发新股票，还没处理的标成 skipped。
+// ============================================================
+
+// ErrSkip 处理函数返回它（可以 %w 包装）表示这只股票本轮无需处理：记 skipped，不算失败。
+var ErrSkip = errors.New("跳过")
+
+const (
+	ingestFlushBatch    = 200
+	ingestFlushInterval = time.Second
+)
+
+// ForEachSymbol 用 fetcher.Concurrency() 个 worker 逐只执行 fn，成功 / 失败计入 Progress。
+// 只有记录股票列表失败时返回错误；单只股票的失败只记状态，不中断整轮。
+func (p *Progress) ForEachSymbol(ctx context.Context, symbols []string, fn func(ctx context.Context, symbol string) error) error {
+	if len(symbols) == 0 {
+		return nil
+	}
+	if p.run > 0 {
+		if err := ingests.seed(p.run, symbols, p.prior); err != nil {
+			return fmt.Errorf("记录股票列表失败: %w", err)
+		}
+	}
+	w := newStatusWriter(p.run)
+
+	work := make(chan string)
+	go func() {
+		defer close(work)
+		for _, s := range symbols {
+			if ctx.Err() != nil {
+				return
+			}
+			select {
+			case work <- s:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	workers := fetcher.Concurrency()
+	if workers > len(symbols) {
+		workers = len(symbols)
+	}
+	var wg sync.WaitGroup
+	var rejected atomic.Int64 // 数据源熔断时不逐只打日志，最后汇总一条
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for sym := range work {
+				row := models.IngestSymbol{RunID: p.run, Symbol: sym, Attempts: p.prior[sym] + 1}
+				err := fn(ctx, sym)
+				switch {
+				case err == nil:
+					row.Status = models.IngestOK
+					p.Done(1)
+				case errors.Is(err, ErrSkip), errors.Is(err, fetcher.ErrNotSupported):
+					row.Status, row.LastError = models.IngestSkipped, err.Error()
+				case ctx.Err() != nil:
+					// 处理到一半被取消：不算一次尝试
+					row.Status, row.LastError, row.Attempts = models.IngestSkipped, "任务取消", row.Attempts-1
+				default:
+					row.Status, row.LastError = models.IngestFailed, err.Error()
+					p.Fail(1)
+					if errors.Is(err, fetcher.ErrCircuitOpen) {
+						rejected.Add(1)
+					} else {
+						log.Printf("⚠️ %s 处理失败: %v", sym, err)
+					}
+				}
+				w.add(row)
+			}
+		}()
+	}
+	wg.Wait()
+	w.close()
+
+	if n := rejected.Load(); n > 0 {
+		log.Printf("⚠️ %d 只股票因数据源熔断未处理", n)
+	}
+	if ctx.Err() != nil && p.run > 0 {
+		if n, err := ingests.skipPending(p.run, "任务取消，未处理"); err != nil {
+			log.Printf("⚠️ 运行 #%d 标记未处理股票失败: %v", p.run, err)
+		} else if n > 0 {
+			log.Printf("ℹ️ 运行 #%d 已取消，%d 只股票未处理", p.run, n)
+		}
+	}
+	return nil
+}
+
+// statusWriter 单 goroutine 攒批写 ingest_symbols。写库失败只打日志：状态记录不影响采集本身。
+type statusWriter struct {
+	ch   chan models.IngestSymbol
+	done chan struct{}
+}
+
+func newStatusWriter(runID int64) *statusWriter {
+	w := &statusWriter{ch: make(chan models.IngestSymbol, ingestFlushBatch), done: make(chan struct{})}
+	go func() {
+		defer close(w.done)
+		buf := make([]models.IngestSymbol, 0, ingestFlushBatch)
+		flush := func() {
+			if len(buf) == 0 || runID == 0 {
+				buf = buf[:0]
+				return
+			}
+			if err := ingests.save(buf); err != nil {
+				log.Printf("⚠️ 运行 #%d 写逐股状态失败（%d 条）: %v", runID, len(buf), err)
+			}
+			buf = buf[:0]
+		}
+		tick := time.NewTicker(ingestFlushInterval)
+		defer tick.Stop()
+		for {
+			select {
+			case r, ok := <-w.ch:
+				if !ok {
+					flush()
+					return
+				}
+				r.UpdatedAt = time.Now()
+				buf = append(buf, r)
+				if len(buf) >= ingestFlushBatch {
+					flush()
+				}
+			case <-tick.C:
+				flush()
+			}
+		}
+	}()
+	return w
+}
+
+func (w *statusWriter) add(r models.IngestSymbol) { w.ch <- r }
+
+// close 写完剩余的结果后返回。
+func (w *statusWriter) close() {
+	close(w.ch)
+	<-w.done
+}
+
+// RetryFailed 新建一次运行，只处理 runID 中失败的股票（处理次数在原值上累加），返回新运行 ID。
+func RetryFailed(ctx context.Context, runID int64, by string) (int64, error) {
+	orig, err := store.get(runID)
+	if err != nil {
+		return 0, err
+	}
+	e, ok := lookup(orig.JobName)
+	if !ok {
+		return 0, ErrUnknownJob
+	}
+	if e.job.RunSymbols == nil {
+		return 0, ErrNotIngest
+	}
+	failed, _, err := ingests.list(runID, models.IngestFailed, 0, -1)
+	if err != nil {
+		return 0, err
+	}
+	if len(failed) == 0 {
+		return 0, ErrNothingToRetry
+	}
+	symbols := make([]string, 0, len(failed))
+	prior := make(map[string]int, len(failed))
+	for _, f := range failed {
+		symbols = append(symbols, f.Symbol)
+		prior[f.Symbol] = f.Attempts
+	}
+	return start(ctx, orig.JobName, "retry", by, runOpts{
+		retryOf: &runID,
+		prior:   prior,
+		run: func(ctx context.Context, p *Progress) error {
+			return e.job.RunSymbols(ctx, p, symbols)
+		},
+	})
+}
+
+// IngestProgress 一次运行的逐股进度。
+type IngestProgress struct {
+	Total   int `json:"total"`
+	Pending int `json:"pending"`
+	OK      int `json:"ok"`
+	Failed  int `json:"failed"`
+	Skipped int `json:"skipped"`
+}
+
+// RunProgress 按 ingest_symbols 统计一次运行的进度（非按股票的任务全为 0）。
+func RunProgress(runID int64) (IngestProgress, error) {
+	c, err := ingests.counts(runID)
+	if err != nil {
+		return IngestProgress{}, err
+	}
+	pr := IngestProgress{
+		Pending: c[models.IngestPending],
+		OK:      c[models.IngestOK],
+		Failed:  c[models.IngestFailed],
+		Skipped: c[models.IngestSkipped],
+	}
+	pr.Total = pr.Pending + pr.OK + pr.Failed + pr.Skipped
+	return pr, nil
+}
+
+// RunSymbols 一次运行的逐股状态，status 为空返回全部。
+func RunSymbols(runID int64, status string, offset, limit int) ([]models.IngestSymbol, int64, error) {
+	return ingests.list(runID, status, offset, limit)
+}
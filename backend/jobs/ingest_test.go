@@ -0,0 +1,212 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+
+	"oh-my-stock/models"
+)
+
+// memIngestStore 内存版 ingest_symbols。
+type memIngestStore struct {
+	mu   sync.Mutex
+	rows map[int64]map[string]models.IngestSymbol
+}
+
+func (m *memIngestStore) seed(runID int64, symbols []string, prior map[string]int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rs := map[string]models.IngestSymbol{}
+	for _, s := range symbols {
+		rs[s] = models.IngestSymbol{RunID: runID, Symbol: s, Status: models.IngestPending, Attempts: prior[s]}
+	}
+	m.rows[runID] = rs
+	return nil
+}
+
+func (m *memIngestStore) save(rows []models.IngestSymbol) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, r := range rows {
+		m.rows[r.RunID][r.Symbol] = r
+	}
+	return nil
+}
+
+func (m *memIngestStore) skipPending(runID int64, reason string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var n int64
+	for s, r := range m.rows[runID] {
+		if r.Status == models.IngestPending {
+			r.Status, r.LastError = models.IngestSkipped, reason
+			m.rows[runID][s] = r
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *memIngestStore) counts(runID int64) (map[string]int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := map[string]int{}
+	for _, r := range m.rows[runID] {
+		out[r.Status]++
+	}
+	return out, nil
+}
+
+func (m *memIngestStore) list(runID int64, status string, offset, limit int) ([]models.IngestSymbol, int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []models.IngestSymbol
+	for _, r := range m.rows[runID] {
+		if status == "" || r.Status == status {
+			out = append(out, r)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Symbol < out[j].Symbol })
+	total := int64(len(out))
+	if offset < len(out) {
+		out = out[offset:]
+	} else {
+		out = nil
+	}
+	if limit >= 0 && limit < len(out) {
+		out = out[:limit]
+	}
+	return out, total, nil
+}
+
+func symbolStatus(t *testing.T, runID int64) map[string]models.IngestSymbol {
+	rows, _, _ := RunSymbols(runID, "", 0, -1)
+	out := map[string]models.IngestSymbol{}
+	for _, r := range rows {
+		out[r.Symbol] = r
+	}
+	return out
+}
+
+func TestIngest_StatusAndRetryFailed(t *testing.T) {
+	useMemStore(t)
+	var mu sync.Mutex
+	calls := map[string]int{}
+	broken := map[string]bool{"000002": true, "000003": true}
+	Register(Job{
+		Name:    "t_ingest",
+		Symbols: func() []string { return []string{"000001", "000002", "000003", "000004"} },
+		RunSymbols: func(ctx context.Context, p *Progress, symbols []string) error {
+			return p.ForEachSymbol(ctx, symbols, func(ctx context.Context, sym string) error {
+				mu.Lock()
+				defer mu.Unlock()
+				calls[sym]++
+				switch {
+				case sym == "000004":
+					return ErrSkip
+				case broken[sym]:
+					return errors.New("upstream down")
+				}
+				return nil
+			})
+		},
+	})
+	Register(Job{Name: "t_plain", Run: func(ctx context.Context, p *Progress) error { return nil }})
+
+	id, err := Trigger(context.Background(), "t_ingest", "manual", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	Wait()
+	run, _ := GetRun(id)
+	if run.Processed != 1 || run.Failed != 2 {
+		t.Fatalf("run = %+v", run)
+	}
+	pr, _ := RunProgress(id)
+	if pr != (IngestProgress{Total: 4, OK: 1, Failed: 2, Skipped: 1}) {
+		t.Fatalf("progress = %+v", pr)
+	}
+	st := symbolStatus(t, id)
+	if st["000002"].Attempts != 1 || st["000002"].LastError != "upstream down" || st["000004"].Status != models.IngestSkipped {
+		t.Fatalf("status = %+v", st)
+	}
+
+	// 只重试失败的：000003 恢复，000002 仍失败
+	delete(broken, "000003")
+	retryID, err := RetryFailed(context.Background(), id, "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	Wait()
+	retry, _ := GetRun(retryID)
+	if retry.Trigger != "retry" || retry.RetryOf == nil || *retry.RetryOf != id || retry.Processed != 1 || retry.Failed != 1 {
+		t.Fatalf("retry = %+v", retry)
+	}
+	st = symbolStatus(t, retryID)
+	if len(st) != 2 || st["000002"].Attempts != 2 || st["000003"].Status != models.IngestOK {
+		t.Fatalf("retry status = %+v", st)
+	}
+	if calls["000001"] != 1 || calls["000004"] != 1 {
+		t.Fatalf("成功和跳过的股票不应重跑: %v", calls)
+	}
+
+	// 再重试一轮全部成功后没有可重试的
+	delete(broken, "000002")
+	id3, _ := RetryFailed(context.Background(), retryID, "")
+	Wait()
+	if st := symbolStatus(t, id3); st["000002"].Attempts != 3 {
+		t.Fatalf("attempts 应累加: %+v", st)
+	}
+	if _, err := RetryFailed(context.Background(), id3, ""); !errors.Is(err, ErrNothingToRetry) {
+		t.Fatalf("err = %v", err)
+	}
+	plainID, _ := Trigger(context.Background(), "t_plain", "manual", "")
+	Wait()
+	if _, err := RetryFailed(context.Background(), plainID, ""); !errors.Is(err, ErrNotIngest) {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestIngest_Cancel(t *testing.T) {
+	useMemStore(t)
+	symbols := make([]string, 100)
+	for i := range symbols {
+		symbols[i] = string(rune('A'+i/26)) + string(rune('a'+i%26))
+	}
+	started := make(chan struct{}, len(symbols))
+	Register(Job{
+		Name:    "t_ingest_cancel",
+		Symbols: func() []string { return symbols },
+		RunSymbols: func(ctx context.Context, p *Progress, symbols []string) error {
+			p.ForEachSymbol(ctx, symbols, func(ctx context.Context, sym string) error {
+				started <- struct{}{}
+				<-ctx.Done()
+				return ctx.Err()
+			})
+			return ctx.Err()
+		},
+	})
+	id, err := Trigger(context.Background(), "t_ingest_cancel", "manual", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	if err := Cancel("t_ingest_cancel"); err != nil {
+		t.Fatal(err)
+	}
+	Wait()
+
+	run, _ := GetRun(id)
+	pr, _ := RunProgress(id)
+	if run.Status != models.JobRunCanceled || pr.Total != 100 || pr.Skipped != 100 || run.Failed != 0 {
+		t.Fatalf("run = %+v progress = %+v", run, pr)
+	}
+	for _, r := range symbolStatus(t, id) {
+		if r.Attempts != 0 {
+			t.Fatalf("被取消的不算尝试: %+v", r)
+		}
+	}
+}
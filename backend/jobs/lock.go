@@ -0,0 +1,141 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"oh-my-stock/config"
+)
+
+// ============================================================
+// 跨副本互斥：每个任务一把 PostgreSQL 会话级 advisory lock
+//
+// 运行前在一条专用连接上 pg_try_advisory_lock，拿不到说明别的副本正在跑；
+// 任务跑完 pg_advisory_unlock 并归还连接。持锁期间定时在这条连接上 SELECT 1 续租，
+// 连接断了（锁已随会话释放）立即取消任务，不再假定自己独占。
+// 副本宕机时 PG 靠 TCP keepalive 发现连接死掉并释放锁（会话上把 keepalive 调到约 1 分钟），
+// 其他副本下一次调度即可接手。
+// ============================================================
+
+// Instance 当前副本标识（主机名:pid），记入 job_runs.instance。
+var Instance = func() string {
+	h, _ := os.Hostname()
+	return fmt.Sprintf("%s:%d", h, os.Getpid())
+}()
+
+// LeaseRenewInterval 持锁期间检查连接的间隔。
+var LeaseRenewInterval = 15 * time.Second
+
+// locker 任务锁；测试里换成进程内实现。
+type locker interface {
+	// tryLock 拿到锁返回 lease；锁被别人持有返回 nil, nil。
+	tryLock(ctx context.Context, name string) (lease, error)
+}
+
+// lease 持有中的锁。
+type lease interface {
+	// lost 锁意外失效（连接断开）时关闭
+	lost() <-chan struct{}
+	release()
+}
+
+var locks locker = pgLocker{}
+
+// lockKey 任务名 → advisory lock 的 bigint 键（加前缀，避免和别的业务撞键）。
+func lockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte("oh-my-stock/jobs/" + name))
+	return int64(h.Sum64())
+}
+
+type pgLocker struct{}
+
+func (pgLocker) tryLock(ctx context.Context, name string) (lease, error) {
+	sqlDB, err := config.DB.DB()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	key := lockKey(name)
+	var ok bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", key).Scan(&ok); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !ok {
+		conn.Close()
+		return nil, nil
+	}
+	// 持锁副本宕机后尽快释放：空闲 30s 开始探测，10s 一次，3 次无响应断开
+	for _, stmt := range []string{
+		"SET tcp_keepalives_idle = 30",
+		"SET tcp_keepalives_interval = 10",
+		"SET tcp_keepalives_count = 3",
+	} {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			log.Printf("⚠️ 任务 %s 设置 keepalive 失败: %v", name, err)
+			break
+		}
+	}
+
+	l := &pgLease{name: name, key: key, conn: conn, lostCh: make(chan struct{}), stop: make(chan struct{})}
+	go l.renew()
+	return l, nil
+}
+
+type pgLease struct {
+	name     string
+	key      int64
+	conn     *sql.Conn
+	lostCh   chan struct{}
+	stop     chan struct{}
+	lostOnce sync.Once
+	relOnce  sync.Once
+}
+
+func (l *pgLease) lost() <-chan struct{} { return l.lostCh }
+
+// renew 定时确认持锁连接还活着；连接断开即视为失去锁。
+func (l *pgLease) renew() {
+	t := time.NewTicker(LeaseRenewInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-t.C:
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			_, err := l.conn.ExecContext(ctx, "SELECT 1")
+			cancel()
+			if err != nil {
+				log.Printf("⚠️ 任务 %s 持锁连接失效，放弃运行: %v", l.name, err)
+				l.lostOnce.Do(func() { close(l.lostCh) })
+				return
+			}
+		}
+	}
+}
+
+func (l *pgLease) release() {
+	l.relOnce.Do(func() {
+		close(l.stop)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if _, err := l.conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", l.key); err != nil {
+			// 解锁失败时连接不能回池（锁还挂在会话上），标记坏连接让连接池关掉它
+			log.Printf("⚠️ 任务 %s 释放锁失败，丢弃连接: %v", l.name, err)
+			l.conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+		}
+		l.conn.Close()
+	})
+}
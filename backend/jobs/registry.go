@@ -0,0 +1,377 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"oh-my-stock/models"
+)
+
+// ============================================================
+// 任务注册表
+//
+// 每个后台任务一个 Job：名字、调度（cron / 交易日历 / 仅手动）和执行函数。
+// Start 之后每个有调度的任务一个 goroutine 按 Schedule.Next 等待触发；
+// 管理接口可以随时手动触发或取消。同一个任务同一时刻只跑一份（多副本之间靠 advisory lock，见 lock.go），
+// 上一轮没跑完时定时触发直接跳过，手动触发返回 ErrRunning / ErrLockedElsewhere。
+// 多副本的调度同时到点时，(job_name, scheduled_for) 唯一约束保证同一计划时刻只跑一次。
+// 每次运行在 job_runs 里记一行：开始/结束时间、状态、处理数、失败数、错误。
+// ============================================================
+
+var (
+	ErrUnknownJob = errors.New("任务不存在")
+	ErrRunning    = errors.New("任务正在运行")
+	ErrNotRunning = errors.New("任务未在运行")
+	// ErrLockedElsewhere 任务正在其他副本运行
+	ErrLockedElsewhere = errors.New("任务正在其他实例运行")
+	// errSlotTaken 本次计划时刻已由其他副本执行
+	errSlotTaken = errors.New("计划时刻已由其他实例执行")
+	// ErrNotIngest 任务不是按股票采集的，不能只重试失败股票
+	ErrNotIngest = errors.New("该任务不支持按股票重试")
+	// ErrNothingToRetry 运行中没有失败的股票
+	ErrNothingToRetry = errors.New("没有失败的股票需要重试")
+)
+
+// Job 一个后台任务。
+type Job struct {
+	Name        string
+	Description string
+	Schedule    Schedule // nil 表示只能手动触发
+	Run         func(ctx context.Context, p *Progress) error
+
+	// Symbols + RunSymbols 定义按股票采集的任务（此时 Run 可省略，默认处理 Symbols() 的全部股票）。
+	// RunSymbols 里用 Progress.ForEachSymbol 逐只处理，状态写入 ingest_symbols，
+	// 之后可以 RetryFailed 只把某次运行中失败的股票再交给 RunSymbols。
+	Symbols    func() []string
+	RunSymbols func(ctx context.Context, p *Progress, symbols []string) error
+
+	// OnSuccess 成功结束、运行记录落库之后调用（如推送「行情已更新」事件），可省略。
+	OnSuccess func(run models.JobRun)
+}
+
+// Progress 任务运行中上报计数，并发安全。
+type Progress struct {
+	processed atomic.Int64
+	failed    atomic.Int64
+	run       int64          // job_runs.id，0 表示不落逐股状态
+	prior     map[string]int // 重试运行：每只股票此前的处理次数
+}
+
+// Done 记一条成功。
+func (p *Progress) Done(n int) { p.processed.Add(int64(n)) }
+
+// Fail 记一条失败。
+func (p *Progress) Fail(n int) { p.failed.Add(int64(n)) }
+
+// Counts 当前成功数、失败数。
+func (p *Progress) Counts() (processed, failed int) {
+	return int(p.processed.Load()), int(p.failed.Load())
+}
+
+// JobInfo 管理接口展示用。
+type JobInfo struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Schedule    string         `json:"schedule"`
+	NextRun     *time.Time     `json:"next_run"`
+	Running     bool           `json:"running"`
+	Current     *models.JobRun `json:"current,omitempty"`
+}
+
+type entry struct {
+	job     Job
+	mu      sync.Mutex
+	running *models.JobRun
+	cancel  context.CancelFunc
+	prog    *Progress
+}
+
+var (
+	regMu    sync.RWMutex
+	registry = map[string]*entry{}
+	wg       sync.WaitGroup
+)
+
+// Register 注册任务，重名 panic（在 Start 之前调用）。
+func Register(j Job) {
+	regMu.Lock()
+	defer regMu.Unlock()
+	if _, dup := registry[j.Name]; dup {
+		panic("jobs: job registered twice: " + j.Name)
+	}
+	if j.Run == nil && j.RunSymbols != nil {
+		j.Run = func(ctx context.Context, p *Progress) error { return j.RunSymbols(ctx, p, j.Symbols()) }
+	}
+	registry[j.Name] = &entry{job: j}
+}
+
+func lookup(name string) (*entry, bool) {
+	regMu.RLock()
+	defer regMu.RUnlock()
+	e, ok := registry[name]
+	return e, ok
+}
+
+// List 全部任务，按名字排序。
+func List() []JobInfo {
+	regMu.RLock()
+	es := make([]*entry, 0, len(registry))
+	for _, e := range registry {
+		es = append(es, e)
+	}
+	regMu.RUnlock()
+	sort.Slice(es, func(i, j int) bool { return es[i].job.Name < es[j].job.Name })
+
+	now := time.Now()
+	out := make([]JobInfo, 0, len(es))
+	for _, e := range es {
+		info := JobInfo{Name: e.job.Name, Description: e.job.Description, Schedule: "仅手动"}
+		if e.job.Schedule != nil {
+			info.Schedule = e.job.Schedule.String()
+			if t := e.job.Schedule.Next(now); !t.IsZero() {
+				info.NextRun = &t
+			}
+		}
+		e.mu.Lock()
+		if e.running != nil {
+			cur := *e.running
+			cur.Processed, cur.Failed = e.prog.Counts()
+			info.Running, info.Current = true, &cur
+		}
+		e.mu.Unlock()
+		out = append(out, info)
+	}
+	return out
+}
+
+// Trigger 立即在后台运行一次任务，返回运行记录 ID。
+// trigger 为触发来源（schedule / manual / startup），by 为手动触发的用户。
+func Trigger(ctx context.Context, name, trigger, by string) (int64, error) {
+	return start(ctx, name, trigger, by, runOpts{})
+}
+
+// runOpts start 的可选项。
+type runOpts struct {
+	slot    *time.Time                                   // 定时触发的计划时刻
+	retryOf *int64                                       // 只重试失败股票时的原运行
+	prior   map[string]int                               // 重试时每只股票此前的处理次数
+	run     func(ctx context.Context, p *Progress) error // 非 nil 时代替 Job.Run
+}
+
+// start 拿本地运行位和跨副本锁，记一条 running，然后后台执行。
+func start(ctx context.Context, name, trigger, by string, o runOpts) (int64, error) {
+	e, ok := lookup(name)
+	if !ok {
+		return 0, ErrUnknownJob
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.running != nil {
+		return 0, ErrRunning
+	}
+	l, err := locks.tryLock(ctx, name)
+	if err != nil {
+		return 0, fmt.Errorf("获取任务锁失败: %w", err)
+	}
+	if l == nil {
+		return 0, ErrLockedElsewhere
+	}
+	run := &models.JobRun{
+		JobName:      name,
+		Trigger:      trigger,
+		TriggeredBy:  by,
+		ScheduledFor: o.slot,
+		Instance:     Instance,
+		RetryOf:      o.retryOf,
+		Status:       models.JobRunRunning,
+		StartedAt:    time.Now(),
+	}
+	created, err := store.create(run)
+	if err != nil || !created {
+		l.release()
+		if err != nil {
+			return 0, fmt.Errorf("记录运行失败: %w", err)
+		}
+		return 0, errSlotTaken
+	}
+	runCtx, cancel := context.WithCancel(ctx)
+	e.running, e.cancel, e.prog = run, cancel, &Progress{run: run.ID, prior: o.prior}
+	prog := e.prog
+	fn := e.job.Run
+	if o.run != nil {
+		fn = o.run
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer cancel()
+		// 锁意外失效时取消任务：别的副本可能已经接手
+		go func() {
+			select {
+			case <-l.lost():
+				cancel()
+			case <-runCtx.Done():
+			}
+		}()
+		err := safeRun(runCtx, fn, prog)
+		finish(e, run, prog, runCtx, err, l)
+	}()
+	return run.ID, nil
+}
+
+// safeRun 执行任务，panic 转成错误，避免拖垮整个进程。
+func safeRun(ctx context.Context, run func(context.Context, *Progress) error, p *Progress) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return run(ctx, p)
+}
+
+// finish 落库运行结果，先释放锁再清本地运行位，避免紧接着的触发被自己的锁挡住。
+func finish(e *entry, run *models.JobRun, prog *Progress, ctx context.Context, err error, l lease) {
+	now := time.Now()
+	run.FinishedAt = &now
+	run.Processed, run.Failed = prog.Counts()
+	switch {
+	case ctx.Err() != nil:
+		run.Status = models.JobRunCanceled
+		if err != nil && !errors.Is(err, context.Canceled) {
+			run.Error = err.Error()
+		}
+		select {
+		case <-l.lost():
+			run.Error = "任务锁失效（数据库连接断开），已中止"
+		default:
+		}
+	case err != nil:
+		run.Status = models.JobRunFailed
+		run.Error = err.Error()
+	default:
+		run.Status = models.JobRunSuccess
+	}
+	if e := store.finish(run); e != nil {
+		log.Printf("⚠️ 任务 %s 运行记录 #%d 保存失败: %v", run.JobName, run.ID, e)
+	}
+	log.Printf("ℹ️ 任务 %s #%d %s（成功 %d，失败 %d，耗时 %s）%s",
+		run.JobName, run.ID, run.Status, run.Processed, run.Failed,
+		now.Sub(run.StartedAt).Round(time.Millisecond), run.Error)
+
+	l.release()
+	e.mu.Lock()
+	e.running, e.cancel, e.prog = nil, nil, nil
+	e.mu.Unlock()
+
+	if run.Status == models.JobRunSuccess && e.job.OnSuccess != nil {
+		e.job.OnSuccess(*run)
+	}
+}
+
+// Cancel 取消正在运行的任务（通过 ctx，任务需自行响应 ctx.Done）。
+func Cancel(name string) error {
+	e, ok := lookup(name)
+	if !ok {
+		return ErrUnknownJob
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.running == nil {
+		return ErrNotRunning
+	}
+	e.cancel()
+	return nil
+}
+
+// Runs 某个任务最近 limit 次运行，新的在前。
+func Runs(name string, limit int) ([]models.JobRun, error) {
+	if _, ok := lookup(name); !ok {
+		return nil, ErrUnknownJob
+	}
+	return store.list(name, limit)
+}
+
+// GetRun 按 ID 取一次运行；正在跑的返回实时计数。
+func GetRun(id int64) (*models.JobRun, error) {
+	run, err := store.get(id)
+	if err != nil {
+		return nil, err
+	}
+	if e, ok := lookup(run.JobName); ok {
+		e.mu.Lock()
+		if e.running != nil && e.running.ID == id {
+			run.Processed, run.Failed = e.prog.Counts()
+		}
+		e.mu.Unlock()
+	}
+	return run, nil
+}
+
+// startScheduler 每个有调度的任务一个 goroutine，ctx 取消时退出。
+func startScheduler(ctx context.Context) {
+	regMu.RLock()
+	defer regMu.RUnlock()
+	for _, e := range registry {
+		if e.job.Schedule == nil {
+			continue
+		}
+		go scheduleLoop(ctx, e.job)
+	}
+}
+
+func scheduleLoop(ctx context.Context, j Job) {
+	for {
+		next := j.Schedule.Next(time.Now())
+		if next.IsZero() {
+			log.Printf("⚠️ 任务 %s 的调度 %s 不会再触发", j.Name, j.Schedule)
+			return
+		}
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		slot := next
+		switch _, err := start(ctx, j.Name, "schedule", "", runOpts{slot: &slot}); {
+		case err == nil, errors.Is(err, errSlotTaken):
+		case errors.Is(err, ErrRunning), errors.Is(err, ErrLockedElsewhere):
+			log.Printf("ℹ️ 任务 %s 上一轮未结束（%v），跳过本次调度", j.Name, err)
+		default:
+			log.Printf("⚠️ 任务 %s 触发失败: %v", j.Name, err)
+		}
+	}
+}
+
+// abandonStale 清理宕机副本遗留的 running 记录：只有拿得到该任务的锁（没人在跑）才标成 failed，
+// 别的副本正在跑的记录不动。
+func abandonStale(ctx context.Context) {
+	names, err := store.runningJobs()
+	if err != nil {
+		log.Printf("⚠️ 查询遗留运行记录失败: %v", err)
+		return
+	}
+	for _, name := range names {
+		l, err := locks.tryLock(ctx, name)
+		if err != nil || l == nil {
+			continue
+		}
+		if n, err := store.abandon(name); err != nil {
+			log.Printf("⚠️ 清理任务 %s 遗留运行记录失败: %v", name, err)
+		} else if n > 0 {
+			log.Printf("ℹ️ 任务 %s 有 %d 条遗留 running 记录，已标记为 failed", name, n)
+		}
+		l.release()
+	}
+}
+
+// Wait 等待所有正在运行的任务结束（测试和优雅退出用）。
+func Wait() { wg.Wait() }
@@ -0,0 +1,276 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"oh-my-stock/models"
+)
+
+// memStore 内存版 job_runs。
+type memStore struct {
+	mu   sync.Mutex
+	runs []models.JobRun
+}
+
+func (m *memStore) create(run *models.JobRun) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if run.ScheduledFor != nil {
+		for _, r := range m.runs {
+			if r.JobName == run.JobName && r.ScheduledFor != nil && r.ScheduledFor.Equal(*run.ScheduledFor) {
+				return false, nil
+			}
+		}
+	}
+	run.ID = int64(len(m.runs) + 1)
+	m.runs = append(m.runs, *run)
+	return true, nil
+}
+
+func (m *memStore) finish(run *models.JobRun) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.runs[run.ID-1] = *run
+	return nil
+}
+
+func (m *memStore) list(name string, limit int) ([]models.JobRun, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []models.JobRun
+	for _, r := range m.runs {
+		if r.JobName == name {
+			out = append(out, r)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID > out[j].ID })
+	return out, nil
+}
+
+func (m *memStore) get(id int64) (*models.JobRun, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if id < 1 || int(id) > len(m.runs) {
+		return nil, errors.New("not found")
+	}
+	r := m.runs[id-1]
+	return &r, nil
+}
+
+func (m *memStore) runningJobs() ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	seen := map[string]bool{}
+	var out []string
+	for _, r := range m.runs {
+		if r.Status == models.JobRunRunning && !seen[r.JobName] {
+			seen[r.JobName] = true
+			out = append(out, r.JobName)
+		}
+	}
+	return out, nil
+}
+
+func (m *memStore) abandon(name string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var n int64
+	for i, r := range m.runs {
+		if r.JobName == name && r.Status == models.JobRunRunning {
+			m.runs[i].Status = models.JobRunFailed
+			n++
+		}
+	}
+	return n, nil
+}
+
+// memLocker 进程内的"advisory lock"，held 里的名字视为被其他副本持有。
+type memLocker struct {
+	mu   sync.Mutex
+	held map[string]*memLease
+}
+
+type memLease struct {
+	m      *memLocker
+	name   string
+	lostCh chan struct{}
+}
+
+func (m *memLocker) tryLock(_ context.Context, name string) (lease, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.held[name] != nil {
+		return nil, nil
+	}
+	l := &memLease{m: m, name: name, lostCh: make(chan struct{})}
+	m.held[name] = l
+	return l, nil
+}
+
+func (l *memLease) lost() <-chan struct{} { return l.lostCh }
+
+func (l *memLease) release() {
+	l.m.mu.Lock()
+	defer l.m.mu.Unlock()
+	if l.m.held[l.name] == l {
+		delete(l.m.held, l.name)
+	}
+}
+
+func useMemStore(t *testing.T) *memLocker {
+	oldStore, oldLocks, oldIngests := store, locks, ingests
+	ml := &memLocker{held: map[string]*memLease{}}
+	store, locks, ingests = &memStore{}, ml, &memIngestStore{rows: map[int64]map[string]models.IngestSymbol{}}
+	t.Cleanup(func() { store, locks, ingests = oldStore, oldLocks, oldIngests })
+	return ml
+}
+
+func TestRegistry_TriggerRecordsRun(t *testing.T) {
+	useMemStore(t)
+	Register(Job{Name: "t_ok", Run: func(ctx context.Context, p *Progress) error {
+		p.Done(3)
+		p.Fail(1)
+		return nil
+	}})
+	Register(Job{Name: "t_err", Run: func(ctx context.Context, p *Progress) error {
+		return errors.New("boom")
+	}})
+	Register(Job{Name: "t_panic", Run: func(ctx context.Context, p *Progress) error {
+		panic("oops")
+	}})
+
+	id, err := Trigger(context.Background(), "t_ok", "manual", "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	Trigger(context.Background(), "t_err", "manual", "")
+	Trigger(context.Background(), "t_panic", "manual", "")
+	Wait()
+
+	run, _ := GetRun(id)
+	if run.Status != models.JobRunSuccess || run.Processed != 3 || run.Failed != 1 || run.FinishedAt == nil || run.TriggeredBy != "u1" {
+		t.Fatalf("run = %+v", run)
+	}
+	runs, _ := Runs("t_err", 10)
+	if len(runs) != 1 || runs[0].Status != models.JobRunFailed || runs[0].Error != "boom" {
+		t.Fatalf("runs = %+v", runs)
+	}
+	runs, _ = Runs("t_panic", 10)
+	if runs[0].Status != models.JobRunFailed || runs[0].Error != "panic: oops" {
+		t.Fatalf("runs = %+v", runs)
+	}
+	if _, err := Trigger(context.Background(), "nope", "manual", ""); !errors.Is(err, ErrUnknownJob) {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestRegistry_OverlapAndCancel(t *testing.T) {
+	useMemStore(t)
+	started := make(chan struct{})
+	Register(Job{Name: "t_slow", Run: func(ctx context.Context, p *Progress) error {
+		close(started)
+		<-ctx.Done()
+		p.Done(1)
+		return ctx.Err()
+	}})
+
+	id, err := Trigger(context.Background(), "t_slow", "manual", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	if _, err := Trigger(context.Background(), "t_slow", "schedule", ""); !errors.Is(err, ErrRunning) {
+		t.Fatalf("重叠运行应被拒绝: %v", err)
+	}
+	var info JobInfo
+	for _, j := range List() {
+		if j.Name == "t_slow" {
+			info = j
+		}
+	}
+	if !info.Running || info.Current == nil || info.Current.ID != id || info.Schedule != "仅手动" {
+		t.Fatalf("info = %+v", info)
+	}
+
+	if err := Cancel("t_slow"); err != nil {
+		t.Fatal(err)
+	}
+	Wait()
+	run, _ := GetRun(id)
+	if run.Status != models.JobRunCanceled || run.Processed != 1 || run.Error != "" {
+		t.Fatalf("run = %+v", run)
+	}
+	if err := Cancel("t_slow"); !errors.Is(err, ErrNotRunning) {
+		t.Fatalf("err = %v", err)
+	}
+	// 结束后可以再次触发
+	started = make(chan struct{})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := Trigger(ctx, "t_slow", "manual", ""); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	Wait()
+}
+
+func TestRegistry_AcrossReplicas(t *testing.T) {
+	ml := useMemStore(t)
+	started := make(chan struct{}, 1)
+	Register(Job{Name: "t_multi", Run: func(ctx context.Context, p *Progress) error {
+		started <- struct{}{}
+		<-ctx.Done()
+		return nil
+	}})
+
+	// 其他副本持锁
+	other, _ := ml.tryLock(context.Background(), "t_multi")
+	if _, err := Trigger(context.Background(), "t_multi", "manual", ""); !errors.Is(err, ErrLockedElsewhere) {
+		t.Fatalf("err = %v", err)
+	}
+	other.release()
+
+	// 同一计划时刻只跑一次
+	slot := time.Date(2024, 6, 7, 9, 35, 0, 0, time.UTC)
+	id, err := start(context.Background(), "t_multi", "schedule", "", runOpts{slot: &slot})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	// 锁失效 → 任务被取消并记录原因
+	close(ml.held["t_multi"].lostCh)
+	Wait()
+	run, _ := GetRun(id)
+	if run.Status != models.JobRunCanceled || run.Error == "" || run.Instance != Instance {
+		t.Fatalf("run = %+v", run)
+	}
+	if _, err := start(context.Background(), "t_multi", "schedule", "", runOpts{slot: &slot}); !errors.Is(err, errSlotTaken) {
+		t.Fatalf("err = %v", err)
+	}
+	if len(ml.held) != 0 {
+		t.Fatalf("锁未释放: %v", ml.held)
+	}
+}
+
+func TestAbandonStale(t *testing.T) {
+	ml := useMemStore(t)
+	store.create(&models.JobRun{JobName: "dead", Status: models.JobRunRunning})
+	store.create(&models.JobRun{JobName: "alive", Status: models.JobRunRunning})
+	other, _ := ml.tryLock(context.Background(), "alive") // 其他副本正在跑
+	defer other.release()
+
+	abandonStale(context.Background())
+	dead, _ := store.get(1)
+	alive, _ := store.get(2)
+	if dead.Status != models.JobRunFailed || alive.Status != models.JobRunRunning {
+		t.Fatalf("dead=%s alive=%s", dead.Status, alive.Status)
+	}
+	if ml.held["dead"] != nil {
+		t.Fatal("清理后应释放锁")
+	}
+}
@@ -0,0 +1,195 @@
+package jobs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"oh-my-stock/calendar"
+)
+
+// Schedule 给出 after 之后的下一次运行时刻（严格晚于 after）。
+type Schedule interface {
+	Next(after time.Time) time.Time
+	String() string
+}
+
+// ============================================================
+// cron：标准 5 段 "分 时 日 月 周"，按上海时间解释
+// 支持 *、a-b、a,b、*/n、a-b/n；周 0 和 7 都是周日。
+// 日和周都不是 * 时按 cron 惯例取并集。
+// ============================================================
+
+type cronSchedule struct {
+	spec                     string
+	min, hour, dom, mon, dow uint64 // 位图
+	domStar, dowStar         bool
+}
+
+// Cron 解析 5 段 cron 表达式。
+func Cron(spec string) (Schedule, error) {
+	fs := strings.Fields(spec)
+	if len(fs) != 5 {
+		return nil, fmt.Errorf("cron %q: 需要 5 段（分 时 日 月 周）", spec)
+	}
+	s := &cronSchedule{spec: spec}
+	var err error
+	if s.min, err = cronField(fs[0], 0, 59); err != nil {
+		return nil, fmt.Errorf("cron %q 分: %w", spec, err)
+	}
+	if s.hour, err = cronField(fs[1], 0, 23); err != nil {
+		return nil, fmt.Errorf("cron %q 时: %w", spec, err)
+	}
+	if s.dom, err = cronField(fs[2], 1, 31); err != nil {
+		return nil, fmt.Errorf("cron %q 日: %w", spec, err)
+	}
+	if s.mon, err = cronField(fs[3], 1, 12); err != nil {
+		return nil, fmt.Errorf("cron %q 月: %w", spec, err)
+	}
+	if s.dow, err = cronField(fs[4], 0, 7); err != nil {
+		return nil, fmt.Errorf("cron %q 周: %w", spec, err)
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.domStar, s.dowStar = fs[2] == "*", fs[4] == "*"
+	return s, nil
+}
+
+// MustCron 同 Cron，表达式写错直接 panic（只用于内置任务）。
+func MustCron(spec string) Schedule {
+	s, err := Cron(spec)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+func cronField(f string, lo, hi int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(f, ",") {
+		rng, step := part, 1
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("步长 %q 无效", part)
+			}
+			rng, step = part[:i], n
+		}
+		a, b := lo, hi
+		if rng != "*" {
+			x, y, isRange := strings.Cut(rng, "-")
+			var err error
+			if a, err = strconv.Atoi(x); err != nil {
+				return 0, fmt.Errorf("%q 不是数字", part)
+			}
+			b = a
+			if isRange {
+				if b, err = strconv.Atoi(y); err != nil {
+					return 0, fmt.Errorf("%q 不是数字", part)
+				}
+			} else if step > 1 {
+				b = hi
+			}
+		}
+		if a < lo || b > hi || a > b {
+			return 0, fmt.Errorf("%q 超出范围 %d-%d", part, lo, hi)
+		}
+		for v := a; v <= b; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func (s *cronSchedule) String() string { return "cron " + s.spec }
+
+func (s *cronSchedule) dayMatch(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+func (s *cronSchedule) Next(after time.Time) time.Time {
+	t := after.In(calendar.Shanghai).Truncate(time.Minute).Add(time.Minute)
+	// 最多找 5 年，防止 2 月 30 日这种永远不会到的表达式死循环
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if s.mon&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, calendar.Shanghai)
+			continue
+		}
+		if !s.dayMatch(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, calendar.Shanghai)
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, calendar.Shanghai)
+			continue
+		}
+		if s.min&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// ============================================================
+// 交易日历
+// ============================================================
+
+type tradingDays struct{ inner Schedule }
+
+// OnTradingDays 只保留落在交易日的触发点，例如 OnTradingDays(MustCron("30 17 * * *"))
+// 表示每个交易日 17:30。
+func OnTradingDays(s Schedule) Schedule { return tradingDays{s} }
+
+func (s tradingDays) String() string { return s.inner.String() + "（仅交易日）" }
+
+func (s tradingDays) Next(after time.Time) time.Time {
+	t := s.inner.Next(after)
+	for i := 0; i < 1000 && !t.IsZero() && !calendar.IsTradingDay(t); i++ {
+		t = s.inner.Next(t)
+	}
+	return t
+}
+
+type inSession struct {
+	every      time.Duration
+	afterClose time.Duration
+}
+
+// InSession 盘中（9:30–11:30、13:00–15:00）每 every 一次，另外每个交易日收盘后 afterClose 再补一次，
+// 拿到当天最终的日 K。夜间、周末、节假日不触发。
+func InSession(every, afterClose time.Duration) Schedule {
+	return inSession{every: every, afterClose: afterClose}
+}
+
+func (s inSession) String() string {
+	return fmt.Sprintf("盘中每 %s，收盘后 %s", s.every, s.afterClose)
+}
+
+func (s inSession) Next(after time.Time) time.Time {
+	t := after.Truncate(s.every).Add(s.every)
+	if !calendar.InSession(t) {
+		t = calendar.NextOpen(t)
+	}
+	d := calendar.Date(after)
+	if !calendar.IsTradingDay(d) {
+		d = calendar.NextTradingDay(d, 1)
+	}
+	closeRun := calendar.CloseTime(d).Add(s.afterClose)
+	if !closeRun.After(after) {
+		closeRun = calendar.CloseTime(calendar.NextTradingDay(d, 1)).Add(s.afterClose)
+	}
+	if closeRun.Before(t) {
+		return closeRun
+	}
+	return t
+}
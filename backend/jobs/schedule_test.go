@@ -0,0 +1,70 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+
+	"oh-my-stock/calendar"
+)
+
+func at(s string) time.Time {
+	t, err := time.ParseInLocation("2006-01-02 15:04", s, calendar.Shanghai)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestCron_Next(t *testing.T) {
+	cases := []struct{ spec, after, want string }{
+		{"30 17 * * *", "2024-06-07 10:00", "2024-06-07 17:30"},
+		{"30 17 * * *", "2024-06-07 17:30", "2024-06-08 17:30"}, // 严格晚于 after
+		{"*/15 9-10 * * 1-5", "2024-06-07 10:50", "2024-06-10 09:00"},
+		{"0 20 * * 6", "2024-06-07 10:00", "2024-06-08 20:00"},
+		{"0 0 1 * *", "2024-06-07 10:00", "2024-07-01 00:00"},
+		{"0 8 * * 7", "2024-06-07 10:00", "2024-06-09 08:00"},  // 7 = 周日
+		{"0 8 15 * 1", "2024-06-07 10:00", "2024-06-10 08:00"}, // 日和周取并集
+	}
+	for _, c := range cases {
+		s, err := Cron(c.spec)
+		if err != nil {
+			t.Fatalf("%s: %v", c.spec, err)
+		}
+		if got := s.Next(at(c.after)); !got.Equal(at(c.want)) {
+			t.Errorf("%s after %s = %s, want %s", c.spec, c.after, got.Format("2006-01-02 15:04"), c.want)
+		}
+	}
+	for _, bad := range []string{"* * * *", "60 * * * *", "a * * * *", "*/0 * * * *", "5-1 * * * *"} {
+		if _, err := Cron(bad); err == nil {
+			t.Errorf("%q 应报错", bad)
+		}
+	}
+	if got := MustCron("0 0 30 2 *").Next(at("2024-06-07 10:00")); !got.IsZero() {
+		t.Errorf("2 月 30 日不应触发: %v", got)
+	}
+}
+
+func TestOnTradingDays(t *testing.T) {
+	s := OnTradingDays(MustCron("30 17 * * *"))
+	// 周五 18:00 之后：跳过周末和端午（06-10）
+	if got := s.Next(at("2024-06-07 18:00")); !got.Equal(at("2024-06-11 17:30")) {
+		t.Fatalf("next = %s", got.Format("2006-01-02 15:04"))
+	}
+}
+
+func TestInSession(t *testing.T) {
+	s := InSession(5*time.Minute, 10*time.Minute)
+	cases := []struct{ after, want string }{
+		{"2024-06-07 08:00", "2024-06-07 09:30"},
+		{"2024-06-07 09:31", "2024-06-07 09:35"},
+		{"2024-06-07 11:28", "2024-06-07 13:00"}, // 11:30 午休不触发
+		{"2024-06-07 14:57", "2024-06-07 15:10"}, // 15:00 收盘，补一次
+		{"2024-06-07 15:10", "2024-06-11 09:30"}, // 跳过周末和端午
+		{"2024-06-08 12:00", "2024-06-11 09:30"},
+	}
+	for _, c := range cases {
+		if got := s.Next(at(c.after)); !got.Equal(at(c.want)) {
+			t.Errorf("after %s = %s, want %s", c.after, got.Format("2006-01-02 15:04"), c.want)
+		}
+	}
+}
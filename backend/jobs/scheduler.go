@@ -2,78 +2,305 @@ package jobs
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
-	"oh-my-stock/config"
-	"oh-my-stock/notify"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"oh-my-stock/alerts"
+	"oh-my-stock/auth"
+	"oh-my-stock/calendar"
+	"oh-my-stock/config"
+	"oh-my-stock/digest"
+	"oh-my-stock/events"
 	"oh-my-stock/fetcher"
 	"oh-my-stock/models"
+	"oh-my-stock/notify"
 )
 
-// Start 启动后开始：1) 异步拉全量列表；2) 周期抓取近期日 K；3) 周期裁剪。
+// Start 注册内置任务并启动调度：启动时异步建好分区、补全股票列表；之后各任务按自己的调度运行，
+// 运行记录写入 job_runs，管理接口（/api/v1/admin/jobs）可查看、手动触发和取消。
 func Start(ctx context.Context) {
-	go runOnce(ctx)
-
-	go loop(ctx, 5*time.Minute, func(ctx context.Context) {
-		runIncrementalFetch(ctx)
-		if n, err := fetcher.PurgeOldDaily(); err == nil {
-			log.Printf("✅ 裁剪 stock_daily_data：删除 %d 行（>30 天）", n)
-		} else {
-			log.Printf("⚠️ 裁剪 stock_daily_data 失败: %v", err)
+	registerBuiltin()
+	abandonStale(ctx)
+	for _, name := range []string{"partitions", "stock_list_init", "history_mv"} {
+		if _, err := Trigger(ctx, name, "startup", ""); err != nil && !errors.Is(err, ErrLockedElsewhere) {
+			log.Printf("⚠️ 启动任务 %s 触发失败: %v", name, err)
 		}
-		if n, err := fetcher.PurgeOldHistoryMV(); err == nil {
-			log.Printf("✅ 裁剪 stock_history_mv：删除 %d 行（>30 天）", n)
-		} else {
-			log.Printf("⚠️ 裁剪 stock_history_mv 失败: %v", err)
+	}
+	startScheduler(ctx)
+}
+
+var builtinOnce sync.Once
+
+// registerBuiltin 内置任务。
+func registerBuiltin() {
+	builtinOnce.Do(func() {
+		Register(Job{
+			Name:        "partitions",
+			Description: fmt.Sprintf("建好日 K / 指标 / 资金流从完整性检查窗口到之后 %d 个月的月份分区", fetcher.PartitionsAhead),
+			Schedule:    MustCron("0 1 * * *"),
+			Run:         runPartitions,
+		})
+		Register(Job{
+			Name:        "stock_list_init",
+			Description: "stock_basic_info 为空时拉全量股票列表并补全行业/板块/估值",
+			Run:         runOnce,
+		})
+		Register(Job{
+			Name:        "history_mv",
+			Description: "stock_history_mv 定义版本不一致时重建，否则并发刷新",
+			Run:         runHistoryMV,
+		})
+		Register(Job{
+			Name:        "incremental_fetch",
+			Description: "增量抓取活跃股票最近 7 天日 K、资金流，续算指标和公式，评估价格提醒",
+			Schedule:    InSession(5*time.Minute, 10*time.Minute),
+			Symbols:     incrementalSymbols,
+			RunSymbols:  fetchDaily,
+			OnSuccess:   announceIngest,
+		})
+		Register(Job{
+			Name:        "rule_check",
+			Description: "用最新交易日快照匹配用户规则，命中写通知（同一规则、股票、交易日只通知一次）",
+			Schedule:    InSession(5*time.Minute, 15*time.Minute),
+			Run:         runRuleChecks,
+		})
+		Register(Job{
+			Name:        "notify_deliver",
+			Description: "重试到期的通知外发（webhook / 邮件 / 群机器人），超过最大次数记失败",
+			Schedule:    MustCron("*/5 * * * *"),
+			Run:         runNotifyDeliver,
+		})
+		Register(Job{
+			Name:        "daily_digest",
+			Description: "收盘后给每个用户生成日报（规则命中新进 / 持续、自选股涨跌、触发的提醒、市场宽度），按设置发邮件",
+			Schedule:    OnTradingDays(MustCron("0 16 * * *")),
+			Run:         runDailyDigest,
+		})
+		Register(Job{
+			Name:        "purge",
+			Description: "按保留策略把过期的整月归档成 .csv.gz 并删除，清理过期的实时事件和任务运行记录",
+			Schedule:    OnTradingDays(MustCron("30 17 * * *")),
+			Run:         runPurge,
+		})
+		Register(Job{
+			Name:        "backfill_gaps",
+			Description: "按交易日历找出日 K 缺口，只补抓缺失的交易日，补上后评估价格提醒",
+			Schedule:    OnTradingDays(MustCron("0 18 * * *")),
+			Symbols:     incompleteSymbols,
+			RunSymbols:  runBackfill,
+			OnSuccess:   announceIngest,
+		})
+		Register(Job{
+			Name:        "refetch_daily_all",
+			Description: "全市场最近 7 天日 K 重新抓取",
+			Symbols:     fetcher.ListAllSymbols,
+			RunSymbols:  fetchDaily,
+			OnSuccess:   announceIngest,
+		})
+		Register(Job{
+			Name:        "refetch_basics_all",
+			Description: "全市场行业/板块/地区/估值重新补全",
+			Schedule:    MustCron("0 20 * * 6"),
+			Symbols:     fetcher.ListAllSymbols,
+			RunSymbols:  RefetchStockBasics,
+		})
+	})
+}
+
+// runPurge 按保留策略裁剪各表（见 fetcher.PurgeExpired），删除行数计入 processed；
+// 顺带清理过期的实时事件、登录会话和任务运行记录。一张表失败不影响其他表。
+func runPurge(ctx context.Context, p *Progress) error {
+	var (
+		deleted int64
+		errs    []error
+	)
+	for _, pol := range fetcher.RetentionPolicies() {
+		res, err := fetcher.PurgeExpired(ctx, pol.Table)
+		if res.Rows > 0 || res.Held > 0 {
+			log.Printf("✅ 裁剪 %s：%d 个月 %d 行（早于 %s，归档 %d 个文件，装回保留中跳过 %d 个月）",
+				pol.Table, res.Months, res.Rows, res.Before.Format("2006-01-02"), len(res.Files), res.Held)
 		}
-		if n, err := fetcher.PurgeOldMoneyFlowDaily(); err == nil {
-			log.Printf("✅ 裁剪 stock_money_flow_daily：删除 %d 行（>30 天）", n)
-		} else {
-			log.Printf("⚠️ 裁剪 stock_money_flow_daily 失败: %v", err)
+		deleted += res.Rows
+		p.Done(int(res.Rows))
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			errs = append(errs, fmt.Errorf("裁剪 %s: %w", pol.Table, err))
 		}
-	})
+	}
+	if deleted > 0 {
+		refreshHistoryMV(ctx)
+	}
+	// 实时事件只用于断线重连补发，不走保留策略，固定保留 events.DefaultKeep
+	if n, err := events.Prune(ctx, config.DB, events.DefaultKeep); err != nil {
+		errs = append(errs, fmt.Errorf("清理实时事件: %w", err))
+	} else if n > 0 {
+		log.Printf("✅ 清理 %d 条过期实时事件", n)
+	}
+	if n, err := auth.Prune(ctx, config.DB, auth.DefaultKeep); err != nil {
+		errs = append(errs, fmt.Errorf("清理登录会话: %w", err))
+	} else if n > 0 {
+		log.Printf("✅ 清理 %d 个过期 / 已退出的登录会话", n)
+	}
+	if n, err := PruneRuns(ctx, config.DB, RunKeep); err != nil {
+		errs = append(errs, fmt.Errorf("清理任务运行记录: %w", err))
+	} else if n > 0 {
+		log.Printf("✅ 清理 %d 条过期的任务运行记录（连同逐股进度）", n)
+	}
+	return errors.Join(errs...)
+}
+
+// runPartitions 提前建月份分区，新建的个数计入 processed。还没迁移成分区表的老库什么也不做。
+// 顺带检查交易日历是否收录了今年和（临近年底时）明年，没有时任务失败（见 calendar.CheckCoverage）。
+func runPartitions(ctx context.Context, p *Progress) error {
+	n, err := fetcher.EnsureUpcomingPartitions(ctx)
+	if n > 0 {
+		log.Printf("✅ 新建 %d 个月份分区", n)
+	}
+	p.Done(n)
+	if cerr := calendar.CheckCoverage(time.Now()); cerr != nil {
+		log.Printf("❌ %v", cerr)
+		err = errors.Join(err, cerr)
+	}
+	return err
+}
 
-	// 规则触发通知：每 5 分钟一次，与数据抓取同步。
-	// 实际只依赖最新一个 trade_date 的快照，去重粒度是 (user, rule, symbol, 当日)，不会重复刷屏。
-	go loop(ctx, 5*time.Minute, func(ctx context.Context) {
-		runRuleChecks(ctx)
+// runRuleChecks 对所有打开通知的用户跑一次规则匹配（见 notify 包），新写入的通知数计入 processed，
+// 接着把排好的外发投递发出去。收盘后比 incremental_fetch 晚 5 分钟，拿到当天最终的快照。
+func runRuleChecks(ctx context.Context, p *Progress) error {
+	db := config.DB.WithContext(ctx)
+	n, err := notify.RunForAllUsers(db)
+	if n > 0 {
+		log.Printf("✅ 规则匹配：写入 %d 条新通知", n)
+	}
+	p.Done(n)
+	if _, derr := dispatchNotifications(ctx); derr != nil {
+		err = errors.Join(err, derr)
+	}
+	return err
+}
+
+// announceIngest 行情入库任务成功后给所有在线用户推一条 ingest 事件，前端据此刷新行情。
+// 什么都没入库的运行不推。
+func announceIngest(run models.JobRun) {
+	if run.Processed == 0 {
+		return
+	}
+	err := events.Publish(config.DB, "", events.TypeIngest, map[string]interface{}{
+		"job": run.JobName, "run_id": run.ID, "processed": run.Processed, "failed": run.Failed,
+		"finished_at": run.FinishedAt,
 	})
+	if err != nil {
+		log.Printf("⚠️ 推送入库完成事件失败: %v", err)
+	}
 }
 
-// runRuleChecks 对所有用户跑一次规则匹配，写入新通知。
-// 失败计入日志但不阻塞下次循环。
-func runRuleChecks(ctx context.Context) {
-	n, err := notify.RunForAllUsers(config.DB)
+// runDailyDigest 给所有用户生成最新交易日的日报（见 digest 包），生成的份数计入 processed，
+// 生成或发邮件失败的用户计入 failed。行情还停在更早的交易日时不生成，等入库后手动触发。
+func runDailyDigest(ctx context.Context, p *Progress) error {
+	m, err := digest.LoadMarket(ctx, config.DB, time.Time{})
 	if err != nil {
-		log.Printf("⚠️ 规则匹配失败: %v", err)
+		return err
+	}
+	now := time.Now()
+	want := calendar.LastTradingDay(now)
+	if calendar.IsTradingDay(now) && now.Before(calendar.CloseTime(now)) {
+		want = calendar.PrevTradingDay(now, 1)
+	}
+	if m.Day.Format("2006-01-02") < want.Format("2006-01-02") {
+		return fmt.Errorf("%s 的行情还没入库（stock_history_mv 最新为 %s），入库后手动触发",
+			want.Format("2006-01-02"), m.Day.Format("2006-01-02"))
+	}
+	res, err := digest.Run(ctx, config.DB, m)
+	log.Printf("📦 收盘日报 %s：生成 %d 份，发送邮件 %d 封，失败 %d", m.Day.Format("2006-01-02"), res.Generated, res.Emailed, res.Failed)
+	p.Done(res.Generated)
+	p.Fail(res.Failed)
+	return err
+}
+
+// runNotifyDeliver 重试到期的外发投递，发送成功数计入 processed，最终失败数计入 failed。
+func runNotifyDeliver(ctx context.Context, p *Progress) error {
+	res, err := dispatchNotifications(ctx)
+	p.Done(res.Sent)
+	p.Fail(res.Failed)
+	return err
+}
+
+func dispatchNotifications(ctx context.Context) (notify.DispatchResult, error) {
+	res, err := notify.Dispatch(ctx, config.DB.WithContext(ctx))
+	if res.Sent+res.Retried+res.Failed > 0 {
+		log.Printf("📦 通知外发：成功 %d，待重试 %d，失败 %d", res.Sent, res.Retried, res.Failed)
+	}
+	return res, err
+}
+
+// checkAlerts 新 K 线入库后评估这批股票上的价格提醒（见 alerts 包，best-effort），
+// 有触发且排了外发的马上发一轮，不等 notify_deliver。
+func checkAlerts(ctx context.Context, symbols []string) {
+	if ctx.Err() != nil {
 		return
 	}
-	if n > 0 {
-		log.Printf("✅ 规则匹配：写入 %d 条新通知", n)
-	} else {
-		log.Printf("ℹ️ 规则匹配：无新增通知")
+	res, err := alerts.CheckSymbols(ctx, config.DB, symbols)
+	if err != nil {
+		log.Printf("⚠️ 评估价格提醒失败: %v", err)
+	}
+	if res.Fired > 0 {
+		log.Printf("✅ 价格提醒：评估 %d 条，触发 %d 条", res.Evaluated, res.Fired)
+	}
+	if res.Queued > 0 {
+		if _, err := dispatchNotifications(ctx); err != nil {
+			log.Printf("⚠️ 通知外发失败（notify_deliver 会重试）: %v", err)
+		}
+	}
+}
+
+// runHistoryMV 定义版本落后时重建 stock_history_mv，否则 REFRESH CONCURRENTLY。
+func runHistoryMV(ctx context.Context, p *Progress) error {
+	rebuilt, err := fetcher.EnsureHistoryMV(ctx)
+	if err != nil {
+		return err
+	}
+	if !rebuilt {
+		if err := fetcher.RefreshHistoryMV(ctx); err != nil {
+			return err
+		}
+	}
+	p.Done(1)
+	return nil
+}
+
+// refreshHistoryMV 批量写入结束后刷新 stock_history_mv（best-effort，失败记入 mv_meta，
+// 下一批或 history_mv 任务会再刷）。
+func refreshHistoryMV(ctx context.Context) {
+	if ctx.Err() != nil {
+		return
+	}
+	if err := fetcher.RefreshHistoryMV(ctx); err != nil {
+		log.Printf("⚠️ 刷新 stock_history_mv 失败: %v", err)
 	}
 }
 
 // runOnce 启动时执行一次：检测表是否为空，必要时拉全量列表
-func runOnce(ctx context.Context) {
+func runOnce(ctx context.Context, p *Progress) error {
 	cnt := fetcher.CountBasicInfo()
 	if cnt > 0 {
 		log.Printf("ℹ️ stock_basic_info 已有 %d 行，跳过全量拉取", cnt)
-		return
+		return nil
 	}
 	log.Printf("⏳ stock_basic_info 为空，开始从东方财富拉全量列表...")
-	if err := fetchAndPersistStockList(ctx); err != nil {
-		log.Printf("❌ 全量列表拉取失败: %v", err)
-		return
+	if err := fetchAndPersistStockList(ctx, p); err != nil {
+		return fmt.Errorf("全量列表拉取失败: %w", err)
 	}
 	log.Printf("✅ stock_basic_info 初始化完成")
+	return nil
 }
 
-func fetchAndPersistStockList(ctx context.Context) error {
+func fetchAndPersistStockList(ctx context.Context, p *Progress) error {
 	items, err := fetcher.FetchSinaList(ctx)
 	if err != nil {
 		return err
@@ -102,42 +329,31 @@ func fetchAndPersistStockList(ctx context.Context) error {
 			return err
 		}
 		total += n
+		p.Done(n)
 		log.Printf("✅ 写入 stock_basic_info %d/%d（chunk %d 条）", total, len(items), n)
 	}
 	log.Printf("✅ stock_basic_info 全量入库完成 %d 行", total)
 	log.Printf("⏳ 启动后端东财 detail 补全 industry/market/area...")
-	bumpIndustry := RefetchStockBasics(ctx, fetcherListAllSymbols())
-	if bumpIndustry.Updated > 0 {
-		log.Printf("✅ industry/market/area 补全完成 %d 行（失败 %d）", bumpIndustry.Updated, len(bumpIndustry.Failed))
-	} else {
-		log.Printf("⚠️ industry/market/area 补全 0 行（%d 失败）", len(bumpIndustry.Failed))
+	// 补全失败不影响列表本身，逐股状态可在本次运行里查看，缺的资料由每周的 refetch_basics_all 补上
+	if err := RefetchStockBasics(ctx, p, fetcher.ListAllSymbols()); err != nil {
+		log.Printf("⚠️ industry/market/area 补全失败: %v", err)
 	}
 	return nil
 }
 
-// RefetchSummary 用于 admin 控制器返回
-type RefetchSummary struct {
-	Updated int
-	Failed  []string
-}
-
-// fetcherListAllSymbols 拉所有 symbol（包装 fetcher.ListAllSymbols 统一调用）
-func fetcherListAllSymbols() []string {
-	return fetcher.ListAllSymbols()
-}
-
-// RefetchStockBasics 同步补全指定 symbols 的 industry/market/area/pe/pb/listing_date
-// 一次性拉全市场估值表，然后按 symbol 索引，避免每只请求 1 次。
-func RefetchStockBasics(ctx context.Context, symbols []string) RefetchSummary {
-	summary := RefetchSummary{}
+// RefetchStockBasics 补全指定 symbols 的 industry/market/area/pe/pb/listing_date。
+// 一次性拉全市场估值表，然后按 symbol 索引，避免每只请求 1 次；detail 逐只并发拉，结果最后分批写库。
+func RefetchStockBasics(ctx context.Context, p *Progress, symbols []string) error {
 	if len(symbols) == 0 {
-		return summary
+		log.Printf("ℹ️ 没有 symbol 可补全")
+		return nil
 	}
+	log.Printf("⏳ 补全 %d 只股票的 industry/market/area", len(symbols))
 	// 1) 一次拉全市场估值表
 	t0 := time.Now()
 	vrows, err := fetcher.FetchValuationAll(ctx)
 	if err != nil {
-		return summary
+		return fmt.Errorf("拉估值表: %w", err)
 	}
 	index := make(map[string]fetcher.ValuationRow, len(vrows))
 	for _, r := range vrows {
@@ -146,73 +362,61 @@ func RefetchStockBasics(ctx context.Context, symbols []string) RefetchSummary {
 	log.Printf("✅ 拉一次性估值表 %d 行（%s）", len(vrows), time.Since(t0))
 
 	// 2) 并发拉 detail（name/industry/area/total_shares）并按 symbol 合并估值
-	type result struct {
-		sym string
-		row models.StockBasicInfo
-	}
-	sem := make(chan struct{}, 10)
-	results := make(chan result, len(symbols))
-	var wg sync.WaitGroup
-	for _, sym := range symbols {
-		sym := sym
-		wg.Add(1)
-		sem <- struct{}{}
-		go func() {
-			defer wg.Done()
-			defer func() { <-sem }()
-
-			detail, err := fetcher.FetchEastMoneyDetail(ctx, sym)
-			if err != nil {
-				log.Printf("⚠️ %s 拉 detail 失败: %v", sym, err)
-				summary.Failed = append(summary.Failed, sym)
-				return
-			}
-			row := models.StockBasicInfo{
-				Symbol:      detail.Symbol,
-				Name:        fallbackName(detail.Name, sym),
-				Industry:    detail.Industry,
-				Area:        detail.Area,
-				Market:      detail.Market,
-				Status:      "上市",
-				TotalShares: detail.TotalShares,
-			}
-			if v, ok := index[sym]; ok {
-				row.PETTM = v.PETTM
-				row.PB = v.PB
-				if v.ListingDate != "" {
-					t, err := time.Parse("2006-01-02", v.ListingDate)
-					if err == nil {
-						row.ListingDate = &t
-					}
+	var mu sync.Mutex
+	rows := make([]models.StockBasicInfo, 0, len(symbols))
+	err = p.ForEachSymbol(ctx, symbols, func(ctx context.Context, sym string) error {
+		detail, err := fetcher.FetchEastMoneyDetail(ctx, sym)
+		if err != nil {
+			return fmt.Errorf("拉 detail: %w", err)
+		}
+		row := models.StockBasicInfo{
+			Symbol:      detail.Symbol,
+			Name:        fallbackName(detail.Name, sym),
+			Industry:    detail.Industry,
+			Area:        detail.Area,
+			Market:      detail.Market,
+			Status:      "上市",
+			TotalShares: detail.TotalShares,
+		}
+		if v, ok := index[sym]; ok {
+			row.PETTM = v.PETTM
+			row.PB = v.PB
+			if v.ListingDate != "" {
+				t, err := time.Parse("2006-01-02", v.ListingDate)
+				if err == nil {
+					row.ListingDate = &t
 				}
 			}
-			results <- result{sym: sym, row: row}
-		}()
+		}
+		mu.Lock()
+		rows = append(rows, row)
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		return err
 	}
-	wg.Wait()
-	close(results)
 
+	// 3) 分批写库（取消时已拉到的也照样写入）
 	const chunk = 200
-	batch := make([]models.StockBasicInfo, 0, chunk)
-	for r := range results {
-		batch = append(batch, r.row)
-		if len(batch) >= chunk {
-			n, err := fetcher.UpsertBasicInfoWithValuation(batch)
-			if err != nil {
-				log.Printf("⚠️ batch upsert: %v", err)
-			}
-			summary.Updated += n
-			batch = batch[:0]
+	updated := 0
+	for i := 0; i < len(rows); i += chunk {
+		end := i + chunk
+		if end > len(rows) {
+			end = len(rows)
 		}
-	}
-	if len(batch) > 0 {
-		n, err := fetcher.UpsertBasicInfoWithValuation(batch)
+		n, err := fetcher.UpsertBasicInfoWithValuation(rows[i:end])
 		if err != nil {
-			log.Printf("⚠️ tail batch upsert: %v", err)
+			return fmt.Errorf("写入 stock_basic_info: %w", err)
 		}
-		summary.Updated += n
+		updated += n
 	}
-	return summary
+	_, failed := p.Counts()
+	log.Printf("✅ industry/market/area 补全完成 %d 行（失败 %d）", updated, failed)
+	if updated > 0 {
+		refreshHistoryMV(ctx)
+	}
+	return ctx.Err()
 }
 
 func fallbackName(detailName, sym string) string {
@@ -222,94 +426,106 @@ func fallbackName(detailName, sym string) string {
 	return sym
 }
 
-// RefetchStockBasicsAllFull 基于 DB 现有 symbols，全部一次性补全 industry/market/area。
-func RefetchStockBasicsAllFull(ctx context.Context) error {
-	symbols := fetcher.ListAllSymbols()
+// incrementalSymbols 增量：仅上一个交易日以来有日 K 的 symbol（停牌股不在其列）
+func incrementalSymbols() []string {
+	symbols := fetcher.ActiveSymbolsSince(calendar.PrevTradingDay(time.Now(), 1))
 	if len(symbols) == 0 {
-		log.Printf("ℹ️ DB 里没有 symbol 可补全")
-		return nil
+		// 兜底：拉所有 symbol 的最近 1 条（首次启动后还可能没数据）
+		symbols = fetcher.ListAllSymbols()
 	}
-	log.Printf("⏳ admin 全量补全 %d symbols 的 industry/market/area", len(symbols))
-	summary := RefetchStockBasics(ctx, symbols)
-	log.Printf("✅ admin 全量补全 完成 %d（失败 %d）", summary.Updated, len(summary.Failed))
-	return nil
+	return symbols
 }
 
-// RefetchStockDailyAll 触发全量最近 7 天日 K 抓取
-func RefetchStockDailyAll(ctx context.Context) {
-	symbols := fetcher.ListAllSymbols()
+// fetchDaily 逐只抓最近 7 天日 K 及其衍生数据（增量抓取、全量日 K、重试失败共用），最后评估价格提醒
+func fetchDaily(ctx context.Context, p *Progress, symbols []string) error {
 	if len(symbols) == 0 {
-		log.Printf("ℹ️ 没有 symbol 可抓取")
-		return
+		log.Printf("ℹ️ 没有 symbol 需要抓取")
+		return nil
+	}
+	log.Printf("⏳ 抓取 %d 只股票最近 7 天日 K...", len(symbols))
+	set := loadFormulaSet()
+	if err := p.ForEachSymbol(ctx, symbols, func(ctx context.Context, sym string) error {
+		return fetchOneSymbol(ctx, set, sym, 7)
+	}); err != nil {
+		return err
 	}
-	log.Printf("⏳ admin 触发全量日 K 抓取 %d 只", len(symbols))
-	fetchWithLimit(ctx, symbols, 10, 7)
-	log.Printf("✅ admin 全量日 K 抓取完成")
+	processed, failed := p.Counts()
+	log.Printf("✅ 日 K 抓取完成：成功 %d，失败 %d", processed, failed)
+	if processed > 0 {
+		refreshHistoryMV(ctx)
+		checkAlerts(ctx, symbols)
+	}
+	return ctx.Err()
 }
 
-// runIncrementalFetch 增量：仅拉最近 24h 内有日 K 的 symbol
-func runIncrementalFetch(ctx context.Context) {
-	symbols := fetcher.ActiveSymbolsSince(time.Now().Add(-24 * time.Hour))
-	if len(symbols) == 0 {
-		// 兜底：拉所有 symbol 的最近 1 条（首次启动后还可能没数据）
-		symbols = fetcher.ListAllSymbols()
-	}
-	if len(symbols) == 0 {
-		log.Printf("ℹ️ 没有 symbol 需要抓取")
-		return
+// incompleteSymbols 还有缺口需要补抓的股票
+func incompleteSymbols() []string {
+	symbols, err := fetcher.IncompleteSymbols()
+	if err != nil {
+		log.Printf("⚠️ 统计日 K 完整性失败: %v", err)
 	}
-	log.Printf("⏳ 增量抓取 %d 只股票最近 7 天日 K...", len(symbols))
-	fetchWithLimit(ctx, symbols, 10, 7)
-	log.Printf("✅ 增量抓取完成")
+	return symbols
 }
 
-func loop(ctx context.Context, interval time.Duration, fn func(ctx context.Context)) {
-	t := time.NewTicker(interval)
-	defer t.Stop()
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case <-t.C:
-			fn(ctx)
+// runBackfill 逐只补抓缺失的交易日，每天的结果记在 stock_daily_missing
+func runBackfill(ctx context.Context, p *Progress, symbols []string) error {
+	if len(symbols) == 0 {
+		log.Printf("ℹ️ 日 K 没有需要补抓的缺口")
+		return nil
+	}
+	log.Printf("⏳ 补抓 %d 只股票的日 K 缺口...", len(symbols))
+	set := loadFormulaSet()
+	var filled atomic.Int64
+	if err := p.ForEachSymbol(ctx, symbols, func(ctx context.Context, sym string) error {
+		res, err := fetcher.Backfill(ctx, sym, set)
+		if err != nil {
+			return err
+		}
+		filled.Add(int64(res.Filled))
+		if res.Filled == 0 {
+			return fmt.Errorf("%w: 缺 %d 天，上游无数据 %d 天、隔离 %d 天", ErrSkip, res.Tried, res.NoData, res.Quarantined)
 		}
+		return nil
+	}); err != nil {
+		return err
 	}
+	log.Printf("✅ 日 K 缺口补抓完成：补上 %d 天", filled.Load())
+	if filled.Load() > 0 {
+		refreshHistoryMV(ctx)
+		checkAlerts(ctx, symbols)
+	}
+	return ctx.Err()
 }
 
-// fetchWithLimit 并发抓取，limit 控制最大并发数
-func fetchWithLimit(ctx context.Context, symbols []string, limit int, days int) {
-	sem := make(chan struct{}, limit)
-	var wg sync.WaitGroup
-	for _, sym := range symbols {
-		wg.Add(1)
-		sem <- struct{}{}
-		go func(s string) {
-			defer wg.Done()
-			defer func() { <-sem }()
-			if err := fetchOneSymbol(ctx, s, days); err != nil {
-				log.Printf("⚠️ %s 抓取失败: %v", s, err)
-			}
-		}(sym)
+// loadFormulaSet 每轮抓取开始时编译一次全部自定义公式；失败时本轮不算公式（返回 nil）
+func loadFormulaSet() *fetcher.FormulaSet {
+	set, err := fetcher.LoadFormulaSet()
+	if err != nil {
+		log.Printf("⚠️ 读取自定义公式失败，本轮不重算公式: %v", err)
 	}
-	wg.Wait()
+	return set
 }
 
-// fetchOneSymbol 拉一只，写库：日K + 资金流 + 技术指标
-func fetchOneSymbol(ctx context.Context, symbol string, days int) error {
+// fetchOneSymbol 拉一只，写库：日K + 资金流 + 技术指标 + 自定义公式（set 为本轮已编译的公式）
+func fetchOneSymbol(ctx context.Context, set *fetcher.FormulaSet, symbol string, days int) error {
 	rows, err := fetcher.FetchRecentDaily(ctx, symbol, days)
 	if err != nil {
 		return err
 	}
 	if len(rows) == 0 {
-		return nil
+		return fmt.Errorf("%w: 数据源无日 K（停牌或未上市）", ErrSkip)
+	}
+	// 除权除息事件先同步：下面校验涨跌幅限制时要用
+	if err := fetcher.SyncCorporateActions(ctx, symbol); err != nil {
+		log.Printf("⚠️ %s 同步除权除息失败: %v", symbol, err)
 	}
-	prepared := make([]models.StockDailyData, 0, len(rows))
-	for i, r := range rows {
+	parsed := make([]models.StockDailyData, 0, len(rows))
+	for _, r := range rows {
 		t, perr := time.Parse("2006-01-02", r.Day)
 		if perr != nil {
 			continue
 		}
-		entry := models.StockDailyData{
+		parsed = append(parsed, models.StockDailyData{
 			Symbol:    symbol,
 			TradeDate: t,
 			Open:      r.Open,
@@ -318,15 +534,18 @@ func fetchOneSymbol(ctx context.Context, symbol string, days int) error {
 			Close:     r.Close,
 			Volume:    int64(r.Volume),
 			Turnover:  r.Turnover,
-		}
-		if i > 0 {
-			prev := rows[i-1].Close
-			if prev != 0 {
-				entry.ChangeAmount = fetcher.Round4(r.Close - prev)
-				entry.ChangePercent = fetcher.Round4((r.Close - prev) / prev * 100)
-			}
-		}
-		prepared = append(prepared, entry)
+		})
+	}
+	// 数据质量校验：坏行进隔离表待复核，不进日 K（涨跌幅在这里按前收盘算好）
+	prepared, quarantined, err := fetcher.AdmitDaily(symbol, "fetch", parsed)
+	if err != nil {
+		return fmt.Errorf("校验日 K: %w", err)
+	}
+	if quarantined > 0 {
+		log.Printf("⚠️ %s %d 根日 K 未通过校验，已隔离", symbol, quarantined)
+	}
+	if len(prepared) == 0 {
+		return fmt.Errorf("%w: %d 根日 K 全部被隔离", ErrSkip, quarantined)
 	}
 	if n, err := fetcher.UpsertDaily(prepared); err != nil {
 		return fmt.Errorf("upsert: %w", err)
@@ -344,23 +563,21 @@ func fetchOneSymbol(ctx context.Context, symbol string, days int) error {
 		log.Printf("✅ %s 写入资金流 %d 行", symbol, n)
 	}
 
-	// 历史 MV（资金流已通过表关联在 UpsertHistoryMV 内合并）
-	if n, err := fetcher.UpsertHistoryMV(prepared); err != nil {
-		log.Printf("⚠️ %s 同步到 stock_history_mv: %v", symbol, err)
-	} else {
-		log.Printf("✅ %s 写入 mv %d 行", symbol, n)
+	// 复权因子（新除权日的 K 线刚入库时才能算出因子；因子变化时下面的指标会全量重算）
+	if _, err := fetcher.RebuildAdjFactors(symbol); err != nil {
+		log.Printf("⚠️ %s 重建复权因子失败: %v", symbol, err)
 	}
 
-	// 技术指标（取最近 60 天日 K 计算）
-	recent, err := fetcher.LoadRecentDaily(symbol, 90)
-	if err == nil && len(recent) >= 30 {
-		inds := fetcher.ComputeIndicators(symbol, recent)
-		if n, err := fetcher.UpsertIndicators(inds); err != nil {
-			log.Printf("⚠️ %s 写技术指标失败: %v", symbol, err)
-		} else {
-			log.Printf("✅ %s 写入指标 %d 行", symbol, n)
-		}
+	// 技术指标（按持久化状态增量续算，见 fetcher.RefreshIndicators）
+	if n, err := fetcher.RefreshIndicators(symbol); err != nil {
+		log.Printf("⚠️ %s 写技术指标失败: %v", symbol, err)
+	} else if n > 0 {
+		log.Printf("✅ %s 写入指标 %d 行", symbol, n)
+	}
+
+	// 用户自定义公式在最新交易日的取值（规则条件 formula:NAME 引用）
+	if _, err := fetcher.RefreshFormulaValues(set, symbol); err != nil {
+		log.Printf("⚠️ %s 计算自定义公式失败: %v", symbol, err)
 	}
 	return nil
 }
-
@@ -0,0 +1,168 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"oh-my-stock/config"
+	"oh-my-stock/models"
+)
+
+// runStore job_runs 的读写；测试里换成内存实现。
+type runStore interface {
+	// create 写入一条 running 记录；定时触发的计划时刻已被别的副本记过时返回 false
+	create(run *models.JobRun) (bool, error)
+	finish(run *models.JobRun) error
+	list(name string, limit int) ([]models.JobRun, error)
+	get(id int64) (*models.JobRun, error)
+	// runningJobs 有 running 记录的任务名
+	runningJobs() ([]string, error)
+	// abandon 把 name 的 running 记录标成 failed（调用方须已持有该任务的锁），返回条数
+	abandon(name string) (int64, error)
+}
+
+var store runStore = dbStore{}
+
+type dbStore struct{}
+
+func (dbStore) create(run *models.JobRun) (bool, error) {
+	res := config.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(run)
+	return res.RowsAffected > 0, res.Error
+}
+
+func (dbStore) finish(run *models.JobRun) error {
+	return config.DB.Model(&models.JobRun{}).Where("id = ?", run.ID).Updates(map[string]interface{}{
+		"status":      run.Status,
+		"finished_at": run.FinishedAt,
+		"processed":   run.Processed,
+		"failed":      run.Failed,
+		"error":       run.Error,
+	}).Error
+}
+
+func (dbStore) list(name string, limit int) ([]models.JobRun, error) {
+	if limit <= 0 || limit > 200 {
+		limit = 20
+	}
+	var out []models.JobRun
+	err := config.DB.Where("job_name = ?", name).Order("id DESC").Limit(limit).Find(&out).Error
+	return out, err
+}
+
+func (dbStore) get(id int64) (*models.JobRun, error) {
+	var run models.JobRun
+	if err := config.DB.First(&run, id).Error; err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+func (dbStore) runningJobs() ([]string, error) {
+	var out []string
+	err := config.DB.Model(&models.JobRun{}).Where("status = ?", models.JobRunRunning).
+		Distinct("job_name").Pluck("job_name", &out).Error
+	return out, err
+}
+
+func (dbStore) abandon(name string) (int64, error) {
+	res := config.DB.Model(&models.JobRun{}).
+		Where("job_name = ? AND status = ?", name, models.JobRunRunning).
+		Updates(map[string]interface{}{
+			"status":      models.JobRunFailed,
+			"finished_at": time.Now(),
+			"error":       "所在实例退出，运行中断",
+		})
+	return res.RowsAffected, res.Error
+}
+
+// RunKeep job_runs 保留时长，超过的由 purge 任务清理（见 PruneRuns）。
+// incremental_fetch 盘中每 5 分钟一轮、每轮全市场的 ingest_symbols，不清理每天要多二十多万行。
+const RunKeep = 14 * 24 * time.Hour
+
+// PruneRuns 删除早于 keep 开始、已结束的运行记录，每个任务最近一次运行始终保留（任务列表要显示）；
+// ingest_symbols 随 job_runs 级联删除。返回删除的运行条数。
+func PruneRuns(ctx context.Context, db *gorm.DB, keep time.Duration) (int64, error) {
+	res := db.WithContext(ctx).
+		Where("started_at < ? AND status <> ?", time.Now().Add(-keep), models.JobRunRunning).
+		Where("id NOT IN (SELECT MAX(id) FROM job_runs GROUP BY job_name)").
+		Delete(&models.JobRun{})
+	return res.RowsAffected, res.Error
+}
+
+// ingestStore ingest_symbols 的读写；测试里换成内存实现。
+type ingestStore interface {
+	// seed 把本轮股票写成 pending，attempts 取 prior 里的值（重试运行沿用上一轮）
+	seed(runID int64, symbols []string, prior map[string]int) error
+	// save 写入处理结果
+	save(rows []models.IngestSymbol) error
+	// skipPending 运行中断时把还是 pending 的股票标成 skipped
+	skipPending(runID int64, reason string) (int64, error)
+	// counts 按状态计数
+	counts(runID int64) (map[string]int, error)
+	// list 按状态过滤（空为全部），按股票代码排序分页
+	list(runID int64, status string, offset, limit int) ([]models.IngestSymbol, int64, error)
+}
+
+var ingests ingestStore = dbIngestStore{}
+
+type dbIngestStore struct{}
+
+func (dbIngestStore) seed(runID int64, symbols []string, prior map[string]int) error {
+	now := time.Now()
+	rows := make([]models.IngestSymbol, 0, len(symbols))
+	for _, s := range symbols {
+		rows = append(rows, models.IngestSymbol{
+			RunID: runID, Symbol: s, Status: models.IngestPending, Attempts: prior[s], UpdatedAt: now,
+		})
+	}
+	return config.DB.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(rows, 500).Error
+}
+
+func (dbIngestStore) save(rows []models.IngestSymbol) error {
+	return config.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "run_id"}, {Name: "symbol"}},
+		DoUpdates: clause.AssignmentColumns([]string{"status", "attempts", "last_error", "updated_at"}),
+	}).CreateInBatches(rows, 500).Error
+}
+
+func (dbIngestStore) skipPending(runID int64, reason string) (int64, error) {
+	res := config.DB.Model(&models.IngestSymbol{}).
+		Where("run_id = ? AND status = ?", runID, models.IngestPending).
+		Updates(map[string]interface{}{
+			"status":     models.IngestSkipped,
+			"last_error": reason,
+			"updated_at": time.Now(),
+		})
+	return res.RowsAffected, res.Error
+}
+
+func (dbIngestStore) counts(runID int64) (map[string]int, error) {
+	var rows []struct {
+		Status string
+		N      int
+	}
+	err := config.DB.Model(&models.IngestSymbol{}).Select("status, COUNT(*) AS n").
+		Where("run_id = ?", runID).Group("status").Scan(&rows).Error
+	out := make(map[string]int, len(rows))
+	for _, r := range rows {
+		out[r.Status] = r.N
+	}
+	return out, err
+}
+
+func (dbIngestStore) list(runID int64, status string, offset, limit int) ([]models.IngestSymbol, int64, error) {
+	q := config.DB.Model(&models.IngestSymbol{}).Where("run_id = ?", runID)
+	if status != "" {
+		q = q.Where("status = ?", status)
+	}
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var out []models.IngestSymbol
+	err := q.Order("symbol").Offset(offset).Limit(limit).Find(&out).Error
+	return out, total, err
+}
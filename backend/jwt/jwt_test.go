@@ -0,0 +1,220 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+var now = time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+
+func hmacKey(t *testing.T, kid, secret string, created, expires time.Time) *Key {
+	k, err := NewHMACKey(kid, []byte(secret), created, expires)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func claims(scope string) Claims {
+	return Claims{Subject: "u1", SessionID: "s1", Scope: scope, IssuedAt: now.Unix(), ExpiresAt: now.Add(time.Hour).Unix()}
+}
+
+func TestSignVerify_HS256(t *testing.T) {
+	ks, err := NewKeySet("oh-my-stock", []*Key{hmacKey(t, "k1", "secret-1", time.Time{}, time.Time{})}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tok, err := ks.Sign(claims(""), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(tok, ".")
+	if len(parts) != 3 {
+		t.Fatalf("token = %q", tok)
+	}
+	var h map[string]string
+	raw, _ := base64.RawURLEncoding.DecodeString(parts[0])
+	_ = json.Unmarshal(raw, &h)
+	if h["alg"] != "HS256" || h["typ"] != "JWT" || h["kid"] != "k1" {
+		t.Fatalf("header = %v", h)
+	}
+
+	c, err := ks.Verify(tok, "", now)
+	if err != nil || c.Subject != "u1" || c.SessionID != "s1" || c.Issuer != "oh-my-stock" {
+		t.Fatalf("claims = %+v, err = %v", c, err)
+	}
+	if _, err := ks.Verify(tok, "", now.Add(2*time.Hour)); !errors.Is(err, ErrExpired) {
+		t.Fatalf("过期 err = %v", err)
+	}
+	if _, err := ks.Verify(tok, "events", now); !errors.Is(err, ErrScope) {
+		t.Fatalf("访问 token 当票据用 err = %v", err)
+	}
+	if _, err := ks.Verify(tok[:len(tok)-2]+"AA", "", now); !errors.Is(err, ErrSignature) {
+		t.Fatalf("篡改签名 err = %v", err)
+	}
+	ticket, _ := ks.Sign(claims("events"), now)
+	if _, err := ks.Verify(ticket, "", now); !errors.Is(err, ErrScope) {
+		t.Fatalf("票据当访问 token 用 err = %v", err)
+	}
+}
+
+func TestIssuer(t *testing.T) {
+	k := hmacKey(t, "k1", "secret-1", time.Time{}, time.Time{})
+	ks, _ := NewKeySet("oh-my-stock", []*Key{k}, nil)
+	// 同一把密钥、不配签发方的 KeySet 签出没有 iss 的 token
+	noIss, _ := NewKeySet("", []*Key{k}, nil)
+	other, _ := NewKeySet("someone-else", []*Key{k}, nil)
+
+	tok, _ := noIss.Sign(claims(""), now)
+	if _, err := ks.Verify(tok, "", now); !errors.Is(err, ErrIssuer) {
+		t.Fatalf("缺 iss err = %v", err)
+	}
+	tok, _ = other.Sign(claims(""), now)
+	if _, err := ks.Verify(tok, "", now); !errors.Is(err, ErrIssuer) {
+		t.Fatalf("iss 不一致 err = %v", err)
+	}
+	if _, err := noIss.Verify(tok, "", now); err != nil {
+		t.Fatalf("不配签发方时不校验 iss: %v", err)
+	}
+}
+
+func TestSignVerify_EdDSA(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	der, _ := x509.MarshalPKCS8PrivateKey(priv)
+	pemKey := string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	k, err := NewEdDSAKey("ed1", pemKey, "", now, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks, err := NewKeySet("", []*Key{k}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tok, err := ks.Sign(claims(""), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 标准验签：任何 JWT 库按 RFC 8037 做的也就是这一步
+	parts := strings.Split(tok, ".")
+	sig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	if !ed25519.Verify(pub, []byte(parts[0]+"."+parts[1]), sig) {
+		t.Fatal("Ed25519 签名校验失败")
+	}
+
+	jwks := ks.JWKS(now)
+	if len(jwks.Keys) != 1 || jwks.Keys[0].Kid != "ed1" || jwks.Keys[0].Crv != "Ed25519" ||
+		jwks.Keys[0].X != base64.RawURLEncoding.EncodeToString(pub) {
+		t.Fatalf("jwks = %+v", jwks)
+	}
+
+	// 只有公钥（base64）：能验签，不能签发
+	verifyOnly, err := NewEdDSAKey("ed1", "", base64.StdEncoding.EncodeToString(pub), now, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewKeySet("", []*Key{verifyOnly}, nil); err == nil {
+		t.Fatal("只有公钥时应报没有可签发的密钥")
+	}
+	ks2, _ := NewKeySet("", []*Key{hmacKey(t, "h", "x", time.Time{}, time.Time{}), verifyOnly}, nil)
+	if _, err := ks2.Verify(tok, "", now); err != nil {
+		t.Fatalf("只有公钥验签 err = %v", err)
+	}
+
+	if _, err := NewEdDSAKey("bad", base64.StdEncoding.EncodeToString(make([]byte, 10)), "", now, time.Time{}); err == nil {
+		t.Fatal("长度不对的私钥应报错")
+	}
+	other, _, _ := ed25519.GenerateKey(nil)
+	if _, err := NewEdDSAKey("bad", pemKey, base64.StdEncoding.EncodeToString(other), now, time.Time{}); err == nil {
+		t.Fatal("公私钥不匹配应报错")
+	}
+}
+
+func TestRotation(t *testing.T) {
+	day := 24 * time.Hour
+	oldKey := hmacKey(t, "old", "secret-old", now.Add(-30*day), now.Add(day))
+	newKey := hmacKey(t, "new", "secret-new", now.Add(-day), time.Time{})
+	ksOld, _ := NewKeySet("", []*Key{oldKey}, nil)
+	oldTok, _ := ksOld.Sign(claims(""), now)
+
+	ks, err := NewKeySet("", []*Key{newKey, oldKey}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ks.SigningKeyID() != "new" {
+		t.Fatalf("签发密钥 = %s, want new", ks.SigningKeyID())
+	}
+	if _, err := ks.Verify(oldTok, "", now); err != nil {
+		t.Fatalf("旧密钥签发的 token 轮换后应仍然有效: %v", err)
+	}
+	if _, err := ks.Verify(oldTok, "", now.Add(day)); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("旧密钥过期后 err = %v", err)
+	}
+
+	// created_at 相同时列表里靠后的算更新；新的过期后退回旧的
+	a := hmacKey(t, "a", "1", time.Time{}, time.Time{})
+	b := hmacKey(t, "b", "2", time.Time{}, now.Add(time.Hour))
+	ks, _ = NewKeySet("", []*Key{a, b}, nil)
+	if k, _ := ks.signingKey(now); k.ID != "b" {
+		t.Fatalf("签发密钥 = %s, want b", k.ID)
+	}
+	if k, _ := ks.signingKey(now.Add(2 * time.Hour)); k.ID != "a" {
+		t.Fatalf("b 过期后签发密钥 = %s, want a", k.ID)
+	}
+
+	if _, err := NewKeySet("", []*Key{a, hmacKey(t, "a", "3", time.Time{}, time.Time{})}, nil); err == nil {
+		t.Fatal("kid 重复应报错")
+	}
+}
+
+func TestAlgConfusion(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	k, _ := NewEdDSAKey("ed1", base64.StdEncoding.EncodeToString(priv.Seed()), "", now, time.Time{})
+	ks, _ := NewKeySet("", []*Key{k}, nil)
+	body, _ := json.Marshal(claims(""))
+	for _, alg := range []string{"HS256", "none"} {
+		// 拿公开的公钥当 HMAC 密钥伪造
+		h, _ := json.Marshal(header{Alg: alg, Typ: "JWT", Kid: "ed1"})
+		input := b64.EncodeToString(h) + "." + b64.EncodeToString(body)
+		forged := &Key{Alg: AlgHS256, secret: pub}
+		tok := input + "." + b64.EncodeToString(forged.sign([]byte(input)))
+		if _, err := ks.Verify(tok, "", now); !errors.Is(err, ErrSignature) {
+			t.Fatalf("alg %s err = %v", alg, err)
+		}
+	}
+}
+
+func TestLegacy(t *testing.T) {
+	secret := []byte("old-secret")
+	payload, _ := json.Marshal(legacyPayload{UID: "u1", IAT: now.Unix(), EXP: now.Add(time.Hour).Unix()})
+	p := b64.EncodeToString(payload)
+	tok := p + "." + legacySignature(secret, "", p)
+	ticket := p + "." + legacySignature(secret, "events", p)
+	k := hmacKey(t, "default", string(secret), time.Time{}, time.Time{})
+
+	ks, _ := NewKeySet("oh-my-stock", []*Key{k}, secret)
+	c, err := ks.Verify(tok, "", now)
+	if err != nil || c.Subject != "u1" || c.SessionID != "" {
+		t.Fatalf("老 token claims = %+v, err = %v", c, err)
+	}
+	if _, err := ks.Verify(ticket, "events", now); err != nil {
+		t.Fatalf("老票据 err = %v", err)
+	}
+	if _, err := ks.Verify(ticket, "", now); !errors.Is(err, ErrSignature) {
+		t.Fatalf("老票据当访问 token 用 err = %v", err)
+	}
+	if _, err := ks.Verify(tok, "", now.Add(2*time.Hour)); !errors.Is(err, ErrExpired) {
+		t.Fatalf("老 token 过期 err = %v", err)
+	}
+
+	ks, _ = NewKeySet("oh-my-stock", []*Key{k}, nil)
+	if _, err := ks.Verify(tok, "", now); !errors.Is(err, ErrMalformed) {
+		t.Fatalf("关闭老格式后 err = %v", err)
+	}
+}
@@ -0,0 +1,246 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ============================================================
+// 签名密钥：HS256（共享密钥）或 EdDSA（Ed25519）。
+// 一个 KeySet 里可以同时有多把有效的密钥：签发用最新的（CreatedAt 最大），
+// 校验按 token 头里的 kid 找，没过期的都认。轮换时先加新钥匙，旧的设个过期时间（长于最长的 token 有效期）即可，
+// 不会把已登录的用户踢下线。EdDSA 的公钥通过 JWKS 公开，网关 / 其他服务可以自行验签；HS256 的密钥不公开。
+// ============================================================
+
+// 支持的算法（JWS alg）
+const (
+	AlgHS256 = "HS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// Key 一把签名 / 验签密钥。
+type Key struct {
+	ID        string    // kid
+	Alg       string    // AlgHS256 / AlgEdDSA
+	CreatedAt time.Time // 签发选最新的
+	ExpiresAt time.Time // 过期后不再签发也不再认，零值 = 不过期
+
+	secret []byte             // HS256
+	priv   ed25519.PrivateKey // EdDSA，nil = 只能验签（别的服务签发的公钥）
+	pub    ed25519.PublicKey
+}
+
+// NewHMACKey HS256 密钥。
+func NewHMACKey(kid string, secret []byte, created, expires time.Time) (*Key, error) {
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("密钥 %s: HS256 secret 不能为空", kid)
+	}
+	return &Key{ID: kid, Alg: AlgHS256, CreatedAt: created, ExpiresAt: expires, secret: secret}, nil
+}
+
+// NewEdDSAKey Ed25519 密钥。私钥为 PEM（PKCS#8，`openssl genpkey -algorithm ed25519`）或 base64 的 32 字节种子；
+// 公钥为 PEM（PKIX）或 base64 的 32 字节。只给公钥 = 只能验签。
+func NewEdDSAKey(kid, privateKey, publicKey string, created, expires time.Time) (*Key, error) {
+	k := &Key{ID: kid, Alg: AlgEdDSA, CreatedAt: created, ExpiresAt: expires}
+	if privateKey != "" {
+		priv, err := parsePrivateKey(privateKey)
+		if err != nil {
+			return nil, fmt.Errorf("密钥 %s: 私钥: %w", kid, err)
+		}
+		k.priv = priv
+		k.pub = priv.Public().(ed25519.PublicKey)
+	}
+	if publicKey != "" {
+		pub, err := parsePublicKey(publicKey)
+		if err != nil {
+			return nil, fmt.Errorf("密钥 %s: 公钥: %w", kid, err)
+		}
+		if k.pub != nil && !k.pub.Equal(pub) {
+			return nil, fmt.Errorf("密钥 %s: 公钥和私钥不匹配", kid)
+		}
+		k.pub = pub
+	}
+	if k.pub == nil {
+		return nil, fmt.Errorf("密钥 %s: EdDSA 至少要有私钥或公钥", kid)
+	}
+	return k, nil
+}
+
+func decodeBase64(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		if b, err := enc.DecodeString(s); err == nil {
+			return b, nil
+		}
+	}
+	return nil, errors.New("既不是 PEM 也不是 base64")
+}
+
+func parsePrivateKey(s string) (ed25519.PrivateKey, error) {
+	if block, _ := pem.Decode([]byte(s)); block != nil {
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		priv, ok := key.(ed25519.PrivateKey)
+		if !ok {
+			return nil, errors.New("不是 Ed25519 私钥")
+		}
+		return priv, nil
+	}
+	b, err := decodeBase64(s)
+	if err != nil {
+		return nil, err
+	}
+	switch len(b) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(b), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(b), nil
+	}
+	return nil, fmt.Errorf("长度 %d，应为 32 字节种子或 64 字节私钥", len(b))
+}
+
+func parsePublicKey(s string) (ed25519.PublicKey, error) {
+	if block, _ := pem.Decode([]byte(s)); block != nil {
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		pub, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return nil, errors.New("不是 Ed25519 公钥")
+		}
+		return pub, nil
+	}
+	b, err := decodeBase64(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("长度 %d，应为 32 字节", len(b))
+	}
+	return ed25519.PublicKey(b), nil
+}
+
+// active now 时是否还能用。
+func (k *Key) active(now time.Time) bool {
+	return k.ExpiresAt.IsZero() || now.Before(k.ExpiresAt)
+}
+
+// canSign 有没有签发用的私钥材料。
+func (k *Key) canSign() bool {
+	return k.Alg == AlgHS256 || k.priv != nil
+}
+
+func (k *Key) sign(input []byte) []byte {
+	if k.Alg == AlgEdDSA {
+		return ed25519.Sign(k.priv, input)
+	}
+	mac := hmac.New(sha256.New, k.secret)
+	mac.Write(input)
+	return mac.Sum(nil)
+}
+
+func (k *Key) verify(input, sig []byte) bool {
+	if k.Alg == AlgEdDSA {
+		return ed25519.Verify(k.pub, input, sig)
+	}
+	return hmac.Equal(sig, k.sign(input))
+}
+
+// KeySet 当前的全部密钥，外加迁移期认不认老格式 token。
+type KeySet struct {
+	Issuer string
+	keys   []*Key // 按 CreatedAt 从新到旧
+	byID   map[string]*Key
+	legacy []byte // 老格式 token 的 HMAC 密钥，nil = 不再接受
+}
+
+// NewKeySet 校验 kid 不重复、至少有一把有私钥的密钥（过期与否由 Sign 时判断）。legacySecret 非空时接受老格式 token（见 legacy.go）。
+// CreatedAt 相同的，列表里靠后的算更新。
+func NewKeySet(issuer string, keys []*Key, legacySecret []byte) (*KeySet, error) {
+	ks := &KeySet{Issuer: issuer, byID: map[string]*Key{}, legacy: legacySecret}
+	for _, k := range keys {
+		if k.ID == "" {
+			return nil, errors.New("密钥缺少 kid")
+		}
+		if _, dup := ks.byID[k.ID]; dup {
+			return nil, fmt.Errorf("kid %s 重复", k.ID)
+		}
+		ks.byID[k.ID] = k
+		ks.keys = append(ks.keys, k)
+	}
+	// 倒过来再稳定排序：同样的 CreatedAt 靠后的排前面
+	for i, j := 0, len(ks.keys)-1; i < j; i, j = i+1, j-1 {
+		ks.keys[i], ks.keys[j] = ks.keys[j], ks.keys[i]
+	}
+	sort.SliceStable(ks.keys, func(i, j int) bool { return ks.keys[i].CreatedAt.After(ks.keys[j].CreatedAt) })
+	for _, k := range ks.keys {
+		if k.canSign() {
+			return ks, nil
+		}
+	}
+	return nil, errors.New("没有可用于签发的密钥（只有公钥）")
+}
+
+// signingKey 最新的、没过期、有私钥的密钥。
+func (ks *KeySet) signingKey(now time.Time) (*Key, error) {
+	for _, k := range ks.keys {
+		if k.canSign() && k.active(now) {
+			return k, nil
+		}
+	}
+	return nil, errors.New("没有可用于签发的密钥（都已过期或只有公钥）")
+}
+
+// SigningKeyID 当前签发用的 kid，全都过期时为空。
+func (ks *KeySet) SigningKeyID() string {
+	k, err := ks.signingKey(time.Now())
+	if err != nil {
+		return ""
+	}
+	return k.ID
+}
+
+// AcceptsLegacy 是否还接受老格式 token。
+func (ks *KeySet) AcceptsLegacy() bool { return ks.legacy != nil }
+
+// JWK 一把公钥（RFC 8037 OKP / Ed25519）。
+type JWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+}
+
+// JWKSet GET /.well-known/jwks.json 的响应体。
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS 没过期的 EdDSA 公钥（新的在前）；HS256 是共享密钥，不公开。
+func (ks *KeySet) JWKS(now time.Time) JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	for _, k := range ks.keys {
+		if k.Alg != AlgEdDSA || !k.active(now) {
+			continue
+		}
+		set.Keys = append(set.Keys, JWK{
+			Kty: "OKP", Crv: "Ed25519", X: base64.RawURLEncoding.EncodeToString(k.pub),
+			Kid: k.ID, Alg: AlgEdDSA, Use: "sig",
+		})
+	}
+	return set
+}
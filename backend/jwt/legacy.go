@@ -0,0 +1,52 @@
+package jwt
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+// ============================================================
+// 老格式 token：base64url(payload).hex(hmac_sha256(secret, [scope + ":"] + base64url(payload)))
+// payload = {"uid","sid","iat","exp"}。升级前签发的 token 迁移期内照常可用，
+// 等它们全部过期（最长 jwt.ttl_hours）后把 jwt.accept_legacy 设为 false。新 token 一律签成 JWT。
+// ============================================================
+
+type legacyPayload struct {
+	UID string `json:"uid"`
+	SID string `json:"sid,omitempty"`
+	IAT int64  `json:"iat"`
+	EXP int64  `json:"exp"`
+}
+
+func legacySignature(secret []byte, scope, payloadB64 string) string {
+	mac := hmac.New(sha256.New, secret)
+	if scope != "" {
+		mac.Write([]byte(scope + ":"))
+	}
+	mac.Write([]byte(payloadB64))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (ks *KeySet) verifyLegacy(payloadB64, sig, scope string, now time.Time) (Claims, error) {
+	// scope 拼在签名里：票据冒充不了访问 token，反过来也一样
+	if !hmac.Equal([]byte(sig), []byte(legacySignature(ks.legacy, scope, payloadB64))) {
+		return Claims{}, ErrSignature
+	}
+	raw, err := b64.DecodeString(payloadB64)
+	if err != nil {
+		return Claims{}, ErrMalformed
+	}
+	var p legacyPayload
+	if err := json.Unmarshal(raw, &p); err != nil {
+		return Claims{}, ErrMalformed
+	}
+	// 老格式没有 iss，不做签发方校验
+	c := Claims{Subject: p.UID, SessionID: p.SID, Scope: scope, IssuedAt: p.IAT, ExpiresAt: p.EXP}
+	if err := ks.check(c, scope, now); err != nil {
+		return Claims{}, err
+	}
+	return c, nil
+}
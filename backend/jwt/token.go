@@ -0,0 +1,135 @@
+package jwt
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ============================================================
+// RFC 7519 JWT（JWS Compact：base64url(header).base64url(claims).base64url(signature)）
+// header 固定 {"alg","typ":"JWT","kid"}；校验时 alg 必须和 kid 对应密钥的算法一致，
+// 不认 "none"，也不会拿 HS256 的 alg 去用 EdDSA 公钥验签。
+// ============================================================
+
+var (
+	ErrMalformed  = errors.New("malformed token")
+	ErrSignature  = errors.New("bad signature")
+	ErrExpired    = errors.New("token expired")
+	ErrUnknownKey = errors.New("unknown or expired key")
+	ErrScope      = errors.New("token scope mismatch")
+	ErrIssuer     = errors.New("unexpected issuer")
+)
+
+// Claims token 里的声明。Scope 非空的是只能用于某个用途的短期 token（如事件流票据），和访问 token 互不通用。
+type Claims struct {
+	Issuer    string `json:"iss,omitempty"`
+	Subject   string `json:"sub"`           // 用户 ID
+	SessionID string `json:"sid,omitempty"` // user_sessions.id
+	Scope     string `json:"scope,omitempty"`
+	IssuedAt  int64  `json:"iat"`
+	NotBefore int64  `json:"nbf,omitempty"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ,omitempty"`
+	Kid string `json:"kid,omitempty"`
+}
+
+var b64 = base64.RawURLEncoding
+
+// Sign 用当前最新的密钥签发。Issuer 为空时填 KeySet 的 Issuer。
+func (ks *KeySet) Sign(c Claims, now time.Time) (string, error) {
+	k, err := ks.signingKey(now)
+	if err != nil {
+		return "", err
+	}
+	if c.Issuer == "" {
+		c.Issuer = ks.Issuer
+	}
+	h, err := json.Marshal(header{Alg: k.Alg, Typ: "JWT", Kid: k.ID})
+	if err != nil {
+		return "", err
+	}
+	body, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	input := b64.EncodeToString(h) + "." + b64.EncodeToString(body)
+	return input + "." + b64.EncodeToString(k.sign([]byte(input))), nil
+}
+
+// Verify 校验签名、有效期、签发方（KeySet 配了 Issuer 时 iss 必须一致）和用途（scope 为空 = 访问 token）。
+// 两段式的老格式 token 在 KeySet 还接受时走 verifyLegacy。
+func (ks *KeySet) Verify(token, scope string, now time.Time) (Claims, error) {
+	parts := strings.Split(token, ".")
+	switch len(parts) {
+	case 2:
+		if ks.legacy == nil {
+			return Claims{}, ErrMalformed
+		}
+		return ks.verifyLegacy(parts[0], parts[1], scope, now)
+	case 3:
+	default:
+		return Claims{}, ErrMalformed
+	}
+
+	var h header
+	if err := decodeJSON(parts[0], &h); err != nil {
+		return Claims{}, ErrMalformed
+	}
+	k, ok := ks.byID[h.Kid]
+	if !ok || !k.active(now) {
+		return Claims{}, ErrUnknownKey
+	}
+	if h.Alg != k.Alg {
+		return Claims{}, fmt.Errorf("%w: alg %q", ErrSignature, h.Alg)
+	}
+	sig, err := b64.DecodeString(parts[2])
+	if err != nil || !k.verify([]byte(parts[0]+"."+parts[1]), sig) {
+		return Claims{}, ErrSignature
+	}
+
+	var c Claims
+	if err := decodeJSON(parts[1], &c); err != nil {
+		return Claims{}, ErrMalformed
+	}
+	// 配了签发方就必须一致，缺 iss 也不行；只有老格式 token（没有 iss）豁免，见 verifyLegacy
+	if ks.Issuer != "" && c.Issuer != ks.Issuer {
+		return Claims{}, fmt.Errorf("%w: %q", ErrIssuer, c.Issuer)
+	}
+	if err := ks.check(c, scope, now); err != nil {
+		return Claims{}, err
+	}
+	return c, nil
+}
+
+// check 签名以外的声明校验（签发方由调用方按 token 格式校验）。
+func (ks *KeySet) check(c Claims, scope string, now time.Time) error {
+	if c.Subject == "" {
+		return ErrMalformed
+	}
+	if c.ExpiresAt == 0 || now.Unix() > c.ExpiresAt {
+		return ErrExpired
+	}
+	if c.NotBefore > 0 && now.Unix() < c.NotBefore {
+		return fmt.Errorf("token not valid yet")
+	}
+	if c.Scope != scope {
+		return ErrScope
+	}
+	return nil
+}
+
+func decodeJSON(seg string, v interface{}) error {
+	raw, err := b64.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
@@ -6,15 +6,21 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
 	"strings"
 	"time"
 
+	"oh-my-stock/calendar"
 	"oh-my-stock/config"
 	"oh-my-stock/controllers"
+	"oh-my-stock/events"
+	"oh-my-stock/fetcher"
+	"oh-my-stock/jobs"
 	_ "oh-my-stock/docs" //nolint:unused
 	"oh-my-stock/middleware"
+	"oh-my-stock/notify"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -28,6 +34,27 @@ func main() {
 	config.LoadConfig(configPath)
 	config.InitDB()
 	SeedAdmin(config.DB)
+	if f := config.Cfg.Calendar.HolidaysFile; f != "" {
+		if err := calendar.LoadFile(f); err != nil {
+			log.Printf("⚠️ 加载休市表 %s 失败，使用内置数据: %v", f, err)
+		}
+	}
+	fetcher.Configure(config.Cfg.Fetch)
+	fetcher.ConfigureRetention(config.Cfg.Retention)
+	notify.Configure(config.Cfg.Notify)
+	if err := fetcher.InitProviders(config.Cfg.Providers.Order, config.Cfg.Providers.Options); err != nil {
+		log.Printf("⚠️ 行情数据源初始化失败，抓取不可用: %v", err)
+	}
+
+	// 命令行子命令（如 import），执行完退出
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1:]))
+	}
+
+	// 后台任务：注册 + 按调度运行（见 jobs 包）
+	jobs.Start(context.Background())
+	// 实时事件：LISTEN user_events，按用户扇出给 SSE 连接（见 events 包）
+	events.Start(context.Background(), config.DB)
 
 	r := gin.Default()
 
@@ -42,15 +69,24 @@ func main() {
 		MaxAge:           12 * time.Hour,
 	}))
 
+	// 验签公钥（EdDSA），网关 / 其他服务按 token 头里的 kid 取
+	r.GET("/.well-known/jwks.json", controllers.JWKS)
+
 	v1 := r.Group("/api/v1")
 
 	// ============ 公开路由（不需要 JWT）============
 	v1.POST("/user/register", controllers.Register)
 	v1.POST("/user/login", controllers.Login)
+	v1.POST("/user/token/refresh", controllers.RefreshToken)
+	v1.POST("/user/logout", controllers.Logout)
 
 	// ============ 用户域（需要 JWT）============
 	user := v1.Group("/user", middleware.JWTAuth())
 	{
+		user.POST("/logout-all", controllers.LogoutAll)
+		user.GET("/sessions", controllers.ListSessions)
+		user.DELETE("/sessions/:id", controllers.RevokeSession)
+
 		user.POST("/favorites", controllers.AddFavorite)
 		user.GET("/favorites", controllers.GetFavorites)
 		user.DELETE("/favorites/:id", controllers.DeleteFavorite)
@@ -62,6 +98,66 @@ func main() {
 		user.DELETE("/rules/:id", controllers.DeleteRule)
 		user.POST("/rules/:id/run", controllers.RunRule)
 		user.POST("/rules/preview", controllers.PreviewRule)
+		user.PUT("/rules/:id/notify", controllers.SetRuleNotify)
+
+		user.GET("/notifications", controllers.ListNotifications)
+		user.GET("/notifications/unread-count", controllers.CountUnreadNotifications)
+		user.GET("/notifications/preview", controllers.PreviewNotifications)
+		user.GET("/notifications/policy", controllers.GetNotificationPolicy)
+		user.PUT("/notifications/policy", controllers.UpdateNotificationPolicy)
+		user.POST("/notifications/read-all", controllers.MarkAllNotificationsRead)
+		user.POST("/notifications/:id/read", controllers.MarkNotificationRead)
+
+		user.GET("/channels", controllers.ListChannels)
+		user.POST("/channels", controllers.AddChannel)
+		user.PUT("/channels/:id", controllers.UpdateChannel)
+		user.DELETE("/channels/:id", controllers.DeleteChannel)
+		user.POST("/channels/:id/test", controllers.TestChannel)
+		user.GET("/rules/:id/channels", controllers.GetRuleChannels)
+		user.PUT("/rules/:id/channels", controllers.SetRuleChannels)
+		user.GET("/deliveries", controllers.ListDeliveries)
+
+		user.GET("/alerts", controllers.ListAlerts)
+		user.POST("/alerts", controllers.AddAlert)
+		user.PUT("/alerts/:id", controllers.UpdateAlert)
+		user.DELETE("/alerts/:id", controllers.DeleteAlert)
+
+		user.GET("/digests", controllers.ListDigests)
+		user.GET("/digests/:date", controllers.GetDigest)
+		user.POST("/digests/generate", controllers.GenerateDigest)
+		user.GET("/digest-settings", controllers.GetDigestSettings)
+		user.PUT("/digest-settings", controllers.UpdateDigestSettings)
+		user.POST("/events/ticket", controllers.IssueEventTicket)
+
+		user.POST("/formulas", controllers.AddFormula)
+		user.GET("/formulas", controllers.GetFormulas)
+		user.PUT("/formulas/:id", controllers.UpdateFormula)
+		user.DELETE("/formulas/:id", controllers.DeleteFormula)
+		user.POST("/formulas/check", controllers.CheckFormula)
+	}
+
+	// 实时事件流：EventSource 不能带请求头，单独挂，支持 ?ticket= 鉴权
+	v1.GET("/user/events", middleware.JWTAuthStream(), controllers.StreamEvents)
+
+	// ============ 管理域（需要 JWT + 管理员）============
+	admin := v1.Group("/admin", middleware.JWTAuth(), middleware.AdminOnly())
+	{
+		admin.GET("/jobs", controllers.ListJobs)
+		admin.GET("/jobs/:name/runs", controllers.ListJobRuns)
+		admin.POST("/jobs/:name/trigger", controllers.TriggerJob)
+		admin.POST("/jobs/:name/cancel", controllers.CancelJob)
+		admin.GET("/job-runs/:id", controllers.GetJobRun)
+		admin.GET("/job-runs/:id/symbols", controllers.ListJobRunSymbols)
+		admin.POST("/job-runs/:id/retry-failed", controllers.RetryJobRunFailed)
+		admin.GET("/fetcher/metrics", controllers.GetFetcherMetrics)
+		admin.GET("/quarantine", controllers.ListQuarantine)
+		admin.POST("/quarantine/:id/admit", controllers.AdmitQuarantine)
+		admin.POST("/quarantine/:id/reject", controllers.RejectQuarantine)
+		admin.GET("/data/completeness", controllers.GetDataCompleteness)
+		admin.GET("/data/completeness/:symbol", controllers.GetSymbolCompleteness)
+		admin.GET("/data/mv", controllers.GetHistoryMVStatus)
+		admin.GET("/data/archives", controllers.ListArchives)
+		admin.POST("/corporate-actions", controllers.UpsertCorporateAction)
 	}
 
 	// ============ 股票域（公开）============
@@ -74,7 +170,7 @@ func main() {
 		stock.POST("", controllers.CreateStock)
 		stock.PUT("/:id", controllers.UpdateStock)
 		stock.GET("/symbol/:symbol", controllers.GetStockBySymbol)
-		stock.GET("/history", controllers.GetStockHistory)
+		stock.GET("/history", middleware.JWTOptional(), controllers.GetStockHistory)
 		stock.GET("/info", controllers.GetStockHistoryInfo)
 		stock.GET("/list", controllers.GetStockList)
 		stock.GET("/search", controllers.SearchStocks)
@@ -88,6 +184,11 @@ func main() {
 		stockDaily.POST("", controllers.CreateStockDailyData)
 	}
 
+	corp := v1.Group("/stock-corporate-actions")
+	{
+		corp.GET("/:symbol", controllers.GetCorporateActions)
+	}
+
 	indicator := v1.Group("/stock-indicators")
 	{
 		indicator.POST("", controllers.CreateStockIndicator)
@@ -1,36 +1,119 @@
 package middleware
 
 import (
+	"errors"
+	"log"
 	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"oh-my-stock/auth"
 	"oh-my-stock/config"
+	"oh-my-stock/models"
 )
 
 // ============================================================
 // 鉴权中间件 - 校验 Authorization: Bearer <token>
-// 失败：401；成功：把 user_id 放入 ctx "user_id"
+// 签名、有效期之外还要看 token 所属的会话没有退出或被吊销（auth.Check）
+// 失败：401；成功：把 user_id / session_id 放入 ctx
 // ============================================================
 func JWTAuth() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		auth := c.GetHeader("Authorization")
-		if auth == "" {
+		header := c.GetHeader("Authorization")
+		if header == "" {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing Authorization header"})
 			return
 		}
 		var token string
-		if strings.HasPrefix(auth, "Bearer ") {
-			token = strings.TrimPrefix(auth, "Bearer ")
+		if strings.HasPrefix(header, "Bearer ") {
+			token = strings.TrimPrefix(header, "Bearer ")
 		} else {
-			token = auth
+			token = header
 		}
-		uid, err := config.VerifyToken(token)
-		if err != nil {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token: " + err.Error()})
+		claims, err := config.VerifyToken(token)
+		if !authorize(c, claims, err) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// authorize 校验通过把 claims 放入 ctx 并返回 true，否则中止请求。
+func authorize(c *gin.Context, claims config.Claims, err error) bool {
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token: " + err.Error()})
+		return false
+	}
+	if err := auth.Check(config.DB, claims); err != nil {
+		if errors.Is(err, auth.ErrSessionRevoked) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return false
+		}
+		log.Printf("⚠️ %v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "会话校验失败"})
+		return false
+	}
+	c.Set("user_id", claims.UserID)
+	c.Set("session_id", claims.SessionID)
+	c.Set("claims", claims)
+	return true
+}
+
+// JWTOptional 公开接口上的可选鉴权：带了合法 token 就放入 user_id，否则匿名放行。
+// 用于 /stocks/history 这类公开接口里叠加用户私有数据（如自定义公式）。
+func JWTOptional() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if token != "" {
+			if claims, err := config.VerifyToken(token); err == nil && auth.Check(config.DB, claims) == nil {
+				c.Set("user_id", claims.UserID)
+				c.Set("session_id", claims.SessionID)
+				c.Set("claims", claims)
+			}
+		}
+		c.Next()
+	}
+}
+
+// StreamScope 实时事件票据的用途，见 config.IssueScopedToken。
+const StreamScope = "events"
+
+// JWTAuthStream 给 SSE 用的鉴权：浏览器的 EventSource 不能带请求头，
+// 没有 Authorization 时用 ?ticket= 里的短期票据（POST /user/events/ticket 换取，只能用于事件流）。
+// 不直接接受 URL 里的登录 token，免得它落进访问日志。
+func JWTAuthStream() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var (
+			claims config.Claims
+			err    error
+		)
+		if header := c.GetHeader("Authorization"); header != "" {
+			claims, err = config.VerifyToken(strings.TrimPrefix(header, "Bearer "))
+		} else if ticket := c.Query("ticket"); ticket != "" {
+			claims, err = config.VerifyScopedToken(ticket, StreamScope)
+		} else {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing Authorization header or ticket"})
+			return
+		}
+		if !authorize(c, claims, err) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// AdminOnly 管理接口：须挂在 JWTAuth 之后，非管理员返回 403。
+func AdminOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var u models.User
+		if err := config.DB.Select("is_admin", "is_active").Where("id = ?", GetUserID(c)).First(&u).Error; err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "用户不存在"})
+			return
+		}
+		if !u.IsAdmin || !u.IsActive {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "需要管理员权限"})
 			return
 		}
-		c.Set("user_id", uid)
 		c.Next()
 	}
 }
@@ -44,3 +127,20 @@ func GetUserID(c *gin.Context) string {
 	s, _ := v.(string)
 	return s
 }
+
+// GetSessionID 当前 token 所属的会话，升级前签发的老 token 为空
+func GetSessionID(c *gin.Context) string {
+	v, _ := c.Get("session_id")
+	s, _ := v.(string)
+	return s
+}
+
+// GetClaims 当前 token 的声明，长连接（SSE）里定期重新 auth.Check 用
+func GetClaims(c *gin.Context) (config.Claims, bool) {
+	v, ok := c.Get("claims")
+	if !ok {
+		return config.Claims{}, false
+	}
+	claims, ok := v.(config.Claims)
+	return claims, ok
+}
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// ArchiveFile 过期数据归档出去的一个文件：某张表一个自然月的行（见 fetcher.PurgeExpired）。
+type ArchiveFile struct {
+	ID        int64     `gorm:"primaryKey" json:"id"`
+	Table     string    `gorm:"column:table_name;type:varchar(63);not null" json:"table"`
+	Month     time.Time `gorm:"type:date;not null" json:"month"` // 该月 1 日
+	Path      string    `gorm:"type:text;not null" json:"path"`
+	Rows      int64     `gorm:"not null" json:"rows"`
+	Bytes     int64     `gorm:"not null" json:"bytes"`
+	SHA256    string    `gorm:"column:sha256;type:char(64);not null" json:"sha256"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (ArchiveFile) TableName() string {
+	return "archive_files"
+}
+
+// RetentionHold 从归档装回的区间在 hold_until 之前不再被裁剪（见 importer.Restore）。
+type RetentionHold struct {
+	ID        int64     `gorm:"primaryKey" json:"id"`
+	Table     string    `gorm:"column:table_name;type:varchar(63);not null" json:"table"`
+	FromDate  time.Time `gorm:"type:date;not null" json:"from_date"`
+	ToDate    time.Time `gorm:"type:date;not null" json:"to_date"`
+	HoldUntil time.Time `gorm:"not null" json:"hold_until"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (RetentionHold) TableName() string {
+	return "retention_holds"
+}
@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// DailyDigest 收盘日报（见 digest 包）：每个用户每个交易日一份，重新生成时覆盖。
+// Summary 是结构化内容（JSON），Markdown / HTML 是渲染好的正文。
+type DailyDigest struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	UserID      string     `gorm:"type:uuid;not null" json:"user_id"`
+	TradeDate   time.Time  `gorm:"type:date;not null" json:"trade_date"`
+	Title       string     `gorm:"type:varchar(200);not null" json:"title"`
+	Summary     []byte     `gorm:"type:jsonb;not null" json:"-"`
+	Markdown    string     `gorm:"type:text;not null" json:"-"`
+	HTML        string     `gorm:"column:html;type:text;not null" json:"-"`
+	EmailStatus string     `gorm:"type:varchar(10);not null;default:''" json:"email_status"` // '' 没发过 / sent / failed
+	EmailError  string     `gorm:"type:text;not null;default:''" json:"email_error,omitempty"`
+	EmailedAt   *time.Time `json:"emailed_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+func (DailyDigest) TableName() string {
+	return "daily_digests"
+}
+
+// DigestSetting 用户的日报设置；没有记录时按默认：生成、不发邮件。
+// EmailTo 为空时发到注册邮箱（users.email）。
+type DigestSetting struct {
+	UserID    string    `gorm:"type:uuid;primaryKey" json:"-"`
+	Enabled   bool      `gorm:"not null;default:true" json:"enabled"`
+	Email     bool      `gorm:"not null;default:false" json:"email"`
+	EmailTo   string    `gorm:"type:varchar(200);not null;default:''" json:"email_to"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (DigestSetting) TableName() string {
+	return "digest_settings"
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// 采集任务中单只股票的状态
+const (
+	IngestPending = "pending"
+	IngestOK      = "ok"
+	IngestFailed  = "failed"
+	IngestSkipped = "skipped" // 无数据 / 数据源不支持 / 任务取消时未处理
+)
+
+// IngestSymbol 按股票采集的任务（见 jobs.Progress.ForEachSymbol）每次运行中每只股票一行。
+type IngestSymbol struct {
+	RunID     int64     `gorm:"primaryKey;autoIncrement:false" json:"run_id"` // job_runs.id
+	Symbol    string    `gorm:"primaryKey;type:varchar(10)" json:"symbol"`
+	Status    string    `gorm:"type:varchar(10);not null" json:"status"`
+	Attempts  int       `gorm:"not null;default:0" json:"attempts"` // 累计处理次数（重试失败的运行会沿用上一轮的次数）
+	LastError string    `gorm:"type:text" json:"last_error,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (IngestSymbol) TableName() string {
+	return "ingest_symbols"
+}
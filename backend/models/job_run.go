@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// 任务运行状态
+const (
+	JobRunRunning  = "running"
+	JobRunSuccess  = "success"
+	JobRunFailed   = "failed"
+	JobRunCanceled = "canceled"
+)
+
+// JobRun 后台任务的一次运行记录（见 jobs 包）。
+type JobRun struct {
+	ID          int64  `gorm:"primaryKey" json:"id"`
+	JobName     string `gorm:"type:varchar(50);not null;index" json:"job_name"`
+	Trigger     string `gorm:"type:varchar(20);not null" json:"trigger"` // schedule / manual / startup / retry
+	TriggeredBy string `gorm:"type:varchar(64)" json:"triggered_by,omitempty"`
+	// ScheduledFor 定时触发的计划时刻；(job_name, scheduled_for) 唯一，多副本同一时刻只有一个能记上
+	ScheduledFor *time.Time `json:"scheduled_for,omitempty"`
+	Instance     string     `gorm:"type:varchar(100)" json:"instance"` // 运行所在副本（主机名:pid）
+	RetryOf      *int64     `json:"retry_of,omitempty"`                // 只重试失败股票时，指向被重试的运行
+	Status       string     `gorm:"type:varchar(20);not null" json:"status"`
+	StartedAt    time.Time  `gorm:"not null" json:"started_at"`
+	FinishedAt   *time.Time `json:"finished_at"`
+	Processed    int        `gorm:"not null;default:0" json:"processed"` // 成功处理的条数（股票数、行数……由任务自己定义）
+	Failed       int        `gorm:"not null;default:0" json:"failed"`
+	Error        string     `gorm:"type:text" json:"error,omitempty"`
+}
+
+func (JobRun) TableName() string {
+	return "job_runs"
+}
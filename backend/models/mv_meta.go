@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// MVMeta 后端管理的物化视图：当前定义版本和最近一次刷新的结果（见 fetcher.EnsureHistoryMV）。
+type MVMeta struct {
+	Name          string     `gorm:"primaryKey;type:varchar(63)" json:"name"`
+	Version       int        `gorm:"not null" json:"version"`
+	RefreshedAt   *time.Time `json:"refreshed_at"`                     // 最近一次成功刷新（或重建）的完成时间
+	RefreshMS     int        `json:"refresh_ms"`                       // 最近一次成功刷新耗时
+	SourceMaxDate *time.Time `gorm:"type:date" json:"source_max_date"` // 刷新开始时 stock_daily_data 的最大交易日
+	MVMaxDate     *time.Time `gorm:"column:mv_max_date;type:date" json:"mv_max_date"`
+	MVRows        int64      `gorm:"column:mv_rows" json:"mv_rows"` // 估算行数（pg_class.reltuples）
+	LastError     string     `gorm:"type:text" json:"last_error,omitempty"`
+	LastErrorAt   *time.Time `json:"last_error_at,omitempty"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+func (MVMeta) TableName() string {
+	return "mv_meta"
+}
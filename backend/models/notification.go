@@ -0,0 +1,59 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Notification 站内通知：规则命中（RuleID，同一 (用户, 规则, 股票, 交易日) 只写一条）
+// 或价格提醒触发（AlertID，见 alerts 包）。
+// 打开了合并通知（NotificationPolicy.GroupHits）时，规则一轮的命中合成一条：Symbols 是全部股票，
+// Symbol 是其中涨幅最大的一只。
+type Notification struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    string     `gorm:"type:uuid;not null" json:"user_id"`
+	RuleID    *uint      `json:"rule_id"`
+	AlertID   *uint      `json:"alert_id,omitempty"`
+	RuleName  string     `gorm:"type:varchar(100)" json:"rule_name"` // 冗余，规则删除后历史通知仍可读
+	Symbol    string     `gorm:"type:varchar(10);not null" json:"symbol"`
+	StockName string     `gorm:"type:varchar(50)" json:"stock_name"`
+	Symbols   StringList `gorm:"type:jsonb;not null;default:'[]'" json:"symbols,omitempty"`
+	TradeDate time.Time  `gorm:"type:date;not null" json:"trade_date"`
+	Title     string     `gorm:"type:varchar(200);not null" json:"title"`
+	Message   string     `gorm:"type:text" json:"message"`
+	IsRead    bool       `gorm:"not null;default:false" json:"is_read"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+func (Notification) TableName() string {
+	return "notifications"
+}
+
+// StringList 存成 JSONB 数组的字符串列表。
+type StringList []string
+
+func (l StringList) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+	b, err := json.Marshal([]string(l))
+	return string(b), err
+}
+
+func (l *StringList) Scan(src interface{}) error {
+	var b []byte
+	switch v := src.(type) {
+	case nil:
+		*l = nil
+		return nil
+	case []byte:
+		b = v
+	case string:
+		b = []byte(v)
+	default:
+		return fmt.Errorf("StringList: 不支持的类型 %T", src)
+	}
+	return json.Unmarshal(b, (*[]string)(l))
+}
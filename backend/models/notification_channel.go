@@ -0,0 +1,58 @@
+package models
+
+import "time"
+
+// NotificationChannel 用户配置的外发渠道：webhook / email / wecom / dingtalk / feishu。
+// Config 按类型存 url、secret、to 等，含密钥，不直接输出（见 controllers 里的脱敏）。
+type NotificationChannel struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    string    `gorm:"type:uuid;not null" json:"user_id"`
+	Name      string    `gorm:"type:varchar(50);not null" json:"name"`
+	Type      string    `gorm:"type:varchar(20);not null" json:"type"`
+	Config    []byte    `gorm:"type:jsonb;not null" json:"-"`
+	Enabled   bool      `gorm:"not null;default:true" json:"enabled"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (NotificationChannel) TableName() string {
+	return "notification_channels"
+}
+
+// RuleChannel 规则命中后推送到哪些渠道（多对多）。
+type RuleChannel struct {
+	RuleID    uint `gorm:"primaryKey" json:"rule_id"`
+	ChannelID uint `gorm:"primaryKey" json:"channel_id"`
+}
+
+func (RuleChannel) TableName() string {
+	return "rule_channels"
+}
+
+// NotificationDelivery 一条通知往一个渠道的投递记录，也是重试队列。
+// NotificationID 为空表示测试发送。
+type NotificationDelivery struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	UserID         string     `gorm:"type:uuid;not null" json:"user_id"`
+	ChannelID      uint       `gorm:"not null" json:"channel_id"`
+	NotificationID *uint      `json:"notification_id"`
+	Status         string     `gorm:"type:varchar(10);not null;default:pending" json:"status"` // pending / sent / failed
+	Attempts       int        `gorm:"not null;default:0" json:"attempts"`
+	LastError      string     `gorm:"type:text" json:"last_error"`
+	ResponseCode   int        `json:"response_code"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at"`
+	SentAt         *time.Time `json:"sent_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+func (NotificationDelivery) TableName() string {
+	return "notification_deliveries"
+}
+
+// 投递状态
+const (
+	DeliveryPending = "pending"
+	DeliverySent    = "sent"
+	DeliveryFailed  = "failed"
+)
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// NotificationPolicy 用户的通知策略（见 notify/policy.go）；没有记录时按 notify.DefaultPolicy。
+type NotificationPolicy struct {
+	UserID          string    `gorm:"type:uuid;primaryKey" json:"-"`
+	QuietStart      string    `gorm:"type:varchar(5);not null;default:''" json:"quiet_start"` // 免打扰开始 HH:MM（上海时间），空 = 不免打扰
+	QuietEnd        string    `gorm:"type:varchar(5);not null;default:''" json:"quiet_end"`   // 免打扰结束 HH:MM，可以跨零点
+	MaxPerRuleDaily int       `gorm:"not null;default:50" json:"max_per_rule_daily"`          // 每条规则每个交易日最多几条通知
+	GroupHits       bool      `gorm:"not null;default:false" json:"group_hits"`               // 一条规则一轮的命中合成一条
+	NewEntriesOnly  bool      `gorm:"not null;default:false" json:"new_entries_only"`         // 只通知新进（前一交易日没命中）的股票
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+func (NotificationPolicy) TableName() string {
+	return "notification_policies"
+}
@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// StockCorporateAction 除权除息事件（分红、送股、转增、配股），均为每股口径。
+// 例如 10 派 3 送 2 转 3：CashDividend=0.3, BonusRatio=0.2, TransferRatio=0.3。
+type StockCorporateAction struct {
+	Symbol        string    `gorm:"type:varchar(10);primaryKey" json:"symbol"`
+	ExDate        time.Time `gorm:"type:date;primaryKey" json:"ex_date"`      // 除权除息日
+	CashDividend  float64   `gorm:"type:decimal(12,6)" json:"cash_dividend"`  // 每股派现(元，税前)
+	BonusRatio    float64   `gorm:"type:decimal(12,6)" json:"bonus_ratio"`    // 每股送股
+	TransferRatio float64   `gorm:"type:decimal(12,6)" json:"transfer_ratio"` // 每股转增
+	RightsRatio   float64   `gorm:"type:decimal(12,6)" json:"rights_ratio"`   // 每股配股
+	RightsPrice   float64   `gorm:"type:decimal(12,4)" json:"rights_price"`   // 配股价(元)
+	Source        string    `gorm:"type:varchar(20)" json:"source"`
+	CreatedAt     time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+func (StockCorporateAction) TableName() string {
+	return "stock_corporate_actions"
+}
+
+// StockAdjFactor 后复权累计因子，只在除权除息日记一行：
+// 自 ExDate 起（直到下一行之前）每根 K 线的后复权价 = 原始价 × Factor，
+// 第一次除权之前因子为 1。前复权价 = 原始价 × Factor / 最新因子。
+type StockAdjFactor struct {
+	Symbol string    `gorm:"type:varchar(10);primaryKey" json:"symbol"`
+	ExDate time.Time `gorm:"type:date;primaryKey" json:"ex_date"`
+	Factor float64   `json:"factor"`
+}
+
+func (StockAdjFactor) TableName() string {
+	return "stock_adj_factors"
+}
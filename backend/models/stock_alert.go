@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// StockAlert 用户对单只股票设的价格 / 指标提醒（见 alerts 包）。
+// 新 K 线入库后评估，触发时写一条通知（AlertID 指回这里），可选再推到一个外发渠道。
+// Repeat=false 触发一次后自动停用；Repeat=true 按 CooldownMinutes 冷却后可再次触发。
+type StockAlert struct {
+	ID              uint       `gorm:"primaryKey" json:"id"`
+	UserID          string     `gorm:"type:uuid;not null" json:"user_id"`
+	Symbol          string     `gorm:"type:varchar(10);not null" json:"symbol"`
+	Kind            string     `gorm:"type:varchar(20);not null" json:"kind"`      // price_cross / pct_move / volume_spike / rsi_zone / boll_touch
+	Direction       string     `gorm:"type:varchar(10);not null" json:"direction"` // above / below / up / down / any / upper / lower
+	Threshold       float64    `gorm:"type:decimal(16,4);not null" json:"threshold"`
+	Period          int        `gorm:"not null;default:0" json:"period,omitempty"` // rsi_zone 用 RSI 的周期：6 / 12 / 24
+	RefClose        *float64   `gorm:"type:decimal(12,4)" json:"ref_close"`        // pct_move 的参考收盘价，空 = 前一交易日收盘
+	ChannelID       *uint      `json:"channel_id"`                                 // 触发时额外推送的外发渠道，空 = 只站内通知
+	Note            string     `gorm:"type:varchar(200)" json:"note"`
+	Repeat          bool       `gorm:"not null;default:false" json:"repeat"`
+	CooldownMinutes int        `gorm:"not null;default:0" json:"cooldown_minutes"`
+	Active          bool       `gorm:"not null;default:true" json:"active"`
+	LastTriggeredAt *time.Time `json:"last_triggered_at"`
+	TriggerCount    int        `gorm:"not null;default:0" json:"trigger_count"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+func (StockAlert) TableName() string {
+	return "stock_alerts"
+}
@@ -14,6 +14,8 @@ type StockBasicInfo struct {
 	ListingDate       *time.Time `json:"listing_date" example:"1999-11-10"`
 	OutstandingShares float64    `gorm:"type:decimal(20,4)" json:"outstanding_shares" example:"2930026.0000"`
 	TotalShares       float64    `gorm:"type:decimal(20,4)" json:"total_shares" example:"2930026.0000"`
+	PETTM             float64    `gorm:"column:pettm;type:decimal(10,4)" json:"pe_ttm" example:"5.12"` // 市盈率(TTM)，估值表刷新
+	PB                float64    `gorm:"column:pb;type:decimal(10,4)" json:"pb" example:"0.45"`        // 市净率
 	IsHs              bool       `json:"is_hs" example:"true"`
 	Status            string     `gorm:"type:varchar(20)" json:"status" example:"上市"`
 	CreatedAt         time.Time  `gorm:"autoCreateTime" json:"created_at" example:"2025-08-13T10:00:00+08:00"`
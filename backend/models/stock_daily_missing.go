@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// 缺失交易日的补抓状态
+const (
+	MissingOpen        = "missing"     // 还缺，等待补抓
+	MissingFilled      = "filled"      // 已补上
+	MissingQuarantined = "quarantined" // 补抓到了但未通过校验，等隔离区复核
+	MissingUnavailable = "unavailable" // 多次补抓上游都没有（多半是停牌），不再自动补
+)
+
+// StockDailyMissing 日 K 缺失的交易日及补抓结果（见 fetcher.Backfill）。
+type StockDailyMissing struct {
+	Symbol    string    `gorm:"primaryKey;type:varchar(10)" json:"symbol"`
+	TradeDate time.Time `gorm:"primaryKey;type:date" json:"trade_date"`
+	Status    string    `gorm:"type:varchar(12);not null" json:"status"`
+	Attempts  int       `gorm:"not null;default:0" json:"attempts"`
+	LastError string    `gorm:"type:text" json:"last_error,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (StockDailyMissing) TableName() string {
+	return "stock_daily_missing"
+}
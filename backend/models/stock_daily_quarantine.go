@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+// 隔离记录的复核状态
+const (
+	QuarantinePending  = "pending"
+	QuarantineAdmitted = "admitted" // 管理员确认无误，已写入 stock_daily_data
+	QuarantineRejected = "rejected" // 确认是坏数据，之后再抓到同样的 K 线直接丢弃
+)
+
+// StockDailyQuarantine 未通过数据质量校验的日 K（见 quality 包），复核前不进入 stock_daily_data。
+type StockDailyQuarantine struct {
+	ID         int64      `gorm:"primaryKey" json:"id"`
+	Symbol     string     `gorm:"type:varchar(10);not null" json:"symbol"`
+	TradeDate  time.Time  `gorm:"type:date;not null" json:"trade_date"`
+	Open       float64    `gorm:"type:decimal(12,4)" json:"open"`
+	High       float64    `gorm:"type:decimal(12,4)" json:"high"`
+	Low        float64    `gorm:"type:decimal(12,4)" json:"low"`
+	Close      float64    `gorm:"type:decimal(12,4)" json:"close"`
+	Volume     int64      `gorm:"type:bigint" json:"volume"`
+	Turnover   float64    `gorm:"type:decimal(20,4)" json:"turnover"`
+	Reason     string     `gorm:"type:varchar(30);not null" json:"reason"` // quality.Reason
+	Detail     string     `gorm:"type:text" json:"detail"`
+	Source     string     `gorm:"type:varchar(30)" json:"source"` // fetch / import
+	Status     string     `gorm:"type:varchar(10);not null" json:"status"`
+	ReviewedBy string     `gorm:"type:varchar(64)" json:"reviewed_by,omitempty"`
+	ReviewedAt *time.Time `json:"reviewed_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+func (StockDailyQuarantine) TableName() string {
+	return "stock_daily_quarantine"
+}
+
+// Bar 还原成日 K 行（不含涨跌幅）。
+func (q StockDailyQuarantine) Bar() StockDailyData {
+	return StockDailyData{
+		Symbol: q.Symbol, TradeDate: q.TradeDate,
+		Open: q.Open, High: q.High, Low: q.Low, Close: q.Close,
+		Volume: q.Volume, Turnover: q.Turnover,
+	}
+}
@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// StockIndicatorState 递推类指标的续算状态，每只股票一行。
+// 对应 LastDate 那根 K 线收盘后的 EMA/KDJ/RSI/OBV 值，见 indicators/state.go。
+type StockIndicatorState struct {
+	Symbol    string    `gorm:"type:varchar(10);primaryKey" json:"symbol"`
+	LastDate  time.Time `gorm:"type:date;not null" json:"last_date"` // 状态对应的最后一根已定型 K 线
+	LastClose float64   `json:"last_close"`                          // 该 K 线收盘价，用于检测历史改写
+	Bars      int       `json:"bars"`                                // 累计参与递推的 K 线根数
+	// 续算窗口（LastDate 及之前 WindowBars 根）的第一根，用于检测窗口内补进 / 删掉 K 线；老状态为零值
+	WindowFrom time.Time `gorm:"type:date" json:"window_from"`
+	EMA12      float64   `json:"ema12"`
+	EMA26      float64   `json:"ema26"`
+	DEA        float64   `json:"dea"`
+	K          float64   `json:"k"`
+	D          float64   `json:"d"`
+	RSI6Up     float64   `json:"rsi6_up"`
+	RSI6Abs    float64   `json:"rsi6_abs"`
+	RSI12Up    float64   `json:"rsi12_up"`
+	RSI12Abs   float64   `json:"rsi12_abs"`
+	RSI24Up    float64   `json:"rsi24_up"`
+	RSI24Abs   float64   `json:"rsi24_abs"`
+	OBV        float64   `json:"obv"`
+	UpdatedAt  time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+func (StockIndicatorState) TableName() string {
+	return "stock_indicator_state"
+}
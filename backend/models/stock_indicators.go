@@ -12,6 +12,8 @@ type StockIndicator struct {
 	MA10      *float64  `json:"ma10"`
 	MA20      *float64  `json:"ma20"`
 	MA60      *float64  `json:"ma60"`
+	MA120     *float64  `json:"ma120"` // 半年线
+	MA250     *float64  `json:"ma250"` // 年线
 	MACD      *float64  `json:"macd"`
 	DIF       *float64  `json:"dif"`
 	DEA       *float64  `json:"dea"`
@@ -24,6 +26,16 @@ type StockIndicator struct {
 	BollUpper *float64  `json:"boll_upper"`
 	BollMid   *float64  `json:"boll_mid"`
 	BollLower *float64  `json:"boll_lower"`
+	ATR14     *float64  `json:"atr14"` // 平均真实波幅 ATR(14)
+	OBV       *float64  `json:"obv"`   // 能量潮（股）
+	CCI14     *float64  `json:"cci14"` // 顺势指标 CCI(14)
+	WR6       *float64  `json:"wr6"`   // 威廉指标 WR(6)
+	WR10      *float64  `json:"wr10"`  // 威廉指标 WR(10)
+	PDI       *float64  `json:"pdi"`   // DMI +DI(14)
+	MDI       *float64  `json:"mdi"`   // DMI -DI(14)
+	ADX       *float64  `json:"adx"`   // DMI ADX(14,6)
+	ADXR      *float64  `json:"adxr"`  // DMI ADXR(14,6)
+	VWAP      *float64  `json:"vwap"`  // 当日成交均价 = 成交额/成交量
 	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
 }
 
@@ -14,8 +14,12 @@ type User struct {
 	Email        string    `gorm:"unique"`
 	Phone        string    `gorm:"unique"`
 	IsActive     bool      `gorm:"default:true"`
+	IsAdmin      bool      `gorm:"not null;default:false"` // 可访问 /api/v1/admin
 	CreatedAt    time.Time `gorm:"autoCreateTime"`
 	UpdatedAt    time.Time `gorm:"autoUpdateTime"`
+
+	// 早于这个时刻签发、不带会话的老 token 一律失效（「退出所有设备」时设置，见 auth 包）
+	TokensRevokedAt *time.Time
 }
 
 func (u *User) BeforeCreate(tx *gorm.DB) (err error) {
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// UserEvent 推给前端的实时事件（见 events 包），也是断线重连时按 Last-Event-ID 补发的来源。
+// UserID 为空表示发给所有在线用户（如行情入库完成）。
+type UserEvent struct {
+	ID        int64     `gorm:"primaryKey" json:"id"`
+	UserID    *string   `gorm:"type:uuid" json:"user_id,omitempty"`
+	Type      string    `gorm:"type:varchar(30);not null" json:"type"`
+	Data      []byte    `gorm:"type:jsonb;not null" json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (UserEvent) TableName() string {
+	return "user_events"
+}
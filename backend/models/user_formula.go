@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// UserFormula 用户自定义指标公式（通达信风格，语法见 formula 包）。
+type UserFormula struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	UserID      string    `gorm:"type:uuid;not null;index" json:"user_id"`
+	Name        string    `gorm:"type:varchar(50);not null" json:"name"` // 同一用户内唯一，统一大写
+	Source      string    `gorm:"type:text;not null" json:"source"`      // 公式源码
+	Description string    `gorm:"type:varchar(200)" json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+func (UserFormula) TableName() string {
+	return "user_formulas"
+}
+
+// UserFormulaValue 公式输出线在每只股票最新交易日的取值，供规则条件引用。
+// 每条 (formula, symbol, output) 只保留一行，随日 K 刷新覆盖。
+type UserFormulaValue struct {
+	FormulaID uint      `gorm:"primaryKey" json:"formula_id"`
+	Symbol    string    `gorm:"type:varchar(10);primaryKey" json:"symbol"`
+	Output    string    `gorm:"type:varchar(50);primaryKey" json:"output"`
+	TradeDate time.Time `gorm:"type:date;not null" json:"trade_date"`
+	Value     *float64  `json:"value"`                       // 无效值（窗口不足等）为 NULL
+	InputHash int64     `gorm:"not null;default:0" json:"-"` // 求值时输入 K 线的指纹，没变就不重算
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+func (UserFormulaValue) TableName() string {
+	return "user_formula_values"
+}
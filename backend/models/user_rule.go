@@ -8,7 +8,8 @@ type UserStockRule struct {
 	ID             uint      `gorm:"primaryKey" json:"id"`
 	UserID         string    `json:"user_id"`
 	RuleName       string    `json:"rule_name"`
-	RuleExpression []byte    `gorm:"type:jsonb" json:"-"` // 存 PostgreSQL JSONB
+	RuleExpression []byte    `gorm:"type:jsonb" json:"-"`                          // 存 PostgreSQL JSONB
+	NotifyOnMatch  bool      `gorm:"not null;default:true" json:"notify_on_match"` // 命中时是否写通知
 	CreatedAt      time.Time `json:"created_at"`
 	UpdatedAt      time.Time `json:"updated_at"`
 }
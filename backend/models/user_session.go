@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// UserSession 登录会话（见 auth 包）：一次登录一行，refresh token 只存 SHA-256。
+// 每次刷新轮换 refresh token，上一个的哈希留在 PrevHash 里，用来识别被盗用后的重放。
+type UserSession struct {
+	ID           string     `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID       string     `gorm:"type:uuid;not null" json:"-"`
+	RefreshHash  string     `gorm:"type:char(64);not null" json:"-"`
+	PrevHash     string     `gorm:"type:char(64);not null;default:''" json:"-"`
+	RotatedAt    *time.Time `json:"-"`
+	UserAgent    string     `gorm:"type:varchar(300);not null;default:''" json:"user_agent"`
+	IP           string     `gorm:"column:ip;type:varchar(64);not null;default:''" json:"ip"`
+	CreatedAt    time.Time  `json:"created_at"`
+	LastUsedAt   time.Time  `json:"last_used_at"`
+	ExpiresAt    time.Time  `json:"expires_at"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty"`
+	RevokeReason string     `gorm:"type:varchar(20);not null;default:''" json:"revoke_reason,omitempty"` // logout / logout_all / revoked / reuse
+}
+
+func (UserSession) TableName() string {
+	return "user_sessions"
+}
@@ -0,0 +1,506 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"oh-my-stock/config"
+)
+
+// ============================================================
+// 外发渠道：规则命中后把通知推出去。
+//
+//   webhook   POST JSON，带 HMAC-SHA256 签名头（见 webhookSignature）
+//   email     走 config.notify.smtp 的发信服务器
+//   wecom     企业微信群机器人（markdown）
+//   dingtalk  钉钉群机器人（markdown，配了加签密钥时带 timestamp + sign）
+//   feishu    飞书群机器人（text，配了签名校验时带 timestamp + sign）
+//
+// webhook / 机器人地址默认不允许指向内网、回环地址（连接时按解析出的 IP 检查，
+// 防止借渠道探测内网），本地联调时打开 notify.allow_private_hosts。
+// ============================================================
+
+// 渠道类型
+const (
+	ChannelWebhook  = "webhook"
+	ChannelEmail    = "email"
+	ChannelWeCom    = "wecom"
+	ChannelDingTalk = "dingtalk"
+	ChannelFeishu   = "feishu"
+)
+
+// ChannelTypes 支持的渠道类型。
+var ChannelTypes = []string{ChannelWebhook, ChannelEmail, ChannelWeCom, ChannelDingTalk, ChannelFeishu}
+
+// ChannelConfig 渠道配置（存 notification_channels.config）。
+// webhook / 机器人用 url + secret，email 用 to。
+type ChannelConfig struct {
+	URL    string   `json:"url,omitempty"`
+	Secret string   `json:"secret,omitempty"`
+	To     []string `json:"to,omitempty"`
+}
+
+// Message 一条要外发的消息。
+type Message struct {
+	Event          string      `json:"event"` // rule.matched / test
+	Title          string      `json:"title"`
+	Text           string      `json:"text"`
+	NotificationID uint        `json:"notification_id,omitempty"`
+	Data           interface{} `json:"data,omitempty"`
+	HTML           string      `json:"-"` // 可选的 HTML 正文，只有邮件用（和 Text 一起发 multipart/alternative）
+}
+
+// 事件名，webhook 的 X-OhMyStock-Event 头
+const (
+	EventRuleMatched    = "rule.matched"
+	EventAlertTriggered = "alert.triggered" // 价格提醒触发（见 alerts 包）
+	EventDigest         = "digest"          // 收盘日报（见 digest 包）
+	EventTest           = "test"
+)
+
+// maxResponseBody 读回的响应体上限，只用于判断机器人的 errcode 和记错误。
+const maxResponseBody = 4 << 10
+
+// PermanentError 重试也不会成功的失败（地址不合法、4xx 等），投递直接标记失败。
+type PermanentError struct{ Err error }
+
+func (e *PermanentError) Error() string { return e.Err.Error() }
+func (e *PermanentError) Unwrap() error { return e.Err }
+
+func permanent(err error) error { return &PermanentError{Err: err} }
+
+// IsPermanent err 是否不值得重试。
+func IsPermanent(err error) bool {
+	var pe *PermanentError
+	return errors.As(err, &pe)
+}
+
+var (
+	settingsMu sync.RWMutex
+	settings   = withDefaults(config.NotifyConfig{})
+	httpClient = newHTTPClient(settings)
+)
+
+func withDefaults(c config.NotifyConfig) config.NotifyConfig {
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = 5
+	}
+	if c.TimeoutSec <= 0 {
+		c.TimeoutSec = 10
+	}
+	if c.SMTP.TLS == "" {
+		c.SMTP.TLS = "starttls"
+	}
+	if c.SMTP.Port == "" {
+		c.SMTP.Port = map[string]string{"tls": "465", "none": "25"}[c.SMTP.TLS]
+		if c.SMTP.Port == "" {
+			c.SMTP.Port = "587"
+		}
+	}
+	return c
+}
+
+// Configure 设置外发渠道（在 jobs.Start 之前调用）。
+func Configure(c config.NotifyConfig) {
+	c = withDefaults(c)
+	settingsMu.Lock()
+	settings = c
+	httpClient = newHTTPClient(c)
+	settingsMu.Unlock()
+}
+
+func current() (config.NotifyConfig, *http.Client) {
+	settingsMu.RLock()
+	defer settingsMu.RUnlock()
+	return settings, httpClient
+}
+
+// newHTTPClient 发 webhook 的客户端：按配置超时；不允许内网时在建连前检查解析出的 IP，
+// 重定向到内网同样会被拦下。
+func newHTTPClient(c config.NotifyConfig) *http.Client {
+	dialer := &net.Dialer{Timeout: time.Duration(c.TimeoutSec) * time.Second}
+	if !c.AllowPrivateHosts {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || privateIP(ip) {
+				return permanent(fmt.Errorf("不允许连接内网地址 %s", host))
+			}
+			return nil
+		}
+	}
+	return &http.Client{
+		Timeout: time.Duration(c.TimeoutSec) * time.Second,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 5 * time.Second,
+			MaxIdleConnsPerHost: 2,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 3 {
+				return errors.New("重定向次数过多")
+			}
+			return nil
+		},
+	}
+}
+
+func privateIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast()
+}
+
+// ParseChannelConfig 解析并校验渠道配置。
+func ParseChannelConfig(typ string, raw []byte) (ChannelConfig, error) {
+	var cfg ChannelConfig
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &cfg); err != nil {
+			return cfg, fmt.Errorf("渠道配置格式错误: %w", err)
+		}
+	}
+	return cfg, ValidateChannel(typ, cfg)
+}
+
+// ValidateChannel 检查渠道类型和必填配置。
+func ValidateChannel(typ string, cfg ChannelConfig) error {
+	switch typ {
+	case ChannelWebhook, ChannelWeCom, ChannelDingTalk, ChannelFeishu:
+		u, err := url.Parse(cfg.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("url 必须是 http(s) 地址")
+		}
+	case ChannelEmail:
+		if len(cfg.To) == 0 {
+			return errors.New("to 至少一个收件地址")
+		}
+		for _, addr := range cfg.To {
+			if strings.ContainsAny(addr, "\r\n") {
+				return fmt.Errorf("收件地址 %q 不合法", addr)
+			}
+			if _, err := mail.ParseAddress(addr); err != nil {
+				return fmt.Errorf("收件地址 %q 不合法", addr)
+			}
+		}
+	default:
+		return fmt.Errorf("不支持的渠道类型 %q（可选 %s）", typ, strings.Join(ChannelTypes, " / "))
+	}
+	return nil
+}
+
+// NewSecret 随机生成 webhook 签名密钥。
+func NewSecret() string {
+	b := make([]byte, 24)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Send 往一个渠道发一条消息。返回对方的 HTTP 状态码（邮件为 SMTP 最终状态，成功记 250）。
+// 返回 PermanentError 时不必重试。
+func Send(ctx context.Context, typ string, cfg ChannelConfig, msg Message) (int, error) {
+	if err := ValidateChannel(typ, cfg); err != nil {
+		return 0, permanent(err)
+	}
+	switch typ {
+	case ChannelWebhook:
+		return sendWebhook(ctx, cfg, msg)
+	case ChannelEmail:
+		return sendEmail(ctx, cfg, msg)
+	case ChannelWeCom:
+		return sendWeCom(ctx, cfg, msg)
+	case ChannelDingTalk:
+		return sendDingTalk(ctx, cfg, msg)
+	default:
+		return sendFeishu(ctx, cfg, msg)
+	}
+}
+
+// ------------------------------------------------------------
+// webhook
+// ------------------------------------------------------------
+
+// webhookSignature X-OhMyStock-Signature 的值：sha256=hex(HMAC-SHA256(secret, "<timestamp>.<body>"))。
+// 接收方用同样的方式计算后常量时间比较，并拒绝时间戳偏差过大的请求防重放。
+func webhookSignature(secret, ts string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func sendWebhook(ctx context.Context, cfg ChannelConfig, msg Message) (int, error) {
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	body, err := json.Marshal(struct {
+		Message
+		Timestamp string `json:"timestamp"`
+	}{msg, ts})
+	if err != nil {
+		return 0, permanent(err)
+	}
+	header := http.Header{}
+	header.Set("X-OhMyStock-Event", msg.Event)
+	header.Set("X-OhMyStock-Timestamp", ts)
+	if cfg.Secret != "" {
+		header.Set("X-OhMyStock-Signature", webhookSignature(cfg.Secret, ts, body))
+	}
+	code, _, err := postJSON(ctx, cfg.URL, header, body)
+	return code, err
+}
+
+// ------------------------------------------------------------
+// 群机器人
+// ------------------------------------------------------------
+
+// robotResult 企业微信 / 钉钉返回 errcode，飞书返回 code（旧版本是 StatusCode），0 为成功。
+type robotResult struct {
+	ErrCode    *int   `json:"errcode"`
+	ErrMsg     string `json:"errmsg"`
+	Code       *int   `json:"code"`
+	Msg        string `json:"msg"`
+	StatusCode *int   `json:"StatusCode"`
+}
+
+func (r robotResult) err() error {
+	for _, c := range []*int{r.ErrCode, r.Code, r.StatusCode} {
+		if c != nil && *c != 0 {
+			return fmt.Errorf("机器人返回错误 %d: %s%s", *c, r.ErrMsg, r.Msg)
+		}
+	}
+	return nil
+}
+
+func postRobot(ctx context.Context, u string, payload interface{}) (int, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return 0, permanent(err)
+	}
+	code, resp, err := postJSON(ctx, u, nil, body)
+	if err != nil {
+		return code, err
+	}
+	var r robotResult
+	if json.Unmarshal(resp, &r) == nil {
+		if err := r.err(); err != nil {
+			return code, err
+		}
+	}
+	return code, nil
+}
+
+func markdown(msg Message) string {
+	return "**" + msg.Title + "**\n\n" + msg.Text
+}
+
+func sendWeCom(ctx context.Context, cfg ChannelConfig, msg Message) (int, error) {
+	return postRobot(ctx, cfg.URL, map[string]interface{}{
+		"msgtype":  "markdown",
+		"markdown": map[string]string{"content": markdown(msg)},
+	})
+}
+
+// dingTalkSign 钉钉加签：base64(HMAC-SHA256(secret, "<毫秒时间戳>\n<secret>"))。
+func dingTalkSign(secret, ts string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts + "\n" + secret))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func sendDingTalk(ctx context.Context, cfg ChannelConfig, msg Message) (int, error) {
+	u := cfg.URL
+	if cfg.Secret != "" {
+		ts := strconv.FormatInt(time.Now().UnixMilli(), 10)
+		sep := "?"
+		if strings.Contains(u, "?") {
+			sep = "&"
+		}
+		u += sep + "timestamp=" + ts + "&sign=" + url.QueryEscape(dingTalkSign(cfg.Secret, ts))
+	}
+	return postRobot(ctx, u, map[string]interface{}{
+		"msgtype":  "markdown",
+		"markdown": map[string]string{"title": msg.Title, "text": markdown(msg)},
+	})
+}
+
+// feishuSign 飞书签名校验：以 "<秒级时间戳>\n<secret>" 为密钥对空串做 HMAC-SHA256，再 base64。
+func feishuSign(secret, ts string) string {
+	mac := hmac.New(sha256.New, []byte(ts+"\n"+secret))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func sendFeishu(ctx context.Context, cfg ChannelConfig, msg Message) (int, error) {
+	payload := map[string]interface{}{
+		"msg_type": "text",
+		"content":  map[string]string{"text": msg.Title + "\n" + msg.Text},
+	}
+	if cfg.Secret != "" {
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		payload["timestamp"] = ts
+		payload["sign"] = feishuSign(cfg.Secret, ts)
+	}
+	return postRobot(ctx, cfg.URL, payload)
+}
+
+// postJSON 发 JSON，返回状态码和（截断的）响应体。
+// 2xx 成功；408 / 429 / 5xx 和网络错误可重试；其余 4xx 视为永久失败。
+func postJSON(ctx context.Context, u string, header http.Header, body []byte) (int, []byte, error) {
+	_, client := current()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, permanent(err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("User-Agent", "oh-my-stock-notify/1.0")
+	resp, err := client.Do(req)
+	if err != nil {
+		if IsPermanent(err) {
+			return 0, nil, err
+		}
+		return 0, nil, fmt.Errorf("请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return resp.StatusCode, data, nil
+	case resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return resp.StatusCode, data, fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	default:
+		return resp.StatusCode, data, permanent(fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(data))))
+	}
+}
+
+// ------------------------------------------------------------
+// 邮件
+// ------------------------------------------------------------
+
+// buildEmail 拼邮件正文：UTF-8，主题按 RFC 2047 编码，正文 base64。
+// 带 HTML 时发 multipart/alternative（纯文本在前，客户端优先显示 HTML）。
+func buildEmail(from string, to []string, subject, text, html string, now time.Time) []byte {
+	var b strings.Builder
+	b.WriteString("From: " + from + "\r\n")
+	b.WriteString("To: " + strings.Join(to, ", ") + "\r\n")
+	b.WriteString("Subject: " + mime.BEncoding.Encode("UTF-8", subject) + "\r\n")
+	b.WriteString("Date: " + now.Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	if html == "" {
+		writeBase64Part(&b, "text/plain", text)
+		return []byte(b.String())
+	}
+	boundary := "=_oh-my-stock_" + strconv.FormatInt(now.UnixNano(), 36)
+	b.WriteString("Content-Type: multipart/alternative; boundary=\"" + boundary + "\"\r\n\r\n")
+	b.WriteString("--" + boundary + "\r\n")
+	writeBase64Part(&b, "text/plain", text)
+	b.WriteString("--" + boundary + "\r\n")
+	writeBase64Part(&b, "text/html", html)
+	b.WriteString("--" + boundary + "--\r\n")
+	return []byte(b.String())
+}
+
+// writeBase64Part 写一段 UTF-8 正文的头和按 76 列折行的 base64 内容。
+func writeBase64Part(b *strings.Builder, contentType, body string) {
+	b.WriteString("Content-Type: " + contentType + "; charset=UTF-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+	enc := base64.StdEncoding.EncodeToString([]byte(body))
+	for len(enc) > 76 {
+		b.WriteString(enc[:76] + "\r\n")
+		enc = enc[76:]
+	}
+	b.WriteString(enc + "\r\n")
+}
+
+func sendEmail(ctx context.Context, cfg ChannelConfig, msg Message) (int, error) {
+	s, _ := current()
+	sc := s.SMTP
+	if sc.Host == "" || sc.From == "" {
+		return 0, permanent(errors.New("未配置发信服务器（notify.smtp）"))
+	}
+	from, err := mail.ParseAddress(sc.From)
+	if err != nil {
+		return 0, permanent(fmt.Errorf("notify.smtp.from 不合法: %w", err))
+	}
+	addr := net.JoinHostPort(sc.Host, sc.Port)
+	timeout := time.Duration(s.TimeoutSec) * time.Second
+	dialer := &net.Dialer{Timeout: timeout}
+
+	var conn net.Conn
+	if sc.TLS == "tls" {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: sc.Host}}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("连接发信服务器: %w", err)
+	}
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+
+	c, err := smtp.NewClient(conn, sc.Host)
+	if err != nil {
+		conn.Close()
+		return 0, fmt.Errorf("SMTP 握手: %w", err)
+	}
+	defer c.Close()
+	if sc.TLS == "starttls" {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return 0, permanent(errors.New("发信服务器不支持 STARTTLS（本地联调可设 tls: none）"))
+		}
+		if err := c.StartTLS(&tls.Config{ServerName: sc.Host}); err != nil {
+			return 0, fmt.Errorf("STARTTLS: %w", err)
+		}
+	}
+	if sc.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", sc.Username, sc.Password, sc.Host)); err != nil {
+			return 0, permanent(fmt.Errorf("SMTP 认证: %w", err))
+		}
+	}
+	if err := c.Mail(from.Address); err != nil {
+		return 0, fmt.Errorf("MAIL FROM: %w", err)
+	}
+	for _, to := range cfg.To {
+		a, _ := mail.ParseAddress(to)
+		if err := c.Rcpt(a.Address); err != nil {
+			return 0, fmt.Errorf("RCPT TO %s: %w", a.Address, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return 0, fmt.Errorf("DATA: %w", err)
+	}
+	if _, err := w.Write(buildEmail(sc.From, cfg.To, msg.Title, msg.Text, msg.HTML, time.Now())); err != nil {
+		return 0, fmt.Errorf("写入邮件: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return 0, fmt.Errorf("发送邮件: %w", err)
+	}
+	c.Quit()
+	return 250, nil
+}
@@ -0,0 +1,380 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"oh-my-stock/config"
+	"oh-my-stock/models"
+)
+
+// useNotifyConfig 测试期间替换外发配置，结束后恢复。
+func useNotifyConfig(t *testing.T, c config.NotifyConfig) {
+	t.Helper()
+	old, _ := current()
+	Configure(c)
+	t.Cleanup(func() { Configure(old) })
+}
+
+// captured 本地 HTTP 替身收到的一次请求。
+type captured struct {
+	header http.Header
+	query  map[string]string
+	body   []byte
+}
+
+// standIn 本地 HTTP 替身：记录请求，按 status / reply 应答。
+func standIn(t *testing.T, status int, reply string) (*httptest.Server, chan captured) {
+	t.Helper()
+	got := make(chan captured, 4)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		q := map[string]string{}
+		for k := range r.URL.Query() {
+			q[k] = r.URL.Query().Get(k)
+		}
+		got <- captured{header: r.Header.Clone(), query: q, body: body}
+		w.WriteHeader(status)
+		io.WriteString(w, reply)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, got
+}
+
+var testMsg = Message{Event: EventRuleMatched, Title: "规则「放量」命中 600000 浦发银行", Text: "2024-06-07 收盘 10.50，涨跌幅 5.20%", NotificationID: 7}
+
+func TestWebhook_Signed(t *testing.T) {
+	useNotifyConfig(t, config.NotifyConfig{AllowPrivateHosts: true})
+	srv, got := standIn(t, http.StatusOK, "ok")
+
+	code, err := Send(context.Background(), ChannelWebhook, ChannelConfig{URL: srv.URL, Secret: "s3cret"}, testMsg)
+	if err != nil || code != http.StatusOK {
+		t.Fatalf("send: code=%d err=%v", code, err)
+	}
+	req := <-got
+	ts := req.header.Get("X-OhMyStock-Timestamp")
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write([]byte(ts + "." + string(req.body)))
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); req.header.Get("X-OhMyStock-Signature") != want {
+		t.Fatalf("签名不对: %s", req.header.Get("X-OhMyStock-Signature"))
+	}
+	if req.header.Get("X-OhMyStock-Event") != EventRuleMatched {
+		t.Fatalf("event = %s", req.header.Get("X-OhMyStock-Event"))
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal(req.body, &payload); err != nil || payload["title"] != testMsg.Title || payload["timestamp"] != ts {
+		t.Fatalf("payload = %s", req.body)
+	}
+}
+
+func TestWebhook_StatusClassification(t *testing.T) {
+	useNotifyConfig(t, config.NotifyConfig{AllowPrivateHosts: true})
+	for _, c := range []struct {
+		status    int
+		permanent bool
+	}{
+		{http.StatusInternalServerError, false},
+		{http.StatusTooManyRequests, false},
+		{http.StatusRequestTimeout, false},
+		{http.StatusBadRequest, true},
+		{http.StatusNotFound, true},
+	} {
+		srv, _ := standIn(t, c.status, "nope")
+		code, err := Send(context.Background(), ChannelWebhook, ChannelConfig{URL: srv.URL}, testMsg)
+		if err == nil || code != c.status || IsPermanent(err) != c.permanent {
+			t.Fatalf("HTTP %d: code=%d err=%v permanent=%v", c.status, code, err, IsPermanent(err))
+		}
+	}
+}
+
+func TestWebhook_PrivateHostBlocked(t *testing.T) {
+	useNotifyConfig(t, config.NotifyConfig{})
+	srv, got := standIn(t, http.StatusOK, "ok")
+	_, err := Send(context.Background(), ChannelWebhook, ChannelConfig{URL: srv.URL}, testMsg)
+	if err == nil || !IsPermanent(err) {
+		t.Fatalf("回环地址应被拒绝且不重试: %v", err)
+	}
+	select {
+	case <-got:
+		t.Fatal("请求不应到达")
+	default:
+	}
+}
+
+func TestRobots(t *testing.T) {
+	useNotifyConfig(t, config.NotifyConfig{AllowPrivateHosts: true})
+
+	t.Run("wecom", func(t *testing.T) {
+		srv, got := standIn(t, http.StatusOK, `{"errcode":0,"errmsg":"ok"}`)
+		if _, err := Send(context.Background(), ChannelWeCom, ChannelConfig{URL: srv.URL + "/cgi-bin/webhook/send?key=k"}, testMsg); err != nil {
+			t.Fatal(err)
+		}
+		var p struct {
+			MsgType  string `json:"msgtype"`
+			Markdown struct{ Content string }
+		}
+		json.Unmarshal((<-got).body, &p)
+		if p.MsgType != "markdown" || !strings.Contains(p.Markdown.Content, testMsg.Title) {
+			t.Fatalf("payload = %+v", p)
+		}
+	})
+
+	t.Run("dingtalk signed", func(t *testing.T) {
+		srv, got := standIn(t, http.StatusOK, `{"errcode":0,"errmsg":"ok"}`)
+		if _, err := Send(context.Background(), ChannelDingTalk, ChannelConfig{URL: srv.URL + "/robot/send?access_token=tok", Secret: "SECabc"}, testMsg); err != nil {
+			t.Fatal(err)
+		}
+		req := <-got
+		ts := req.query["timestamp"]
+		mac := hmac.New(sha256.New, []byte("SECabc"))
+		mac.Write([]byte(ts + "\n" + "SECabc"))
+		if req.query["access_token"] != "tok" || req.query["sign"] != base64.StdEncoding.EncodeToString(mac.Sum(nil)) {
+			t.Fatalf("query = %v", req.query)
+		}
+		var p struct {
+			MsgType  string `json:"msgtype"`
+			Markdown struct{ Title, Text string }
+		}
+		json.Unmarshal(req.body, &p)
+		if p.MsgType != "markdown" || p.Markdown.Title != testMsg.Title {
+			t.Fatalf("payload = %+v", p)
+		}
+	})
+
+	t.Run("feishu signed", func(t *testing.T) {
+		srv, got := standIn(t, http.StatusOK, `{"code":0,"msg":"success"}`)
+		if _, err := Send(context.Background(), ChannelFeishu, ChannelConfig{URL: srv.URL + "/open-apis/bot/v2/hook/x", Secret: "fs"}, testMsg); err != nil {
+			t.Fatal(err)
+		}
+		var p struct {
+			Timestamp string `json:"timestamp"`
+			Sign      string `json:"sign"`
+			MsgType   string `json:"msg_type"`
+			Content   struct{ Text string }
+		}
+		json.Unmarshal((<-got).body, &p)
+		mac := hmac.New(sha256.New, []byte(p.Timestamp+"\n"+"fs"))
+		if p.MsgType != "text" || p.Sign != base64.StdEncoding.EncodeToString(mac.Sum(nil)) || !strings.Contains(p.Content.Text, testMsg.Text) {
+			t.Fatalf("payload = %+v", p)
+		}
+	})
+
+	t.Run("errcode", func(t *testing.T) {
+		srv, _ := standIn(t, http.StatusOK, `{"errcode":310000,"errmsg":"sign not match"}`)
+		_, err := Send(context.Background(), ChannelDingTalk, ChannelConfig{URL: srv.URL}, testMsg)
+		if err == nil || !strings.Contains(err.Error(), "310000") {
+			t.Fatalf("errcode 非 0 应算失败: %v", err)
+		}
+	})
+}
+
+// fakeSMTP 本地 SMTP 替身，只接一封信。
+type fakeSMTP struct {
+	addr  *net.TCPAddr
+	auth  chan string
+	rcpts chan []string
+	data  chan string
+}
+
+func startFakeSMTP(t *testing.T) *fakeSMTP {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	f := &fakeSMTP{addr: ln.Addr().(*net.TCPAddr), auth: make(chan string, 1), rcpts: make(chan []string, 1), data: make(chan string, 1)}
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		tp := textproto.NewConn(conn)
+		tp.PrintfLine("220 fake ESMTP")
+		var rcpts []string
+		for {
+			line, err := tp.ReadLine()
+			if err != nil {
+				return
+			}
+			cmd := strings.ToUpper(strings.Fields(line + " ")[0])
+			switch cmd {
+			case "EHLO", "HELO":
+				tp.PrintfLine("250-fake")
+				tp.PrintfLine("250 AUTH PLAIN")
+			case "AUTH":
+				f.auth <- line
+				tp.PrintfLine("235 ok")
+			case "MAIL":
+				tp.PrintfLine("250 ok")
+			case "RCPT":
+				rcpts = append(rcpts, line)
+				tp.PrintfLine("250 ok")
+			case "DATA":
+				tp.PrintfLine("354 go ahead")
+				b, _ := tp.ReadDotBytes()
+				f.rcpts <- rcpts
+				f.data <- string(b)
+				tp.PrintfLine("250 queued")
+			case "QUIT":
+				tp.PrintfLine("221 bye")
+				return
+			default:
+				tp.PrintfLine("250 ok")
+			}
+		}
+	}()
+	return f
+}
+
+func TestEmail(t *testing.T) {
+	f := startFakeSMTP(t)
+	useNotifyConfig(t, config.NotifyConfig{SMTP: config.SMTPConfig{
+		Host: "127.0.0.1", Port: strconv.Itoa(f.addr.Port), Username: "bot", Password: "pw",
+		From: "oh-my-stock <bot@example.com>", TLS: "none",
+	}})
+
+	code, err := Send(context.Background(), ChannelEmail, ChannelConfig{To: []string{"张三 <a@example.com>", "b@example.com"}}, testMsg)
+	if err != nil || code != 250 {
+		t.Fatalf("send: code=%d err=%v", code, err)
+	}
+	if auth := <-f.auth; !strings.HasPrefix(auth, "AUTH PLAIN ") {
+		t.Fatalf("auth = %s", auth)
+	}
+	rcpts := <-f.rcpts
+	if len(rcpts) != 2 || !strings.Contains(rcpts[0], "<a@example.com>") {
+		t.Fatalf("rcpts = %v", rcpts)
+	}
+	data := <-f.data
+	head, body, _ := strings.Cut(data, "\n\n")
+	var subject string
+	for _, l := range strings.Split(head, "\n") {
+		if strings.HasPrefix(l, "Subject: ") {
+			subject, _ = new(mime.WordDecoder).DecodeHeader(strings.TrimPrefix(l, "Subject: "))
+		}
+	}
+	if subject != testMsg.Title {
+		t.Fatalf("subject = %q", subject)
+	}
+	text, _ := base64.StdEncoding.DecodeString(strings.ReplaceAll(body, "\n", ""))
+	if string(text) != testMsg.Text {
+		t.Fatalf("body = %q", text)
+	}
+}
+
+func TestEmail_NotConfigured(t *testing.T) {
+	useNotifyConfig(t, config.NotifyConfig{})
+	_, err := Send(context.Background(), ChannelEmail, ChannelConfig{To: []string{"a@example.com"}}, testMsg)
+	if err == nil || !IsPermanent(err) {
+		t.Fatalf("未配置 SMTP 应永久失败: %v", err)
+	}
+}
+
+func TestValidateChannel(t *testing.T) {
+	bad := []struct {
+		typ string
+		cfg ChannelConfig
+	}{
+		{"sms", ChannelConfig{URL: "https://x"}},
+		{ChannelWebhook, ChannelConfig{}},
+		{ChannelWeCom, ChannelConfig{URL: "ftp://x/y"}},
+		{ChannelEmail, ChannelConfig{}},
+		{ChannelEmail, ChannelConfig{To: []string{"a@example.com\r\nBcc: x@example.com"}}},
+		{ChannelEmail, ChannelConfig{To: []string{"not-an-address"}}},
+	}
+	for _, c := range bad {
+		if ValidateChannel(c.typ, c.cfg) == nil {
+			t.Fatalf("%s %+v 应校验失败", c.typ, c.cfg)
+		}
+	}
+	if err := ValidateChannel(ChannelFeishu, ChannelConfig{URL: "https://open.feishu.cn/open-apis/bot/v2/hook/x"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRecordAttempt(t *testing.T) {
+	now := time.Date(2024, 6, 7, 15, 0, 0, 0, time.UTC)
+	d := models.NotificationDelivery{}
+	if s := recordAttempt(&d, 500, errors.New("boom"), 3, now); s != models.DeliveryPending || !d.NextAttemptAt.Equal(now.Add(retryDelays[0])) {
+		t.Fatalf("第 1 次失败应排重试: %s %v", s, d.NextAttemptAt)
+	}
+	if s := recordAttempt(&d, 500, errors.New("boom"), 3, now); s != models.DeliveryPending || !d.NextAttemptAt.Equal(now.Add(retryDelays[1])) {
+		t.Fatalf("第 2 次失败应退避更久: %s %v", s, d.NextAttemptAt)
+	}
+	if s := recordAttempt(&d, 500, errors.New("boom"), 3, now); s != models.DeliveryFailed || d.Attempts != 3 {
+		t.Fatalf("达到最大次数应失败: %s %d", s, d.Attempts)
+	}
+
+	d = models.NotificationDelivery{}
+	if s := recordAttempt(&d, 404, permanent(errors.New("gone")), 5, now); s != models.DeliveryFailed {
+		t.Fatalf("永久失败不重试: %s", s)
+	}
+	d = models.NotificationDelivery{LastError: "old"}
+	if s := recordAttempt(&d, 200, nil, 5, now); s != models.DeliverySent || d.SentAt == nil || d.LastError != "" {
+		t.Fatalf("成功: %+v", d)
+	}
+	if retryDelay(100) != retryDelays[len(retryDelays)-1] {
+		t.Fatal("超出的次数取最后一档")
+	}
+}
+
+func TestMessageFor(t *testing.T) {
+	rid, aid := uint(3), uint(9)
+	n := models.Notification{ID: 1, RuleID: &rid, RuleName: "放量", Symbol: "600000", TradeDate: time.Date(2024, 6, 7, 0, 0, 0, 0, time.UTC)}
+	if m := messageFor(n); m.Event != EventRuleMatched || m.Data.(map[string]interface{})["rule_name"] != "放量" {
+		t.Fatalf("规则通知: %+v", m)
+	}
+	n.RuleID, n.RuleName, n.AlertID = nil, "", &aid
+	m := messageFor(n)
+	data := m.Data.(map[string]interface{})
+	if m.Event != EventAlertTriggered || data["alert_id"] != aid || data["rule_id"] != nil {
+		t.Fatalf("提醒通知: %+v", m)
+	}
+}
+
+func TestBuildEmail_HTML(t *testing.T) {
+	raw := buildEmail("bot@example.com", []string{"a@example.com"}, "日报", "纯文本", "<h1>日报</h1>", time.Unix(1717740000, 0))
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mt, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mt != "multipart/alternative" {
+		t.Fatalf("content-type = %q", msg.Header.Get("Content-Type"))
+	}
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	var got []string
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(base64.NewDecoder(base64.StdEncoding, p))
+		got = append(got, strings.Split(p.Header.Get("Content-Type"), ";")[0]+":"+string(b))
+	}
+	if len(got) != 2 || got[0] != "text/plain:纯文本" || got[1] != "text/html:<h1>日报</h1>" {
+		t.Fatalf("parts = %q", got)
+	}
+}
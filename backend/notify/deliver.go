@@ -0,0 +1,246 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"oh-my-stock/models"
+)
+
+// ============================================================
+// 投递：notification_deliveries 既是投递日志也是重试队列。
+// 规则命中写通知时按 rule_channels 给每个启用的渠道排一条 pending（见 matchAndWrite），
+// Dispatch 取到期的 pending 逐条发送：成功记 sent；可重试的失败按 retryDelays 退避，
+// 达到 notify.max_attempts 或遇到永久失败（地址非法、4xx……）记 failed。
+// 多副本 / 多任务同时 Dispatch 时靠 FOR UPDATE SKIP LOCKED + 租约时间互不重复发送。
+// ============================================================
+
+// retryDelays 第 n 次失败后等多久再试，超出取最后一个。
+var retryDelays = []time.Duration{5 * time.Minute, 15 * time.Minute, time.Hour, 3 * time.Hour}
+
+// dispatchBatch 每轮最多取多少条；dispatchConcurrency 同时发送的条数。
+const (
+	dispatchBatch       = 200
+	dispatchConcurrency = 8
+)
+
+// dispatchLease 取出后先把 next_attempt_at 推后这么久，发送途中进程挂掉的投递过了租约会被重新取到。
+const dispatchLease = 10 * time.Minute
+
+func retryDelay(attempts int) time.Duration {
+	if attempts <= 0 {
+		attempts = 1
+	}
+	if attempts > len(retryDelays) {
+		return retryDelays[len(retryDelays)-1]
+	}
+	return retryDelays[attempts-1]
+}
+
+// DispatchResult 一轮投递的结果。
+type DispatchResult struct {
+	Sent    int // 成功
+	Retried int // 失败但还会重试
+	Failed  int // 最终失败
+}
+
+// messageFor 通知 → 外发消息：价格提醒触发的是 alert.triggered，其余是规则命中。
+func messageFor(n models.Notification) Message {
+	data := map[string]interface{}{
+		"symbol":     n.Symbol,
+		"stock_name": n.StockName,
+		"trade_date": n.TradeDate.Format("2006-01-02"),
+	}
+	event := EventRuleMatched
+	if n.AlertID != nil {
+		event = EventAlertTriggered
+		data["alert_id"] = *n.AlertID
+	} else {
+		data["rule_id"] = n.RuleID
+		data["rule_name"] = n.RuleName
+	}
+	if len(n.Symbols) > 0 {
+		data["symbols"] = n.Symbols // 合并通知包含的全部股票
+	}
+	return Message{Event: event, Title: n.Title, Text: n.Message, NotificationID: n.ID, Data: data}
+}
+
+// Dispatch 发送所有到期的 pending 投递，直到取不到为止。
+func Dispatch(ctx context.Context, db *gorm.DB) (DispatchResult, error) {
+	var total DispatchResult
+	for {
+		res, n, err := dispatchBatchOnce(ctx, db)
+		total.Sent += res.Sent
+		total.Retried += res.Retried
+		total.Failed += res.Failed
+		if err != nil || n < dispatchBatch {
+			return total, err
+		}
+		if ctx.Err() != nil {
+			return total, ctx.Err()
+		}
+	}
+}
+
+func dispatchBatchOnce(ctx context.Context, db *gorm.DB) (DispatchResult, int, error) {
+	var rows []models.NotificationDelivery
+	err := db.WithContext(ctx).Raw(`UPDATE notification_deliveries SET next_attempt_at = ?, updated_at = NOW()
+		WHERE id IN (
+			SELECT id FROM notification_deliveries
+			WHERE status = ? AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at, id
+			LIMIT ?
+			FOR UPDATE SKIP LOCKED)
+		RETURNING *`, time.Now().Add(dispatchLease), models.DeliveryPending, dispatchBatch).Scan(&rows).Error
+	if err != nil {
+		return DispatchResult{}, 0, fmt.Errorf("读取待投递: %w", err)
+	}
+	if len(rows) == 0 {
+		return DispatchResult{}, 0, nil
+	}
+
+	channels, notes, err := loadForDelivery(db.WithContext(ctx), rows)
+	if err != nil {
+		return DispatchResult{}, len(rows), err
+	}
+	s, _ := current()
+
+	var (
+		res  DispatchResult
+		mu   sync.Mutex
+		errs []error
+		wg   sync.WaitGroup
+		sem  = make(chan struct{}, dispatchConcurrency)
+	)
+	for i := range rows {
+		d := &rows[i]
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			ch, ok := channels[d.ChannelID]
+			var (
+				code    int
+				sendErr error
+			)
+			switch {
+			case !ok:
+				sendErr = permanent(errors.New("渠道已删除"))
+			case !ch.Enabled:
+				sendErr = permanent(errors.New("渠道已停用"))
+			case d.NotificationID == nil || notes[*d.NotificationID].ID == 0:
+				sendErr = permanent(errors.New("通知已删除"))
+			default:
+				code, sendErr = sendChannel(ctx, ch, messageFor(notes[*d.NotificationID]))
+			}
+			status := recordAttempt(d, code, sendErr, s.MaxAttempts, time.Now())
+			if err := db.Model(&models.NotificationDelivery{}).Where("id = ?", d.ID).Updates(map[string]interface{}{
+				"status":          d.Status,
+				"attempts":        d.Attempts,
+				"last_error":      d.LastError,
+				"response_code":   d.ResponseCode,
+				"next_attempt_at": d.NextAttemptAt,
+				"sent_at":         d.SentAt,
+				"updated_at":      time.Now(),
+			}).Error; err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("更新投递 %d: %w", d.ID, err))
+				mu.Unlock()
+				return
+			}
+			mu.Lock()
+			switch status {
+			case models.DeliverySent:
+				res.Sent++
+			case models.DeliveryFailed:
+				res.Failed++
+				log.Printf("⚠️ 通知投递 %d（渠道 %d）最终失败: %s", d.ID, d.ChannelID, d.LastError)
+			default:
+				res.Retried++
+			}
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return res, len(rows), errors.Join(errs...)
+}
+
+// loadForDelivery 一批投递涉及的渠道和通知。
+func loadForDelivery(db *gorm.DB, rows []models.NotificationDelivery) (map[uint]models.NotificationChannel, map[uint]models.Notification, error) {
+	var chIDs, noteIDs []uint
+	for _, d := range rows {
+		chIDs = append(chIDs, d.ChannelID)
+		if d.NotificationID != nil {
+			noteIDs = append(noteIDs, *d.NotificationID)
+		}
+	}
+	var chs []models.NotificationChannel
+	if err := db.Where("id IN ?", chIDs).Find(&chs).Error; err != nil {
+		return nil, nil, fmt.Errorf("读取渠道: %w", err)
+	}
+	channels := make(map[uint]models.NotificationChannel, len(chs))
+	for _, c := range chs {
+		channels[c.ID] = c
+	}
+	notes := map[uint]models.Notification{}
+	if len(noteIDs) > 0 {
+		var ns []models.Notification
+		if err := db.Where("id IN ?", noteIDs).Find(&ns).Error; err != nil {
+			return nil, nil, fmt.Errorf("读取通知: %w", err)
+		}
+		for _, n := range ns {
+			notes[n.ID] = n
+		}
+	}
+	return channels, notes, nil
+}
+
+func sendChannel(ctx context.Context, ch models.NotificationChannel, msg Message) (int, error) {
+	cfg, err := ParseChannelConfig(ch.Type, ch.Config)
+	if err != nil {
+		return 0, permanent(err)
+	}
+	return Send(ctx, ch.Type, cfg, msg)
+}
+
+// recordAttempt 把一次发送结果记到投递上，返回新状态。
+func recordAttempt(d *models.NotificationDelivery, code int, err error, maxAttempts int, now time.Time) string {
+	d.Attempts++
+	d.ResponseCode = code
+	switch {
+	case err == nil:
+		d.Status = models.DeliverySent
+		d.LastError = ""
+		d.SentAt = &now
+	case IsPermanent(err) || d.Attempts >= maxAttempts:
+		d.Status = models.DeliveryFailed
+		d.LastError = err.Error()
+	default:
+		d.Status = models.DeliveryPending
+		d.LastError = err.Error()
+		d.NextAttemptAt = now.Add(retryDelay(d.Attempts))
+	}
+	return d.Status
+}
+
+// SendTest 立即往渠道发一条测试消息（不重试），结果记一条 notification_id 为空的投递日志。
+func SendTest(ctx context.Context, db *gorm.DB, ch models.NotificationChannel) (models.NotificationDelivery, error) {
+	now := time.Now()
+	code, sendErr := sendChannel(ctx, ch, Message{
+		Event: EventTest,
+		Title: "oh-my-stock 测试通知",
+		Text:  fmt.Sprintf("渠道「%s」配置正常，发送时间 %s", ch.Name, now.Format("2006-01-02 15:04:05")),
+	})
+	d := models.NotificationDelivery{UserID: ch.UserID, ChannelID: ch.ID, NextAttemptAt: now}
+	recordAttempt(&d, code, sendErr, 1, time.Now())
+	if err := db.Create(&d).Error; err != nil {
+		return d, fmt.Errorf("记录投递: %w", err)
+	}
+	return d, sendErr
+}
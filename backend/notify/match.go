@@ -0,0 +1,131 @@
+package notify
+
+import (
+	"sort"
+	"time"
+)
+
+// Snapshot 一只股票在最新交易日的行情快照（取自 stock_history_mv），规则通知只看这些字段。
+type Snapshot struct {
+	Symbol        string
+	Name          string
+	TradeDate     time.Time
+	Close         float64
+	ChangePercent float64
+	Volume        float64
+	TurnoverRate  float64
+	PETTM         float64
+	PB            float64
+	NetAmount     float64 // 资金流净额（元）
+}
+
+// SnapshotField 规则表达式里可用于通知的字段。其余字段（行业、连续 N 天、公式……）
+// 需要查库或窗口计算，只在「运行规则」里生效；带这些条件的规则不做通知匹配（见 notifiable）。
+var SnapshotField = map[string]func(Snapshot) float64{
+	"close":          func(s Snapshot) float64 { return s.Close },
+	"change_percent": func(s Snapshot) float64 { return s.ChangePercent },
+	"volume":         func(s Snapshot) float64 { return s.Volume },
+	"turnover_rate":  func(s Snapshot) float64 { return s.TurnoverRate },
+	"pe_ttm":         func(s Snapshot) float64 { return s.PETTM },
+	"pe_ratio":       func(s Snapshot) float64 { return s.PETTM }, // 旧前端用的别名
+	"pb":             func(s Snapshot) float64 { return s.PB },
+	"net_amount":     func(s Snapshot) float64 { return s.NetAmount },
+}
+
+// numeric JSON 解出来的数值（float64），以及直接构造表达式时的 int / int64。
+func numeric(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// MatchStock 快照是否满足规则表达式：各字段 AND，每个字段支持 gt / gte / lt / lte。
+// 不认识的字段、比较符和格式不对的条件跳过，不影响其它条件。
+func MatchStock(s Snapshot, expr map[string]interface{}) bool {
+	for field, cond := range expr {
+		get, ok := SnapshotField[field]
+		if !ok {
+			continue
+		}
+		ops, ok := cond.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		v := get(s)
+		for op, raw := range ops {
+			want, ok := numeric(raw)
+			if !ok {
+				continue
+			}
+			switch op {
+			case "gt":
+				if !(v > want) {
+					return false
+				}
+			case "gte":
+				if !(v >= want) {
+					return false
+				}
+			case "lt":
+				if !(v < want) {
+					return false
+				}
+			case "lte":
+				if !(v <= want) {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+// paramKeys 规则表达式里不是条件的参数（放量倍数，配合 consecutive_volume_amplify_days 用）。
+var paramKeys = map[string]bool{"volume_amplify_days": true}
+
+// unsupportedFields 表达式里快照判断不了的条件，按字段名排序：不在 SnapshotField 里的字段，
+// 以及比较符不是 gt / gte / lt / lte 数值比较的条件（eq、between、格式不对……）。
+func unsupportedFields(expr map[string]interface{}) []string {
+	var out []string
+	for field, cond := range expr {
+		if paramKeys[field] {
+			continue
+		}
+		if _, ok := SnapshotField[field]; !ok {
+			out = append(out, field)
+			continue
+		}
+		ops, ok := cond.(map[string]interface{})
+		if !ok || len(ops) == 0 {
+			out = append(out, field)
+			continue
+		}
+		for op, raw := range ops {
+			if _, ok := numeric(raw); !ok || (op != "gt" && op != "gte" && op != "lt" && op != "lte") {
+				out = append(out, field)
+				break
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// notifiable 表达式的每个条件都能在快照上判断，且至少有一个。MatchStock 会跳过不认识的条件，
+// 只判断一部分条件会把规则报成命中（如「银行股 close > 10」命中所有 close > 10 的股票），
+// 所以带快照判断不了的条件的规则不做通知匹配，要看结果请「运行规则」。
+func notifiable(expr map[string]interface{}) bool {
+	n := 0
+	for field := range expr {
+		if !paramKeys[field] {
+			n++
+		}
+	}
+	return n > 0 && len(unsupportedFields(expr)) == 0
+}
@@ -0,0 +1,82 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"oh-my-stock/models"
+)
+
+func TestNotifiable(t *testing.T) {
+	cases := []struct {
+		expr map[string]interface{}
+		want bool
+	}{
+		{map[string]interface{}{}, false},
+		{map[string]interface{}{"industry": map[string]interface{}{"in": []interface{}{"银行"}}}, false},
+		{map[string]interface{}{"change_percent": map[string]interface{}{"eq": 5.0}}, false},
+		{map[string]interface{}{"change_percent": "bad"}, false},
+		{map[string]interface{}{"pb": map[string]interface{}{"lt": 1.0}, "close": map[string]interface{}{"gte": 5.0}}, true},
+		// 只能判断一部分条件的规则不匹配，免得按子集报命中
+		{map[string]interface{}{"industry": "银行", "pb": map[string]interface{}{"lt": 1.0}}, false},
+		{map[string]interface{}{"close": map[string]interface{}{"gt": 10.0}, "consecutive_up_days": map[string]interface{}{"gte": 3.0}}, false},
+		{map[string]interface{}{"close": map[string]interface{}{"gt": 10.0}, "formula:MYMA.MA5": map[string]interface{}{"gt": 0.0}}, false},
+		{map[string]interface{}{"close": map[string]interface{}{"gt": 10.0, "eq": 11.0}}, false},
+		{map[string]interface{}{"volume_amplify_days": 2.0}, false},
+	}
+	for _, c := range cases {
+		if got := notifiable(c.expr); got != c.want {
+			t.Fatalf("notifiable(%v) = %v, want %v", c.expr, got, c.want)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	expr, _ := json.Marshal(map[string]interface{}{"change_percent": map[string]interface{}{"gt": 0}})
+	onlyIndustry, _ := json.Marshal(map[string]interface{}{"industry": "银行"})
+	rules := []models.UserStockRule{
+		{ID: 1, RuleName: "off", RuleExpression: expr, NotifyOnMatch: false},
+		{ID: 2, RuleName: "on", RuleExpression: expr, NotifyOnMatch: true},
+		{ID: 3, RuleName: "industry", RuleExpression: onlyIndustry, NotifyOnMatch: true},
+	}
+	var snaps []Snapshot
+	for i := 0; i < maxHitsPerRule+10; i++ {
+		snaps = append(snaps, Snapshot{Symbol: fmt.Sprintf("%06d", i), ChangePercent: 1})
+	}
+
+	hits := match(rules, snaps, true)
+	if len(hits) != maxHitsPerRule {
+		t.Fatalf("hits = %d, want %d（每条规则封顶）", len(hits), maxHitsPerRule)
+	}
+	for _, h := range hits {
+		if h.RuleID != 2 {
+			t.Fatalf("只应命中打开通知的规则 2，got %d", h.RuleID)
+		}
+	}
+	// 预览时关闭通知的规则也算；只有不可判断条件的规则始终跳过
+	if hits := match(rules, snaps, false); len(hits) != 2*maxHitsPerRule {
+		t.Fatalf("dry-run hits = %d", len(hits))
+	}
+}
+
+func TestMatch_SkipsPartiallySupportedRules(t *testing.T) {
+	mixed, _ := json.Marshal(map[string]interface{}{"close": map[string]interface{}{"gt": 10}, "industry": "银行"})
+	formula, _ := json.Marshal(map[string]interface{}{"close": map[string]interface{}{"gt": 10}, "formula:MYMA": map[string]interface{}{"gt": 0}})
+	plain, _ := json.Marshal(map[string]interface{}{"close": map[string]interface{}{"gt": 10}})
+	rules := []models.UserStockRule{
+		{ID: 1, RuleName: "mixed", RuleExpression: mixed, NotifyOnMatch: true},
+		{ID: 2, RuleName: "formula", RuleExpression: formula, NotifyOnMatch: true},
+		{ID: 3, RuleName: "plain", RuleExpression: plain, NotifyOnMatch: true},
+	}
+	snaps := []Snapshot{{Symbol: "600000", Close: 12}, {Symbol: "000001", Close: 8}}
+	hits := MatchAll(rules, snaps)
+	if len(hits) != 1 || hits[0].RuleID != 3 || hits[0].Symbol != "600000" {
+		t.Fatalf("hits = %+v, want only rule 3 / 600000", hits)
+	}
+	skipped := unsupportedRules(rules)
+	if len(skipped) != 2 || skipped[0].RuleID != 1 || skipped[0].Fields[0] != "industry" ||
+		skipped[1].RuleID != 2 || skipped[1].Fields[0] != "formula:MYMA" {
+		t.Fatalf("skipped = %+v", skipped)
+	}
+}
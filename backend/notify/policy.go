@@ -0,0 +1,256 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"oh-my-stock/calendar"
+	"oh-my-stock/models"
+)
+
+// ============================================================
+// 通知策略（notification_policies，每个用户一份，没有记录按 DefaultPolicy）：
+//   - 免打扰 quiet_start–quiet_end（上海时间，可以跨零点）：通知照常写站内、推实时事件，
+//     外发投递推迟到免打扰结束再发。规则命中和价格提醒都遵守（见 DeliverAt）。
+//   - 每条规则每个交易日最多 max_per_rule_daily 条通知，超出的命中当天不再通知。
+//   - 合并（group_hits）：一条规则一轮的新命中合成一条通知，算一条。
+//   - 只通知新进（new_entries_only）：前一交易日收盘快照上已经命中的股票不通知，
+//     股票一直留在结果里就只在进入那天通知一次。
+// 同一交易日已经通知过的 (规则, 股票) 不会再通知，和策略无关。
+// ============================================================
+
+const (
+	// DefaultMaxPerRuleDaily 没有设置时每条规则每个交易日的通知上限。
+	DefaultMaxPerRuleDaily = maxHitsPerRule
+	// MaxPerRuleDailyLimit max_per_rule_daily 的上限。
+	MaxPerRuleDailyLimit = 500
+	// groupListLimit 合并通知正文里最多列出几只，其余只计数。
+	groupListLimit = 20
+)
+
+// DefaultPolicy 没有设置过策略的用户：不免打扰、每条规则每天 50 条、逐只通知。
+func DefaultPolicy(userID string) models.NotificationPolicy {
+	return models.NotificationPolicy{UserID: userID, MaxPerRuleDaily: DefaultMaxPerRuleDaily}
+}
+
+// parseClock "HH:MM" → 距零点的分钟数。
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("时间 %q 格式应为 HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// ValidatePolicy 校验策略，并把免打扰时间规范成 HH:MM。
+func ValidatePolicy(p *models.NotificationPolicy) error {
+	p.QuietStart, p.QuietEnd = strings.TrimSpace(p.QuietStart), strings.TrimSpace(p.QuietEnd)
+	if (p.QuietStart == "") != (p.QuietEnd == "") {
+		return errors.New("免打扰开始和结束时间要同时设置（或同时留空）")
+	}
+	if p.QuietStart != "" {
+		start, err := parseClock(p.QuietStart)
+		if err != nil {
+			return err
+		}
+		end, err := parseClock(p.QuietEnd)
+		if err != nil {
+			return err
+		}
+		if start == end {
+			return errors.New("免打扰开始和结束时间不能相同")
+		}
+		p.QuietStart = fmt.Sprintf("%02d:%02d", start/60, start%60)
+		p.QuietEnd = fmt.Sprintf("%02d:%02d", end/60, end%60)
+	}
+	if p.MaxPerRuleDaily < 1 || p.MaxPerRuleDaily > MaxPerRuleDailyLimit {
+		return fmt.Errorf("每条规则每天的通知上限应在 1–%d 之间", MaxPerRuleDailyLimit)
+	}
+	return nil
+}
+
+// QuietUntil now 在免打扰时段内时返回时段结束的时刻，否则返回零值。
+func QuietUntil(p models.NotificationPolicy, now time.Time) time.Time {
+	if p.QuietStart == "" || p.QuietEnd == "" {
+		return time.Time{}
+	}
+	start, err1 := parseClock(p.QuietStart)
+	end, err2 := parseClock(p.QuietEnd)
+	if err1 != nil || err2 != nil || start == end {
+		return time.Time{}
+	}
+	t := now.In(calendar.Shanghai)
+	m := t.Hour()*60 + t.Minute()
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, calendar.Shanghai)
+	endAt := midnight.Add(time.Duration(end) * time.Minute)
+	switch {
+	case start < end && m >= start && m < end:
+		return endAt
+	case start > end && m >= start: // 跨零点，结束在明天
+		return endAt.AddDate(0, 0, 1)
+	case start > end && m < end:
+		return endAt
+	}
+	return time.Time{}
+}
+
+// DeliverAt 外发投递最早的发送时刻：免打扰时段内推迟到时段结束，否则就是 now（时区和 now 一致）。
+func DeliverAt(p models.NotificationPolicy, now time.Time) time.Time {
+	if until := QuietUntil(p, now); !until.IsZero() {
+		return until.In(now.Location())
+	}
+	return now
+}
+
+// LoadPolicy 一个用户的通知策略，没有设置过返回 DefaultPolicy。
+func LoadPolicy(db *gorm.DB, userID string) (models.NotificationPolicy, error) {
+	p := DefaultPolicy(userID)
+	err := db.Where("user_id = ?", userID).First(&p).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return p, nil
+	}
+	if err != nil {
+		return p, fmt.Errorf("读取通知策略: %w", err)
+	}
+	return p, nil
+}
+
+// LoadPolicies 一批用户的通知策略，没有设置过的用 DefaultPolicy。
+func LoadPolicies(db *gorm.DB, userIDs []string) (map[string]models.NotificationPolicy, error) {
+	out := make(map[string]models.NotificationPolicy, len(userIDs))
+	for _, uid := range userIDs {
+		out[uid] = DefaultPolicy(uid)
+	}
+	if len(userIDs) == 0 {
+		return out, nil
+	}
+	var rows []models.NotificationPolicy
+	if err := db.Where("user_id IN ?", userIDs).Find(&rows).Error; err != nil {
+		return out, fmt.Errorf("读取通知策略: %w", err)
+	}
+	for _, p := range rows {
+		out[p.UserID] = p
+	}
+	return out, nil
+}
+
+// ruleSymbol 一条规则命中的一只股票。
+type ruleSymbol struct {
+	RuleID uint
+	Symbol string
+}
+
+func hitSet(hits []Hit) map[ruleSymbol]bool {
+	set := make(map[ruleSymbol]bool, len(hits))
+	for _, h := range hits {
+		set[ruleSymbol{h.RuleID, h.Symbol}] = true
+	}
+	return set
+}
+
+// sentState 一个用户某个交易日已经写过的规则通知：每条规则的条数、已通知过的股票（含合并通知里的）。
+type sentState struct {
+	counts  map[uint]int
+	symbols map[ruleSymbol]bool
+}
+
+func loadSent(db *gorm.DB, userID string, tradeDate time.Time) (sentState, error) {
+	s := sentState{counts: map[uint]int{}, symbols: map[ruleSymbol]bool{}}
+	var rows []struct {
+		RuleID  uint
+		Symbol  string
+		Symbols models.StringList
+	}
+	if err := db.Raw(`SELECT rule_id, symbol, symbols FROM notifications
+		WHERE user_id = ? AND trade_date = ? AND rule_id IS NOT NULL`,
+		userID, tradeDate.Format("2006-01-02")).Scan(&rows).Error; err != nil {
+		return s, fmt.Errorf("读取已发通知: %w", err)
+	}
+	for _, r := range rows {
+		s.counts[r.RuleID]++
+		s.symbols[ruleSymbol{r.RuleID, r.Symbol}] = true
+		for _, sym := range r.Symbols {
+			s.symbols[ruleSymbol{r.RuleID, sym}] = true
+		}
+	}
+	return s, nil
+}
+
+// draft 一条待写入的规则通知。
+type draft struct {
+	RuleID   uint
+	RuleName string
+	Symbol   string
+	Name     string
+	Title    string
+	Message  string
+	Symbols  []string // 合并通知包含的全部股票，逐只通知时为空
+}
+
+// plan 按策略把命中变成要写的通知。hits 同一规则的连在一起、组内按涨跌幅从高到低（见 matchLimit）；
+// prev 是前一交易日命中的 (规则, 股票)，只在 NewEntriesOnly 时用。
+func plan(hits []Hit, p models.NotificationPolicy, sent sentState, prev map[ruleSymbol]bool) []draft {
+	limit := p.MaxPerRuleDaily
+	if limit <= 0 {
+		limit = DefaultMaxPerRuleDaily
+	}
+	var out []draft
+	for start := 0; start < len(hits); {
+		end := start
+		for end < len(hits) && hits[end].RuleID == hits[start].RuleID {
+			end++
+		}
+		ruleID := hits[start].RuleID
+		var fresh []Hit
+		for _, h := range hits[start:end] {
+			k := ruleSymbol{h.RuleID, h.Symbol}
+			if sent.symbols[k] || (p.NewEntriesOnly && prev[k]) {
+				continue
+			}
+			fresh = append(fresh, h)
+		}
+		start = end
+
+		remaining := limit - sent.counts[ruleID]
+		switch {
+		case len(fresh) == 0 || remaining <= 0:
+		case p.GroupHits && len(fresh) > 1:
+			out = append(out, groupDraft(fresh))
+		default:
+			for _, h := range fresh[:min(remaining, len(fresh))] {
+				out = append(out, draft{
+					RuleID: h.RuleID, RuleName: h.RuleName, Symbol: h.Symbol, Name: h.Name,
+					Title:   fmt.Sprintf("规则「%s」命中 %s %s", h.RuleName, h.Symbol, h.Name),
+					Message: fmt.Sprintf("%s 收盘 %.2f，涨跌幅 %.2f%%", h.TradeDate, h.Close, h.ChangePercent),
+				})
+			}
+		}
+	}
+	return out
+}
+
+// groupDraft 一条规则的多只命中合成一条通知，Symbol 取第一只（涨幅最大）。
+func groupDraft(hits []Hit) draft {
+	first := hits[0]
+	d := draft{
+		RuleID: first.RuleID, RuleName: first.RuleName, Symbol: first.Symbol, Name: first.Name,
+		Title:   fmt.Sprintf("规则「%s」命中 %d 只股票", first.RuleName, len(hits)),
+		Symbols: make([]string, 0, len(hits)),
+	}
+	lines := []string{first.TradeDate}
+	for i, h := range hits {
+		d.Symbols = append(d.Symbols, h.Symbol)
+		if i < groupListLimit {
+			lines = append(lines, fmt.Sprintf("%s %s 收盘 %.2f，涨跌幅 %.2f%%", h.Symbol, h.Name, h.Close, h.ChangePercent))
+		}
+	}
+	if len(hits) > groupListLimit {
+		lines = append(lines, fmt.Sprintf("……等共 %d 只", len(hits)))
+	}
+	d.Message = strings.Join(lines, "\n")
+	return d
+}
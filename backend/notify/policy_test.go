@@ -0,0 +1,179 @@
+package notify
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"oh-my-stock/calendar"
+	"oh-my-stock/models"
+)
+
+func TestValidatePolicy(t *testing.T) {
+	cases := []struct {
+		p       models.NotificationPolicy
+		wantErr bool
+	}{
+		{models.NotificationPolicy{MaxPerRuleDaily: 50}, false},
+		{models.NotificationPolicy{QuietStart: "22:00", QuietEnd: "7:30", MaxPerRuleDaily: 10}, false},
+		{models.NotificationPolicy{QuietStart: "22:00", MaxPerRuleDaily: 10}, true},
+		{models.NotificationPolicy{QuietStart: "25:00", QuietEnd: "07:00", MaxPerRuleDaily: 10}, true},
+		{models.NotificationPolicy{QuietStart: "08:00", QuietEnd: "08:00", MaxPerRuleDaily: 10}, true},
+		{models.NotificationPolicy{MaxPerRuleDaily: 0}, true},
+		{models.NotificationPolicy{MaxPerRuleDaily: MaxPerRuleDailyLimit + 1}, true},
+	}
+	for _, c := range cases {
+		p := c.p
+		if err := ValidatePolicy(&p); (err != nil) != c.wantErr {
+			t.Fatalf("ValidatePolicy(%+v) err = %v, wantErr %v", c.p, err, c.wantErr)
+		}
+	}
+	p := models.NotificationPolicy{QuietStart: " 22:00", QuietEnd: "7:30", MaxPerRuleDaily: 1}
+	if err := ValidatePolicy(&p); err != nil || p.QuietEnd != "07:30" || p.QuietStart != "22:00" {
+		t.Fatalf("规范化后 = %q–%q, err = %v", p.QuietStart, p.QuietEnd, err)
+	}
+}
+
+func TestQuietUntil(t *testing.T) {
+	at := func(day, hh, mm int) time.Time {
+		return time.Date(2026, 3, day, hh, mm, 0, 0, calendar.Shanghai)
+	}
+	night := models.NotificationPolicy{QuietStart: "22:00", QuietEnd: "08:00"}
+	noon := models.NotificationPolicy{QuietStart: "11:30", QuietEnd: "13:00"}
+	cases := []struct {
+		name string
+		p    models.NotificationPolicy
+		now  time.Time
+		want time.Time
+	}{
+		{"未设置", models.NotificationPolicy{}, at(10, 23, 0), time.Time{}},
+		{"跨零点：当晚", night, at(10, 23, 0), at(11, 8, 0)},
+		{"跨零点：凌晨", night, at(11, 7, 59), at(11, 8, 0)},
+		{"跨零点：结束时刻不算", night, at(11, 8, 0), time.Time{}},
+		{"跨零点：白天", night, at(11, 14, 0), time.Time{}},
+		{"当天时段内", noon, at(10, 12, 0), at(10, 13, 0)},
+		{"当天时段前", noon, at(10, 11, 29), time.Time{}},
+		{"UTC 时间按上海时区判断", night, time.Date(2026, 3, 10, 15, 0, 0, 0, time.UTC), at(11, 8, 0)},
+	}
+	for _, c := range cases {
+		if got := QuietUntil(c.p, c.now); !got.Equal(c.want) {
+			t.Fatalf("%s: QuietUntil = %v, want %v", c.name, got, c.want)
+		}
+	}
+
+	now := time.Date(2026, 3, 10, 15, 0, 0, 0, time.UTC)
+	if got := DeliverAt(night, now); !got.Equal(at(11, 8, 0)) || got.Location() != time.UTC {
+		t.Fatalf("DeliverAt = %v", got)
+	}
+	if got := DeliverAt(noon, now); !got.Equal(now) {
+		t.Fatalf("DeliverAt 不在免打扰时段 = %v, want now", got)
+	}
+}
+
+func testHits(ruleID uint, n int) []Hit {
+	var hits []Hit
+	for i := 0; i < n; i++ {
+		hits = append(hits, Hit{RuleID: ruleID, RuleName: fmt.Sprintf("r%d", ruleID), Symbol: fmt.Sprintf("%06d", i),
+			Name: "股票", TradeDate: "2026-03-10", Close: 10, ChangePercent: float64(10 - i)})
+	}
+	return hits
+}
+
+func emptySent() sentState {
+	return sentState{counts: map[uint]int{}, symbols: map[ruleSymbol]bool{}}
+}
+
+func TestPlan_CapAndDedup(t *testing.T) {
+	hits := append(testHits(1, 10), testHits(2, 3)...)
+	p := models.NotificationPolicy{MaxPerRuleDaily: 5}
+	sent := emptySent()
+	sent.counts[1] = 2
+	sent.symbols[ruleSymbol{1, "000000"}] = true
+	sent.symbols[ruleSymbol{1, "000001"}] = true
+
+	drafts := plan(hits, p, sent, nil)
+	var r1, r2 []string
+	for _, d := range drafts {
+		if d.RuleID == 1 {
+			r1 = append(r1, d.Symbol)
+		} else {
+			r2 = append(r2, d.Symbol)
+		}
+	}
+	// 规则 1 今天已有 2 条，只剩 3 条额度，跳过已通知的两只
+	if strings.Join(r1, ",") != "000002,000003,000004" {
+		t.Fatalf("rule 1 = %v", r1)
+	}
+	if len(r2) != 3 {
+		t.Fatalf("rule 2 = %v, want 3", r2)
+	}
+
+	sent.counts[1] = 5
+	for _, d := range plan(hits, p, sent, nil) {
+		if d.RuleID == 1 {
+			t.Fatalf("额度用完后仍然通知 %s", d.Symbol)
+		}
+	}
+}
+
+func TestPlan_Group(t *testing.T) {
+	p := models.NotificationPolicy{MaxPerRuleDaily: 1, GroupHits: true}
+	drafts := plan(testHits(1, groupListLimit+5), p, emptySent(), nil)
+	if len(drafts) != 1 {
+		t.Fatalf("drafts = %d, want 1", len(drafts))
+	}
+	d := drafts[0]
+	if d.Symbol != "000000" || len(d.Symbols) != groupListLimit+5 {
+		t.Fatalf("group symbol = %s, symbols = %d", d.Symbol, len(d.Symbols))
+	}
+	if !strings.Contains(d.Title, fmt.Sprintf("命中 %d 只", groupListLimit+5)) || !strings.Contains(d.Message, "等共") {
+		t.Fatalf("title = %q, message = %q", d.Title, d.Message)
+	}
+	if n := strings.Count(d.Message, "\n"); n != groupListLimit+1 {
+		t.Fatalf("正文行数 = %d", n+1)
+	}
+
+	// 合并通知里的股票算已通知；只剩一只新的时写普通通知
+	sent := emptySent()
+	for _, sym := range d.Symbols[:len(d.Symbols)-1] {
+		sent.symbols[ruleSymbol{1, sym}] = true
+	}
+	sent.counts[1] = 1
+	if drafts := plan(testHits(1, groupListLimit+5), models.NotificationPolicy{MaxPerRuleDaily: 2, GroupHits: true}, sent, nil); len(drafts) != 1 || len(drafts[0].Symbols) != 0 {
+		t.Fatalf("drafts = %+v, want 1 条普通通知", drafts)
+	}
+}
+
+func TestPlan_NewEntriesOnly(t *testing.T) {
+	hits := testHits(1, 4)
+	prev := hitSet(hits[:2])
+	p := models.NotificationPolicy{MaxPerRuleDaily: 50, NewEntriesOnly: true}
+	drafts := plan(hits, p, emptySent(), prev)
+	if len(drafts) != 2 || drafts[0].Symbol != "000002" || drafts[1].Symbol != "000003" {
+		t.Fatalf("drafts = %+v", drafts)
+	}
+	// 没打开时前一交易日的命中照常通知
+	p.NewEntriesOnly = false
+	if drafts := plan(hits, p, emptySent(), prev); len(drafts) != 4 {
+		t.Fatalf("drafts = %d, want 4", len(drafts))
+	}
+}
+
+func TestPlan_DefaultLimit(t *testing.T) {
+	drafts := plan(testHits(1, DefaultMaxPerRuleDaily+10), models.NotificationPolicy{}, emptySent(), nil)
+	if len(drafts) != DefaultMaxPerRuleDaily {
+		t.Fatalf("drafts = %d, want %d", len(drafts), DefaultMaxPerRuleDaily)
+	}
+}
+
+func TestStringList(t *testing.T) {
+	v, err := models.StringList(nil).Value()
+	if err != nil || v != "[]" {
+		t.Fatalf("nil Value = %v, %v", v, err)
+	}
+	var l models.StringList
+	if err := l.Scan([]byte(`["600000","000001"]`)); err != nil || len(l) != 2 || l[1] != "000001" {
+		t.Fatalf("Scan = %v, %v", l, err)
+	}
+}
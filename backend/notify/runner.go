@@ -0,0 +1,344 @@
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+
+	"oh-my-stock/events"
+	"oh-my-stock/models"
+)
+
+// ============================================================
+// 规则命中通知：用 stock_history_mv 最新交易日的快照逐条匹配用户规则（MatchStock），
+// 命中写入 notifications。去重粒度 (user, rule, symbol, trade_date)，同一交易日内
+// rule_check 任务反复跑也不会重复通知；新交易日的数据进来后同一只股票可以再次通知。
+// 新写入的通知按 rule_channels 给规则绑定的渠道排外发投递（见 deliver.go），并推给在线用户（见 events 包）。
+// 写哪些、怎么写由用户的通知策略决定：每天上限、合并、只通知新进、免打扰（见 policy.go）。
+// ============================================================
+
+// allUsersConcurrency RunForAllUsers 同时处理的用户数。
+const allUsersConcurrency = 4
+
+// maxHitsPerRule 预览时每条规则最多列出的股票数（按涨跌幅从高到低），也是每天通知上限的默认值。
+const maxHitsPerRule = 50
+
+// Hit 一条规则命中的一只股票。
+type Hit struct {
+	RuleID        uint    `json:"rule_id"`
+	RuleName      string  `json:"rule_name"`
+	Symbol        string  `json:"symbol"`
+	Name          string  `json:"name"`
+	TradeDate     string  `json:"trade_date"`
+	Close         float64 `json:"close"`
+	ChangePercent float64 `json:"change_percent"`
+}
+
+// snapshotSQL 某个交易日全部股票的快照，按涨跌幅从高到低；%s 是交易日条件。
+const snapshotSQL = `SELECT symbol, COALESCE(name, '') AS name, trade_date,
+		COALESCE(close, 0) AS close, COALESCE(change_percent, 0) AS change_percent,
+		COALESCE(volume, 0) AS volume, COALESCE(turnover_rate, 0) AS turnover_rate,
+		COALESCE(pe_ttm, 0) AS pettm, COALESCE(pb, 0) AS pb, COALESCE(net_amount, 0) AS net_amount
+	FROM stock_history_mv
+	WHERE trade_date = %s
+	ORDER BY change_percent DESC NULLS LAST, symbol`
+
+// loadSnapshots 最新交易日全部股票的快照，按涨跌幅从高到低。
+func loadSnapshots(db *gorm.DB) ([]Snapshot, error) {
+	var snaps []Snapshot
+	if err := db.Raw(fmt.Sprintf(snapshotSQL, "(SELECT MAX(trade_date) FROM stock_history_mv)")).Scan(&snaps).Error; err != nil {
+		return nil, fmt.Errorf("读取行情快照: %w", err)
+	}
+	return snaps, nil
+}
+
+// loadPrevSnapshots day 之前最近一个有数据的交易日的快照；没有更早的数据时返回空。
+func loadPrevSnapshots(db *gorm.DB, day time.Time) (time.Time, []Snapshot, error) {
+	var prev *time.Time
+	if err := db.Raw("SELECT MAX(trade_date) FROM stock_history_mv WHERE trade_date < ?", day.Format("2006-01-02")).Scan(&prev).Error; err != nil {
+		return time.Time{}, nil, fmt.Errorf("读取前一交易日: %w", err)
+	}
+	if prev == nil {
+		return time.Time{}, nil, nil
+	}
+	snaps, err := loadSnapshotsOn(db, *prev)
+	return *prev, snaps, err
+}
+
+// loadSnapshotsOn 指定交易日的快照。
+func loadSnapshotsOn(db *gorm.DB, day time.Time) ([]Snapshot, error) {
+	var snaps []Snapshot
+	if err := db.Raw(fmt.Sprintf(snapshotSQL, "?"), day.Format("2006-01-02")).Scan(&snaps).Error; err != nil {
+		return nil, fmt.Errorf("读取 %s 行情快照: %w", day.Format("2006-01-02"), err)
+	}
+	return snaps, nil
+}
+
+// loadRules 用户的规则；notifyOnly 时只取打开了通知的。
+func loadRules(db *gorm.DB, userID string, notifyOnly bool) ([]models.UserStockRule, error) {
+	q := db.Where("user_id = ?", userID)
+	if notifyOnly {
+		q = q.Where("notify_on_match")
+	}
+	var rules []models.UserStockRule
+	if err := q.Order("id").Find(&rules).Error; err != nil {
+		return nil, fmt.Errorf("读取规则: %w", err)
+	}
+	return rules, nil
+}
+
+// match 规则 × 快照。notifyOnly 时跳过关闭通知的规则；有快照判断不了的条件的规则（见 notifiable）跳过。
+// 每条规则最多 maxHitsPerRule 只。
+func match(rules []models.UserStockRule, snaps []Snapshot, notifyOnly bool) []Hit {
+	return matchLimit(rules, snaps, notifyOnly, maxHitsPerRule)
+}
+
+// matchLimit 同 match，每条规则最多 limit 只，limit <= 0 不限。
+func matchLimit(rules []models.UserStockRule, snaps []Snapshot, notifyOnly bool, limit int) []Hit {
+	var hits []Hit
+	for _, r := range rules {
+		if notifyOnly && !r.NotifyOnMatch {
+			continue
+		}
+		var expr map[string]interface{}
+		if err := json.Unmarshal(r.RuleExpression, &expr); err != nil || !notifiable(expr) {
+			continue
+		}
+		n := 0
+		for _, s := range snaps {
+			if !MatchStock(s, expr) {
+				continue
+			}
+			hits = append(hits, Hit{
+				RuleID: r.ID, RuleName: r.RuleName, Symbol: s.Symbol, Name: s.Name,
+				TradeDate: s.TradeDate.Format("2006-01-02"), Close: s.Close, ChangePercent: s.ChangePercent,
+			})
+			if n++; limit > 0 && n >= limit {
+				break
+			}
+		}
+	}
+	return hits
+}
+
+// writeChunk 每条 INSERT 最多写多少条通知（每条 9 个参数，远低于 PostgreSQL 的 65535 上限）。
+const writeChunk = 500
+
+// insertNotificationsSQL 写通知，并在同一条语句里给规则绑定的启用渠道排投递、写实时事件：
+// 只有这次真正新写入的通知（ins）才排，已通知过的冲突行不会重复推送。
+// VALUES 之后的参数是投递的最早发送时间（免打扰时段内推迟，见 DeliverAt）。
+const insertNotificationsSQL = `WITH ins AS (
+	INSERT INTO notifications (user_id, rule_id, rule_name, symbol, stock_name, symbols, trade_date, title, message)
+	VALUES %s
+	ON CONFLICT (user_id, rule_id, symbol, trade_date) DO NOTHING
+	RETURNING id, user_id, rule_id, rule_name, symbol, stock_name, symbols, trade_date, title, message, created_at
+), q AS (
+	INSERT INTO notification_deliveries (user_id, channel_id, notification_id, status, next_attempt_at)
+	SELECT ins.user_id, c.id, ins.id, 'pending', ?::timestamp
+	FROM ins
+	JOIN rule_channels rc ON rc.rule_id = ins.rule_id
+	JOIN notification_channels c ON c.id = rc.channel_id AND c.user_id = ins.user_id AND c.enabled
+	ON CONFLICT (notification_id, channel_id) DO NOTHING
+	RETURNING 1
+), ev AS (
+	INSERT INTO user_events (user_id, type, data)
+	SELECT user_id, 'notification', jsonb_build_object(
+		'id', id, 'rule_id', rule_id, 'rule_name', rule_name, 'symbol', symbol, 'stock_name', stock_name,
+		'symbols', symbols, 'trade_date', trade_date, 'title', title, 'message', message, 'created_at', created_at)
+	FROM ins ORDER BY id
+)
+SELECT (SELECT COUNT(*) FROM ins) AS notified, (SELECT COUNT(*) FROM q) AS queued`
+
+// matchAndWrite 匹配打开了通知的规则，按用户的通知策略写入通知，同时给绑定的渠道排投递。
+// prev 是前一交易日的快照（只通知新进时用）。返回新写入的通知条数（已通知过的不算）。
+func matchAndWrite(db *gorm.DB, userID string, rules []models.UserStockRule, snaps, prev []Snapshot, p models.NotificationPolicy) (int, error) {
+	hits := matchLimit(rules, snaps, true, 0)
+	if len(hits) == 0 {
+		return 0, nil
+	}
+	tradeDate := snaps[0].TradeDate // 快照都是同一个交易日
+	sent, err := loadSent(db, userID, tradeDate)
+	if err != nil {
+		return 0, err
+	}
+	var before map[ruleSymbol]bool
+	if p.NewEntriesOnly {
+		before = hitSet(matchLimit(rules, prev, true, 0))
+	}
+	drafts := plan(hits, p, sent, before)
+	deliverAt := DeliverAt(p, time.Now())
+
+	notified := 0
+	for start := 0; start < len(drafts); start += writeChunk {
+		chunk := drafts[start:min(start+writeChunk, len(drafts))]
+		values := make([]string, 0, len(chunk))
+		args := make([]interface{}, 0, len(chunk)*9+1)
+		for _, d := range chunk {
+			values = append(values, "(?, ?, ?, ?, ?, ?::jsonb, ?, ?, ?)")
+			args = append(args, userID, d.RuleID, d.RuleName, d.Symbol, d.Name, models.StringList(d.Symbols), tradeDate, d.Title, d.Message)
+		}
+		args = append(args, deliverAt)
+		var res struct{ Notified, Queued int }
+		if err := db.Raw(fmt.Sprintf(insertNotificationsSQL, strings.Join(values, ", ")), args...).Scan(&res).Error; err != nil {
+			return notified, fmt.Errorf("写入通知: %w", err)
+		}
+		notified += res.Notified
+	}
+	if notified > 0 {
+		if err := events.Signal(db); err != nil {
+			log.Printf("⚠️ 实时事件通知失败（在线用户最晚 %s 后收到）: %v", events.PollInterval, err)
+		}
+	}
+	return notified, nil
+}
+
+// RunForUser 对一个用户跑一次规则匹配，返回新写入的通知数。
+func RunForUser(db *gorm.DB, userID string) (int, error) {
+	if userID == "" {
+		return 0, nil
+	}
+	snaps, err := loadSnapshots(db)
+	if err != nil || len(snaps) == 0 {
+		return 0, err
+	}
+	rules, err := loadRules(db, userID, true)
+	if err != nil {
+		return 0, err
+	}
+	p, err := LoadPolicy(db, userID)
+	if err != nil {
+		return 0, err
+	}
+	var prev []Snapshot
+	if p.NewEntriesOnly {
+		if _, prev, err = loadPrevSnapshots(db, snaps[0].TradeDate); err != nil {
+			return 0, err
+		}
+	}
+	return matchAndWrite(db, userID, rules, snaps, prev, p)
+}
+
+// Unsupported 一条不做通知匹配的规则及其快照判断不了的条件。
+type Unsupported struct {
+	RuleID   uint     `json:"rule_id"`
+	RuleName string   `json:"rule_name"`
+	Fields   []string `json:"fields"`
+}
+
+// unsupportedRules rules 里不做通知匹配的规则（表达式解析失败的 Fields 为空）。
+func unsupportedRules(rules []models.UserStockRule) []Unsupported {
+	var out []Unsupported
+	for _, r := range rules {
+		var expr map[string]interface{}
+		if err := json.Unmarshal(r.RuleExpression, &expr); err != nil || !notifiable(expr) {
+			out = append(out, Unsupported{RuleID: r.ID, RuleName: r.RuleName, Fields: unsupportedFields(expr)})
+		}
+	}
+	return out
+}
+
+// DryRunForUser 只匹配不写入，给前端预览「现在会通知哪些」。notifyOnly=false 时关闭了通知的规则也算。
+// 第二个返回值是因条件判断不了而不做通知匹配的规则。
+func DryRunForUser(db *gorm.DB, userID string, notifyOnly bool) ([]Hit, []Unsupported, error) {
+	if userID == "" {
+		return nil, nil, nil
+	}
+	rules, err := loadRules(db, userID, notifyOnly)
+	if err != nil {
+		return nil, nil, err
+	}
+	skipped := unsupportedRules(rules)
+	snaps, err := loadSnapshots(db)
+	if err != nil || len(snaps) == 0 {
+		return nil, skipped, err
+	}
+	hits := match(rules, snaps, notifyOnly)
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].RuleID < hits[j].RuleID })
+	return hits, skipped, nil
+}
+
+// SnapshotsOn 指定交易日全部股票的快照，按涨跌幅从高到低（日报用，多个用户共用一份）。
+func SnapshotsOn(db *gorm.DB, day time.Time) ([]Snapshot, error) {
+	return loadSnapshotsOn(db, day)
+}
+
+// PrevSnapshots day 之前最近一个有数据的交易日及其快照；没有更早的数据时返回零值。
+func PrevSnapshots(db *gorm.DB, day time.Time) (time.Time, []Snapshot, error) {
+	return loadPrevSnapshots(db, day)
+}
+
+// MatchAll 规则 × 快照，含关闭通知的规则，每条规则不封顶（日报用）。
+func MatchAll(rules []models.UserStockRule, snaps []Snapshot) []Hit {
+	return matchLimit(rules, snaps, false, 0)
+}
+
+// Notifiable 规则的条件是否都能在快照上判断（不能的规则不做匹配，见 notifiable）。
+func Notifiable(r models.UserStockRule) bool {
+	var expr map[string]interface{}
+	return json.Unmarshal(r.RuleExpression, &expr) == nil && notifiable(expr)
+}
+
+// RunForAllUsers 对所有打开了通知的用户跑一次（rule_check 任务），快照（和只通知新进要用的前一交易日快照）只读一次。
+// 一个用户失败不影响其他用户，错误合并返回。
+func RunForAllUsers(db *gorm.DB) (int, error) {
+	snaps, err := loadSnapshots(db)
+	if err != nil || len(snaps) == 0 {
+		return 0, err
+	}
+	var users []string
+	if err := db.Model(&models.UserStockRule{}).Where("notify_on_match").
+		Distinct("user_id").Pluck("user_id", &users).Error; err != nil {
+		return 0, fmt.Errorf("读取用户: %w", err)
+	}
+	policies, err := LoadPolicies(db, users)
+	if err != nil {
+		return 0, err
+	}
+	var prev []Snapshot
+	for _, p := range policies {
+		if p.NewEntriesOnly {
+			if _, prev, err = loadPrevSnapshots(db, snaps[0].TradeDate); err != nil {
+				return 0, err
+			}
+			break
+		}
+	}
+
+	var (
+		total atomic.Int64
+		mu    sync.Mutex
+		errs  []error
+		wg    sync.WaitGroup
+		sem   = make(chan struct{}, allUsersConcurrency)
+	)
+	for _, uid := range users {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			rules, err := loadRules(db, uid, true)
+			if err == nil {
+				var n int
+				if n, err = matchAndWrite(db, uid, rules, snaps, prev, policies[uid]); n > 0 {
+					total.Add(int64(n))
+				}
+			}
+			if err != nil {
+				log.Printf("⚠️ 用户 %s 规则匹配失败: %v", uid, err)
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("用户 %s: %w", uid, err))
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return int(total.Load()), errors.Join(errs...)
+}
@@ -157,15 +157,15 @@ func TestAllUsersConcurrency_Positive(t *testing.T) {
 }
 
 
-// DryRunForUser 在无 user_id 时直接返回 (nil, nil)，不查 DB。
+// DryRunForUser 在无 user_id 时直接返回 (nil, nil, nil)，不查 DB。
 // 这条保证上层 admin preview / dry-run 按钮不会因空字符串 panic。
 func TestDryRunForUser_EmptyUserID(t *testing.T) {
-	hits, err := DryRunForUser(nil, "", true)
+	hits, skipped, err := DryRunForUser(nil, "", true)
 	if err != nil {
 		t.Fatalf("err = %v, want nil", err)
 	}
-	if hits != nil {
-		t.Fatalf("hits = %v, want nil", hits)
+	if hits != nil || skipped != nil {
+		t.Fatalf("hits = %v, skipped = %v, want nil", hits, skipped)
 	}
 }
 
@@ -0,0 +1,234 @@
+package parquet
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ============================================================
+// 值的编码：PLAIN、RLE / bit-packed 混合（定义级别、字典下标、布尔），
+// 以及按逻辑类型把物理值渲染成字符串（与 CSV 里的写法一致，交给上层按列解析）。
+// ============================================================
+
+// 物理类型
+const (
+	typeBoolean = iota
+	typeInt32
+	typeInt64
+	typeInt96
+	typeFloat
+	typeDouble
+	typeByteArray
+	typeFixedLenByteArray
+)
+
+// 值编码
+const (
+	encPlain           = 0
+	encPlainDictionary = 2
+	encRLE             = 3
+	encRLEDictionary   = 8
+)
+
+var encodingNames = map[int64]string{
+	0: "PLAIN", 2: "PLAIN_DICTIONARY", 3: "RLE", 4: "BIT_PACKED", 5: "DELTA_BINARY_PACKED",
+	6: "DELTA_LENGTH_BYTE_ARRAY", 7: "DELTA_BYTE_ARRAY", 8: "RLE_DICTIONARY", 9: "BYTE_STREAM_SPLIT",
+}
+
+func encodingName(e int64) string {
+	if s, ok := encodingNames[e]; ok {
+		return s
+	}
+	return strconv.FormatInt(e, 10)
+}
+
+var errCorrupt = errors.New("parquet: 页数据损坏")
+
+// readHybrid 解 n 个 RLE / bit-packed 混合编码的值（位宽 width，0~32）。
+func readHybrid(b []byte, width, n int) ([]uint32, error) {
+	if width < 0 || width > 32 {
+		return nil, fmt.Errorf("parquet: 位宽 %d 不合法", width)
+	}
+	out := make([]uint32, 0, n)
+	byteWidth := (width + 7) / 8
+	pos := 0
+	for len(out) < n {
+		h, k := binary.Uvarint(b[pos:])
+		if k <= 0 {
+			return nil, errCorrupt
+		}
+		pos += k
+		if h&1 == 0 { // RLE：重复 h>>1 次
+			count := int(h >> 1)
+			if pos+byteWidth > len(b) {
+				return nil, errCorrupt
+			}
+			var v uint32
+			for i := 0; i < byteWidth; i++ {
+				v |= uint32(b[pos+i]) << (8 * i)
+			}
+			pos += byteWidth
+			for i := 0; i < count && len(out) < n; i++ {
+				out = append(out, v)
+			}
+			continue
+		}
+		// bit-packed：h>>1 组，每组 8 个值，低位在前
+		count := int(h>>1) * 8
+		end := pos + int(h>>1)*width
+		if end > len(b) || end < pos {
+			return nil, errCorrupt
+		}
+		for i := 0; i < count && len(out) < n; i++ {
+			var v uint32
+			for j := 0; j < width; j++ {
+				bit := i*width + j
+				if b[pos+bit/8]>>(bit%8)&1 == 1 {
+					v |= 1 << j
+				}
+			}
+			out = append(out, v)
+		}
+		pos = end
+	}
+	return out, nil
+}
+
+// bitWidth 表示 0..max 需要的位数。
+func bitWidth(max int) int {
+	w := 0
+	for max > 0 {
+		w++
+		max >>= 1
+	}
+	return w
+}
+
+// plain 解 n 个 PLAIN 编码的值并渲染成字符串。
+func (c *column) plain(b []byte, n int) ([]string, error) {
+	out := make([]string, 0, n)
+	fixed := map[int]int{typeInt32: 4, typeInt64: 8, typeInt96: 12, typeFloat: 4, typeDouble: 8, typeFixedLenByteArray: c.typeLen}
+	switch c.phys {
+	case typeBoolean:
+		if (n+7)/8 > len(b) {
+			return nil, errCorrupt
+		}
+		for i := 0; i < n; i++ {
+			out = append(out, strconv.FormatBool(b[i/8]>>(i%8)&1 == 1))
+		}
+	case typeByteArray:
+		pos := 0
+		for i := 0; i < n; i++ {
+			if pos+4 > len(b) {
+				return nil, errCorrupt
+			}
+			l := int(binary.LittleEndian.Uint32(b[pos:]))
+			pos += 4
+			if l < 0 || l > len(b)-pos {
+				return nil, errCorrupt
+			}
+			out = append(out, c.bytes(b[pos:pos+l]))
+			pos += l
+		}
+	default:
+		size := fixed[c.phys]
+		if size <= 0 || n*size > len(b) {
+			return nil, errCorrupt
+		}
+		for i := 0; i < n; i++ {
+			out = append(out, c.fixed(b[i*size:(i+1)*size]))
+		}
+	}
+	return out, nil
+}
+
+// fixed 渲染定长物理值。
+func (c *column) fixed(v []byte) string {
+	switch c.phys {
+	case typeInt32:
+		x := int32(binary.LittleEndian.Uint32(v))
+		switch {
+		case c.date:
+			return time.Unix(int64(x)*86400, 0).UTC().Format("2006-01-02")
+		case c.scale > 0:
+			return decimal(big.NewInt(int64(x)), c.scale)
+		case c.unsigned:
+			return strconv.FormatUint(uint64(uint32(x)), 10)
+		}
+		return strconv.FormatInt(int64(x), 10)
+	case typeInt64:
+		x := int64(binary.LittleEndian.Uint64(v))
+		switch {
+		case c.tsUnit > 0:
+			return c.timestamp(x)
+		case c.scale > 0:
+			return decimal(big.NewInt(x), c.scale)
+		case c.unsigned:
+			return strconv.FormatUint(uint64(x), 10)
+		}
+		return strconv.FormatInt(x, 10)
+	case typeInt96: // 旧版 Impala / Spark 时间戳：8 字节当日纳秒 + 4 字节儒略日
+		nanos := int64(binary.LittleEndian.Uint64(v))
+		days := int64(binary.LittleEndian.Uint32(v[8:])) - 2440588
+		return c.render(time.Unix(days*86400, nanos).In(c.loc))
+	case typeFloat:
+		return strconv.FormatFloat(float64(math.Float32frombits(binary.LittleEndian.Uint32(v))), 'f', -1, 32)
+	case typeDouble:
+		return strconv.FormatFloat(math.Float64frombits(binary.LittleEndian.Uint64(v)), 'f', -1, 64)
+	}
+	return c.bytes(v) // FIXED_LEN_BYTE_ARRAY
+}
+
+// bytes 渲染变长 / 定长字节串：DECIMAL 是大端补码的未缩放整数，其余按 UTF-8 文本。
+func (c *column) bytes(v []byte) string {
+	if !c.decimal {
+		return string(v)
+	}
+	x := new(big.Int).SetBytes(v)
+	if len(v) > 0 && v[0]&0x80 != 0 {
+		x.Sub(x, new(big.Int).Lsh(big.NewInt(1), uint(len(v)*8)))
+	}
+	return decimal(x, c.scale)
+}
+
+// timestamp INT64 时间戳：tsUnit 为每秒的单位数（1e3 / 1e6 / 1e9）。
+func (c *column) timestamp(x int64) string {
+	sec, frac := x/c.tsUnit, x%c.tsUnit
+	if frac < 0 {
+		sec, frac = sec-1, frac+c.tsUnit
+	}
+	t := time.Unix(sec, frac*(int64(time.Second)/c.tsUnit)).UTC()
+	if c.utc {
+		t = t.In(c.loc)
+	}
+	return c.render(t)
+}
+
+// render 午夜的时间戳（pandas 的日期列）只写日期。
+func (c *column) render(t time.Time) string {
+	if t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0 && t.Nanosecond() == 0 {
+		return t.Format("2006-01-02")
+	}
+	return t.Format("2006-01-02 15:04:05")
+}
+
+// decimal 未缩放整数 x 按 scale 位小数渲染，如 (12345, 2) → 123.45。
+func decimal(x *big.Int, scale int) string {
+	s := new(big.Int).Abs(x).String()
+	if scale > 0 {
+		if len(s) <= scale {
+			s = strings.Repeat("0", scale-len(s)+1) + s
+		}
+		s = s[:len(s)-scale] + "." + s[len(s)-scale:]
+	}
+	if x.Sign() < 0 {
+		s = "-" + s
+	}
+	return s
+}
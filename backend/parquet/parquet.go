@@ -0,0 +1,433 @@
+// Package parquet 只读的 Parquet 读取器（只用标准库），供导入历史数据用。
+//
+// 支持平铺的表（没有嵌套、重复列）：REQUIRED / OPTIONAL 列，PLAIN 与字典编码，
+// 数据页 v1 / v2，UNCOMPRESSED / SNAPPY / GZIP 压缩。pandas、pyarrow、polars、duckdb
+// 用默认参数导出的日线表都在这个范围内（polars 默认 ZSTD，导出时需指定 compression="snappy"）。
+// 每个值按逻辑类型渲染成字符串（DATE → 2024-06-03，DECIMAL → 12.34），与 CSV 的读法一致。
+package parquet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+)
+
+var magic = []byte("PAR1")
+
+// ErrNotParquet 文件头尾没有 PAR1 标记。
+var ErrNotParquet = errors.New("parquet: 不是 Parquet 文件")
+
+// 页类型
+const (
+	pageData       = 0
+	pageIndex      = 1
+	pageDictionary = 2
+	pageDataV2     = 3
+)
+
+var codecNames = map[int64]string{0: "UNCOMPRESSED", 1: "SNAPPY", 2: "GZIP", 3: "LZO", 4: "BROTLI", 5: "LZ4", 6: "ZSTD", 7: "LZ4_RAW"}
+
+// File 一个打开的 Parquet 文件，按行读取。
+type File struct {
+	f        *os.File
+	cols     []*column
+	groups   []fields
+	numRows  int64
+	group    int        // 下一个要读的行组
+	buf      [][]string // 当前行组各列按行的值，NULL 行为空串
+	valid    [][]bool
+	row, end int
+}
+
+// column 一个叶子列及其渲染方式。
+type column struct {
+	name     string
+	phys     int
+	typeLen  int
+	maxDef   int
+	date     bool
+	decimal  bool
+	scale    int
+	unsigned bool
+	tsUnit   int64 // INT64 时间戳每秒的单位数，0 表示不是时间戳
+	utc      bool  // isAdjustedToUTC：按 loc 换算成当地时间
+	loc      *time.Location
+}
+
+// Open 打开 path 并读取文件尾的元数据。loc 用于换算带时区（isAdjustedToUTC）的时间戳，nil 为 UTC。
+func Open(path string, loc *time.Location) (*File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	pf, err := newFile(f, loc)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return pf, nil
+}
+
+func newFile(f *os.File, loc *time.Location) (*File, error) {
+	if loc == nil {
+		loc = time.UTC
+	}
+	st, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := st.Size()
+	if size < 12 {
+		return nil, ErrNotParquet
+	}
+	tail := make([]byte, 8)
+	if _, err := f.ReadAt(tail, size-8); err != nil {
+		return nil, err
+	}
+	head := make([]byte, 4)
+	if _, err := f.ReadAt(head, 0); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(tail[4:], magic) || !bytes.Equal(head, magic) {
+		return nil, ErrNotParquet
+	}
+	n := int64(binary.LittleEndian.Uint32(tail))
+	if n <= 0 || n > size-12 {
+		return nil, errors.New("parquet: 文件尾长度不对")
+	}
+	footer := make([]byte, n)
+	if _, err := f.ReadAt(footer, size-8-n); err != nil {
+		return nil, err
+	}
+	meta, err := (&thriftReader{b: footer}).readStruct(0)
+	if err != nil {
+		return nil, fmt.Errorf("parquet: 读取元数据: %w", err)
+	}
+	cols, err := schemaColumns(meta.list(2), loc)
+	if err != nil {
+		return nil, err
+	}
+	pf := &File{f: f, cols: cols, numRows: meta.i64(3)}
+	for _, g := range meta.list(4) {
+		rg, _ := g.(fields)
+		if len(rg.list(1)) != len(cols) {
+			return nil, errors.New("parquet: 行组的列数与 schema 不符")
+		}
+		pf.groups = append(pf.groups, rg)
+	}
+	return pf, nil
+}
+
+// schemaColumns 从 schema 列表（第一个是根）取出叶子列；有嵌套或重复列时报错。
+func schemaColumns(schema []any, loc *time.Location) ([]*column, error) {
+	if len(schema) == 0 {
+		return nil, errors.New("parquet: 没有 schema")
+	}
+	var cols []*column
+	for _, e := range schema[1:] {
+		el, _ := e.(fields)
+		name := el.str(4)
+		if el.i64(5) > 0 || el.i64(3) == 2 {
+			return nil, fmt.Errorf("parquet: 列 %q 是嵌套或重复列，只支持平铺的表", name)
+		}
+		c := &column{name: name, phys: int(el.i64(1)), typeLen: int(el.i64(2)), loc: loc}
+		if el.i64(3) == 1 { // OPTIONAL
+			c.maxDef = 1
+		}
+		switch el.i64(6) { // ConvertedType（旧写法，新文件两者都写）
+		case 5:
+			c.decimal, c.scale = true, int(el.i64(7))
+		case 6:
+			c.date = true
+		case 9:
+			c.tsUnit, c.utc = 1e3, true
+		case 10:
+			c.tsUnit, c.utc = 1e6, true
+		case 11, 12, 13, 14:
+			c.unsigned = true
+		}
+		if lt := el.sub(10); lt != nil { // LogicalType 优先
+			switch {
+			case lt.has(5):
+				d := lt.sub(5)
+				c.decimal, c.scale = true, int(d.i64(1))
+			case lt.has(6):
+				c.date = true
+			case lt.has(8):
+				ts := lt.sub(8)
+				c.utc = ts.boolean(1, false)
+				switch unit := ts.sub(2); {
+				case unit.has(1):
+					c.tsUnit = 1e3
+				case unit.has(2):
+					c.tsUnit = 1e6
+				case unit.has(3):
+					c.tsUnit = 1e9
+				}
+			case lt.has(10):
+				c.unsigned = !lt.sub(10).boolean(2, true)
+			}
+		}
+		if c.phys == typeInt96 {
+			c.utc = true
+		}
+		cols = append(cols, c)
+	}
+	return cols, nil
+}
+
+// Columns 列名，顺序与 Next 返回的值一致。
+func (f *File) Columns() []string {
+	out := make([]string, len(f.cols))
+	for i, c := range f.cols {
+		out[i] = c.name
+	}
+	return out
+}
+
+// NumRows 总行数。
+func (f *File) NumRows() int64 { return f.numRows }
+
+// Next 下一行，NULL 为空串；读完返回 io.EOF。返回的切片下次调用时会被复用。
+func (f *File) Next() ([]string, error) {
+	for f.row >= f.end {
+		if f.group >= len(f.groups) {
+			return nil, io.EOF
+		}
+		if err := f.loadGroup(f.groups[f.group]); err != nil {
+			return nil, fmt.Errorf("parquet: 第 %d 个行组: %w", f.group+1, err)
+		}
+		f.group++
+	}
+	rec := make([]string, len(f.cols))
+	for i := range f.cols {
+		if f.valid[i][f.row] {
+			rec[i] = f.buf[i][f.row]
+		}
+	}
+	f.row++
+	return rec, nil
+}
+
+// Close 关闭文件。
+func (f *File) Close() error { return f.f.Close() }
+
+// loadGroup 把一个行组的所有列解出来。
+func (f *File) loadGroup(rg fields) error {
+	n := int(rg.i64(3))
+	f.buf, f.valid = make([][]string, len(f.cols)), make([][]bool, len(f.cols))
+	for i, cc := range rg.list(1) {
+		chunk, _ := cc.(fields)
+		vals, valid, err := f.readChunk(f.cols[i], chunk.sub(3))
+		if err != nil {
+			return fmt.Errorf("列 %q: %w", f.cols[i].name, err)
+		}
+		if len(valid) != n {
+			return fmt.Errorf("列 %q: 值个数 %d 与行数 %d 不符", f.cols[i].name, len(valid), n)
+		}
+		f.buf[i], f.valid[i] = vals, valid
+	}
+	f.row, f.end = 0, n
+	return nil
+}
+
+// readChunk 读一个列块：可选的字典页 + 若干数据页。vals、valid 都按行，NULL 行 valid 为 false。
+func (f *File) readChunk(c *column, md fields) (vals []string, valid []bool, err error) {
+	if md == nil {
+		return nil, nil, errors.New("缺少列元数据")
+	}
+	codec := md.i64(4)
+	if _, ok := codecNames[codec]; !ok || codec > 2 {
+		return nil, nil, fmt.Errorf("不支持 %s 压缩（请用 snappy / gzip / 不压缩导出）", codecNames[codec])
+	}
+	start := md.i64(9)
+	if dict := md.i64(11); md.has(11) && dict > 0 && dict < start {
+		start = dict
+	}
+	size := md.i64(7)
+	if start < 4 || size <= 0 || size > 1<<31 {
+		return nil, nil, errCorrupt
+	}
+	raw := make([]byte, size)
+	if _, err := f.f.ReadAt(raw, start); err != nil {
+		return nil, nil, err
+	}
+	total := md.i64(5)
+	r := &thriftReader{b: raw}
+	var dict []string
+	for int64(len(valid)) < total {
+		ph, err := r.readStruct(0)
+		if err != nil {
+			return nil, nil, fmt.Errorf("页头: %w", err)
+		}
+		clen, ulen := int(ph.i64(3)), int(ph.i64(2))
+		if clen < 0 || clen > len(raw)-r.pos {
+			return nil, nil, errCorrupt
+		}
+		body := raw[r.pos : r.pos+clen]
+		r.pos += clen
+
+		switch ph.i64(1) {
+		case pageDictionary:
+			data, err := decompress(codec, body, ulen)
+			if err != nil {
+				return nil, nil, err
+			}
+			if dict, err = c.plain(data, int(ph.sub(7).i64(1))); err != nil {
+				return nil, nil, fmt.Errorf("字典页: %w", err)
+			}
+		case pageData:
+			dh := ph.sub(5)
+			data, err := decompress(codec, body, ulen)
+			if err != nil {
+				return nil, nil, err
+			}
+			n := int(dh.i64(1))
+			defs := data[:0]
+			if c.maxDef > 0 { // v1：定义级别前有 4 字节长度
+				if len(data) < 4 {
+					return nil, nil, errCorrupt
+				}
+				l := int(binary.LittleEndian.Uint32(data))
+				if l < 0 || l > len(data)-4 {
+					return nil, nil, errCorrupt
+				}
+				defs, data = data[4:4+l], data[4+l:]
+			}
+			if vals, valid, err = c.appendPage(vals, valid, defs, data, n, dh.i64(2), dict); err != nil {
+				return nil, nil, err
+			}
+		case pageDataV2:
+			dh := ph.sub(8)
+			rl, dl := int(dh.i64(6)), int(dh.i64(5))
+			if rl < 0 || dl < 0 || rl+dl > len(body) {
+				return nil, nil, errCorrupt
+			}
+			defs, data := body[rl:rl+dl], body[rl+dl:] // v2 的级别不压缩
+			if dh.boolean(7, true) {
+				if data, err = decompress(codec, data, ulen-rl-dl); err != nil {
+					return nil, nil, err
+				}
+			}
+			if vals, valid, err = c.appendPage(vals, valid, defs, data, int(dh.i64(1)), dh.i64(4), dict); err != nil {
+				return nil, nil, err
+			}
+		case pageIndex:
+		default:
+			return nil, nil, fmt.Errorf("未知页类型 %d", ph.i64(1))
+		}
+	}
+	return vals, valid, nil
+}
+
+// appendPage 解一个数据页的 n 行：defs 为定义级别（RLE，无长度前缀），data 为值。
+func (c *column) appendPage(vals []string, valid []bool, defs, data []byte, n int, enc int64, dict []string) ([]string, []bool, error) {
+	ok := make([]bool, n)
+	present := n
+	if c.maxDef > 0 {
+		levels, err := readHybrid(defs, bitWidth(c.maxDef), n)
+		if err != nil {
+			return nil, nil, fmt.Errorf("定义级别: %w", err)
+		}
+		present = 0
+		for i, l := range levels {
+			if ok[i] = int(l) == c.maxDef; ok[i] {
+				present++
+			}
+		}
+	} else {
+		for i := range ok {
+			ok[i] = true
+		}
+	}
+	got, err := c.pageValues(data, present, enc, dict)
+	if err != nil {
+		return nil, nil, err
+	}
+	j := 0
+	for _, v := range ok {
+		if v {
+			vals = append(vals, got[j])
+			j++
+		} else {
+			vals = append(vals, "")
+		}
+	}
+	return vals, append(valid, ok...), nil
+}
+
+// pageValues 解一页里 n 个非 NULL 值。
+func (c *column) pageValues(data []byte, n int, enc int64, dict []string) ([]string, error) {
+	if n == 0 {
+		return nil, nil
+	}
+	switch {
+	case enc == encPlain:
+		return c.plain(data, n)
+	case enc == encPlainDictionary || enc == encRLEDictionary:
+		if dict == nil {
+			return nil, errors.New("字典编码的页前面没有字典页")
+		}
+		if len(data) == 0 {
+			return nil, errCorrupt
+		}
+		idx, err := readHybrid(data[1:], int(data[0]), n)
+		if err != nil {
+			return nil, fmt.Errorf("字典下标: %w", err)
+		}
+		out := make([]string, n)
+		for k, i := range idx {
+			if int(i) >= len(dict) {
+				return nil, errCorrupt
+			}
+			out[k] = dict[i]
+		}
+		return out, nil
+	case enc == encRLE && c.phys == typeBoolean: // v2 页里的布尔值：4 字节长度 + RLE
+		if len(data) < 4 {
+			return nil, errCorrupt
+		}
+		bits, err := readHybrid(data[4:], 1, n)
+		if err != nil {
+			return nil, err
+		}
+		out := make([]string, n)
+		for k, b := range bits {
+			out[k] = strconv.FormatBool(b == 1)
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("不支持 %s 编码", encodingName(enc))
+}
+
+// decompress 按列块的压缩方式解压一页；ulen 为解压后的长度。
+func decompress(codec int64, b []byte, ulen int) ([]byte, error) {
+	switch codec {
+	case 0:
+		return b, nil
+	case 1:
+		return snappyDecode(b, ulen)
+	case 2:
+		zr, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		out := make([]byte, 0, ulen)
+		buf := bytes.NewBuffer(out)
+		if _, err := io.Copy(buf, io.LimitReader(zr, int64(ulen)+1)); err != nil {
+			return nil, err
+		}
+		if buf.Len() != ulen {
+			return nil, errCorrupt
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, fmt.Errorf("不支持 %s 压缩", codecNames[codec])
+}
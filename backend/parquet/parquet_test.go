@@ -0,0 +1,288 @@
+package parquet
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "重新生成 testdata/daily.parquet")
+
+func readAll(t *testing.T, path string, loc *time.Location) ([]string, [][]string) {
+	t.Helper()
+	f, err := Open(path, loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var rows [][]string
+	for {
+		rec, err := f.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows = append(rows, rec)
+	}
+	if int64(len(rows)) != f.NumRows() {
+		t.Fatalf("读到 %d 行, 元数据 %d 行", len(rows), f.NumRows())
+	}
+	return f.Columns(), rows
+}
+
+func logical(id int16, body func(e *tenc)) func(e *tenc) {
+	return func(e *tenc) {
+		e.strct(id)
+		if body != nil {
+			body(e)
+		}
+		e.end()
+	}
+}
+
+// dailyCols pandas(pyarrow) 导出日线的样子：日期是不带时区的 TIMESTAMP(MICROS)，
+// 代码字典编码，价格 DOUBLE 可为空。
+func dailyCols() []tcol {
+	day := func(s string) any {
+		d, _ := time.Parse("2006-01-02", s)
+		return d.UnixMicro()
+	}
+	return []tcol{
+		{name: "date", phys: typeInt64, conv: -1, values: []any{day("2024-06-03"), day("2024-06-04"), day("2024-06-05")},
+			logical: logical(8, func(e *tenc) {
+				e.boolean(1, false)
+				e.strct(2)
+				e.strct(2) // MICROS
+				e.end()
+				e.end()
+			})},
+		{name: "symbol", phys: typeByteArray, conv: 0, optional: true, dict: true, logical: logical(1, nil),
+			values: []any{"600000", "600000", "600000"}},
+		{name: "open", phys: typeDouble, conv: -1, optional: true, values: []any{7.0, 7.05, 7.1}},
+		{name: "high", phys: typeDouble, conv: -1, optional: true, values: []any{7.1, 7.15, 7.25}},
+		{name: "low", phys: typeDouble, conv: -1, optional: true, values: []any{6.95, 7.0, 7.05}},
+		{name: "close", phys: typeDouble, conv: -1, optional: true, values: []any{7.05, 7.1, 7.2}},
+		{name: "volume", phys: typeInt64, conv: -1, optional: true, values: []any{int64(100), int64(200), int64(300)}},
+		{name: "amount", phys: typeDouble, conv: -1, optional: true, values: []any{705.0, nil, 2160.0}},
+	}
+}
+
+// TestGolden testdata/daily.parquet 也是 importer 的导入样本（snappy、字典页 + v1 数据页）。
+func TestGolden(t *testing.T) {
+	path := filepath.Join("testdata", "daily.parquet")
+	if *update {
+		writeParquet(t, path, dailyCols(), topts{codec: 1})
+	}
+	cols, rows := readAll(t, path, nil)
+	if want := []string{"date", "symbol", "open", "high", "low", "close", "volume", "amount"}; !reflect.DeepEqual(cols, want) {
+		t.Fatalf("cols = %v", cols)
+	}
+	want := [][]string{
+		{"2024-06-03", "600000", "7", "7.1", "6.95", "7.05", "100", "705"},
+		{"2024-06-04", "600000", "7.05", "7.15", "7", "7.1", "200", ""},
+		{"2024-06-05", "600000", "7.1", "7.25", "7.05", "7.2", "300", "2160"},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Fatalf("rows = %v", rows)
+	}
+}
+
+func TestRead_EncodingsAndPages(t *testing.T) {
+	n := 40
+	dates := make([]any, n)
+	codes := make([]any, n)
+	closes := make([]any, n)
+	flags := make([]any, n)
+	prices := make([]any, n)
+	for i := range dates {
+		dates[i] = int32(19877 + i) // 2024-06-03 起的天数
+		codes[i] = []string{"600000", "000001", "300750"}[i%3]
+		if i%7 != 3 {
+			closes[i] = 10 + float64(i)/4
+		}
+		flags[i] = i%5 == 0
+		prices[i] = int64(1234 + i) // DECIMAL(18,2)
+	}
+	cols := []tcol{
+		{name: "trade_date", phys: typeInt32, conv: 6, values: dates},
+		{name: "code", phys: typeByteArray, conv: 0, dict: true, values: codes},
+		{name: "close", phys: typeDouble, conv: -1, optional: true, values: closes},
+		{name: "st", phys: typeBoolean, conv: -1, values: flags},
+		{name: "price", phys: typeInt64, conv: 5, scale: 2, values: prices},
+	}
+	for _, opt := range []topts{
+		{codec: 0},
+		{codec: 1, groupRows: 16, pageRows: 5},
+		{codec: 2, groupRows: 25, pageRows: 9},
+		{codec: 0, v2: true, pageRows: 11},
+		{codec: 1, v2: true, groupRows: 13, pageRows: 4},
+		{codec: 2, v2: true, groupRows: 30},
+	} {
+		path := filepath.Join(t.TempDir(), "x.parquet")
+		writeParquet(t, path, cols, opt)
+		_, rows := readAll(t, path, nil)
+		if len(rows) != n {
+			t.Fatalf("%+v: %d 行", opt, len(rows))
+		}
+		for i, r := range rows {
+			want := []string{
+				time.Date(2024, 6, 3+i, 0, 0, 0, 0, time.UTC).Format("2006-01-02"),
+				codes[i].(string), "", "false", "",
+			}
+			if closes[i] != nil {
+				want[2] = strconv.FormatFloat(closes[i].(float64), 'f', -1, 64)
+			}
+			if flags[i].(bool) {
+				want[3] = "true"
+			}
+			want[4] = decimal(big.NewInt(prices[i].(int64)), 2)
+			if !reflect.DeepEqual(r, want) {
+				t.Fatalf("%+v 第 %d 行 = %v, want %v", opt, i, r, want)
+			}
+		}
+	}
+}
+
+func TestRead_TimestampsAndDecimals(t *testing.T) {
+	sh := time.FixedZone("CST", 8*3600)
+	// 2024-06-03 00:00 上海 = 2024-06-02 16:00 UTC
+	instant := time.Date(2024, 6, 3, 0, 0, 0, 0, sh)
+	var int96 [12]byte
+	jd := uint32(instant.UTC().Unix()/86400 + 2440588)
+	nanos := uint64(instant.UTC().Unix()%86400) * 1e9
+	for i := 0; i < 8; i++ {
+		int96[i] = byte(nanos >> (8 * i))
+	}
+	for i := 0; i < 4; i++ {
+		int96[8+i] = byte(jd >> (8 * i))
+	}
+	tsUTC := func(unit int16) func(e *tenc) {
+		return logical(8, func(e *tenc) {
+			e.boolean(1, true)
+			e.strct(2)
+			e.strct(unit)
+			e.end()
+			e.end()
+		})
+	}
+	cols := []tcol{
+		{name: "ms", phys: typeInt64, conv: 9, values: []any{instant.UnixMilli()}},
+		{name: "ns", phys: typeInt64, conv: -1, logical: tsUTC(3), values: []any{instant.UnixNano()}},
+		{name: "naive", phys: typeInt64, conv: -1, values: []any{time.Date(2024, 6, 3, 9, 30, 0, 0, time.UTC).UnixMicro()},
+			logical: logical(8, func(e *tenc) {
+				e.boolean(1, false)
+				e.strct(2)
+				e.strct(2)
+				e.end()
+				e.end()
+			})},
+		{name: "legacy", phys: typeInt96, conv: -1, values: []any{int96}},
+		{name: "neg", phys: typeInt32, conv: 5, scale: 3, values: []any{int32(-5)}},
+		{name: "big", phys: typeFixedLenByteArray, typeLen: 3, conv: -1, scale: 2,
+			logical: logical(5, func(e *tenc) { e.i32(1, 2); e.i32(2, 6) }), values: []any{[]byte{0xff, 0xff, 0x85}}},
+		{name: "f32", phys: typeFloat, conv: -1, values: []any{float32(0.1)}},
+		{name: "u32", phys: typeInt32, conv: 13, values: []any{int32(-1)}},
+	}
+	// conv=-1 的 big 靠 LogicalType 识别 DECIMAL
+	cols[5].scale = 0
+	path := filepath.Join(t.TempDir(), "ts.parquet")
+	writeParquet(t, path, cols, topts{codec: 1})
+	_, rows := readAll(t, path, sh)
+	want := []string{"2024-06-03", "2024-06-03", "2024-06-03 09:30:00", "2024-06-03", "-0.005", "-1.23", "0.1", "4294967295"}
+	if !reflect.DeepEqual(rows[0], want) {
+		t.Fatalf("row = %v, want %v", rows[0], want)
+	}
+	// 不给时区按 UTC：上海零点是前一天 16:00
+	_, rows = readAll(t, path, nil)
+	if rows[0][0] != "2024-06-02 16:00:00" || rows[0][2] != "2024-06-03 09:30:00" {
+		t.Fatalf("utc row = %v", rows[0])
+	}
+}
+
+func TestOpen_Errors(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "bad.parquet")
+	os.WriteFile(p, []byte("date,open\n2024-06-03,1\n"), 0o644)
+	if _, err := Open(p, nil); !errors.Is(err, ErrNotParquet) {
+		t.Fatalf("err = %v", err)
+	}
+
+	// ZSTD：元数据能读，读数据时报清楚的错
+	cols := dailyCols()[:1]
+	writeParquet(t, p, cols, topts{codec: 6})
+	f, err := Open(p, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.Next()
+	f.Close()
+	if err == nil || !strings.Contains(err.Error(), "ZSTD") {
+		t.Fatalf("err = %v", err)
+	}
+
+	// 截断的文件
+	writeParquet(t, p, dailyCols(), topts{codec: 1})
+	b, _ := os.ReadFile(p)
+	os.WriteFile(p, append(b[:20:20], b[len(b)-8:]...), 0o644)
+	if _, err := Open(p, nil); err == nil {
+		t.Fatal("截断的文件应报错")
+	}
+}
+
+func TestSnappyDecode(t *testing.T) {
+	// 字面量 "abcd" + 1 字节偏移拷贝（offset 4, len 8，与输出重叠）
+	src := []byte{12, 3 << 2, 'a', 'b', 'c', 'd', (8-4)<<2 | 1, 4}
+	got, err := snappyDecode(src, 0)
+	if err != nil || string(got) != "abcdabcdabcd" {
+		t.Fatalf("got %q err %v", got, err)
+	}
+	// 61 字节的长字面量（tag 60 + 1 字节长度）+ 4 字节偏移拷贝
+	lit := bytes.Repeat([]byte("xy"), 30)
+	lit = append(lit, 'z')
+	src = []byte{61 + 5}
+	src = append(src, 60<<2, 60)
+	src = append(src, lit...)
+	src = append(src, (5-1)<<2|3, 61, 0, 0, 0)
+	got, err = snappyDecode(src, 66)
+	if err != nil || string(got) != string(lit)+string(lit[:5]) {
+		t.Fatalf("got %q err %v", got, err)
+	}
+	// 往回拷贝越界、长度对不上
+	for _, bad := range [][]byte{{4, 3<<2 | 1, 9}, {5, 0, 'a'}} {
+		if _, err := snappyDecode(bad, 0); err == nil {
+			t.Fatalf("%v 应报错", bad)
+		}
+	}
+	// 与测试写入器互逆
+	in := []byte(strings.Repeat("2024-06-03,600000,7.05;", 50))
+	if got, err := snappyDecode(snappyEncode(in), len(in)); err != nil || !bytes.Equal(got, in) {
+		t.Fatalf("roundtrip err %v", err)
+	}
+}
+
+func TestReadHybrid(t *testing.T) {
+	// 规范里的例子：0..7 位宽 3 bit-packed
+	got, err := readHybrid([]byte{3, 0x88, 0xc6, 0xfa}, 3, 8)
+	if err != nil || !reflect.DeepEqual(got, []uint32{0, 1, 2, 3, 4, 5, 6, 7}) {
+		t.Fatalf("got %v err %v", got, err)
+	}
+	// RLE：5 个 300（位宽 9 → 2 字节）
+	got, err = readHybrid([]byte{10, 0x2c, 0x01}, 9, 5)
+	if err != nil || !reflect.DeepEqual(got, []uint32{300, 300, 300, 300, 300}) {
+		t.Fatalf("got %v err %v", got, err)
+	}
+	if _, err := readHybrid([]byte{3, 0x88}, 3, 8); err == nil {
+		t.Fatal("数据不够应报错")
+	}
+}
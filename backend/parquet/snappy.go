@@ -0,0 +1,84 @@
+package parquet
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// ============================================================
+// Snappy 块格式解压（Parquet 的 SNAPPY 编解码器用裸块，不带 framing）。
+// 格式：varint 原始长度，之后是一串元素；标签字节低 2 位区分
+// 字面量（0）和 1/2/4 字节偏移的回溯拷贝（1/2/3），拷贝允许与输出重叠。
+// ============================================================
+
+var errSnappy = errors.New("parquet: snappy 数据损坏")
+
+// snappyDecode 解压 src；want > 0 时校验解压后的长度（页头里的 uncompressed_page_size）。
+func snappyDecode(src []byte, want int) ([]byte, error) {
+	n, k := binary.Uvarint(src)
+	if k <= 0 || n > 1<<31 || (want > 0 && int(n) != want) {
+		return nil, errSnappy
+	}
+	dst := make([]byte, 0, n)
+	s := k
+	for s < len(src) {
+		tag := src[s]
+		s++
+		var length, offset int
+		switch tag & 3 {
+		case 0: // 字面量
+			length = int(tag >> 2)
+			if length >= 60 {
+				extra := length - 59 // 1~4 字节小端长度
+				if s+extra > len(src) {
+					return nil, errSnappy
+				}
+				length = 0
+				for i := extra - 1; i >= 0; i-- {
+					length = length<<8 | int(src[s+i])
+				}
+				s += extra
+			}
+			length++
+			if length > len(src)-s || len(dst)+length > int(n) {
+				return nil, errSnappy
+			}
+			dst = append(dst, src[s:s+length]...)
+			s += length
+			continue
+		case 1:
+			if s >= len(src) {
+				return nil, errSnappy
+			}
+			length = 4 + int(tag>>2&7)
+			offset = int(tag&0xe0)<<3 | int(src[s])
+			s++
+		case 2:
+			if s+2 > len(src) {
+				return nil, errSnappy
+			}
+			length = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint16(src[s:]))
+			s += 2
+		case 3:
+			if s+4 > len(src) {
+				return nil, errSnappy
+			}
+			length = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint32(src[s:]))
+			s += 4
+		}
+		if offset <= 0 || offset > len(dst) || len(dst)+length > int(n) {
+			return nil, errSnappy
+		}
+		// 逐字节拷贝：offset < length 时是重复前面的片段
+		from := len(dst) - offset
+		for i := 0; i < length; i++ {
+			dst = append(dst, dst[from+i])
+		}
+	}
+	if len(dst) != int(n) {
+		return nil, errSnappy
+	}
+	return dst, nil
+}
@@ -0,0 +1,223 @@
+package parquet
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ============================================================
+// Thrift Compact Protocol 解码（只读）。
+// Parquet 的文件尾（FileMetaData）和每个页头（PageHeader）都是这种编码。
+// 不生成代码：解成 fields（字段 ID → 值）这种通用结构，再按需取字段，
+// 不认识的字段（新版本加的统计信息、加密信息……）自然被忽略。
+// ============================================================
+
+// compact 协议的类型编号
+const (
+	tBoolTrue  = 1
+	tBoolFalse = 2
+	tByte      = 3
+	tI16       = 4
+	tI32       = 5
+	tI64       = 6
+	tDouble    = 7
+	tBinary    = 8
+	tList      = 9
+	tSet       = 10
+	tMap       = 11
+	tStruct    = 12
+)
+
+// maxDepth 嵌套层数上限，防止损坏的文件把栈吃光。
+const maxDepth = 64
+
+var errShort = errors.New("parquet: thrift 数据不完整")
+
+// fields 一个 struct：字段 ID → 值（bool / int64 / float64 / []byte / []any / fields）。
+type fields map[int16]any
+
+func (f fields) i64(id int16) int64 {
+	v, _ := f[id].(int64)
+	return v
+}
+
+func (f fields) has(id int16) bool {
+	_, ok := f[id]
+	return ok
+}
+
+func (f fields) str(id int16) string {
+	b, _ := f[id].([]byte)
+	return string(b)
+}
+
+func (f fields) boolean(id int16, def bool) bool {
+	if v, ok := f[id].(bool); ok {
+		return v
+	}
+	return def
+}
+
+func (f fields) sub(id int16) fields {
+	v, _ := f[id].(fields)
+	return v
+}
+
+func (f fields) list(id int16) []any {
+	v, _ := f[id].([]any)
+	return v
+}
+
+// thriftReader 在一段内存上解码，pos 之后是未读部分。
+type thriftReader struct {
+	b   []byte
+	pos int
+}
+
+// readStruct 解一个 struct，返回后 pos 指向它后面的第一个字节。
+func (r *thriftReader) readStruct(depth int) (fields, error) {
+	if depth > maxDepth {
+		return nil, errors.New("parquet: thrift 嵌套过深")
+	}
+	out := fields{}
+	var last int16
+	for {
+		h, err := r.byte()
+		if err != nil {
+			return nil, err
+		}
+		if h == 0 { // STOP
+			return out, nil
+		}
+		typ := h & 0x0f
+		id := last + int16(h>>4)
+		if h>>4 == 0 { // 字段 ID 不是增量，后面跟一个 zigzag i16
+			v, err := r.varint()
+			if err != nil {
+				return nil, err
+			}
+			id = int16(unzigzag(v))
+		}
+		last = id
+		v, err := r.value(typ, depth)
+		if err != nil {
+			return nil, err
+		}
+		out[id] = v
+	}
+}
+
+func (r *thriftReader) value(typ byte, depth int) (any, error) {
+	switch typ {
+	case tBoolTrue:
+		return true, nil
+	case tBoolFalse:
+		return false, nil
+	case tByte:
+		b, err := r.byte()
+		return int64(int8(b)), err
+	case tI16, tI32, tI64:
+		v, err := r.varint()
+		return unzigzag(v), err
+	case tDouble:
+		if r.pos+8 > len(r.b) {
+			return nil, errShort
+		}
+		v := math.Float64frombits(binary.LittleEndian.Uint64(r.b[r.pos:]))
+		r.pos += 8
+		return v, nil
+	case tBinary:
+		n, err := r.varint()
+		if err != nil {
+			return nil, err
+		}
+		if n > uint64(len(r.b)-r.pos) {
+			return nil, errShort
+		}
+		v := r.b[r.pos : r.pos+int(n)]
+		r.pos += int(n)
+		return v, nil
+	case tList, tSet:
+		return r.list(depth)
+	case tMap:
+		return r.skipMap(depth)
+	case tStruct:
+		return r.readStruct(depth + 1)
+	}
+	return nil, fmt.Errorf("parquet: 未知的 thrift 类型 %d", typ)
+}
+
+// list 元素里的布尔值每个占一个字节（1 真 2 假），和字段头里的写法不同。
+func (r *thriftReader) list(depth int) (any, error) {
+	h, err := r.byte()
+	if err != nil {
+		return nil, err
+	}
+	n, et := uint64(h>>4), h&0x0f
+	if n == 15 {
+		if n, err = r.varint(); err != nil {
+			return nil, err
+		}
+	}
+	if n > uint64(len(r.b)-r.pos) { // 每个元素至少一个字节
+		return nil, errShort
+	}
+	out := make([]any, 0, n)
+	for i := uint64(0); i < n; i++ {
+		var v any
+		if et == tBoolTrue || et == tBoolFalse {
+			b, err := r.byte()
+			if err != nil {
+				return nil, err
+			}
+			v = b == tBoolTrue
+		} else if v, err = r.value(et, depth+1); err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+// skipMap FileMetaData 里用不到 map，读过去即可。
+func (r *thriftReader) skipMap(depth int) (any, error) {
+	n, err := r.varint()
+	if err != nil || n == 0 {
+		return nil, err
+	}
+	kv, err := r.byte()
+	if err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < n; i++ {
+		if _, err := r.value(kv>>4, depth+1); err != nil {
+			return nil, err
+		}
+		if _, err := r.value(kv&0x0f, depth+1); err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+func (r *thriftReader) byte() (byte, error) {
+	if r.pos >= len(r.b) {
+		return 0, errShort
+	}
+	b := r.b[r.pos]
+	r.pos++
+	return b, nil
+}
+
+func (r *thriftReader) varint() (uint64, error) {
+	v, n := binary.Uvarint(r.b[r.pos:])
+	if n <= 0 {
+		return 0, errShort
+	}
+	r.pos += n
+	return v, nil
+}
+
+func unzigzag(v uint64) int64 { return int64(v>>1) ^ -int64(v&1) }
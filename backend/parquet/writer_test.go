@@ -0,0 +1,458 @@
+package parquet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"math"
+	"os"
+	"testing"
+)
+
+// ============================================================
+// 测试用的最小 Parquet 写入器：按规范手写文件，用来造各种编码 / 压缩 / 页版本的样本。
+// 写法照 parquet-mr / pyarrow：字段头用增量 ID，字典页在数据页之前，
+// 元数据里带上读取器应当忽略的 key_value_metadata 和 statistics。
+// ============================================================
+
+// tenc Thrift Compact 编码。
+type tenc struct {
+	buf  bytes.Buffer
+	last []int16
+}
+
+func (e *tenc) uvarint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	e.buf.Write(b[:binary.PutUvarint(b[:], v)])
+}
+
+func zigzag(v int64) uint64 { return uint64(v<<1) ^ uint64(v>>63) }
+
+func (e *tenc) begin() { e.last = append(e.last, 0) }
+
+func (e *tenc) end() {
+	e.buf.WriteByte(0)
+	e.last = e.last[:len(e.last)-1]
+}
+
+func (e *tenc) field(id int16, typ byte) {
+	l := &e.last[len(e.last)-1]
+	if d := id - *l; d > 0 && d <= 15 {
+		e.buf.WriteByte(byte(d)<<4 | typ)
+	} else {
+		e.buf.WriteByte(typ)
+		e.uvarint(zigzag(int64(id)))
+	}
+	*l = id
+}
+
+func (e *tenc) i32(id int16, v int64) { e.field(id, tI32); e.uvarint(zigzag(v)) }
+func (e *tenc) i64(id int16, v int64) { e.field(id, tI64); e.uvarint(zigzag(v)) }
+
+func (e *tenc) bin(id int16, b []byte) {
+	e.field(id, tBinary)
+	e.uvarint(uint64(len(b)))
+	e.buf.Write(b)
+}
+
+func (e *tenc) boolean(id int16, v bool) {
+	if v {
+		e.field(id, tBoolTrue)
+	} else {
+		e.field(id, tBoolFalse)
+	}
+}
+
+func (e *tenc) strct(id int16) { e.field(id, tStruct); e.begin() }
+
+func (e *tenc) list(id int16, n int, et byte) {
+	e.field(id, tList)
+	if n < 15 {
+		e.buf.WriteByte(byte(n)<<4 | et)
+	} else {
+		e.buf.WriteByte(0xf0 | et)
+		e.uvarint(uint64(n))
+	}
+}
+
+// tcol 一列样本。values 里 nil 为 NULL；类型按 phys：bool / int32 / int64 / [12]byte / float32 / float64 / string。
+type tcol struct {
+	name     string
+	phys     int
+	typeLen  int
+	optional bool
+	conv     int64         // ConvertedType，-1 不写
+	scale    int64         // DECIMAL
+	logical  func(e *tenc) // 写 LogicalType 联合体的内容，nil 不写
+	dict     bool          // 字典编码
+	values   []any
+}
+
+type topts struct {
+	codec     int64
+	v2        bool
+	groupRows int // 每个行组的行数
+	pageRows  int // 每个数据页的行数
+}
+
+func plainValues(c tcol, vals []any) []byte {
+	var b bytes.Buffer
+	if c.phys == typeBoolean {
+		packed := make([]byte, (len(vals)+7)/8)
+		for i, v := range vals {
+			if v.(bool) {
+				packed[i/8] |= 1 << (i % 8)
+			}
+		}
+		return packed
+	}
+	for _, v := range vals {
+		switch x := v.(type) {
+		case int32:
+			binary.Write(&b, binary.LittleEndian, x)
+		case int64:
+			binary.Write(&b, binary.LittleEndian, x)
+		case float32:
+			binary.Write(&b, binary.LittleEndian, math.Float32bits(x))
+		case float64:
+			binary.Write(&b, binary.LittleEndian, math.Float64bits(x))
+		case [12]byte:
+			b.Write(x[:])
+		case []byte: // FIXED_LEN_BYTE_ARRAY
+			b.Write(x)
+		case string:
+			binary.Write(&b, binary.LittleEndian, uint32(len(x)))
+			b.WriteString(x)
+		}
+	}
+	return b.Bytes()
+}
+
+// hybrid RLE / bit-packed 混合编码：连续 8 个以上相同的值写 RLE，其余每 8 个一组 bit-pack。
+func hybrid(vals []uint32, width int) []byte {
+	var e tenc
+	for i := 0; i < len(vals); {
+		run := 1
+		for i+run < len(vals) && vals[i+run] == vals[i] {
+			run++
+		}
+		if run >= 8 {
+			e.uvarint(uint64(run) << 1)
+			for k := 0; k < (width+7)/8; k++ {
+				e.buf.WriteByte(byte(vals[i] >> (8 * k)))
+			}
+			i += run
+			continue
+		}
+		group := make([]byte, width) // 8 个值 × width 位
+		for j := 0; j < 8 && i+j < len(vals); j++ {
+			for k := 0; k < width; k++ {
+				if vals[i+j]>>k&1 == 1 {
+					bit := j*width + k
+					group[bit/8] |= 1 << (bit % 8)
+				}
+			}
+		}
+		e.uvarint(1<<1 | 1)
+		e.buf.Write(group)
+		i += 8
+	}
+	return e.buf.Bytes()
+}
+
+// snappyEncode 贪心找 ≥4 字节的重复（哈希表记每个 4 字节串最近的位置），产出字面量 + 2 字节偏移拷贝。
+func snappyEncode(src []byte) []byte {
+	var e tenc
+	e.uvarint(uint64(len(src)))
+	lit := 0
+	flush := func(end int) {
+		for lit < end {
+			n := end - lit
+			if n > 60 {
+				n = 60
+			}
+			e.buf.WriteByte(byte(n-1) << 2)
+			e.buf.Write(src[lit : lit+n])
+			lit += n
+		}
+	}
+	last := map[uint32]int{}
+	for i := 0; i+4 <= len(src); {
+		key := binary.LittleEndian.Uint32(src[i:])
+		j, ok := last[key]
+		last[key] = i
+		if !ok || i-j > 65535 {
+			i++
+			continue
+		}
+		n := 4
+		for i+n < len(src) && n < 64 && src[j+n] == src[i+n] {
+			n++
+		}
+		flush(i)
+		e.buf.WriteByte(byte(n-1)<<2 | 2)
+		binary.Write(&e.buf, binary.LittleEndian, uint16(i-j))
+		i += n
+		lit = i
+	}
+	flush(len(src))
+	return e.buf.Bytes()
+}
+
+func compress(t *testing.T, codec int64, b []byte) []byte {
+	switch codec {
+	case 1:
+		return snappyEncode(b)
+	case 2:
+		var out bytes.Buffer
+		zw := gzip.NewWriter(&out)
+		zw.Write(b)
+		zw.Close()
+		return out.Bytes()
+	}
+	return b
+}
+
+func pageHeader(typ int64, ulen, clen int, body func(e *tenc)) []byte {
+	var e tenc
+	e.begin()
+	e.i32(1, typ)
+	e.i32(2, int64(ulen))
+	e.i32(3, int64(clen))
+	body(&e)
+	e.end()
+	return e.buf.Bytes()
+}
+
+// writeChunk 写一个列块，返回 ColumnMetaData 需要的偏移与大小。
+func writeChunk(t *testing.T, out *bytes.Buffer, c tcol, vals []any, opt topts) (dictOff, dataOff, ulen, clen int64, encs []int64) {
+	start := int64(out.Len())
+	var dict []any
+	index := map[any]uint32{}
+	if c.dict {
+		for _, v := range vals {
+			if v == nil {
+				continue
+			}
+			if _, ok := index[v]; !ok {
+				index[v] = uint32(len(dict))
+				dict = append(dict, v)
+			}
+		}
+		raw := plainValues(c, dict)
+		comp := compress(t, opt.codec, raw)
+		dictOff = start
+		out.Write(pageHeader(pageDictionary, len(raw), len(comp), func(e *tenc) {
+			e.strct(7)
+			e.i32(1, int64(len(dict)))
+			e.i32(2, encPlainDictionary)
+			e.end()
+		}))
+		out.Write(comp)
+		ulen += int64(len(raw))
+		encs = append(encs, encPlainDictionary)
+	}
+	dataOff = int64(out.Len())
+	step := opt.pageRows
+	if step <= 0 {
+		step = len(vals)
+	}
+	for a := 0; a < len(vals); a += step {
+		b := a + step
+		if b > len(vals) {
+			b = len(vals)
+		}
+		page := vals[a:b]
+		var defs []byte
+		var present []any
+		levels := make([]uint32, len(page))
+		nulls := 0
+		for i, v := range page {
+			if v != nil {
+				levels[i] = 1
+				present = append(present, v)
+			} else {
+				nulls++
+			}
+		}
+		if c.optional {
+			defs = hybrid(levels, 1)
+		}
+		var values []byte
+		enc := int64(encPlain)
+		if c.dict {
+			enc = encRLEDictionary
+			idx := make([]uint32, len(present))
+			for i, v := range present {
+				idx[i] = index[v]
+			}
+			w := bitWidth(len(dict) - 1)
+			values = append([]byte{byte(w)}, hybrid(idx, w)...)
+		} else if c.phys == typeBoolean && opt.v2 {
+			enc = encRLE
+			bits := make([]uint32, len(present))
+			for i, v := range present {
+				if v.(bool) {
+					bits[i] = 1
+				}
+			}
+			h := hybrid(bits, 1)
+			values = binary.LittleEndian.AppendUint32(nil, uint32(len(h)))
+			values = append(values, h...)
+		} else {
+			values = plainValues(c, present)
+		}
+		if opt.v2 {
+			comp := compress(t, opt.codec, values)
+			out.Write(pageHeader(pageDataV2, len(defs)+len(values), len(defs)+len(comp), func(e *tenc) {
+				e.strct(8)
+				e.i32(1, int64(len(page)))
+				e.i32(2, int64(nulls))
+				e.i32(3, int64(len(page)))
+				e.i32(4, enc)
+				e.i32(5, int64(len(defs)))
+				e.i32(6, 0)
+				e.end()
+			}))
+			out.Write(defs)
+			out.Write(comp)
+			ulen += int64(len(defs) + len(values))
+		} else {
+			var raw []byte
+			if c.optional {
+				raw = binary.LittleEndian.AppendUint32(raw, uint32(len(defs)))
+				raw = append(raw, defs...)
+			}
+			raw = append(raw, values...)
+			comp := compress(t, opt.codec, raw)
+			out.Write(pageHeader(pageData, len(raw), len(comp), func(e *tenc) {
+				e.strct(5)
+				e.i32(1, int64(len(page)))
+				e.i32(2, enc)
+				e.i32(3, encRLE)
+				e.i32(4, encRLE)
+				e.end()
+			}))
+			out.Write(comp)
+			ulen += int64(len(raw))
+		}
+		encs = append(encs, enc)
+	}
+	clen = int64(out.Len()) - start
+	return
+}
+
+// writeParquet 把 cols 写成 path，按 opt 切行组和数据页。
+func writeParquet(t *testing.T, path string, cols []tcol, opt topts) {
+	t.Helper()
+	rows := len(cols[0].values)
+	if opt.groupRows <= 0 {
+		opt.groupRows = rows
+	}
+	var out bytes.Buffer
+	out.Write(magic)
+
+	type chunk struct {
+		dictOff, dataOff, ulen, clen int64
+		encs                         []int64
+		n                            int
+	}
+	var groups [][]chunk
+	for a := 0; a < rows; a += opt.groupRows {
+		b := a + opt.groupRows
+		if b > rows {
+			b = rows
+		}
+		var g []chunk
+		for _, c := range cols {
+			d, o, u, l, encs := writeChunk(t, &out, c, c.values[a:b], opt)
+			g = append(g, chunk{d, o, u, l, encs, b - a})
+		}
+		groups = append(groups, g)
+	}
+
+	var e tenc
+	e.begin()
+	e.i32(1, 1)
+	e.list(2, len(cols)+1, tStruct)
+	e.begin()
+	e.bin(4, []byte("schema"))
+	e.i32(5, int64(len(cols)))
+	e.end()
+	for _, c := range cols {
+		e.begin()
+		e.i32(1, int64(c.phys))
+		if c.typeLen > 0 {
+			e.i32(2, int64(c.typeLen))
+		}
+		if c.optional {
+			e.i32(3, 1)
+		} else {
+			e.i32(3, 0)
+		}
+		e.bin(4, []byte(c.name))
+		if c.conv >= 0 {
+			e.i32(6, c.conv)
+		}
+		if c.scale > 0 {
+			e.i32(7, c.scale)
+			e.i32(8, 18)
+		}
+		if c.logical != nil {
+			e.strct(10)
+			c.logical(&e)
+			e.end()
+		}
+		e.end()
+	}
+	e.i64(3, int64(rows))
+	e.list(4, len(groups), tStruct)
+	for _, g := range groups {
+		e.begin()
+		e.list(1, len(g), tStruct)
+		for i, ch := range g {
+			e.begin()
+			e.i64(2, ch.dataOff)
+			e.strct(3)
+			e.i32(1, int64(cols[i].phys))
+			e.list(2, len(ch.encs), tI32)
+			for _, enc := range ch.encs {
+				e.uvarint(zigzag(enc))
+			}
+			e.list(3, 1, tBinary)
+			e.uvarint(uint64(len(cols[i].name)))
+			e.buf.WriteString(cols[i].name)
+			e.i32(4, opt.codec)
+			e.i64(5, int64(ch.n))
+			e.i64(6, ch.ulen)
+			e.i64(7, ch.clen)
+			e.i64(9, ch.dataOff)
+			if cols[i].dict {
+				e.i64(11, ch.dictOff)
+			}
+			e.strct(12) // statistics：读取器应忽略
+			e.bin(5, []byte("max"))
+			e.bin(6, []byte("min"))
+			e.end()
+			e.end()
+			e.end()
+		}
+		e.i64(2, 0)
+		e.i64(3, int64(g[0].n))
+		e.end()
+	}
+	e.list(5, 1, tStruct) // key_value_metadata（pandas 会写一段 JSON）
+	e.begin()
+	e.bin(1, []byte("pandas"))
+	e.bin(2, []byte(`{"index_columns": []}`))
+	e.end()
+	e.bin(6, []byte("oh-my-stock test writer"))
+	e.end()
+
+	out.Write(e.buf.Bytes())
+	binary.Write(&out, binary.LittleEndian, uint32(e.buf.Len()))
+	out.Write(magic)
+	if err := os.WriteFile(path, out.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -8,7 +8,8 @@
 //	  "exclude": [<condition>, ...]    // 全部不满足
 //	}
 //
-// 14 类 condition（见 compileOne）。详见 presets.go 中预设的写法。
+// 14 类 condition（见 compileOne），以及算术表达式条件 expr（见 expr.go）。
+// 详见 presets.go 中预设的写法。
 package presets
 
 import (
@@ -27,6 +28,7 @@ type expression struct {
 type CompileResult struct {
 	Where string        // WHERE 子句（不含 WHERE 关键字），保证非空
 	Args  []interface{} // 占位符参数
+	Lags  []string      // 需追加到 ranked CTE 的列（expr 条件里的 REF），可能为空
 }
 
 // Compile 把 JSONB 表达式编译成 WHERE 子句。
@@ -44,9 +46,10 @@ func Compile(exprJSON []byte) (CompileResult, error) {
 
 	parts := []string{"1=1"}
 	args := []interface{}{}
+	var lags []string
 	idx := 1
 	for _, c := range e.All {
-		sql, newArgs, used, err := compileOne(c, idx)
+		sql, newArgs, used, err := compileCond(c, idx, &lags)
 		if err != nil {
 			return CompileResult{}, fmt.Errorf("all: %w", err)
 		}
@@ -58,7 +61,7 @@ func Compile(exprJSON []byte) (CompileResult, error) {
 		idx += used
 	}
 	for _, c := range e.Exclude {
-		sql, newArgs, used, err := compileOne(c, idx)
+		sql, newArgs, used, err := compileCond(c, idx, &lags)
 		if err != nil {
 			return CompileResult{}, fmt.Errorf("exclude: %w", err)
 		}
@@ -70,7 +73,21 @@ func Compile(exprJSON []byte) (CompileResult, error) {
 		idx += used
 	}
 	where := strings.ReplaceAll(strings.Join(parts, " AND "), "ranked.", "latest.")
-	return CompileResult{Where: where, Args: args}, nil
+	return CompileResult{Where: where, Args: args, Lags: lags}, nil
+}
+
+// compileCond 分派：expr 条件可能额外需要 ranked CTE 列，收集到 lags（去重）。
+func compileCond(c map[string]interface{}, idx int, lags *[]string) (string, []interface{}, int, error) {
+	if t, _ := c["type"].(string); t != "expr" {
+		return compileOne(c, idx)
+	}
+	sql, args, used, extra, err := compileExpr(c, idx)
+	for _, l := range extra {
+		if !contains(*lags, l) {
+			*lags = append(*lags, l)
+		}
+	}
+	return sql, args, used, err
 }
 
 // compileOne 返回 (sql, args, placeholder_count, error)
@@ -132,7 +149,7 @@ func compileOne(c map[string]interface{}, idx int) (string, []interface{}, int,
 			fastCol, slowCol, fastCol, opSQL, slowCol), nil, 0, nil
 
 	case "close_vs_ma":
-		// 收盘价 vs 某条均线：ma=ma5/ma10/ma20/ma60，op=gt/gte/lt/lte
+		// 收盘价 vs 某条均线：ma=ma5/ma10/ma20/ma60/ma120/ma250，op=gt/gte/lt/lte
 		ma, _ := c["ma"].(string)
 		op, _ := c["op"].(string)
 		maCol, err := resolveField(ma)
@@ -425,7 +442,7 @@ func resolveField(name string) (string, error) {
 		return "pettm", nil
 	case "pb":
 		return "pb", nil
-	case "ma5", "ma10", "ma20", "ma60":
+	case "ma5", "ma10", "ma20", "ma60", "ma120", "ma250":
 		return name, nil
 	case "macd", "dif", "dea":
 		return name, nil
@@ -435,6 +452,10 @@ func resolveField(name string) (string, error) {
 		return name, nil
 	case "boll_upper", "boll_mid", "boll_lower":
 		return name, nil
+	case "atr14", "obv", "cci14", "wr6", "wr10", "vwap":
+		return name, nil
+	case "pdi", "mdi", "adx", "adxr":
+		return name, nil
 	}
 	return "", fmt.Errorf("unknown field %q", name)
 }
@@ -166,3 +166,21 @@ func TestAllPresets_NoUnknownTypes(t *testing.T) {
 		walk(p.Expression)
 	}
 }
+
+// 扩展指标（ATR/OBV/CCI/WR/DMI/VWAP/MA120/MA250）都能作为 field 条件使用。
+func TestCompile_ExtendedIndicatorFields(t *testing.T) {
+	for _, name := range []string{"ma120", "ma250", "atr14", "obv", "cci14", "wr6", "wr10", "pdi", "mdi", "adx", "adxr", "vwap"} {
+		c := json.RawMessage(`{"all":[{"type":"field","name":"` + name + `","op":"gt","value":1}]}`)
+		r, err := Compile(c)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !strings.Contains(r.Where, "latest."+name+" > $1") {
+			t.Errorf("%s: where = %q", name, r.Where)
+		}
+	}
+	c := json.RawMessage(`{"all":[{"type":"close_vs_ma","ma":"ma250","op":"gt"}]}`)
+	if _, err := Compile(c); err != nil {
+		t.Fatalf("close_vs_ma ma250: %v", err)
+	}
+}
@@ -0,0 +1,255 @@
+package presets
+
+import (
+	"fmt"
+	"strings"
+
+	"oh-my-stock/formula"
+)
+
+// ============================================================
+// expr 条件：算术表达式 / 字段间比较
+//
+//	{"type": "expr", "expr": "close / ma20 > 1.05"}
+//	{"type": "expr", "expr": "(high - low) / close * 100 >= 6"}
+//	{"type": "expr", "expr": "turnover_rate > 2 * ref(turnover_rate, 5)"}
+//
+// 表达式用 formula 包解析（与自定义公式同一套语法），再翻译成 SQL：
+//   - 字段必须过 resolveField 白名单，且在 ranked CTE 中可取到；
+//   - 数字常量一律走占位符，不拼进 SQL；
+//   - 除法翻译为 x / NULLIF(y, 0)，除零得 NULL（条件不成立）而不是报错；
+//   - REF(field, N) 翻译为 ranked CTE 中追加的 LAG 列，N 为 1..MaxExprRef 的整数常量。
+// ============================================================
+
+// MaxExprRef REF 最大回看根数，受 ranked CTE 的回看窗口（LookbackDays 个交易日）限制。
+const MaxExprRef = LookbackDays - 1
+
+// exprSource 表达式可用字段 → ranked CTE 中的来源列（REF 生成 LAG 时使用）。
+// 与 runner.go 中两个 ranked CTE 的 SELECT 列表保持一致。
+func exprSource(col string) (string, bool) {
+	switch col {
+	case "open", "close", "high", "low", "volume", "change_percent", "turnover_rate", "net_amount":
+		return "h." + col, true
+	case "pettm", "pb":
+		return "b." + col, true
+	case "ma5", "ma10", "ma20", "ma60", "ma120", "ma250",
+		"macd", "dif", "dea", "rsi6", "rsi12", "rsi24", "k", "d", "j",
+		"boll_upper", "boll_mid", "boll_lower",
+		"atr14", "obv", "cci14", "wr6", "wr10", "vwap", "pdi", "mdi", "adx", "adxr":
+		return "i." + col, true
+	}
+	return "", false
+}
+
+// exprCompiler 单个 expr 条件的编译状态。
+type exprCompiler struct {
+	idx  int // 下一个占位符编号
+	args []interface{}
+	lags []string // 需要追加到 ranked CTE 的列定义
+}
+
+type exprKind int
+
+const (
+	kindNum exprKind = iota
+	kindBool
+)
+
+// compileExpr 返回 (sql, args, placeholder_count, extra_ranked_columns, error)。
+func compileExpr(c map[string]interface{}, idx int) (string, []interface{}, int, []string, error) {
+	src, _ := c["expr"].(string)
+	if strings.TrimSpace(src) == "" {
+		return "", nil, 0, nil, fmt.Errorf("expr: missing expr")
+	}
+	if len(src) > 500 {
+		return "", nil, 0, nil, fmt.Errorf("expr: too long")
+	}
+	x, err := formula.ParseExpr(src)
+	if err != nil {
+		return "", nil, 0, nil, fmt.Errorf("expr: %w", err)
+	}
+	ec := &exprCompiler{idx: idx}
+	sql, kind, err := ec.compile(x)
+	if err != nil {
+		return "", nil, 0, nil, fmt.Errorf("expr: %w", err)
+	}
+	if kind != kindBool {
+		return "", nil, 0, nil, fmt.Errorf("expr: %q is not a comparison", src)
+	}
+	return sql, ec.args, len(ec.args), ec.lags, nil
+}
+
+func (ec *exprCompiler) placeholder(v float64) string {
+	s := fmt.Sprintf("$%d::numeric", ec.idx)
+	ec.idx++
+	ec.args = append(ec.args, v)
+	return s
+}
+
+func (ec *exprCompiler) compile(x formula.Expr) (string, exprKind, error) {
+	switch n := x.(type) {
+	case *formula.Num:
+		return ec.placeholder(n.Value), kindNum, nil
+
+	case *formula.Ident:
+		col, err := exprField(n.Name)
+		if err != nil {
+			return "", 0, err
+		}
+		return "latest." + col, kindNum, nil
+
+	case *formula.Unary:
+		s, err := ec.num(n.X)
+		if err != nil {
+			return "", 0, err
+		}
+		return "(-" + s + ")", kindNum, nil
+
+	case *formula.Binary:
+		switch n.Op {
+		case "+", "-", "*", "/":
+			l, err := ec.num(n.L)
+			if err != nil {
+				return "", 0, err
+			}
+			r, err := ec.num(n.R)
+			if err != nil {
+				return "", 0, err
+			}
+			if n.Op == "/" {
+				return fmt.Sprintf("(%s / NULLIF(%s, 0))", l, r), kindNum, nil
+			}
+			return fmt.Sprintf("(%s %s %s)", l, n.Op, r), kindNum, nil
+		case ">", "<", ">=", "<=", "=", "<>":
+			l, err := ec.num(n.L)
+			if err != nil {
+				return "", 0, err
+			}
+			r, err := ec.num(n.R)
+			if err != nil {
+				return "", 0, err
+			}
+			return fmt.Sprintf("(%s %s %s)", l, n.Op, r), kindBool, nil
+		case "AND", "OR":
+			l, err := ec.boolean(n.L)
+			if err != nil {
+				return "", 0, err
+			}
+			r, err := ec.boolean(n.R)
+			if err != nil {
+				return "", 0, err
+			}
+			return fmt.Sprintf("(%s %s %s)", l, n.Op, r), kindBool, nil
+		}
+		return "", 0, fmt.Errorf("unsupported operator %s", n.Op)
+
+	case *formula.Call:
+		switch n.Func {
+		case "REF":
+			return ec.ref(n)
+		case "ABS":
+			if len(n.Args) != 1 {
+				return "", 0, fmt.Errorf("ABS needs 1 argument")
+			}
+			s, err := ec.num(n.Args[0])
+			if err != nil {
+				return "", 0, err
+			}
+			return "ABS(" + s + ")", kindNum, nil
+		case "MAX", "MIN":
+			if len(n.Args) != 2 {
+				return "", 0, fmt.Errorf("%s needs 2 arguments", n.Func)
+			}
+			a, err := ec.num(n.Args[0])
+			if err != nil {
+				return "", 0, err
+			}
+			b, err := ec.num(n.Args[1])
+			if err != nil {
+				return "", 0, err
+			}
+			fn := map[string]string{"MAX": "GREATEST", "MIN": "LEAST"}[n.Func]
+			return fmt.Sprintf("%s(%s, %s)", fn, a, b), kindNum, nil
+		case "NOT":
+			if len(n.Args) != 1 {
+				return "", 0, fmt.Errorf("NOT needs 1 argument")
+			}
+			s, err := ec.boolean(n.Args[0])
+			if err != nil {
+				return "", 0, err
+			}
+			return "(NOT " + s + ")", kindBool, nil
+		}
+		return "", 0, fmt.Errorf("unsupported function %s", n.Func)
+	}
+	return "", 0, fmt.Errorf("unsupported expression %s", x)
+}
+
+func (ec *exprCompiler) num(x formula.Expr) (string, error) {
+	s, k, err := ec.compile(x)
+	if err != nil {
+		return "", err
+	}
+	if k != kindNum {
+		return "", fmt.Errorf("%s is a condition, expected a number", x)
+	}
+	return s, nil
+}
+
+func (ec *exprCompiler) boolean(x formula.Expr) (string, error) {
+	s, k, err := ec.compile(x)
+	if err != nil {
+		return "", err
+	}
+	if k != kindBool {
+		return "", fmt.Errorf("%s is a number, expected a condition", x)
+	}
+	return s, nil
+}
+
+// ref REF(field, N)：只接受字段 + 整数常量，翻译为 ranked.<col>_ref<N>。
+func (ec *exprCompiler) ref(n *formula.Call) (string, exprKind, error) {
+	if len(n.Args) != 2 {
+		return "", 0, fmt.Errorf("REF needs 2 arguments")
+	}
+	id, ok := n.Args[0].(*formula.Ident)
+	if !ok {
+		return "", 0, fmt.Errorf("REF: first argument must be a field")
+	}
+	num, ok := n.Args[1].(*formula.Num)
+	if !ok || num.Value != float64(int(num.Value)) || num.Value < 1 || num.Value > MaxExprRef {
+		return "", 0, fmt.Errorf("REF: period must be an integer in 1..%d", MaxExprRef)
+	}
+	col, err := exprField(id.Name)
+	if err != nil {
+		return "", 0, err
+	}
+	src, _ := exprSource(col)
+	alias := fmt.Sprintf("%s_ref%d", col, int(num.Value))
+	def := fmt.Sprintf("LAG(%s, %d) OVER w AS %s", src, int(num.Value), alias)
+	if !contains(ec.lags, def) {
+		ec.lags = append(ec.lags, def)
+	}
+	return "ranked." + alias, kindNum, nil
+}
+
+// exprField 标识符 → 白名单列名（formula 词法已转大写，这里转回小写）。
+func exprField(name string) (string, error) {
+	col, err := resolveField(strings.ToLower(name))
+	if err != nil {
+		return "", err
+	}
+	if _, ok := exprSource(col); !ok {
+		return "", fmt.Errorf("field %q is not available in expressions", strings.ToLower(name))
+	}
+	return col, nil
+}
+
+func contains(ls []string, s string) bool {
+	for _, x := range ls {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+package presets
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func compileExprJSON(t *testing.T, expr string) (CompileResult, error) {
+	t.Helper()
+	b, _ := json.Marshal(map[string]interface{}{
+		"all": []map[string]interface{}{{"type": "expr", "expr": expr}},
+	})
+	return Compile(b)
+}
+
+func TestCompile_ExprFieldRatio(t *testing.T) {
+	r, err := compileExprJSON(t, "close / ma20 > 1.05")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(r.Where, "((latest.close / NULLIF(latest.ma20, 0)) > $1::numeric)") {
+		t.Errorf("where = %q", r.Where)
+	}
+	if len(r.Args) != 1 || r.Args[0] != 1.05 || len(r.Lags) != 0 {
+		t.Errorf("args = %v lags = %v", r.Args, r.Lags)
+	}
+}
+
+func TestCompile_ExprAmplitude(t *testing.T) {
+	r, err := compileExprJSON(t, "(high-low)/close*100 >= 6")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "((((latest.high - latest.low) / NULLIF(latest.close, 0)) * $1::numeric) >= $2::numeric)"
+	if !strings.Contains(r.Where, want) {
+		t.Errorf("where = %q", r.Where)
+	}
+	if len(r.Args) != 2 || r.Args[0] != float64(100) || r.Args[1] != float64(6) {
+		t.Errorf("args = %v", r.Args)
+	}
+}
+
+func TestCompile_ExprRefAddsLag(t *testing.T) {
+	c := json.RawMessage(`{"all":[
+		{"type":"field","name":"close","op":"gt","value":5},
+		{"type":"expr","expr":"turnover_rate > 2 * ref(turnover_rate, 5) and ref(turnover_rate,5) > 0"}
+	]}`)
+	r, err := Compile(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// field 占用 $1，expr 的常量从 $2 开始
+	if !strings.Contains(r.Where, "(latest.turnover_rate > ($2::numeric * latest.turnover_rate_ref5))") {
+		t.Errorf("where = %q", r.Where)
+	}
+	if len(r.Lags) != 1 || r.Lags[0] != "LAG(h.turnover_rate, 5) OVER w AS turnover_rate_ref5" {
+		t.Errorf("lags = %v", r.Lags)
+	}
+	if len(r.Args) != 3 {
+		t.Errorf("args = %v", r.Args)
+	}
+}
+
+func TestCompile_ExprRejectsUnsafeInput(t *testing.T) {
+	bad := []string{
+		"close > 1; DROP TABLE users", // 多余语句
+		"password_hash > 0",           // 不在白名单
+		"in_amount > 0",               // 白名单内但 ranked CTE 里没有
+		"close + 1",                   // 不是条件
+		"close > 1 + (ma5 > ma10)",    // 条件参与算术
+		"ref(close, 0) > 1",           // 周期越界
+		"ref(close, 91) > 1",          // 周期越界
+		"ref(close + 1, 2) > 1",       // REF 只接受字段
+		"ref(close, n) > 1",           // 周期必须是常量
+		"sum(close, 5) > 1",           // 不支持的函数
+		"close > 'x'",                 // 非法字符
+	}
+	for _, e := range bad {
+		if _, err := compileExprJSON(t, e); err == nil {
+			t.Errorf("%q should be rejected", e)
+		}
+	}
+}
+
+func TestCompile_ExprFunctions(t *testing.T) {
+	r, err := compileExprJSON(t, "abs(change_percent) < 2 or not(max(ma5, ma10) <= min(close, open))")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, w := range []string{"ABS(latest.change_percent)", "GREATEST(latest.ma5, latest.ma10)", "LEAST(latest.close, latest.open)", "(NOT "} {
+		if !strings.Contains(r.Where, w) {
+			t.Errorf("missing %q in %q", w, r.Where)
+		}
+	}
+}
@@ -3,6 +3,9 @@ package presets
 import (
 	"encoding/json"
 	"fmt"
+	"time"
+
+	"oh-my-stock/calendar"
 
 	"gorm.io/gorm"
 )
@@ -27,8 +30,32 @@ type RunResult struct {
 	BoardPriority int     `json:"board_priority"`
 }
 
+// LookbackDays ranked CTE 取最近多少个交易日：high_max90 要往前 90 根，再加最新一根。
+const LookbackDays = 91
+
+// qfqHistorySQL 最近 LookbackDays 个交易日的 stock_history_mv（起点由 %s 填入），
+// 开高低收换算成前复权价（见 adjust 包）。
+// 最新一根的系数恒为 1，所以 latest.close 仍是实际收盘价；
+// 窗口谓词（close_lag / high_max 等）跨过除权日时不会再把除权缺口当成下跌或突破。
+const qfqHistorySQL = `
+    SELECT mv.symbol, mv.name, mv.trade_date,
+           mv.open * q.k AS open, mv.close * q.k AS close, mv.high * q.k AS high, mv.low * q.k AS low,
+           mv.volume, mv.change_percent, mv.turnover_rate, mv.net_amount
+    FROM stock_history_mv mv
+    CROSS JOIN LATERAL (
+      SELECT COALESCE((SELECT f.factor FROM stock_adj_factors f
+                        WHERE f.symbol = mv.symbol AND f.ex_date <= mv.trade_date
+                        ORDER BY f.ex_date DESC LIMIT 1), 1)
+           / COALESCE((SELECT f.factor FROM stock_adj_factors f
+                        WHERE f.symbol = mv.symbol
+                        ORDER BY f.ex_date DESC LIMIT 1), 1) AS k
+    ) q
+    WHERE mv.trade_date >= DATE '%s'
+  `
+
 // Run 在 stock_history_mv 上执行预设规则表达式。
-// 最新交易日为基准，向前回溯 30 天用于窗口谓词；上市新股用 basic_info 判断。
+// 最新交易日为基准，按交易日历向前回溯 LookbackDays 个交易日（前复权价）用于窗口谓词；
+// 上市新股用 basic_info 判断。
 //
 // expression 取 Preset.Expression，page/pageSize 简单分页。
 func Run(db *gorm.DB, expression map[string]interface{}, page, pageSize int) ([]RunResult, int64, error) {
@@ -75,6 +102,9 @@ WITH ranked AS (
     i.rsi6, i.rsi12, i.rsi24,
     i.k, i.d, i.j,
     i.boll_upper, i.boll_mid, i.boll_lower,
+    i.ma120, i.ma250,
+    i.atr14, i.obv, i.cci14, i.wr6, i.wr10, i.vwap,
+    i.pdi, i.mdi, i.adx, i.adxr,
     (h.close > h.open) AS yang_lag0,
     LAG(h.close > h.open, 1) OVER w AS yang_lag1,
     LAG(h.close > h.open, 2) OVER w AS yang_lag2,
@@ -114,11 +144,10 @@ WITH ranked AS (
     LAG(i.dif,  1) OVER w AS dif_lag1,
     LAG(i.dea,  1) OVER w AS dea_lag1,
     LAG(i.k,    1) OVER w AS k_lag1,
-    LAG(i.d,    1) OVER w AS d_lag1
-  FROM stock_history_mv h
+    LAG(i.d,    1) OVER w AS d_lag1%s
+  FROM (` + qfqHistorySQL + `) h
   LEFT JOIN stock_basic_info b ON b.symbol = h.symbol
   LEFT JOIN stock_indicators  i ON i.symbol = h.symbol AND i.calc_date = h.trade_date
-  WHERE h.trade_date >= (SELECT MAX(trade_date) FROM stock_history_mv) - INTERVAL '90 days'
   WINDOW w AS (PARTITION BY h.symbol ORDER BY h.trade_date)
 ),
 latest AS (
@@ -145,16 +174,29 @@ WHERE ` + "1=1" + `
 ORDER BY board_priority ASC, latest.change_percent DESC, latest.symbol ASC
 LIMIT %d OFFSET %d`
 
-	q := fmt.Sprintf(baseSQL, compiled.Where, pageSize, (page-1)*pageSize)
+	// expr 条件里的 REF(field, N) 需要额外的 LAG 列
+	extraCols := ""
+	for _, l := range compiled.Lags {
+		extraCols += ",\n    " + l
+	}
+
+	since, err := lookbackStart(db)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	q := fmt.Sprintf(baseSQL, extraCols, since, compiled.Where, pageSize, (page-1)*pageSize)
 
 	// count 走相同的 WHERE
 	countSQL := fmt.Sprintf(`
 WITH ranked AS (
   SELECT
-    h.symbol, h.name, h.trade_date, h.close, h.open, h.volume, h.change_percent, h.turnover_rate, h.net_amount, h.high,
+    h.symbol, h.name, h.trade_date, h.close, h.open, h.volume, h.change_percent, h.turnover_rate, h.net_amount, h.high, h.low,
     b.pettm, b.pb, b.industry, b.market, b.listing_date, b.outstanding_shares, b.total_shares, b.status,
     i.ma5, i.ma10, i.ma20, i.ma60, i.macd, i.dif, i.dea, i.rsi6, i.rsi12, i.rsi24,
     i.k, i.d, i.j, i.boll_upper, i.boll_mid, i.boll_lower,
+    i.ma120, i.ma250, i.atr14, i.obv, i.cci14, i.wr6, i.wr10, i.vwap,
+    i.pdi, i.mdi, i.adx, i.adxr,
     (h.close > h.open) AS yang_lag0,
     LAG(h.close > h.open, 1) OVER w AS yang_lag1,
     LAG(h.close > h.open, 2) OVER w AS yang_lag2,
@@ -194,11 +236,10 @@ WITH ranked AS (
     LAG(i.dif,  1) OVER w AS dif_lag1,
     LAG(i.dea,  1) OVER w AS dea_lag1,
     LAG(i.k,    1) OVER w AS k_lag1,
-    LAG(i.d,    1) OVER w AS d_lag1
-  FROM stock_history_mv h
+    LAG(i.d,    1) OVER w AS d_lag1%s
+  FROM (`+qfqHistorySQL+`) h
   LEFT JOIN stock_basic_info b ON b.symbol = h.symbol
   LEFT JOIN stock_indicators  i ON i.symbol = h.symbol AND i.calc_date = h.trade_date
-  WHERE h.trade_date >= (SELECT MAX(trade_date) FROM stock_history_mv) - INTERVAL '90 days'
   WINDOW w AS (PARTITION BY h.symbol ORDER BY h.trade_date)
 ),
 latest AS (
@@ -208,7 +249,7 @@ latest AS (
 SELECT COUNT(*) FROM latest
 LEFT JOIN stock_basic_info basic ON basic.symbol = latest.symbol
 WHERE `+"1=1"+`
-  AND %s`, compiled.Where)
+  AND %s`, extraCols, since, compiled.Where)
 
 	var total int64
 	if err := db.Raw(countSQL, compiled.Args...).Scan(&total).Error; err != nil {
@@ -225,6 +266,20 @@ WHERE `+"1=1"+`
 	return rows, total, nil
 }
 
+// lookbackStart MV 最新交易日往前 LookbackDays 个交易日，YYYY-MM-DD；MV 为空时取今天。
+// 用交易日历而不是自然日间隔，长假后窗口里的 K 线根数不会变少。
+func lookbackStart(db *gorm.DB) (string, error) {
+	var latest *time.Time
+	if err := db.Raw(`SELECT MAX(trade_date) FROM stock_history_mv`).Scan(&latest).Error; err != nil {
+		return "", fmt.Errorf("latest trade_date: %w", err)
+	}
+	base := time.Now()
+	if latest != nil {
+		base = *latest
+	}
+	return calendar.PrevTradingDay(base, LookbackDays).Format("2006-01-02"), nil
+}
+
 func marshalExpr(e map[string]interface{}) ([]byte, error) {
 	if e == nil {
 		return nil, fmt.Errorf("nil expression")
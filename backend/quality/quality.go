@@ -0,0 +1,185 @@
+// Package quality 日 K 入库前的数据质量校验。
+//
+// 上游偶尔会给出坏数据：最高价低于收盘价、负成交量、同一天两根不同的 K 线、
+// 没有除权除息却超出涨跌幅限制的跳变、不是停牌的零成交日……
+// 这些行一旦入库，会一路污染指标续算、自定义公式和规则匹配。
+// Check 把一批 K 线分成可以入库的和需要隔离的，隔离的带上原因，由管理员复核后放行或丢弃。
+package quality
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"oh-my-stock/adjust"
+	"oh-my-stock/calendar"
+	"oh-my-stock/models"
+)
+
+// Reason 隔离原因。
+type Reason string
+
+const (
+	ReasonDuplicateDate Reason = "duplicate_date"  // 同一交易日出现多根不同的 K 线
+	ReasonOutOfOrder    Reason = "out_of_order"    // 日期早于批次中前面的 K 线
+	ReasonBadPrice      Reason = "bad_price"       // 价格不为正
+	ReasonOHLC          Reason = "ohlc"            // 不满足 low ≤ open/close ≤ high
+	ReasonNegativeVol   Reason = "negative_volume" // 成交量或成交额为负
+	ReasonNonTradingDay Reason = "non_trading_day" // 日期不是交易日
+	ReasonZeroVolume    Reason = "zero_volume"     // 零成交但不是停牌形态
+	ReasonPriceJump     Reason = "price_jump"      // 超出板块涨跌幅限制且没有除权除息
+)
+
+// NewListingDays 上市后前几个交易日不设涨跌幅限制（科创板、创业板、北交所前 5 日；主板首日），统一按 5 日放过。
+const NewListingDays = 5
+
+// priceEps 涨跌停价按分四舍五入，比较时留半分钱余量。
+const priceEps = 0.005
+
+// Issue 一根被隔离的 K 线。
+type Issue struct {
+	Row    models.StockDailyData
+	Reason Reason
+	Detail string
+}
+
+// Context 校验需要的上下文，都可以为空（为空时相应检查放宽）。
+type Context struct {
+	Name        string                        // 股票名称，判断 ST
+	ListingDate *time.Time                    // 上市日期，新股不设涨跌幅
+	Prev        *models.StockDailyData        // 批次第一根之前已入库的最后一根 K 线
+	Actions     []models.StockCorporateAction // 除权除息事件
+}
+
+// LimitPct 板块涨跌幅限制（比例）：主板 10%、ST 5%，创业板、科创板 20%，北交所 30%。
+func LimitPct(symbol, name string) float64 {
+	switch {
+	case strings.HasPrefix(symbol, "300"), strings.HasPrefix(symbol, "301"),
+		strings.HasPrefix(symbol, "688"), strings.HasPrefix(symbol, "689"):
+		return 0.20
+	case strings.HasPrefix(symbol, "4"), strings.HasPrefix(symbol, "8"), strings.HasPrefix(symbol, "92"):
+		return 0.30
+	case strings.Contains(strings.ToUpper(name), "ST"):
+		return 0.05
+	}
+	return 0.10
+}
+
+// Check 按交易日升序校验一批 K 线，返回可以入库的行和需要隔离的行。
+// 完全相同的重复行只保留一根，不算问题。
+func Check(symbol string, rows []models.StockDailyData, c Context) (ok []models.StockDailyData, bad []Issue) {
+	// 同一天多根且内容不同：无法判断哪根是对的，全部隔离
+	byDate := map[string][]int{}
+	for i, r := range rows {
+		d := r.TradeDate.Format("2006-01-02")
+		byDate[d] = append(byDate[d], i)
+	}
+	conflict := map[string]bool{}
+	for d, idx := range byDate {
+		for _, i := range idx[1:] {
+			if !sameBar(rows[idx[0]], rows[i]) {
+				conflict[d] = true
+			}
+		}
+	}
+
+	limit := LimitPct(symbol, c.Name)
+	prev := c.Prev // 最近一根已接受的 K 线，涨跌幅以它为基准
+	var last time.Time
+	seen := map[string]bool{}
+	for _, r := range rows {
+		d := r.TradeDate.Format("2006-01-02")
+		if seen[d] && !conflict[d] {
+			continue
+		}
+		seen[d] = true
+
+		var why Reason
+		var detail string
+		switch {
+		case conflict[d]:
+			why, detail = ReasonDuplicateDate, fmt.Sprintf("%s 有 %d 根不同的 K 线", d, len(byDate[d]))
+		case !last.IsZero() && r.TradeDate.Before(last):
+			why, detail = ReasonOutOfOrder, fmt.Sprintf("%s 排在 %s 之后", d, last.Format("2006-01-02"))
+		default:
+			why, detail = checkBar(r, prev, limit, c)
+		}
+		if r.TradeDate.After(last) {
+			last = r.TradeDate
+		}
+		if why != "" {
+			bad = append(bad, Issue{Row: r, Reason: why, Detail: detail})
+			continue
+		}
+		ok = append(ok, r)
+		p := r
+		prev = &p
+	}
+	return ok, bad
+}
+
+// checkBar 单根 K 线的检查，返回第一个不通过的原因。
+func checkBar(r models.StockDailyData, prev *models.StockDailyData, limit float64, c Context) (Reason, string) {
+	if r.Open <= 0 || r.High <= 0 || r.Low <= 0 || r.Close <= 0 {
+		return ReasonBadPrice, fmt.Sprintf("O=%g H=%g L=%g C=%g", r.Open, r.High, r.Low, r.Close)
+	}
+	if r.Low > math.Min(r.Open, r.Close) || r.High < math.Max(r.Open, r.Close) {
+		return ReasonOHLC, fmt.Sprintf("O=%g H=%g L=%g C=%g", r.Open, r.High, r.Low, r.Close)
+	}
+	if r.Volume < 0 || r.Turnover < 0 {
+		return ReasonNegativeVol, fmt.Sprintf("volume=%d turnover=%g", r.Volume, r.Turnover)
+	}
+	if !calendar.IsTradingDay(r.TradeDate) {
+		return ReasonNonTradingDay, r.TradeDate.Format("2006-01-02") + " 休市"
+	}
+	if r.Volume == 0 && !suspended(r, prev) {
+		return ReasonZeroVolume, fmt.Sprintf("零成交但价格有波动 O=%g H=%g L=%g C=%g", r.Open, r.High, r.Low, r.Close)
+	}
+	if prev == nil || newListing(r.TradeDate, c.ListingDate) {
+		return "", ""
+	}
+	base := prev.Close
+	for _, a := range c.Actions {
+		// 除权除息日当天按参考价计算涨跌停
+		if a.ExDate.After(prev.TradeDate) && !a.ExDate.After(r.TradeDate) {
+			if ref := adjust.RefPrice(base, a); ref > 0 {
+				base = ref
+			}
+		}
+	}
+	// 和 prev 之间隔了几个交易日（中间的 K 线缺失或被隔离）就按几个涨跌停放宽
+	steps := calendar.TradingDaysBetween(prev.TradeDate, r.TradeDate) - 1
+	if steps < 1 {
+		steps = 1
+	}
+	up := round2(base * math.Pow(1+limit, float64(steps)))
+	down := round2(base * math.Pow(1-limit, float64(steps)))
+	if r.High > up+priceEps || r.Low < down-priceEps {
+		return ReasonPriceJump, fmt.Sprintf("基准 %.2f，涨跌停 [%.2f, %.2f]（%.0f%%），实际 L=%g H=%g",
+			base, down, up, limit*100, r.Low, r.High)
+	}
+	return "", ""
+}
+
+// suspended 停牌占位 K 线：零成交、一字且等于前收盘。
+func suspended(r models.StockDailyData, prev *models.StockDailyData) bool {
+	if r.Turnover != 0 || r.Open != r.Close || r.High != r.Close || r.Low != r.Close {
+		return false
+	}
+	return prev == nil || math.Abs(prev.Close-r.Close) < priceEps
+}
+
+func newListing(day time.Time, listing *time.Time) bool {
+	if listing == nil || day.Before(*listing) {
+		return false
+	}
+	return calendar.TradingDaysBetween(*listing, day) <= NewListingDays
+}
+
+func sameBar(a, b models.StockDailyData) bool {
+	return a.Open == b.Open && a.High == b.High && a.Low == b.Low && a.Close == b.Close &&
+		a.Volume == b.Volume && a.Turnover == b.Turnover
+}
+
+func round2(v float64) float64 { return math.Round(v*100) / 100 }
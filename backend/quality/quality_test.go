@@ -0,0 +1,120 @@
+package quality
+
+import (
+	"testing"
+	"time"
+
+	"oh-my-stock/models"
+)
+
+func day(n int) time.Time { return time.Date(2024, 6, n, 0, 0, 0, 0, time.UTC) }
+
+func bar(d int, o, h, l, c float64, vol int64) models.StockDailyData {
+	return models.StockDailyData{Symbol: "600000", TradeDate: day(d), Open: o, High: h, Low: l, Close: c, Volume: vol, Turnover: float64(vol) * c}
+}
+
+func reasons(bad []Issue) map[string]Reason {
+	out := map[string]Reason{}
+	for _, b := range bad {
+		out[b.Row.TradeDate.Format("0102")] = b.Reason
+	}
+	return out
+}
+
+func TestLimitPct(t *testing.T) {
+	cases := []struct {
+		sym, name string
+		want      float64
+	}{
+		{"600000", "浦发银行", 0.10},
+		{"000001", "*ST 某某", 0.05},
+		{"300750", "宁德时代", 0.20},
+		{"688981", "中芯国际", 0.20},
+		{"830799", "艾融软件", 0.30},
+	}
+	for _, c := range cases {
+		if got := LimitPct(c.sym, c.name); got != c.want {
+			t.Errorf("LimitPct(%s, %s) = %v, want %v", c.sym, c.name, got, c.want)
+		}
+	}
+}
+
+func TestCheck_BarConsistency(t *testing.T) {
+	rows := []models.StockDailyData{
+		bar(3, 10, 10.5, 9.8, 10.2, 100),
+		bar(4, 10.2, 10.1, 10, 10.3, 100), // high < close
+		bar(5, 0, 10.5, 10, 10.3, 100),    // 开盘价为 0
+		bar(6, 10.3, 10.5, 10, 10.4, -1),  // 负成交量
+		bar(7, 10.4, 10.6, 10.2, 10.5, 0), // 零成交但有波动
+		bar(10, 10, 10, 10, 10, 100),      // 端午休市
+	}
+	ok, bad := Check("600000", rows, Context{})
+	got := reasons(bad)
+	want := map[string]Reason{"0604": ReasonOHLC, "0605": ReasonBadPrice, "0606": ReasonNegativeVol, "0607": ReasonZeroVolume, "0610": ReasonNonTradingDay}
+	if len(ok) != 1 || len(got) != len(want) {
+		t.Fatalf("ok=%d bad=%v", len(ok), got)
+	}
+	for d, r := range want {
+		if got[d] != r {
+			t.Errorf("%s: got %q want %q", d, got[d], r)
+		}
+	}
+
+	// 停牌占位（零成交一字、等于前收）不算问题
+	susp := bar(4, 10.2, 10.2, 10.2, 10.2, 0)
+	if ok, bad := Check("600000", []models.StockDailyData{rows[0], susp}, Context{}); len(ok) != 2 || len(bad) != 0 {
+		t.Fatalf("停牌 K 线被隔离: %v", bad)
+	}
+}
+
+func TestCheck_DuplicatesAndOrder(t *testing.T) {
+	a := bar(3, 10, 10.5, 9.8, 10.2, 100)
+	b := bar(4, 10.2, 10.6, 10, 10.5, 100)
+	b2 := b
+	b2.Close = 10.4
+	c := bar(5, 10.5, 10.8, 10.3, 10.6, 100)
+
+	ok, bad := Check("600000", []models.StockDailyData{a, a, c, b}, Context{})
+	if len(ok) != 2 || len(bad) != 1 || bad[0].Reason != ReasonOutOfOrder {
+		t.Fatalf("相同重复行只保留一根、乱序隔离: ok=%d bad=%v", len(ok), bad)
+	}
+	ok, bad = Check("600000", []models.StockDailyData{a, b, b2, c}, Context{})
+	if len(ok) != 2 || len(bad) != 2 || bad[0].Reason != ReasonDuplicateDate || bad[1].Reason != ReasonDuplicateDate {
+		t.Fatalf("同日不同 K 线应全部隔离: ok=%d bad=%v", len(ok), bad)
+	}
+}
+
+func TestCheck_PriceJump(t *testing.T) {
+	prev := bar(3, 10, 10, 10, 10, 100)
+	up := bar(4, 10.5, 11, 10.5, 11, 100)       // 主板涨停 11.00，正好
+	over := bar(5, 11.5, 12.2, 11.5, 12.2, 100) // 11 → 12.2 超过 10%
+	next := bar(6, 12, 12.5, 11.9, 12.1, 100)   // 和 11 之间隔了两天，按两个涨停放宽
+
+	ok, bad := Check("600000", []models.StockDailyData{up, over, next}, Context{Prev: &prev})
+	if len(ok) != 2 || len(bad) != 1 || bad[0].Reason != ReasonPriceJump {
+		t.Fatalf("ok=%d bad=%v", len(ok), bad)
+	}
+	// 创业板 20% 不算超限
+	if _, bad := Check("300750", []models.StockDailyData{up, over}, Context{Prev: &prev}); len(bad) != 0 {
+		t.Fatalf("创业板: %v", bad)
+	}
+	// ST 5%
+	if _, bad := Check("600000", []models.StockDailyData{up}, Context{Name: "ST 浦发", Prev: &prev}); len(bad) != 1 {
+		t.Fatal("ST 超过 5% 应隔离")
+	}
+
+	// 10 转 10：参考价 5，除权日收 5.2 不算跌停以下
+	ex := bar(4, 5, 5.3, 4.9, 5.2, 100)
+	if _, bad := Check("600000", []models.StockDailyData{ex}, Context{Prev: &prev}); len(bad) != 1 {
+		t.Fatal("没有除权事件的腰斩应隔离")
+	}
+	acts := []models.StockCorporateAction{{ExDate: day(4), TransferRatio: 1}}
+	if _, bad := Check("600000", []models.StockDailyData{ex}, Context{Prev: &prev, Actions: acts}); len(bad) != 0 {
+		t.Fatalf("有除权事件: %v", bad)
+	}
+	// 新股前 5 个交易日不设涨跌幅
+	listing := day(3)
+	if _, bad := Check("600000", []models.StockDailyData{up, over}, Context{Prev: &prev, ListingDate: &listing}); len(bad) != 0 {
+		t.Fatalf("新股: %v", bad)
+	}
+}
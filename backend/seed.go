@@ -13,7 +13,7 @@ import (
 
 // ============================================================
 // SeedAdmin
-// 启动时如果 ADMIN_USER 不存在则创建
+// 启动时如果 ADMIN_USER 不存在则创建，并确保其有管理员权限
 // 环境变量:
 //   ADMIN_USER  (默认 "admin")
 //   ADMIN_PASS  (默认 "admin123")
@@ -36,6 +36,9 @@ func SeedAdmin(db *gorm.DB) {
 	var existing models.User
 	err := db.Where("username = ?", user).First(&existing).Error
 	if err == nil {
+		if !existing.IsAdmin {
+			db.Model(&existing).Update("is_admin", true)
+		}
 		log.Printf("👤 admin 账号已存在: %s", user)
 		return
 	}
@@ -56,6 +59,7 @@ func SeedAdmin(db *gorm.DB) {
 		Email:        email,
 		Phone:        "admin-" + uuid.New().String()[:8],
 		IsActive:     true,
+		IsAdmin:      true,
 	}
 	if err := db.Create(&u).Error; err != nil {
 		log.Printf("⚠️  seed 创建失败: %v", err)
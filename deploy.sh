@@ -38,8 +38,6 @@ case "$cmd" in
       fi
       sleep 1
     done
-    echo "→ 初始化物化视图"
-    docker compose up init-mv
     echo ""
     echo "✅ 部署完成"
     echo "  前端: http://localhost:5173"
@@ -67,7 +65,6 @@ case "$cmd" in
     echo "→ 强制重建并启动"
     docker compose build --no-cache
     docker compose up -d
-    docker compose up init-mv
     ;;
   frontend)
     echo "→ 仅重新构建前端（容器内 yarn）并让 nginx 重新加载"
@@ -18,16 +18,55 @@ request.interceptors.request.use(config => {
   return config
 })
 
-// 响应拦截：401 / 网络错误统一提示
+// 访问 token 过期后用 refresh token 换一对新的；同时过期的多个请求共用一次刷新
+let refreshing = null
+function refreshToken() {
+  if (!refreshing) {
+    const refresh = localStorage.getItem('refresh_token')
+    refreshing = (refresh
+      ? axios.post(`${API_BASE}/user/token/refresh`, { refresh_token: refresh }).then(res => {
+          localStorage.setItem('token', res.data.token)
+          localStorage.setItem('refresh_token', res.data.refresh_token)
+          return res.data.token
+        })
+      : Promise.reject(new Error('no refresh token'))
+    ).finally(() => { refreshing = null })
+  }
+  return refreshing
+}
+
+function clearLogin() {
+  localStorage.removeItem('token')
+  localStorage.removeItem('refresh_token')
+  localStorage.removeItem('user_id')
+}
+
+// 响应拦截：401 先刷新 token 重试一次，再不行回登录页；网络错误统一提示
 request.interceptors.response.use(
   res => res,
-  err => {
+  async err => {
     const status = err.response?.status
     const msg = err.response?.data?.error || err.message || '网络错误'
+    const cfg = err.config
+    if (status === 401 && cfg && !cfg._retried && localStorage.getItem('refresh_token')) {
+      cfg._retried = true
+      const sent = localStorage.getItem('token')
+      try {
+        const token = await refreshToken()
+        cfg.headers['Authorization'] = `Bearer ${token}`
+        return request(cfg)
+      } catch (e) {
+        // 其他标签页刚刷新过（409）：用它存下的新 token 重试；否则按登录过期处理
+        const latest = localStorage.getItem('token')
+        if (e.response?.status === 409 && latest && latest !== sent) {
+          cfg.headers['Authorization'] = `Bearer ${latest}`
+          return request(cfg)
+        }
+      }
+    }
     if (status === 401) {
       ElMessage.error('登录状态已过期，请重新登录')
-      localStorage.removeItem('token')
-      localStorage.removeItem('user_id')
+      clearLogin()
       if (!window.location.pathname.startsWith('/login')) {
         window.location.href = '/login'
       }
@@ -1,7 +1,8 @@
 """
 compute_indicators.py
 =====================
-读取 stock_daily_data，按 symbol 计算 MA/MACD/KDJ/RSI/BOLL，写入 stock_indicators。
+读取 stock_daily_data，按 symbol 计算 MA/MACD/KDJ/RSI/BOLL 及扩展指标，写入 stock_indicators。
+也是扩展指标上线后的历史回填入口（先执行 create_table.sql 补列）。
 
 技术实现要点：
 - MA(N)        : 收盘价 N 日简单移动平均
@@ -9,6 +10,14 @@ compute_indicators.py
 - KDJ (9,3,3)  : RSV=(C-Low9)/(High9-Low9)*100；K=SMA(RSV,3)；D=SMA(K,3)；J=3K-2D
 - RSI (N)      : N 日相对强弱指标
 - BOLL (20,2)  : MID=MA20；UPPER=MID+2*STD；LOWER=MID-2*STD
+- MA120/MA250  : 半年线 / 年线（数据不足时为 NULL）
+- ATR (14)     : TR=max(H-L,|H-昨收|,|L-昨收|)；ATR=MA(TR,14)
+- OBV          : 收涨累加成交量，收跌累减
+- CCI (14)     : (TP-MA(TP,14))/(0.015*AVEDEV(TP,14))，TP=(H+L+C)/3
+- WR (10,6)    : 100*(HHV(H,N)-C)/(HHV(H,N)-LLV(L,N))
+- DMI (14,6)   : PDI/MDI=SUM(±DM,14)/SUM(TR,14)*100；ADX=MA(DX,6)；ADXR=(ADX+REF(ADX,6))/2
+- VWAP         : 当日成交额/成交量
+与 backend/indicators 包口径一致。
 
 运行: python compute_indicators.py
 依赖: pandas, sqlalchemy, psycopg2-binary, tqdm
@@ -23,6 +32,11 @@ import os
 import sys
 
 
+def _opt(v):
+    """NaN → None（入库为 NULL）。"""
+    return None if pd.isna(v) else float(v)
+
+
 def main():
     cfg_path = os.environ.get("CONFIG_INI", "config.ini")
     config = configparser.ConfigParser()
@@ -44,7 +58,7 @@ def main():
     with engine.begin() as conn:
         for symbol in tqdm(symbols, desc="计算指标"):
             df = pd.read_sql(
-                text("SELECT trade_date, close, high, low, volume FROM stock_daily_data "
+                text("SELECT trade_date, close, high, low, volume, turnover FROM stock_daily_data "
                      "WHERE symbol = :s ORDER BY trade_date ASC"),
                 conn, params={"s": symbol},
                 parse_dates=["trade_date"],
@@ -57,6 +71,8 @@ def main():
             df["ma10"] = df["close"].rolling(10).mean()
             df["ma20"] = df["close"].rolling(20).mean()
             df["ma60"] = df["close"].rolling(60).mean()
+            df["ma120"] = df["close"].rolling(120).mean()
+            df["ma250"] = df["close"].rolling(250).mean()
 
             ema12 = df["close"].ewm(span=12, adjust=False).mean()
             ema26 = df["close"].ewm(span=26, adjust=False).mean()
@@ -78,25 +94,61 @@ def main():
             df["d"] = d_vals
             df["j"] = 3 * df["k"] - 2 * df["d"]
 
+            # 通达信 SMA(X,N,1) 平滑，与 backend/indicators 增量续算口径一致
+            diff = df["close"].diff()
             for n in (6, 12, 24):
-                diff = df["close"].diff()
-                gain = diff.clip(lower=0).rolling(n).mean()
-                loss = (-diff.clip(upper=0)).rolling(n).mean()
-                rs = gain / loss.replace(0, np.nan)
-                df[f"rsi{n}"] = 100 - 100 / (1 + rs)
+                up = diff.clip(lower=0).ewm(alpha=1 / n, adjust=False, min_periods=n).mean()
+                tot = diff.abs().ewm(alpha=1 / n, adjust=False, min_periods=n).mean()
+                df[f"rsi{n}"] = up / tot.replace(0, np.nan) * 100
 
             std20 = df["close"].rolling(20).std()
             df["boll_mid"]   = df["ma20"]
             df["boll_upper"] = df["ma20"] + 2 * std20
             df["boll_lower"] = df["ma20"] - 2 * std20
 
-            keep = ["trade_date",
-                    "ma5","ma10","ma20","ma60",
+            prev_close = df["close"].shift(1)
+            tr = pd.concat([
+                df["high"] - df["low"],
+                (df["high"] - prev_close).abs(),
+                (df["low"] - prev_close).abs(),
+            ], axis=1).max(axis=1)
+            df["atr14"] = tr.rolling(14).mean()
+
+            direction = np.sign(df["close"].diff()).fillna(0)
+            df["obv"] = (direction * df["volume"]).cumsum()
+
+            tp = (df["high"] + df["low"] + df["close"]) / 3
+            avedev = tp.rolling(14).apply(lambda w: np.mean(np.abs(w - w.mean())), raw=True)
+            df["cci14"] = (tp - tp.rolling(14).mean()) / (0.015 * avedev.replace(0, np.nan))
+
+            for n in (6, 10):
+                hh = df["high"].rolling(n).max()
+                ll = df["low"].rolling(n).min()
+                df[f"wr{n}"] = 100 * (hh - df["close"]) / (hh - ll).replace(0, np.nan)
+
+            hd = df["high"].diff()
+            ld = -df["low"].diff()
+            dmp = hd.where((hd > 0) & (hd > ld), 0).where(hd.notna())
+            dmm = ld.where((ld > 0) & (ld > hd), 0).where(ld.notna())
+            tr14 = tr.where(prev_close.notna()).rolling(14).sum().replace(0, np.nan)
+            df["pdi"] = dmp.rolling(14).sum() * 100 / tr14
+            df["mdi"] = dmm.rolling(14).sum() * 100 / tr14
+            dx = (df["mdi"] - df["pdi"]).abs() / (df["mdi"] + df["pdi"]).replace(0, np.nan) * 100
+            df["adx"] = dx.rolling(6).mean()
+            df["adxr"] = (df["adx"] + df["adx"].shift(6)) / 2
+
+            df["vwap"] = df["turnover"] / df["volume"].replace(0, np.nan)
+
+            core = ["ma5","ma10","ma20","ma60",
                     "macd","dif","dea",
                     "k","d","j",
                     "rsi6","rsi12","rsi24",
                     "boll_upper","boll_mid","boll_lower"]
-            df = df[keep].dropna()
+            extra = ["ma120","ma250",
+                     "atr14","obv","cci14","wr6","wr10",
+                     "pdi","mdi","adx","adxr","vwap"]
+            # 只按基础指标丢行；扩展指标（尤其 MA250）窗口不足时写 NULL
+            df = df[["trade_date"] + core + extra].dropna(subset=core)
 
             if df.empty:
                 skipped += 1
@@ -107,15 +159,22 @@ def main():
                 conn.execute(text("""
                     INSERT INTO stock_indicators
                         (symbol, calc_date, ma5, ma10, ma20, ma60, macd, dif, dea,
-                         k, d, j, rsi6, rsi12, rsi24, boll_upper, boll_mid, boll_lower)
+                         k, d, j, rsi6, rsi12, rsi24, boll_upper, boll_mid, boll_lower,
+                         ma120, ma250, atr14, obv, cci14, wr6, wr10, pdi, mdi, adx, adxr, vwap)
                     VALUES (:s,:d,:ma5,:ma10,:ma20,:ma60,:macd,:dif,:dea,
-                            :k,:d,:j,:r6,:r12,:r24,:bu,:bm,:bl)
+                            :k,:d,:j,:r6,:r12,:r24,:bu,:bm,:bl,
+                            :ma120,:ma250,:atr14,:obv,:cci14,:wr6,:wr10,:pdi,:mdi,:adx,:adxr,:vwap)
                     ON CONFLICT (symbol, calc_date) DO UPDATE SET
                         ma5=EXCLUDED.ma5, ma10=EXCLUDED.ma10, ma20=EXCLUDED.ma20, ma60=EXCLUDED.ma60,
                         macd=EXCLUDED.macd, dif=EXCLUDED.dif, dea=EXCLUDED.dea,
                         k=EXCLUDED.k, d=EXCLUDED.d, j=EXCLUDED.j,
                         rsi6=EXCLUDED.rsi6, rsi12=EXCLUDED.rsi12, rsi24=EXCLUDED.rsi24,
-                        boll_upper=EXCLUDED.boll_upper, boll_mid=EXCLUDED.boll_mid, boll_lower=EXCLUDED.boll_lower
+                        boll_upper=EXCLUDED.boll_upper, boll_mid=EXCLUDED.boll_mid, boll_lower=EXCLUDED.boll_lower,
+                        ma120=EXCLUDED.ma120, ma250=EXCLUDED.ma250,
+                        atr14=EXCLUDED.atr14, obv=EXCLUDED.obv, cci14=EXCLUDED.cci14,
+                        wr6=EXCLUDED.wr6, wr10=EXCLUDED.wr10,
+                        pdi=EXCLUDED.pdi, mdi=EXCLUDED.mdi, adx=EXCLUDED.adx, adxr=EXCLUDED.adxr,
+                        vwap=EXCLUDED.vwap
                 """), {
                     "s": symbol,
                     "d": row["trade_date"].date(),
@@ -135,6 +194,7 @@ def main():
                     "bu": float(row["boll_upper"]),
                     "bm": float(row["boll_mid"]),
                     "bl": float(row["boll_lower"]),
+                    **{c: _opt(row[c]) for c in extra},
                 })
             inserted += len(df)
 
@@ -28,11 +28,16 @@ CREATE INDEX IF NOT EXISTS idx_stock_basic_symbol   ON stock_basic_info(symbol);
 CREATE INDEX IF NOT EXISTS idx_stock_basic_industry ON stock_basic_info(industry);
 CREATE INDEX IF NOT EXISTS idx_stock_basic_market   ON stock_basic_info(market);
 
+-- 估值（抓取时由估值表刷新，预设规则里的 pettm / pb 条件读这里）
+ALTER TABLE stock_basic_info
+    ADD COLUMN IF NOT EXISTS pettm DECIMAL(10,4),
+    ADD COLUMN IF NOT EXISTS pb    DECIMAL(10,4);
+
 -- ============================================================
--- 2. 股票日线数据
+-- 2. 股票日线数据（按 trade_date 月分区，见第 17 节）
 -- ============================================================
 CREATE TABLE IF NOT EXISTS stock_daily_data (
-    id               SERIAL PRIMARY KEY,
+    id               SERIAL,
     symbol           VARCHAR(10) NOT NULL,
     trade_date       DATE        NOT NULL,
     open             DECIMAL(12,4),
@@ -49,10 +54,10 @@ CREATE TABLE IF NOT EXISTS stock_daily_data (
     pb               DECIMAL(10,4),
     amplitude        DECIMAL(10,4),
     created_at       TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id, trade_date),
     CONSTRAINT uk_stock_daily UNIQUE (symbol, trade_date)
-);
-CREATE INDEX IF NOT EXISTS idx_stock_daily_symbol ON stock_daily_data(symbol);
-CREATE INDEX IF NOT EXISTS idx_stock_daily_date   ON stock_daily_data(trade_date);
+) PARTITION BY RANGE (trade_date);
+CREATE INDEX IF NOT EXISTS idx_stock_daily_date ON stock_daily_data(trade_date);
 
 -- ============================================================
 -- 3. 股票财务数据
@@ -82,16 +87,18 @@ CREATE INDEX IF NOT EXISTS idx_stock_financial_symbol ON stock_financial_data(sy
 CREATE INDEX IF NOT EXISTS idx_stock_financial_date   ON stock_financial_data(report_date);
 
 -- ============================================================
--- 4. 股票技术指标（MA/MACD/KDJ/RSI/BOLL）
+-- 4. 股票技术指标（MA/MACD/KDJ/RSI/BOLL + ATR/OBV/CCI/WR/DMI/VWAP，按 calc_date 月分区）
 -- ============================================================
 CREATE TABLE IF NOT EXISTS stock_indicators (
-    id         SERIAL PRIMARY KEY,
+    id         SERIAL,
     symbol     VARCHAR(10) NOT NULL,
     calc_date  DATE        NOT NULL,
     ma5        DECIMAL(12,4),
     ma10       DECIMAL(12,4),
     ma20       DECIMAL(12,4),
     ma60       DECIMAL(12,4),
+    ma120      DECIMAL(12,4),                       -- 半年线
+    ma250      DECIMAL(12,4),                       -- 年线
     macd       DECIMAL(12,4),
     dif        DECIMAL(12,4),
     dea        DECIMAL(12,4),
@@ -104,17 +111,65 @@ CREATE TABLE IF NOT EXISTS stock_indicators (
     boll_upper DECIMAL(12,4),
     boll_mid   DECIMAL(12,4),
     boll_lower DECIMAL(12,4),
+    atr14      DECIMAL(12,4),                       -- ATR(14)
+    obv        DECIMAL(20,4),                       -- 能量潮（股），量级远超 12 位
+    cci14      DECIMAL(12,4),                       -- CCI(14)
+    wr6        DECIMAL(12,4),                       -- WR(6)
+    wr10       DECIMAL(12,4),                       -- WR(10)
+    pdi        DECIMAL(12,4),                       -- DMI +DI(14)
+    mdi        DECIMAL(12,4),                       -- DMI -DI(14)
+    adx        DECIMAL(12,4),                       -- DMI ADX(14,6)
+    adxr       DECIMAL(12,4),                       -- DMI ADXR(14,6)
+    vwap       DECIMAL(12,4),                       -- 当日成交均价
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id, calc_date),
     CONSTRAINT uk_stock_indicators UNIQUE (symbol, calc_date)
+) PARTITION BY RANGE (calc_date);
+CREATE INDEX IF NOT EXISTS idx_stock_indicators_date ON stock_indicators(calc_date);
+
+-- 存量库升级：补齐扩展指标列，随后用 compute_indicators.py 回填历史
+ALTER TABLE stock_indicators
+    ADD COLUMN IF NOT EXISTS ma120 DECIMAL(12,4),
+    ADD COLUMN IF NOT EXISTS ma250 DECIMAL(12,4),
+    ADD COLUMN IF NOT EXISTS atr14 DECIMAL(12,4),
+    ADD COLUMN IF NOT EXISTS obv   DECIMAL(20,4),
+    ADD COLUMN IF NOT EXISTS cci14 DECIMAL(12,4),
+    ADD COLUMN IF NOT EXISTS wr6   DECIMAL(12,4),
+    ADD COLUMN IF NOT EXISTS wr10  DECIMAL(12,4),
+    ADD COLUMN IF NOT EXISTS pdi   DECIMAL(12,4),
+    ADD COLUMN IF NOT EXISTS mdi   DECIMAL(12,4),
+    ADD COLUMN IF NOT EXISTS adx   DECIMAL(12,4),
+    ADD COLUMN IF NOT EXISTS adxr  DECIMAL(12,4),
+    ADD COLUMN IF NOT EXISTS vwap  DECIMAL(12,4);
+
+-- 递推类指标（EMA/KDJ/RSI/OBV）续算状态，每只股票一行；删掉即触发全量重算
+CREATE TABLE IF NOT EXISTS stock_indicator_state (
+    symbol      VARCHAR(10) PRIMARY KEY,
+    last_date   DATE NOT NULL,              -- 状态对应的最后一根已定型 K 线
+    last_close  DECIMAL(12,4) NOT NULL,     -- 该 K 线收盘价，对不上即视为历史改写
+    bars        INTEGER NOT NULL,           -- 累计参与递推的 K 线根数
+    window_from DATE,                       -- 续算窗口的第一根，窗口内补进 / 删掉 K 线即视为历史改写
+    ema12       DOUBLE PRECISION,
+    ema26       DOUBLE PRECISION,
+    dea         DOUBLE PRECISION,
+    k           DOUBLE PRECISION,
+    d           DOUBLE PRECISION,
+    rsi6_up     DOUBLE PRECISION,
+    rsi6_abs    DOUBLE PRECISION,
+    rsi12_up    DOUBLE PRECISION,
+    rsi12_abs   DOUBLE PRECISION,
+    rsi24_up    DOUBLE PRECISION,
+    rsi24_abs   DOUBLE PRECISION,
+    obv         DOUBLE PRECISION,
+    updated_at  TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
-CREATE INDEX IF NOT EXISTS idx_stock_indicators_symbol ON stock_indicators(symbol);
-CREATE INDEX IF NOT EXISTS idx_stock_indicators_date   ON stock_indicators(calc_date);
+ALTER TABLE stock_indicator_state ADD COLUMN IF NOT EXISTS window_from DATE;
 
 -- ============================================================
--- 5. 股票资金流（按 symbol+date 唯一）
+-- 5. 股票资金流（按 symbol+date 唯一，按 trade_date 月分区）
 -- ============================================================
 CREATE TABLE IF NOT EXISTS stock_money_flow (
-    id                SERIAL PRIMARY KEY,
+    id                SERIAL,
     symbol            VARCHAR(10) NOT NULL,
     trade_date        DATE        NOT NULL,
     main_net          DECIMAL(20,4),
@@ -123,10 +178,10 @@ CREATE TABLE IF NOT EXISTS stock_money_flow (
     medium_order_ratio DECIMAL(10,4),
     small_order_ratio  DECIMAL(10,4),
     created_at        TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id, trade_date),
     CONSTRAINT uk_stock_money_flow UNIQUE (symbol, trade_date)
-);
-CREATE INDEX IF NOT EXISTS idx_stock_money_flow_symbol ON stock_money_flow(symbol);
-CREATE INDEX IF NOT EXISTS idx_stock_money_flow_date   ON stock_money_flow(trade_date);
+) PARTITION BY RANGE (trade_date);
+CREATE INDEX IF NOT EXISTS idx_stock_money_flow_date ON stock_money_flow(trade_date);
 
 -- ============================================================
 -- 6. 股票资金流榜单（全市场排行、含 TimeSpan 维度）
@@ -187,9 +242,13 @@ CREATE TABLE IF NOT EXISTS users (
     email         VARCHAR(100) UNIQUE,
     phone         VARCHAR(20)  UNIQUE,
     is_active     BOOLEAN      DEFAULT TRUE,
+    is_admin      BOOLEAN      NOT NULL DEFAULT FALSE,  -- 可访问 /api/v1/admin
     created_at    TIMESTAMP    DEFAULT CURRENT_TIMESTAMP,
     updated_at    TIMESTAMP    DEFAULT CURRENT_TIMESTAMP
 );
+ALTER TABLE users ADD COLUMN IF NOT EXISTS is_admin BOOLEAN NOT NULL DEFAULT FALSE;
+-- 「退出所有设备」的时间：早于它签发、不带会话的老 token 失效（见 24. 登录会话）
+ALTER TABLE users ADD COLUMN IF NOT EXISTS tokens_revoked_at TIMESTAMP;
 
 -- 自动更新 updated_at
 CREATE OR REPLACE FUNCTION set_updated_at()
@@ -228,10 +287,13 @@ CREATE TABLE IF NOT EXISTS user_stock_rules (
     user_id         UUID         NOT NULL,
     rule_name       VARCHAR(100) NOT NULL,
     rule_expression JSONB        NOT NULL DEFAULT '{}'::jsonb,
+    notify_on_match BOOLEAN      NOT NULL DEFAULT TRUE, -- 命中时写通知（见第 18 节）
     created_at      TIMESTAMP    DEFAULT CURRENT_TIMESTAMP,
     updated_at      TIMESTAMP    DEFAULT CURRENT_TIMESTAMP,
     CONSTRAINT uk_user_rule UNIQUE (user_id, rule_name)
 );
+-- 存量库升级：默认打开，已有规则照常通知
+ALTER TABLE user_stock_rules ADD COLUMN IF NOT EXISTS notify_on_match BOOLEAN NOT NULL DEFAULT TRUE;
 CREATE INDEX IF NOT EXISTS idx_user_rule_user     ON user_stock_rules(user_id);
 CREATE INDEX IF NOT EXISTS idx_rule_expr_gin      ON user_stock_rules USING gin (rule_expression);
 
@@ -244,5 +306,386 @@ END $$;
 
 -- ============================================================
 -- 11. 物化视图：stock_history_mv（日线 + 指标 + 资金流 三表对齐）
---     由 scripts/refresh_mv.py 负责创建/刷新
+--     定义在 backend/fetcher/history_mv.go，后端启动时按版本创建/重建，
+--     每批写入后 REFRESH CONCURRENTLY；版本和刷新结果记在 mv_meta
+-- ============================================================
+CREATE TABLE IF NOT EXISTS mv_meta (
+    name            VARCHAR(63)  PRIMARY KEY,
+    version         INT          NOT NULL,
+    refreshed_at    TIMESTAMP,                    -- 最近一次成功刷新（或重建）完成时间
+    refresh_ms      INT          NOT NULL DEFAULT 0,
+    source_max_date DATE,                         -- 刷新开始时 stock_daily_data 的最大交易日
+    mv_max_date     DATE,                         -- 视图里的最大交易日
+    mv_rows         BIGINT       NOT NULL DEFAULT 0,
+    last_error      TEXT,
+    last_error_at   TIMESTAMP,
+    updated_at      TIMESTAMP    NOT NULL DEFAULT NOW()
+);
+
+-- ============================================================
+-- 12. 用户自定义指标公式（通达信风格，见 backend/formula）
+-- ============================================================
+CREATE TABLE IF NOT EXISTS user_formulas (
+    id          SERIAL PRIMARY KEY,
+    user_id     UUID         NOT NULL,
+    name        VARCHAR(50)  NOT NULL,              -- 统一大写，规则里用 formula:NAME 引用
+    source      TEXT         NOT NULL,
+    description VARCHAR(200),
+    created_at  TIMESTAMP    DEFAULT CURRENT_TIMESTAMP,
+    updated_at  TIMESTAMP    DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT uk_user_formula UNIQUE (user_id, name)
+);
+CREATE INDEX IF NOT EXISTS idx_user_formula_user ON user_formulas(user_id);
+
+DO $$ BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_trigger WHERE tgname = 'trg_user_formulas_updated_at') THEN
+        CREATE TRIGGER trg_user_formulas_updated_at BEFORE UPDATE ON user_formulas
+        FOR EACH ROW EXECUTE FUNCTION set_updated_at();
+    END IF;
+END $$;
+
+-- 公式输出线在每只股票最新交易日的取值（每条输出一行，随日 K 刷新覆盖）
+CREATE TABLE IF NOT EXISTS user_formula_values (
+    formula_id  INT          NOT NULL REFERENCES user_formulas(id) ON DELETE CASCADE,
+    symbol      VARCHAR(10)  NOT NULL,
+    output      VARCHAR(50)  NOT NULL,
+    trade_date  DATE         NOT NULL,
+    value       DOUBLE PRECISION,                   -- 窗口不足等无效值为 NULL
+    input_hash  BIGINT       NOT NULL DEFAULT 0,    -- 求值时输入 K 线的指纹，没变就不重算
+    updated_at  TIMESTAMP    DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (formula_id, symbol, output)
+);
+
+-- 存量库升级：旧行指纹为 0，下次抓取时重算一次
+ALTER TABLE user_formula_values
+    ADD COLUMN IF NOT EXISTS input_hash BIGINT NOT NULL DEFAULT 0;
+
+-- ============================================================
+-- 13. 复权：除权除息事件 + 后复权累计因子（见 backend/adjust）
+--     日 K 原样存不复权价，读取时按因子换算前/后复权价
+-- ============================================================
+CREATE TABLE IF NOT EXISTS stock_corporate_actions (
+    symbol          VARCHAR(10)   NOT NULL,
+    ex_date         DATE          NOT NULL,         -- 除权除息日
+    cash_dividend   DECIMAL(12,6) DEFAULT 0,        -- 每股派现(元，税前)
+    bonus_ratio     DECIMAL(12,6) DEFAULT 0,        -- 每股送股
+    transfer_ratio  DECIMAL(12,6) DEFAULT 0,        -- 每股转增
+    rights_ratio    DECIMAL(12,6) DEFAULT 0,        -- 每股配股
+    rights_price    DECIMAL(12,4) DEFAULT 0,        -- 配股价
+    source          VARCHAR(20),
+    created_at      TIMESTAMP     DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (symbol, ex_date)
+);
+
+-- 只在除权除息日记一行：自 ex_date 起的 K 线后复权价 = 原始价 × factor
+CREATE TABLE IF NOT EXISTS stock_adj_factors (
+    symbol   VARCHAR(10)      NOT NULL,
+    ex_date  DATE             NOT NULL,
+    factor   DOUBLE PRECISION NOT NULL,
+    PRIMARY KEY (symbol, ex_date)
+);
+
+-- ============================================================
+-- 14. 后台任务运行记录（见 backend/jobs）
+-- ============================================================
+CREATE TABLE IF NOT EXISTS job_runs (
+    id            BIGSERIAL    PRIMARY KEY,
+    job_name      VARCHAR(50)  NOT NULL,
+    trigger       VARCHAR(20)  NOT NULL,          -- schedule / manual / startup / retry
+    triggered_by  VARCHAR(64),                    -- 手动触发的 users.id
+    scheduled_for TIMESTAMP,                      -- 定时触发的计划时刻（多副本去重）
+    instance      VARCHAR(100),                   -- 运行所在副本（主机名:pid）
+    status        VARCHAR(20)  NOT NULL,          -- running / success / failed / canceled
+    started_at    TIMESTAMP    NOT NULL,
+    finished_at   TIMESTAMP,
+    processed     INT          NOT NULL DEFAULT 0,
+    failed        INT          NOT NULL DEFAULT 0,
+    error         TEXT
+);
+ALTER TABLE job_runs ADD COLUMN IF NOT EXISTS scheduled_for TIMESTAMP;
+ALTER TABLE job_runs ADD COLUMN IF NOT EXISTS instance      VARCHAR(100);
+ALTER TABLE job_runs ADD COLUMN IF NOT EXISTS retry_of      BIGINT;       -- 只重试失败股票时指向原运行
+CREATE INDEX IF NOT EXISTS idx_job_runs_name ON job_runs(job_name, id DESC);
+-- 多副本同一计划时刻只有一个能插入（手动触发 scheduled_for 为 NULL，不受限）
+CREATE UNIQUE INDEX IF NOT EXISTS uk_job_runs_slot ON job_runs(job_name, scheduled_for);
+
+-- 按股票采集的任务每次运行中每只股票的状态（见 jobs.Progress.ForEachSymbol）
+CREATE TABLE IF NOT EXISTS ingest_symbols (
+    run_id     BIGINT      NOT NULL REFERENCES job_runs(id) ON DELETE CASCADE,
+    symbol     VARCHAR(10) NOT NULL,
+    status     VARCHAR(10) NOT NULL,              -- pending / ok / failed / skipped
+    attempts   INT         NOT NULL DEFAULT 0,    -- 累计处理次数（重试运行沿用上一轮）
+    last_error TEXT,
+    updated_at TIMESTAMP   NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (run_id, symbol)
+);
+CREATE INDEX IF NOT EXISTS idx_ingest_symbols_status ON ingest_symbols(run_id, status);
+
+-- ============================================================
+-- 15. 日 K 数据质量隔离（见 backend/quality）
+-- ============================================================
+CREATE TABLE IF NOT EXISTS stock_daily_quarantine (
+    id          BIGSERIAL      PRIMARY KEY,
+    symbol      VARCHAR(10)    NOT NULL,
+    trade_date  DATE           NOT NULL,
+    open        DECIMAL(12,4),
+    high        DECIMAL(12,4),
+    low         DECIMAL(12,4),
+    close       DECIMAL(12,4),
+    volume      BIGINT,
+    turnover    DECIMAL(20,4),
+    reason      VARCHAR(30)    NOT NULL,          -- ohlc / bad_price / negative_volume / duplicate_date / out_of_order / non_trading_day / zero_volume / price_jump
+    detail      TEXT,
+    source      VARCHAR(30),                      -- fetch / import
+    status      VARCHAR(10)    NOT NULL,          -- pending / admitted / rejected
+    reviewed_by VARCHAR(64),
+    reviewed_at TIMESTAMP,
+    created_at  TIMESTAMP      NOT NULL DEFAULT NOW(),
+    updated_at  TIMESTAMP      NOT NULL DEFAULT NOW()
+);
+-- 同一根 K 线待复核的只留一条，重复抓到时更新
+CREATE UNIQUE INDEX IF NOT EXISTS uk_quarantine_pending ON stock_daily_quarantine(symbol, trade_date) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_quarantine_status ON stock_daily_quarantine(status, id DESC);
+
+-- 日 K 缺失的交易日及补抓结果（见 backend/fetcher/gaps.go）
+CREATE TABLE IF NOT EXISTS stock_daily_missing (
+    symbol      VARCHAR(10)  NOT NULL,
+    trade_date  DATE         NOT NULL,
+    status      VARCHAR(12)  NOT NULL,            -- missing / filled / quarantined / unavailable
+    attempts    INT          NOT NULL DEFAULT 0,
+    last_error  TEXT,
+    updated_at  TIMESTAMP    NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (symbol, trade_date)
+);
+CREATE INDEX IF NOT EXISTS idx_daily_missing_status ON stock_daily_missing(status);
+
+-- ============================================================
+-- 16. 数据保留与归档（见 backend/fetcher/retention.go、archive.go）
 -- ============================================================
+-- 过期整月归档出去的文件，restore 子命令按它找文件
+CREATE TABLE IF NOT EXISTS archive_files (
+    id          BIGSERIAL    PRIMARY KEY,
+    table_name  VARCHAR(63)  NOT NULL,
+    month       DATE         NOT NULL,            -- 该月 1 日
+    path        TEXT         NOT NULL,
+    rows        BIGINT       NOT NULL,
+    bytes       BIGINT       NOT NULL,
+    sha256      CHAR(64)     NOT NULL,
+    created_at  TIMESTAMP    NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_archive_files_month ON archive_files(table_name, month);
+
+-- 装回的区间在 hold_until 之前不再裁剪
+CREATE TABLE IF NOT EXISTS retention_holds (
+    id          BIGSERIAL    PRIMARY KEY,
+    table_name  VARCHAR(63)  NOT NULL,
+    from_date   DATE         NOT NULL,
+    to_date     DATE         NOT NULL,
+    hold_until  TIMESTAMP    NOT NULL,
+    created_at  TIMESTAMP    NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_retention_holds_table ON retention_holds(table_name, hold_until);
+
+-- ============================================================
+-- 17. 月份分区（见 backend/fetcher/partitions.go）
+-- ============================================================
+-- stock_daily_data / stock_indicators / stock_money_flow 每月一个分区 <表名>_pYYYYMM，没有 DEFAULT 分区。
+-- 这里先建最近 15 个月到之后 3 个月，后端的 partitions 任务每天补建之后的月份；导入更早的历史时导入命令自己建。
+-- 唯一约束 (symbol, 日期) 同时充当 symbol 索引。老库（普通表）用 oh-my-stock partition migrate 转换。
+DO $$
+DECLARE
+    t TEXT;
+    m DATE;
+BEGIN
+    FOREACH t IN ARRAY ARRAY['stock_daily_data', 'stock_indicators', 'stock_money_flow'] LOOP
+        CONTINUE WHEN (SELECT relkind FROM pg_class WHERE oid = to_regclass(t)) <> 'p';
+        FOR m IN SELECT generate_series(date_trunc('month', CURRENT_DATE) - INTERVAL '15 months',
+                                        date_trunc('month', CURRENT_DATE) + INTERVAL '3 months',
+                                        INTERVAL '1 month')::date LOOP
+            EXECUTE format('CREATE TABLE IF NOT EXISTS %I PARTITION OF %I FOR VALUES FROM (%L) TO (%L)',
+                           t || '_p' || to_char(m, 'YYYYMM'), t, m, (m + INTERVAL '1 month')::date);
+        END LOOP;
+    END LOOP;
+END $$;
+
+-- ============================================================
+-- 18. 规则命中通知（见 backend/notify）
+-- ============================================================
+-- rule_check 任务用最新交易日快照匹配规则，同一 (用户, 规则, 股票, 交易日) 只写一条；
+-- 价格提醒触发的通知 rule_id 为空、alert_id 指向 stock_alerts（见第 21 节），不受该唯一约束限制
+CREATE TABLE IF NOT EXISTS notifications (
+    id          SERIAL       PRIMARY KEY,
+    user_id     UUID         NOT NULL,
+    rule_id     INT,                              -- user_stock_rules.id，规则删除后通知保留
+    alert_id    INT,                              -- stock_alerts.id，提醒删除后通知保留
+    rule_name   VARCHAR(100),                     -- 冗余，规则删除 / 改名后历史通知仍可读
+    symbol      VARCHAR(10)  NOT NULL,
+    stock_name  VARCHAR(50),
+    symbols     JSONB        NOT NULL DEFAULT '[]'::jsonb,  -- 合并通知包含的全部股票，symbol 是其中涨幅最大的一只
+    trade_date  DATE         NOT NULL,
+    title       VARCHAR(200) NOT NULL,
+    message     TEXT,
+    is_read     BOOLEAN      NOT NULL DEFAULT FALSE,
+    created_at  TIMESTAMP    NOT NULL DEFAULT NOW(),
+    CONSTRAINT uk_notification UNIQUE (user_id, rule_id, symbol, trade_date)
+);
+CREATE INDEX IF NOT EXISTS idx_notif_user_id     ON notifications(user_id, id DESC);
+CREATE INDEX IF NOT EXISTS idx_notif_user_unread ON notifications(user_id) WHERE NOT is_read;
+-- 老库：价格提醒的通知没有规则
+ALTER TABLE notifications ALTER COLUMN rule_id DROP NOT NULL;
+ALTER TABLE notifications ADD COLUMN IF NOT EXISTS alert_id INT;
+-- 老库：合并通知
+ALTER TABLE notifications ADD COLUMN IF NOT EXISTS symbols JSONB NOT NULL DEFAULT '[]'::jsonb;
+
+-- ============================================================
+-- 19. 通知外发渠道与投递日志（见 backend/notify/channels.go、deliver.go）
+-- ============================================================
+-- 用户自己的渠道：webhook / email / wecom / dingtalk / feishu，config 存 url、secret、to
+CREATE TABLE IF NOT EXISTS notification_channels (
+    id          SERIAL       PRIMARY KEY,
+    user_id     UUID         NOT NULL,
+    name        VARCHAR(50)  NOT NULL,
+    type        VARCHAR(20)  NOT NULL CHECK (type IN ('webhook', 'email', 'wecom', 'dingtalk', 'feishu')),
+    config      JSONB        NOT NULL DEFAULT '{}'::jsonb,
+    enabled     BOOLEAN      NOT NULL DEFAULT TRUE,
+    created_at  TIMESTAMP    NOT NULL DEFAULT NOW(),
+    updated_at  TIMESTAMP    NOT NULL DEFAULT NOW(),
+    CONSTRAINT uk_channel_user_name UNIQUE (user_id, name)
+);
+
+-- 规则命中推送到哪些渠道；规则或渠道删除时绑定一并删除
+CREATE TABLE IF NOT EXISTS rule_channels (
+    rule_id     INT NOT NULL REFERENCES user_stock_rules(id) ON DELETE CASCADE,
+    channel_id  INT NOT NULL REFERENCES notification_channels(id) ON DELETE CASCADE,
+    PRIMARY KEY (rule_id, channel_id)
+);
+CREATE INDEX IF NOT EXISTS idx_rule_channels_channel ON rule_channels(channel_id);
+
+-- 投递日志兼重试队列：pending 到 next_attempt_at 后由 rule_check / notify_deliver 任务发送；
+-- notification_id 为空的是测试发送
+CREATE TABLE IF NOT EXISTS notification_deliveries (
+    id               SERIAL      PRIMARY KEY,
+    user_id          UUID        NOT NULL,
+    channel_id       INT         NOT NULL REFERENCES notification_channels(id) ON DELETE CASCADE,
+    notification_id  INT         REFERENCES notifications(id) ON DELETE CASCADE,
+    status           VARCHAR(10) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'sent', 'failed')),
+    attempts         INT         NOT NULL DEFAULT 0,
+    last_error       TEXT        NOT NULL DEFAULT '',
+    response_code    INT         NOT NULL DEFAULT 0,
+    next_attempt_at  TIMESTAMP   NOT NULL DEFAULT NOW(),
+    sent_at          TIMESTAMP,
+    created_at       TIMESTAMP   NOT NULL DEFAULT NOW(),
+    updated_at       TIMESTAMP   NOT NULL DEFAULT NOW(),
+    CONSTRAINT uk_delivery UNIQUE (notification_id, channel_id)
+);
+CREATE INDEX IF NOT EXISTS idx_delivery_user    ON notification_deliveries(user_id, id DESC);
+CREATE INDEX IF NOT EXISTS idx_delivery_pending ON notification_deliveries(next_attempt_at) WHERE status = 'pending';
+
+-- ============================================================
+-- 20. 实时事件（见 backend/events）
+-- ============================================================
+-- 推给前端 SSE 的事件：写入后 NOTIFY user_events，各副本读出新行按用户扇出；
+-- 同时是断线重连按 Last-Event-ID 补发的来源，purge 任务清理 3 天前的
+CREATE TABLE IF NOT EXISTS user_events (
+    id          BIGSERIAL    PRIMARY KEY,
+    user_id     UUID,                              -- NULL = 发给所有在线用户
+    type        VARCHAR(30)  NOT NULL,             -- notification / ingest / alert / digest
+    data        JSONB        NOT NULL DEFAULT '{}'::jsonb,
+    created_at  TIMESTAMP    NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_user_events_user    ON user_events(user_id, id);
+CREATE INDEX IF NOT EXISTS idx_user_events_created ON user_events(created_at);
+
+-- ============================================================
+-- 21. 价格 / 指标提醒（见 backend/alerts）
+-- ============================================================
+-- 单只股票的提醒：新 K 线入库后评估，触发写 notifications（alert_id）和 user_events（alert），
+-- 设了 channel_id 的再排一条外发投递。repeat=false 触发后 active 置 false；
+-- repeat=true 距 last_triggered_at 满 cooldown_minutes 才能再次触发
+CREATE TABLE IF NOT EXISTS stock_alerts (
+    id                 SERIAL        PRIMARY KEY,
+    user_id            UUID          NOT NULL,
+    symbol             VARCHAR(10)   NOT NULL,
+    kind               VARCHAR(20)   NOT NULL CHECK (kind IN ('price_cross', 'pct_move', 'volume_spike', 'rsi_zone', 'boll_touch')),
+    direction          VARCHAR(10)   NOT NULL,            -- above / below / up / down / any / upper / lower
+    threshold          DECIMAL(16,4) NOT NULL,            -- 价位 / 涨跌幅% / 量能倍数 / RSI 值；boll_touch 不用
+    period             INT           NOT NULL DEFAULT 0,  -- rsi_zone 的 RSI 周期 6 / 12 / 24
+    ref_close          DECIMAL(12,4),                     -- pct_move 的参考收盘价，NULL = 前一交易日收盘
+    channel_id         INT           REFERENCES notification_channels(id) ON DELETE SET NULL,
+    note               VARCHAR(200)  NOT NULL DEFAULT '',
+    repeat             BOOLEAN       NOT NULL DEFAULT FALSE,
+    cooldown_minutes   INT           NOT NULL DEFAULT 0 CHECK (cooldown_minutes >= 0),
+    active             BOOLEAN       NOT NULL DEFAULT TRUE,
+    last_triggered_at  TIMESTAMP,
+    trigger_count      INT           NOT NULL DEFAULT 0,
+    created_at         TIMESTAMP     NOT NULL DEFAULT NOW(),
+    updated_at         TIMESTAMP     NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_stock_alerts_user   ON stock_alerts(user_id, id DESC);
+CREATE INDEX IF NOT EXISTS idx_stock_alerts_symbol ON stock_alerts(symbol) WHERE active;
+
+-- ============================================================
+-- 22. 收盘日报（见 backend/digest）
+-- ============================================================
+-- daily_digest 任务收盘后每个用户每个交易日生成一份，重新生成时按 (user_id, trade_date) 覆盖正文，
+-- 邮件状态保留，已发送的不重发
+CREATE TABLE IF NOT EXISTS daily_digests (
+    id            SERIAL        PRIMARY KEY,
+    user_id       UUID          NOT NULL,
+    trade_date    DATE          NOT NULL,
+    title         VARCHAR(200)  NOT NULL,
+    summary       JSONB         NOT NULL,                -- 结构化内容（市场概况 / 规则命中 / 自选股 / 提醒）
+    markdown      TEXT          NOT NULL,
+    html          TEXT          NOT NULL,
+    email_status  VARCHAR(10)   NOT NULL DEFAULT '',     -- '' 没发过 / sent / failed
+    email_error   TEXT          NOT NULL DEFAULT '',
+    emailed_at    TIMESTAMP,
+    created_at    TIMESTAMP     NOT NULL DEFAULT NOW(),
+    updated_at    TIMESTAMP     NOT NULL DEFAULT NOW(),
+    CONSTRAINT uk_daily_digest UNIQUE (user_id, trade_date)
+);
+
+-- 日报设置：没有记录 = 生成、不发邮件；email_to 为空发到 users.email
+CREATE TABLE IF NOT EXISTS digest_settings (
+    user_id     UUID          PRIMARY KEY,
+    enabled     BOOLEAN       NOT NULL DEFAULT TRUE,
+    email       BOOLEAN       NOT NULL DEFAULT FALSE,
+    email_to    VARCHAR(200)  NOT NULL DEFAULT '',
+    updated_at  TIMESTAMP     NOT NULL DEFAULT NOW()
+);
+
+-- ============================================================
+-- 23. 通知策略（见 backend/notify/policy.go）
+-- ============================================================
+-- 每个用户一行，没有记录 = 不免打扰、每条规则每天 50 条、逐只通知、持续命中每天都通知
+CREATE TABLE IF NOT EXISTS notification_policies (
+    user_id             UUID         PRIMARY KEY,
+    quiet_start         VARCHAR(5)   NOT NULL DEFAULT '',   -- 免打扰 HH:MM（上海时间），空 = 不免打扰；可以跨零点
+    quiet_end           VARCHAR(5)   NOT NULL DEFAULT '',
+    max_per_rule_daily  INT          NOT NULL DEFAULT 50 CHECK (max_per_rule_daily BETWEEN 1 AND 500),
+    group_hits          BOOLEAN      NOT NULL DEFAULT FALSE, -- 一条规则一轮的命中合成一条通知
+    new_entries_only    BOOLEAN      NOT NULL DEFAULT FALSE, -- 前一交易日已命中的股票不通知
+    updated_at          TIMESTAMP    NOT NULL DEFAULT NOW()
+);
+
+-- ============================================================
+-- 24. 登录会话（见 backend/auth）
+-- ============================================================
+-- 每次登录一行；refresh token 只存 SHA-256，每次刷新轮换，上一个留在 prev_hash 里识别重放
+CREATE TABLE IF NOT EXISTS user_sessions (
+    id             UUID          PRIMARY KEY,
+    user_id        UUID          NOT NULL,
+    refresh_hash   CHAR(64)      NOT NULL,
+    prev_hash      CHAR(64)      NOT NULL DEFAULT '',
+    rotated_at     TIMESTAMP,
+    user_agent     VARCHAR(300)  NOT NULL DEFAULT '',
+    ip             VARCHAR(64)   NOT NULL DEFAULT '',
+    created_at     TIMESTAMP     NOT NULL DEFAULT NOW(),
+    last_used_at   TIMESTAMP     NOT NULL DEFAULT NOW(),
+    expires_at     TIMESTAMP     NOT NULL,              -- 每次刷新顺延 jwt.ttl_hours
+    revoked_at     TIMESTAMP,
+    revoke_reason  VARCHAR(20)   NOT NULL DEFAULT ''    -- logout / logout_all / revoked / reuse
+);
+CREATE UNIQUE INDEX IF NOT EXISTS uk_user_sessions_refresh ON user_sessions (refresh_hash);
+CREATE INDEX IF NOT EXISTS idx_user_sessions_prev ON user_sessions (prev_hash) WHERE prev_hash <> '';
+CREATE INDEX IF NOT EXISTS idx_user_sessions_user ON user_sessions (user_id, last_used_at DESC);
@@ -1,17 +1,18 @@
 """
 refresh_mv.py
 =============
-1) 创建 stock_history_mv 物化视图（如果不存在）
-2) 增量刷新（如已存在，带 CONCURRENTLY）
+手动 CONCURRENTLY 刷新 stock_history_mv，并把结果写进 mv_meta。
+视图的定义和创建/重建归后端管（backend/fetcher/history_mv.go，启动时的 history_mv 任务），
+采集批次结束后后端也会自动刷新；这里只在脚本直接写库（get_*.py、compute_indicators.py）后补一次。
 运行: python refresh_mv.py
 """
 import configparser
 import os
 import sys
+import time
 from sqlalchemy import create_engine, text
-from pathlib import Path
 
-DDL_PATH = Path(__file__).parent / "refresh_mv.sql"
+LOCK_KEY = 0x6d765f68697374  # 与后端相同的 advisory lock，和后端的刷新/重建串行
 
 
 def main():
@@ -21,24 +22,29 @@ def main():
     db_url = config.get("database", "url")
 
     engine = create_engine(db_url)
-    ddl = DDL_PATH.read_text(encoding="utf-8")
-
     with engine.begin() as conn:
+        conn.execute(text("SELECT pg_advisory_xact_lock(:k)"), {"k": LOCK_KEY})
         exists = conn.execute(text("""
             SELECT 1 FROM pg_matviews WHERE matviewname = 'stock_history_mv'
         """)).first()
-
         if not exists:
-            print("→ 首次创建 stock_history_mv ...")
-            conn.execute(text(ddl))
-            print("✅ 创建完成")
-        else:
-            print("→ MV 已存在，CONCURRENTLY 刷新 ...")
-            conn.execute(text("REFRESH MATERIALIZED VIEW CONCURRENTLY stock_history_mv;"))
-            print("✅ 增量刷新完成")
-
+            print("❌ stock_history_mv 不存在：启动后端即可创建（history_mv 任务）")
+            sys.exit(1)
+
+        start = time.time()
+        src_max = conn.execute(text("SELECT MAX(trade_date) FROM stock_daily_data")).scalar()
+        print("→ CONCURRENTLY 刷新 stock_history_mv ...")
+        conn.execute(text("REFRESH MATERIALIZED VIEW CONCURRENTLY stock_history_mv"))
+        mv_max = conn.execute(text("SELECT MAX(trade_date) FROM stock_history_mv")).scalar()
         cnt = conn.execute(text("SELECT COUNT(*) FROM stock_history_mv")).scalar()
-        print(f"   MV 当前行数: {cnt}")
+        conn.execute(text("""
+            UPDATE mv_meta
+               SET refreshed_at = NOW(), refresh_ms = :ms, source_max_date = :src,
+                   mv_max_date = :mv, mv_rows = :cnt,
+                   last_error = NULL, last_error_at = NULL, updated_at = NOW()
+             WHERE name = 'stock_history_mv'
+        """), {"ms": int((time.time() - start) * 1000), "src": src_max, "mv": mv_max, "cnt": cnt})
+        print(f"✅ 刷新完成，MV 当前行数: {cnt}，最新交易日: {mv_max}")
 
 
 if __name__ == "__main__":